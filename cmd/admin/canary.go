@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+)
+
+// runCanary lists, registers, and removes canary documents. A document is
+// hashed here, so that only its SHA-256 and ssdeep hashes reach the server.
+func runCanary(b backend, args []string) error {
+	if len(args) == 0 {
+		return errors.New("canary needs list, add, or remove")
+	}
+	switch args[0] {
+	case "list":
+		list, err := b.Canaries()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSHA256\tSSDEEP")
+		for _, c := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.SHA256, c.SSDeep)
+		}
+		return tw.Flush()
+
+	case "add":
+		if len(args) != 3 {
+			return errors.New("usage: canary add <name> <file>")
+		}
+		data, err := os.ReadFile(args[2]) // #nosec G304 -- operator-supplied path
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		c := canary.Canary{Name: args[1], SHA256: hex.EncodeToString(sum[:])}
+		if c.SSDeep, err = fuzzyhash.Sum(data); errors.Is(err, fuzzyhash.ErrTooSmall) {
+			fmt.Fprintln(os.Stderr, "File too small for a fuzzy hash: only exact copies will match")
+		} else if err != nil {
+			return err
+		}
+		if err := b.AddCanary(c); err != nil {
+			return err
+		}
+		fmt.Println("Registered canary", c.Name)
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return errors.New("usage: canary remove <name>")
+		}
+		if err := b.RemoveCanary(args[1]); err != nil {
+			return err
+		}
+		fmt.Println("Removed canary", args[1])
+		return nil
+	}
+	return fmt.Errorf("unknown canary command %q", args[0])
+}
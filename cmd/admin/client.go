@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/stats"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// apiBackend talks to a running server's admin API over its unix socket.
+type apiBackend struct {
+	client *http.Client
+	token  string
+}
+
+func newAPIBackend(socket, token string) *apiBackend {
+	return &apiBackend{
+		client: &http.Client{
+			Timeout: 5 * time.Minute, // cleanup of a large store can take a while
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		token: token,
+	}
+}
+
+// do sends a request to the admin API and decodes a JSON reply into out.
+// The host part of the URL is ignored; the socket is always used.
+func (b *apiBackend) do(method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, "http://admin"+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("admin API: %w", err)
+	}
+	defer resp.Body.Close()
+	warnScuttle(resp.Header.Get("X-Dead-Drop-Scuttle-Deadline"))
+	if resp.StatusCode >= 400 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("admin API: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// scuttleWarned keeps warnScuttle to one warning per run.
+var scuttleWarned sync.Once
+
+// warnScuttle prints the scuttle deadline the server sends when it is near,
+// whatever command was run.
+func warnScuttle(deadline string) {
+	at, err := time.Parse(time.RFC3339, deadline)
+	if err != nil {
+		return
+	}
+	scuttleWarned.Do(func() {
+		fmt.Fprintf(os.Stderr, "WARNING: the server scuttles its storage at %s (in %s) unless an operator checks in: run dead-drop-admin checkin\n",
+			at.Local().Format(time.RFC1123), time.Until(at).Truncate(time.Minute))
+	})
+}
+
+func (b *apiBackend) List(offset, limit int, filter storage.ListFilter) ([]storage.DropSummary, int, error) {
+	q := url.Values{}
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	if filter.Campaign != "" {
+		q.Set("campaign", filter.Campaign)
+	}
+	if filter.OlderThan > 0 {
+		q.Set("older_than_hours", strconv.Itoa(int(filter.OlderThan.Hours())))
+	}
+	if filter.NewerThan > 0 {
+		q.Set("newer_than_hours", strconv.Itoa(int(filter.NewerThan.Hours())))
+	}
+	if filter.LegalHold {
+		q.Set("legal_hold", "true")
+	}
+	var reply struct {
+		Drops []storage.DropSummary `json:"drops"`
+		Total int                   `json:"total"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/drops?"+q.Encode(), nil, &reply)
+	return reply.Drops, reply.Total, err
+}
+
+func (b *apiBackend) Inspect(id string) (*storage.DropInfo, error) {
+	var info storage.DropInfo
+	if err := b.do(http.MethodGet, "/admin/v1/drops/"+url.PathEscape(id), nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (b *apiBackend) Delete(id string) error {
+	return b.do(http.MethodDelete, "/admin/v1/drops/"+url.PathEscape(id), nil, nil)
+}
+
+func (b *apiBackend) Pin(id, reason string) error {
+	return b.do(http.MethodPost, "/admin/v1/drops/"+url.PathEscape(id)+"/hold", url.Values{"reason": {reason}}, nil)
+}
+
+func (b *apiBackend) Unpin(id string) (string, error) {
+	var reply map[string]string
+	err := b.do(http.MethodDelete, "/admin/v1/drops/"+url.PathEscape(id)+"/hold", nil, &reply)
+	return reply["status"], err
+}
+
+func (b *apiBackend) Quota() (*quotaReport, error) {
+	var q quotaReport
+	if err := b.do(http.MethodGet, "/admin/v1/quota", nil, &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+func (b *apiBackend) Purge() (int, error) {
+	var reply struct {
+		Deleted int `json:"deleted"`
+	}
+	err := b.do(http.MethodPost, "/admin/v1/cleanup", nil, &reply)
+	return reply.Deleted, err
+}
+
+func (b *apiBackend) Clusters(campaign string, threshold int) ([][]string, error) {
+	q := url.Values{"threshold": {strconv.Itoa(threshold)}}
+	if campaign != "" {
+		q.Set("campaign", campaign)
+	}
+	var reply struct {
+		Clusters [][]string `json:"clusters"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/clusters?"+q.Encode(), nil, &reply)
+	return reply.Clusters, err
+}
+
+func (b *apiBackend) Campaigns() (map[string]storage.CampaignCount, error) {
+	var reply struct {
+		Campaigns map[string]storage.CampaignCount `json:"campaigns"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/campaigns", nil, &reply)
+	return reply.Campaigns, err
+}
+
+func (b *apiBackend) CSPReports() ([]cspViolation, error) {
+	var reply struct {
+		Violations []cspViolation `json:"violations"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/csp-reports", nil, &reply)
+	return reply.Violations, err
+}
+
+func (b *apiBackend) Stats(since time.Time) ([]stats.Bucket, error) {
+	q := url.Values{}
+	if !since.IsZero() {
+		q.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	var reply struct {
+		Stats []stats.Bucket `json:"stats"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/stats?"+q.Encode(), nil, &reply)
+	return reply.Stats, err
+}
+
+func (b *apiBackend) CheckIn() (*checkInStatus, error) {
+	var st checkInStatus
+	if err := b.do(http.MethodPost, "/admin/v1/checkin", url.Values{}, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (b *apiBackend) CheckInStatus() (*checkInStatus, error) {
+	var st checkInStatus
+	if err := b.do(http.MethodGet, "/admin/v1/checkin", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (b *apiBackend) ReloadConfig() (*reloadResult, error) {
+	var result reloadResult
+	if err := b.do(http.MethodPost, "/admin/v1/config/reload", url.Values{}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *apiBackend) Canaries() ([]canary.Canary, error) {
+	var reply struct {
+		Canaries []canary.Canary `json:"canaries"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/canaries", nil, &reply)
+	return reply.Canaries, err
+}
+
+func (b *apiBackend) AddCanary(c canary.Canary) error {
+	return b.do(http.MethodPost, "/admin/v1/canaries", url.Values{
+		"name": {c.Name}, "sha256": {c.SHA256}, "ssdeep": {c.SSDeep},
+	}, nil)
+}
+
+func (b *apiBackend) RemoveCanary(name string) error {
+	return b.do(http.MethodDelete, "/admin/v1/canaries/"+url.PathEscape(name), nil, nil)
+}
+
+func (b *apiBackend) Quarantined() ([]storage.DropSummary, error) {
+	var reply struct {
+		Quarantine []storage.DropSummary `json:"quarantine"`
+	}
+	err := b.do(http.MethodGet, "/admin/v1/quarantine", nil, &reply)
+	return reply.Quarantine, err
+}
+
+func (b *apiBackend) Quarantine(id, reason string) error {
+	return b.do(http.MethodPost, "/admin/v1/drops/"+url.PathEscape(id)+"/quarantine", url.Values{"reason": {reason}}, nil)
+}
+
+func (b *apiBackend) ReleaseQuarantine(id string) error {
+	return b.do(http.MethodPost, "/admin/v1/quarantine/"+url.PathEscape(id)+"/release", nil, nil)
+}
+
+func (b *apiBackend) PurgeQuarantine(id string) error {
+	return b.do(http.MethodDelete, "/admin/v1/quarantine/"+url.PathEscape(id), nil, nil)
+}
+
+func (b *apiBackend) Forward(id, destination string, remove bool) (*forwardResult, error) {
+	form := url.Values{"destination": {destination}}
+	if remove {
+		form.Set("delete", "true")
+	}
+	var result forwardResult
+	if err := b.do(http.MethodPost, "/admin/v1/drops/"+url.PathEscape(id)+"/forward", form, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
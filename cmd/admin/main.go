@@ -0,0 +1,474 @@
+// Command dead-drop-admin is the operator CLI. It talks to a running server's
+// admin API over its unix socket, or with -offline works on the storage
+// directory directly while the server is stopped. Drop contents and receipts
+// are never shown, except the credentials another instance issues for a
+// forwarded drop.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+	"github.com/scttfrdmn/dead-drop/internal/stats"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// quotaReport mirrors the reply of GET /admin/v1/quota.
+type quotaReport struct {
+	TotalBytes int64 `json:"total_bytes"`
+	DropCount  int   `json:"drop_count"`
+	MaxBytes   int64 `json:"max_bytes"`
+	MaxDrops   int   `json:"max_drops"`
+
+	// How much the storage key has encrypted, and its limits (0 = none)
+	KeyBytes       int64 `json:"key_bytes"`
+	KeyMessages    int64 `json:"key_messages"`
+	KeyMaxBytes    int64 `json:"key_max_bytes"`
+	KeyMaxMessages int64 `json:"key_max_messages"`
+}
+
+// forwardResult mirrors the reply of POST /admin/v1/drops/{id}/forward: the
+// credentials the destination issued for the forwarded drop.
+type forwardResult struct {
+	Status      string `json:"status"`
+	Destination string `json:"destination"`
+	Remote      struct {
+		DropID     string `json:"drop_id"`
+		Receipt    string `json:"receipt,omitempty"`
+		ReceiptURL string `json:"receipt_url,omitempty"`
+	} `json:"remote"`
+}
+
+// cspViolation is a count of Content-Security-Policy violation reports of
+// one directive and blocked source.
+type cspViolation struct {
+	Directive string `json:"directive"`
+	Blocked   string `json:"blocked"`
+	Count     int64  `json:"count"`
+}
+
+// checkInStatus mirrors the reply of the /admin/v1/checkin endpoints.
+type checkInStatus struct {
+	LastCheckIn time.Time `json:"last_checkin"`
+	Deadline    time.Time `json:"deadline"` // zero when not known (offline)
+}
+
+// reloadResult mirrors the reply of /admin/v1/config/reload.
+type reloadResult struct {
+	Applied []string `json:"applied"`
+	Restart []string `json:"restart_required"`
+}
+
+// backend is implemented by the admin API client and the offline store.
+type backend interface {
+	List(offset, limit int, filter storage.ListFilter) ([]storage.DropSummary, int, error)
+	Inspect(id string) (*storage.DropInfo, error)
+	Delete(id string) error
+	Pin(id, reason string) error
+	Unpin(id string) (string, error)
+	Quota() (*quotaReport, error)
+	Purge() (int, error)
+	Clusters(campaign string, threshold int) ([][]string, error)
+	Campaigns() (map[string]storage.CampaignCount, error)
+	Canaries() ([]canary.Canary, error)
+	AddCanary(c canary.Canary) error
+	RemoveCanary(name string) error
+	Quarantined() ([]storage.DropSummary, error)
+	Quarantine(id, reason string) error
+	ReleaseQuarantine(id string) error
+	PurgeQuarantine(id string) error
+	Forward(id, destination string, remove bool) (*forwardResult, error)
+	CSPReports() ([]cspViolation, error)
+	Stats(since time.Time) ([]stats.Bucket, error)
+	CheckIn() (*checkInStatus, error)
+	CheckInStatus() (*checkInStatus, error)
+	ReloadConfig() (*reloadResult, error)
+}
+
+const usage = `Usage: dead-drop-admin [flags] <command> [args]
+
+Commands:
+  list [-sort age|size|id] [-offset N] [-limit N] [-campaign C]
+       [-older-than D] [-newer-than D] [-held]
+                             List drops (no filenames), a page at a time
+  inspect <id>               Show a drop's metadata (never contents or receipt)
+  delete <id>                Delete a drop (refused under legal hold)
+  pin <id> [reason]          Place a legal hold
+  unpin <id>                 Approve lifting a legal hold (two admins required)
+  quota                      Report storage usage and limits
+  purge                      Run a cleanup pass now
+  clusters [-campaign C] [-threshold N]
+                             Group near-duplicate drops by fuzzy hash
+  campaigns                  Count drops and stored bytes per campaign
+  csp-reports                Count the web UI's CSP violation reports by
+                             directive and blocked source
+  stats [-since D] [-json]   Show hourly usage totals (submissions, retrievals,
+                             refused uploads, bytes) for the last D (e.g. 720h)
+  checkin [-status]          Check in as an operator, putting off the scuttle
+                             timer (scuttle.after_days); -status only shows it
+  reload-config              Re-read the server's config file, as SIGHUP does,
+                             applying rate limits, quotas, the upload size
+                             limit, and logging flags
+  canary list                List registered canary documents
+  canary add <name> <file>   Register a canary (only its hashes are sent)
+  canary remove <name>       Unregister a canary
+  quarantine list            List quarantined drops and why they were held
+  quarantine add <id> [reason]
+                             Move a drop into quarantine
+  quarantine release <id>    Make a quarantined drop retrievable again
+  quarantine purge <id>      Delete a quarantined drop (refused under legal hold)
+  forward [-delete] <id> <destination>
+                             Seal a drop to another dead-drop instance named in
+                             forwarding.destinations; prints the credentials
+                             it issued, for its receivers
+  secret set|list|delete     Manage secrets for secret:// config references
+                             (value on stdin; needs DEAD_DROP_MASTER_KEY)
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	socket := flag.String("socket", "/run/dead-drop/admin.sock", "Admin API unix socket")
+	tokenEnv := flag.String("token-env", "DEAD_DROP_ADMIN_TOKEN", "Environment variable holding the admin token")
+	offline := flag.Bool("offline", false, "Work on the storage directory directly (server must be stopped)")
+	storageDir := flag.String("storage-dir", "./drops", "Storage directory for -offline and secret")
+	auditLog := flag.String("audit-log", "", "Audit log for -offline (default: .audit.log in the storage directory)")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Secrets are read by the server at startup only, so they are managed on
+	// the storage directory whether or not the server is running
+	if args[0] == "secret" {
+		if err := runSecret(*storageDir, args[1:]); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+
+	var b backend
+	if *offline {
+		ob, err := newOfflineBackend(*storageDir, *auditLog)
+		if err != nil {
+			log.Fatalf("Failed to open storage: %v", err)
+		}
+		b = ob
+	} else {
+		token := os.Getenv(*tokenEnv)
+		if token == "" {
+			log.Fatalf("%s must hold an admin token (or use -offline)", *tokenEnv)
+		}
+		b = newAPIBackend(*socket, token)
+	}
+
+	err := run(b, args[0], args[1:])
+	if ob, ok := b.(*offlineBackend); ok {
+		ob.Close() // zero the keys before exiting
+	}
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+func run(b backend, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		sortBy := fs.String("sort", "age", "Sort the page by age (oldest first), size (largest first), or id")
+		offset := fs.Int("offset", 0, "Skip this many drops, in ID order")
+		limit := fs.Int("limit", 0, "List at most this many drops (0 = all)")
+		var filter storage.ListFilter
+		fs.StringVar(&filter.Campaign, "campaign", "", "Only drops under this campaign code")
+		fs.DurationVar(&filter.OlderThan, "older-than", 0, "Only drops received at least this long ago (e.g. 720h)")
+		fs.DurationVar(&filter.NewerThan, "newer-than", 0, "Only drops received less than this long ago")
+		fs.BoolVar(&filter.LegalHold, "held", false, "Only drops under legal hold")
+		_ = fs.Parse(args)
+		if *offset < 0 || *limit < 0 {
+			return fmt.Errorf("-offset and -limit must not be negative")
+		}
+		drops, total, err := b.List(*offset, *limit, filter)
+		if err != nil {
+			return err
+		}
+		if err := sortDrops(drops, *sortBy); err != nil {
+			return err
+		}
+		printDrops(drops)
+		if len(drops) < total {
+			fmt.Printf("\n%d of %d drops from offset %d\n", len(drops), total, *offset)
+		}
+		return nil
+
+	case "inspect":
+		id, err := oneID(args)
+		if err != nil {
+			return err
+		}
+		info, err := b.Inspect(id)
+		if err != nil {
+			return err
+		}
+		return printJSON(info)
+
+	case "delete":
+		id, err := oneID(args)
+		if err != nil {
+			return err
+		}
+		if err := b.Delete(id); err != nil {
+			return err
+		}
+		fmt.Println("Deleted", id)
+		return nil
+
+	case "pin":
+		if len(args) < 1 {
+			return fmt.Errorf("pin needs a drop ID")
+		}
+		if err := b.Pin(args[0], strings.Join(args[1:], " ")); err != nil {
+			return err
+		}
+		fmt.Println("Legal hold placed on", args[0])
+		return nil
+
+	case "unpin":
+		id, err := oneID(args)
+		if err != nil {
+			return err
+		}
+		status, err := b.Unpin(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", id, status)
+		return nil
+
+	case "quota":
+		q, err := b.Quota()
+		if err != nil {
+			return err
+		}
+		return printJSON(q)
+
+	case "purge":
+		deleted, err := b.Purge()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Cleanup deleted %d expired drops\n", deleted)
+		return nil
+
+	case "clusters":
+		fs := flag.NewFlagSet("clusters", flag.ExitOnError)
+		campaign := fs.String("campaign", "", "Only drops submitted under this campaign")
+		threshold := fs.Int("threshold", fuzzyhash.DefaultThreshold, "Similarity score (1-100) that groups two drops")
+		_ = fs.Parse(args)
+		clusters, err := b.Clusters(*campaign, *threshold)
+		if err != nil {
+			return err
+		}
+		for _, ids := range clusters {
+			fmt.Println(strings.Join(ids, " "))
+		}
+		return nil
+
+	case "campaigns":
+		counts, err := b.Campaigns()
+		if err != nil {
+			return err
+		}
+		printCampaigns(counts)
+		return nil
+
+	case "csp-reports":
+		violations, err := b.CSPReports()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COUNT\tDIRECTIVE\tBLOCKED")
+		for _, v := range violations {
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", v.Count, v.Directive, v.Blocked)
+		}
+		return tw.Flush()
+
+	case "stats":
+		fs := flag.NewFlagSet("stats", flag.ExitOnError)
+		since := fs.Duration("since", 0, "Only hours less than this long ago (0 = all)")
+		asJSON := fs.Bool("json", false, "Print the totals as JSON, for reports")
+		_ = fs.Parse(args)
+		var from time.Time
+		if *since > 0 {
+			from = time.Now().Add(-*since)
+		}
+		buckets, err := b.Stats(from)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			return printJSON(buckets)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "HOUR\tSUBMISSIONS\tRETRIEVALS\tREJECTIONS\tBYTES IN\tBYTES OUT")
+		for _, h := range buckets {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\n", h.Time.Format("2006-01-02 15:00"),
+				h.Submissions, h.Retrievals, h.Rejections, h.BytesSubmitted, h.BytesRetrieved)
+		}
+		return tw.Flush()
+
+	case "checkin":
+		fs := flag.NewFlagSet("checkin", flag.ExitOnError)
+		statusOnly := fs.Bool("status", false, "Show the last check-in and deadline without checking in")
+		_ = fs.Parse(args)
+		var st *checkInStatus
+		var err error
+		if *statusOnly {
+			st, err = b.CheckInStatus()
+		} else {
+			st, err = b.CheckIn()
+		}
+		if err != nil {
+			return err
+		}
+		if st.LastCheckIn.IsZero() {
+			fmt.Println("Last check-in: never")
+		} else {
+			fmt.Printf("Last check-in: %s\n", st.LastCheckIn.Local().Format(time.RFC1123))
+		}
+		if !st.Deadline.IsZero() {
+			fmt.Printf("Scuttled at:   %s (in %s) without another check-in\n",
+				st.Deadline.Local().Format(time.RFC1123), time.Until(st.Deadline).Truncate(time.Minute))
+		}
+		return nil
+
+	case "reload-config":
+		result, err := b.ReloadConfig()
+		if err != nil {
+			return err
+		}
+		if len(result.Applied) == 0 {
+			fmt.Println("Config reloaded; no reloadable setting changed")
+		} else {
+			fmt.Printf("Config reloaded; applied %s\n", strings.Join(result.Applied, ", "))
+		}
+		if len(result.Restart) > 0 {
+			fmt.Printf("Changes to %s take effect at restart\n", strings.Join(result.Restart, ", "))
+		}
+		return nil
+
+	case "canary":
+		return runCanary(b, args)
+
+	case "quarantine":
+		return runQuarantine(b, args)
+
+	case "forward":
+		fs := flag.NewFlagSet("forward", flag.ExitOnError)
+		remove := fs.Bool("delete", false, "Delete the drop here once the destination has it")
+		_ = fs.Parse(args)
+		if fs.NArg() != 2 {
+			return fmt.Errorf("forward needs a drop ID and a destination")
+		}
+		result, err := b.Forward(fs.Arg(0), fs.Arg(1), *remove)
+		if err != nil {
+			return err
+		}
+		return printJSON(result)
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func oneID(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected one drop ID")
+	}
+	return args[0], nil
+}
+
+func sortDrops(drops []storage.DropSummary, by string) error {
+	var less func(a, b storage.DropSummary) bool
+	switch by {
+	case "age":
+		less = func(a, b storage.DropSummary) bool { return a.TimestampHour < b.TimestampHour }
+	case "size":
+		less = func(a, b storage.DropSummary) bool { return a.Size > b.Size }
+	case "id":
+		less = func(a, b storage.DropSummary) bool { return a.ID < b.ID }
+	default:
+		return fmt.Errorf("unknown sort %q", by)
+	}
+	sort.SliceStable(drops, func(i, j int) bool { return less(drops[i], drops[j]) })
+	return nil
+}
+
+func printDrops(drops []storage.DropSummary) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tAGE\tSIZE\tCLASS\tCAMPAIGN\tSTATS\tHOLD\tPROCESSING\tNOTE\tREPLY")
+	now := time.Now()
+	for _, d := range drops {
+		age := now.Sub(time.Unix(d.TimestampHour, 0)).Truncate(time.Hour)
+		hold := ""
+		if d.LegalHold {
+			hold = "held"
+		}
+		note := ""
+		if d.Note != nil {
+			note = d.Note.Status
+		}
+		reply := ""
+		if d.Replied {
+			reply = "sent"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, age, d.Size, d.Retention, d.Campaign, d.Stats, hold, d.Processing, note, reply)
+	}
+	_ = tw.Flush()
+}
+
+func printCampaigns(counts map[string]storage.CampaignCount) {
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CAMPAIGN\tDROPS\tBYTES")
+	for _, code := range codes {
+		name := code
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", name, counts[code].Drops, counts[code].Bytes)
+	}
+	_ = tw.Flush()
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/audit"
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/stats"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// offlineActor is the audit log actor for changes made without the server.
+const offlineActor = "offline"
+
+// errNeedsServer is returned for commands whose safeguards live in the
+// running server.
+var errNeedsServer = errors.New("not available offline: use the admin API of the running server")
+
+// offlineBackend works on the storage directory directly while the server is
+// stopped. Changes are still written to the audit log.
+type offlineBackend struct {
+	storage  *storage.Manager
+	audit    *audit.Log
+	canaries *canary.Store
+	stats    *stats.Store
+}
+
+// newOfflineBackend opens storageDir with the master passphrase in
+// DEAD_DROP_MASTER_KEY (if the keys are wrapped). It refuses a directory
+// without keys rather than generating new ones.
+func newOfflineBackend(storageDir, auditPath string) (*offlineBackend, error) {
+	if _, err := os.Stat(filepath.Join(storageDir, ".encryption.key")); err != nil {
+		return nil, fmt.Errorf("%s is not a dead-drop storage directory: %w", storageDir, err)
+	}
+	if err := storage.UseIDFormat(storageDir, nil); err != nil {
+		return nil, err
+	}
+
+	var masterKey []byte
+	if passphrase := os.Getenv("DEAD_DROP_MASTER_KEY"); passphrase != "" {
+		salt, err := crypto.LoadOrGenerateSalt(storageDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load salt: %w", err)
+		}
+		masterKey = crypto.DeriveMasterKey(passphrase, salt)
+		defer crypto.ZeroBytes(masterKey)
+	}
+	m, err := storage.NewManager(storageDir, masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if auditPath == "" {
+		auditPath = filepath.Join(storageDir, ".audit.log")
+	}
+	auditLog, err := audit.Open(auditPath)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	// Offline, the canary file and stats log are assumed at their default paths
+	canaries := canary.New(filepath.Join(storageDir, ".canaries"), func() ([]byte, error) {
+		return m.SubKey("canaries")
+	}, 0)
+	usage := stats.New(filepath.Join(storageDir, ".stats"), func() ([]byte, error) {
+		return m.SubKey("stats")
+	})
+	return &offlineBackend{storage: m, audit: auditLog, canaries: canaries, stats: usage}, nil
+}
+
+func (b *offlineBackend) Close() {
+	_ = b.audit.Close()
+	b.storage.Close()
+}
+
+func (b *offlineBackend) List(offset, limit int, filter storage.ListFilter) ([]storage.DropSummary, int, error) {
+	return b.storage.DropsPage(offset, limit, filter)
+}
+
+func (b *offlineBackend) Inspect(id string) (*storage.DropInfo, error) {
+	info, err := b.storage.Inspect(id)
+	if err != nil {
+		return nil, err
+	}
+	return info, b.audit.Record(offlineActor, "drop_inspected", id, "")
+}
+
+func (b *offlineBackend) Delete(id string) error {
+	if err := b.storage.DeleteDrop(id); err != nil {
+		if errors.Is(err, storage.ErrLegalHold) {
+			_ = b.audit.Record(offlineActor, "drop_delete_refused", id, "legal hold")
+		}
+		return err
+	}
+	return b.audit.Record(offlineActor, "drop_deleted", id, "")
+}
+
+func (b *offlineBackend) Pin(id, reason string) error {
+	if err := b.storage.SetLegalHold(id, true); err != nil {
+		return err
+	}
+	return b.audit.Record(offlineActor, "legal_hold_set", id, reason)
+}
+
+// Unpin is refused offline: lifting a hold needs two admins' approval,
+// which only the admin API enforces.
+func (b *offlineBackend) Unpin(string) (string, error) {
+	return "", errNeedsServer
+}
+
+func (b *offlineBackend) Quota() (*quotaReport, error) {
+	q, err := storage.NewQuotaManager(b.storage.StorageDir, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var report quotaReport
+	report.TotalBytes, report.DropCount = q.Stats()
+	if usage, err := b.storage.KeyUsage(); err == nil {
+		report.KeyBytes, report.KeyMessages = usage.Bytes, usage.Messages
+	}
+	return &report, nil
+}
+
+// Purge is refused offline: retention classes and the maximum age are in
+// the server's configuration, and guessing them could delete drops early.
+func (b *offlineBackend) Purge() (int, error) {
+	return 0, errNeedsServer
+}
+
+func (b *offlineBackend) Clusters(campaign string, threshold int) ([][]string, error) {
+	return b.storage.Clusters(campaign, threshold)
+}
+
+// Campaigns counts drops offline; campaigns configured on the server but
+// without drops are not listed.
+func (b *offlineBackend) Campaigns() (map[string]storage.CampaignCount, error) {
+	return b.storage.CampaignCounts()
+}
+
+func (b *offlineBackend) Canaries() ([]canary.Canary, error) {
+	return b.canaries.List()
+}
+
+func (b *offlineBackend) AddCanary(c canary.Canary) error {
+	if err := b.canaries.Add(c); err != nil {
+		return err
+	}
+	return b.audit.Record(offlineActor, "canary_registered", "", c.Name)
+}
+
+func (b *offlineBackend) RemoveCanary(name string) error {
+	if err := b.canaries.Remove(name); err != nil {
+		return err
+	}
+	return b.audit.Record(offlineActor, "canary_removed", "", name)
+}
+
+func (b *offlineBackend) Quarantined() ([]storage.DropSummary, error) {
+	return b.storage.Quarantined()
+}
+
+func (b *offlineBackend) Quarantine(id, reason string) error {
+	if reason == "" {
+		reason = "operator"
+	}
+	if len(reason) > storage.MaxQuarantineReason {
+		return fmt.Errorf("reason longer than %d bytes", storage.MaxQuarantineReason)
+	}
+	if err := b.storage.Quarantine(id, reason); err != nil {
+		return err
+	}
+	return b.audit.Record(offlineActor, "drop_quarantined", id, reason)
+}
+
+func (b *offlineBackend) ReleaseQuarantine(id string) error {
+	if err := b.storage.ReleaseQuarantine(id); err != nil {
+		return err
+	}
+	return b.audit.Record(offlineActor, "quarantine_released", id, "")
+}
+
+func (b *offlineBackend) PurgeQuarantine(id string) error {
+	if err := b.storage.PurgeQuarantine(id); err != nil {
+		if errors.Is(err, storage.ErrLegalHold) {
+			_ = b.audit.Record(offlineActor, "quarantine_purge_refused", id, "legal hold")
+		}
+		return err
+	}
+	return b.audit.Record(offlineActor, "quarantine_purged", id, "")
+}
+
+// Forward is refused offline: destinations, and the Tor proxy to reach
+// them, are in the server's configuration.
+func (b *offlineBackend) Forward(string, string, bool) (*forwardResult, error) {
+	return nil, errNeedsServer
+}
+
+// CSPReports is refused offline: the counts live in the server's memory.
+func (b *offlineBackend) CSPReports() ([]cspViolation, error) {
+	return nil, errNeedsServer
+}
+
+// Stats reads the usage statistics log. Totals the server had not written
+// when it stopped are lost.
+func (b *offlineBackend) Stats(since time.Time) ([]stats.Bucket, error) {
+	return b.stats.Buckets(since)
+}
+
+// CheckIn records a check-in on the storage directory, so that a server
+// stopped for longer than scuttle.after_days does not scuttle it at start.
+func (b *offlineBackend) CheckIn() (*checkInStatus, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := storage.CheckIn(b.storage.StorageDir, now); err != nil {
+		return nil, err
+	}
+	if err := b.audit.Record(offlineActor, "checkin", "", ""); err != nil {
+		return nil, err
+	}
+	return &checkInStatus{LastCheckIn: now}, nil
+}
+
+// CheckInStatus shows the last check-in only: the deadline depends on the
+// server's configuration.
+func (b *offlineBackend) CheckInStatus() (*checkInStatus, error) {
+	last, err := storage.LastCheckIn(b.storage.StorageDir)
+	if err != nil {
+		return nil, err
+	}
+	return &checkInStatus{LastCheckIn: last}, nil
+}
+
+// ReloadConfig is refused offline: there is no running server to reload.
+func (b *offlineBackend) ReloadConfig() (*reloadResult, error) {
+	return nil, errNeedsServer
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runQuarantine lists quarantined drops, and moves drops into and out of
+// quarantine.
+func runQuarantine(b backend, args []string) error {
+	if len(args) == 0 {
+		return errors.New("quarantine needs list, add, release, or purge")
+	}
+	switch args[0] {
+	case "list":
+		drops, err := b.Quarantined()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tAGE\tSIZE\tCAMPAIGN\tHOLD\tREASON")
+		now := time.Now()
+		for _, d := range drops {
+			age := now.Sub(time.Unix(d.TimestampHour, 0)).Truncate(time.Hour)
+			hold := ""
+			if d.LegalHold {
+				hold = "held"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\n", d.ID, age, d.Size, d.Campaign, hold, d.Quarantine)
+		}
+		return tw.Flush()
+
+	case "add":
+		if len(args) < 2 {
+			return errors.New("usage: quarantine add <id> [reason]")
+		}
+		if err := b.Quarantine(args[1], strings.Join(args[2:], " ")); err != nil {
+			return err
+		}
+		fmt.Println("Quarantined", args[1])
+		return nil
+
+	case "release":
+		id, err := oneID(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := b.ReleaseQuarantine(id); err != nil {
+			return err
+		}
+		fmt.Println("Released", id)
+		return nil
+
+	case "purge":
+		id, err := oneID(args[1:])
+		if err != nil {
+			return err
+		}
+		if err := b.PurgeQuarantine(id); err != nil {
+			return err
+		}
+		fmt.Println("Purged", id)
+		return nil
+	}
+	return fmt.Errorf("unknown quarantine command %q", args[0])
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// runSecret manages the encrypted secrets file that secret:// references in
+// config.yaml resolve from. It needs the master passphrase in
+// DEAD_DROP_MASTER_KEY but not the server. Values are read from stdin so
+// they stay out of shell history.
+func runSecret(storageDir string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("secret needs set, list, or delete")
+	}
+	passphrase := os.Getenv("DEAD_DROP_MASTER_KEY")
+	if passphrase == "" {
+		return errors.New("DEAD_DROP_MASTER_KEY must be set: the secrets file is sealed with the master key")
+	}
+	salt, err := crypto.LoadOrGenerateSalt(storageDir)
+	if err != nil {
+		return fmt.Errorf("failed to load salt: %w", err)
+	}
+	masterKey := crypto.DeriveMasterKey(passphrase, salt)
+	defer crypto.ZeroBytes(masterKey)
+
+	secrets, err := config.LoadSecrets(storageDir, masterKey)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		names := make([]string, 0, len(secrets))
+		for name := range secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+
+	case "set":
+		if len(args) != 2 {
+			return errors.New("secret set needs a name")
+		}
+		fmt.Fprintf(os.Stderr, "Value for %s: ", args[1])
+		value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && value == "" {
+			return fmt.Errorf("failed to read value: %w", err)
+		}
+		if value = strings.TrimRight(value, "\r\n"); value == "" {
+			return errors.New("empty value")
+		}
+		secrets[args[1]] = value
+		if err := config.SaveSecrets(storageDir, masterKey, secrets); err != nil {
+			return err
+		}
+		fmt.Printf("Stored %s; reference it as secret://%s\n", args[1], args[1])
+		return nil
+
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("secret delete needs a name")
+		}
+		if _, ok := secrets[args[1]]; !ok {
+			return fmt.Errorf("no secret %q", args[1])
+		}
+		delete(secrets, args[1])
+		if err := config.SaveSecrets(storageDir, masterKey, secrets); err != nil {
+			return err
+		}
+		fmt.Println("Deleted", args[1])
+		return nil
+	}
+	return fmt.Errorf("unknown secret command %q", args[0])
+}
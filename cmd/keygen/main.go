@@ -0,0 +1,115 @@
+// Command dead-drop-keygen runs a key ceremony on an air-gapped machine: it
+// generates the master salt, the encryption and receipt keys wrapped to the
+// master passphrase, and optional recipient key pairs, and writes a bundle
+// the server imports on first start (security.key_bundle). With
+// -recipient-only it generates just the recipient key pairs: the receivers'
+// age X25519 identity, whose age1 recipient the server publishes as
+// security.recipient_key for sources to seal files to. Identities are
+// written in the format of age-keygen, so age itself can use them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func main() {
+	out := flag.String("out", "dead-drop-keys.json", "Path to write the key bundle")
+	recipients := flag.String("recipients", "", "Comma-separated names of recipient key pairs to generate")
+	recipientDir := flag.String("recipient-dir", ".", "Directory to write recipient private keys")
+	recipientOnly := flag.Bool("recipient-only", false, "Generate only the -recipients key pairs, without a key bundle or master passphrase")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
+	var names []string
+	for _, name := range strings.Split(*recipients, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+				log.Fatalf("Invalid recipient name %q", name)
+			}
+			names = append(names, name)
+		}
+	}
+
+	if *recipientOnly {
+		if len(names) == 0 {
+			log.Fatal("-recipient-only needs -recipients")
+		}
+		for _, name := range names {
+			id, err := age.GenerateX25519Identity()
+			if err != nil {
+				log.Fatalf("Failed to generate key: %v", err)
+			}
+			writeRecipient(*recipientDir, name, id)
+		}
+		fmt.Println("\nSet security.recipient_key to the public key the receivers' drops should be")
+		fmt.Println("sealed to, and publish its fingerprint where sources can compare it.")
+		return
+	}
+
+	passphrase := os.Getenv("DEAD_DROP_MASTER_KEY")
+	if passphrase == "" {
+		log.Fatal("DEAD_DROP_MASTER_KEY environment variable must be set")
+	}
+
+	if _, err := os.Stat(*out); err == nil {
+		log.Fatalf("Refusing to overwrite existing bundle %s", *out)
+	}
+
+	bundle, private, err := storage.GenerateKeyBundle(passphrase, names)
+	if err != nil {
+		log.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	for _, r := range bundle.Recipients {
+		writeRecipient(*recipientDir, r.Name, private[r.Name])
+	}
+
+	if err := bundle.Save(*out); err != nil {
+		log.Fatalf("Failed to save bundle: %v", err)
+	}
+
+	fmt.Printf("Key bundle written to %s\n", *out)
+	fmt.Println("\nCopy the bundle to the server, set security.key_bundle to its path, and start")
+	fmt.Println("the server with the same master passphrase. Delete the bundle from the server")
+	fmt.Println("after the first start; keep an offline backup.")
+}
+
+// writeRecipient writes a recipient's identity to recipient-<name>.key in
+// dir, as age-keygen would, and prints the public key and its fingerprint.
+func writeRecipient(dir, name string, id *age.X25519Identity) {
+	path := filepath.Join(dir, "recipient-"+name+".key")
+	public := id.Recipient()
+	encoded := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().UTC().Format(time.RFC3339), public, id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- path from operator flags
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", path, err)
+	}
+	if _, err := f.WriteString(encoded); err != nil {
+		_ = f.Close()
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	fmt.Printf("Recipient private key: %s (keep offline)\n", path)
+	fmt.Printf("  Public key:  %s\n", public)
+	fmt.Printf("  Fingerprint: %s\n", crypto.RecipientFingerprint(public))
+}
@@ -0,0 +1,332 @@
+// dead-drop-release builds the release binaries reproducibly: statically
+// linked (CGO disabled), with paths trimmed, no build ID, and the version,
+// commit and commit time linked into internal/buildinfo. Building the same
+// commit with the same Go toolchain gives byte-identical binaries, so an
+// operator can rebuild a release from source and compare its SHA256SUMS
+// with the published one (-verify does the comparison).
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/minisign"
+)
+
+const buildinfoPkg = "github.com/scttfrdmn/dead-drop/internal/buildinfo"
+
+// commands maps each binary to the package it is built from.
+var commands = map[string]string{
+	"dead-drop-server":        "./cmd/server",
+	"dead-drop-submit":        "./cmd/submit",
+	"dead-drop-retrieve":      "./cmd/retrieve",
+	"dead-drop-rotate-keys":   "./cmd/rotate-keys",
+	"dead-drop-keygen":        "./cmd/keygen",
+	"dead-drop-unseal":        "./cmd/unseal",
+	"dead-drop-admin":         "./cmd/admin",
+	"dead-drop-verify-binary": "./cmd/verify-binary",
+}
+
+const defaultTargets = "linux/amd64,linux/arm64,darwin/amd64,darwin/arm64"
+
+// artifact is one built binary in the manifest.
+type artifact struct {
+	Name   string `json:"name"`
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// manifest records what a release was built from and the hash of each
+// binary, written as manifest.json beside SHA256SUMS.
+type manifest struct {
+	Version   string     `json:"version"`
+	Commit    string     `json:"commit"`
+	BuildTime string     `json:"build_time"`
+	GoVersion string     `json:"go_version"`
+	Artifacts []artifact `json:"artifacts"`
+}
+
+func main() {
+	outDir := flag.String("out", "dist", "Directory to write the binaries and manifests")
+	version := flag.String("version", "", "Release version (default: git describe --tags --always)")
+	targets := flag.String("targets", defaultTargets, "Comma-separated GOOS/GOARCH pairs to build")
+	only := flag.String("commands", "", "Comma-separated binaries to build (default: all)")
+	allowDirty := flag.Bool("allow-dirty", false, "Build from a working tree with uncommitted changes (not reproducible)")
+	verify := flag.String("verify", "", "SHA256SUMS of a published release to compare the new builds with")
+	signingKey := flag.String("signing-key", "", "Minisign public key file to link in for dead-drop-verify-binary")
+	flag.Parse()
+
+	if err := run(*outDir, *version, *targets, *only, *allowDirty, *verify, *signingKey); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(outDir, version, targets, only string, allowDirty bool, verify, signingKey string) error {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("release builds need a git checkout: %w", err)
+	}
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	status, err := git("status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return err
+	}
+	dirty := status != ""
+	if dirty && !allowDirty {
+		return fmt.Errorf("working tree has uncommitted changes; commit them or pass -allow-dirty")
+	}
+	if version == "" {
+		if version, err = git("describe", "--tags", "--always"); err != nil {
+			return err
+		}
+		if dirty {
+			version += "-dirty"
+		}
+	}
+	buildTime, err := sourceTime()
+	if err != nil {
+		return err
+	}
+	goVersion, err := goEnv("GOVERSION")
+	if err != nil {
+		return err
+	}
+
+	names, err := selectCommands(only)
+	if err != nil {
+		return err
+	}
+	platforms, err := parseTargets(targets)
+	if err != nil {
+		return err
+	}
+
+	pubKey, err := readSigningKey(signingKey)
+	if err != nil {
+		return err
+	}
+
+	if outDir, err = filepath.Abs(outDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(outDir, 0750); err != nil {
+		return err
+	}
+	flags := []string{
+		"-s", "-w", "-buildid=",
+		"-X", buildinfoPkg + ".Version=" + version,
+		"-X", buildinfoPkg + ".Commit=" + commit,
+		"-X", buildinfoPkg + ".BuildTime=" + buildTime,
+	}
+	if pubKey != "" {
+		flags = append(flags, "-X", buildinfoPkg+".SigningKey="+pubKey)
+	}
+	ldflags := strings.Join(flags, " ")
+
+	m := manifest{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: goVersion}
+	for _, p := range platforms {
+		for _, name := range names {
+			file := fmt.Sprintf("%s_%s_%s", name, p[0], p[1])
+			path := filepath.Join(outDir, file)
+			fmt.Printf("Building %s\n", file)
+			// #nosec G204 -- arguments are fixed or come from the release operator's flags
+			cmd := exec.Command("go", "build", "-trimpath", "-buildvcs=false", "-ldflags", ldflags, "-o", path, commands[name])
+			cmd.Dir = root
+			cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS="+p[0], "GOARCH="+p[1], "GOFLAGS=")
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				return fmt.Errorf("building %s: %w", file, err)
+			}
+			sum, size, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			m.Artifacts = append(m.Artifacts, artifact{Name: file, GOOS: p[0], GOARCH: p[1], Size: size, SHA256: sum})
+		}
+	}
+
+	if err := writeManifests(outDir, &m); err != nil {
+		return err
+	}
+	fmt.Printf("Built %d binaries of %s (%s) with %s in %s\n", len(m.Artifacts), version, commit, goVersion, outDir)
+
+	if verify != "" {
+		return verifySums(verify, m.Artifacts)
+	}
+	return nil
+}
+
+// sourceTime returns the time the build claims, in RFC 3339: that of
+// SOURCE_DATE_EPOCH when set, else the commit time, so that it does not
+// change between rebuilds.
+func sourceTime() (string, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		var err error
+		if epoch, err = git("log", "-1", "--format=%ct"); err != nil {
+			return "", err
+		}
+	}
+	secs, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid source time %q: %w", epoch, err)
+	}
+	return time.Unix(secs, 0).UTC().Format(time.RFC3339), nil
+}
+
+// readSigningKey returns the base64 line of the minisign public key file
+// at path, or "" when none is given. Only the public key is linked in;
+// signing the built binaries is left to minisign.
+func readSigningKey(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path from the release operator's flags
+	if err != nil {
+		return "", err
+	}
+	key, err := minisign.ParsePublicKey(string(data))
+	if err != nil {
+		return "", fmt.Errorf("-signing-key %s: %w", path, err)
+	}
+	return key.Encode(), nil
+}
+
+func selectCommands(only string) ([]string, error) {
+	var names []string
+	if only == "" {
+		for name := range commands {
+			names = append(names, name)
+		}
+	} else {
+		for _, name := range strings.Split(only, ",") {
+			name = strings.TrimSpace(name)
+			if !strings.HasPrefix(name, "dead-drop-") {
+				name = "dead-drop-" + name
+			}
+			if _, ok := commands[name]; !ok {
+				return nil, fmt.Errorf("unknown command %q", name)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func parseTargets(targets string) ([][2]string, error) {
+	var platforms [][2]string
+	for _, t := range strings.Split(targets, ",") {
+		goos, goarch, ok := strings.Cut(strings.TrimSpace(t), "/")
+		if !ok || goos == "" || goarch == "" {
+			return nil, fmt.Errorf("invalid target %q, want GOOS/GOARCH", t)
+		}
+		platforms = append(platforms, [2]string{goos, goarch})
+	}
+	return platforms, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path) // #nosec G304 -- path of a binary this run just built
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// writeManifests writes SHA256SUMS, in the format sha256sum -c reads, and
+// manifest.json.
+func writeManifests(outDir string, m *manifest) error {
+	var sums strings.Builder
+	for _, a := range m.Artifacts {
+		fmt.Fprintf(&sums, "%s  %s\n", a.SHA256, a.Name)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "SHA256SUMS"), []byte(sums.String()), 0600); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outDir, "manifest.json"), append(data, '\n'), 0600)
+}
+
+// verifySums compares the new builds with a published SHA256SUMS, failing
+// on any binary built here whose hash differs or is missing from it.
+func verifySums(path string, built []artifact) error {
+	f, err := os.Open(path) // #nosec G304 -- path from the release operator's flags
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	published := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if ok {
+			published[strings.TrimPrefix(name, "*")] = sum
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	mismatches := 0
+	for _, a := range built {
+		switch want, ok := published[a.Name]; {
+		case !ok:
+			fmt.Printf("MISSING  %s (not in %s)\n", a.Name, path)
+			mismatches++
+		case want != a.SHA256:
+			fmt.Printf("DIFFERS  %s\n", a.Name)
+			mismatches++
+		default:
+			fmt.Printf("OK       %s\n", a.Name)
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d binaries do not match %s", mismatches, len(built), path)
+	}
+	fmt.Printf("All %d binaries match %s\n", len(built), path)
+	return nil
+}
+
+func git(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output() // #nosec G204 -- fixed git subcommands
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func goEnv(key string) (string, error) {
+	out, err := exec.Command("go", "env", key).Output() // #nosec G204 -- fixed go subcommand
+	if err != nil {
+		return "", fmt.Errorf("go env %s: %w", key, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
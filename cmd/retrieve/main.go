@@ -0,0 +1,341 @@
+// Command dead-drop-retrieve downloads a drop with its drop ID and receipt,
+// optionally through Tor. The download is hashed as it arrives and checked
+// against the server's X-Dead-Drop-SHA256 trailer, and with -sha256 against
+// the file hash the submitter was given. With -key-file, a drop the source
+// encrypted with a per-drop key (dead-drop-submit -encrypt) is decrypted;
+// its fingerprint is checked with the server first, since retrieval may burn
+// the drop. With -recipient-key-file, a drop the source sealed to the
+// receivers' public key (security.recipient_key) is opened with its private
+// key and written under its original name, after the same check. The
+// receipt is read from DEAD_DROP_RECEIPT unless -receipt is
+// given, so that it need not appear in the process list, and the passphrase
+// of a protected drop likewise from DEAD_DROP_PASSPHRASE or -passphrase-file.
+// Where the server flattens risky formats into static renderings, -original
+// asks for the file as it was uploaded.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/net/proxy"
+
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// integrityTrailer is the trailer in which the server sends the SHA-256 of
+// the download body once it has all been written.
+const integrityTrailer = "X-Dead-Drop-SHA256"
+
+// flattenedHeader marks a drop the server converted into a static rendering,
+// with the extension of the original.
+const flattenedHeader = "X-Dead-Drop-Flattened"
+
+// statusResponse mirrors the reply of POST /api/v1/drop-status.
+type statusResponse struct {
+	Status          string `json:"status"`
+	ClientEncrypted bool   `json:"client_encrypted"`
+	KeyFingerprint  string `json:"key_fingerprint"`
+}
+
+func main() {
+	serverURL := flag.String("server", "http://localhost:8080", "Dead drop server URL")
+	useTor := flag.Bool("tor", false, "Use Tor SOCKS5 proxy")
+	torProxy := flag.String("tor-proxy", "127.0.0.1:9050", "Tor SOCKS5 proxy address")
+	dropID := flag.String("id", "", "Drop ID (required)")
+	receipt := flag.String("receipt", "", "Receipt code (default: DEAD_DROP_RECEIPT env var)")
+	outDir := flag.String("out-dir", ".", "Directory to write the drop")
+	digest := flag.String("sha256", "", "Expected SHA-256 of the drop, as given to the submitter")
+	keyFile := flag.String("key-file", "", "Per-drop key file (from dead-drop-submit -encrypt) to decrypt a client-encrypted drop")
+	recipientKeyFile := flag.String("recipient-key-file", "", "Recipient private key (from dead-drop-keygen -recipients) to open a drop sealed to the receivers' key")
+	passphraseFile := flag.String("passphrase-file", "", "File holding the drop's passphrase (default: DEAD_DROP_PASSPHRASE env var)")
+	replyFile := flag.String("reply-file", "", "Leave the reply in this file (- for stdin) on the drop for its source, instead of retrieving it")
+	checkReply := flag.Bool("check-reply", false, "Print the receivers' reply to the drop, instead of retrieving it")
+	original := flag.Bool("original", false, "Retrieve the file as uploaded, even where the server flattens its format into a static rendering")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
+	if *dropID == "" {
+		log.Fatal("-id is required")
+	}
+	if *receipt == "" {
+		*receipt = os.Getenv("DEAD_DROP_RECEIPT")
+	}
+	if *receipt == "" {
+		log.Fatal("-receipt or DEAD_DROP_RECEIPT is required")
+	}
+	if *keyFile != "" && *recipientKeyFile != "" {
+		log.Fatal("-key-file and -recipient-key-file cannot be combined")
+	}
+	if *replyFile != "" && *checkReply {
+		log.Fatal("-reply-file and -check-reply cannot be combined")
+	}
+
+	passphrase := os.Getenv("DEAD_DROP_PASSPHRASE")
+	if *passphraseFile != "" {
+		data, err := os.ReadFile(*passphraseFile) // #nosec G304 -- path from the user's flags
+		if err != nil {
+			log.Fatalf("Failed to read passphrase: %v", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+
+	var key []byte
+	var recipient *age.X25519Identity
+	var fingerprint, keyFlag string
+	if *keyFile != "" {
+		key = readKey(*keyFile)
+		defer crypto.ZeroBytes(key)
+		fingerprint, keyFlag = crypto.KeyFingerprint(key), "-key-file"
+	}
+	if *recipientKeyFile != "" {
+		data, err := os.ReadFile(*recipientKeyFile) // #nosec G304 -- path from the user's flags
+		if err != nil {
+			log.Fatalf("Failed to read recipient key: %v", err)
+		}
+		if recipient, err = crypto.ParseIdentity(data); err != nil {
+			log.Fatalf("Invalid recipient key: %v", err)
+		}
+		crypto.ZeroBytes(data)
+		fingerprint, keyFlag = crypto.RecipientFingerprint(recipient.Recipient()), "-recipient-key-file"
+	}
+
+	client := &http.Client{}
+	if *useTor {
+		dialer, err := proxy.SOCKS5("tcp", *torProxy, nil, proxy.Direct)
+		if err != nil {
+			log.Fatalf("Failed to create proxy dialer: %v", err)
+		}
+		transport := &http.Transport{}
+		if cd, ok := dialer.(proxy.ContextDialer); ok {
+			transport.DialContext = cd.DialContext
+		}
+		client.Transport = transport
+		fmt.Println("Using Tor proxy:", *torProxy)
+	}
+
+	form := url.Values{"id": {*dropID}, "receipt": {*receipt}}
+	switch {
+	case *replyFile != "":
+		if err := sendReply(client, *serverURL, form, *replyFile); err != nil {
+			log.Fatalf("Reply failed: %v", err)
+		}
+		fmt.Println("Reply left for the source")
+		return
+	case *checkReply:
+		reply, err := fetchReply(client, *serverURL, form)
+		if err != nil {
+			log.Fatalf("Checking for a reply failed: %v", err)
+		}
+		if reply == "" {
+			fmt.Println("No reply yet")
+			return
+		}
+		fmt.Println(reply)
+		return
+	}
+	if passphrase != "" {
+		form.Set("passphrase", passphrase)
+	}
+	if *original {
+		form.Set("original", "true")
+	}
+	if fingerprint != "" {
+		if err := checkKey(client, *serverURL, form, fingerprint, keyFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	path, err := retrieve(client, *serverURL, form, *outDir, *digest, key, recipient)
+	if err != nil {
+		log.Fatalf("Retrieval failed: %v", err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+}
+
+// readKey reads a base64 key file.
+func readKey(path string) []byte {
+	encoded, err := os.ReadFile(path) // #nosec G304 -- path from the user's flags
+	if err != nil {
+		log.Fatalf("Failed to read key: %v", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		log.Fatalf("Failed to decode key: %v", err)
+	}
+	return key
+}
+
+// checkKey asks the server which key the drop was encrypted or sealed with,
+// without retrieving it, so that a drop that burns after reading is not
+// spent on the wrong key. keyFlag names the flag that gave the key.
+func checkKey(client *http.Client, serverURL string, form url.Values, fingerprint, keyFlag string) error {
+	resp, err := client.PostForm(serverURL+"/api/v1/drop-status", form) // #nosec G107 -- server URL is user-provided by design
+	if err != nil {
+		return fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("drop status: %s", serverError(resp))
+	}
+	var status statusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("drop status: %w", err)
+	}
+
+	switch {
+	case status.Status != "ready":
+		return fmt.Errorf("drop is not ready yet (%s), try again later", status.Status)
+	case !status.ClientEncrypted:
+		return fmt.Errorf("drop was not encrypted by its source; retrieve it without %s", keyFlag)
+	case status.KeyFingerprint != "" && status.KeyFingerprint != fingerprint:
+		return fmt.Errorf("drop was encrypted with key %s, not %s", status.KeyFingerprint, fingerprint)
+	}
+	return nil
+}
+
+// retrieve downloads the drop into outDir, verifies it, decrypts it with
+// key or opens it with the recipient private key if given, and returns the
+// path written. Nothing is left behind on failure.
+func retrieve(client *http.Client, serverURL string, form url.Values, outDir, digest string, key []byte, recipient *age.X25519Identity) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, serverURL+"/retrieve", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req) // #nosec G704 -- server URL is user-provided by design
+	if err != nil {
+		return "", fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(serverError(resp))
+	}
+
+	tmp, err := os.CreateTemp(outDir, ".dead-drop-retrieve-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	// The trailer is only read once the body has been read to the end
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), resp.Body); err != nil {
+		return "", fmt.Errorf("download interrupted: %w", err)
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if want := resp.Trailer.Get(integrityTrailer); want == "" || !strings.EqualFold(want, got) {
+		return "", errors.New("download incomplete or altered: the server's SHA-256 trailer is missing or does not match")
+	}
+	if from := resp.Header.Get(flattenedHeader); from != "" {
+		// The submitter's hash is of the original
+		fmt.Printf("Flattened from %s by the server; unless the drop was deleted on retrieval, -original retrieves the original\n", from)
+		digest = ""
+	}
+	if digest != "" && !strings.EqualFold(strings.TrimSpace(digest), got) {
+		return "", fmt.Errorf("SHA-256 mismatch: got %s, want %s", got, digest)
+	}
+	fmt.Println("SHA-256:", got)
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if recipient != nil {
+		return unseal(tmp, outDir, recipient)
+	}
+
+	path := filepath.Join(outDir, downloadName(resp.Header.Get("Content-Disposition")))
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- base name inside the user's chosen dir
+	if err != nil {
+		return "", err
+	}
+	if key != nil {
+		err = crypto.DecryptStream(key, tmp, out, nil)
+		if err != nil {
+			err = fmt.Errorf("%w (wrong key, or not a client-encrypted drop)", err)
+		}
+	} else {
+		_, err = io.Copy(out, tmp)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// unseal opens a drop sealed to the receivers' key with its private key
+// and writes it into outDir under the name sealed with it.
+func unseal(sealed io.Reader, outDir string, identity *age.X25519Identity) (string, error) {
+	name, data, err := crypto.OpenSealedFile(identity, sealed)
+	if err != nil {
+		return "", fmt.Errorf("%w (wrong key, or not sealed to the receivers' key)", err)
+	}
+	defer crypto.ZeroBytes(data)
+
+	path := filepath.Join(outDir, safeName(name))
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- base name inside the user's chosen dir
+	if err != nil {
+		return "", err
+	}
+	_, err = out.Write(data)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// downloadName returns the file name the server gave the drop, reduced to a
+// base name so that it stays inside the output directory.
+func downloadName(disposition string) string {
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return "drop"
+	}
+	return safeName(params["filename"])
+}
+
+// safeName reduces a name chosen by the source to a base name, so that it
+// cannot choose the directory.
+func safeName(name string) string {
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return "drop"
+	}
+	return name
+}
+
+// serverError describes an error reply.
+func serverError(resp *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Sprintf("server returned error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
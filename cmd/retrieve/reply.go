@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// maxReplyFile bounds the reply read from -reply-file; the server takes
+// no more than 2 KiB of it anyway.
+const maxReplyFile = 64 << 10
+
+// sendReply leaves the reply held in path, or on stdin for "-", on the drop
+// named by form, for the source to fetch with -check-reply.
+func sendReply(client *http.Client, serverURL string, form url.Values, path string) error {
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path) // #nosec G304 -- path from the user's flags
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	text, err := io.ReadAll(io.LimitReader(in, maxReplyFile))
+	if err != nil {
+		return err
+	}
+	if len(text) == 0 {
+		return errors.New("reply is empty")
+	}
+
+	reply := url.Values{"id": form["id"], "receipt": form["receipt"], "text": {string(text)}}
+	resp, err := client.PostForm(serverURL+"/reply", reply) // #nosec G107 -- server URL is user-provided by design
+	if err != nil {
+		return fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New(serverError(resp))
+	}
+	return nil
+}
+
+// fetchReply returns the receivers' reply to the drop named by form, or ""
+// if there is none yet.
+func fetchReply(client *http.Client, serverURL string, form url.Values) (string, error) {
+	resp, err := client.PostForm(serverURL+"/check-reply", form) // #nosec G107 -- server URL is user-provided by design
+	if err != nil {
+		return "", fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", errors.New(serverError(resp))
+	}
+	var reply struct {
+		Reply string `json:"reply"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return "", fmt.Errorf("check reply: %w", err)
+	}
+	return reply.Reply, nil
+}
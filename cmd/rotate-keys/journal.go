@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// journalHeader starts the first line of a journal, followed by the new
+// encryption key wrapped with the new master key.
+const journalHeader = "dead-drop-rotation-v1"
+
+// journalPurpose is the AAD of the wrapped key in the journal.
+var journalPurpose = []byte("rotation-key")
+
+// journal records the progress of a full rotation so that an interrupted or
+// partly failed run can be resumed with -resume. The first line holds the
+// new encryption key, which is installed only once every drop has moved to
+// it; each later line names a drop, or a "step:" after the drops, that is
+// done. Lines are synced as they are written.
+type journal struct {
+	f    *os.File
+	done map[string]bool
+}
+
+// createJournal starts a journal at path for newEncKey. It refuses to
+// replace an existing journal, which belongs to an unfinished rotation.
+func createJournal(path string, newMasterKey, newEncKey []byte) (*journal, error) {
+	wrapped, err := crypto.EncryptKeyFile(newMasterKey, newEncKey, journalPurpose)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600) // #nosec G304 -- fixed name inside storage dir
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("a rotation is already in progress (%s); finish it with -resume", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	j := &journal{f: f, done: make(map[string]bool)}
+	if err := j.append(journalHeader + " " + base64.StdEncoding.EncodeToString(wrapped)); err != nil {
+		f.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return j, nil
+}
+
+// openJournal reopens the journal at path for -resume and returns it with
+// the new encryption key it holds.
+func openJournal(path string, newMasterKey []byte) (*journal, []byte, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0600) // #nosec G304 -- fixed name inside storage dir
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("no rotation to resume (%s not found)", path)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j := &journal{f: f, done: make(map[string]bool)}
+	var newEncKey []byte
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if newEncKey == nil {
+			encoded, ok := strings.CutPrefix(line, journalHeader+" ")
+			wrapped, err := base64.StdEncoding.DecodeString(encoded)
+			if !ok || err != nil {
+				f.Close()
+				return nil, nil, errors.New("journal header is malformed: no drop was rotated before it was written, so remove it and start over")
+			}
+			newEncKey, err = crypto.DecryptKeyFile(newMasterKey, wrapped, journalPurpose)
+			if err != nil {
+				f.Close()
+				return nil, nil, fmt.Errorf("failed to unwrap the journal's key (is DEAD_DROP_MASTER_KEY the new passphrase?): %w", err)
+			}
+			continue
+		}
+		// A line cut short by a crash names nothing; its drop is checked again
+		if line != "" {
+			j.done[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		crypto.ZeroBytes(newEncKey)
+		return nil, nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	if newEncKey == nil {
+		f.Close()
+		return nil, nil, errors.New("journal is empty: no drop was rotated, so remove it and start over")
+	}
+	return j, newEncKey, nil
+}
+
+// isDone reports whether name was recorded as done.
+func (j *journal) isDone(name string) bool { return j.done[name] }
+
+// markDone records name as done.
+func (j *journal) markDone(name string) error {
+	if err := j.append(name); err != nil {
+		return err
+	}
+	j.done[name] = true
+	return nil
+}
+
+func (j *journal) append(line string) error {
+	if _, err := j.f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return j.f.Sync()
+}
+
+func (j *journal) Close() error { return j.f.Close() }
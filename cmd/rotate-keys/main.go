@@ -1,23 +1,37 @@
 package main
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/config"
 	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
+	"github.com/scttfrdmn/dead-drop/internal/stats"
 	"github.com/scttfrdmn/dead-drop/internal/storage"
 )
 
 func main() {
 	storageDir := flag.String("storage-dir", "./drops", "Path to storage directory")
 	rewrapOnly := flag.Bool("rewrap-only", false, "Only re-wrap key files with new master key (no data re-encryption)")
+	incidentLog := flag.String("incidents", "", "Path to the incident log (default: .incidents in the storage directory)")
+	statsLog := flag.String("stats", "", "Path to the usage statistics log (default: .stats in the storage directory)")
+	canaryFile := flag.String("canaries", "", "Path to the canary file (default: .canaries in the storage directory)")
+	resume := flag.Bool("resume", false, "Resume an interrupted or partly failed full rotation from its journal")
+	dryRun := flag.Bool("dry-run", false, "Check that every drop can be re-encrypted, writing nothing")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
 	oldPassphrase := os.Getenv("DEAD_DROP_OLD_MASTER_KEY")
 	newPassphrase := os.Getenv("DEAD_DROP_MASTER_KEY")
 
@@ -25,6 +39,21 @@ func main() {
 		log.Fatal("DEAD_DROP_MASTER_KEY environment variable must be set")
 	}
 
+	if _, err := os.Stat(filepath.Join(*storageDir, ".encryption.key")); err != nil {
+		log.Fatalf("%s is not a dead-drop storage directory: %v", *storageDir, err)
+	}
+
+	// Hold the store for the whole run: a server working on drops while they
+	// move between keys would corrupt them, and it cannot start meanwhile
+	lock, err := storage.LockStore(*storageDir, "dead-drop-rotate-keys")
+	if err != nil {
+		log.Fatalf("%v (stop the server before rotating keys)", err)
+	}
+	defer lock.Release()
+	if err := storage.UseIDFormat(*storageDir, nil); err != nil {
+		log.Fatalf("%v", err)
+	}
+
 	// Load salt (must already exist)
 	salt, err := crypto.LoadOrGenerateSalt(*storageDir)
 	if err != nil {
@@ -51,12 +80,23 @@ func main() {
 		if err := rewrapKeyFile(receiptKeyPath, oldMasterKey, newMasterKey, []byte("receipt-key")); err != nil {
 			log.Fatalf("Failed to rewrap receipt key: %v", err)
 		}
+		if err := rewrapSecrets(*storageDir, oldMasterKey, newMasterKey); err != nil {
+			log.Fatalf("Failed to rewrap config secrets: %v", err)
+		}
 		fmt.Println("Key files re-wrapped successfully.")
 		return
 	}
 
 	// Full rotation: generate new encryption key, re-encrypt all drops
-	fmt.Println("Full key rotation: generating new encryption key and re-encrypting all drops...")
+	journalPath := filepath.Join(*storageDir, storage.RotationJournalFile)
+	switch {
+	case *dryRun:
+		fmt.Println("Dry run: checking that every drop can be re-encrypted; nothing is written.")
+	case *resume:
+		fmt.Println("Resuming full key rotation...")
+	default:
+		fmt.Println("Full key rotation: generating new encryption key and re-encrypting all drops...")
+	}
 
 	// Load old encryption key
 	oldEncKey, err := loadKey(encKeyPath, oldMasterKey, []byte("encryption-key"))
@@ -65,35 +105,122 @@ func main() {
 	}
 	defer crypto.ZeroBytes(oldEncKey)
 
-	// Generate new encryption key
-	newEncKey, err := crypto.GenerateKey()
-	if err != nil {
-		log.Fatalf("Failed to generate new key: %v", err)
+	// The new key is recorded in the journal before any drop moves to it, and
+	// installed only once they all have
+	var j *journal
+	var newEncKey []byte
+	switch {
+	case *resume:
+		j, newEncKey, err = openJournal(journalPath, newMasterKey)
+		if err != nil {
+			log.Fatalf("Failed to resume: %v", err)
+		}
+	case *dryRun:
+		if _, err := os.Stat(journalPath); err == nil {
+			fmt.Println("A rotation is in progress; add -resume to check what it has left.")
+		}
+	default:
+		newEncKey, err = crypto.GenerateKey()
+		if err != nil {
+			log.Fatalf("Failed to generate new key: %v", err)
+		}
+		j, err = createJournal(journalPath, newMasterKey, newEncKey)
+		if err != nil {
+			log.Fatalf("Failed to start rotation: %v", err)
+		}
 	}
 	defer crypto.ZeroBytes(newEncKey)
-
-	// Re-encrypt all drops
-	entries, err := os.ReadDir(*storageDir)
-	if err != nil {
-		log.Fatalf("Failed to read storage directory: %v", err)
+	if j != nil {
+		defer j.Close()
 	}
 
-	rotated := 0
-	for _, entry := range entries {
-		if !entry.IsDir() || entry.Name()[0] == '.' {
-			continue
+	// Re-encrypt all drops (sharded and legacy flat layouts, and quarantine).
+	// This walks the directories rather than storage.ListDrops: the index
+	// leaves out quarantined drops and any whose metadata it could not read,
+	// and every drop on disk must move to the new key. A drop that fails is
+	// reported at the end rather than stopping the run.
+	var rotated, skipped int
+	var failed []string
+	reencrypt := func(dropID, dropDir string) error {
+		if j != nil && j.isDone(dropID) {
+			skipped++
+			return nil
+		}
+		if err := storage.RekeyDrop(dropDir, dropID, oldEncKey, newEncKey, *dryRun); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", dropID, err))
+			return nil
 		}
+		rotated++
+		if *dryRun {
+			return nil
+		}
+		return j.markDone(dropID)
+	}
+	if err := storage.WalkDrops(*storageDir, reencrypt); err != nil {
+		log.Fatalf("Failed to re-encrypt drops: %v", err)
+	}
+	if err := storage.WalkQuarantine(*storageDir, reencrypt); err != nil {
+		log.Fatalf("Failed to re-encrypt quarantined drops: %v", err)
+	}
 
-		dropID := entry.Name()
-		if err := storage.ValidateDropID(dropID); err != nil {
-			continue // skip non-drop directories
+	verb := "re-encrypted"
+	if *dryRun {
+		verb = "can be re-encrypted"
+	}
+	fmt.Printf("%d drops %s, %d already done, %d failed.\n", rotated, verb, skipped, len(failed))
+	for _, f := range failed {
+		fmt.Printf("  %s\n", f)
+	}
+	if *dryRun {
+		if len(failed) > 0 {
+			os.Exit(1)
 		}
+		return
+	}
+	if len(failed) > 0 {
+		fmt.Printf("The old key stays in place. Fix or remove the failed drops, then run again with -resume.\n")
+		os.Exit(1)
+	}
 
-		dropDir := filepath.Join(*storageDir, dropID)
-		if err := reencryptDrop(dropDir, dropID, oldEncKey, newEncKey); err != nil {
-			log.Fatalf("Failed to re-encrypt drop %s: %v", dropID, err)
+	// The rest is keyed by the new encryption and master keys. Each step is
+	// journaled, as none can be repeated once done.
+	if *incidentLog == "" {
+		*incidentLog = filepath.Join(*storageDir, ".incidents")
+	}
+	if *statsLog == "" {
+		*statsLog = filepath.Join(*storageDir, ".stats")
+	}
+	if *canaryFile == "" {
+		*canaryFile = filepath.Join(*storageDir, ".canaries")
+	}
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"incidents", func() error { return rekeyIncidents(*incidentLog, oldEncKey, newEncKey) }},
+		{"stats", func() error { return rekeyStats(*statsLog, oldEncKey, newEncKey) }},
+		{"canaries", func() error { return rekeyCanaries(*canaryFile, oldEncKey, newEncKey) }},
+		{"receipt-key", func() error {
+			return rewrapKeyFile(receiptKeyPath, oldMasterKey, newMasterKey, []byte("receipt-key"))
+		}},
+		{"secrets", func() error { return rewrapSecrets(*storageDir, oldMasterKey, newMasterKey) }},
+	}
+	for _, step := range steps {
+		if j.isDone("step:" + step.name) {
+			continue
 		}
-		rotated++
+		if err := step.run(); err != nil {
+			log.Fatalf("Failed to re-key %s: %v (run again with -resume)", step.name, err)
+		}
+		if err := j.markDone("step:" + step.name); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	// The cleanup expiry index is sealed with the old key; the server
+	// rebuilds it from drop metadata on the next cleanup
+	if err := os.Remove(filepath.Join(*storageDir, ".expiry-index")); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove expiry index: %v", err)
 	}
 
 	// Save new encryption key (encrypted with new master key)
@@ -101,16 +228,83 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to encrypt new key: %v", err)
 	}
-	if err := os.WriteFile(filepath.Clean(encKeyPath), encrypted, 0600); err != nil { // #nosec G703 -- path from CLI flag
-		log.Fatalf("Failed to write new encryption key: %v", err)
+	if err := writeFileAtomic(encKeyPath, encrypted); err != nil {
+		log.Fatalf("Failed to write new encryption key: %v (run again with -resume)", err)
 	}
 
-	// Re-wrap receipt key with new master key
-	if err := rewrapKeyFile(receiptKeyPath, oldMasterKey, newMasterKey, []byte("receipt-key")); err != nil {
-		log.Fatalf("Failed to rewrap receipt key: %v", err)
+	// The journal holds the new key too; it goes once the key is in place
+	j.Close()
+	if err := os.Remove(journalPath); err != nil {
+		log.Printf("Failed to remove the rotation journal %s: %v", journalPath, err)
 	}
+	fmt.Printf("Key rotation complete: %d drops re-encrypted.\n", rotated+skipped)
+}
+
+// rekeyIncidents re-seals the incident log at path under the sub-key of the
+// new encryption key. A missing log is not an error.
+func rekeyIncidents(path string, oldEncKey, newEncKey []byte) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	newKey, err := storage.DeriveSubKey(newEncKey, "incidents")
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(newKey)
+
+	store := incidents.New(path, func() ([]byte, error) {
+		return storage.DeriveSubKey(oldEncKey, "incidents")
+	})
+	return store.Rekey(newKey)
+}
+
+// rekeyStats re-seals the usage statistics log at path under the sub-key of
+// the new encryption key. A missing log is not an error.
+func rekeyStats(path string, oldEncKey, newEncKey []byte) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	newKey, err := storage.DeriveSubKey(newEncKey, "stats")
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(newKey)
+
+	store := stats.New(path, func() ([]byte, error) {
+		return storage.DeriveSubKey(oldEncKey, "stats")
+	})
+	return store.Rekey(newKey)
+}
+
+// rekeyCanaries re-seals the canary file at path under the sub-key of the
+// new encryption key. A missing file is not an error.
+func rekeyCanaries(path string, oldEncKey, newEncKey []byte) error {
+	newKey, err := storage.DeriveSubKey(newEncKey, "canaries")
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(newKey)
 
-	fmt.Printf("Key rotation complete: %d drops re-encrypted.\n", rotated)
+	store := canary.New(path, func() ([]byte, error) {
+		return storage.DeriveSubKey(oldEncKey, "canaries")
+	}, 0)
+	return store.Rekey(newKey)
+}
+
+// rewrapSecrets re-seals the config secrets file with the new master key.
+// A missing file is not an error.
+func rewrapSecrets(storageDir string, oldMasterKey, newMasterKey []byte) error {
+	if _, err := os.Stat(filepath.Join(storageDir, config.SecretsFile)); os.IsNotExist(err) {
+		return nil
+	}
+	if oldMasterKey == nil {
+		return fmt.Errorf("DEAD_DROP_OLD_MASTER_KEY must be set to open %s", config.SecretsFile)
+	}
+	secrets, err := config.LoadSecrets(storageDir, oldMasterKey)
+	if err != nil {
+		return err
+	}
+	return config.SaveSecrets(storageDir, newMasterKey, secrets)
 }
 
 // loadKey reads a key file, decrypting it if masterKey is provided.
@@ -157,55 +351,28 @@ func rewrapKeyFile(path string, oldMasterKey, newMasterKey, purpose []byte) erro
 	return nil
 }
 
-// reencryptDrop decrypts a drop's file and metadata with the old key and re-encrypts with the new key.
-func reencryptDrop(dropDir, dropID string, oldKey, newKey []byte) error {
-	// Re-encrypt data file (try "data" first, fall back to legacy "file.enc")
-	filePath := filepath.Join(dropDir, "data")
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		filePath = filepath.Join(dropDir, "file.enc")
-	}
-	if err := reencryptFile(filePath, dropID, oldKey, newKey); err != nil {
-		return fmt.Errorf("failed to re-encrypt file: %w", err)
-	}
-
-	// Re-encrypt metadata
-	metaPath := filepath.Join(dropDir, "meta")
-	if err := reencryptFile(metaPath, dropID, oldKey, newKey); err != nil {
-		return fmt.Errorf("failed to re-encrypt metadata: %w", err)
-	}
-
-	return nil
-}
-
-// reencryptFile decrypts and re-encrypts a single file using AES-GCM stream operations.
-func reencryptFile(path, dropID string, oldKey, newKey []byte) error {
-	data, err := os.ReadFile(path) // #nosec G304 -- path built from validated drop ID
+// writeFileAtomic replaces the file at path with data, so that a crash
+// leaves either the old contents or the new, never a truncated file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := filepath.Clean(path) + ".rotate.tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 -- path from CLI flag
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return fmt.Errorf("failed to open file for writing: %w", err)
 	}
-
-	// Decrypt with old key
-	decrypted := bytes.NewBuffer(nil)
-	if err := crypto.DecryptStream(oldKey, bytes.NewReader(data), decrypted, []byte(dropID)); err != nil {
-		return fmt.Errorf("failed to decrypt: %w", err)
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
 	}
-
-	// Re-encrypt with new key
-	var encrypted bytes.Buffer
-	if err := crypto.EncryptStream(newKey, decrypted, &encrypted, []byte(dropID)); err != nil {
-		return fmt.Errorf("failed to encrypt: %w", err)
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
-
-	// Write back
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0600) // #nosec G304
 	if err != nil {
-		return fmt.Errorf("failed to open file for writing: %w", err)
-	}
-	defer f.Close()
-
-	if _, err := io.Copy(f, &encrypted); err != nil {
+		_ = os.Remove(tmp)
 		return fmt.Errorf("failed to write file: %w", err)
 	}
-
+	if err := os.Rename(tmp, filepath.Clean(path)); err != nil { // #nosec G703 -- path from CLI flag
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,995 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/audit"
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
+	"github.com/scttfrdmn/dead-drop/internal/stats"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+const (
+	// minAdminTokenLen is the shortest admin token accepted in config.
+	minAdminTokenLen = 32
+
+	// maxAdminBodyBytes bounds admin request bodies.
+	maxAdminBodyBytes = 4096
+
+	// maxAuditDetail bounds free-text reasons copied into the audit log.
+	maxAuditDetail = 256
+
+	// holdReleaseWindow is how long a first approval to lift a legal hold
+	// waits for a second, different admin.
+	holdReleaseWindow = time.Hour
+)
+
+type adminToken struct {
+	name      string
+	hash      [sha256.Size]byte
+	role      string   // config.RoleOperator or config.RoleReceiver
+	campaigns []string // a receiver's campaign codes; nil = all
+}
+
+// holdRelease is a pending approval to lift a legal hold.
+type holdRelease struct {
+	approver string
+	at       time.Time
+}
+
+// adminAPI serves operator endpoints on a unix socket or a mutual-TLS
+// listener, never on the public listener. Every request is authenticated
+// with a named bearer token and every change is written to the audit log
+// under that name. Receiver tokens reach only the drop endpoints, for the
+// drops of their campaigns; everything store-wide needs an operator token.
+type adminAPI struct {
+	server *Server
+	tokens []adminToken
+	audit  *audit.Log
+
+	mu       sync.Mutex
+	releases map[string]holdRelease // drop ID -> first approval
+	servers  []*http.Server
+}
+
+func newAdminAPI(s *Server, tokens []config.AdminToken, auditLog *audit.Log) (*adminAPI, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("admin.tokens must not be empty")
+	}
+	a := &adminAPI{
+		server:   s,
+		audit:    auditLog,
+		releases: make(map[string]holdRelease),
+	}
+	seen := make(map[string]bool)
+	for _, t := range tokens {
+		if t.Name == "" || seen[t.Name] {
+			return nil, fmt.Errorf("admin token names must be unique and non-empty (%q)", t.Name)
+		}
+		if len(t.Token) < minAdminTokenLen {
+			return nil, fmt.Errorf("admin token %q is shorter than %d characters", t.Name, minAdminTokenLen)
+		}
+		h := sha256.Sum256([]byte(t.Token))
+		for _, other := range a.tokens {
+			if other.hash == h {
+				return nil, fmt.Errorf("admin tokens %q and %q are identical", other.name, t.Name)
+			}
+		}
+		role := t.Role
+		if role == "" {
+			role = config.RoleOperator
+		}
+		if role != config.RoleOperator && role != config.RoleReceiver {
+			return nil, fmt.Errorf("admin token %q has unknown role %q", t.Name, t.Role)
+		}
+		if len(t.Campaigns) > 0 && role != config.RoleReceiver {
+			return nil, fmt.Errorf("admin token %q: campaigns only apply to receivers", t.Name)
+		}
+		seen[t.Name] = true
+		a.tokens = append(a.tokens, adminToken{name: t.Name, hash: h, role: role, campaigns: t.Campaigns})
+	}
+	return a, nil
+}
+
+func (a *adminAPI) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/v1/holds", a.auth(config.RoleOperator, a.handleListHolds))
+	mux.HandleFunc("POST /admin/v1/drops/{id}/hold", a.auth(config.RoleOperator, a.handleSetHold))
+	mux.HandleFunc("DELETE /admin/v1/drops/{id}/hold", a.auth(config.RoleOperator, a.handleReleaseHold))
+	mux.HandleFunc("DELETE /admin/v1/drops/{id}", a.auth(config.RoleOperator, a.handleDeleteDrop))
+	mux.HandleFunc("GET /admin/v1/drops", a.auth(config.RoleReceiver, a.handleListDrops))
+	mux.HandleFunc("GET /admin/v1/drops/{id}", a.auth(config.RoleReceiver, a.handleInspectDrop))
+	mux.HandleFunc("GET /admin/v1/quota", a.auth(config.RoleOperator, a.handleQuota))
+	mux.HandleFunc("POST /admin/v1/cleanup", a.auth(config.RoleOperator, a.handleCleanup))
+	mux.HandleFunc("PUT /admin/v1/drops/{id}/note", a.auth(config.RoleReceiver, a.handleSetNote))
+	mux.HandleFunc("DELETE /admin/v1/drops/{id}/note", a.auth(config.RoleReceiver, a.handleClearNote))
+	mux.HandleFunc("POST /admin/v1/drops/{id}/quarantine", a.auth(config.RoleOperator, a.handleQuarantine))
+	mux.HandleFunc("POST /admin/v1/drops/{id}/forward", a.auth(config.RoleReceiver, a.handleForward))
+	mux.HandleFunc("GET /admin/v1/quarantine", a.auth(config.RoleOperator, a.handleListQuarantine))
+	mux.HandleFunc("POST /admin/v1/quarantine/{id}/release", a.auth(config.RoleOperator, a.handleReleaseQuarantine))
+	mux.HandleFunc("DELETE /admin/v1/quarantine/{id}", a.auth(config.RoleOperator, a.handlePurgeQuarantine))
+	mux.HandleFunc("GET /admin/v1/incidents", a.auth(config.RoleOperator, a.handleIncidents))
+	mux.HandleFunc("GET /admin/v1/incidents/export", a.auth(config.RoleOperator, a.handleExportIncidents))
+	mux.HandleFunc("GET /admin/v1/stats", a.auth(config.RoleOperator, a.handleStats))
+	mux.HandleFunc("GET /admin/v1/clusters", a.auth(config.RoleReceiver, a.handleClusters))
+	mux.HandleFunc("GET /admin/v1/campaigns", a.auth(config.RoleReceiver, a.handleCampaigns))
+	mux.HandleFunc("GET /admin/v1/canaries", a.auth(config.RoleOperator, a.handleListCanaries))
+	mux.HandleFunc("POST /admin/v1/canaries", a.auth(config.RoleOperator, a.handleAddCanary))
+	mux.HandleFunc("DELETE /admin/v1/canaries/{name}", a.auth(config.RoleOperator, a.handleRemoveCanary))
+	mux.HandleFunc("GET /admin/v1/csp-reports", a.auth(config.RoleOperator, a.handleCSPReports))
+	mux.HandleFunc("GET /admin/v1/checkin", a.auth(config.RoleOperator, a.handleCheckInStatus))
+	mux.HandleFunc("POST /admin/v1/checkin", a.auth(config.RoleOperator, a.handleCheckIn))
+	mux.HandleFunc("POST /admin/v1/config/reload", a.auth(config.RoleOperator, a.handleReloadConfig))
+	return mux
+}
+
+// Serve handles admin requests on ln until Shutdown.
+func (a *adminAPI) Serve(ln net.Listener) {
+	srv := &http.Server{
+		Handler:      a.routes(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	a.mu.Lock()
+	a.servers = append(a.servers, srv)
+	a.mu.Unlock()
+
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Admin socket error: %v", err)
+	}
+}
+
+// Shutdown stops the admin listeners and closes the audit log.
+func (a *adminAPI) Shutdown(ctx context.Context) {
+	a.mu.Lock()
+	servers := a.servers
+	a.mu.Unlock()
+	for _, srv := range servers {
+		_ = srv.Shutdown(ctx)
+	}
+	_ = a.audit.Close()
+}
+
+// authenticate returns the token the request bears. All tokens are compared
+// so that timing does not reveal which one matched.
+func (a *adminAPI) authenticate(r *http.Request) (adminToken, bool) {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || presented == "" {
+		return adminToken{}, false
+	}
+	h := sha256.Sum256([]byte(presented))
+	var match adminToken
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(h[:], t.hash[:]) == 1 {
+			match = t
+		}
+	}
+	return match, match.name != ""
+}
+
+// auth authenticates a request and checks that its token's role may use
+// the endpoint: operators may use every endpoint, receivers only those
+// registered with config.RoleReceiver.
+func (a *adminAPI) auth(role string, next func(w http.ResponseWriter, r *http.Request, actor string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := a.authenticate(r)
+		if !ok {
+			a.record(r, "", "auth_failed", "", r.Method+" "+r.URL.Path)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if t.role != config.RoleOperator && t.role != role {
+			a.record(r, t.name, "forbidden", "", r.Method+" "+r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+		a.warnScuttle(w)
+		next(w, r, t.name)
+	}
+}
+
+// token returns the token named actor.
+func (a *adminAPI) token(actor string) adminToken {
+	for _, t := range a.tokens {
+		if t.name == actor {
+			return t
+		}
+	}
+	return adminToken{}
+}
+
+// scopedDrop is dropID for the endpoints open to receivers. A drop outside
+// the actor's campaigns is reported as not found, so that its existence is
+// not revealed, and the attempt is audited.
+func (a *adminAPI) scopedDrop(w http.ResponseWriter, r *http.Request, actor string) (string, bool) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return "", false
+	}
+	scope := a.token(actor).campaigns
+	if scope == nil {
+		return id, true
+	}
+	payload, err := a.server.storage.GetDropMetadata(id)
+	if err != nil {
+		storageError(w, err)
+		return "", false
+	}
+	if !slices.Contains(scope, payload.Campaign) {
+		a.record(r, actor, "forbidden", id, r.Method+" "+r.URL.Path)
+		http.Error(w, "Drop not found", http.StatusNotFound)
+		return "", false
+	}
+	return id, true
+}
+
+// scopedCampaign returns the campaign query parameter, which must be one of
+// the actor's campaigns if it has any. A receiver with a single campaign
+// need not give it.
+func (a *adminAPI) scopedCampaign(w http.ResponseWriter, r *http.Request, actor string) (string, bool) {
+	campaign := r.URL.Query().Get("campaign")
+	scope := a.token(actor).campaigns
+	switch {
+	case scope == nil:
+		return campaign, true
+	case campaign == "" && len(scope) == 1:
+		return scope[0], true
+	case campaign == "":
+		http.Error(w, "campaign is required for this token", http.StatusBadRequest)
+	case !slices.Contains(scope, campaign):
+		a.record(r, actor, "forbidden", "", r.Method+" "+r.URL.Path+"?campaign="+campaign)
+		http.Error(w, "Campaign outside this token's scope", http.StatusForbidden)
+	default:
+		return campaign, true
+	}
+	return "", false
+}
+
+// record writes an audit entry for a request, with its TLS client
+// certificate if any, reporting whether it was persisted.
+func (a *adminAPI) record(r *http.Request, actor, action, dropID, detail string) bool {
+	if len(detail) > maxAuditDetail {
+		detail = detail[:maxAuditDetail]
+	}
+	if err := a.audit.RecordClient(actor, clientIdentity(r), action, dropID, detail); err != nil {
+		log.Printf("Audit log write failed: %v", err)
+		return false
+	}
+	return true
+}
+
+// respond writes a JSON status reply. A change that could not be audited is
+// reported as a server error so the operator notices.
+func (a *adminAPI) respond(w http.ResponseWriter, status int, audited bool, body any) {
+	if !audited {
+		http.Error(w, "Audit log write failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// storageError maps a storage error to an HTTP status.
+func storageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrLocked):
+		http.Error(w, "Storage locked", http.StatusServiceUnavailable)
+	case errors.Is(err, storage.ErrLegalHold):
+		http.Error(w, "Drop is under legal hold", http.StatusConflict)
+	case errors.Is(err, storage.ErrNoteTooLong):
+		http.Error(w, "Note too long", http.StatusBadRequest)
+	case errors.Is(err, storage.ErrNotQuarantined):
+		http.Error(w, "Drop is not quarantined", http.StatusNotFound)
+	default:
+		http.Error(w, "Drop not found", http.StatusNotFound)
+	}
+}
+
+func (a *adminAPI) dropID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if err := storage.ValidateDropID(id); err != nil {
+		http.Error(w, "Invalid drop ID", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
+
+func (a *adminAPI) handleListHolds(w http.ResponseWriter, _ *http.Request, _ string) {
+	held, err := a.server.storage.LegalHolds()
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	if held == nil {
+		held = []string{}
+	}
+	a.respond(w, http.StatusOK, true, map[string][]string{"holds": held})
+}
+
+func (a *adminAPI) handleSetHold(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.server.storage.SetLegalHold(id, true); err != nil {
+		storageError(w, err)
+		return
+	}
+	delete(a.releases, id)
+
+	audited := a.record(r, actor, "legal_hold_set", id, r.FormValue("reason"))
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "held"})
+}
+
+// handleReleaseHold lifts a legal hold once two different admins have asked
+// for it within holdReleaseWindow. The first request only records approval.
+func (a *adminAPI) handleReleaseHold(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	payload, err := a.server.storage.GetDropMetadata(id)
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	if !payload.LegalHold {
+		http.Error(w, "Drop is not under legal hold", http.StatusConflict)
+		return
+	}
+
+	pending, ok := a.releases[id]
+	if ok && time.Since(pending.at) > holdReleaseWindow {
+		ok = false
+	}
+
+	switch {
+	case !ok:
+		a.releases[id] = holdRelease{approver: actor, at: time.Now()}
+		audited := a.record(r, actor, "legal_hold_release_requested", id, "")
+		a.respond(w, http.StatusAccepted, audited, map[string]string{"status": "awaiting second approval"})
+	case pending.approver == actor:
+		http.Error(w, "A different admin must approve the release", http.StatusConflict)
+	default:
+		if err := a.server.storage.SetLegalHold(id, false); err != nil {
+			storageError(w, err)
+			return
+		}
+		delete(a.releases, id)
+		audited := a.record(r, actor, "legal_hold_released", id, "first approval by "+pending.approver)
+		a.respond(w, http.StatusOK, audited, map[string]string{"status": "released"})
+	}
+}
+
+func (a *adminAPI) handleDeleteDrop(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := a.server.storage.GetDropMetadata(id); err != nil {
+		storageError(w, err)
+		return
+	}
+	if err := a.server.storage.DeleteDrop(id); err != nil {
+		if errors.Is(err, storage.ErrLegalHold) {
+			a.record(r, actor, "drop_delete_refused", id, "legal hold")
+		}
+		storageError(w, err)
+		return
+	}
+
+	audited := a.record(r, actor, "drop_deleted", id, "")
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "deleted"})
+}
+
+// handleListDrops lists drops with their triage notes, sorted by ID, and
+// the number of drops matching. Query parameters page through the listing
+// (offset, limit) and filter it (campaign, older_than_hours,
+// newer_than_hours, legal_hold=true); filtering uses the encrypted index, so
+// only the drops on the page are decrypted. Filenames and receipts are not
+// included. Receivers limited to campaigns list one of them at a time.
+func (a *adminAPI) handleListDrops(w http.ResponseWriter, r *http.Request, actor string) {
+	campaign, ok := a.scopedCampaign(w, r, actor)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	var offset, limit, olderHours, newerHours int
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"offset", &offset},
+		{"limit", &limit},
+		{"older_than_hours", &olderHours},
+		{"newer_than_hours", &newerHours},
+	} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+p.name, http.StatusBadRequest)
+				return
+			}
+			*p.dst = n
+		}
+	}
+	filter := storage.ListFilter{
+		Campaign:  campaign,
+		OlderThan: time.Duration(olderHours) * time.Hour,
+		NewerThan: time.Duration(newerHours) * time.Hour,
+		LegalHold: q.Get("legal_hold") == "true",
+	}
+
+	drops, total, err := a.server.storage.DropsPage(offset, limit, filter)
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	if drops == nil {
+		drops = []storage.DropSummary{}
+	}
+	a.respond(w, http.StatusOK, true, dropList{Drops: drops, Total: total})
+}
+
+// dropList is the reply of handleListDrops.
+type dropList struct {
+	Drops []storage.DropSummary `json:"drops"`
+	Total int                   `json:"total"` // matching drops, on every page
+}
+
+// handleInspectDrop returns a drop's metadata, including its filename but
+// never its receipt or contents. Inspections are audited.
+func (a *adminAPI) handleInspectDrop(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.scopedDrop(w, r, actor)
+	if !ok {
+		return
+	}
+	info, err := a.server.storage.Inspect(id)
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "drop_inspected", id, "")
+	a.respond(w, http.StatusOK, audited, info)
+}
+
+// quotaReport is the reply of GET /admin/v1/quota. Limits of 0 mean none.
+type quotaReport struct {
+	TotalBytes int64 `json:"total_bytes"`
+	DropCount  int   `json:"drop_count"`
+	MaxBytes   int64 `json:"max_bytes"`
+	MaxDrops   int   `json:"max_drops"`
+
+	// How much the storage key has encrypted, and its limits (0 = none)
+	KeyBytes       int64 `json:"key_bytes"`
+	KeyMessages    int64 `json:"key_messages"`
+	KeyMaxBytes    int64 `json:"key_max_bytes"`
+	KeyMaxMessages int64 `json:"key_max_messages"`
+}
+
+func (a *adminAPI) handleQuota(w http.ResponseWriter, _ *http.Request, _ string) {
+	quota := a.server.storage.Quota
+	if quota == nil {
+		// No limits configured: scan the store for the usage alone
+		var err error
+		if quota, err = storage.NewQuotaManager(a.server.storage.StorageDir, 0, 0); err != nil {
+			log.Printf("Quota scan failed: %v", err)
+			http.Error(w, "Quota scan failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	var report quotaReport
+	report.TotalBytes, report.DropCount = quota.Stats()
+	report.MaxBytes, report.MaxDrops = quota.Limits()
+	if usage, err := a.server.storage.KeyUsage(); err == nil {
+		report.KeyBytes, report.KeyMessages = usage.Bytes, usage.Messages
+	}
+	limits := a.server.storage.KeyLimits
+	report.KeyMaxBytes, report.KeyMaxMessages = limits.MaxBytes, limits.MaxMessages
+	a.respond(w, http.StatusOK, true, report)
+}
+
+// handleCleanup runs a cleanup pass now with the server's retention rules.
+func (a *adminAPI) handleCleanup(w http.ResponseWriter, r *http.Request, actor string) {
+	if a.server.storage.Locked() {
+		storageError(w, storage.ErrLocked)
+		return
+	}
+	deleted, err := a.server.storage.Cleanup(a.server.config().Security.GetMaxFileAge())
+	if err != nil {
+		log.Printf("Cleanup failed: %v", err)
+		http.Error(w, "Cleanup failed", http.StatusInternalServerError)
+		return
+	}
+	audited := a.record(r, actor, "cleanup_run", "", fmt.Sprintf("%d deleted", deleted))
+	a.respond(w, http.StatusOK, audited, map[string]int{"deleted": deleted})
+}
+
+// handleSetNote replaces a drop's triage note with the status, initials,
+// and text form fields. Only the status is audited; the text stays in the
+// encrypted metadata.
+func (a *adminAPI) handleSetNote(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.scopedDrop(w, r, actor)
+	if !ok {
+		return
+	}
+	note := &storage.Note{
+		Status:   r.FormValue("status"),
+		Initials: r.FormValue("initials"),
+		Text:     r.FormValue("text"),
+	}
+	if err := a.server.storage.SetNote(id, note); err != nil {
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "note_set", id, note.Status)
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "noted"})
+}
+
+func (a *adminAPI) handleClearNote(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.scopedDrop(w, r, actor)
+	if !ok {
+		return
+	}
+	if err := a.server.storage.SetNote(id, nil); err != nil {
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "note_cleared", id, "")
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "cleared"})
+}
+
+// handleQuarantine moves a drop into quarantine with the reason form field,
+// for drops flagged by a check outside the server such as a virus scan.
+func (a *adminAPI) handleQuarantine(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return
+	}
+	reason := r.FormValue("reason")
+	if reason == "" {
+		reason = "operator"
+	}
+	if len(reason) > storage.MaxQuarantineReason {
+		http.Error(w, "Reason too long", http.StatusBadRequest)
+		return
+	}
+	if err := a.server.storage.Quarantine(id, reason); err != nil {
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "drop_quarantined", id, reason)
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "quarantined"})
+}
+
+// handleForward sends a drop to a destination in forwarding.destinations
+// and replies with the credentials the destination issued, for its
+// receivers. With delete=true the drop is then deleted here.
+func (a *adminAPI) handleForward(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.scopedDrop(w, r, actor)
+	if !ok {
+		return
+	}
+	destination := r.FormValue("destination")
+	if r.FormValue("delete") == "true" && a.token(actor).role != config.RoleOperator {
+		a.record(r, actor, "forbidden", id, "forward with delete")
+		http.Error(w, "Deleting needs an operator token", http.StatusForbidden)
+		return
+	}
+	remote, err := a.server.forwardDrop(r.Context(), id, destination)
+	switch {
+	case err == nil:
+	case errors.Is(err, errUnknownDestination):
+		http.Error(w, "Unknown destination", http.StatusBadRequest)
+		return
+	case errors.Is(err, storage.ErrPending):
+		http.Error(w, "Drop is still being processed", http.StatusConflict)
+		return
+	case errors.Is(err, storage.ErrQuarantined):
+		http.Error(w, "Drop is quarantined", http.StatusConflict)
+		return
+	case errors.Is(err, errForwardFailed):
+		log.Printf("Forwarding failed: %v", err)
+		http.Error(w, "Forwarding failed", http.StatusBadGateway)
+		return
+	default:
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "drop_forwarded", id, destination)
+
+	status := "forwarded"
+	if r.FormValue("delete") == "true" {
+		if err := a.server.storage.DeleteDrop(id); err != nil {
+			// Forwarded all the same; the operator needs the credentials
+			status = "forwarded, not deleted: " + err.Error()
+		} else {
+			audited = a.record(r, actor, "drop_deleted", id, "forwarded to "+destination) && audited
+		}
+	}
+	a.respond(w, http.StatusOK, audited, map[string]any{
+		"status":      status,
+		"destination": destination,
+		"remote":      remote,
+	})
+}
+
+// handleListQuarantine lists quarantined drops with their reasons.
+func (a *adminAPI) handleListQuarantine(w http.ResponseWriter, _ *http.Request, _ string) {
+	drops, err := a.server.storage.Quarantined()
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	if drops == nil {
+		drops = []storage.DropSummary{}
+	}
+	a.respond(w, http.StatusOK, true, map[string][]storage.DropSummary{"quarantine": drops})
+}
+
+// handleReleaseQuarantine makes a quarantined drop retrievable again, as it
+// is.
+func (a *adminAPI) handleReleaseQuarantine(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.server.storage.ReleaseQuarantine(id); err != nil {
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "quarantine_released", id, "")
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "released"})
+}
+
+// handlePurgeQuarantine deletes a quarantined drop.
+func (a *adminAPI) handlePurgeQuarantine(w http.ResponseWriter, r *http.Request, actor string) {
+	id, ok := a.dropID(w, r)
+	if !ok {
+		return
+	}
+	if err := a.server.storage.PurgeQuarantine(id); err != nil {
+		if errors.Is(err, storage.ErrLegalHold) {
+			a.record(r, actor, "quarantine_purge_refused", id, "legal hold")
+		}
+		storageError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "quarantine_purged", id, "")
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "purged"})
+}
+
+// incidentEvents returns logged incidents filtered by the optional since
+// (RFC 3339) and kind query parameters, writing an error response on failure.
+func (a *adminAPI) incidentEvents(w http.ResponseWriter, r *http.Request) ([]incidents.Event, bool) {
+	if a.server.incidents == nil {
+		http.Error(w, "Incident log is disabled", http.StatusNotFound)
+		return nil, false
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid since: use RFC 3339", http.StatusBadRequest)
+			return nil, false
+		}
+		since = t
+	}
+
+	events, err := a.server.incidents.Events(since)
+	if err != nil {
+		if errors.Is(err, storage.ErrLocked) {
+			storageError(w, err)
+		} else {
+			log.Printf("Incident log read failed: %v", err)
+			http.Error(w, "Incident log unreadable", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	kind := r.URL.Query().Get("kind")
+	filtered := make([]incidents.Event, 0, len(events))
+	for _, e := range events {
+		if kind == "" || e.Kind == kind {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered, true
+}
+
+func (a *adminAPI) handleIncidents(w http.ResponseWriter, r *http.Request, _ string) {
+	events, ok := a.incidentEvents(w, r)
+	if !ok {
+		return
+	}
+	a.respond(w, http.StatusOK, true, map[string][]incidents.Event{"incidents": events})
+}
+
+// handleExportIncidents returns the incidents as a JSON attachment for
+// incident reports. Exports are audited since the data leaves the server.
+func (a *adminAPI) handleExportIncidents(w http.ResponseWriter, r *http.Request, actor string) {
+	events, ok := a.incidentEvents(w, r)
+	if !ok {
+		return
+	}
+	audited := a.record(r, actor, "incidents_exported", "", r.URL.RawQuery)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"incidents-%s.json\"", time.Now().UTC().Format("20060102")))
+	a.respond(w, http.StatusOK, audited, map[string]any{
+		"exported_at": time.Now().UTC().Truncate(time.Second),
+		"incidents":   events,
+	})
+}
+
+// handleStats returns the hourly usage totals at or after the optional since
+// query parameter (RFC 3339) of the hours that have ended.
+func (a *adminAPI) handleStats(w http.ResponseWriter, r *http.Request, _ string) {
+	if a.server.stats == nil {
+		http.Error(w, "Usage statistics are disabled", http.StatusNotFound)
+		return
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "Invalid since: use RFC 3339", http.StatusBadRequest)
+			return
+		}
+		since = t
+	}
+
+	buckets, err := a.server.stats.Buckets(since)
+	if err != nil {
+		if errors.Is(err, storage.ErrLocked) {
+			storageError(w, err)
+		} else {
+			log.Printf("Usage statistics read failed: %v", err)
+			http.Error(w, "Usage statistics unreadable", http.StatusInternalServerError)
+		}
+		return
+	}
+	a.respond(w, http.StatusOK, true, map[string][]stats.Bucket{"stats": buckets})
+}
+
+// checkInStatus is the reply of the check-in endpoints.
+type checkInStatus struct {
+	LastCheckIn time.Time `json:"last_checkin"`
+	Deadline    time.Time `json:"deadline"` // scuttled at this time without another check-in
+}
+
+// warnScuttle tells the admin CLI, on every reply, when the scuttle deadline
+// is within the warning period, so that operators see it whatever they run.
+func (a *adminAPI) warnScuttle(w http.ResponseWriter) {
+	period := scuttlePeriod(a.server.config())
+	if period == 0 {
+		return
+	}
+	deadline, err := scuttleDeadline(a.server.config().Server.StorageDir, period)
+	if err == nil && !deadline.IsZero() && time.Until(deadline) <= scuttleWarning(a.server.config()) {
+		w.Header().Set("X-Dead-Drop-Scuttle-Deadline", deadline.UTC().Format(time.RFC3339))
+	}
+}
+
+// handleCheckInStatus reports the last operator check-in and the scuttle
+// deadline it sets.
+func (a *adminAPI) handleCheckInStatus(w http.ResponseWriter, _ *http.Request, _ string) {
+	period := scuttlePeriod(a.server.config())
+	if period == 0 {
+		http.Error(w, "Scuttle timer is disabled", http.StatusNotFound)
+		return
+	}
+	last, err := storage.LastCheckIn(a.server.config().Server.StorageDir)
+	if err != nil {
+		log.Printf("Check-in read failed: %v", err)
+		http.Error(w, "Check-in unreadable", http.StatusInternalServerError)
+		return
+	}
+	status := checkInStatus{LastCheckIn: last}
+	if !last.IsZero() {
+		status.Deadline = last.Add(period)
+	}
+	a.respond(w, http.StatusOK, true, status)
+}
+
+// handleCheckIn records an operator check-in, putting off the scuttle
+// deadline by scuttle.after_days.
+func (a *adminAPI) handleCheckIn(w http.ResponseWriter, r *http.Request, actor string) {
+	period := scuttlePeriod(a.server.config())
+	if period == 0 {
+		http.Error(w, "Scuttle timer is disabled", http.StatusNotFound)
+		return
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := storage.CheckIn(a.server.config().Server.StorageDir, now); err != nil {
+		log.Printf("Check-in failed: %v", err)
+		http.Error(w, "Check-in failed", http.StatusInternalServerError)
+		return
+	}
+	// The warning set before the check-in no longer applies
+	w.Header().Del("X-Dead-Drop-Scuttle-Deadline")
+	audited := a.record(r, actor, "checkin", "", "")
+	a.respond(w, http.StatusOK, audited, checkInStatus{LastCheckIn: now, Deadline: now.Add(period)})
+}
+
+// handleReloadConfig re-reads the config file, as SIGHUP does, and reports
+// which settings were applied and which sections wait for a restart.
+func (a *adminAPI) handleReloadConfig(w http.ResponseWriter, r *http.Request, actor string) {
+	if a.server.reloader == nil {
+		http.Error(w, "Server was started without a config file", http.StatusNotFound)
+		return
+	}
+	result, err := a.server.reloader.reload()
+	a.server.reloader.logReload(result, err)
+	if err != nil {
+		a.record(r, actor, "config_reload_failed", "", "")
+		http.Error(w, fmt.Sprintf("Config reload failed, settings unchanged: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+	audited := a.record(r, actor, "config_reload", "", result.String())
+	a.respond(w, http.StatusOK, audited, result)
+}
+
+// handleClusters groups drops with similar fuzzy hashes, optionally within
+// one campaign (campaign query parameter) and at a given score (threshold,
+// 1-100).
+func (a *adminAPI) handleClusters(w http.ResponseWriter, r *http.Request, actor string) {
+	campaign, ok := a.scopedCampaign(w, r, actor)
+	if !ok {
+		return
+	}
+	threshold := fuzzyhash.DefaultThreshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "Invalid threshold: use 1-100", http.StatusBadRequest)
+			return
+		}
+		threshold = n
+	}
+	clusters, err := a.server.storage.Clusters(campaign, threshold)
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	if clusters == nil {
+		clusters = [][]string{}
+	}
+	a.respond(w, http.StatusOK, true, map[string][][]string{"clusters": clusters})
+}
+
+// handleCampaigns reports drop counts and stored bytes per campaign code.
+// Configured campaigns without drops are listed with zero counts; drops
+// without a campaign are under "". Sources never see these numbers, and
+// receivers only those of their campaigns.
+func (a *adminAPI) handleCampaigns(w http.ResponseWriter, _ *http.Request, actor string) {
+	counts, err := a.server.storage.CampaignCounts()
+	if err != nil {
+		storageError(w, err)
+		return
+	}
+	for code := range a.server.config().Campaigns {
+		if _, ok := counts[code]; !ok {
+			counts[code] = storage.CampaignCount{}
+		}
+	}
+	if scope := a.token(actor).campaigns; scope != nil {
+		maps.DeleteFunc(counts, func(code string, _ storage.CampaignCount) bool {
+			return !slices.Contains(scope, code)
+		})
+	}
+	a.respond(w, http.StatusOK, true, map[string]map[string]storage.CampaignCount{"campaigns": counts})
+}
+
+// handleCSPReports reports the Content-Security-Policy violations browsers
+// have reported since the server started, by directive and blocked source.
+func (a *adminAPI) handleCSPReports(w http.ResponseWriter, _ *http.Request, _ string) {
+	if a.server.cspReports == nil {
+		http.Error(w, "CSP reports are disabled", http.StatusNotFound)
+		return
+	}
+	a.respond(w, http.StatusOK, true, map[string][]cspViolation{"violations": a.server.cspReports.violations()})
+}
+
+// canaryError maps a canary store error to an HTTP status.
+func canaryError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrLocked):
+		storageError(w, err)
+	case errors.Is(err, canary.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, canary.ErrNotFound):
+		http.Error(w, "Canary not found", http.StatusNotFound)
+	default:
+		log.Printf("Canary file access failed: %v", err)
+		http.Error(w, "Canary file unreadable", http.StatusInternalServerError)
+	}
+}
+
+// canaryStore returns the canary store, writing an error response if
+// canary matching is disabled.
+func (a *adminAPI) canaryStore(w http.ResponseWriter) (*canary.Store, bool) {
+	if a.server.canaries == nil {
+		http.Error(w, "Canary matching is disabled", http.StatusNotFound)
+		return nil, false
+	}
+	return a.server.canaries, true
+}
+
+func (a *adminAPI) handleListCanaries(w http.ResponseWriter, _ *http.Request, _ string) {
+	store, ok := a.canaryStore(w)
+	if !ok {
+		return
+	}
+	list, err := store.List()
+	if err != nil {
+		canaryError(w, err)
+		return
+	}
+	if list == nil {
+		list = []canary.Canary{}
+	}
+	a.respond(w, http.StatusOK, true, map[string][]canary.Canary{"canaries": list})
+}
+
+// handleAddCanary registers a canary document from the name, sha256, and
+// ssdeep form fields. Only hashes are sent: the document never reaches the
+// server.
+func (a *adminAPI) handleAddCanary(w http.ResponseWriter, r *http.Request, actor string) {
+	store, ok := a.canaryStore(w)
+	if !ok {
+		return
+	}
+	c := canary.Canary{
+		Name:   r.FormValue("name"),
+		SHA256: r.FormValue("sha256"),
+		SSDeep: r.FormValue("ssdeep"),
+	}
+	if err := store.Add(c); err != nil {
+		canaryError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "canary_registered", "", c.Name)
+	a.respond(w, http.StatusCreated, audited, map[string]string{"status": "registered"})
+}
+
+func (a *adminAPI) handleRemoveCanary(w http.ResponseWriter, r *http.Request, actor string) {
+	store, ok := a.canaryStore(w)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if err := store.Remove(name); err != nil {
+		canaryError(w, err)
+		return
+	}
+	audited := a.record(r, actor, "canary_removed", "", name)
+	a.respond(w, http.StatusOK, audited, map[string]string{"status": "removed"})
+}
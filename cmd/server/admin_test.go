@@ -0,0 +1,629 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/audit"
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+const (
+	aliceToken = "alice-token-0123456789abcdef0123456789"
+	bobToken   = "bob-token-0123456789abcdef0123456789ab"
+)
+
+func newTestAdmin(t *testing.T) (*adminAPI, string) {
+	t.Helper()
+	s := newTestServer(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	a, err := newAdminAPI(s, []config.AdminToken{
+		{Name: "alice", Token: aliceToken},
+		{Name: "bob", Token: bobToken},
+	}, auditLog)
+	if err != nil {
+		t.Fatalf("newAdminAPI error: %v", err)
+	}
+	return a, auditPath
+}
+
+func adminDo(t *testing.T, a *adminAPI, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func saveTestDrop(t *testing.T, s *Server) string {
+	t.Helper()
+	drop, err := s.storage.SaveDrop("test.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return drop.ID
+}
+
+func TestAdmin_RequiresToken(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+
+	for _, token := range []string{"", "wrong-token-0123456789abcdef0123456789"} {
+		if rec := adminDo(t, a, http.MethodGet, "/admin/v1/holds", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, rec.Code)
+		}
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "auth_failed" {
+		t.Errorf("failed attempts should be audited, got %+v", entries)
+	}
+}
+
+func TestAdmin_LegalHoldDualControl(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	id := saveTestDrop(t, a.server)
+	holdPath := "/admin/v1/drops/" + id + "/hold"
+
+	if rec := adminDo(t, a, http.MethodPost, holdPath, aliceToken); rec.Code != http.StatusOK {
+		t.Fatalf("set hold: status = %d", rec.Code)
+	}
+
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/holds", bobToken)
+	var list map[string][]string
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list["holds"]) != 1 || list["holds"][0] != id {
+		t.Errorf("holds = %v, want [%s]", list["holds"], id)
+	}
+
+	// Manual deletion is blocked
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/drops/"+id, aliceToken); rec.Code != http.StatusConflict {
+		t.Errorf("delete held drop: status = %d, want 409", rec.Code)
+	}
+
+	// One admin cannot lift the hold alone
+	if rec := adminDo(t, a, http.MethodDelete, holdPath, aliceToken); rec.Code != http.StatusAccepted {
+		t.Fatalf("first release approval: status = %d, want 202", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, holdPath, aliceToken); rec.Code != http.StatusConflict {
+		t.Errorf("repeat approval by same admin: status = %d, want 409", rec.Code)
+	}
+	if payload, _ := a.server.storage.GetDropMetadata(id); !payload.LegalHold {
+		t.Fatal("hold should remain after a single approval")
+	}
+
+	// A second admin completes the release
+	if rec := adminDo(t, a, http.MethodDelete, holdPath, bobToken); rec.Code != http.StatusOK {
+		t.Fatalf("second release approval: status = %d, want 200", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/drops/"+id, bobToken); rec.Code != http.StatusOK {
+		t.Errorf("delete after release: status = %d, want 200", rec.Code)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Actor+":"+e.Action)
+	}
+	want := "alice:legal_hold_set alice:drop_delete_refused alice:legal_hold_release_requested bob:legal_hold_released bob:drop_deleted"
+	if got := strings.Join(actions, " "); got != want {
+		t.Errorf("audit trail = %q, want %q", got, want)
+	}
+}
+
+func TestAdmin_Errors(t *testing.T) {
+	a, _ := newTestAdmin(t)
+
+	if rec := adminDo(t, a, http.MethodPost, "/admin/v1/drops/not-an-id/hold", aliceToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid ID: status = %d, want 400", rec.Code)
+	}
+	missing := "/admin/v1/drops/abcdef0123456789abcdef0123456789"
+	if rec := adminDo(t, a, http.MethodPost, missing+"/hold", aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("missing drop: status = %d, want 404", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, missing, aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("delete missing drop: status = %d, want 404", rec.Code)
+	}
+
+	id := saveTestDrop(t, a.server)
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/drops/"+id+"/hold", aliceToken); rec.Code != http.StatusConflict {
+		t.Errorf("release without hold: status = %d, want 409", rec.Code)
+	}
+}
+
+func TestNewAdminAPI_RejectsWeakTokens(t *testing.T) {
+	s := newTestServer(t)
+	cases := [][]config.AdminToken{
+		nil,
+		{{Name: "alice", Token: "short"}},
+		{{Name: "", Token: aliceToken}},
+		{{Name: "alice", Token: aliceToken}, {Name: "alice", Token: bobToken}},
+		{{Name: "alice", Token: aliceToken}, {Name: "bob", Token: aliceToken}},
+	}
+	for i, tokens := range cases {
+		if _, err := newAdminAPI(s, tokens, nil); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestAdmin_Incidents(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	s := a.server
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/incidents", aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("disabled log: status = %d, want 404", rec.Code)
+	}
+
+	s.incidents = incidents.New(filepath.Join(t.TempDir(), "incidents"), func() ([]byte, error) {
+		return s.storage.SubKey("incidents")
+	})
+	id := saveTestDrop(t, s)
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, id, "wrong"))
+	s.incidents.Record(incidents.KindHoneypotAccess, id, "tor_exit")
+
+	rec = adminDo(t, a, http.MethodGet, "/admin/v1/incidents?kind=invalid_receipt", aliceToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		Incidents []incidents.Event `json:"incidents"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Incidents) != 1 || list.Incidents[0].Origin != "clearnet" || list.Incidents[0].DropID != "" {
+		t.Errorf("incidents = %+v, want one invalid receipt without drop ID", list.Incidents)
+	}
+
+	rec = adminDo(t, a, http.MethodGet, "/admin/v1/incidents/export", bobToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export status = %d", rec.Code)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment;") {
+		t.Error("export should be an attachment")
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Incidents) != 2 {
+		t.Errorf("exported %d incidents, want 2", len(list.Incidents))
+	}
+
+	entries, _ := audit.Verify(auditPath)
+	if len(entries) != 1 || entries[0].Action != "incidents_exported" || entries[0].Actor != "bob" {
+		t.Errorf("export should be audited, got %+v", entries)
+	}
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/incidents?since=yesterday", aliceToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad since: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdmin_Notes(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	id := saveTestDrop(t, a.server)
+	notePath := "/admin/v1/drops/" + id + "/note"
+
+	form := "status=reviewing&initials=AB&text=" + strings.Repeat("confidential+", 2)
+	req := httptest.NewRequest(http.MethodPut, notePath, strings.NewReader(form))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set note: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = adminDo(t, a, http.MethodGet, "/admin/v1/drops", bobToken)
+	var list struct {
+		Drops []struct {
+			ID   string `json:"id"`
+			Note *struct {
+				Status   string `json:"status"`
+				Initials string `json:"initials"`
+				Text     string `json:"text"`
+			} `json:"note"`
+		} `json:"drops"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Drops) != 1 || list.Drops[0].ID != id || list.Drops[0].Note == nil ||
+		list.Drops[0].Note.Status != "reviewing" || list.Drops[0].Note.Initials != "AB" {
+		t.Fatalf("unexpected listing: %s", rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "test.txt") {
+		t.Error("listing should not include filenames")
+	}
+
+	if rec := adminDo(t, a, http.MethodDelete, notePath, bobToken); rec.Code != http.StatusOK {
+		t.Fatalf("clear note: status = %d", rec.Code)
+	}
+	if meta, _ := a.server.storage.GetDropMetadata(id); meta.Note != nil {
+		t.Errorf("note should be cleared, got %+v", meta.Note)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "note_set" || entries[1].Action != "note_cleared" {
+		t.Errorf("unexpected audit entries: %+v", entries)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Detail, "confidential") {
+			t.Error("note text should not be copied into the audit log")
+		}
+	}
+}
+
+func TestAdmin_InspectQuotaCleanup(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	id := saveTestDrop(t, a.server)
+
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops/"+id, aliceToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("inspect: status = %d", rec.Code)
+	}
+	var info map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if info["filename"] != "test.txt" || info["size"] == float64(0) {
+		t.Errorf("unexpected inspection: %s", rec.Body.String())
+	}
+	if _, ok := info["receipt"]; ok {
+		t.Error("inspection must not include the receipt")
+	}
+
+	rec = adminDo(t, a, http.MethodGet, "/admin/v1/quota", aliceToken)
+	var quota quotaReport
+	json.Unmarshal(rec.Body.Bytes(), &quota)
+	if rec.Code != http.StatusOK || quota.DropCount != 1 || quota.TotalBytes == 0 {
+		t.Errorf("quota: status %d, %+v", rec.Code, quota)
+	}
+
+	rec = adminDo(t, a, http.MethodPost, "/admin/v1/cleanup", bobToken)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleted":0`) {
+		t.Errorf("cleanup: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "drop_inspected" || entries[1].Action != "cleanup_run" {
+		t.Errorf("unexpected audit entries: %+v", entries)
+	}
+}
+
+func TestAdmin_Canaries(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/canaries", aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("disabled: status = %d, want 404", rec.Code)
+	}
+	a.server.canaries = canary.New(filepath.Join(t.TempDir(), "canaries"), func() ([]byte, error) {
+		return a.server.storage.SubKey("canaries")
+	}, 0)
+
+	post := func(form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/v1/canaries", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		rec := httptest.NewRecorder()
+		a.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := post("name=memo&sha256=" + strings.Repeat("ab", 32)); rec.Code != http.StatusCreated {
+		t.Fatalf("register: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec := post("name=bad&sha256=xyz"); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed hash: status = %d, want 400", rec.Code)
+	}
+
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/canaries", bobToken)
+	if !strings.Contains(rec.Body.String(), `"name":"memo"`) {
+		t.Errorf("listing = %s", rec.Body.String())
+	}
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/canaries/memo", bobToken); rec.Code != http.StatusOK {
+		t.Errorf("remove: status = %d", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/canaries/memo", bobToken); rec.Code != http.StatusNotFound {
+		t.Errorf("remove again: status = %d, want 404", rec.Code)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "canary_registered" || entries[1].Action != "canary_removed" {
+		t.Errorf("unexpected audit entries: %+v", entries)
+	}
+}
+
+func TestAdmin_ListDropsPaged(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	for _, campaign := range []string{"tips", "tips", "tips", ""} {
+		opts := &storage.SaveOptions{Campaign: campaign}
+		if _, err := a.server.storage.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("data")), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var pages []string
+	for offset := 0; offset < 3; offset += 2 {
+		rec := adminDo(t, a, http.MethodGet, fmt.Sprintf("/admin/v1/drops?campaign=tips&limit=2&offset=%d", offset), aliceToken)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		var list struct {
+			Drops []storage.DropSummary `json:"drops"`
+			Total int                   `json:"total"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		if list.Total != 3 {
+			t.Errorf("total = %d, want 3", list.Total)
+		}
+		for _, d := range list.Drops {
+			if d.Campaign != "tips" {
+				t.Errorf("drop %s of campaign %q listed", d.ID, d.Campaign)
+			}
+			pages = append(pages, d.ID)
+		}
+	}
+	if len(pages) != 3 || pages[0] == pages[1] || pages[1] == pages[2] {
+		t.Errorf("pages listed %v, want 3 distinct drops", pages)
+	}
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops?limit=-1", aliceToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative limit: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdmin_Campaigns(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	a.server.config().Campaigns = map[string]config.CampaignConfig{"tips": {}, "quiet": {}}
+	for _, campaign := range []string{"tips", "tips", ""} {
+		opts := &storage.SaveOptions{Campaign: campaign}
+		if _, err := a.server.storage.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("data")), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/campaigns", aliceToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var reply struct {
+		Campaigns map[string]storage.CampaignCount `json:"campaigns"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if got := reply.Campaigns["tips"]; got.Drops != 2 || got.Bytes == 0 {
+		t.Errorf("tips = %+v, want 2 drops", got)
+	}
+	if got, ok := reply.Campaigns["quiet"]; !ok || got.Drops != 0 {
+		t.Errorf("quiet = %+v (listed %v), want listed with 0 drops", got, ok)
+	}
+	if got := reply.Campaigns[""]; got.Drops != 1 {
+		t.Errorf("no campaign = %+v, want 1 drop", got)
+	}
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/campaigns", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestAdmin_Clusters(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	a.server.storage.FuzzyHash = true
+
+	var doc bytes.Buffer
+	for i := 0; doc.Len() < 20000; i++ {
+		fmt.Fprintf(&doc, "Shipment %d cleared customs at gate %d.\n", i*7919%10007, i%17)
+	}
+	ids := make(map[string]bool)
+	for _, data := range [][]byte{doc.Bytes(), bytes.Replace(doc.Bytes(), []byte("gate 3"), []byte("gate 9"), 1)} {
+		drop, err := a.server.storage.SaveDrop("manifest.txt", bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[drop.ID] = true
+	}
+	saveTestDrop(t, a.server)
+
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/clusters", aliceToken)
+	var reply struct {
+		Clusters [][]string `json:"clusters"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Clusters) != 1 || len(reply.Clusters[0]) != 2 || !ids[reply.Clusters[0][0]] || !ids[reply.Clusters[0][1]] {
+		t.Errorf("clusters = %s", rec.Body.String())
+	}
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/clusters?threshold=0", aliceToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("threshold=0: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestAdmin_Quarantine(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	id := saveTestDrop(t, a.server)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/v1/drops/"+id+"/quarantine", strings.NewReader("reason=av_signature"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	rec := httptest.NewRecorder()
+	a.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("quarantine: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = adminDo(t, a, http.MethodGet, "/admin/v1/quarantine", bobToken)
+	var list struct {
+		Quarantine []storage.DropSummary `json:"quarantine"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Quarantine) != 1 || list.Quarantine[0].ID != id || list.Quarantine[0].Quarantine != "av_signature" {
+		t.Fatalf("unexpected quarantine listing: %s", rec.Body.String())
+	}
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops/"+id, bobToken); rec.Code != http.StatusOK {
+		t.Errorf("inspect quarantined drop: status = %d", rec.Code)
+	}
+
+	if rec := adminDo(t, a, http.MethodPost, "/admin/v1/quarantine/"+id+"/release", bobToken); rec.Code != http.StatusOK {
+		t.Fatalf("release: status = %d", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/quarantine/"+id, bobToken); rec.Code != http.StatusNotFound {
+		t.Errorf("purge of released drop: status = %d, want 404", rec.Code)
+	}
+
+	if rec := adminDo(t, a, http.MethodPost, "/admin/v1/drops/"+id+"/quarantine", aliceToken); rec.Code != http.StatusOK {
+		t.Fatalf("quarantine again: status = %d", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/quarantine/"+id, bobToken); rec.Code != http.StatusOK {
+		t.Fatalf("purge: status = %d", rec.Code)
+	}
+	if drops, _ := a.server.storage.Quarantined(); len(drops) != 0 {
+		t.Errorf("quarantine after purge = %v", drops)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	want := "drop_quarantined drop_inspected quarantine_released drop_quarantined quarantine_purged"
+	if strings.Join(actions, " ") != want {
+		t.Errorf("audit actions = %v, want %s", actions, want)
+	}
+}
+
+func TestAdmin_ReceiverRole(t *testing.T) {
+	s := newTestServer(t)
+	auditPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+	const internToken = "intern-token-0123456789abcdef01234567"
+	a, err := newAdminAPI(s, []config.AdminToken{
+		{Name: "alice", Token: aliceToken},
+		{Name: "intern", Token: internToken, Role: config.RoleReceiver, Campaigns: []string{"tips"}},
+	}, auditLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make(map[string]string)
+	for _, campaign := range []string{"tips", "leaks"} {
+		drop, err := s.storage.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("data")), &storage.SaveOptions{Campaign: campaign})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[campaign] = drop.ID
+	}
+
+	// Store-wide endpoints need an operator
+	for _, req := range []struct{ method, path string }{
+		{http.MethodDelete, "/admin/v1/drops/" + ids["tips"]},
+		{http.MethodPost, "/admin/v1/cleanup"},
+		{http.MethodGet, "/admin/v1/quota"},
+		{http.MethodPost, "/admin/v1/drops/" + ids["tips"] + "/hold"},
+	} {
+		if rec := adminDo(t, a, req.method, req.path, internToken); rec.Code != http.StatusForbidden {
+			t.Errorf("receiver %s %s: status = %d, want 403", req.method, req.path, rec.Code)
+		}
+	}
+	if _, _, err := s.storage.GetDrop(ids["tips"]); err != nil {
+		t.Fatalf("drop deleted by a receiver: %v", err)
+	}
+
+	// Drops of its campaign only
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops", internToken)
+	var list dropList
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if rec.Code != http.StatusOK || list.Total != 1 || list.Drops[0].ID != ids["tips"] {
+		t.Errorf("receiver listing = %d %+v, want the tips drop", rec.Code, list)
+	}
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops?campaign=leaks", internToken); rec.Code != http.StatusForbidden {
+		t.Errorf("other campaign listing: status = %d, want 403", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops/"+ids["tips"], internToken); rec.Code != http.StatusOK {
+		t.Errorf("inspect in scope: status = %d", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops/"+ids["leaks"], internToken); rec.Code != http.StatusNotFound {
+		t.Errorf("inspect out of scope: status = %d, want 404", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodDelete, "/admin/v1/drops/"+ids["tips"]+"/note", internToken); rec.Code != http.StatusOK {
+		t.Errorf("annotate in scope: status = %d", rec.Code)
+	}
+	if rec := adminDo(t, a, http.MethodPost, "/admin/v1/drops/"+ids["tips"]+"/forward?delete=true", internToken); rec.Code != http.StatusForbidden {
+		t.Errorf("forward with delete: status = %d, want 403", rec.Code)
+	}
+
+	// Operators keep every endpoint and campaign
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/drops/"+ids["leaks"], aliceToken); rec.Code != http.StatusOK {
+		t.Errorf("operator inspect: status = %d", rec.Code)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forbidden := 0
+	for _, e := range entries {
+		if e.Action == "forbidden" {
+			if e.Actor != "intern" {
+				t.Errorf("refusal attributed to %q", e.Actor)
+			}
+			forbidden++
+		}
+	}
+	// Four store-wide requests, the other campaign, the other drop, and the delete
+	if forbidden != 7 {
+		t.Errorf("%d refusals audited, want 7", forbidden)
+	}
+}
+
+func TestNewAdminAPI_RejectsBadRoles(t *testing.T) {
+	s := newTestServer(t)
+	for _, tok := range []config.AdminToken{
+		{Name: "x", Token: aliceToken, Role: "intern"},
+		{Name: "x", Token: aliceToken, Campaigns: []string{"tips"}},
+	} {
+		if _, err := newAdminAPI(s, []config.AdminToken{tok}, nil); err == nil {
+			t.Errorf("token %+v accepted", tok)
+		}
+	}
+}
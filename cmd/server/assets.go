@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// overlayFS serves files from override where it has them and from base
+// otherwise. Directories are not merged: only files are looked up.
+type overlayFS struct {
+	override, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.override.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
+
+// openStaticDir opens server.static_dir, whose files override the embedded
+// assets of the same name under /static/ and whose templates subdirectory
+// overrides the page templates. Files are read through an os.Root, so no
+// name or symlink can reach outside the directory. The directory is checked
+// here so that mistakes stop the server at startup instead of failing
+// requests: every entry must be a regular file, or a symlink to one within
+// the directory, and every template must replace one of the embedded pages.
+func openStaticDir(dir string) (fs.FS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	fsys := root.FS()
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case name == "." || name == "templates" && d.IsDir():
+			return nil
+		case d.IsDir():
+			return fmt.Errorf("%s: only files and a templates directory are served", name)
+		}
+		// Symlinks are followed, and only within the root
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s: not a regular file", name)
+		}
+		if strings.HasPrefix(name, "templates/") {
+			if _, err := fs.Stat(templateFiles, name); err != nil {
+				return fmt.Errorf("%s: no such page to override", name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fsys, nil
+}
+
+// loadPages parses the page templates, each from override if it holds one
+// and from the embedded templates otherwise.
+func loadPages(override fs.FS) (*template.Template, error) {
+	names, err := fs.Glob(templateFiles, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	assets := overlayFS{override: override, base: templateFiles}
+	pages := template.New("")
+	for _, name := range names {
+		data, err := fs.ReadFile(assets, name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pages.New(path.Base(name)).Parse(string(data)); err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// staticAssets returns the files served under /static/.
+func (s *Server) staticAssets() fs.FS {
+	embedded, _ := fs.Sub(staticFiles, "static")
+	if s.assets == nil {
+		return embedded
+	}
+	return overlayFS{override: s.assets, base: embedded}
+}
+
+// pages returns the page templates.
+func (s *Server) pages() *template.Template {
+	if s.templates == nil {
+		return pageTemplates
+	}
+	return s.templates
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticDir_Overrides(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "style.css"), []byte("body { color: teal }"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	page := `<html><body>Déposer un fichier {{.MaxUploadMB}}</body></html>`
+	if err := os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte(page), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t)
+	var err error
+	if s.assets, err = openStaticDir(dir); err != nil {
+		t.Fatalf("openStaticDir: %v", err)
+	}
+	if s.templates, err = loadPages(s.assets); err != nil {
+		t.Fatalf("loadPages: %v", err)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleStatic()(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	if rec := get("/static/style.css"); rec.Body.String() != "body { color: teal }" {
+		t.Errorf("style.css not overridden: %q", rec.Body)
+	}
+	embedded, _ := staticFiles.ReadFile("static/app.js")
+	if rec := get("/static/app.js"); rec.Body.String() != string(embedded) {
+		t.Error("app.js not served from the embedded assets")
+	}
+	if rec := get("/static/templates"); rec.Code != http.StatusNotFound {
+		t.Errorf("templates directory served: %d", rec.Code)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(rec.Body.String(), "Déposer un fichier") {
+		t.Errorf("index not overridden: %q", rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	s.fail(rec, true, "Drop not found", http.StatusNotFound)
+	if !strings.Contains(rec.Body.String(), "Drop not found") {
+		t.Error("embedded error page not used")
+	}
+}
+
+func TestStaticDir_Rejected(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, setup := range map[string]func(dir string) error{
+		"symlink out": func(dir string) error {
+			return os.Symlink(outside, filepath.Join(dir, "app.js"))
+		},
+		"unknown page": func(dir string) error {
+			if err := os.Mkdir(filepath.Join(dir, "templates"), 0700); err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Join(dir, "templates", "admin.html"), nil, 0600)
+		},
+		"subdirectory": func(dir string) error {
+			return os.Mkdir(filepath.Join(dir, "fonts"), 0700)
+		},
+	} {
+		dir := t.TempDir()
+		if err := setup(dir); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := openStaticDir(dir); err == nil {
+			t.Errorf("%s: static_dir accepted", name)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "templates"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "templates", "error.html"), []byte("{{.Title"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assets, err := openStaticDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPages(assets); err == nil {
+		t.Error("broken template accepted")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// cleanBasePath normalizes server.base_path to "" (served at the root) or
+// a path with a leading slash and no trailing slash, e.g. "/securedrop".
+func cleanBasePath(p string) (string, error) {
+	p = strings.TrimRight(p, "/")
+	if p == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(p, "/") || strings.ContainsAny(p, "?#%\\\"'<> ") || strings.Contains(p, "//") {
+		return "", fmt.Errorf("invalid base_path %q: must be an absolute URL path such as /securedrop", p)
+	}
+	for _, seg := range strings.Split(p[1:], "/") {
+		if seg == "." || seg == ".." {
+			return "", fmt.Errorf("invalid base_path %q: must not contain . or .. segments", p)
+		}
+	}
+	return p, nil
+}
+
+// mountAt serves h under basePath, for a reverse proxy that forwards
+// https://example.org/securedrop/... unchanged. Handlers see paths with the
+// prefix removed; the bare prefix redirects to the prefix with a slash.
+func mountAt(basePath string, h http.Handler) http.Handler {
+	if basePath == "" {
+		return h
+	}
+	mux := http.NewServeMux()
+	mux.Handle(basePath+"/", http.StripPrefix(basePath, h))
+	mux.Handle(basePath, http.RedirectHandler(basePath+"/", http.StatusMovedPermanently))
+	return mux
+}
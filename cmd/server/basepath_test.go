@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCleanBasePath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":             "",
+		"/":            "",
+		"/securedrop":  "/securedrop",
+		"/securedrop/": "/securedrop",
+		"/a/b":         "/a/b",
+	} {
+		got, err := cleanBasePath(in)
+		if err != nil || got != want {
+			t.Errorf("cleanBasePath(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"securedrop", "/a//b", "/a/../b", "/a?b", "/a b", `/a"b`} {
+		if _, err := cleanBasePath(in); err == nil {
+			t.Errorf("cleanBasePath(%q) should fail", in)
+		}
+	}
+}
+
+func TestMountAt_BasePath(t *testing.T) {
+	s := newTestServer(t)
+	s.basePath = "/securedrop"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/v1/download-token", s.handleDownloadToken)
+	h := mountAt(s.basePath, mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/securedrop/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("index status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`href="/securedrop/static/style.css"`,
+		`src="/securedrop/static/app.js"`,
+		`action="/securedrop/submit"`,
+		`action="/securedrop/retrieve"`,
+		`data-token-url="/securedrop/api/v1/download-token"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("index page lacks %s", want)
+		}
+	}
+	if c := rec.Result().Cookies(); len(c) == 0 || c[0].Path != "/securedrop/" {
+		t.Errorf("CSRF cookie should be scoped to the base path: %v", c)
+	}
+
+	if rec := get("/securedrop"); rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "/securedrop/" {
+		t.Errorf("bare prefix: status = %d, Location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := get("/"); rec.Code != http.StatusNotFound {
+		t.Errorf("root outside the base path: status = %d, want 404", rec.Code)
+	}
+
+	drop, err := s.storage.SaveDrop("a.txt", strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := retrieveRequest(t, drop.ID, drop.Receipt)
+	req.URL.Path = "/securedrop/api/v1/download-token"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var resp struct {
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.URL != "/securedrop/download/"+resp.Token {
+		t.Errorf("download URL = %q (%v), want it under the base path", resp.URL, err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBinaryMatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-drop-server")
+	if err := os.WriteFile(path, []byte("binary"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// sha256sum of "binary"
+	const sum = "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd"
+
+	if got, ok, err := binaryMatches(path, strings.ToUpper(sum)); err != nil || !ok || got != sum {
+		t.Errorf("pinned digest: %q, %v, %v", got, ok, err)
+	}
+	if err := os.WriteFile(path, []byte("binary, altered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := binaryMatches(path, sum); err != nil || ok || got == sum {
+		t.Errorf("altered binary: %q, %v, %v", got, ok, err)
+	}
+	if _, _, err := binaryMatches(filepath.Join(t.TempDir(), "missing"), sum); err == nil {
+		t.Error("missing binary: no error")
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import "github.com/scttfrdmn/dead-drop/internal/crypto"
+
+// Multipliers estimating peak memory per byte of payload. An upload is held
+// by the multipart parser, the validator, and SaveDrop when fuzzy hashes or
+// triage statistics need the whole file; a download by the ciphertext and
+// plaintext buffers of the chunk being decrypted.
+const (
+	uploadMemoryFactor   = 3
+	downloadMemoryFactor = 2
+)
+
+// uploadCost estimates the memory an upload will hold. Requests without a
+// Content-Length are charged for the largest permitted upload.
+func (s *Server) uploadCost(contentLength int64) int64 {
+	limit := s.config().Server.MaxUploadMB * 1024 * 1024
+	if contentLength < 0 || contentLength > limit {
+		contentLength = limit
+	}
+	return contentLength * uploadMemoryFactor
+}
+
+// downloadCost estimates the memory a retrieval of a drop whose encrypted
+// data file is storedSize bytes will hold. Drops are decrypted a chunk at a
+// time, so no retrieval holds more than a chunk, however large the drop.
+// Drops stored before chunked encryption are decrypted whole and cost more
+// than this.
+func downloadCost(storedSize int64) int64 {
+	return min(storedSize, crypto.EncryptedSize(crypto.StreamChunkSize)) * downloadMemoryFactor
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+)
+
+func TestUploadCost(t *testing.T) {
+	s := newTestServer(t)
+	limit := s.config().Server.MaxUploadMB * 1024 * 1024
+
+	if got := s.uploadCost(1000); got != 1000*uploadMemoryFactor {
+		t.Errorf("uploadCost(1000) = %d", got)
+	}
+	if got := s.uploadCost(-1); got != limit*uploadMemoryFactor {
+		t.Errorf("unknown length should be charged the max upload, got %d", got)
+	}
+	if got := s.uploadCost(limit * 10); got != limit*uploadMemoryFactor {
+		t.Errorf("oversized length should be capped, got %d", got)
+	}
+}
+
+func TestHandleSubmit_ShedsWhenBudgetExhausted(t *testing.T) {
+	s := newTestServer(t)
+	s.memory = ratelimit.NewMemoryBudget(1024)
+	if !s.memory.Acquire(1024) {
+		t.Fatal("Acquire should succeed on an empty budget")
+	}
+
+	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+
+	s.memory.Release(1024)
+	body, ct = createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 once memory is available", rec.Code)
+	}
+	if s.memory.Used() != 0 {
+		t.Errorf("budget should be released after the request, used = %d", s.memory.Used())
+	}
+}
+
+func TestHandleRetrieve_ShedsWhenBudgetExhausted(t *testing.T) {
+	s := newTestServer(t)
+	drop, err := s.storage.SaveDrop("test.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.memory = ratelimit.NewMemoryBudget(1024)
+	s.memory.Acquire(1024)
+
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, drop.ID, drop.Receipt))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+const (
+	// maxBundleFiles bounds the files in one multi-file submission.
+	maxBundleFiles = 100
+
+	// bundleFilename names the drop a multi-file submission is stored as.
+	bundleFilename = "bundle.zip"
+
+	bundleContentType = "application/zip"
+)
+
+// upload is what a source sent to be stored as one drop: a file, or the
+// files of a multi-file submission, which are bundled into one.
+type upload struct {
+	file        io.Reader
+	name        string
+	contentType string
+	parts       []*multipart.FileHeader // set for a multi-file submission; file is then nil
+}
+
+// bundleUpload checks each file of a multi-file submission as inspectUpload
+// checks a single upload, recording flags, the scrub profile and the first
+// canary match in opts, and returns a zip archive of the checked files. The
+// entries are stored uncompressed, without timestamps, under their base
+// names, with duplicates numbered. When the submission declares the
+// recipient's fingerprint, each file must be sealed to it.
+func (s *Server) bundleUpload(ctx context.Context, parts []*multipart.FileHeader, opts *storage.SaveOptions) (io.ReadCloser, *canary.Match, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	var first *canary.Match
+	used := make(map[string]bool)
+	for i, part := range parts {
+		name := bundleEntryName(part.Filename, i, used)
+		match, err := s.bundlePart(ctx, zw, part, name, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		if first == nil {
+			first = match
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, err
+	}
+	// Each file raised its own flags, and a later canary match its name
+	if first != nil {
+		opts.Canary = first.Name
+	}
+	slices.Sort(opts.Flags)
+	opts.Flags = slices.Compact(opts.Flags)
+	return io.NopCloser(&buf), first, nil
+}
+
+// bundlePart checks one file of a bundle and adds it to zw as name.
+func (s *Server) bundlePart(ctx context.Context, zw *zip.Writer, part *multipart.FileHeader, name string, opts *storage.SaveOptions) (*canary.Match, error) {
+	f, err := part.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var file io.Reader = f
+	if fp := s.recipientFingerprint(); fp != "" && opts.KeyFingerprint == fp {
+		sealed, ok := checkSealed(file)
+		if !ok {
+			return nil, errNotSealed
+		}
+		file = sealed
+	}
+	checked, match, err := s.inspectUpload(ctx, name, file, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer checked.Close()
+	if err := addToBundle(zw, name, checked); err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// bundleEntryName returns the name of the i'th file of a bundle inside the
+// archive: its base name, numbered if an earlier file took it.
+func bundleEntryName(filename string, i int, used map[string]bool) string {
+	name := filepath.Base(filename)
+	if name == "." || name == string(filepath.Separator) {
+		name = fmt.Sprintf("file-%d", i+1)
+	}
+	base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	used[name] = true
+	return name
+}
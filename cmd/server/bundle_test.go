@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// createBundleForm returns a multipart form with one file part per entry of
+// files, in order, each under the field name "file".
+func createBundleForm(t *testing.T, files [][2]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, f := range files {
+		part, err := writer.CreateFormFile("file", f[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(f[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	return &buf, writer.FormDataContentType()
+}
+
+func TestHandleSubmit_MultipleFilesBundled(t *testing.T) {
+	s := newTestServer(t)
+	body, ct := createBundleForm(t, [][2]string{
+		{"notes.txt", "first file"},
+		{"../../etc/notes.txt", "same name, elsewhere"},
+		{"report.csv", "a,b\n1,2\n"},
+	})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	// One drop, one receipt, holding every file
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	data, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("drop is not a zip archive: %v", err)
+	}
+	want := map[string]string{
+		"notes.txt":   "first file",
+		"notes-2.txt": "same name, elsewhere",
+		"report.csv":  "a,b\n1,2\n",
+	}
+	if len(zr.File) != len(want) {
+		t.Fatalf("bundle has %d entries, want %d", len(zr.File), len(want))
+	}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != want[f.Name] {
+			t.Errorf("%s = %q, want %q", f.Name, got, want[f.Name])
+		}
+	}
+}
+
+func TestHandleSubmit_TooManyFiles(t *testing.T) {
+	s := newTestServer(t)
+	files := make([][2]string, maxBundleFiles+1)
+	for i := range files {
+		files[i] = [2]string{fmt.Sprintf("f%d.txt", i), "x"}
+	}
+	body, ct := createBundleForm(t, files)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestBundleEntryName(t *testing.T) {
+	used := make(map[string]bool)
+	for i, tc := range []struct{ in, want string }{
+		{"a.txt", "a.txt"},
+		{"dir/a.txt", "a-2.txt"},
+		{"a.txt", "a-3.txt"},
+		{"/", "file-4"},
+		{"README", "README"},
+		{"README", "README-2"},
+	} {
+		if got := bundleEntryName(tc.in, i, used); got != tc.want {
+			t.Errorf("bundleEntryName(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/honeypot"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
+)
+
+// canaryAlert reports an upload matching a canary document: in the log,
+// the incident log, and as a high-priority webhook alert. Nothing about the
+// source is sent; origin is the coarse origin of the upload for the incident
+// log, or "" if unknown.
+func (s *Server) canaryAlert(dropID string, match *canary.Match, origin string) {
+	log.Printf("CANARY ALERT: drop %s matches canary %q (score %d)", dropID, match.Name, match.Score) // #nosec G706 -- drop ID is generated hex, name is %q-quoted
+	if s.incidents != nil {
+		s.incidents.Record(incidents.KindCanaryUpload, dropID, origin)
+	}
+	if s.alerter != nil {
+		s.alerter.Send(&honeypot.AlertPayload{
+			Event:    "canary_upload",
+			DropID:   dropID,
+			Canary:   match.Name,
+			Priority: "high",
+		})
+	}
+}
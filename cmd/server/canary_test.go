@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+	"github.com/scttfrdmn/dead-drop/internal/honeypot"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func TestHandleSubmit_CanaryMatch(t *testing.T) {
+	s := newTestServer(t)
+	s.canaries = canary.New(filepath.Join(t.TempDir(), "canaries"), func() ([]byte, error) {
+		return s.storage.SubKey("canaries")
+	}, 0)
+
+	alerts := make(chan []byte, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		alerts <- body
+	}))
+	defer webhook.Close()
+	s.alerter = honeypot.NewAlerter(webhook.URL)
+
+	var memo bytes.Buffer
+	for i := 0; memo.Len() < 20000; i++ {
+		memo.WriteString("Quarterly review, internal draft, paragraph ")
+		memo.WriteString(string(rune('a' + i%26)))
+		memo.WriteString(". Figures are confidential.\n")
+	}
+	hash, err := fuzzyhash.Sum(memo.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.canaries.Add(canary.Canary{Name: "q3-memo", SSDeep: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy with its watermark changed still matches
+	leaked := bytes.Replace(memo.Bytes(), []byte("paragraph q"), []byte("paragraph Q"), 1)
+	body, ct := createMultipartForm(t, "memo.txt", leaked, nil)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: canary uploads are stored", rec.Code)
+	}
+
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	meta, err := s.storage.GetDropMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Canary != "q3-memo" || len(meta.Flags) != 1 || meta.Flags[0] != storage.FlagCanary {
+		t.Errorf("metadata canary = %q, flags = %v", meta.Canary, meta.Flags)
+	}
+
+	select {
+	case raw := <-alerts:
+		var alert map[string]string
+		if err := json.Unmarshal(raw, &alert); err != nil {
+			t.Fatal(err)
+		}
+		if alert["event"] != "canary_upload" || alert["priority"] != "high" ||
+			alert["canary"] != "q3-memo" || alert["drop_id"] != resp["drop_id"] {
+			t.Errorf("alert = %v", alert)
+		}
+		if _, ok := alert["remote_addr"]; ok {
+			t.Error("canary alert must not carry the source's address")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no canary alert was sent")
+	}
+
+	// Unrelated uploads are not flagged
+	body, ct = createMultipartForm(t, "other.txt", []byte("nothing to see here"), nil)
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	meta, err = s.storage.GetDropMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Canary != "" || len(meta.Flags) != 0 {
+		t.Errorf("unrelated upload: canary = %q, flags = %v", meta.Canary, meta.Flags)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// capacityResponse advertises what the dropzone currently accepts so that
+// clients and published instructions need not hardcode limits. It
+// deliberately omits remaining quota: only whether submissions are accepted.
+type capacityResponse struct {
+	AcceptingSubmissions bool     `json:"accepting_submissions"`
+	MaxUploadMB          int64    `json:"max_upload_mb"`
+	AcceptedTypes        []string `json:"accepted_types"`
+	BlockedTypes         []string `json:"blocked_types"`
+	RetentionClasses     []string `json:"retention_classes,omitempty"`
+	MaxExpiresHours      int      `json:"max_expires_hours,omitempty"`
+	TimeKey              string   `json:"time_key,omitempty"`   // Ed25519 key of signed time assertions
+	UploadKey            string   `json:"upload_key,omitempty"` // X25519 key of upload envelopes
+	ResumableUploads     bool     `json:"resumable_uploads,omitempty"`
+
+	RecipientKey string `json:"recipient_key,omitempty"` // age recipient of the receivers, to seal files to
+	PoWChallenge string `json:"pow_challenge,omitempty"` // endpoint of proof-of-work challenges, for hidden service clients
+}
+
+// submissionsPaused reports whether uploads are currently refused: the
+// operator paused them, the storage is locked, the storage key reached its
+// usage limit, or the quota is full.
+func (s *Server) submissionsPaused() bool {
+	if s.config().Security.SubmissionsPaused || s.storage.Locked() || s.storage.KeyExhausted() {
+		return true
+	}
+	return s.storage.Quota != nil && !s.storage.Quota.CanAccept(1)
+}
+
+// defaultQuotaAlerts are the usage thresholds, in percent, alerted on when
+// security.quota_alerts is not set.
+var defaultQuotaAlerts = []int{70, 85, 95}
+
+// quotaAlert tells operators that storage usage rose to percent of the
+// quota, before uploads start being refused.
+func (s *Server) quotaAlert(percent int) {
+	if s.config().Logging.Errors {
+		log.Printf("WARNING: storage usage reached %d%% of the quota", percent)
+	}
+	if s.notifier != nil {
+		s.notifier.QuotaThreshold(percent)
+	}
+}
+
+// quotaRetryAfter is the Retry-After, in seconds, sent with uploads refused
+// because the quota is full: freeing space takes an operator or the cleanup
+// of expired drops, so retrying at once cannot succeed.
+const quotaRetryAfter = "3600"
+
+// refuseQuotaFull answers an upload refused because the quota is full, with
+// security.quota_full_status and a Retry-After. The default 503 and message
+// are those of any other overload, so the reply tells no more than
+// /api/v1/capacity does.
+func (s *Server) refuseQuotaFull(w http.ResponseWriter, html bool) {
+	s.metrics.RecordQuotaRejected()
+	status := s.config().Security.QuotaFullStatus
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Retry-After", quotaRetryAfter)
+	s.fail(w, html, "Server busy, please try again later", status)
+}
+
+func (s *Server) handleCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSON(w, capacityResponse{
+		AcceptingSubmissions: !s.submissionsPaused(),
+		MaxUploadMB:          s.config().Server.MaxUploadMB,
+		AcceptedTypes:        s.validator().AllowedTypes,
+		BlockedTypes:         s.validator().BlockedTypes,
+		RetentionClasses:     s.selectableClasses(),
+		MaxExpiresHours:      s.config().Security.MaxExpiresHours,
+		TimeKey:              s.timeAssertionPublicKey(),
+		UploadKey:            s.envelopePublicKey(),
+		ResumableUploads:     s.uploads != nil,
+		RecipientKey:         s.recipientPublicKey(),
+		PoWChallenge:         s.powURL(r),
+	})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func getCapacity(t *testing.T, s *Server) capacityResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleCapacity(rec, httptest.NewRequest(http.MethodGet, "/api/v1/capacity", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp capacityResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	return resp
+}
+
+func TestHandleCapacity_Defaults(t *testing.T) {
+	s := newTestServer(t)
+	resp := getCapacity(t, s)
+
+	if !resp.AcceptingSubmissions {
+		t.Error("should accept submissions by default")
+	}
+	if resp.MaxUploadMB != s.config().Server.MaxUploadMB {
+		t.Errorf("max_upload_mb = %d, want %d", resp.MaxUploadMB, s.config().Server.MaxUploadMB)
+	}
+	if len(resp.AcceptedTypes) == 0 {
+		t.Error("accepted_types should not be empty")
+	}
+}
+
+func TestHandleCapacity_OperatorPause(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.SubmissionsPaused = true
+
+	if getCapacity(t, s).AcceptingSubmissions {
+		t.Error("paused server should not advertise accepting submissions")
+	}
+
+	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("submit status = %d, want 503 while paused", rec.Code)
+	}
+}
+
+func TestHandleCapacity_QuotaFull(t *testing.T) {
+	s := newTestServer(t)
+	qm, err := storage.NewQuotaManager(s.storage.StorageDir, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.storage.Quota = qm
+
+	if !getCapacity(t, s).AcceptingSubmissions {
+		t.Fatal("should accept before quota is used")
+	}
+	if err := qm.Reserve(10); err != nil {
+		t.Fatal(err)
+	}
+	if getCapacity(t, s).AcceptingSubmissions {
+		t.Error("full quota should pause submissions")
+	}
+}
+
+func TestHandleCapacity_KeyExhausted(t *testing.T) {
+	s := newTestServer(t)
+	s.storage.KeyLimits = storage.KeyLimits{MaxMessages: 2}
+
+	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first submit status = %d", rec.Code)
+	}
+
+	if getCapacity(t, s).AcceptingSubmissions {
+		t.Error("server with an exhausted key should not advertise accepting submissions")
+	}
+	body, ct = createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("submit status = %d, want 503 once the key is exhausted", rec.Code)
+	}
+}
+
+func TestHandleCapacity_MethodNotAllowed(t *testing.T) {
+	s := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.handleCapacity(rec, httptest.NewRequest(http.MethodPost, "/api/v1/capacity", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405", rec.Code)
+	}
+}
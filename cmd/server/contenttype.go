@@ -0,0 +1,33 @@
+package main
+
+import (
+	"mime"
+	"slices"
+)
+
+// defaultServeContentTypes are the recorded content types a drop is
+// downloaded with when security.serve_content_types is not set. None can
+// run script in a browser; downloads stay attachments with nosniff either way.
+var defaultServeContentTypes = []string{
+	"text/plain",
+	"application/pdf",
+	"image/png", "image/jpeg", "image/gif", "image/webp",
+	"audio/mpeg", "audio/ogg", "audio/wav",
+	"video/mp4", "video/webm",
+	"application/zip", "application/gzip",
+}
+
+// servedContentType returns the Content-Type for a drop whose recorded
+// content type is recorded: the recorded type if its media type is allowed,
+// application/octet-stream otherwise.
+func (s *Server) servedContentType(recorded string) string {
+	allowed := s.config().Security.ServeContentTypes
+	if allowed == nil {
+		allowed = defaultServeContentTypes
+	}
+	mediaType, _, err := mime.ParseMediaType(recorded)
+	if err != nil || !slices.Contains(allowed, mediaType) {
+		return "application/octet-stream"
+	}
+	return recorded
+}
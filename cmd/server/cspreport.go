@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// contentSecurityPolicy is sent with every response; with
+	// security.csp_reports, cspHeader adds where to report violations.
+	contentSecurityPolicy = "default-src 'self'; script-src 'self'; style-src 'self'"
+
+	// maxCSPReportBytes bounds one report body; browsers send well under 4 KiB.
+	maxCSPReportBytes = 16 << 10
+
+	// maxCSPViolations bounds the distinct directive and source pairs
+	// counted; further ones are counted under cspOther.
+	maxCSPViolations = 256
+
+	cspOther = "other"
+)
+
+// cspDirective matches a CSP directive name as reported.
+var cspDirective = regexp.MustCompile(`^[a-z-]{1,40}$`)
+
+// cspViolation is one directive and blocked source with the number of
+// reports of it. Nothing identifying the page or the browser is kept: the
+// blocked source is reduced to its origin or keyword.
+type cspViolation struct {
+	Directive string `json:"directive"`
+	Blocked   string `json:"blocked"`
+	Count     int64  `json:"count"`
+}
+
+type cspKey struct {
+	directive, blocked string
+}
+
+// cspReports aggregates the Content-Security-Policy violations browsers
+// report, for security.csp_reports. Counts are kept in memory only and read
+// through the admin API.
+type cspReports struct {
+	mu     sync.Mutex
+	counts map[cspKey]int64
+}
+
+func newCSPReports() *cspReports {
+	return &cspReports{counts: make(map[cspKey]int64)}
+}
+
+func (c *cspReports) record(directive, blocked string) {
+	k := cspKey{cspDirectiveName(directive), cspBlockedSource(blocked)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.counts[k]; !ok && len(c.counts) >= maxCSPViolations {
+		k = cspKey{cspOther, cspOther}
+	}
+	c.counts[k]++
+}
+
+// violations returns the counts, most reported first.
+func (c *cspReports) violations() []cspViolation {
+	c.mu.Lock()
+	out := make([]cspViolation, 0, len(c.counts))
+	for k, n := range c.counts {
+		out = append(out, cspViolation{Directive: k.directive, Blocked: k.blocked, Count: n})
+	}
+	c.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if out[i].Directive != out[j].Directive {
+			return out[i].Directive < out[j].Directive
+		}
+		return out[i].Blocked < out[j].Blocked
+	})
+	return out
+}
+
+// cspDirectiveName returns the directive a report names, such as
+// "script-src-elem", or cspOther for anything else.
+func cspDirectiveName(d string) string {
+	// Older browsers send the whole violated directive, sources and all
+	d, _, _ = strings.Cut(strings.TrimSpace(d), " ")
+	if !cspDirective.MatchString(d) {
+		return cspOther
+	}
+	return d
+}
+
+// cspBlockedSource reduces a reported blocked URI to what is worth counting:
+// a keyword such as "inline" or "eval", a scheme such as "data", or the
+// origin of a URL. Paths and queries, which may carry anything, are dropped.
+func cspBlockedSource(uri string) string {
+	switch uri {
+	case "inline", "eval", "wasm-eval", "trusted-types-policy", "trusted-types-sink":
+		return uri
+	case "":
+		return "none"
+	}
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" {
+		return cspOther
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if u.Host == "" {
+		if len(scheme) > 16 {
+			return cspOther
+		}
+		return scheme
+	}
+	origin := scheme + "://" + strings.ToLower(u.Host)
+	if len(origin) > 100 {
+		return cspOther
+	}
+	return origin
+}
+
+// handleCSPReport collects Content-Security-Policy violation reports in
+// either form browsers send: application/csp-report from report-uri, and
+// application/reports+json from report-to. It always answers 204, so a
+// page learns nothing from it.
+func (s *Server) handleCSPReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer w.WriteHeader(http.StatusNoContent)
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportBytes))
+	if err != nil {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/csp-report":
+		var report struct {
+			Body struct {
+				Effective string `json:"effective-directive"`
+				Violated  string `json:"violated-directive"`
+				Blocked   string `json:"blocked-uri"`
+			} `json:"csp-report"`
+		}
+		if json.Unmarshal(body, &report) != nil {
+			return
+		}
+		directive := report.Body.Effective
+		if directive == "" {
+			directive = report.Body.Violated
+		}
+		s.cspReports.record(directive, report.Body.Blocked)
+
+	case "application/reports+json":
+		var reports []struct {
+			Type string `json:"type"`
+			Body struct {
+				Effective string `json:"effectiveDirective"`
+				Blocked   string `json:"blockedURL"`
+			} `json:"body"`
+		}
+		if json.Unmarshal(body, &reports) != nil {
+			return
+		}
+		for _, report := range reports {
+			if report.Type == "csp-violation" {
+				s.cspReports.record(report.Body.Effective, report.Body.Blocked)
+			}
+		}
+	}
+}
+
+// cspHeader returns the Content-Security-Policy to send, with report
+// directives when reports are collected.
+func (s *Server) cspHeader() string {
+	if s.cspReports == nil {
+		return contentSecurityPolicy
+	}
+	return contentSecurityPolicy + "; report-uri " + s.basePath + "/csp-report; report-to csp"
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleCSPReport(t *testing.T) {
+	s := newTestServer(t)
+	s.cspReports = newCSPReports()
+
+	post := func(contentType, body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		s.handleCSPReport(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d", rec.Code)
+		}
+	}
+	post("application/csp-report", `{"csp-report":{"document-uri":"https://drop.example/?id=abc",`+
+		`"violated-directive":"script-src 'self'","blocked-uri":"https://evil.example/x.js?leak=1"}}`)
+	post("application/reports+json", `[{"type":"csp-violation","url":"https://drop.example/",`+
+		`"body":{"effectiveDirective":"script-src-elem","blockedURL":"https://EVIL.example/y.js"}},`+
+		`{"type":"csp-violation","body":{"effectiveDirective":"script-src-elem","blockedURL":"https://evil.example/z.js"}},`+
+		`{"type":"deprecation","body":{}}]`)
+	post("application/csp-report", `{"csp-report":{"effective-directive":"style-src-attr","blocked-uri":"inline"}}`)
+	post("application/csp-report", `not json`)
+
+	got := s.cspReports.violations()
+	want := []cspViolation{
+		{Directive: "script-src-elem", Blocked: "https://evil.example", Count: 2},
+		{Directive: "script-src", Blocked: "https://evil.example", Count: 1},
+		{Directive: "style-src-attr", Blocked: "inline", Count: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("violations = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("violation %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCSPReports_Bounded(t *testing.T) {
+	c := newCSPReports()
+	for i := 0; i < maxCSPViolations+10; i++ {
+		c.record("img-src", "https://host"+strings.Repeat("x", i%200)+".example")
+		c.record("img-src", "data:"+strings.Repeat("y", i))
+	}
+	if n := len(c.violations()); n > maxCSPViolations+1 {
+		t.Errorf("%d distinct violations kept, want at most %d", n, maxCSPViolations+1)
+	}
+}
+
+func TestSecurityHeaders_CSPReportDirectives(t *testing.T) {
+	s := newTestServer(t)
+	handler := s.securityHeaders(func(w http.ResponseWriter, _ *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); csp != contentSecurityPolicy {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+	if rec.Header().Get("Reporting-Endpoints") != "" {
+		t.Error("Reporting-Endpoints sent with reports off")
+	}
+
+	s.cspReports = newCSPReports()
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.HasSuffix(csp, "; report-uri /csp-report; report-to csp") {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+	if re := rec.Header().Get("Reporting-Endpoints"); re != `csp="/csp-report"` {
+		t.Errorf("Reporting-Endpoints = %q", re)
+	}
+}
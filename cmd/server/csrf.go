@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// csrfCookieName holds the browser's copy of the double-submit token.
+	csrfCookieName = "dd_csrf"
+	// csrfFieldName is the hidden form field carrying the submitted copy.
+	csrfFieldName = "csrf_token"
+
+	defaultCSRFTokenTTL = time.Hour
+
+	csrfNonceSize = 16
+	csrfRawSize   = 8 + csrfNonceSize + sha256.Size
+)
+
+// csrfTokens issues and verifies time-limited double-submit tokens for the
+// HTML form path, where the X-Dead-Drop-Upload header cannot be set.
+//
+// A token is base64url(expiry || nonce || HMAC-SHA256(key, expiry || nonce)).
+// It is stored in a SameSite=Strict cookie and embedded in the form; a
+// submission must present the same valid, unexpired token in both places. The
+// key is generated per process, so tokens do not survive a restart.
+type csrfTokens struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// newCSRFTokens creates a token issuer with a fresh random key. A ttl <= 0
+// selects a one-hour lifetime.
+func newCSRFTokens(ttl time.Duration) (*csrfTokens, error) {
+	if ttl <= 0 {
+		ttl = defaultCSRFTokenTTL
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate CSRF key: %w", err)
+	}
+	return &csrfTokens{key: key, ttl: ttl, now: time.Now}, nil
+}
+
+// Issue returns a new token valid for the configured lifetime.
+func (c *csrfTokens) Issue() (string, error) {
+	raw := make([]byte, csrfRawSize)
+	binary.BigEndian.PutUint64(raw[:8], uint64(c.now().Add(c.ttl).Unix())) // #nosec G115 -- Unix time is positive
+	if _, err := rand.Read(raw[8 : 8+csrfNonceSize]); err != nil {
+		return "", fmt.Errorf("failed to generate CSRF nonce: %w", err)
+	}
+	copy(raw[8+csrfNonceSize:], c.mac(raw[:8+csrfNonceSize]))
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Valid reports whether token was issued by c and has not expired.
+func (c *csrfTokens) Valid(token string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != csrfRawSize {
+		return false
+	}
+	if !hmac.Equal(raw[8+csrfNonceSize:], c.mac(raw[:8+csrfNonceSize])) {
+		return false
+	}
+	expiry := time.Unix(int64(binary.BigEndian.Uint64(raw[:8])), 0) // #nosec G115 -- authenticated value written by Issue
+	return c.now().Before(expiry)
+}
+
+func (c *csrfTokens) mac(data []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// issueCSRFToken sets a fresh token cookie and returns the token to embed in
+// the page.
+func (s *Server) issueCSRFToken(w http.ResponseWriter) (string, error) {
+	token, err := s.csrf.Issue()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     s.basePath + "/",
+		MaxAge:   int(s.csrf.ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   s.tlsEnabled,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// hasCSRFCookie reports whether the request carries a token cookie at all,
+// allowing obviously forged posts to be rejected before the body is parsed.
+func hasCSRFCookie(r *http.Request) bool {
+	_, err := r.Cookie(csrfCookieName)
+	return err == nil
+}
+
+// validCSRFToken reports whether the form token matches the cookie token and
+// is valid. The body must be parsed (e.g., by FormFile) before calling.
+func (s *Server) validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookieName)
+	if err != nil {
+		return false
+	}
+	field := r.FormValue(csrfFieldName)
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(field)) != 1 {
+		return false
+	}
+	return s.csrf.Valid(field)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSRFTokens_RoundTrip(t *testing.T) {
+	c, err := newCSRFTokens(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Valid(token) {
+		t.Error("freshly issued token should be valid")
+	}
+
+	other, err := c.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == other {
+		t.Error("tokens should be unique")
+	}
+}
+
+func TestCSRFTokens_Expiry(t *testing.T) {
+	c, err := newCSRFTokens(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	token, err := c.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.now = func() time.Time { return now.Add(59 * time.Second) }
+	if !c.Valid(token) {
+		t.Error("token should be valid before expiry")
+	}
+	c.now = func() time.Time { return now.Add(61 * time.Second) }
+	if c.Valid(token) {
+		t.Error("token should be invalid after expiry")
+	}
+}
+
+func TestCSRFTokens_Tampered(t *testing.T) {
+	c, err := newCSRFTokens(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a character in the expiry portion
+	b := []byte(token)
+	if b[2] == 'A' {
+		b[2] = 'B'
+	} else {
+		b[2] = 'A'
+	}
+
+	for _, bad := range []string{"", "not-base64!", strings.Repeat("A", 10), string(b)} {
+		if c.Valid(bad) {
+			t.Errorf("Valid(%q) = true, want false", bad)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+const (
+	defaultDownloadTokenTTL = time.Minute
+
+	// maxDownloadTokens bounds outstanding tokens so that exchanging
+	// credentials in a loop cannot grow memory without limit.
+	maxDownloadTokens = 10000
+
+	downloadTokenSize = 32
+)
+
+// errTooManyTokens is returned when the outstanding token limit is reached.
+var errTooManyTokens = errors.New("too many outstanding download tokens")
+
+type pendingDownload struct {
+	dropID  string
+	expires time.Time
+}
+
+// downloadTokens holds short-lived, single-use download tokens. The web UI
+// exchanges a drop ID and receipt for a token in a POST body, then fetches
+// the file with a plain GET of /download/<token>, so the credentials never
+// appear in a URL and the URL that does is useless once used or expired.
+//
+// Tokens are kept in memory, keyed by their SHA-256, and do not survive a
+// restart.
+type downloadTokens struct {
+	mu      sync.Mutex
+	pending map[[sha256.Size]byte]pendingDownload
+	ttl     time.Duration
+	now     func() time.Time
+}
+
+// newDownloadTokens creates a token store. A ttl <= 0 selects one minute.
+func newDownloadTokens(ttl time.Duration) *downloadTokens {
+	if ttl <= 0 {
+		ttl = defaultDownloadTokenTTL
+	}
+	return &downloadTokens{
+		pending: make(map[[sha256.Size]byte]pendingDownload),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Issue returns a new token for dropID.
+func (d *downloadTokens) Issue(dropID string) (string, error) {
+	raw := make([]byte, downloadTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate download token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	if len(d.pending) >= maxDownloadTokens {
+		for k, p := range d.pending {
+			if !now.Before(p.expires) {
+				delete(d.pending, k)
+			}
+		}
+		if len(d.pending) >= maxDownloadTokens {
+			return "", errTooManyTokens
+		}
+	}
+	d.pending[sha256.Sum256([]byte(token))] = pendingDownload{dropID: dropID, expires: now.Add(d.ttl)}
+	return token, nil
+}
+
+// Redeem consumes token and returns the drop it was issued for. A token can
+// be redeemed once, and only before it expires.
+func (d *downloadTokens) Redeem(token string) (string, bool) {
+	key := sha256.Sum256([]byte(token))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.pending[key]
+	if !ok {
+		return "", false
+	}
+	delete(d.pending, key)
+	return p.dropID, d.now().Before(p.expires)
+}
+
+// handleDownloadToken exchanges a drop ID and receipt, sent in a POST body,
+// for a download token.
+func (s *Server) handleDownloadToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropID, ok := s.retrievalCredentials(w, r, false)
+	if !ok {
+		return
+	}
+
+	// A link cannot carry the passphrase; the web UI posts it to /retrieve
+	meta, err := s.storage.GetDropMetadata(dropID)
+	if err == nil && meta.PassphraseSalt != nil {
+		s.dropUnavailable(w, false, storage.ErrPassphraseRequired)
+		return
+	}
+
+	token, err := s.downloads.Issue(dropID)
+	if err != nil {
+		s.fail(w, false, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	resp := map[string]any{
+		"token":      token,
+		"url":        s.basePath + "/download/" + token,
+		"expires_in": int(s.downloads.ttl.Seconds()),
+	}
+	// The browser saves the download itself and cannot see the integrity
+	// trailer, so the web UI shows the stored hash for the receiver to check.
+	// A drop with a message downloads as an archive, which it would not match.
+	if meta != nil && meta.Processing == "" && meta.FileHash != "" && meta.Message == "" {
+		resp["sha256"] = meta.FileHash
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, resp)
+}
+
+// handleDownload serves the drop for a token from handleDownloadToken.
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	html := acceptsHTML(r)
+	dropID, ok := s.downloads.Redeem(strings.TrimPrefix(r.URL.Path, "/download/"))
+	if !ok {
+		s.fail(w, html, "Download link expired or already used", http.StatusNotFound)
+		return
+	}
+	if s.storage.Locked() {
+		s.fail(w, html, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.serveDrop(w, r, html, dropID, nil, "")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadTokens_SingleUseAndExpiry(t *testing.T) {
+	d := newDownloadTokens(time.Minute)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	token, err := d.Issue("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := d.Redeem(token); !ok || id != "abc" {
+		t.Fatalf("Redeem = %q, %v; want abc, true", id, ok)
+	}
+	if _, ok := d.Redeem(token); ok {
+		t.Error("token should be single-use")
+	}
+
+	token, _ = d.Issue("abc")
+	now = now.Add(2 * time.Minute)
+	if _, ok := d.Redeem(token); ok {
+		t.Error("expired token should be rejected")
+	}
+	if _, ok := d.Redeem("bogus"); ok {
+		t.Error("unknown token should be rejected")
+	}
+}
+
+func TestHandleDownload_TokenExchange(t *testing.T) {
+	s := newTestServer(t)
+	drop, err := s.storage.SaveDrop("secret.txt", strings.NewReader("secret content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := retrieveRequest(t, drop.ID, drop.Receipt)
+	req.URL.Path = "/api/v1/download-token"
+	rec := httptest.NewRecorder()
+	s.handleDownloadToken(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Token  string `json:"token"`
+		URL    string `json:"url"`
+		SHA256 string `json:"sha256"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.Token == "" || resp.URL != "/download/"+resp.Token {
+		t.Fatalf("unexpected response: %s", rec.Body.String())
+	}
+	if sum := sha256.Sum256([]byte("secret content")); resp.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("sha256 = %q, want the hash of the stored file", resp.SHA256)
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleDownload(rec, httptest.NewRequest(http.MethodGet, resp.URL, nil))
+		return rec
+	}
+	rec = get()
+	if rec.Code != http.StatusOK || rec.Body.String() != "secret content" {
+		t.Fatalf("download = %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("download should not be cacheable")
+	}
+	if rec = get(); rec.Code != http.StatusNotFound {
+		t.Errorf("second download status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleDownloadToken_InvalidReceipt(t *testing.T) {
+	s := newTestServer(t)
+	drop, err := s.storage.SaveDrop("secret.txt", strings.NewReader("secret content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleDownloadToken(rec, retrieveRequest(t, drop.ID, "wrong"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", rec.Code)
+	}
+	if len(s.downloads.pending) != 0 {
+		t.Error("no token should be issued for a bad receipt")
+	}
+}
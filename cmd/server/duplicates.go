@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxRecentUploads bounds the hashes recentUploads remembers; past it,
+// uploads are not remembered until older ones expire.
+const maxRecentUploads = 10000
+
+// duplicateAdvisory tells a source that the file it sent had already been
+// received, so that it need not keep sending it.
+const duplicateAdvisory = "An identical file was already submitted recently. It does not need to be sent again."
+
+// recentUploads remembers which files were uploaded in the last window, for
+// security.duplicate_advisory_minutes. Hashes are keyed with a secret that
+// never leaves memory, so what is held cannot be matched against known
+// files, and nothing survives a restart.
+type recentUploads struct {
+	mu     sync.Mutex
+	key    []byte
+	seen   map[[sha256.Size]byte]time.Time // keyed hash -> when it expires
+	window time.Duration
+}
+
+func newRecentUploads(window time.Duration) (*recentUploads, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &recentUploads{key: key, seen: make(map[[sha256.Size]byte]time.Time), window: window}, nil
+}
+
+// repeat records an upload of the file with the given hash and reports
+// whether one was already recorded within the window.
+func (u *recentUploads) repeat(fileHash string) bool {
+	mac := hmac.New(sha256.New, u.key)
+	mac.Write([]byte(fileHash))
+	var k [sha256.Size]byte
+	copy(k[:], mac.Sum(nil))
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	expires, ok := u.seen[k]
+	if ok && now.Before(expires) {
+		return true
+	}
+	if !ok && len(u.seen) >= maxRecentUploads {
+		for h, e := range u.seen {
+			if !now.Before(e) {
+				delete(u.seen, h)
+			}
+		}
+		if len(u.seen) >= maxRecentUploads {
+			return false
+		}
+	}
+	u.seen[k] = now.Add(u.window)
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecentUploads(t *testing.T) {
+	u, err := newRecentUploads(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.repeat("aaaa") {
+		t.Error("first upload reported as a repeat")
+	}
+	if !u.repeat("aaaa") {
+		t.Error("second upload not reported as a repeat")
+	}
+	if u.repeat("bbbb") {
+		t.Error("different file reported as a repeat")
+	}
+
+	// Expired entries are forgotten
+	for k := range u.seen {
+		u.seen[k] = time.Now().Add(-time.Second)
+	}
+	if u.repeat("aaaa") {
+		t.Error("upload after the window reported as a repeat")
+	}
+}
+
+func TestHandleSubmit_DuplicateAdvisory(t *testing.T) {
+	s := newTestServer(t)
+	submit := func(content string) map[string]string {
+		t.Helper()
+		body, contentType := createMultipartFile(t, "file", "test.txt", []byte(content))
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(body, contentType))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		var resp map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// Off by default
+	submit("hello world")
+	if resp := submit("hello world"); resp["advisory"] != "" {
+		t.Errorf("advisory with the setting off: %q", resp["advisory"])
+	}
+
+	var err error
+	s.recent, err = newRecentUploads(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := submit("hello world"); resp["advisory"] != "" {
+		t.Errorf("advisory on first upload: %q", resp["advisory"])
+	}
+	if resp := submit("hello world"); resp["advisory"] != duplicateAdvisory {
+		t.Errorf("advisory on repeat = %q, want %q", resp["advisory"], duplicateAdvisory)
+	}
+	if resp := submit("something else"); resp["advisory"] != "" {
+		t.Errorf("advisory on a different file: %q", resp["advisory"])
+	}
+}
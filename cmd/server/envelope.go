@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// envelopePublicKey returns the base64 envelope key published on the index
+// page and in /api/v1/capacity, or "" when upload envelopes are off.
+func (s *Server) envelopePublicKey() string {
+	if s.envelope == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.envelope.PublicKey())
+}
+
+// openEnvelope replaces the body of an upload sealed to the envelope key
+// with its plaintext: the Content-Type of the inner request, a newline, and
+// the inner body. It returns the key to seal the reply with, or nil for a
+// request without an envelope, which is left alone.
+func (s *Server) openEnvelope(r *http.Request) ([]byte, error) {
+	if r.Header.Get("Content-Type") != crypto.EnvelopeContentType {
+		return nil, nil
+	}
+	if s.envelope == nil {
+		return nil, errors.New("upload envelopes are not enabled")
+	}
+	sealed, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, replyKey, err := s.envelope.Open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	contentType, body, ok := bytes.Cut(plaintext, []byte("\n"))
+	if !ok {
+		crypto.ZeroBytes(replyKey)
+		return nil, errors.New("envelope has no content type")
+	}
+	r.Header.Set("Content-Type", string(contentType))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return replyKey, nil
+}
+
+// writeSealedJSON is writeJSON for the reply to an enveloped upload: the
+// padded JSON is sealed under replyKey.
+func (s *Server) writeSealedJSON(w http.ResponseWriter, replyKey []byte, v any) {
+	data, err := s.encodeJSON(v)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sealed, err := crypto.SealReply(replyKey, data)
+	crypto.ZeroBytes(data)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", crypto.EnvelopeContentType)
+	_, _ = w.Write(sealed)
+}
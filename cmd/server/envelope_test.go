@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// sealUpload wraps a multipart body in an upload envelope for s.
+func sealUpload(t *testing.T, s *Server, body *bytes.Buffer, contentType string) ([]byte, []byte) {
+	t.Helper()
+	key, err := base64.StdEncoding.DecodeString(getCapacity(t, s).UploadKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := append([]byte(contentType+"\n"), body.Bytes()...)
+	envelope, replyKey, err := crypto.SealEnvelope(key, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope, replyKey
+}
+
+func TestHandleSubmit_Envelope(t *testing.T) {
+	s := newTestServer(t)
+	s.envelope, _ = crypto.NewEnvelopeKey()
+
+	content := []byte("leaked memo behind a CDN")
+	body, ct := createMultipartFile(t, "file", "memo.txt", content)
+	envelope, replyKey := sealUpload(t, s, body, ct)
+
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(bytes.NewReader(envelope), crypto.EnvelopeContentType))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("Content-Type"); got != crypto.EnvelopeContentType {
+		t.Errorf("reply Content-Type = %q, want the envelope type", got)
+	}
+	reply, err := crypto.OpenReply(replyKey, rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("reply does not open: %v", err)
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["receipt"] == "" {
+		t.Fatal("sealed reply has no receipt")
+	}
+
+	_, rc, err := s.storage.GetDrop(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	stored, _ := io.ReadAll(rc)
+	if !bytes.Equal(stored, content) {
+		t.Errorf("stored %q, want %q", stored, content)
+	}
+}
+
+func TestHandleSubmit_EnvelopeRejected(t *testing.T) {
+	s := newTestServer(t)
+	s.envelope, _ = crypto.NewEnvelopeKey()
+	body, ct := createMultipartFile(t, "file", "memo.txt", []byte("data"))
+	envelope, _ := sealUpload(t, s, body, ct)
+
+	tampered := bytes.Clone(envelope)
+	tampered[len(tampered)-1] ^= 1
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(bytes.NewReader(tampered), crypto.EnvelopeContentType))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("tampered envelope: status = %d, want 400", rec.Code)
+	}
+
+	// A server without envelopes refuses them rather than misparsing
+	s.envelope = nil
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(bytes.NewReader(envelope), crypto.EnvelopeContentType))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("envelopes off: status = %d, want 400", rec.Code)
+	}
+	if getCapacity(t, s).UploadKey != "" {
+		t.Error("upload_key advertised with envelopes off")
+	}
+}
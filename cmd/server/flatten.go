@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/metadata"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// defaultFlattenOutput bounds a rendering when max_output_mb is unset, as
+// for external scrubbers.
+const defaultFlattenOutput = 100 << 20
+
+// originalHeader asks for a drop as it was uploaded rather than flattened,
+// as does the original=true form field.
+const originalHeader = "X-Dead-Drop-Original"
+
+// flattenedHeader marks a flattened download with the extension of the
+// original, which is still stored.
+const flattenedHeader = "X-Dead-Drop-Flattened"
+
+// flattener converts drops of some formats to a static rendering.
+type flattener struct {
+	tool      *metadata.ExternalTool
+	output    string // extension of the rendering
+	maxOutput int64
+}
+
+// flattenerSet maps lower-case input extensions to their converters.
+type flattenerSet map[string]*flattener
+
+// newFlatteners returns the converters of flatten.converters, or nil when
+// there are none.
+func newFlatteners(cfg *config.Config) flattenerSet {
+	if len(cfg.Flatten.Converters) == 0 {
+		return nil
+	}
+	flatteners := make(flattenerSet)
+	for _, conv := range cfg.Flatten.Converters {
+		maxOutput := conv.MaxOutputMB * 1024 * 1024
+		if maxOutput == 0 {
+			maxOutput = defaultFlattenOutput
+		}
+		f := &flattener{
+			tool: &metadata.ExternalTool{
+				Command:        conv.Command,
+				OutputExt:      conv.Output,
+				Timeout:        time.Duration(conv.TimeoutSeconds) * time.Second,
+				MaxOutputBytes: maxOutput,
+				TempDir:        cfg.Scrubbers.TempDir,
+				Sandbox:        cfg.Scrubbers.Sandbox,
+			},
+			output:    strings.ToLower(conv.Output),
+			maxOutput: maxOutput,
+		}
+		for _, ext := range conv.Extensions {
+			flatteners[strings.ToLower(ext)] = f
+		}
+	}
+	return flatteners
+}
+
+// flattens reports whether drops of campaign are flattened on retrieval.
+func (s *Server) flattens(campaign string) bool {
+	if c, ok := s.config().Campaigns[campaign]; ok && c.Flatten != "" {
+		return c.Flatten == "on"
+	}
+	return s.config().Flatten.Enabled
+}
+
+// flattenerFor returns the converter a retrieval should go through, or nil
+// to serve the drop as it is: with no converter for its format, with
+// flattening off for its campaign, when the receiver asked for the original,
+// when the download is sealed to a recipient key, whose holder decrypts it
+// offline, or when the source encrypted the file, which only its key opens.
+func (s *Server) flattenerFor(r *http.Request, payload *storage.MetadataPayload, recipient *age.X25519Recipient) *flattener {
+	if s.flatteners == nil || recipient != nil || payload.ClientEncrypted || !s.flattens(payload.Campaign) {
+		return nil
+	}
+	if r.PostFormValue("original") == "true" || r.Header.Get(originalHeader) == "true" {
+		return nil
+	}
+	return s.flatteners[strings.ToLower(filepath.Ext(payload.Filename))]
+}
+
+// serveFlattened converts a drop's contents with f and serves the
+// rendering. A drop that fails to convert is not served at all, and so not
+// burned; otherwise burn is as for the original, the rendering being the
+// read that the source allowed.
+func (s *Server) serveFlattened(w http.ResponseWriter, r *http.Request, html bool, dropID string, f *flattener, payload *storage.MetadataPayload, content io.ReadCloser, burn bool) {
+	defer content.Close()
+
+	// The rendering is held in memory before it is sent
+	if !s.memory.Acquire(f.maxOutput) {
+		s.metrics.RecordShed()
+		s.fail(w, html, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.memory.Release(f.maxOutput)
+
+	ext := filepath.Ext(payload.Filename)
+	var rendering bytes.Buffer
+	if err := f.tool.Transform(ext)(content, &rendering); err != nil {
+		if errors.Is(err, storage.ErrHashMismatch) {
+			s.hashMismatch(dropID, r)
+			s.fail(w, html, "Drop failed its integrity check", http.StatusInternalServerError)
+			return
+		}
+		if s.config().Logging.Errors {
+			log.Printf("Failed to flatten drop: %v", err)
+		}
+		s.fail(w, html, "Drop could not be flattened; ask for the original", http.StatusUnprocessableEntity)
+		return
+	}
+
+	filename := strings.TrimSuffix(filepath.Base(payload.Filename), ext) + f.output
+	contentType := s.servedContentType(mime.TypeByExtension(f.output))
+	var reader io.ReadCloser = io.NopCloser(&rendering)
+	if payload.Message != "" {
+		filename, reader = bundleDrop(filename, payload.Message, reader)
+		contentType = s.servedContentType("application/zip")
+	}
+	defer reader.Close()
+
+	w.Header().Set("Trailer", integrityTrailer)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set(flattenedHeader, strings.ToLower(ext))
+	digest := sha256.New()
+	_, err := io.Copy(io.MultiWriter(w, digest), reader)
+	if err == nil {
+		w.Header().Set(integrityTrailer, hex.EncodeToString(digest.Sum(nil)))
+		s.metrics.RecordDownload()
+	}
+	_ = reader.Close()
+
+	// Within a resume window, a download cut short leaves the drop to be
+	// fetched again; otherwise it is burned as after any retrieval
+	if burn && (err == nil || s.resumes == nil) {
+		s.burnDrop(dropID)
+	}
+}
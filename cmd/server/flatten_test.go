@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// newFlattenServer returns a test server flattening .docm files to .pdf by
+// upper-casing them, and deleting drops after retrieval.
+func newFlattenServer(t *testing.T, command ...string) *Server {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no shell")
+	}
+	s := newTestServer(t)
+	s.config().Security.DeleteAfterRetrieve = true
+	s.config().Flatten = config.FlattenConfig{
+		Enabled: true,
+		Converters: []config.FlattenConverterConfig{{
+			Extensions: []string{".DOCM"},
+			Command:    command,
+			Output:     ".pdf",
+		}},
+	}
+	s.config().Scrubbers.TempDir = t.TempDir()
+	s.flatteners = newFlatteners(s.config())
+	return s
+}
+
+func retrieveDrop(s *Server, drop *storage.Drop, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/retrieve", nil)
+	req.Header.Set(dropIDHeader, drop.ID)
+	req.Header.Set(receiptHeader, drop.Receipt)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, req)
+	return rec
+}
+
+func TestFlatten_Retrieve(t *testing.T) {
+	s := newFlattenServer(t, "sh", "-c", `tr a-z A-Z < "$0" > "$1"`, "{input}", "{output}")
+	drop, err := s.storage.SaveDrop("report.docm", bytes.NewReader([]byte("macro doc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := retrieveDrop(s, drop)
+	if rec.Code != http.StatusOK || rec.Body.String() != "MACRO DOC" {
+		t.Fatalf("flattened = %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="report.pdf"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := rec.Header().Get(flattenedHeader); got != ".docm" {
+		t.Errorf("%s = %q", flattenedHeader, got)
+	}
+	if rec.Header().Get(integrityTrailer) == "" {
+		t.Error("flattened download has no integrity trailer")
+	}
+	if _, _, err := s.storage.GetDrop(drop.ID); err == nil {
+		t.Error("flattened retrieval did not burn a drop deleted after retrieval")
+	}
+	if rec := retrieveDrop(s, drop, originalHeader, "true"); rec.Code == http.StatusOK {
+		t.Error("original served after the flattened read")
+	}
+}
+
+func TestFlatten_KeepsOriginal(t *testing.T) {
+	s := newFlattenServer(t, "sh", "-c", `tr a-z A-Z < "$0" > "$1"`, "{input}", "{output}")
+	s.config().Security.DeleteAfterRetrieve = false
+	drop, err := s.storage.SaveDrop("report.docm", bytes.NewReader([]byte("macro doc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if rec := retrieveDrop(s, drop); rec.Code != http.StatusOK || rec.Body.String() != "MACRO DOC" {
+			t.Fatalf("flattened = %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	rec := retrieveDrop(s, drop, originalHeader, "true")
+	if rec.Code != http.StatusOK || rec.Body.String() != "macro doc" {
+		t.Fatalf("original = %d %q", rec.Code, rec.Body.String())
+	}
+	if _, _, err := s.storage.GetDrop(drop.ID); err != nil {
+		t.Errorf("drop kept without a burn rule was deleted: %v", err)
+	}
+}
+
+func TestFlatten_CampaignOff(t *testing.T) {
+	s := newFlattenServer(t, "sh", "-c", `tr a-z A-Z < "$0" > "$1"`, "{input}", "{output}")
+	s.config().Campaigns = map[string]config.CampaignConfig{"raw": {Flatten: "off"}}
+	drop, err := s.storage.SaveDropWithOptions("report.docm", bytes.NewReader([]byte("macro doc")), &storage.SaveOptions{Campaign: "raw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := retrieveDrop(s, drop); rec.Body.String() != "macro doc" {
+		t.Errorf("campaign without flattening got %q", rec.Body.String())
+	}
+}
+
+func TestFlatten_ConverterFails(t *testing.T) {
+	s := newFlattenServer(t, "sh", "-c", "exit 1")
+	drop, err := s.storage.SaveDrop("report.docm", bytes.NewReader([]byte("macro doc")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := retrieveDrop(s, drop)
+	if rec.Code != http.StatusUnprocessableEntity || bytes.Contains(rec.Body.Bytes(), []byte("macro")) {
+		t.Errorf("failed conversion = %d %q, want 422 without the original", rec.Code, rec.Body.String())
+	}
+	if _, _, err := s.storage.GetDrop(drop.ID); err != nil {
+		t.Errorf("failed conversion burned the drop: %v", err)
+	}
+}
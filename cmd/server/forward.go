@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/net/proxy"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+var (
+	// errUnknownDestination is returned for a destination not in
+	// forwarding.destinations.
+	errUnknownDestination = errors.New("unknown forwarding destination")
+	// errForwardFailed wraps failures to deliver a drop to its destination.
+	errForwardFailed = errors.New("forwarding failed")
+)
+
+// forwardDestination is a checked forwarding.destinations entry.
+type forwardDestination struct {
+	submitURL string
+	key       *age.X25519Recipient
+}
+
+// forwarder submits drops to other dead-drop instances.
+type forwarder struct {
+	client       *http.Client
+	destinations map[string]forwardDestination
+}
+
+// forwardReceipt is what the destination returned for a forwarded drop:
+// the credentials its receivers retrieve it with.
+type forwardReceipt struct {
+	DropID     string `json:"drop_id"`
+	Receipt    string `json:"receipt,omitempty"`
+	ReceiptURL string `json:"receipt_url,omitempty"`
+}
+
+// newForwarder checks the forwarding config. It returns nil when no
+// destinations are configured. Onion destinations need the SOCKS5 proxy;
+// clearnet ones without it must use HTTPS.
+func newForwarder(cfg config.ForwardingConfig) (*forwarder, error) {
+	if len(cfg.Destinations) == 0 {
+		return nil, nil
+	}
+	f := &forwarder{destinations: make(map[string]forwardDestination)}
+	for _, d := range cfg.Destinations {
+		if d.Name == "" {
+			return nil, errors.New("forwarding destinations need a name")
+		}
+		if _, dup := f.destinations[d.Name]; dup {
+			return nil, fmt.Errorf("forwarding destination %q is listed twice", d.Name)
+		}
+		u, err := url.Parse(d.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("forwarding destination %q: url must be an http or https URL", d.Name)
+		}
+		onion := strings.HasSuffix(u.Hostname(), ".onion")
+		switch {
+		case onion && cfg.Proxy == "":
+			return nil, fmt.Errorf("forwarding destination %q is an onion service: set forwarding.proxy", d.Name)
+		case !onion && cfg.Proxy == "" && u.Scheme != "https":
+			return nil, fmt.Errorf("forwarding destination %q must use https when not reached through forwarding.proxy", d.Name)
+		}
+		key, err := crypto.ParseRecipient(d.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("forwarding destination %q: public_key must be an age X25519 recipient (age1...)", d.Name)
+		}
+		f.destinations[d.Name] = forwardDestination{
+			submitURL: strings.TrimSuffix(u.String(), "/") + "/submit",
+			key:       key,
+		}
+	}
+
+	// No overall timeout: a large drop over Tor takes as long as it takes,
+	// and the admin request's context bounds it
+	transport := &http.Transport{}
+	if cfg.Proxy != "" {
+		dialer, err := proxy.SOCKS5("tcp", cfg.Proxy, nil, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		if cd, ok := dialer.(proxy.ContextDialer); ok {
+			transport.DialContext = cd.DialContext
+		}
+	}
+	f.client = &http.Client{Transport: transport}
+	return f, nil
+}
+
+// forwardDrop seals a drop, its filename and any message from the source
+// to the destination's public key, and submits it there as a
+// client-encrypted upload. Only the destination's receivers can open it,
+// with dead-drop-unseal; the destination's server never sees the contents.
+// The drop stays here; the caller decides whether to delete it.
+func (s *Server) forwardDrop(ctx context.Context, dropID, destination string) (*forwardReceipt, error) {
+	if s.forwarder == nil {
+		return nil, errUnknownDestination
+	}
+	dest, ok := s.forwarder.destinations[destination]
+	if !ok {
+		return nil, errUnknownDestination
+	}
+
+	payload, reader, err := s.storage.GetDropWithMetadata(dropID)
+	if err != nil {
+		return nil, err
+	}
+	filename := filepath.Base(payload.Filename)
+	if payload.Message != "" {
+		filename, reader = bundleDrop(filename, payload.Message, reader)
+	}
+	defer reader.Close()
+
+	// The sealed drop streams into the request body. The writer is done
+	// with the drop before it is closed, however the request ends.
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	done := make(chan struct{})
+	defer func() {
+		_ = pr.Close()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		err := form.WriteField("client_encrypted", "true")
+		if err == nil {
+			var part io.Writer
+			if part, err = form.CreateFormFile("file", "drop.age"); err == nil {
+				err = crypto.SealFile(dest.key, filename, reader, part)
+			}
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dest.submitURL, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	resp, err := s.forwarder.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w to %s: %v", errForwardFailed, destination, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w to %s: destination answered %s", errForwardFailed, destination, resp.Status)
+	}
+
+	var receipt forwardReceipt
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&receipt); err != nil {
+		return nil, fmt.Errorf("%w to %s: unreadable reply: %v", errForwardFailed, destination, err)
+	}
+	if receipt.DropID == "" || (receipt.Receipt == "" && receipt.ReceiptURL == "") {
+		return nil, fmt.Errorf("%w to %s: reply carries no credentials", errForwardFailed, destination)
+	}
+	return &receipt, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestAdmin_Forward(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	id := saveTestDrop(t, a.server)
+
+	dest := newTestServer(t)
+	ts := httptest.NewTLSServer(http.HandlerFunc(dest.handleSubmit))
+	defer ts.Close()
+
+	priv, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := newForwarder(config.ForwardingConfig{Destinations: []config.ForwardDestination{{
+		Name:      "analysis",
+		URL:       ts.URL,
+		PublicKey: priv.Recipient().String(),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.client = ts.Client()
+	a.server.forwarder = f
+
+	forward := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/v1/drops/"+id+"/forward", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		rec := httptest.NewRecorder()
+		a.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := forward("destination=elsewhere"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown destination: status = %d, want 400", rec.Code)
+	}
+
+	rec := forward("destination=analysis&delete=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("forward: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	var reply struct {
+		Status string         `json:"status"`
+		Remote forwardReceipt `json:"remote"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Status != "forwarded" || reply.Remote.DropID == "" || reply.Remote.Receipt == "" {
+		t.Fatalf("reply = %+v", reply)
+	}
+	if _, err := a.server.storage.StoredSize(id); err == nil {
+		t.Error("drop still here after forwarding with delete=true")
+	}
+
+	// The destination holds only the sealed drop, which its receiver opens
+	if !dest.storage.ValidateReceipt(reply.Remote.DropID, reply.Remote.Receipt) {
+		t.Error("destination does not accept the returned receipt")
+	}
+	meta, reader, err := dest.storage.GetDropWithMetadata(reply.Remote.DropID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if !meta.ClientEncrypted {
+		t.Error("forwarded drop not recorded as client-encrypted")
+	}
+	sealed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, data, err := crypto.OpenSealedFile(priv, strings.NewReader(string(sealed)))
+	if err != nil {
+		t.Fatalf("OpenSealedFile: %v", err)
+	}
+	if name != "test.txt" || string(data) != "data" {
+		t.Errorf("opened %q %q", name, data)
+	}
+}
+
+func TestNewForwarder_Checks(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := id.Recipient().String()
+	for _, tc := range []struct {
+		name string
+		cfg  config.ForwardingConfig
+	}{
+		{"onion without proxy", config.ForwardingConfig{Destinations: []config.ForwardDestination{
+			{Name: "a", URL: "http://example2345.onion", PublicKey: key}}}},
+		{"plain http", config.ForwardingConfig{Destinations: []config.ForwardDestination{
+			{Name: "a", URL: "http://analysis.example.org", PublicKey: key}}}},
+		{"bad key", config.ForwardingConfig{Destinations: []config.ForwardDestination{
+			{Name: "a", URL: "https://analysis.example.org", PublicKey: base64.StdEncoding.EncodeToString(make([]byte, 32))}}}},
+		{"duplicate", config.ForwardingConfig{Destinations: []config.ForwardDestination{
+			{Name: "a", URL: "https://one.example.org", PublicKey: key},
+			{Name: "a", URL: "https://two.example.org", PublicKey: key}}}},
+	} {
+		if _, err := newForwarder(tc.cfg); err == nil {
+			t.Errorf("%s: accepted", tc.name)
+		}
+	}
+
+	f, err := newForwarder(config.ForwardingConfig{Proxy: "127.0.0.1:9050", Destinations: []config.ForwardDestination{
+		{Name: "a", URL: "http://example2345.onion/", PublicKey: key}}})
+	if err != nil {
+		t.Fatalf("onion through proxy: %v", err)
+	}
+	if got := f.destinations["a"].submitURL; got != "http://example2345.onion/submit" {
+		t.Errorf("submitURL = %q", got)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// defaultIncidentRetention applies when incidents.retention_days is unset.
+const defaultIncidentRetention = 90 * 24 * time.Hour
+
+// recordIncident notes an intrusion-related event if the incident log is
+// enabled. Only the coarse origin of the request is kept, never its address.
+func (s *Server) recordIncident(kind, dropID string, r *http.Request) {
+	if s.incidents == nil {
+		return
+	}
+	s.incidents.Record(kind, dropID, s.requestOrigin(r).String())
+}
+
+// maintainIncidents flushes pending incidents every minute and prunes those
+// older than retention every hour, until stop is closed. While storage is
+// locked events stay in memory.
+func (s *Server) maintainIncidents(retention time.Duration, stop <-chan struct{}) {
+	flush := time.NewTicker(time.Minute)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-flush.C:
+			if err := s.incidents.Flush(); err != nil && !errors.Is(err, storage.ErrLocked) && s.config().Logging.Errors {
+				log.Printf("Failed to flush incident log: %v", err)
+			}
+		case <-prune.C:
+			if _, err := s.incidents.Prune(retention); err != nil && !errors.Is(err, storage.ErrLocked) && s.config().Logging.Errors {
+				log.Printf("Failed to prune incident log: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
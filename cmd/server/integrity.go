@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/scttfrdmn/dead-drop/internal/honeypot"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
+)
+
+// hashMismatch reports a retrieval of a drop whose contents did not match
+// the hash recorded at upload (security.verify_hash): in the log, the
+// metrics, the incident log, and as a high-priority webhook alert. The drop
+// is left in place to be examined.
+func (s *Server) hashMismatch(dropID string, r *http.Request) {
+	log.Printf("INTEGRITY ALERT: drop %s does not match its stored hash; download aborted", dropID) // #nosec G706 -- drop ID is validated hex
+	s.metrics.RecordHashMismatch()
+	s.recordIncident(incidents.KindHashMismatch, dropID, r)
+	if s.alerter != nil {
+		s.alerter.Send(&honeypot.AlertPayload{
+			Event:    incidents.KindHashMismatch,
+			DropID:   dropID,
+			Priority: "high",
+		})
+	}
+}
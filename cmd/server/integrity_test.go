@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/honeypot"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
+)
+
+func TestRetrieve_VerifiedIntactDrop(t *testing.T) {
+	s := newTestServer(t)
+	s.storage.VerifyHash = true
+	content := bytes.Repeat([]byte("verified drop "), 4096)
+	drop, err := s.storage.SaveDrop("big.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(s.handleRetrieve))
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/retrieve", nil)
+	req.Header.Set(dropIDHeader, drop.ID)
+	req.Header.Set(receiptHeader, drop.Receipt)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || !bytes.Equal(body, content) {
+		t.Fatalf("body = %d bytes, %v", len(body), err)
+	}
+	if resp.Trailer.Get(integrityTrailer) == "" {
+		t.Error("verified download has no integrity trailer")
+	}
+}
+
+func TestHashMismatch_Alerts(t *testing.T) {
+	s := newTestServer(t)
+	s.incidents = incidents.New(filepath.Join(t.TempDir(), "incidents"), func() ([]byte, error) {
+		return s.storage.SubKey("incidents")
+	})
+	alerts := make(chan []byte, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		alerts <- body
+	}))
+	defer webhook.Close()
+	s.alerter = honeypot.NewAlerter(webhook.URL)
+
+	id := saveTestDrop(t, s)
+	s.hashMismatch(id, httptest.NewRequest(http.MethodPost, "/retrieve", nil))
+
+	events, err := s.incidents.Events(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != incidents.KindHashMismatch || events[0].DropID != id {
+		t.Errorf("incidents = %+v, want the drop's hash mismatch", events)
+	}
+
+	rec := httptest.NewRecorder()
+	s.metrics.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "dead_drop_hash_mismatches_total 1\n") {
+		t.Error("hash mismatch not counted in the metrics")
+	}
+
+	select {
+	case raw := <-alerts:
+		var alert map[string]string
+		if err := json.Unmarshal(raw, &alert); err != nil {
+			t.Fatal(err)
+		}
+		if alert["event"] != "hash_mismatch" || alert["priority"] != "high" || alert["drop_id"] != id {
+			t.Errorf("alert = %v", alert)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert was sent")
+	}
+
+	// The drop is kept for the operators
+	if _, _, err := s.storage.GetDrop(id); err != nil {
+		t.Errorf("drop gone after a mismatch: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTimeRequests(t *testing.T) {
+	s := newTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/status/{id}", s.timeRequests(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/status/abc123", nil))
+
+	rec := httptest.NewRecorder()
+	s.metrics.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `dead_drop_request_duration_seconds_count{endpoint="/api/v1/status/{id}"} 1`+"\n") {
+		t.Errorf("request not timed under its route:\n%s", body)
+	}
+	if strings.Contains(body, "abc123") {
+		t.Error("raw path leaked into the latency labels")
+	}
+}
@@ -1,15 +1,20 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
+	"crypto/x509"
 	"embed"
-	"encoding/json"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
 	"log"
 	"math/big"
 	"net"
@@ -17,17 +22,29 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/audit"
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
+	"github.com/scttfrdmn/dead-drop/internal/canary"
 	"github.com/scttfrdmn/dead-drop/internal/config"
 	"github.com/scttfrdmn/dead-drop/internal/crypto"
 	"github.com/scttfrdmn/dead-drop/internal/honeypot"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
 	"github.com/scttfrdmn/dead-drop/internal/metadata"
 	"github.com/scttfrdmn/dead-drop/internal/monitoring"
+	"github.com/scttfrdmn/dead-drop/internal/notify"
 	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+	"github.com/scttfrdmn/dead-drop/internal/stats"
 	"github.com/scttfrdmn/dead-drop/internal/storage"
+	"github.com/scttfrdmn/dead-drop/internal/torexit"
+	"github.com/scttfrdmn/dead-drop/internal/tracing"
 	"github.com/scttfrdmn/dead-drop/internal/validation"
 )
 
@@ -36,20 +53,64 @@ var staticFiles embed.FS
 
 type Server struct {
 	storage    *storage.Manager
-	config     *config.Config
-	validator  *validation.Validator
+	cfg        atomic.Pointer[config.Config]        // replaced whole by a reload; read with config()
+	checks     atomic.Pointer[validation.Validator] // rebuilt by a reload; read with validator()
 	scrubber   *metadata.Scrubber
 	honeypot   *honeypot.Manager
 	metrics    *monitoring.Metrics
+	csrf       *csrfTokens
+	downloads  *downloadTokens
+	receiptQRs *downloadTokens // single-use links to receipt QR codes
+	incidents  *incidents.Store
+	stats      *stats.Store // stats.enabled, nil when off
+	canaries   *canary.Store
+	alerter    *honeypot.Alerter // security.alert_webhook, for canary uploads and hash mismatches
+	notifier   *notify.Notifier
+	memory     *ratelimit.MemoryBudget
+	exits      *torexit.List
+	envelope   *crypto.EnvelopeKey  // security.upload_envelope, nil when off
+	processing *processingQueue     // processing.async, nil when off
+	forwarder  *forwarder           // forwarding.destinations, nil when none
+	uploads    *uploadSessions      // security.resumable_uploads, nil when off
+	resumes    *resumeWindows       // security.resume_window_minutes, nil when off
+	recipient  *age.X25519Recipient // security.recipient_key, nil when unset
+	pow        *ratelimit.PoW       // security.rate_limit_mode pow, nil otherwise
+	cspReports *cspReports          // security.csp_reports, nil when off
+	assets     fs.FS                // server.static_dir, nil when unset
+	templates  *template.Template   // page templates with static_dir's overrides, nil when unset
+	attempts   *ratelimit.Attempts  // wrong receipts per drop ID, for security.receipt_attempts
+	recent     *recentUploads       // security.duplicate_advisory_minutes, nil when off
+	reloader   *reloader            // nil without -config
+	flatteners flattenerSet         // flatten.converters, nil when none
+	tracer     *tracing.Tracer      // tracing.enabled, nil when off
 	tlsEnabled bool
+	basePath   string // URL prefix of every route and link, "" at the root
 }
 
 func main() {
 	configPath := flag.String("config", "", "Path to config file (YAML)")
 	logDir := flag.String("log-dir", "", "Directory for log output (e.g., tmpfs mount for ephemeral logs)")
 	torOnly := flag.Bool("tor-only", false, "Reject non-loopback connections (for Tor hidden service deployments)")
+	checkConfig := flag.Bool("check-config", false, "Validate the config file with its DEAD_DROP_* environment overrides (unknown keys, types, ranges) and exit")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
+	if *checkConfig {
+		if *configPath == "" {
+			log.Fatalf("-check-config requires -config")
+		}
+		if err := config.CheckFile(*configPath); err != nil {
+			log.Fatalf("%s: %v", *configPath, err)
+		}
+		fmt.Printf("%s: OK\n", *configPath)
+		return
+	}
+
 	// Load configuration
 	var cfg *config.Config
 	var err error
@@ -60,25 +121,25 @@ func main() {
 			log.Fatalf("Failed to load config: %v", err)
 		}
 	} else {
-		// Use defaults if no config file
-		cfg = config.DefaultConfig()
-	}
-
-	// CLI flags override config file
-	if *logDir != "" {
-		cfg.Logging.LogDir = *logDir
-	}
-	if *torOnly {
-		cfg.Security.TorOnly = true
+		// Defaults and DEAD_DROP_* variables, as in a container
+		cfg, err = config.LoadEnv()
+		if err != nil {
+			log.Fatalf("Failed to load config from the environment: %v", err)
+		}
 	}
 
-	// When tor_only is enabled, force listen address to loopback if binding all interfaces
-	if cfg.Security.TorOnly {
-		host, port, err := net.SplitHostPort(cfg.Server.Listen)
-		if err == nil && host == "" {
-			cfg.Server.Listen = "127.0.0.1:" + port
-			log.Printf("WARNING: tor_only enabled — listen address overridden to %s", cfg.Server.Listen)
+	// CLI flags override config file, here and at each reload
+	applyFlags := func(cfg *config.Config) bool {
+		if *logDir != "" {
+			cfg.Logging.LogDir = *logDir
+		}
+		if *torOnly {
+			cfg.Security.TorOnly = true
 		}
+		return forceLoopback(cfg)
+	}
+	if applyFlags(cfg) {
+		log.Printf("WARNING: tor_only enabled — listen address overridden to %s", cfg.Server.Listen)
 	}
 
 	// Set up log file if log directory is configured
@@ -95,9 +156,62 @@ func main() {
 		log.SetOutput(logFile)
 	}
 
+	// A running binary that differs from the one deployed may have been
+	// tampered with; warn rather than refuse, so that a mistaken pin after
+	// an upgrade does not take the server down
+	if cfg.Security.BinarySHA256 != "" {
+		self, err := os.Executable()
+		if err == nil {
+			var sum string
+			var ok bool
+			if sum, ok, err = binaryMatches(self, cfg.Security.BinarySHA256); err == nil && !ok {
+				log.Printf("WARNING: %s has SHA-256 %s, not the pinned security.binary_sha256; it may have been altered since deployment. Check it with dead-drop-verify-binary.", self, sum)
+			}
+		}
+		if err != nil {
+			log.Printf("WARNING: could not hash the running binary to check security.binary_sha256: %v", err)
+		}
+	}
+
+	// Hold the storage directory while the server runs, so that offline tools
+	// that rewrite drops (dead-drop-rotate-keys) cannot run against it
+	storeLock, err := storage.LockStore(cfg.Server.StorageDir, "dead-drop-server")
+	if err != nil {
+		log.Fatalf("Failed to lock storage directory: %v", err)
+	}
+	defer storeLock.Release()
+	if _, err := os.Stat(filepath.Join(cfg.Server.StorageDir, storage.RotationJournalFile)); err == nil {
+		log.Fatalf("A key rotation in %s is unfinished; complete it with dead-drop-rotate-keys -resume before starting the server", cfg.Server.StorageDir)
+	}
+	// A scuttled store stays dead, and one whose operators stopped checking
+	// in while the server was down is scuttled before any key is read
+	if at, ok := storage.Scuttled(cfg.Server.StorageDir); ok {
+		log.Fatalf("%s was scuttled at %s; the server will not start on it", cfg.Server.StorageDir, at.Format(time.RFC3339))
+	}
+	if err := prepareScuttle(cfg.Server.StorageDir, scuttlePeriod(cfg), time.Now()); err != nil {
+		log.Fatalf("%v", err)
+	}
+	idFormat, err := storage.NewIDFormat(cfg.Server.DropIDs.Prefix, cfg.Server.DropIDs.Alphabet, cfg.Server.DropIDs.Length)
+	if err != nil {
+		log.Fatalf("Invalid server.drop_ids: %v", err)
+	}
+	if err := storage.UseIDFormat(cfg.Server.StorageDir, &idFormat); err != nil {
+		log.Fatalf("Failed to set drop ID format: %v", err)
+	}
+
 	// Derive master key from environment variable if configured
 	var masterKey []byte
-	if cfg.Security.MasterKeyEnv == "" {
+	lockedStart := cfg.Security.UnlockSocket != ""
+	if lockedStart && cfg.Security.MasterKeyEnv != "" {
+		log.Fatalf("unlock_socket and master_key_env are mutually exclusive")
+	}
+	if cfg.Security.IdleRelockMinutes > 0 && !lockedStart {
+		log.Fatalf("idle_relock_minutes requires unlock_socket")
+	}
+	if cfg.Security.KeyBundle != "" && cfg.Security.MasterKeyEnv == "" && !lockedStart {
+		log.Fatalf("key_bundle requires master_key_env or unlock_socket: bundled keys are wrapped to the master key")
+	}
+	if cfg.Security.MasterKeyEnv == "" && !lockedStart {
 		log.Println("WARNING: master_key_env not set — encryption keys are stored unencrypted on disk. Set master_key_env in config for production use.")
 	}
 	if cfg.Security.MasterKeyEnv != "" {
@@ -105,6 +219,11 @@ func main() {
 		if passphrase == "" {
 			log.Fatalf("Master key environment variable %s is set in config but empty or unset", cfg.Security.MasterKeyEnv)
 		}
+		if cfg.Security.KeyBundle != "" {
+			if err := importKeyBundle(cfg, passphrase); err != nil {
+				log.Fatalf("%v", err)
+			}
+		}
 		salt, saltErr := crypto.LoadOrGenerateSalt(cfg.Server.StorageDir)
 		if saltErr != nil {
 			log.Fatalf("Failed to load/generate master salt: %v", saltErr)
@@ -113,8 +232,51 @@ func main() {
 		defer crypto.ZeroBytes(masterKey)
 	}
 
-	// Initialize storage
-	storageManager, err := storage.NewManager(cfg.Server.StorageDir, masterKey)
+	// secret:// references in the config are kept in a secrets file sealed
+	// with the master key
+	var storedSecrets map[string]string
+	if masterKey != nil {
+		storedSecrets, err = config.LoadSecrets(cfg.Server.StorageDir, masterKey)
+		if err != nil {
+			log.Fatalf("Failed to load config secrets: %v", err)
+		}
+	}
+	if err := cfg.ResolveSecrets(storedSecrets); err != nil {
+		log.Fatalf("Failed to resolve config secrets: %v", err)
+	}
+
+	// Move drops left in the pre-sharding flat layout into shard directories
+	// before anything reads the store. Unmigrated drops remain readable, so a
+	// failure here is not fatal.
+	if _, statErr := os.Stat(cfg.Server.StorageDir); statErr == nil {
+		moved, migErr := storage.MigrateLayout(cfg.Server.StorageDir)
+		if migErr != nil {
+			log.Printf("Storage layout migration incomplete: %v", migErr)
+		}
+		if moved > 0 && cfg.Logging.Startup {
+			log.Printf("Migrated %d drops to sharded layout", moved)
+		}
+
+		// Finish or undo the saves, deletions and data swaps a crash
+		// interrupted, before the quota scan and expiry index count them.
+		// Unresolved records are retried at the next start.
+		recovered, recErr := storage.RecoverIntents(cfg.Server.StorageDir, cfg.Security.SecureDelete)
+		if recErr != nil {
+			log.Printf("Storage recovery incomplete: %v", recErr)
+		}
+		if recovered > 0 && cfg.Logging.Startup {
+			log.Printf("Recovered %d interrupted storage operations", recovered)
+		}
+	}
+
+	// Initialize storage. In locked mode no keys are loaded until the
+	// passphrase arrives over the unlock socket.
+	var storageManager *storage.Manager
+	if lockedStart {
+		storageManager, err = storage.NewLockedManager(cfg.Server.StorageDir)
+	} else {
+		storageManager, err = storage.NewManager(cfg.Server.StorageDir, masterKey)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
@@ -122,6 +284,18 @@ func main() {
 
 	// Configure secure delete from config
 	storageManager.SecureDelete = cfg.Security.SecureDelete
+	storageManager.FuzzyHash = cfg.Security.FuzzyHash
+	storageManager.TriageStats = cfg.Security.TriageStats
+	storageManager.VerifyHash = cfg.Security.VerifyHash
+
+	if err := cfg.ValidateRetention(); err != nil {
+		log.Fatalf("Invalid retention config: %v", err)
+	}
+	storageManager.Retention = retentionClasses(cfg)
+	storageManager.KeyLimits = storage.KeyLimits{
+		MaxBytes:    int64(cfg.Security.KeyMaxGB * 1024 * 1024 * 1024),
+		MaxMessages: cfg.Security.KeyMaxMessages,
+	}
 
 	// Initialize honeypots before quota so they're counted in baseline
 	var honeypotMgr *honeypot.Manager
@@ -131,12 +305,12 @@ func main() {
 		if hpErr != nil {
 			log.Fatalf("Failed to initialize honeypot manager: %v", hpErr)
 		}
-		if cfg.Security.HoneypotCount > 0 {
+		// In locked mode honeypots are generated after unlock
+		if cfg.Security.HoneypotCount > 0 && !lockedStart {
 			if hpErr = honeypotMgr.GenerateHoneypots(cfg.Security.HoneypotCount, storageManager); hpErr != nil {
 				log.Fatalf("Failed to generate honeypots: %v", hpErr)
 			}
 		}
-		storageManager.IsProtected = honeypotMgr.IsHoneypot
 	}
 
 	// Configure disk quotas if set
@@ -150,26 +324,311 @@ func main() {
 
 	tlsEnabled := cfg.Server.TLS.CertFile != "" && cfg.Server.TLS.KeyFile != ""
 
+	basePath, err := cleanBasePath(cfg.Server.BasePath)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// Client certificates for closed deployments: retrieval and the admin
+	// TCP listener require one signed by client_ca_file
+	var clientCAs *x509.CertPool
+	if cfg.Server.TLS.ClientCAFile != "" {
+		if !tlsEnabled {
+			log.Fatalf("server.tls.client_ca_file requires cert_file and key_file")
+		}
+		clientCAs, err = loadClientCAs(cfg.Server.TLS.ClientCAFile)
+		if err != nil {
+			log.Fatalf("Failed to load client CAs: %v", err)
+		}
+	}
+	if cfg.Admin.Listen != "" && clientCAs == nil {
+		log.Fatalf("admin.listen requires server.tls with client_ca_file")
+	}
+
+	csrfTokens, err := newCSRFTokens(time.Duration(cfg.Security.CSRFTokenTTLMinutes) * time.Minute)
+	if err != nil {
+		log.Fatalf("Failed to initialize CSRF tokens: %v", err)
+	}
+
 	server := &Server{
 		storage:    storageManager,
-		config:     cfg,
-		validator:  validation.NewValidator(cfg.Server.MaxUploadMB),
-		scrubber:   metadata.NewScrubber(),
+		scrubber:   newScrubber(cfg),
 		honeypot:   honeypotMgr,
 		metrics:    monitoring.NewMetrics(),
+		csrf:       csrfTokens,
+		downloads:  newDownloadTokens(time.Duration(cfg.Security.DownloadTokenTTLSeconds) * time.Second),
+		receiptQRs: newDownloadTokens(receiptQRTTL),
 		tlsEnabled: tlsEnabled,
+		basePath:   basePath,
+		flatteners: newFlatteners(cfg),
+	}
+	server.cfg.Store(cfg)
+	server.checks.Store(newValidator(cfg))
+
+	if cfg.Server.StaticDir != "" {
+		server.assets, err = openStaticDir(cfg.Server.StaticDir)
+		if err == nil {
+			server.templates, err = loadPages(server.assets)
+		}
+		if err != nil {
+			log.Fatalf("Invalid server.static_dir: %v", err)
+		}
+		if cfg.Logging.Startup {
+			log.Printf("Serving UI overrides from %s", cfg.Server.StaticDir)
+		}
+	}
+
+	// Memory budget: shed uploads/downloads with 503 before the OOM killer hits
+	if cfg.Server.MemoryBudgetMB > 0 {
+		server.memory = ratelimit.NewMemoryBudget(cfg.Server.MemoryBudgetMB * 1024 * 1024)
+		server.metrics.SetMemoryFunc(func() (int64, int64) {
+			return server.memory.Used(), server.memory.Limit()
+		})
+		stopWatchdog := make(chan struct{})
+		defer close(stopWatchdog)
+		go server.memory.Watch(2*time.Second, stopWatchdog)
+		if cfg.Logging.Startup {
+			log.Printf("Memory budget: %d MB", cfg.Server.MemoryBudgetMB)
+		}
+	}
+
+	// Asynchronous processing; workers start once the server is set up
+	if cfg.Processing.Async {
+		server.processing = newProcessingQueue(cfg.Processing.QueueSize)
+	}
+
+	// Resumable uploads, whose files in progress are kept below the
+	// storage dir and removed at each start
+	if cfg.Security.ResumableUploads {
+		server.uploads, err = newUploadSessions(filepath.Join(cfg.Server.StorageDir, ".uploads"))
+		if err != nil {
+			log.Fatalf("Failed to initialize resumable uploads: %v", err)
+		}
+		if cfg.Security.ResumableUploadTTLMinutes > 0 {
+			server.uploads.ttl = time.Duration(cfg.Security.ResumableUploadTTLMinutes) * time.Minute
+		}
+		stopUploads := make(chan struct{})
+		defer close(stopUploads)
+		go server.uploads.expireEvery(time.Minute, stopUploads)
 	}
 
-	// Start automatic cleanup
+	// Burn-after-read drops may be resumed within a window, and are burned
+	// when it closes
+	if cfg.Security.ResumeWindowMinutes > 0 {
+		server.resumes = newResumeWindows(time.Duration(cfg.Security.ResumeWindowMinutes) * time.Minute)
+		stopResumes := make(chan struct{})
+		defer close(stopResumes)
+		go server.burnExpiredWindows(time.Minute, stopResumes)
+	}
+
+	// Drop forwarding to other instances, through the admin API
+	server.forwarder, err = newForwarder(cfg.Forwarding)
+	if err != nil {
+		log.Fatalf("Invalid forwarding config: %v", err)
+	}
+
+	// The receivers' public key, published for sources to seal files to
+	server.recipient, err = parseRecipientKey(cfg.Security.RecipientKey)
+	if err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+
+	// Locked start: keys are loaded once the passphrase arrives on the socket
+	if lockedStart {
+		unlock := &unlocker{
+			server:     server,
+			socketPath: cfg.Security.UnlockSocket,
+			afterUnlock: func() error {
+				if server.processing != nil {
+					go server.requeuePending()
+				}
+				if honeypotMgr == nil || cfg.Security.HoneypotCount <= 0 {
+					return nil
+				}
+				return honeypotMgr.GenerateHoneypots(cfg.Security.HoneypotCount, storageManager)
+			},
+		}
+		if err := unlock.Start(); err != nil {
+			log.Fatalf("Failed to open unlock socket: %v", err)
+		}
+		defer unlock.Stop()
+
+		stopRelock := make(chan struct{})
+		defer close(stopRelock)
+		if cfg.Security.IdleRelockMinutes > 0 {
+			go unlock.watchIdle(time.Duration(cfg.Security.IdleRelockMinutes)*time.Minute, stopRelock)
+		}
+		if len(lockSignals) > 0 {
+			lockCh := make(chan os.Signal, 1)
+			signal.Notify(lockCh, lockSignals...)
+			go func() {
+				for {
+					select {
+					case <-lockCh:
+						unlock.Relock("lock signal")
+					case <-stopRelock:
+						return
+					}
+				}
+			}()
+		}
+		if cfg.Logging.Startup {
+			log.Printf("Server locked: POST the master passphrase to /unlock on unix socket %s", cfg.Security.UnlockSocket)
+		}
+	}
+
+	// Upload envelope key: generated per process and never stored, so a
+	// restart leaves nothing that decrypts captured envelopes
+	if cfg.Security.UploadEnvelope {
+		key, err := crypto.NewEnvelopeKey()
+		if err != nil {
+			log.Fatalf("Failed to create upload envelope key: %v", err)
+		}
+		server.envelope = key
+		if cfg.Logging.Startup {
+			log.Printf("Upload envelopes enabled")
+		}
+	}
+
+	// Encrypted intrusion event log, sealed with a key derived from the
+	// storage key so it is unreadable while the server is locked
+	if cfg.Incidents.Enabled {
+		path := cfg.Incidents.Path
+		if path == "" {
+			path = filepath.Join(cfg.Server.StorageDir, ".incidents")
+		}
+		server.incidents = incidents.New(path, func() ([]byte, error) {
+			return storageManager.SubKey("incidents")
+		})
+		retention := time.Duration(cfg.Incidents.RetentionDays) * 24 * time.Hour
+		if retention <= 0 {
+			retention = defaultIncidentRetention
+		}
+		stopIncidents := make(chan struct{})
+		defer close(stopIncidents)
+		go server.maintainIncidents(retention, stopIncidents)
+		if cfg.Logging.Startup {
+			log.Printf("Incident log: %s (retention %v)", path, retention)
+		}
+	}
+
+	// Hourly usage totals, sealed like the incident log
+	if cfg.Stats.Enabled {
+		path := cfg.Stats.Path
+		if path == "" {
+			path = filepath.Join(cfg.Server.StorageDir, ".stats")
+		}
+		server.stats = stats.New(path, func() ([]byte, error) {
+			return storageManager.SubKey("stats")
+		})
+		retention := time.Duration(cfg.Stats.RetentionDays) * 24 * time.Hour
+		if retention <= 0 {
+			retention = defaultStatsRetention
+		}
+		stopStats := make(chan struct{})
+		defer close(stopStats)
+		go server.maintainStats(retention, stopStats)
+		if cfg.Logging.Startup {
+			log.Printf("Usage statistics: %s (retention %v)", path, retention)
+		}
+	}
+
+	// Dead-man timer: without operator check-ins the store is scuttled
+	if period := scuttlePeriod(cfg); period > 0 {
+		stopScuttle := make(chan struct{})
+		defer close(stopScuttle)
+		go server.watchScuttle(stopScuttle)
+		if cfg.Logging.Startup {
+			log.Printf("Scuttle timer: %v without an operator check-in", period)
+		}
+	}
+
+	// Canary documents, sealed like the incident log
+	if cfg.Canaries.Enabled {
+		if cfg.Canaries.FuzzyThreshold < 0 || cfg.Canaries.FuzzyThreshold > 100 {
+			log.Fatalf("canaries.fuzzy_threshold must be between 0 and 100")
+		}
+		path := cfg.Canaries.Path
+		if path == "" {
+			path = filepath.Join(cfg.Server.StorageDir, ".canaries")
+		}
+		server.canaries = canary.New(path, func() ([]byte, error) {
+			return storageManager.SubKey("canaries")
+		}, cfg.Canaries.FuzzyThreshold)
+		if cfg.Logging.Startup {
+			log.Printf("Canary matching enabled: %s", path)
+		}
+	}
+	if cfg.Security.AlertWebhook != "" {
+		server.alerter = honeypot.NewAlerter(cfg.Security.AlertWebhook)
+	}
+
+	// New-drop webhook with a sealed, minimal payload (campaign and hour)
+	if cfg.Notify.WebhookURL != "" {
+		secret := os.Getenv(cfg.Notify.SecretEnv)
+		if cfg.Notify.SecretEnv == "" || secret == "" {
+			log.Fatalf("notify.webhook_url requires notify.secret_env naming a set environment variable")
+		}
+		notifier, err := notify.New(cfg.Notify.WebhookURL, []byte(secret),
+			time.Duration(cfg.Notify.JitterSeconds)*time.Second)
+		if err != nil {
+			log.Fatalf("Invalid new-drop webhook settings: %v", err)
+		}
+		server.notifier = notifier
+		if cfg.Logging.Startup {
+			log.Printf("New-drop webhook enabled (jitter up to %ds)", cfg.Notify.JitterSeconds)
+		}
+	}
+
+	// Warn before the quota fills and uploads start being refused
+	if storageManager.Quota != nil {
+		alerts := cfg.Security.QuotaAlerts
+		if len(alerts) == 0 {
+			alerts = defaultQuotaAlerts
+		}
+		if err := storageManager.Quota.SetAlerts(alerts, server.quotaAlert); err != nil {
+			log.Fatalf("Invalid security.quota_alerts: %v", err)
+		}
+	}
+
+	// Start automatic cleanup. Retention classes carry their own ages;
+	// max_age_hours applies to drops without a class, and any drop may
+	// carry an expiry its source chose.
 	maxAge := cfg.Security.GetMaxFileAge()
-	if maxAge > 0 {
+	if maxAge > 0 || len(storageManager.Retention) > 0 || cfg.Security.MaxExpiresHours > 0 {
 		cleanupConfig := storage.CleanupConfig{
 			MaxAge:        maxAge,
 			CheckInterval: 1 * time.Hour,
 		}
 		server.storage.StartCleanup(cleanupConfig)
 		if cfg.Logging.Startup {
-			log.Printf("Automatic cleanup enabled: files older than %v will be deleted", maxAge)
+			switch {
+			case len(storageManager.Retention) > 0:
+				log.Printf("Automatic cleanup enabled: %d retention classes", len(storageManager.Retention))
+			case maxAge > 0:
+				log.Printf("Automatic cleanup enabled: files older than %v will be deleted", maxAge)
+			default:
+				log.Printf("Automatic cleanup enabled: files are deleted only at the expiry their source chose")
+			}
+		}
+	}
+
+	// Uploads are checked by workers, starting with any drops a restart left
+	// waiting; in locked mode those are queued after unlock. At shutdown
+	// the workers finish the drops in hand before the keys are zeroed
+	stopProcessing := func() {}
+	if server.processing != nil {
+		stop := make(chan struct{})
+		wait := server.startProcessing(cfg.Processing.Workers, stop)
+		stopProcessing = func() {
+			close(stop)
+			wait()
+		}
+		if !lockedStart {
+			go server.requeuePending()
+		}
+		if cfg.Logging.Startup {
+			log.Printf("Asynchronous processing enabled (queue of %d)", cap(server.processing.jobs))
 		}
 	}
 
@@ -177,11 +636,114 @@ func main() {
 	mux := http.NewServeMux()
 
 	// SECURITY: Rate limiting to prevent DoS and enumeration attacks
-	rateLimit := cfg.Security.RateLimitPerMin
-	if rateLimit <= 0 {
-		rateLimit = 10 // Default to 10 if not configured
+	limiter := ratelimit.NewLimiter(rateLimit(cfg), 1*time.Minute)
+	if v4, v6 := cfg.Security.RateLimitIPv4Prefix, cfg.Security.RateLimitIPv6Prefix; v4 != 0 || v6 != 0 {
+		if v4 == 0 {
+			v4 = ratelimit.DefaultIPv4Prefix
+		}
+		if v6 == 0 {
+			v6 = ratelimit.DefaultIPv6Prefix
+		}
+		if err := limiter.SetPrefixes(v4, v6); err != nil {
+			log.Fatalf("Invalid rate limit prefix: %v", err)
+		}
+	}
+	limiter.OnReject = func(r *http.Request) {
+		// r.Pattern is the registered route, never a caller-chosen path
+		server.metrics.RecordRateLimited(r.Pattern)
+		server.recordIncident(incidents.KindRateLimited, "", r)
+	}
+	server.metrics.SetLimitedFunc(limiter.Limited)
+	if cfg.Security.CSPReports {
+		server.cspReports = newCSPReports()
+	}
+	if cfg.Security.DuplicateAdvisoryMinutes > 0 {
+		server.recent, err = newRecentUploads(time.Duration(cfg.Security.DuplicateAdvisoryMinutes) * time.Minute)
+		if err != nil {
+			log.Fatalf("Failed to set up duplicate advisories: %v", err)
+		}
+	}
+	if cfg.Security.ReceiptAttempts > 0 {
+		lockout := time.Duration(cfg.Security.ReceiptLockoutMinutes) * time.Minute
+		if lockout == 0 {
+			lockout = defaultReceiptLockout
+		}
+		server.attempts = ratelimit.NewAttempts(cfg.Security.ReceiptAttempts, lockout)
+	}
+	if cfg.Security.PoWRequired && cfg.Security.RateLimitMode != "pow" {
+		log.Fatalf("security.pow_required requires rate_limit_mode pow")
+	}
+	if cfg.Security.RateLimitMode == "pow" {
+		server.pow, err = ratelimit.NewPoW(cfg.Security.PoWDifficulty, rateLimit(cfg), time.Minute)
+		if err != nil {
+			log.Fatalf("Failed to set up proof of work: %v", err)
+		}
+		limiter.UseProofOfWork(server.pow, server.powApplies)
+		if cfg.Logging.Startup {
+			log.Printf("Hidden service requests budgeted by proof of work (%d bits when quiet)", server.pow.Difficulty())
+		}
+	}
+
+	// SIGHUP, or the admin API, re-reads the config file and applies the
+	// settings that may change while the server runs
+	if *configPath != "" {
+		server.reloader = &reloader{
+			server:  server,
+			path:    *configPath,
+			flags:   func(cfg *config.Config) { applyFlags(cfg) },
+			secrets: storedSecrets,
+			limiter: limiter,
+		}
+		if len(reloadSignals) > 0 {
+			reloadCh := make(chan os.Signal, 1)
+			signal.Notify(reloadCh, reloadSignals...)
+			stopReload := make(chan struct{})
+			defer close(stopReload)
+			go server.reloader.watch(reloadCh, stopReload)
+		}
+	}
+
+	// Admin API on a unix socket and/or a mutual-TLS listener, with every
+	// change written to the audit log
+	var admin *adminAPI
+	if cfg.Admin.Socket != "" || cfg.Admin.Listen != "" {
+		auditPath := cfg.Admin.AuditLog
+		if auditPath == "" {
+			auditPath = filepath.Join(cfg.Server.StorageDir, ".audit.log")
+		}
+		auditLog, err := audit.Open(auditPath)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		admin, err = newAdminAPI(server, cfg.Admin.Tokens, auditLog)
+		if err != nil {
+			log.Fatalf("Invalid admin config: %v", err)
+		}
+		if cfg.Admin.Socket != "" {
+			ln, err := listenUnixSocket(cfg.Admin.Socket)
+			if err != nil {
+				log.Fatalf("Failed to open admin socket: %v", err)
+			}
+			go admin.Serve(ln)
+			if cfg.Logging.Startup {
+				log.Printf("Admin API listening on unix socket %s (audit log %s)", cfg.Admin.Socket, auditPath)
+			}
+		}
+		if cfg.Admin.Listen != "" {
+			tlsCfg, err := adminTLSConfig(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile, clientCAs)
+			if err != nil {
+				log.Fatalf("Failed to configure admin TLS: %v", err)
+			}
+			ln, err := tls.Listen("tcp", cfg.Admin.Listen, tlsCfg)
+			if err != nil {
+				log.Fatalf("Failed to open admin listener: %v", err)
+			}
+			go admin.Serve(ln)
+			if cfg.Logging.Startup {
+				log.Printf("Admin API listening on %s with client certificates (audit log %s)", cfg.Admin.Listen, auditPath)
+			}
+		}
 	}
-	limiter := ratelimit.NewLimiter(rateLimit, 1*time.Minute)
 
 	// Optional Tor-only middleware wrapper
 	wrap := func(h http.HandlerFunc) http.HandlerFunc { return h }
@@ -189,11 +751,127 @@ func main() {
 		wrap = server.torOnlyMiddleware
 	}
 
+	// Tor exit relay list, used for origin statistics and tor_exit_only
+	originStats := cfg.Server.Metrics.Enabled && cfg.Server.Metrics.OriginStats
+	if originStats || cfg.Security.TorExitOnly {
+		server.exits = loadTorExits(cfg.TorExits)
+		if cfg.TorExits.RefreshHours > 0 {
+			client, err := torExitClient(cfg.TorExits)
+			if err != nil {
+				log.Fatalf("Invalid tor_exits.proxy: %v", err)
+			}
+			stopExits := make(chan struct{})
+			defer close(stopExits)
+			go server.refreshTorExits(client, torExitURL(cfg.TorExits),
+				time.Duration(cfg.TorExits.RefreshHours)*time.Hour, stopExits)
+		}
+		if cfg.Logging.Startup {
+			log.Printf("Tor exit list: %d addresses", server.exits.Len())
+		}
+	}
+
+	if cfg.Security.TorExitOnly {
+		if cfg.Security.TorOnly {
+			log.Fatalf("tor_only and tor_exit_only are mutually exclusive")
+		}
+		wrap = server.torExitOnlyMiddleware
+		if cfg.Logging.Startup {
+			log.Printf("Tor exit-only mode (fail open: %v)", cfg.TorExits.FailOpen)
+		}
+	}
+
+	// Coarse origin statistics (loopback / Tor exit / clearnet), counted
+	// before any rejection so the metrics reflect all traffic
+	if originStats {
+		inner := wrap
+		wrap = func(h http.HandlerFunc) http.HandlerFunc { return server.countOrigin(inner(h)) }
+	}
+
+	// Request spans for a local OpenTelemetry collector
+	if cfg.Tracing.Enabled {
+		endpoint := cfg.Tracing.Endpoint
+		if endpoint == "" {
+			endpoint = defaultTraceEndpoint
+		}
+		server.tracer = tracing.New(endpoint)
+		inner := wrap
+		wrap = func(h http.HandlerFunc) http.HandlerFunc { return server.traceRequests(inner(h)) }
+		if cfg.Logging.Startup {
+			log.Printf("Tracing to %s", endpoint)
+		}
+	}
+
+	// Per-route latency histograms, taken around every other check so that
+	// rejected requests are timed too
+	if cfg.Server.Metrics.Enabled {
+		inner := wrap
+		wrap = func(h http.HandlerFunc) http.HandlerFunc { return server.timeRequests(inner(h)) }
+	}
+
+	// Opt-in request sampling for latency debugging, outermost so that
+	// rejected requests are timed too
+	if n := cfg.Logging.SampleRequests; n != 0 {
+		if n < 0 || cfg.Logging.LogDir == "" {
+			log.Fatalf("logging.sample_requests must be positive and requires logging.log_dir")
+		}
+		samplePath := filepath.Join(cfg.Logging.LogDir, "requests.log")
+		sampleFile, err := os.OpenFile(samplePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // #nosec G304 -- log path from config/flag
+		if err != nil {
+			log.Fatalf("Failed to open request sample log: %v", err)
+		}
+		defer sampleFile.Close()
+		sampler := newRequestSampler(n, sampleFile)
+		inner := wrap
+		wrap = func(h http.HandlerFunc) http.HandlerFunc { return sampler.middleware(inner(h)) }
+		if cfg.Logging.Startup {
+			log.Printf("Request sampling: 1 in %d to %s", n, samplePath)
+		}
+	}
+
+	// Retrieval needs a client certificate when client CAs are configured;
+	// submission stays open
+	retrieval := func(h http.HandlerFunc) http.HandlerFunc { return h }
+	if clientCAs != nil {
+		retrieval = server.requireClientCert
+	}
+
 	// Routes with rate limiting and security headers
 	mux.HandleFunc("/", wrap(server.securityHeaders(server.handleIndex)))
 	mux.HandleFunc("/static/", wrap(server.securityHeaders(server.handleStatic())))
-	mux.HandleFunc("/submit", wrap(server.securityHeaders(limiter.Middleware(server.handleSubmit))))
-	mux.HandleFunc("/retrieve", wrap(server.securityHeaders(limiter.Middleware(server.handleRetrieve))))
+	mux.HandleFunc("/api/v1/capacity", wrap(server.securityHeaders(server.handleCapacity)))
+	if server.pow != nil {
+		mux.HandleFunc("/api/v1/pow-challenge", wrap(server.securityHeaders(server.handlePoWChallenge)))
+		mux.HandleFunc("/challenge", wrap(server.securityHeaders(server.handlePoWChallenge)))
+	}
+	mux.HandleFunc("/submit", wrap(server.securityHeaders(server.countRejections(server.requirePoW(limiter.Middleware(server.handleSubmit))))))
+	if server.uploads != nil {
+		// Chunks are not rate limited: a large upload takes many, and each
+		// names an upload only init could have started
+		mux.HandleFunc("/upload/init", wrap(server.securityHeaders(server.requirePoW(limiter.Middleware(server.handleUploadInit)))))
+		mux.HandleFunc("/upload/chunk", wrap(server.securityHeaders(server.handleUploadChunk)))
+		mux.HandleFunc("/upload/finish", wrap(server.securityHeaders(server.countRejections(server.requirePoW(limiter.Middleware(server.handleUploadFinish))))))
+	}
+	mux.HandleFunc("/retrieve", wrap(server.securityHeaders(retrieval(limiter.Middleware(server.handleRetrieve)))))
+	mux.HandleFunc("/api/v1/download-token", wrap(server.securityHeaders(retrieval(limiter.Middleware(server.handleDownloadToken)))))
+	mux.HandleFunc("/download/", wrap(server.securityHeaders(retrieval(server.handleDownload))))
+	mux.HandleFunc("/api/v1/drop-status", wrap(server.securityHeaders(retrieval(limiter.Middleware(server.handleDropStatus)))))
+	if cfg.Security.Previews {
+		mux.HandleFunc("/api/v1/preview", wrap(server.securityHeaders(retrieval(limiter.Middleware(server.handlePreview)))))
+	}
+	if server.cspReports != nil {
+		// Not rate limited: a page may report several violations at once,
+		// and the counts are bounded whatever is sent
+		mux.HandleFunc("/csp-report", wrap(server.securityHeaders(server.handleCSPReport)))
+	}
+	if cfg.Security.Replies {
+		// Sources hold the same credentials as receivers but no client
+		// certificate, so /check-reply stays outside retrieval's
+		mux.HandleFunc("/reply", wrap(server.securityHeaders(retrieval(limiter.Middleware(server.handleReply)))))
+		mux.HandleFunc("/check-reply", wrap(server.securityHeaders(limiter.Middleware(server.handleCheckReply))))
+	}
+	if cfg.Security.TornReceipts {
+		mux.HandleFunc("/receipt/", wrap(server.securityHeaders(limiter.Middleware(server.handleReceiptQR))))
+	}
 
 	// Metrics endpoint
 	if cfg.Server.Metrics.Enabled {
@@ -203,26 +881,55 @@ func main() {
 				return storageManager.Quota.Stats()
 			}
 		}
+		if storageManager.Quota != nil {
+			server.metrics.SetQuotaFunc(storageManager.Quota.UsagePercent)
+		}
+		server.metrics.SetDropsFunc(func(observe func(float64, int64)) error {
+			return storageManager.EachDrop(func(age time.Duration, size int64) {
+				observe(age.Seconds(), size)
+			})
+		})
 		metricsHandler := server.metrics.Handler(statsFunc)
+		if token := cfg.Server.Metrics.BearerToken; token != "" {
+			if len(token) < minAdminTokenLen {
+				log.Fatalf("server.metrics.bearer_token is shorter than %d characters", minAdminTokenLen)
+			}
+			metricsHandler = bearerOnly(token, metricsHandler)
+		}
 		if cfg.Server.Metrics.LocalhostOnly {
 			mux.HandleFunc("/metrics", server.localhostOnly(metricsHandler))
 		} else {
+			if cfg.Server.Metrics.BearerToken == "" {
+				log.Println("WARNING: /metrics is reachable from any address without authentication. Set localhost_only or bearer_token.")
+			}
 			mux.HandleFunc("/metrics", metricsHandler)
 		}
 	}
 
 	if cfg.Logging.Startup {
-		log.Printf("Dead drop server starting on %s", cfg.Server.Listen)
+		log.Printf("Dead drop server %s starting on %s", buildinfo.Version, cfg.Server.Listen)
+		if basePath != "" {
+			log.Printf("Serving under base path %s", basePath)
+		}
+		if overrides := cfg.EnvOverrides(); len(overrides) > 0 {
+			log.Printf("Set by the environment: %s", strings.Join(overrides, ", "))
+		}
 		log.Printf("Storage directory: %s", cfg.Server.StorageDir)
 		log.Printf("Max upload size: %d MB", cfg.Server.MaxUploadMB)
 		log.Printf("Delete after retrieve: %v", cfg.Security.DeleteAfterRetrieve)
 		log.Printf("Secure delete: %v", cfg.Security.SecureDelete)
 		log.Printf("Tor-only mode: %v", cfg.Security.TorOnly)
+		if cfg.Security.EntropyCheck != "" {
+			log.Printf("Entropy check: %s", cfg.Security.EntropyCheck)
+		}
+	}
+	if cfg.Security.AllowQueryCredentials {
+		log.Printf("WARNING: allow_query_credentials is deprecated; retrieval credentials in URLs leak into proxy logs and browser history")
 	}
 
 	srv := &http.Server{
 		Addr:         cfg.Server.Listen,
-		Handler:      mux,
+		Handler:      mountAt(basePath, mux),
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 60 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -235,9 +942,12 @@ func main() {
 	go func() {
 		var err error
 		if tlsEnabled {
-			srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			srv.TLSConfig = publicTLSConfig(clientCAs)
 			if cfg.Logging.Startup {
 				log.Printf("TLS enabled with cert=%s key=%s", cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+				if clientCAs != nil {
+					log.Printf("Retrieval requires client certificates from %s", cfg.Server.TLS.ClientCAFile)
+				}
 			}
 			err = srv.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
 		} else {
@@ -250,17 +960,123 @@ func main() {
 
 	<-shutdownCh
 	log.Println("Shutting down, waiting for in-flight requests...")
+	go func() {
+		// A second signal gives up on draining
+		<-shutdownCh
+		log.Println("Forced shutdown")
+		os.Exit(1)
+	}()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// New connections are refused at once; uploads and downloads under way
+	// get until the timeout to finish
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("Shutdown error: %v", err)
 	}
+	if admin != nil {
+		admin.Shutdown(ctx)
+	}
+	stopProcessing()
+	if err := server.tracer.Close(ctx); err != nil && cfg.Logging.Errors {
+		log.Printf("Failed to export the last traces: %v", err)
+	}
+	if server.incidents != nil {
+		if err := server.incidents.Flush(); err != nil && cfg.Logging.Errors {
+			log.Printf("Failed to flush incident log: %v", err)
+		}
+	}
+	if server.stats != nil {
+		if err := server.stats.FlushAll(); err != nil && cfg.Logging.Errors {
+			log.Printf("Failed to flush usage statistics: %v", err)
+		}
+	}
 
 	log.Println("Server stopped")
 }
 
+// importKeyBundle installs offline-generated key material from the configured
+// bundle before the storage manager loads (or would otherwise generate) keys.
+func importKeyBundle(cfg *config.Config, passphrase string) error {
+	bundle, err := storage.LoadKeyBundle(cfg.Security.KeyBundle)
+	if err != nil {
+		return fmt.Errorf("failed to load key bundle: %w", err)
+	}
+	imported, err := bundle.Import(cfg.Server.StorageDir, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to import key bundle: %w", err)
+	}
+	if imported && cfg.Logging.Startup {
+		log.Printf("Imported key bundle created %s; remove it from this host", bundle.Created.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// forceLoopback moves a tor_only server listening on all interfaces to
+// loopback, and reports whether it did.
+func forceLoopback(cfg *config.Config) bool {
+	if !cfg.Security.TorOnly {
+		return false
+	}
+	host, port, err := net.SplitHostPort(cfg.Server.Listen)
+	if err != nil || host != "" {
+		return false
+	}
+	cfg.Server.Listen = "127.0.0.1:" + port
+	return true
+}
+
+// newValidator builds the upload validator with the type lists from the
+// validation settings and the resource guards from the security settings.
+func newValidator(cfg *config.Config) *validation.Validator {
+	v := validation.NewValidator(cfg.Server.MaxUploadMB)
+	if len(cfg.Validation.AllowedTypes) > 0 {
+		v.AllowedTypes = cfg.Validation.AllowedTypes
+	}
+	if len(cfg.Validation.BlockedTypes) > 0 {
+		v.BlockedTypes = cfg.Validation.BlockedTypes
+	}
+	if len(cfg.Validation.BlockedExtensions) > 0 {
+		v.BlockedExtensions = cfg.Validation.BlockedExtensions
+	}
+	v.AllowAll = cfg.Validation.AllowAll
+	v.MaxNesting = cfg.Security.MaxArchiveNesting
+	v.MaxExaminedBytes = cfg.Security.MaxExaminedMB * 1024 * 1024
+	return v
+}
+
+// newScrubber builds the metadata scrubber, registering any external tools
+// configured under scrubbers.external on top of the built-in scrubbers.
+// Structurally invalid files are rejected unless scrubbers.on_invalid is
+// "passthrough".
+func newScrubber(cfg *config.Config) *metadata.Scrubber {
+	scrubber := metadata.NewScrubberWithOptions(metadata.Options{
+		RejectInvalid: cfg.Scrubbers.OnInvalid != "passthrough",
+		StrictJPEG:    cfg.Scrubbers.StrictJPEG,
+	})
+	for _, ext := range cfg.Scrubbers.External {
+		if len(ext.Command) == 0 {
+			log.Fatalf("External scrubber for %v has no command", ext.Extensions)
+		}
+		tool := &metadata.ExternalTool{
+			Command:        ext.Command,
+			InPlace:        ext.InPlace,
+			Timeout:        time.Duration(ext.TimeoutSeconds) * time.Second,
+			MaxOutputBytes: ext.MaxOutputMB * 1024 * 1024,
+			TempDir:        cfg.Scrubbers.TempDir,
+			Sandbox:        cfg.Scrubbers.Sandbox,
+		}
+		for _, e := range ext.Extensions {
+			scrubber.Register(e, tool.Transform(e))
+		}
+		if cfg.Logging.Startup {
+			log.Printf("External scrubber %s registered for %v", filepath.Base(ext.Command[0]), ext.Extensions)
+		}
+	}
+	return scrubber
+}
+
 // torOnlyMiddleware rejects connections not originating from a loopback address.
 func (s *Server) torOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -295,12 +1111,31 @@ func (s *Server) localhostOnly(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// bearerOnly rejects requests without "Authorization: Bearer <token>", for
+// metrics scraped over a network.
+func bearerOnly(token string, next http.HandlerFunc) http.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+	return func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		got := sha256.Sum256([]byte(presented))
+		if !ok || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
 // securityHeaders wraps a handler with security response headers.
 func (s *Server) securityHeaders(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self'")
+		w.Header().Set("Content-Security-Policy", s.cspHeader())
+		if s.cspReports != nil {
+			w.Header().Set("Reporting-Endpoints", `csp="`+s.basePath+`/csp-report"`)
+		}
 		w.Header().Set("Referrer-Policy", "no-referrer")
 		w.Header().Set("X-XSS-Protection", "1; mode=block")
 		w.Header().Set("Cache-Control", "no-store")
@@ -326,26 +1161,33 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := staticFiles.ReadFile("static/index.html")
+	token, err := s.issueCSRFToken(w)
 	if err != nil {
-		// Fallback if embed fails
-		w.Header().Set("Content-Type", "text/html")
-		fmt.Fprintf(w, `<!DOCTYPE html>
-<html>
-<head><title>Dead Drop</title></head>
-<body>
-<h1>Dead Drop - Anonymous File Submission</h1>
-<form action="/submit" method="post" enctype="multipart/form-data">
-<input type="file" name="file" required>
-<button type="submit">Submit</button>
-</form>
-</body>
-</html>`)
+		if s.config().Logging.Errors {
+			log.Printf("Failed to issue CSRF token: %v", err)
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/html")
-	_, _ = w.Write(data)
+	if err := s.pages().ExecuteTemplate(w, "index.html", indexPage{
+		BasePath:    s.basePath,
+		CSRFToken:   token,
+		MaxUploadMB: s.config().Server.MaxUploadMB,
+		Paused:      s.submissionsPaused(),
+		Campaign:    s.campaignCode(r.URL.Query().Get("campaign")),
+		Retention:   s.selectableClasses(),
+		QRReceipt:   s.config().Security.TornReceipts,
+		EnvelopeKey: s.envelopePublicKey(),
+		MaxExpires:  s.config().Security.MaxExpiresHours,
+
+		RecipientKey:         s.recipientPublicKey(),
+		RecipientFingerprint: s.recipientFingerprint(),
+		PoWURL:               s.powURL(r),
+	}); err != nil && s.config().Logging.Errors {
+		log.Printf("Failed to render index: %v", err)
+	}
 }
 
 func (s *Server) handleStatic() http.HandlerFunc {
@@ -357,7 +1199,7 @@ func (s *Server) handleStatic() http.HandlerFunc {
 			return
 		}
 
-		data, err := staticFiles.ReadFile("static/" + name)
+		data, err := fs.ReadFile(s.staticAssets(), name)
 		if err != nil {
 			http.NotFound(w, r)
 			return
@@ -372,7 +1214,7 @@ func (s *Server) handleStatic() http.HandlerFunc {
 			w.Header().Set("Content-Type", "application/octet-stream")
 		}
 
-		_, _ = w.Write(data) // #nosec G705 -- data is from embedded filesystem, not user input
+		_, _ = w.Write(data) // #nosec G705 -- data is from the embedded or operator's static files, not user input
 	}
 }
 
@@ -382,139 +1224,649 @@ func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// CSRF protection: require custom header
-	if r.Header.Get("X-Dead-Drop-Upload") != "true" {
+	// CSRF protection: JS and CLI clients send the custom header; plain HTML
+	// form posts (no-JavaScript path) must carry a double-submit token instead
+	html := r.Header.Get("X-Dead-Drop-Upload") != "true"
+	if html && (!hasCSRFCookie(r) || crossSiteForm(r)) {
 		http.Error(w, "Missing required header", http.StatusBadRequest)
 		return
 	}
 
+	if s.config().Security.SubmissionsPaused {
+		s.fail(w, html, "Submissions are temporarily paused", http.StatusServiceUnavailable)
+		return
+	}
+	if s.storage.Locked() {
+		s.fail(w, html, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	// Refused before the body is read when not even an empty drop would fit
+	if s.storage.Quota != nil && !s.storage.Quota.CanAccept(0) {
+		s.refuseQuotaFull(w, html)
+		return
+	}
+
+	cost := s.uploadCost(r.ContentLength)
+	if !s.memory.Acquire(cost) {
+		s.metrics.RecordShed()
+		s.fail(w, html, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.memory.Release(cost)
+
 	// Limit upload size
-	r.Body = http.MaxBytesReader(w, r.Body, s.config.Server.MaxUploadMB*1024*1024)
+	r.Body = http.MaxBytesReader(w, r.Body, s.config().Server.MaxUploadMB*1024*1024)
+
+	// An enveloped upload is decrypted here, and its reply sealed, so that a
+	// TLS-terminating proxy sees neither the file nor the receipt
+	replyKey, err := s.openEnvelope(r)
+	if err != nil || (replyKey != nil && html) {
+		if err != nil && s.config().Logging.Errors {
+			log.Printf("Upload envelope rejected: %v", err)
+		}
+		s.fail(w, html, "Invalid upload envelope", http.StatusBadRequest)
+		return
+	}
+	defer crypto.ZeroBytes(replyKey)
 
+	var up upload
 	file, header, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusBadRequest)
+	switch {
+	case err == nil && len(r.MultipartForm.File["file"]) > 1:
+		// Several files are bundled into one drop
+		file.Close()
+		up.parts = r.MultipartForm.File["file"]
+		if len(up.parts) > maxBundleFiles {
+			s.fail(w, html, fmt.Sprintf("At most %d files can be sent at once", maxBundleFiles), http.StatusBadRequest)
+			return
+		}
+		up.name, up.contentType = bundleFilename, bundleContentType
+	case err == nil:
+		defer file.Close()
+		up.file, up.name, up.contentType = file, header.Filename, header.Header.Get("Content-Type")
+	case errors.Is(err, http.ErrMissingFile) && r.FormValue("message") != "":
+		// A message sent without a file is the drop itself
+		text, ok := s.formMessage(w, r, html)
+		if !ok {
+			return
+		}
+		if text == "" {
+			s.fail(w, html, "Message is empty", http.StatusBadRequest)
+			return
+		}
+		r.Form.Del("message")
+		up.file, up.name, up.contentType = strings.NewReader(text), messageFilename, messageContentType
+	default:
+		s.fail(w, html, "Failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	if html && !s.validCSRFToken(r) {
+		s.fail(w, html, "Form expired, please reload the page and try again", http.StatusForbidden)
+		return
+	}
+
+	s.acceptUpload(w, r, html, replyKey, up)
+}
+
+// acceptUpload stores up as a new drop with the options in r's form and
+// answers the source, for /submit and the resumable upload endpoints. The
+// caller has checked that uploads are accepted and reserved their memory.
+func (s *Server) acceptUpload(w http.ResponseWriter, r *http.Request, html bool, replyKey []byte, up upload) {
+	channel, receiptKey, ok := s.receiptChannel(w, r, html)
+	if !ok {
 		return
 	}
-	defer file.Close()
 
 	// SECURITY: Sanitize filename at point of entry to prevent path traversal
 	// or injection in metadata storage and any downstream consumers
-	filename := filepath.Base(header.Filename)
+	filename := filepath.Base(up.name)
 
-	// Validate file
-	fileData, err := s.validator.ValidateFile(filename, file)
-	if err != nil {
-		if s.config.Logging.Errors {
-			log.Printf("Validation failed: %v", err)
+	opts := &storage.SaveOptions{ClientEncrypted: r.FormValue("client_encrypted") == "true"}
+	if fp := r.FormValue("key_fingerprint"); fp != "" {
+		// Only meaningful for a payload the client encrypted itself
+		if !opts.ClientEncrypted || !crypto.ValidKeyFingerprint(fp) {
+			s.fail(w, html, "Invalid key fingerprint", http.StatusBadRequest)
+			return
 		}
-		// SECURITY: Generic error message to prevent information leakage
-		http.Error(w, "Invalid file upload", http.StatusBadRequest)
+		opts.KeyFingerprint = fp
+	}
+	file := up.file
+	if fp := s.recipientFingerprint(); fp != "" && opts.KeyFingerprint == fp && up.parts == nil {
+		sealed, ok := checkSealed(file)
+		if !ok {
+			s.fail(w, html, "Upload is not sealed to the recipient key", http.StatusBadRequest)
+			return
+		}
+		file = sealed
+	}
+	opts.ContentType = up.contentType
+	if opts.Message, ok = s.formMessage(w, r, html); !ok {
 		return
 	}
+	opts.Campaign = s.campaignCode(r.FormValue("campaign"))
+	if s.campaignFull(opts.Campaign) {
+		// Refused like any other overload, so that the reply says no more
+		// than that the server is busy
+		s.recordIncident(incidents.KindCampaignLimit, "", r)
+		if s.config().Logging.Operations {
+			log.Printf("Upload refused: campaign %q reached its drop limit", opts.Campaign) // #nosec G706 -- configured campaign code
+		}
+		w.Header().Set("Retry-After", quotaRetryAfter)
+		s.fail(w, html, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	opts.Retention = s.retentionClass(r.FormValue("retention"), opts.Campaign, filename)
+	expiresHours, ok := s.uploadExpiry(r.FormValue("expires_hours"))
+	if !ok {
+		s.fail(w, html, "Invalid expiry", http.StatusBadRequest)
+		return
+	}
+	opts.Expires = time.Duration(expiresHours) * time.Hour
+	if passphrase := r.FormValue("passphrase"); passphrase != "" {
+		if len(passphrase) < minPassphraseLen || len(passphrase) > maxPassphraseLen {
+			s.fail(w, html, fmt.Sprintf("Passphrase must be %d to %d characters", minPassphraseLen, maxPassphraseLen), http.StatusBadRequest)
+			return
+		}
+		// Deriving the drop key takes memory of its own
+		if !s.memory.Acquire(crypto.DropKeyMemory) {
+			s.metrics.RecordShed()
+			s.fail(w, html, "Server busy, please try again later", http.StatusServiceUnavailable)
+			return
+		}
+		defer s.memory.Release(crypto.DropKeyMemory)
+		opts.Passphrase = passphrase
+	}
 
-	reader := bytes.NewReader(fileData)
-
-	// Optionally scrub metadata (deprecated: prefer client-side)
-	if s.config.Security.ScrubMetadata {
-		scrubbed := &bytes.Buffer{}
-		if err := s.scrubber.ScrubFile(filename, reader, scrubbed); err != nil {
-			if s.config.Logging.Errors {
-				log.Printf("Metadata scrubbing failed: %v", err)
-			}
-			// Continue with original file if scrubbing fails
-			reader = bytes.NewReader(fileData)
+	var reader io.Reader = file
+	var match *canary.Match
+	if s.processing != nil && opts.Passphrase == "" && up.parts == nil {
+		// Stored as received; a worker checks and scrubs it afterwards. A
+		// passphrase-protected drop could not be read by the worker, so it
+		// is checked now instead, as is a bundle, whose files the worker
+		// would have to unpack.
+		opts.Pending = true
+	} else {
+		// Validation and scrubbing share one time budget, so a crafted file
+		// cannot hold a core for longer than security.parse_timeout_seconds
+		parseCtx, cancel := context.WithTimeout(r.Context(), s.parseTimeout())
+		defer cancel()
+
+		// SECURITY: Generic error messages to prevent information leakage
+		var checked io.ReadCloser
+		var m *canary.Match
+		var err error
+		if up.parts != nil {
+			checked, m, err = s.bundleUpload(parseCtx, up.parts, opts)
 		} else {
-			reader = bytes.NewReader(scrubbed.Bytes())
+			checked, m, err = s.inspectUpload(parseCtx, filename, file, opts)
+		}
+		if errors.Is(err, errNotSealed) {
+			s.fail(w, html, "Upload is not sealed to the recipient key", http.StatusBadRequest)
+			return
 		}
+		if errors.Is(err, errUndeclaredOpaque) {
+			s.fail(w, html, "Encrypted uploads must be declared", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.fail(w, html, "Invalid file upload", http.StatusBadRequest)
+			return
+		}
+		defer checked.Close()
+		reader, match = checked, m
 	}
 
 	// Save the drop
-	drop, err := s.storage.SaveDrop(filename, reader)
+	_, span := s.tracer.Start(r.Context(), "storage.save")
+	span.SetAttr("storage.operation", "save")
+	drop, err := s.storage.SaveDropWithOptions(filename, reader, opts)
 	if err != nil {
-		if s.config.Logging.Errors {
+		span.SetError(errorClass(err))
+	} else {
+		span.SetAttr("storage.size_bucket", sizeBucket(drop.Size))
+	}
+	span.End()
+	if errors.Is(err, storage.ErrKeyExhausted) {
+		// Logged whatever the logging settings: only rotating the key ends it
+		log.Printf("Upload refused: %v", err)
+		s.fail(w, html, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		if s.config().Logging.Errors {
 			log.Printf("Error saving drop: %v", err)
 		}
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, metadata.ErrInvalidFile) {
+			s.fail(w, html, "Invalid file upload", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			s.refuseQuotaFull(w, html)
+			return
+		}
+		s.fail(w, html, "Failed to save file", http.StatusInternalServerError)
 		return
 	}
 
+	if opts.Pending {
+		if !s.processing.add(processingJob{dropID: drop.ID, origin: s.requestOrigin(r).String()}) {
+			// Nothing would process the drop until a restart
+			if err := s.storage.DeleteDrop(drop.ID); err != nil && s.config().Logging.Errors {
+				log.Printf("Failed to delete unqueued drop: %v", err)
+			}
+			s.metrics.RecordShed()
+			s.fail(w, html, "Server busy, please try again later", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
 	s.metrics.RecordUpload()
+	s.metrics.ObserveUploadSize(drop.Size)
+	if s.stats != nil {
+		s.stats.AddSubmission(drop.Size)
+	}
+	if s.notifier != nil && !opts.Pending {
+		s.notifier.NewDrop(opts.Campaign)
+	}
+	if match != nil {
+		s.canaryAlert(drop.ID, match, s.requestOrigin(r).String())
+	}
 
-	if s.config.Logging.Operations {
+	if s.config().Logging.Operations {
 		// Drop ID is validated hex, safe to log
 		log.Printf("Drop saved: %s", drop.ID) // #nosec G706 -- drop.ID is generated hex
 	}
 
-	// Return drop_id, receipt, and file hash
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"drop_id":   drop.ID,
-		"receipt":   drop.Receipt,
-		"file_hash": drop.FileHash,
-		"message":   "File submitted successfully",
-	})
+	resp := s.submitResponse(drop)
+	if opts.KeyFingerprint != "" {
+		// Echoed so that the client can confirm what was recorded
+		resp["key_fingerprint"] = opts.KeyFingerprint
+	}
+	if expiresHours > 0 {
+		// Echoed so that the source learns of any shortening
+		resp["expires_hours"] = strconv.Itoa(expiresHours)
+	}
+	if opts.Passphrase != "" {
+		resp["passphrase_protected"] = "true"
+	}
+	if s.recent != nil && drop.FileHash != "" && s.recent.repeat(drop.FileHash) {
+		resp["advisory"] = duplicateAdvisory
+	}
+	if opts.Pending && s.config().Security.ScrubMetadata {
+		// Scrubbing will change the stored file, so this hash would not match it
+		delete(resp, "file_hash")
+	}
+	if s.config().Security.TimeAssertions {
+		// The drop is saved either way; the client warns when the signature is missing
+		if err := s.assertTime(resp, drop); err != nil && s.config().Logging.Errors {
+			log.Printf("Time assertion failed: %v", err)
+		}
+	}
+	if channel != "" {
+		// The drop is saved, so a failure here must not leak the receipt inline
+		if err := s.tearReceipt(resp, drop.ID, channel, receiptKey); err != nil {
+			if s.config().Logging.Errors {
+				log.Printf("Receipt delivery failed: %v", err)
+			}
+			s.fail(w, html, "Failed to deliver receipt", http.StatusInternalServerError)
+			return
+		}
+	}
+	if html {
+		s.renderPage(w, http.StatusOK, "result.html", resultPage{
+			BasePath:      s.basePath,
+			DropID:        resp["drop_id"],
+			Receipt:       resp["receipt"],
+			ReceiptURL:    resp["receipt_url"],
+			SealedReceipt: resp["sealed_receipt"],
+			FileHash:      resp["file_hash"],
+			ExpiresHours:  resp["expires_hours"],
+			Passphrase:    opts.Passphrase != "",
+			Advisory:      resp["advisory"],
+		})
+		return
+	}
+
+	if replyKey != nil {
+		s.writeSealedJSON(w, replyKey, resp)
+		return
+	}
+	s.writeJSON(w, resp)
+}
+
+// defaultParseTimeout bounds validating and scrubbing an upload when
+// security.parse_timeout_seconds is unset.
+const defaultParseTimeout = 30 * time.Second
+
+// parseTimeout returns the time budget for validating and scrubbing one
+// upload.
+func (s *Server) parseTimeout() time.Duration {
+	if s.config().Security.ParseTimeoutSeconds > 0 {
+		return time.Duration(s.config().Security.ParseTimeoutSeconds) * time.Second
+	}
+	return defaultParseTimeout
+}
+
+// submitResponse returns the fields reported to the source after an upload.
+// drop_id and receipt are always included; security.submit_response can drop
+// the file hash (which confirms exact content to anyone reading the reply)
+// and the message.
+func (s *Server) submitResponse(drop *storage.Drop) map[string]string {
+	resp := map[string]string{
+		"drop_id": drop.ID,
+		"receipt": drop.Receipt,
+	}
+	switch s.config().Security.SubmitResponse {
+	case "minimal":
+	case "no_hash":
+		resp["message"] = "File submitted successfully"
+	default:
+		resp["file_hash"] = drop.FileHash
+		resp["message"] = "File submitted successfully"
+	}
+	return resp
 }
 
 func (s *Server) handleRetrieve(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+	queryGet := r.Method == http.MethodGet && s.config().Security.AllowQueryCredentials
+	if r.Method != http.MethodPost && !queryGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// SECURITY: Accept credentials via POST body instead of URL query string
-	// to prevent leakage through proxy logs, browser history, and Referrer headers
-	dropID := r.FormValue("id")
-	receipt := r.FormValue("receipt")
+	html := acceptsHTML(r)
+	// Checked before the credentials so that a bad key cannot burn the drop
+	recipient, ok := s.recipientKey(w, r, html)
+	if !ok {
+		return
+	}
+	dropID, ok := s.retrievalCredentials(w, r, html)
+	if !ok {
+		return
+	}
+	passphrase := r.PostFormValue("passphrase")
+	if passphrase == "" {
+		passphrase = r.Header.Get(passphraseHeader)
+	}
+	s.serveDrop(w, r, html, dropID, recipient, passphrase)
+}
+
+// Bounds on the passphrase a source may protect a drop with, in bytes.
+const (
+	minPassphraseLen = 8
+	maxPassphraseLen = 1024
+)
+
+// defaultReceiptLockout is how long a drop ID is refused after
+// security.receipt_attempts wrong receipts, without receipt_lockout_minutes.
+const defaultReceiptLockout = 15 * time.Minute
+
+// Request headers that may carry retrieval credentials instead of a POST body.
+const (
+	dropIDHeader  = "X-Dead-Drop-ID"
+	receiptHeader = "X-Dead-Drop-Receipt"
+
+	// passphraseHeader carries the passphrase of a protected drop, as does
+	// the passphrase form field.
+	passphraseHeader = "X-Dead-Drop-Passphrase"
+
+	// recipientKeyHeader carries an age X25519 recipient to seal the
+	// download to, as does the recipient_key form field.
+	recipientKeyHeader = "X-Dead-Drop-Recipient-Key"
+
+	// integrityTrailer is the trailer holding the hex SHA-256 of the whole
+	// download body. It is sent only once every byte was written.
+	integrityTrailer = "X-Dead-Drop-SHA256"
+)
+
+// recipientKey returns the age recipient the receiver asked the drop to
+// be sealed to, or nil if none was given. On a malformed key it writes the
+// error response.
+func (s *Server) recipientKey(w http.ResponseWriter, r *http.Request, html bool) (*age.X25519Recipient, bool) {
+	encoded := r.PostFormValue("recipient_key")
+	if encoded == "" {
+		encoded = r.Header.Get(recipientKeyHeader)
+	}
+	if encoded == "" {
+		return nil, true
+	}
+	key, err := crypto.ParseRecipient(encoded)
+	if err != nil {
+		s.fail(w, html, "Invalid recipient key", http.StatusBadRequest)
+		return nil, false
+	}
+	return key, true
+}
+
+// retrievalCredentials validates the drop ID and receipt of a retrieval
+// request and returns the drop ID. On failure it writes the error response.
+func (s *Server) retrievalCredentials(w http.ResponseWriter, r *http.Request, html bool) (string, bool) {
+	if s.storage.Locked() {
+		s.fail(w, html, "Service unavailable", http.StatusServiceUnavailable)
+		return "", false
+	}
+
+	// SECURITY: Accept credentials via POST body or headers instead of URL
+	// query string to prevent leakage through proxy logs, browser history,
+	// and Referrer headers
+	dropID := r.PostFormValue("id")
+	receipt := r.PostFormValue("receipt")
+	if dropID == "" && receipt == "" {
+		dropID = r.Header.Get(dropIDHeader)
+		receipt = r.Header.Get(receiptHeader)
+	}
+	if dropID == "" && receipt == "" && s.config().Security.AllowQueryCredentials {
+		// Deprecated: kept only for old clients, see allow_query_credentials
+		dropID = r.URL.Query().Get("id")
+		receipt = r.URL.Query().Get("receipt")
+	}
 
 	if dropID == "" || receipt == "" {
-		http.Error(w, "Missing drop ID or receipt", http.StatusBadRequest)
-		return
+		s.fail(w, html, "Missing drop ID or receipt", http.StatusBadRequest)
+		return "", false
 	}
 
 	// Validate ID format
-	if len(dropID) != 32 {
-		http.Error(w, "Invalid drop ID", http.StatusBadRequest)
-		return
+	if storage.ValidateDropID(dropID) != nil {
+		s.fail(w, html, "Invalid drop ID", http.StatusBadRequest)
+		return "", false
+	}
+
+	// A drop ID that has seen too many wrong receipts is refused for a
+	// while, even with the right one, to frustrate guessing at a leaked ID
+	if s.attempts != nil && s.attempts.Blocked(dropID) {
+		s.fail(w, html, "Too many attempts for this drop, please try again later", http.StatusTooManyRequests)
+		return "", false
 	}
 
 	// SECURITY: Validate HMAC receipt before returning file
-	if !s.storage.Receipts.Validate(dropID, receipt) {
-		http.Error(w, "Invalid receipt", http.StatusForbidden)
-		return
+	if !s.storage.ValidateReceipt(dropID, receipt) {
+		s.recordIncident(incidents.KindInvalidReceipt, "", r)
+		if s.attempts != nil && s.attempts.Fail(dropID) {
+			s.recordIncident(incidents.KindReceiptLockout, dropID, r)
+			if s.config().Logging.Operations {
+				log.Printf("Drop ID refused after %d wrong receipts", s.config().Security.ReceiptAttempts)
+			}
+		}
+		s.fail(w, html, "Invalid receipt", http.StatusForbidden)
+		return "", false
 	}
 
 	// Honeypot detection: alert but still serve decoy (indistinguishable)
 	if s.honeypot != nil && s.honeypot.IsHoneypot(dropID) {
 		s.honeypot.Alert(dropID, r.RemoteAddr)
+		s.recordIncident(incidents.KindHoneypotAccess, dropID, r)
 	}
+	return dropID, true
+}
 
-	filename, reader, err := s.storage.GetDrop(dropID)
+// dropUnavailable reports why a drop whose credentials have been checked
+// cannot be served.
+func (s *Server) dropUnavailable(w http.ResponseWriter, html bool, err error) {
+	switch {
+	case errors.Is(err, storage.ErrPending):
+		s.fail(w, html, "Drop is still being processed, please try again later", http.StatusServiceUnavailable)
+	case errors.Is(err, storage.ErrQuarantined):
+		s.fail(w, html, "Drop is held for review by the operator", http.StatusForbidden)
+	case errors.Is(err, storage.ErrPassphraseRequired):
+		s.fail(w, html, "Drop is protected by a passphrase", http.StatusForbidden)
+	case errors.Is(err, storage.ErrWrongPassphrase):
+		s.fail(w, html, "Invalid passphrase", http.StatusForbidden)
+	default:
+		s.fail(w, html, "Drop not found", http.StatusNotFound)
+	}
+}
+
+// serveDrop streams a drop whose credentials have been checked, deleting it
+// afterwards when configured. With a recipient key the file and its name are
+// sealed to that key (crypto.SealFile), so that a TLS-terminating proxy on
+// the path sees neither. A passphrase-protected drop is only served with its
+// passphrase, and a wrong one does not burn it. A Range request gets the
+// ranges asked for, except of a bundle with a message or a sealed file, which
+// differ from one download to the next, and of a drop burned on retrieval
+// without security.resume_window_minutes.
+func (s *Server) serveDrop(w http.ResponseWriter, r *http.Request, html bool, dropID string, recipient *age.X25519Recipient, passphrase string) {
+	size, err := s.storage.StoredSize(dropID)
 	if err != nil {
-		http.Error(w, "Drop not found", http.StatusNotFound)
+		s.dropUnavailable(w, html, err)
 		return
 	}
-	defer reader.Close()
+	cost := downloadCost(size)
+	if recipient != nil {
+		// Sealing holds the plaintext and ciphertext a second time
+		cost *= 2
+	}
+	if passphrase != "" {
+		cost += crypto.DropKeyMemory
+	}
+	if !s.memory.Acquire(cost) {
+		s.metrics.RecordShed()
+		s.fail(w, html, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.memory.Release(cost)
+
+	// Risky formats go out as a static rendering. Its download counts as the
+	// read: a drop burned on retrieval is burned after it, original and all
+	var flatten *flattener
+	if s.flatteners != nil {
+		if meta, err := s.storage.GetDropMetadata(dropID); err == nil {
+			flatten = s.flattenerFor(r, meta, recipient)
+		}
+	}
 
-	// Sanitize filename
-	filename = filepath.Base(filename)
+	// Delete after retrieval if configured globally or by the drop's
+	// retention class, at once or when its resume window allows
+	burn := s.config().Security.DeleteAfterRetrieve || s.storage.BurnAfterRead(dropID)
+	if burn && s.resumes != nil && !s.resumes.open(dropID) {
+		s.burnDrop(dropID)
+		s.dropUnavailable(w, html, os.ErrNotExist)
+		return
+	}
+
+	_, span := s.tracer.Start(r.Context(), "storage.open")
+	span.SetAttr("storage.operation", "open")
+	span.SetAttr("storage.size_bucket", sizeBucket(size))
+	span.SetAttr("dead_drop.passphrase", passphrase != "")
+	span.SetAttr("dead_drop.sealed", recipient != nil)
+	payload, content, err := s.storage.OpenDropContent(dropID, passphrase)
+	if err != nil {
+		span.SetError(errorClass(err))
+	}
+	span.End()
+	if err != nil {
+		s.dropUnavailable(w, html, err)
+		return
+	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
-	w.Header().Set("Content-Type", "application/octet-stream")
+	if flatten != nil {
+		s.serveFlattened(w, r, html, dropID, flatten, payload, content, burn)
+		return
+	}
+	var reader io.ReadCloser = content
 
-	_, _ = io.Copy(w, reader)
+	// Sanitize filename
+	filename := filepath.Base(payload.Filename)
 
-	s.metrics.RecordDownload()
+	// A message travels with the file, as message.txt in a zip archive
+	contentType := s.servedContentType(payload.ContentType)
+	if payload.Message != "" {
+		filename, reader = bundleDrop(filename, payload.Message, reader)
+		contentType = s.servedContentType("application/zip")
+	}
+	defer reader.Close()
 
-	// Delete after retrieval if configured
-	if s.config.Security.DeleteAfterRetrieve {
-		if err := s.storage.DeleteDrop(dropID); err != nil {
-			if s.config.Logging.Errors {
-				// dropID is validated 32-char hex at this point
-				log.Printf("Failed to delete drop after retrieval: %v", err) // #nosec G706
+	ranged := recipient == nil && payload.Message == "" && (!burn || s.resumes != nil)
+	etag := `"` + content.Version + `"`
+	if ranged {
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", etag)
+	} else {
+		w.Header().Set("Accept-Ranges", "none")
+	}
+	// net/http only checks If-Range on GET, and /retrieve is a POST: a range
+	// of another version of the file gets the whole file instead
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != etag {
+		ranged = false
+	}
+
+	// The body is hashed as it streams and the digest follows it as a
+	// trailer, so that clients can verify the download without asking again.
+	// A download cut short, or a drop failing decryption, gets no trailer;
+	// nor does a range, which the client verifies once it has the whole file.
+	complete := false
+	switch {
+	case ranged && r.Header.Get("Range") != "":
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		complete = serveRanges(w, r, content)
+	case recipient != nil:
+		w.Header().Set("Trailer", integrityTrailer)
+		digest := sha256.New()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="drop.age"`)
+		if err := crypto.SealFile(recipient, filename, reader, io.MultiWriter(w, digest)); err != nil {
+			if errors.Is(err, storage.ErrHashMismatch) {
+				s.hashMismatch(dropID, r)
+				panic(http.ErrAbortHandler)
 			}
-		} else if s.config.Logging.Operations {
-			log.Printf("Drop deleted after retrieval") // #nosec G706
+			if s.config().Logging.Errors {
+				log.Printf("Failed to seal drop: %v", err)
+			}
+			return
+		}
+		w.Header().Set(integrityTrailer, hex.EncodeToString(digest.Sum(nil)))
+		complete = true
+	default:
+		w.Header().Set("Trailer", integrityTrailer)
+		digest := sha256.New()
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		_, err := io.Copy(io.MultiWriter(w, digest), reader)
+		if errors.Is(err, storage.ErrHashMismatch) {
+			// Kept for the operators to investigate, whatever the burn rule,
+			// and the connection broken so that no client takes the body
+			// for a complete file
+			s.hashMismatch(dropID, r)
+			panic(http.ErrAbortHandler)
 		}
+		if err == nil {
+			w.Header().Set(integrityTrailer, hex.EncodeToString(digest.Sum(nil)))
+			complete = true
+		}
+	}
+
+	s.metrics.RecordDownload()
+	s.metrics.ObserveDownloadSize(size)
+	if s.stats != nil {
+		s.stats.AddRetrieval(size)
+	}
+	_ = reader.Close()
+
+	// Within a resume window, a download cut short leaves the drop to be
+	// finished; otherwise it is burned as before
+	if burn && (complete || s.resumes == nil) {
+		s.burnDrop(dropID)
 	}
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+	"github.com/scttfrdmn/dead-drop/internal/textsanitize"
+)
+
+// messageFilename names the source's message inside a download bundle,
+// and a message sent without a file, which is stored as a drop of its own.
+const messageFilename = "message.txt"
+
+// messageContentType is recorded for a message stored as a drop.
+const messageContentType = "text/plain; charset=utf-8"
+
+// formMessage returns the message field of an upload, cleaned, and false
+// after answering the source if it is too long.
+func (s *Server) formMessage(w http.ResponseWriter, r *http.Request, html bool) (string, bool) {
+	message := r.FormValue("message")
+	if message == "" {
+		return "", true
+	}
+	if len(message) > storage.MaxMessageLen {
+		s.fail(w, html, "Message too long", http.StatusBadRequest)
+		return "", false
+	}
+	message = cleanMessage(message)
+	if s.config().Security.SanitizeText {
+		message, _ = textsanitize.Sanitize(message)
+	}
+	return message, true
+}
+
+// cleanMessage strips from a source's message the characters a reader
+// cannot see but that can carry a tracking mark (see
+// textsanitize.StripInvisible), and normalizes line endings.
+func cleanMessage(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s, _ = textsanitize.StripInvisible(s)
+	return strings.ReplaceAll(s, "\r", "")
+}
+
+// bundleDrop streams a drop that came with a message as a zip archive of
+// the file and message.txt, and returns the archive's name and contents.
+// Entries are stored uncompressed and carry no timestamps. data is closed
+// once archived; closing the returned reader early stops the archive.
+func bundleDrop(filename, message string, data io.ReadCloser) (string, io.ReadCloser) {
+	if filename == messageFilename {
+		filename = "file-" + filename
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer data.Close()
+		zw := zip.NewWriter(pw)
+		err := addToBundle(zw, messageFilename, strings.NewReader(message))
+		if err == nil {
+			err = addToBundle(zw, filename, data)
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return filename + ".zip", pr
+}
+
+func addToBundle(zw *zip.Writer, name string, r io.Reader) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
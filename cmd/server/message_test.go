@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func TestCleanMessage(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain text\nsecond line\ttab", "plain text\nsecond line\ttab"},
+		{"zero\u200bwidth\u200c\u200d\u2060marks", "zerowidthmarks"},
+		{"\ufeffbom and \u202eoverride\u202c", "bom and override"},
+		{"soft\u00adhyphen, tag\U000E0041s", "softhyphen, tags"},
+		{"windows\r\nline\x07ends", "windows\nlineends"},
+		{"bad \xff utf-8", "bad  utf-8"},
+	}
+	for _, tt := range tests {
+		if got := cleanMessage(tt.in); got != tt.want {
+			t.Errorf("cleanMessage(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSubmit_Message(t *testing.T) {
+	s := newTestServer(t)
+
+	body, ct := createMultipartForm(t, "memo.txt", []byte("the memo"), map[string]string{
+		"message": "Context for\u200b the memo",
+	})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retrieve status = %d", rec.Code)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "memo.txt.zip") {
+		t.Errorf("Content-Disposition = %q, want the archive", cd)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		got[f.Name] = string(data)
+	}
+	if got["message.txt"] != "Context for the memo" || got["memo.txt"] != "the memo" || len(got) != 2 {
+		t.Errorf("archive = %q", got)
+	}
+
+	// Over the cap, the upload is refused
+	body, ct = createMultipartForm(t, "memo.txt", []byte("the memo"), map[string]string{
+		"message": strings.Repeat("a", storage.MaxMessageLen+1),
+	})
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("oversized message: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestHandleSubmit_SanitizeText(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.SanitizeText = true
+
+	upload := "Quarterly rep\u043ert\nPrinted by jsmith on 2026-03-02\nFigures attached.\n"
+	body, ct := createMultipartForm(t, "memo.txt", []byte(upload), nil)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body)
+	}
+
+	meta, rc, err := s.storage.GetDropWithMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "Quarterly report\nFigures attached.\n" {
+		t.Errorf("stored %q", data)
+	}
+	if len(meta.Flags) != 1 || meta.Flags[0] != storage.FlagTextSanitized {
+		t.Errorf("flags = %v, want text_sanitized", meta.Flags)
+	}
+
+	// Client-encrypted uploads are left alone
+	body, ct = createMultipartForm(t, "memo.txt", []byte(upload), map[string]string{"client_encrypted": "true"})
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body)
+	}
+	_, rc, err = s.storage.GetDrop(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = io.ReadAll(rc)
+	rc.Close()
+	if string(data) != upload {
+		t.Errorf("client-encrypted upload changed to %q", data)
+	}
+}
+
+func TestHandleSubmit_MessageOnly(t *testing.T) {
+	s := newTestServer(t)
+
+	// A browser sends an empty file part when no file is chosen
+	form := func(message string) (*bytes.Buffer, string) {
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		if _, err := writer.CreateFormFile("file", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.WriteField("message", message); err != nil {
+			t.Fatal(err)
+		}
+		writer.Close()
+		return &buf, writer.FormDataContentType()
+	}
+
+	body, ct := form("# Tip\r\n\r\nThe audit was\u200b backdated.")
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body)
+	}
+
+	meta, rc, err := s.storage.GetDropWithMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "# Tip\n\nThe audit was backdated." {
+		t.Errorf("stored %q", data)
+	}
+	if meta.Filename != messageFilename || meta.Message != "" {
+		t.Errorf("filename %q, message %q: want the message stored as the file alone", meta.Filename, meta.Message)
+	}
+
+	// Served as the text itself, not a bundle
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, messageFilename) || strings.Contains(cd, ".zip") {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	for _, tc := range []struct {
+		name, message string
+	}{
+		{"no message", ""},
+		{"only invisible characters", "\u200b\u200d"},
+		{"oversized", strings.Repeat("a", storage.MaxMessageLen+1)},
+	} {
+		body, ct := form(tc.message)
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(body, ct))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tc.name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues client certificates for mTLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, cn string, serial int64) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestRequireClientCert(t *testing.T) {
+	s := newTestServer(t)
+	ca := newTestCA(t)
+
+	var seen string
+	ts := httptest.NewUnstartedServer(s.requireClientCert(func(w http.ResponseWriter, r *http.Request) {
+		seen = clientIdentity(r)
+	}))
+	ts.TLS = publicTLSConfig(ca.pool)
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(certs ...tls.Certificate) (*http.Response, error) {
+		// A fresh transport each time, so no connection is reused
+		transport := ts.Client().Transport.(*http.Transport).Clone()
+		transport.TLSClientConfig.Certificates = certs
+		return (&http.Client{Transport: transport}).Get(ts.URL)
+	}
+
+	// No certificate: the handshake succeeds but retrieval is refused
+	resp, err := get()
+	if err != nil {
+		t.Fatalf("request without certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("without certificate: status = %d, want 403", resp.StatusCode)
+	}
+
+	resp, err = get(ca.issue(t, "desk-1", 0x2a))
+	if err != nil {
+		t.Fatalf("request with certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("with certificate: status = %d, want 200", resp.StatusCode)
+	}
+	if seen != "CN=desk-1 serial=2a" {
+		t.Errorf("client identity = %q", seen)
+	}
+
+	// A certificate from another CA fails verification in the handshake
+	if resp, err = get(newTestCA(t).issue(t, "intruder", 1)); err == nil {
+		resp.Body.Close()
+		t.Error("certificate from an unknown CA should be rejected")
+	}
+}
+
+func TestAdminTLSConfig_RequiresClientCert(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	serverCert := ca.issue(t, "localhost", 2)
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := adminTLSConfig(certPath, keyPath, ca.pool)
+	if err != nil {
+		t.Fatalf("adminTLSConfig error: %v", err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs != ca.pool {
+		t.Error("admin listener must require and verify client certificates")
+	}
+
+	caPath := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadClientCAs(caPath); err != nil {
+		t.Errorf("loadClientCAs error: %v", err)
+	}
+	if _, err := loadClientCAs(keyPath); err == nil {
+		t.Error("loadClientCAs should reject a file without certificates")
+	}
+}
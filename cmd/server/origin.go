@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"time"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/monitoring"
+	"github.com/scttfrdmn/dead-drop/internal/torexit"
+)
+
+// requestOrigin classifies the connection's source address. Hidden service
+// traffic arrives from the local Tor daemon and so counts as loopback.
+func (s *Server) requestOrigin(r *http.Request) monitoring.Origin {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return monitoring.OriginClearnet
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return monitoring.OriginClearnet
+	}
+	switch {
+	case addr.Unmap().IsLoopback():
+		return monitoring.OriginLoopback
+	case s.exits != nil && s.exits.Contains(addr):
+		return monitoring.OriginTorExit
+	default:
+		return monitoring.OriginClearnet
+	}
+}
+
+// countOrigin records the coarse origin of each request. Only the aggregate
+// counter is kept; the address itself is discarded.
+func (s *Server) countOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.metrics.RecordOrigin(s.requestOrigin(r))
+		next(w, r)
+	}
+}
+
+// torExitClient returns the client used to download the exit list, dialing
+// through a SOCKS5 proxy (normally the local Tor daemon) when configured so
+// that the fetch does not reveal the server's clearnet address.
+func torExitClient(cfg config.TorExitsConfig) (*http.Client, error) {
+	transport := &http.Transport{}
+	if cfg.Proxy != "" {
+		dialer, err := proxy.SOCKS5("tcp", cfg.Proxy, nil, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		if cd, ok := dialer.(proxy.ContextDialer); ok {
+			transport.DialContext = cd.DialContext
+		}
+	}
+	return &http.Client{Transport: transport, Timeout: 2 * time.Minute}, nil
+}
+
+// exitListUsable reports whether the exit list can be trusted for
+// tor_exit_only: it must be non-empty and, when refreshing is configured,
+// updated within three refresh intervals.
+func (s *Server) exitListUsable() bool {
+	if s.exits == nil || s.exits.Len() == 0 {
+		return false
+	}
+	refresh := time.Duration(s.config().TorExits.RefreshHours) * time.Hour
+	return refresh == 0 || time.Since(s.exits.Updated()) <= 3*refresh
+}
+
+// torExitOnlyMiddleware admits only requests from known Tor exit relays, for
+// clearnet deployments that want Tor-origin traffic only. While the exit list
+// is unusable, requests are refused (fail closed) unless tor_exits.fail_open
+// is set.
+func (s *Server) torExitOnlyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.exitListUsable() {
+			if s.config().TorExits.FailOpen {
+				next(w, r)
+				return
+			}
+			http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if s.requestOrigin(r) != monitoring.OriginTorExit {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// loadTorExits returns the exit list from the on-disk cache if present,
+// otherwise the embedded snapshot.
+func loadTorExits(cfg config.TorExitsConfig) *torexit.List {
+	list := torexit.Embedded()
+	if cfg.CacheFile != "" {
+		if err := list.LoadFile(cfg.CacheFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("Ignoring Tor exit list cache: %v", err)
+		}
+	}
+	return list
+}
+
+// refreshTorExits refreshes the exit list now and then every interval until
+// stop is closed, saving each successful refresh to the cache file. Failed
+// refreshes keep the previous list.
+func (s *Server) refreshTorExits(client *http.Client, url string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		err := s.exits.Refresh(ctx, client, url)
+		cancel()
+		if err == nil && s.config().TorExits.CacheFile != "" {
+			err = s.exits.Save(s.config().TorExits.CacheFile)
+		}
+		if err != nil && s.config().Logging.Errors {
+			log.Printf("Tor exit list refresh failed: %v", err)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// torExitURL returns the configured exit list URL or the default.
+func torExitURL(cfg config.TorExitsConfig) string {
+	if cfg.URL != "" {
+		return cfg.URL
+	}
+	return torexit.DefaultURL
+}
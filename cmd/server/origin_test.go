@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/monitoring"
+	"github.com/scttfrdmn/dead-drop/internal/torexit"
+)
+
+func TestRequestOrigin(t *testing.T) {
+	s := newTestServer(t)
+	s.exits = &torexit.List{}
+	if err := s.exits.Load(strings.NewReader("185.220.101.1\n2001:db8::7\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		remote string
+		want   monitoring.Origin
+	}{
+		{"127.0.0.1:5555", monitoring.OriginLoopback},
+		{"[::1]:5555", monitoring.OriginLoopback},
+		{"185.220.101.1:443", monitoring.OriginTorExit},
+		{"[2001:db8::7]:443", monitoring.OriginTorExit},
+		{"198.51.100.4:80", monitoring.OriginClearnet},
+		{"garbage", monitoring.OriginClearnet},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remote
+		if got := s.requestOrigin(req); got != tt.want {
+			t.Errorf("requestOrigin(%s) = %d, want %d", tt.remote, got, tt.want)
+		}
+	}
+}
+
+func TestCountOrigin_RecordsAggregateOnly(t *testing.T) {
+	s := newTestServer(t)
+	s.exits = torexit.Embedded()
+
+	h := s.countOrigin(func(w http.ResponseWriter, r *http.Request) {})
+	for _, remote := range []string{"127.0.0.1:1", "127.0.0.1:2", "198.51.100.4:3"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		h(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	s.metrics.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, `dead_drop_requests_by_origin_total{origin="loopback"} 2`) ||
+		!strings.Contains(body, `dead_drop_requests_by_origin_total{origin="clearnet"} 1`) {
+		t.Errorf("unexpected origin counters:\n%s", body)
+	}
+	if strings.Contains(body, "198.51.100.4") {
+		t.Error("metrics must not contain addresses")
+	}
+}
+
+func TestTorExitOnlyMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	s.exits = &torexit.List{}
+	s.exits.Load(strings.NewReader("185.220.101.1\n"))
+
+	h := s.torExitOnlyMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	do := func(remote string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	if code := do("185.220.101.1:443"); code != http.StatusOK {
+		t.Errorf("exit relay: status = %d, want 200", code)
+	}
+	for _, remote := range []string{"198.51.100.4:80", "127.0.0.1:80"} {
+		if code := do(remote); code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", remote, code)
+		}
+	}
+}
+
+func TestTorExitOnlyMiddleware_UnusableList(t *testing.T) {
+	s := newTestServer(t)
+	s.config().TorExits.RefreshHours = 1
+	s.exits = &torexit.List{}
+	s.exits.Load(strings.NewReader("185.220.101.1\n"))
+
+	// Simulate a list that has not been refreshed for too long
+	path := filepath.Join(t.TempDir(), "exits.cache")
+	if err := s.exits.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-4 * time.Hour)
+	os.Chtimes(path, old, old)
+	s.exits = loadTorExits(config.TorExitsConfig{CacheFile: path})
+	if s.exitListUsable() {
+		t.Fatal("stale list should be unusable")
+	}
+
+	h := s.torExitOnlyMiddleware(func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "185.220.101.1:443"
+
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("fail closed: status = %d, want 503", rec.Code)
+	}
+
+	s.config().TorExits.FailOpen = true
+	req.RemoteAddr = "198.51.100.4:80"
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("fail open: status = %d, want 200", rec.Code)
+	}
+}
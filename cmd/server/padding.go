@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"net/http"
+)
+
+// padLength returns a random padding length in [0, security.response_padding].
+func (s *Server) padLength() int {
+	limit := s.config().Security.ResponsePadding
+	if limit <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(limit)+1))
+	if err != nil {
+		return limit
+	}
+	return int(n.Int64())
+}
+
+// writeJSON encodes v as a JSON object. With response padding enabled a
+// "padding" field of random-length whitespace is added, so the exact size of
+// a response does not tell a passive observer which outcome it carries.
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	data, err := s.encodeJSON(v)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data) // #nosec G705 -- JSON-encoded, served as application/json
+}
+
+// encodeJSON encodes v for writeJSON, with padding and a trailing newline.
+func (s *Server) encodeJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if n := s.padLength(); n > 0 && len(data) >= 2 && data[len(data)-1] == '}' {
+		sep := ","
+		if len(data) == 2 {
+			sep = ""
+		}
+		padded := make([]byte, 0, len(data)+len(sep)+n+14)
+		padded = append(padded, data[:len(data)-1]...)
+		padded = append(padded, sep+`"padding":"`...)
+		padded = append(padded, bytes.Repeat([]byte{' '}, n)...)
+		data = append(padded, `"}`...)
+	}
+	return append(data, '\n'), nil
+}
+
+// writeError is http.Error with response padding: random trailing whitespace
+// keeps plain-text failures from being told apart by length.
+func (s *Server) writeError(w http.ResponseWriter, message string, status int) {
+	http.Error(w, message+string(bytes.Repeat([]byte{' '}, s.padLength())), status)
+}
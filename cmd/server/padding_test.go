@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSON_Padding(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.ResponsePadding = 64
+
+	lengths := make(map[int]bool)
+	for i := 0; i < 50; i++ {
+		rec := httptest.NewRecorder()
+		s.writeJSON(rec, map[string]string{"drop_id": "abc"})
+
+		var resp map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+		}
+		if resp["drop_id"] != "abc" {
+			t.Errorf("drop_id = %q, want abc", resp["drop_id"])
+		}
+		if len(resp["padding"]) > 64 || strings.TrimSpace(resp["padding"]) != "" {
+			t.Errorf("padding = %q, want up to 64 spaces", resp["padding"])
+		}
+		lengths[rec.Body.Len()] = true
+	}
+	if len(lengths) < 2 {
+		t.Error("response length should vary with padding enabled")
+	}
+}
+
+func TestWriteJSON_NoPaddingByDefault(t *testing.T) {
+	s := newTestServer(t)
+	rec := httptest.NewRecorder()
+	s.writeJSON(rec, map[string]string{"drop_id": "abc"})
+	if got := rec.Body.String(); got != "{\"drop_id\":\"abc\"}\n" {
+		t.Errorf("body = %q", got)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestWriteError_Padding(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.ResponsePadding = 32
+	rec := httptest.NewRecorder()
+	s.fail(rec, false, "Invalid file upload", http.StatusBadRequest)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != "Invalid file upload" {
+		t.Errorf("body = %q", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+// pageTemplates are the server-rendered pages: the landing page and the
+// result pages of the no-JavaScript form flow (e.g., Tor Browser on the
+// "Safest" security level).
+var pageTemplates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// indexPage is the landing page with the upload and retrieve forms.
+type indexPage struct {
+	BasePath    string
+	CSRFToken   string
+	MaxUploadMB int64
+	Paused      bool
+	Campaign    string   // known campaign code from the call-to-action link
+	Retention   []string // retention classes the source may choose
+	QRReceipt   bool     // the source may take the receipt as a QR code
+	EnvelopeKey string   // base64 key to seal uploads to, if enabled
+	MaxExpires  int      // longest expiry in hours the source may choose; 0 = none
+
+	RecipientKey         string // receivers' age recipient to seal files to, if published
+	RecipientFingerprint string
+	PoWURL               string // proof-of-work challenge endpoint, if rate_limit_mode is pow
+}
+
+// resultPage is rendered after a successful HTML form submission.
+type resultPage struct {
+	BasePath      string
+	DropID        string
+	Receipt       string
+	ReceiptURL    string // QR code of the receipt, instead of Receipt
+	SealedReceipt string // receipt sealed to the source's key, instead of Receipt
+	FileHash      string
+	ExpiresHours  string // the expiry the source chose, after any shortening
+	Passphrase    bool   // retrieval also needs the source's passphrase
+	Advisory      string // e.g. that the same file was already received
+}
+
+// errorPage is rendered when an HTML form submission or retrieval fails.
+type errorPage struct {
+	BasePath string
+	Title    string
+	Message  string
+}
+
+// acceptsHTML reports whether the client navigated here with a plain HTML
+// form rather than fetch() or a CLI client, which do not ask for text/html.
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// crossSiteForm reports whether fetch metadata or the Origin header show that
+// a form post came from another site. Browsers that send neither are left to
+// the CSRF token check.
+func crossSiteForm(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "cross-site", "same-site":
+		return true
+	case "same-origin":
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+// renderPage writes the named template with the given status code.
+func (s *Server) renderPage(w http.ResponseWriter, status int, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.pages().ExecuteTemplate(w, name, data); err != nil && s.config().Logging.Errors {
+		log.Printf("Failed to render %s: %v", name, err)
+	}
+}
+
+// fail reports an error as an HTML page for form clients and as plain text
+// otherwise. The message must already be generic.
+func (s *Server) fail(w http.ResponseWriter, html bool, message string, status int) {
+	if !html {
+		s.writeError(w, message, status)
+		return
+	}
+	s.renderPage(w, status, "error.html", errorPage{
+		BasePath: s.basePath,
+		Title:    http.StatusText(status),
+		Message:  message,
+	})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// htmlSubmitRequest builds a plain browser form post carrying token in both
+// the cookie and the hidden form field, as the no-JavaScript page does.
+func htmlSubmitRequest(t *testing.T, content []byte, token string) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.WriteField(csrfFieldName, token); err != nil {
+		t.Fatal(err)
+	}
+	part, err := writer.CreateFormFile("file", "test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/submit", &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+	return req
+}
+
+func issueTestToken(t *testing.T, s *Server) string {
+	t.Helper()
+	token, err := s.csrf.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestHandleIndex_EmbedsCSRFToken(t *testing.T) {
+	s := newTestServer(t)
+	rec := httptest.NewRecorder()
+
+	s.handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookieName {
+		t.Fatalf("expected %s cookie, got %v", csrfCookieName, cookies)
+	}
+	c := cookies[0]
+	if !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+		t.Error("CSRF cookie should be HttpOnly and SameSite=Strict")
+	}
+	if !strings.Contains(rec.Body.String(), `value="`+c.Value+`"`) {
+		t.Error("page should embed the cookie token in the form")
+	}
+}
+
+func TestHandleSubmit_HTMLForm(t *testing.T) {
+	s := newTestServer(t)
+	req := htmlSubmitRequest(t, []byte("no javascript here"), issueTestToken(t, s))
+	rec := httptest.NewRecorder()
+
+	s.handleSubmit(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "Submission Successful") {
+		t.Error("result page should confirm the submission")
+	}
+	if strings.Contains(body, "<script") {
+		t.Error("result page must not depend on JavaScript")
+	}
+}
+
+func TestHandleSubmit_HTMLFormSameOrigin(t *testing.T) {
+	s := newTestServer(t)
+	req := htmlSubmitRequest(t, []byte("data"), issueTestToken(t, s))
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+	req.Header.Set("Origin", "http://"+req.Host)
+	rec := httptest.NewRecorder()
+
+	s.handleSubmit(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestHandleSubmit_HTMLFormCrossSite(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+	}{
+		{"cross-site fetch metadata", map[string]string{"Sec-Fetch-Site": "cross-site"}},
+		{"same-site fetch metadata", map[string]string{"Sec-Fetch-Site": "same-site"}},
+		{"foreign origin", map[string]string{"Origin": "http://evil.example"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			req := htmlSubmitRequest(t, []byte("data"), issueTestToken(t, s))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			s.handleSubmit(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandleSubmit_HTMLFormBadToken(t *testing.T) {
+	s := newTestServer(t)
+	other, err := newCSRFTokens(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := other.Issue()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("no cookie", func(t *testing.T) {
+		body, contentType := createMultipartForm(t, "test.txt", []byte("data"),
+			map[string]string{csrfFieldName: issueTestToken(t, s)})
+		req := httptest.NewRequest(http.MethodPost, "/submit", body)
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+
+		s.handleSubmit(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("cookie and field differ", func(t *testing.T) {
+		req := htmlSubmitRequest(t, []byte("data"), issueTestToken(t, s))
+		req.Header.Del("Cookie")
+		req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: issueTestToken(t, s)})
+		rec := httptest.NewRecorder()
+
+		s.handleSubmit(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+	})
+
+	t.Run("issued by another key", func(t *testing.T) {
+		req := htmlSubmitRequest(t, []byte("data"), foreign)
+		rec := httptest.NewRecorder()
+
+		s.handleSubmit(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "reload the page") {
+			t.Error("error page should tell the user to reload")
+		}
+	})
+}
+
+func TestHandleSubmit_HTMLFormValidationError(t *testing.T) {
+	s := newTestServer(t)
+	elf := append([]byte{0x7F, 0x45, 0x4C, 0x46}, make([]byte, 96)...)
+	req := htmlSubmitRequest(t, elf, issueTestToken(t, s))
+	rec := httptest.NewRecorder()
+
+	s.handleSubmit(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "Invalid file upload") {
+		t.Error("error page should carry the generic message")
+	}
+	if !strings.Contains(rec.Body.String(), `href="/"`) {
+		t.Error("error page should link back to the form")
+	}
+}
+
+func TestHandleRetrieve_HTMLError(t *testing.T) {
+	s := newTestServer(t)
+	req := retrieveRequest(t, strings.Repeat("a", 32), "bogus")
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+
+	s.handleRetrieve(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+}
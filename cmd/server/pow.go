@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/scttfrdmn/dead-drop/internal/monitoring"
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+)
+
+// powChallengeResponse is returned by /api/v1/pow-challenge, also served as
+// /challenge. The solution is a decimal number such that
+// SHA-256(challenge ":" solution) starts with difficulty zero bits; the
+// token, challenge ":" solution, goes in the X-Dead-Drop-PoW header of one
+// rate-limited request.
+type powChallengeResponse struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresIn  int    `json:"expires_in"` // seconds
+}
+
+// handlePoWChallenge issues a proof-of-work challenge, for
+// security.rate_limit_mode pow. Issuing one is free and keeps no state, so
+// the endpoint is not rate limited itself.
+func (s *Server) handlePoWChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	challenge, difficulty, err := s.pow.Challenge()
+	if err != nil {
+		if s.config().Logging.Errors {
+			log.Printf("Failed to issue proof-of-work challenge: %v", err)
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, powChallengeResponse{
+		Challenge:  challenge,
+		Difficulty: difficulty,
+		ExpiresIn:  int(ratelimit.PoWChallengeTTL.Seconds()),
+	})
+}
+
+// powApplies reports whether a request is budgeted by proof of work: it
+// came through the hidden service, whose clients all share the local Tor
+// daemon's address.
+func (s *Server) powApplies(r *http.Request) bool {
+	return s.requestOrigin(r) == monitoring.OriginLoopback
+}
+
+// powURL returns the challenge endpoint r's client fetches tokens from, or
+// "" when proof of work is off or does not apply to it.
+func (s *Server) powURL(r *http.Request) string {
+	if s.pow == nil || !s.powApplies(r) {
+		return ""
+	}
+	return s.basePath + "/api/v1/pow-challenge"
+}
+
+// requirePoW refuses a hidden service request that carries no
+// proof-of-work token, for security.pow_required, where the rate limiter
+// would count it against the Tor daemon's shared allowance instead. The
+// limiter still checks the tokens that are sent.
+func (s *Server) requirePoW(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.pow != nil && s.config().Security.PoWRequired && s.powApplies(r) && r.Header.Get(ratelimit.PoWHeader) == "" {
+			http.Error(w, "Proof of work required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+)
+
+func TestHandlePoWChallenge(t *testing.T) {
+	s := newTestServer(t)
+	var err error
+	if s.pow, err = ratelimit.NewPoW(8, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handlePoWChallenge(rec, httptest.NewRequest(http.MethodGet, "/api/v1/pow-challenge", nil))
+	var resp powChallengeResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if resp.Difficulty != 8 || resp.ExpiresIn != int(ratelimit.PoWChallengeTTL.Seconds()) {
+		t.Errorf("difficulty %d, expires_in %d", resp.Difficulty, resp.ExpiresIn)
+	}
+	if err := s.pow.Spend(resp.Challenge + ":" + ratelimit.Solve(resp.Challenge, resp.Difficulty)); err != nil {
+		t.Errorf("solved challenge not accepted: %v", err)
+	}
+}
+
+func TestPoWURL_HiddenServiceOnly(t *testing.T) {
+	s := newTestServer(t)
+	onion := httptest.NewRequest(http.MethodGet, "/", nil)
+	onion.RemoteAddr = "127.0.0.1:40000"
+	if s.powURL(onion) != "" {
+		t.Error("challenge endpoint advertised with proof of work off")
+	}
+
+	var err error
+	if s.pow, err = ratelimit.NewPoW(8, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.handleIndex(rec, onion)
+	if !strings.Contains(rec.Body.String(), `data-pow-url="/api/v1/pow-challenge"`) {
+		t.Error("index page over the hidden service does not ask for proof of work")
+	}
+
+	// Clearnet clients have addresses of their own to be limited by
+	rec = httptest.NewRecorder()
+	s.handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Contains(rec.Body.String(), "data-pow-url") {
+		t.Error("index page asks clearnet clients for proof of work")
+	}
+}
+
+func TestRequirePoW_HiddenServiceSubmissions(t *testing.T) {
+	s := newTestServer(t)
+	var err error
+	if s.pow, err = ratelimit.NewPoW(8, 10, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	h := s.requirePoW(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	post := func(addr, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/submit", nil)
+		req.RemoteAddr = addr
+		if token != "" {
+			req.Header.Set(ratelimit.PoWHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec.Code
+	}
+
+	// Off by default: tokenless requests fall through to the limiter
+	if code := post("127.0.0.1:40000", ""); code != http.StatusNoContent {
+		t.Errorf("pow_required off: status %d", code)
+	}
+
+	cfg := *s.config()
+	cfg.Security.PoWRequired = true
+	s.cfg.Store(&cfg)
+	if code := post("127.0.0.1:40000", ""); code != http.StatusForbidden {
+		t.Errorf("tokenless hidden service submission: status %d, want 403", code)
+	}
+	if code := post("127.0.0.1:40000", "challenge:1"); code != http.StatusNoContent {
+		t.Errorf("submission with a token not passed on to the limiter: status %d", code)
+	}
+	if code := post("192.0.2.1:40000", ""); code != http.StatusNoContent {
+		t.Errorf("clearnet submission refused: status %d", code)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder for previews
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder for previews
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+const (
+	// maxPreviewBytes bounds the drops previewed, since the whole image is
+	// read before decoding.
+	maxPreviewBytes = 20 << 20
+	// maxPreviewPixels bounds the decoded image, so that a small file
+	// declaring huge dimensions cannot exhaust memory.
+	maxPreviewPixels = 4096 * 4096
+	// previewSize is the longest side of a preview in pixels.
+	previewSize    = 512
+	previewQuality = 80
+)
+
+// previewPolicy confines a preview opened directly in a browser: no
+// scripts, no subresources, no same-origin access.
+const previewPolicy = "default-src 'none'; sandbox"
+
+var (
+	// errNoPreview is returned for drops that are not a previewable image.
+	errNoPreview = errors.New("no preview for this drop")
+	// errServerBusy is returned when the memory budget cannot cover a decode.
+	errServerBusy = errors.New("memory budget exhausted")
+)
+
+// handlePreview serves, for a drop ID and receipt sent in a POST body or
+// headers, a small JPEG re-encoded from the drop's pixels, so receivers can
+// triage images without downloading originals. Re-encoding carries no
+// metadata over, whatever the original held. The drop is not burned. PDFs
+// get no preview: rendering a page takes a PDF rasterizer, a large parser
+// of untrusted input the server does not carry.
+func (s *Server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropID, ok := s.retrievalCredentials(w, r, false)
+	if !ok {
+		return
+	}
+	size, err := s.storage.StoredSize(dropID)
+	if err != nil {
+		s.dropUnavailable(w, false, err)
+		return
+	}
+	if size > crypto.EncryptedSize(maxPreviewBytes) {
+		s.fail(w, false, "No preview for this drop", http.StatusUnsupportedMediaType)
+		return
+	}
+	if !s.memory.Acquire(size) {
+		s.metrics.RecordShed()
+		s.fail(w, false, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.memory.Release(size)
+
+	payload, reader, err := s.storage.GetDropWithMetadata(dropID)
+	if err != nil {
+		s.dropUnavailable(w, false, err)
+		return
+	}
+	defer reader.Close()
+	if payload.ClientEncrypted {
+		s.fail(w, false, "No preview for this drop", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxPreviewBytes))
+	if err != nil {
+		s.fail(w, false, "Drop not found", http.StatusNotFound)
+		return
+	}
+	defer crypto.ZeroBytes(data)
+
+	preview, err := s.renderPreview(data)
+	switch {
+	case errors.Is(err, errNoPreview):
+		s.fail(w, false, "No preview for this drop", http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, errServerBusy):
+		s.metrics.RecordShed()
+		s.fail(w, false, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		if s.config().Logging.Errors {
+			log.Printf("Failed to render preview: %v", err)
+		}
+		s.fail(w, false, "No preview for this drop", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Disposition", `inline; filename="preview.jpg"`)
+	w.Header().Set("Content-Security-Policy", previewPolicy)
+	w.Header().Set("Cross-Origin-Resource-Policy", "same-origin")
+	_, _ = w.Write(preview)
+}
+
+// renderPreview decodes a JPEG, PNG or GIF (its first frame) and returns it
+// scaled to fit previewSize, as a JPEG.
+func (s *Server) renderPreview(data []byte) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNoPreview
+	}
+	pixels := int64(cfg.Width) * int64(cfg.Height)
+	if format != "jpeg" && format != "png" && format != "gif" || pixels == 0 || pixels > maxPreviewPixels {
+		return nil, errNoPreview
+	}
+
+	// The decoded image and its RGBA copy
+	cost := pixels * 8
+	if !s.memory.Acquire(cost) {
+		return nil, errServerBusy
+	}
+	defer s.memory.Release(cost)
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, thumbnail(src, previewSize), &jpeg.Options{Quality: previewQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// thumbnail scales src down to fit in a limit×limit square, averaging the
+// source pixels behind each output pixel. Smaller images keep their size.
+// Transparent areas become white, as JPEG has no alpha.
+func thumbnail(src image.Image, limit int) *image.RGBA {
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Over)
+
+	w, h := b.Dx(), b.Dy()
+	if w <= limit && h <= limit {
+		return rgba
+	}
+	tw, th := limit, max(h*limit/w, 1)
+	if h > w {
+		tw, th = max(w*limit/h, 1), limit
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0 := y * h / th
+		y1 := max((y+1)*h/th, y0+1)
+		for x := 0; x < tw; x++ {
+			x0 := x * w / tw
+			x1 := max((x+1)*w/tw, x0+1)
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride+x0*4 : sy*rgba.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+			n := (y1 - y0) * (x1 - x0)
+			o := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[o+c] = uint8(sum[c] / n) // #nosec G115 -- average of bytes
+			}
+		}
+	}
+	return dst
+}
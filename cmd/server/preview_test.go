@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func previewRequest(t *testing.T, dropID, receipt string) *http.Request {
+	t.Helper()
+	req := retrieveRequest(t, dropID, receipt)
+	req.URL.Path = "/api/v1/preview"
+	return req
+}
+
+func TestHandlePreview_Image(t *testing.T) {
+	s := newTestServer(t)
+
+	img := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(10, 10, color.NRGBA{R: 0xff, A: 0xff})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	drop, err := s.storage.SaveDrop("photo.png", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handlePreview(rec, previewRequest(t, drop.ID, drop.Receipt))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); csp != previewPolicy {
+		t.Errorf("Content-Security-Policy = %q", csp)
+	}
+	preview, err := jpeg.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("preview is not a JPEG: %v", err)
+	}
+	if b := preview.Bounds(); b.Dx() != previewSize || b.Dy() != previewSize/2 {
+		t.Errorf("preview is %dx%d, want %dx%d", b.Dx(), b.Dy(), previewSize, previewSize/2)
+	}
+
+	// Previews do not burn or otherwise touch the drop
+	if _, err := s.storage.StoredSize(drop.ID); err != nil {
+		t.Errorf("drop gone after preview: %v", err)
+	}
+}
+
+func TestHandlePreview_Refused(t *testing.T) {
+	s := newTestServer(t)
+
+	text, err := s.storage.SaveDrop("notes.txt", bytes.NewReader([]byte("not an image")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.handlePreview(rec, previewRequest(t, text.ID, text.Receipt))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("text drop: status = %d, want 415", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handlePreview(rec, previewRequest(t, text.ID, "wrong"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("wrong receipt: status = %d, want 403", rec.Code)
+	}
+
+	// A tiny PNG declaring 100000x100000 pixels is refused before decoding
+	bomb, err := s.storage.SaveDrop("bomb.png", bytes.NewReader(pngHeader(100000, 100000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	s.handlePreview(rec, previewRequest(t, bomb.ID, bomb.Receipt))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("oversized image: status = %d, want 415", rec.Code)
+	}
+}
+
+// pngHeader returns a PNG signature and IHDR chunk declaring the given
+// dimensions, with no image data.
+func pngHeader(width, height uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	out := []byte("\x89PNG\r\n\x1a\n")
+	out = binary.BigEndian.AppendUint32(out, uint32(len(ihdr)-4))
+	out = append(out, ihdr...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(ihdr))
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/scttfrdmn/dead-drop/internal/canary"
+	"github.com/scttfrdmn/dead-drop/internal/metadata"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+	"github.com/scttfrdmn/dead-drop/internal/textsanitize"
+	"github.com/scttfrdmn/dead-drop/internal/validation"
+)
+
+// errUndeclaredOpaque rejects an upload that looks encrypted but was not
+// declared client-encrypted, when security.entropy_check is "reject".
+var errUndeclaredOpaque = errors.New("undeclared high-entropy upload")
+
+// inspectUpload runs the checks on an upload: validation, entropy analysis
+// and canary matching, then text sanitization and scrubbing if configured.
+// It records flags, the canary and the scrub profile in opts and returns the
+// contents to store, which stream from the scrubber until closed, and the
+// canary match, if any.
+func (s *Server) inspectUpload(ctx context.Context, filename string, file io.Reader, opts *storage.SaveOptions) (io.ReadCloser, *canary.Match, error) {
+	fileData, err := s.validator().ValidateFileContext(ctx, filename, file)
+	if err != nil {
+		if s.config().Logging.Errors {
+			log.Printf("Validation failed: %v", err)
+		}
+		return nil, nil, err
+	}
+
+	// Entropy analysis: opaque blobs that were not declared as client-encrypted
+	// are flagged in metadata or rejected, depending on policy
+	if s.config().Security.EntropyCheck != "" && !opts.ClientEncrypted &&
+		validation.LooksOpaque(fileData, s.config().Security.EntropyThreshold) {
+		if s.config().Security.EntropyCheck == "reject" {
+			if s.config().Logging.Errors {
+				log.Printf("Rejected undeclared high-entropy upload")
+			}
+			return nil, nil, errUndeclaredOpaque
+		}
+		opts.Flags = append(opts.Flags, storage.FlagHighEntropy)
+	}
+
+	// Canary documents are matched before scrubbing, which could strip a
+	// watermark. A match is stored as usual but flagged, and alerted on.
+	var match *canary.Match
+	if s.canaries != nil {
+		match, err = s.canaries.Match(fileData)
+		if err != nil && s.config().Logging.Errors {
+			log.Printf("Canary check failed: %v", err)
+		}
+		if match != nil {
+			opts.Flags = append(opts.Flags, storage.FlagCanary)
+			opts.Canary = match.Name
+		}
+	}
+
+	// Plain text is sanitized after canary matching, for the same reason
+	if s.config().Security.SanitizeText && !opts.ClientEncrypted && isPlainText(fileData) {
+		if clean, report := textsanitize.Sanitize(string(fileData)); report.Changed() {
+			fileData = []byte(clean)
+			opts.Flags = append(opts.Flags, storage.FlagTextSanitized)
+		}
+	}
+
+	// Optionally scrub metadata (deprecated: prefer client-side). The scrubber
+	// streams into storage rather than materializing a second copy of the file.
+	if !s.config().Security.ScrubMetadata {
+		return io.NopCloser(bytes.NewReader(fileData)), match, nil
+	}
+	if s.scrubber.Handles(filename) {
+		opts.Scrubbed = "standard"
+		if s.config().Scrubbers.StrictJPEG {
+			opts.Scrubbed = "strict"
+		}
+	}
+	return s.scrubber.ScrubReaderContext(ctx, filename, bytes.NewReader(fileData)), match, nil
+}
+
+// isPlainText reports whether data is UTF-8 text with no structure to
+// preserve.
+func isPlainText(data []byte) bool {
+	return strings.HasPrefix(http.DetectContentType(data), "text/plain") && utf8.Valid(data)
+}
+
+// Defaults for processing.workers and processing.queue_size.
+const (
+	defaultProcessingWorkers = 2
+	defaultProcessingQueue   = 100
+)
+
+// processingJob is a drop saved as received, waiting for inspectUpload.
+type processingJob struct {
+	dropID string
+	origin string // coarse origin of the upload, for canary incidents; "" once requeued
+}
+
+// processingQueue feeds drops saved with storage.SaveOptions.Pending to the
+// workers that check and scrub them. The queue itself is not persistent:
+// pending drops are marked in their metadata and queued again at startup
+// and after unlock.
+type processingQueue struct {
+	jobs chan processingJob
+}
+
+// newProcessingQueue creates the queue of processing.queue_size jobs.
+func newProcessingQueue(size int) *processingQueue {
+	if size <= 0 {
+		size = defaultProcessingQueue
+	}
+	return &processingQueue{jobs: make(chan processingJob, size)}
+}
+
+// add queues a job, reporting false if the queue is full.
+func (q *processingQueue) add(job processingJob) bool {
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// startProcessing runs the processing workers until stop is closed, and
+// returns a function that waits for them to finish the drops in hand.
+func (s *Server) startProcessing(workers int, stop <-chan struct{}) func() {
+	if workers <= 0 {
+		workers = defaultProcessingWorkers
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for {
+				select {
+				case job := <-s.processing.jobs:
+					s.processDrop(job)
+				case <-stop:
+					return
+				}
+			}
+		})
+	}
+	return wg.Wait
+}
+
+// requeuePending queues every drop still waiting for processing, as after a
+// restart. It waits for room in the queue, so it should run in its own
+// goroutine; drops queued twice are processed once.
+func (s *Server) requeuePending() {
+	ids, err := s.storage.PendingDrops()
+	if err != nil {
+		if s.config().Logging.Errors {
+			log.Printf("Failed to list drops waiting for processing: %v", err)
+		}
+		return
+	}
+	for _, id := range ids {
+		s.processing.jobs <- processingJob{dropID: id}
+	}
+	if len(ids) > 0 && s.config().Logging.Operations {
+		log.Printf("Queued %d drops waiting for processing", len(ids))
+	}
+}
+
+// processDrop checks and scrubs a pending drop. A drop that fails is moved
+// into quarantine, and receivers are told.
+// One that cannot be read (storage locked) stays pending for requeuePending.
+func (s *Server) processDrop(job processingJob) {
+	payload, data, err := s.storage.GetPendingDrop(job.dropID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotPending) && !errors.Is(err, storage.ErrLocked) && s.config().Logging.Errors {
+			log.Printf("Failed to read drop for processing: %v", err)
+		}
+		return
+	}
+	defer data.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.parseTimeout())
+	defer cancel()
+
+	opts := &storage.SaveOptions{ClientEncrypted: payload.ClientEncrypted}
+	reader, match, err := s.inspectUpload(ctx, payload.Filename, data, opts)
+	if err != nil {
+		_ = data.Close() // before the drop moves into quarantine
+		s.failProcessing(job.dropID, payload.Campaign, err)
+		return
+	}
+	err = s.storage.CompleteProcessing(job.dropID, reader, opts)
+	reader.Close()
+	switch {
+	case err == nil:
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, metadata.ErrInvalidFile):
+		// The scrubber fails while CompleteProcessing reads from it
+		s.failProcessing(job.dropID, payload.Campaign, err)
+		return
+	case errors.Is(err, storage.ErrLocked) || errors.Is(err, storage.ErrNotPending):
+		return
+	default:
+		// Left pending, to be tried again after a restart
+		if s.config().Logging.Errors {
+			log.Printf("Failed to save processed drop: %v", err)
+		}
+		return
+	}
+
+	if s.config().Logging.Operations {
+		log.Printf("Drop processed: %s", job.dropID) // #nosec G706 -- drop ID is validated hex
+	}
+	if s.notifier != nil {
+		s.notifier.NewDrop(payload.Campaign)
+	}
+	if match != nil {
+		s.canaryAlert(job.dropID, match, job.origin)
+	}
+}
+
+// failProcessing quarantines a drop that failed its checks and tells
+// receivers. Only the kind of failure is recorded as the reason, not the
+// error, which may quote the file.
+func (s *Server) failProcessing(dropID, campaign string, cause error) {
+	reason := "invalid_file"
+	switch {
+	case errors.Is(cause, errUndeclaredOpaque):
+		reason = "undeclared_encryption"
+	case errors.Is(cause, context.DeadlineExceeded):
+		reason = "timeout"
+	}
+	if s.config().Logging.Errors {
+		log.Printf("Drop %s failed processing, quarantining: %v", dropID, cause) // #nosec G706 -- drop ID is validated hex
+	}
+	if err := s.storage.FailProcessing(dropID, reason); err != nil {
+		if s.config().Logging.Errors {
+			log.Printf("Failed to quarantine drop %s: %v", dropID, err) // #nosec G706 -- drop ID is validated hex
+		}
+		return
+	}
+	if s.notifier != nil {
+		s.notifier.ProcessingFailed(campaign)
+	}
+}
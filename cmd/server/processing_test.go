@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// submitAsync uploads a file to s with asynchronous processing on and
+// returns the response fields.
+func submitAsync(t *testing.T, s *Server, filename string, content []byte) map[string]string {
+	t.Helper()
+	body, ct := createMultipartForm(t, filename, content, nil)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("submit status = %d: %s", rec.Code, rec.Body)
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// runQueued processes the jobs waiting in s's queue.
+func runQueued(s *Server) {
+	for len(s.processing.jobs) > 0 {
+		s.processDrop(<-s.processing.jobs)
+	}
+}
+
+func TestHandleSubmit_Async(t *testing.T) {
+	s := newTestServer(t)
+	s.processing = newProcessingQueue(1)
+
+	resp := submitAsync(t, s, "memo.txt", []byte("queued memo"))
+	if resp["receipt"] == "" {
+		t.Fatal("no receipt for a queued upload")
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("retrieve before processing: status = %d, want 503", rec.Code)
+	}
+
+	// A full queue refuses the upload rather than leaving it unprocessed
+	body, ct := createMultipartForm(t, "other.txt", []byte("other"), nil)
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("full queue: status = %d, want 503", rec.Code)
+	}
+
+	runQueued(s)
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusOK || rec.Body.String() != "queued memo" {
+		t.Errorf("retrieve after processing = %d %q", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleSubmit_AsyncFailure(t *testing.T) {
+	s := newTestServer(t)
+	s.processing = newProcessingQueue(0)
+	s.config().Security.EntropyCheck = "reject"
+
+	// Accepted at once; the entropy check fails in the worker
+	resp := submitAsync(t, s, "blob.bin", randomBlob(t, 32*1024))
+	runQueued(s)
+
+	info, err := s.storage.Inspect(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Processing != storage.ProcessingFailed || info.Quarantine != "undeclared_encryption" {
+		t.Errorf("processing = %q, quarantine = %q", info.Processing, info.Quarantine)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("retrieve failed drop: status = %d, want 403", rec.Code)
+	}
+}
+
+func TestRequeuePending(t *testing.T) {
+	s := newTestServer(t)
+	s.processing = newProcessingQueue(0)
+	resp := submitAsync(t, s, "memo.txt", []byte("left by a restart"))
+
+	// A restarted server has an empty queue
+	s.processing = newProcessingQueue(0)
+	s.requeuePending()
+	runQueued(s)
+
+	if _, _, err := s.storage.GetDrop(resp["drop_id"]); err != nil {
+		t.Errorf("GetDrop after requeue error: %v", err)
+	}
+}
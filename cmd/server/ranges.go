@@ -0,0 +1,153 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// resumeWindows tracks the burn-after-read drops a download has started on,
+// under security.resume_window_minutes. Such a drop can be fetched, whole
+// or in ranges, until the window that opened with its first retrieval
+// closes, and is deleted once a response has carried its last byte or the
+// window has closed, whichever comes first. Windows are kept in memory: a
+// restart leaves the drops they covered to be retrieved afresh.
+type resumeWindows struct {
+	mu        sync.Mutex
+	deadlines map[string]time.Time
+	window    time.Duration
+	now       func() time.Time
+}
+
+func newResumeWindows(window time.Duration) *resumeWindows {
+	return &resumeWindows{
+		deadlines: make(map[string]time.Time),
+		window:    window,
+		now:       time.Now,
+	}
+}
+
+// open reports whether dropID may still be served, opening its window if
+// this is its first retrieval.
+func (rw *resumeWindows) open(dropID string) bool {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	deadline, ok := rw.deadlines[dropID]
+	if !ok {
+		rw.deadlines[dropID] = rw.now().Add(rw.window)
+		return true
+	}
+	return rw.now().Before(deadline)
+}
+
+// close forgets the window of a drop that has been deleted.
+func (rw *resumeWindows) close(dropID string) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	delete(rw.deadlines, dropID)
+}
+
+// expired removes and returns the drops whose window has closed.
+func (rw *resumeWindows) expired() []string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	now := rw.now()
+	var ids []string
+	for id, deadline := range rw.deadlines {
+		if !now.Before(deadline) {
+			delete(rw.deadlines, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// burnExpiredWindows deletes the drops whose resume window has closed,
+// every interval until stop is closed.
+func (s *Server) burnExpiredWindows(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, id := range s.resumes.expired() {
+				s.burnDrop(id)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// burnDrop deletes a drop after retrieval.
+func (s *Server) burnDrop(dropID string) {
+	if s.resumes != nil {
+		s.resumes.close(dropID)
+	}
+	if err := s.storage.DeleteDrop(dropID); err != nil {
+		if s.config().Logging.Errors {
+			// dropID is validated 32-char hex at this point
+			log.Printf("Failed to delete drop after retrieval: %v", err) // #nosec G706
+		}
+	} else if s.config().Logging.Operations {
+		log.Printf("Drop deleted after retrieval") // #nosec G706
+	}
+}
+
+// serveRanges answers a Range request from content, and reports whether
+// the response carried the last byte of the file.
+func serveRanges(w http.ResponseWriter, r *http.Request, content io.ReadSeeker) bool {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		http.Error(w, "Failed to read drop", http.StatusInternalServerError)
+		return false
+	}
+	tracked := &endTracker{ReadSeeker: content, size: size}
+	out := &writeTracker{ResponseWriter: w}
+	http.ServeContent(out, r, "", time.Time{}, tracked)
+	return tracked.end && out.err == nil
+}
+
+// endTracker notes whether the last byte of a file of size bytes was read.
+type endTracker struct {
+	io.ReadSeeker
+	size int64
+	pos  int64
+	end  bool
+}
+
+func (e *endTracker) Read(p []byte) (int, error) {
+	n, err := e.ReadSeeker.Read(p)
+	e.pos += int64(n)
+	if n > 0 && e.pos >= e.size {
+		e.end = true
+	}
+	return n, err
+}
+
+func (e *endTracker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := e.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		e.pos = pos
+	}
+	return pos, err
+}
+
+// writeTracker records the first failure to write a response.
+type writeTracker struct {
+	http.ResponseWriter
+	err error
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	n, err := t.ResponseWriter.Write(p)
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func saveRangeDrop(t *testing.T, s *Server, content []byte, opts *storage.SaveOptions) *storage.Drop {
+	t.Helper()
+	drop, err := s.storage.SaveDropWithOptions("blob.bin", bytes.NewReader(content), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return drop
+}
+
+func retrieveRange(t *testing.T, s *Server, drop *storage.Drop, ranges string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := retrieveRequest(t, drop.ID, drop.Receipt)
+	if ranges != "" {
+		req.Header.Set("Range", ranges)
+	}
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, req)
+	return rec
+}
+
+func TestHandleRetrieve_Range(t *testing.T) {
+	s := newTestServer(t)
+	content := randomBlob(t, 200*1024)
+	drop := saveRangeDrop(t, s, content, nil)
+
+	rec := retrieveRange(t, s, drop, "bytes=100000-")
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), content[100000:]) {
+		t.Fatalf("range: status = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if got, want := rec.Header().Get("Content-Range"), fmt.Sprintf("bytes 100000-%d/%d", len(content)-1, len(content)); got != want {
+		t.Errorf("Content-Range = %q, want %q", got, want)
+	}
+	etag := rec.Header().Get("ETag")
+
+	// A full download advertises ranges and carries the same version
+	rec = retrieveRange(t, s, drop, "")
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), content) {
+		t.Fatalf("full: status = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec.Header().Get("Accept-Ranges") != "bytes" || rec.Header().Get("ETag") != etag || etag == "" {
+		t.Errorf("Accept-Ranges %q, ETag %q then %q", rec.Header().Get("Accept-Ranges"), etag, rec.Header().Get("ETag"))
+	}
+
+	// A range of a different version gets the whole file
+	req := retrieveRequest(t, drop.ID, drop.Receipt)
+	req.Header.Set("Range", "bytes=10-20")
+	req.Header.Set("If-Range", `"stale"`)
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.Len() != len(content) {
+		t.Errorf("stale If-Range: status = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestHandleRetrieve_RangeBurnedWithoutWindow(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.DeleteAfterRetrieve = true
+	content := randomBlob(t, 1000)
+	drop := saveRangeDrop(t, s, content, nil)
+
+	rec := retrieveRange(t, s, drop, "bytes=0-9")
+	if rec.Code != http.StatusOK || rec.Body.Len() != len(content) || rec.Header().Get("Accept-Ranges") != "none" {
+		t.Fatalf("status = %d, %d bytes, Accept-Ranges %q", rec.Code, rec.Body.Len(), rec.Header().Get("Accept-Ranges"))
+	}
+	if rec := retrieveRange(t, s, drop, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("after retrieval: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleRetrieve_ResumeWindow(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.DeleteAfterRetrieve = true
+	s.resumes = newResumeWindows(10 * time.Minute)
+	content := randomBlob(t, 200*1024)
+
+	// A download resumed within the window burns the drop once it is done
+	drop := saveRangeDrop(t, s, content, nil)
+	if rec := retrieveRange(t, s, drop, "bytes=0-99999"); rec.Code != http.StatusPartialContent {
+		t.Fatalf("first part: status = %d", rec.Code)
+	}
+	rec := retrieveRange(t, s, drop, "bytes=100000-")
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), content[100000:]) {
+		t.Fatalf("rest: status = %d, %d bytes", rec.Code, rec.Body.Len())
+	}
+	if rec := retrieveRange(t, s, drop, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("after the last byte: status = %d, want 404", rec.Code)
+	}
+
+	// Once the window closes the drop is burned, finished or not
+	now := time.Now()
+	s.resumes.now = func() time.Time { return now }
+	drop = saveRangeDrop(t, s, content, nil)
+	if rec := retrieveRange(t, s, drop, "bytes=0-9"); rec.Code != http.StatusPartialContent {
+		t.Fatalf("first part: status = %d", rec.Code)
+	}
+	now = now.Add(11 * time.Minute)
+	if rec := retrieveRange(t, s, drop, "bytes=10-"); rec.Code != http.StatusNotFound {
+		t.Errorf("after the window: status = %d, want 404", rec.Code)
+	}
+	if _, err := s.storage.GetDropMetadata(drop.ID); err == nil {
+		t.Error("drop kept after its window closed")
+	}
+}
+
+func TestResumeWindows_Expired(t *testing.T) {
+	rw := newResumeWindows(time.Minute)
+	now := time.Now()
+	rw.now = func() time.Time { return now }
+
+	rw.open("a")
+	now = now.Add(30 * time.Second)
+	rw.open("b")
+	now = now.Add(45 * time.Second)
+	if got := rw.expired(); len(got) != 1 || got[0] != "a" {
+		t.Errorf("expired = %v, want [a]", got)
+	}
+	if !rw.open("b") {
+		t.Error("b refused within its window")
+	}
+}
+
+func TestHandleRetrieve_RangeIgnoredForBundles(t *testing.T) {
+	s := newTestServer(t)
+	drop := saveRangeDrop(t, s, randomBlob(t, 1000), &storage.SaveOptions{Message: "read me"})
+
+	rec := retrieveRange(t, s, drop, "bytes=0-9")
+	if rec.Code != http.StatusOK || rec.Header().Get("Accept-Ranges") != "none" {
+		t.Errorf("status = %d, Accept-Ranges %q", rec.Code, rec.Header().Get("Accept-Ranges"))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"rsc.io/qr"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// Receipt delivery channels a source may choose at upload (the
+// receipt_channel form field) when security.torn_receipts is on. The
+// default, "", returns the receipt in the submit response.
+const (
+	receiptSealed = "sealed" // sealed to the age recipient in receipt_key
+	receiptQR     = "qr"     // a QR code served once from a separate URL
+)
+
+// receiptQRTTL is how long a source has to open the receipt QR code.
+const receiptQRTTL = 5 * time.Minute
+
+// receiptChannel reads the receipt channel chosen for an upload and, for a
+// sealed receipt, the key to seal it to. It is checked before the drop is
+// saved, so that a refused channel never falls back to an inline receipt. On
+// an invalid choice it writes the error response.
+func (s *Server) receiptChannel(w http.ResponseWriter, r *http.Request, html bool) (string, *age.X25519Recipient, bool) {
+	channel := r.FormValue("receipt_channel")
+	if channel == "" {
+		return "", nil, true
+	}
+	if !s.config().Security.TornReceipts || (channel != receiptSealed && channel != receiptQR) {
+		s.fail(w, html, "Receipt delivery option not available", http.StatusBadRequest)
+		return "", nil, false
+	}
+	if channel == receiptQR {
+		return channel, nil, true
+	}
+	key, err := crypto.ParseRecipient(r.FormValue("receipt_key"))
+	if err != nil {
+		s.fail(w, html, "Invalid receipt key", http.StatusBadRequest)
+		return "", nil, false
+	}
+	return channel, key, true
+}
+
+// tearReceipt replaces the receipt in a submit response with its delivery
+// through channel: sealed_receipt, the receipt sealed to key as a file that
+// dead-drop-unseal opens, or receipt_url, where a QR code of it can be
+// fetched once.
+func (s *Server) tearReceipt(resp map[string]string, dropID, channel string, key *age.X25519Recipient) error {
+	switch channel {
+	case receiptSealed:
+		var sealed bytes.Buffer
+		name := "receipt-" + dropID + ".txt"
+		if err := crypto.SealFile(key, name, strings.NewReader(resp["receipt"]+"\n"), &sealed); err != nil {
+			return err
+		}
+		resp["sealed_receipt"] = base64.StdEncoding.EncodeToString(sealed.Bytes())
+	case receiptQR:
+		token, err := s.receiptQRs.Issue(dropID)
+		if err != nil {
+			return err
+		}
+		resp["receipt_url"] = s.basePath + "/receipt/" + token
+	default:
+		return fmt.Errorf("unknown receipt channel %q", channel)
+	}
+	delete(resp, "receipt")
+	return nil
+}
+
+// handleReceiptQR serves the QR code of a receipt once, as a PNG image.
+func (s *Server) handleReceiptQR(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dropID, ok := s.receiptQRs.Redeem(strings.TrimPrefix(r.URL.Path, "/receipt/"))
+	if !ok {
+		http.Error(w, "Receipt link expired or already used", http.StatusNotFound)
+		return
+	}
+	receipt, err := s.storage.Receipt(dropID)
+	if err != nil {
+		http.Error(w, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	code, err := qr.Encode(receipt, qr.M)
+	if err != nil {
+		http.Error(w, "Failed to render receipt", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	_, _ = w.Write(code.PNG())
+}
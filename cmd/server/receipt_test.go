@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func submitWithChannel(t *testing.T, s *Server, fields map[string]string) (*httptest.ResponseRecorder, map[string]string) {
+	t.Helper()
+	body, ct := createMultipartForm(t, "a.txt", []byte("torn receipt test"), fields)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp
+}
+
+func TestHandleSubmit_SealedReceipt(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.TornReceipts = true
+	priv, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, resp := submitWithChannel(t, s, map[string]string{
+		"receipt_channel": "sealed",
+		"receipt_key":     priv.Recipient().String(),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := resp["receipt"]; ok {
+		t.Fatal("response must not carry the receipt in the clear")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(resp["sealed_receipt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, data, err := crypto.OpenSealedFile(priv, bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatalf("OpenSealedFile error: %v", err)
+	}
+	if !s.storage.ValidateReceipt(resp["drop_id"], strings.TrimSpace(string(data))) {
+		t.Error("sealed receipt does not validate")
+	}
+}
+
+func TestHandleSubmit_QRReceipt(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.TornReceipts = true
+	s.receiptQRs = newDownloadTokens(receiptQRTTL)
+
+	rec, resp := submitWithChannel(t, s, map[string]string{"receipt_channel": "qr"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := resp["receipt"]; ok {
+		t.Fatal("response must not carry the receipt")
+	}
+	if !strings.HasPrefix(resp["receipt_url"], "/receipt/") {
+		t.Fatalf("receipt_url = %q", resp["receipt_url"])
+	}
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.handleReceiptQR(rec, httptest.NewRequest(http.MethodGet, resp["receipt_url"], nil))
+		return rec
+	}
+	rec = get()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" ||
+		!bytes.HasPrefix(rec.Body.Bytes(), []byte("\x89PNG")) {
+		t.Fatalf("QR fetch: status = %d, type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := get(); rec.Code != http.StatusNotFound {
+		t.Errorf("second QR fetch: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleSubmit_ReceiptChannelRefused(t *testing.T) {
+	s := newTestServer(t)
+	for _, tc := range []struct {
+		torn   bool
+		fields map[string]string
+	}{
+		{false, map[string]string{"receipt_channel": "qr"}},
+		{true, map[string]string{"receipt_channel": "carrier-pigeon"}},
+		{true, map[string]string{"receipt_channel": "sealed", "receipt_key": "not a key"}},
+	} {
+		s.config().Security.TornReceipts = tc.torn
+		if rec, _ := submitWithChannel(t, s, tc.fields); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v (torn_receipts %v): status = %d, want 400", tc.fields, tc.torn, rec.Code)
+		}
+	}
+	if drops, _ := s.storage.Drops(); len(drops) != 0 {
+		t.Errorf("refused uploads must not be stored, found %d drops", len(drops))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// parseRecipientKey parses security.recipient_key, the receivers' age
+// X25519 recipient, returning nil when none is set.
+func parseRecipientKey(encoded string) (*age.X25519Recipient, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := crypto.ParseRecipient(encoded)
+	if err != nil {
+		return nil, errors.New("security.recipient_key must be an age X25519 recipient (age1...)")
+	}
+	return key, nil
+}
+
+// recipientPublicKey returns the age recipient key published on the index
+// page and in /api/v1/capacity, or "" when none is set.
+func (s *Server) recipientPublicKey() string {
+	if s.recipient == nil {
+		return ""
+	}
+	return s.recipient.String()
+}
+
+// recipientFingerprint returns the key fingerprint that uploads sealed to
+// the recipient key declare, or "" when none is set.
+func (s *Server) recipientFingerprint() string {
+	if s.recipient == nil {
+		return ""
+	}
+	return crypto.RecipientFingerprint(s.recipient)
+}
+
+// errNotSealed is returned for an upload that declares it is sealed to the
+// recipient key but does not start like an age file.
+var errNotSealed = errors.New("upload is not sealed to the recipient key")
+
+// checkSealed reads the start of an upload that declares it is sealed to
+// the recipient key and returns a reader of the whole upload, or false if
+// it does not start like an age file. Only the header can be checked, but
+// that is enough to keep a client that failed to seal from leaving its
+// plaintext on the server recorded as unreadable to it.
+func checkSealed(file io.Reader) (io.Reader, bool) {
+	header := make([]byte, crypto.SealedHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil || !crypto.IsSealedHeader(header) {
+		return nil, false
+	}
+	return io.MultiReader(bytes.NewReader(header), file), true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestParseRecipientKey(t *testing.T) {
+	priv, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := priv.Recipient().String()
+	if key, err := parseRecipientKey(encoded + "\n"); err != nil || key.String() != encoded {
+		t.Errorf("valid key: %v", err)
+	}
+	if key, err := parseRecipientKey(""); key != nil || err != nil {
+		t.Errorf("unset: %v, %v", key, err)
+	}
+	// A raw base64 X25519 key, or an identity, is not an age recipient
+	for _, bad := range []string{"not a key", base64.StdEncoding.EncodeToString(make([]byte, 32)), priv.String()} {
+		if _, err := parseRecipientKey(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestHandleSubmit_SealedToRecipient(t *testing.T) {
+	s := newTestServer(t)
+	priv, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.recipient = priv.Recipient()
+	fp := crypto.RecipientFingerprint(s.recipient)
+
+	// The key is published for clients to seal to
+	rec := httptest.NewRecorder()
+	s.handleCapacity(rec, httptest.NewRequest(http.MethodGet, "/api/v1/capacity", nil))
+	var capacity capacityResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &capacity); err != nil || capacity.RecipientKey != s.recipientPublicKey() {
+		t.Fatalf("capacity recipient_key = %q (%v)", capacity.RecipientKey, err)
+	}
+	rec = httptest.NewRecorder()
+	s.handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	page := rec.Body.String()
+	if !strings.Contains(page, `data-recipient-key="`+s.recipientPublicKey()+`"`) || !strings.Contains(page, fp) {
+		t.Error("index page does not publish the recipient key and fingerprint")
+	}
+
+	// A file claiming the recipient's fingerprint must look sealed
+	fields := map[string]string{"client_encrypted": "true", "key_fingerprint": fp}
+	body, ct := createMultipartForm(t, "drop.age", randomBlob(t, 4096), fields)
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unsealed upload: status = %d, want 400", rec.Code)
+	}
+
+	var sealed bytes.Buffer
+	if err := crypto.SealFile(s.recipient, "memo.pdf", bytes.NewReader([]byte("for the receivers only")), &sealed); err != nil {
+		t.Fatal(err)
+	}
+	body, ct = createMultipartForm(t, "drop.age", sealed.Bytes(), fields)
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("sealed upload: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if resp["key_fingerprint"] != fp {
+		t.Errorf("key_fingerprint = %q, want %q", resp["key_fingerprint"], fp)
+	}
+
+	// Stored as sent, so the receivers open it with their private key
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	name, data, err := crypto.OpenSealedFile(priv, rec.Body)
+	if err != nil || name != "memo.pdf" || string(data) != "for the receivers only" {
+		t.Errorf("opened %q %q: %v", name, data, err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+	"github.com/scttfrdmn/dead-drop/internal/validation"
+)
+
+// defaultRateLimit applies when security.rate_limit_per_min is not positive.
+const defaultRateLimit = 10
+
+// config returns the settings in effect, which a reload may replace between
+// two calls.
+func (s *Server) config() *config.Config {
+	return s.cfg.Load()
+}
+
+// validator returns the upload validator for the settings in effect.
+func (s *Server) validator() *validation.Validator {
+	return s.checks.Load()
+}
+
+// rateLimit returns the requests per minute each client network may make.
+func rateLimit(cfg *config.Config) int {
+	if cfg.Security.RateLimitPerMin <= 0 {
+		return defaultRateLimit
+	}
+	return cfg.Security.RateLimitPerMin
+}
+
+// reloader re-reads the config file, on SIGHUP or through the admin API, and
+// applies the settings that may change while the server runs: rate limits,
+// quotas, the upload size limit, and the logging flags. Connections in
+// progress are kept, as are the keys; anything else the file changes takes
+// effect at the next restart.
+type reloader struct {
+	mu      sync.Mutex // one reload at a time
+	server  *Server
+	path    string
+	flags   func(*config.Config) // the command-line overrides, applied again
+	secrets map[string]string    // the secrets file as read at startup
+	limiter *ratelimit.Limiter
+}
+
+// reloadResult reports what a reload changed.
+type reloadResult struct {
+	Applied []string `json:"applied"`          // settings now in effect, by config path
+	Restart []string `json:"restart_required"` // config sections whose changes wait for a restart
+}
+
+// String describes the result for the audit log.
+func (r reloadResult) String() string {
+	return fmt.Sprintf("applied [%s]; restart [%s]", strings.Join(r.Applied, " "), strings.Join(r.Restart, " "))
+}
+
+// reload reads the config file and applies it. A file that fails to load or
+// validate changes nothing.
+func (rl *reloader) reload() (reloadResult, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	loaded, err := config.LoadConfig(rl.path)
+	if err != nil {
+		return reloadResult{}, err
+	}
+	rl.flags(loaded)
+	if err := loaded.ResolveSecrets(rl.secrets); err != nil {
+		return reloadResult{}, err
+	}
+
+	s := rl.server
+	next := *s.config()
+	var result reloadResult
+	reloadSetting(&result, "server.max_upload_mb", &next.Server.MaxUploadMB, loaded.Server.MaxUploadMB)
+	reloadSetting(&result, "security.rate_limit_per_min", &next.Security.RateLimitPerMin, loaded.Security.RateLimitPerMin)
+	if s.storage.Quota != nil {
+		// Quotas set at startup may change; turning them on or off takes a
+		// restart, which scans the store
+		reloadSetting(&result, "security.max_storage_gb", &next.Security.MaxStorageGB, loaded.Security.MaxStorageGB)
+		reloadSetting(&result, "security.max_drops", &next.Security.MaxDrops, loaded.Security.MaxDrops)
+	}
+	reloadSetting(&result, "logging.startup", &next.Logging.Startup, loaded.Logging.Startup)
+	reloadSetting(&result, "logging.errors", &next.Logging.Errors, loaded.Logging.Errors)
+	reloadSetting(&result, "logging.operations", &next.Logging.Operations, loaded.Logging.Operations)
+	result.Restart = changedSections(&next, loaded)
+
+	// The validator is replaced before the config, so that no upload is
+	// admitted under a new limit and checked against the old one
+	s.checks.Store(newValidator(&next))
+	s.cfg.Store(&next)
+	rl.limiter.SetRate(rateLimit(&next))
+	if s.pow != nil {
+		s.pow.SetRate(rateLimit(&next))
+	}
+	if s.storage.Quota != nil {
+		s.storage.Quota.SetLimits(next.Security.MaxStorageGB, next.Security.MaxDrops)
+	}
+	return result, nil
+}
+
+// reloadSetting copies one reloadable setting, noting it in result if it
+// changed.
+func reloadSetting[T comparable](result *reloadResult, path string, current *T, loaded T) {
+	if *current != loaded {
+		*current = loaded
+		result.Applied = append(result.Applied, path)
+	}
+}
+
+// changedSections returns the top-level config sections that differ between
+// the settings in effect and those loaded, by their YAML keys.
+func changedSections(current, loaded *config.Config) []string {
+	var sections []string
+	cv, lv := reflect.ValueOf(current).Elem(), reflect.ValueOf(loaded).Elem()
+	for i := range cv.NumField() {
+		field := cv.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(cv.Field(i).Interface(), lv.Field(i).Interface()) {
+			key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			sections = append(sections, key)
+		}
+	}
+	return sections
+}
+
+// watch reloads on each of signals until stop is closed.
+func (rl *reloader) watch(signals <-chan os.Signal, stop <-chan struct{}) {
+	for {
+		select {
+		case <-signals:
+			rl.logReload(rl.reload())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// logReload logs the outcome of a reload. A failure is always logged: the
+// operator who sent the signal has no other way to learn of it.
+func (rl *reloader) logReload(result reloadResult, err error) {
+	if err != nil {
+		log.Printf("Config reload failed, settings unchanged: %v", err)
+		return
+	}
+	if !rl.server.config().Logging.Startup {
+		return
+	}
+	applied := "no reloadable setting changed"
+	if len(result.Applied) > 0 {
+		applied = "applied " + strings.Join(result.Applied, ", ")
+	}
+	log.Printf("Config reloaded: %s", applied)
+	if len(result.Restart) > 0 {
+		log.Printf("Config reload: changes to %s take effect at restart", strings.Join(result.Restart, ", "))
+	}
+}
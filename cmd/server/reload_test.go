@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/audit"
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// newTestReloader returns a reloader of s reading a config file written with
+// body, and the file's path.
+func newTestReloader(t *testing.T, s *Server, body string) (*reloader, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &reloader{
+		server:  s,
+		path:    path,
+		flags:   func(*config.Config) {},
+		limiter: ratelimit.NewLimiter(rateLimit(s.config()), time.Minute),
+	}, path
+}
+
+func TestReload(t *testing.T) {
+	s := newTestServer(t)
+	quota, err := storage.NewQuotaManager(s.config().Server.StorageDir, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.storage.Quota = quota
+
+	base := "server:\n  storage_dir: " + s.config().Server.StorageDir + "\n"
+	rl, path := newTestReloader(t, s, base)
+	s.config().Security.MaxDrops = 10
+	if _, err := rl.reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := base + `  max_upload_mb: 5
+  listen: "127.0.0.1:9999"
+security:
+  rate_limit_per_min: 1
+  max_drops: 1
+logging:
+  errors: false
+`
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := s.config()
+	result, err := rl.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"server.max_upload_mb", "security.rate_limit_per_min", "security.max_drops", "logging.errors"}
+	if !slices.Equal(result.Applied, want) {
+		t.Errorf("applied %v, want %v", result.Applied, want)
+	}
+	if !slices.Equal(result.Restart, []string{"server"}) {
+		t.Errorf("restart %v, want [server] for the listen address", result.Restart)
+	}
+
+	cfg := s.config()
+	if cfg == old || old.Server.MaxUploadMB != 100 {
+		t.Error("the config in effect should be replaced, not changed in place")
+	}
+	if cfg.Server.MaxUploadMB != 5 || cfg.Server.Listen != old.Server.Listen || cfg.Logging.Errors {
+		t.Errorf("config after reload = %+v", cfg.Server)
+	}
+	if s.validator().MaxSizeBytes != 5<<20 {
+		t.Errorf("validator limit = %d, want 5 MB", s.validator().MaxSizeBytes)
+	}
+	if _, maxDrops := quota.Limits(); maxDrops != 1 {
+		t.Errorf("quota max drops = %d, want 1", maxDrops)
+	}
+	if !rl.limiter.Allow("192.0.2.1") || rl.limiter.Allow("192.0.2.1") {
+		t.Error("limiter should allow one request a minute")
+	}
+}
+
+func TestReload_InvalidConfigChangesNothing(t *testing.T) {
+	s := newTestServer(t)
+	rl, _ := newTestReloader(t, s, "security:\n  rate_limit_per_min: -5\n  no_such_key: true\n")
+	old := s.config()
+	if _, err := rl.reload(); err == nil {
+		t.Fatal("reload of an invalid config should fail")
+	}
+	if s.config() != old {
+		t.Error("a failed reload should keep the config in effect")
+	}
+}
+
+func TestReload_QuotaNeedsRestart(t *testing.T) {
+	s := newTestServer(t)
+	rl, _ := newTestReloader(t, s, "server:\n  storage_dir: "+s.config().Server.StorageDir+"\nsecurity:\n  max_drops: 5\n")
+	result, err := rl.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Applied) != 0 || !slices.Equal(result.Restart, []string{"security"}) {
+		t.Errorf("result = %+v, want quotas left for a restart", result)
+	}
+	if s.config().Security.MaxDrops != 0 {
+		t.Error("a quota cannot be turned on without a restart")
+	}
+}
+
+func TestAdmin_ReloadConfig(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	if rec := adminDo(t, a, http.MethodPost, "/admin/v1/config/reload", aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("without a config file: status = %d, want 404", rec.Code)
+	}
+
+	a.server.reloader, _ = newTestReloader(t, a.server,
+		"server:\n  storage_dir: "+a.server.config().Server.StorageDir+"\n  max_upload_mb: 7\n")
+	rec := adminDo(t, a, http.MethodPost, "/admin/v1/config/reload", aliceToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var result reloadResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(result.Applied, []string{"server.max_upload_mb"}) {
+		t.Errorf("applied %v", result.Applied)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := entries[len(entries)-1]; last.Action != "config_reload" {
+		t.Errorf("last audit entry = %+v, want the reload", last)
+	}
+}
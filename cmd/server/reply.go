@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// maxReplyBodyBytes bounds a /reply request: the credentials and a reply of
+// storage.MaxReplyText bytes, URL-encoded.
+const maxReplyBodyBytes = 4*storage.MaxReplyText + 1024
+
+// replyResponse is returned by /check-reply.
+type replyResponse struct {
+	Reply string `json:"reply"`
+}
+
+// handleReply attaches a receiver's reply to a drop, for security.replies:
+// with the drop ID and receipt that retrieved it, and the reply in the text
+// form field. A later reply replaces it; an empty one withdraws it. The
+// drop is not burned.
+func (s *Server) handleReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReplyBodyBytes)
+	dropID, ok := s.retrievalCredentials(w, r, false)
+	if !ok {
+		return
+	}
+	err := s.storage.SetReply(dropID, r.PostFormValue("text"))
+	switch {
+	case errors.Is(err, storage.ErrReplyTooLong):
+		s.fail(w, false, "Reply too long", http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, storage.ErrLocked):
+		s.fail(w, false, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		if s.config().Logging.Errors {
+			log.Printf("Failed to save reply: %v", err)
+		}
+		s.fail(w, false, "Drop not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCheckReply returns, for a drop ID and receipt sent in a POST body or
+// headers, the reply the receivers left on the drop, so its source can learn
+// that it arrived or what else is wanted without any other channel.
+func (s *Server) handleCheckReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropID, ok := s.retrievalCredentials(w, r, false)
+	if !ok {
+		return
+	}
+	text, err := s.storage.Reply(dropID)
+	switch {
+	case errors.Is(err, storage.ErrLocked):
+		s.fail(w, false, "Service unavailable", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		// A drop that is gone has no reply either, and says no more
+		s.fail(w, false, "No reply", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, replyResponse{Reply: text})
+}
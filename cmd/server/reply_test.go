@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHandleReply(t *testing.T) {
+	s := newTestServer(t)
+	drop, err := s.storage.SaveDrop("doc.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := retrieveRequest(t, drop.ID, drop.Receipt)
+		req.URL.Path = "/check-reply"
+		s.handleCheckReply(rec, req)
+		return rec
+	}
+	if rec := check(); rec.Code != http.StatusNotFound {
+		t.Fatalf("check before a reply: status = %d", rec.Code)
+	}
+
+	form := url.Values{"id": {drop.ID}, "receipt": {drop.Receipt}, "text": {"Got it. More on the 14th?"}}
+	req := httptest.NewRequest(http.MethodPost, "/reply", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	s.handleReply(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("reply: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = check()
+	var resp replyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("check: status = %d, body %q", rec.Code, rec.Body)
+	}
+	if resp.Reply != "Got it. More on the 14th?" {
+		t.Errorf("reply = %q", resp.Reply)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+
+	// Replying takes the receipt, like retrieval
+	form.Set("receipt", "wrong")
+	req = httptest.NewRequest(http.MethodPost, "/reply", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	s.handleReply(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("reply with a bad receipt: status = %d", rec.Code)
+	}
+}
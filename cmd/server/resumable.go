@@ -0,0 +1,565 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+const (
+	// maxUploadSessions bounds resumable uploads in progress, each of which
+	// holds a file on disk until it is finished or expires.
+	maxUploadSessions = 64
+
+	// uploadSessionTTL is how long a resumable upload is kept without a
+	// chunk arriving, long enough to wait out a broken Tor circuit, unless
+	// security.resumable_upload_ttl_minutes sets another.
+	uploadSessionTTL = time.Hour
+
+	// maxUploadChunk bounds one chunk, which is held in memory until it is
+	// complete and its checksum verified.
+	maxUploadChunk = 8 << 20
+
+	uploadIDSize = 32
+
+	// uploadIDHeader names the upload a chunk belongs to. It is a header
+	// rather than part of the URL so that it stays out of access logs.
+	uploadIDHeader = "X-Dead-Drop-Upload-ID"
+)
+
+// errTooManyUploads is returned when maxUploadSessions are in progress.
+var errTooManyUploads = errors.New("too many resumable uploads in progress")
+
+// Resumable uploads let a source send a large file in chunks and pick up
+// after a dropped connection where the server left off, in the manner of
+// tus: /upload/init declares the file's name, size and SHA-256,
+// /upload/chunk appends chunks at the offset the server reports, and
+// /upload/finish checks the assembled file against the declared size and
+// hash before it is stored like a /submit upload, with the same options.
+//
+// Each chunk is kept in its own file below the storage directory, named by
+// an HMAC of its SHA-256 under a key held only in memory and encrypted
+// under the same key. Content addressing makes chunks idempotent: a chunk
+// sent again after its reply was lost is acknowledged without being stored
+// twice, and identical chunks within an upload share one file. A restart
+// loses every upload in progress, and the files left behind, unreadable
+// without their keys, are removed at startup.
+type uploadSession struct {
+	mu sync.Mutex // held while a chunk is appended or the upload finished
+
+	id          string
+	filename    string
+	contentType string
+	size        int64
+	sum         []byte // declared SHA-256 of the whole file
+
+	key    []byte
+	dir    string          // holds the chunk files
+	parts  []uploadPart    // the chunks held, in file order
+	stored map[string]bool // names of the chunk files written
+	hash   hash.Hash
+	offset int64
+	seen   time.Time
+	closed bool // removed from the store; the files are gone
+}
+
+// uploadPart is one chunk of an upload, at offset in the file.
+type uploadPart struct {
+	offset int64
+	size   int64
+	name   string // chunk file holding it
+}
+
+// uploadSessions holds the resumable uploads in progress.
+type uploadSessions struct {
+	mu       sync.Mutex
+	dir      string
+	sessions map[string]*uploadSession
+	ttl      time.Duration
+	now      func() time.Time
+}
+
+// newUploadSessions creates a store keeping its files in dir, removing any
+// a previous process left there.
+func newUploadSessions(dir string) (*uploadSessions, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to clear resumable uploads: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create resumable upload dir: %w", err)
+	}
+	return &uploadSessions{
+		dir:      dir,
+		sessions: make(map[string]*uploadSession),
+		ttl:      uploadSessionTTL,
+		now:      time.Now,
+	}, nil
+}
+
+// start begins an upload of size bytes whose SHA-256 is sum.
+func (u *uploadSessions) start(filename, contentType string, size int64, sum []byte) (*uploadSession, error) {
+	u.expire()
+
+	raw := make([]byte, uploadIDSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate upload ID: %w", err)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	// Named after a hash of the ID, which is the only credential of the upload
+	name := sha256.Sum256(raw)
+	sess := &uploadSession{
+		id:          base64.RawURLEncoding.EncodeToString(raw),
+		filename:    filename,
+		contentType: contentType,
+		size:        size,
+		sum:         sum,
+		key:         key,
+		dir:         filepath.Join(u.dir, hex.EncodeToString(name[:])),
+		stored:      make(map[string]bool),
+		hash:        sha256.New(),
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.sessions) >= maxUploadSessions {
+		crypto.ZeroBytes(key)
+		return nil, errTooManyUploads
+	}
+	if err := os.Mkdir(sess.dir, 0700); err != nil {
+		crypto.ZeroBytes(key)
+		return nil, fmt.Errorf("failed to create upload dir: %w", err)
+	}
+	sess.seen = u.now()
+	u.sessions[sess.id] = sess
+	return sess, nil
+}
+
+// chunkName returns the name of the file holding the chunk whose SHA-256
+// is sum. Keyed, so that the names do not reveal the hashes of the chunks.
+func (sess *uploadSession) chunkName(sum [sha256.Size]byte) string {
+	mac := hmac.New(sha256.New, sess.key)
+	mac.Write(sum[:])
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// appendChunk adds chunk, whose SHA-256 is sum, at the end of the upload,
+// writing it to disk unless an identical chunk already was.
+func (sess *uploadSession) appendChunk(chunk []byte, sum [sha256.Size]byte) error {
+	name := sess.chunkName(sum)
+	if !sess.stored[name] {
+		if err := sess.writeChunk(name, chunk); err != nil {
+			return err
+		}
+		sess.stored[name] = true
+	}
+	sess.parts = append(sess.parts, uploadPart{offset: sess.offset, size: int64(len(chunk)), name: name})
+	sess.hash.Write(chunk)
+	sess.offset += int64(len(chunk))
+	return nil
+}
+
+// writeChunk encrypts chunk into the file name, bound to that name, so
+// that a chunk cannot be passed off as another. It is written under a
+// temporary name and renamed, so that a chunk file is whole or absent.
+func (sess *uploadSession) writeChunk(name string, chunk []byte) error {
+	path := filepath.Join(sess.dir, name)
+	f, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 -- hex name inside the upload dir
+	if err != nil {
+		return err
+	}
+	err = crypto.EncryptStream(sess.key, bytes.NewReader(chunk), f, []byte(name))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+	}
+	return err
+}
+
+// holds reports whether the upload already has chunk, whose SHA-256 is
+// sum, at offset: a chunk sent again after its reply was lost.
+func (sess *uploadSession) holds(offset int64, chunk []byte, sum [sha256.Size]byte) bool {
+	i := sort.Search(len(sess.parts), func(i int) bool { return sess.parts[i].offset >= offset })
+	if i == len(sess.parts) {
+		return false
+	}
+	part := sess.parts[i]
+	return part.offset == offset && part.size == int64(len(chunk)) && part.name == sess.chunkName(sum)
+}
+
+// reader returns the upload's contents, decrypting one chunk at a time.
+func (sess *uploadSession) reader() io.Reader {
+	return &partsReader{sess: sess}
+}
+
+// partsReader reads an upload's chunks back in file order.
+type partsReader struct {
+	sess *uploadSession
+	next int
+	buf  bytes.Buffer
+}
+
+func (p *partsReader) Read(b []byte) (int, error) {
+	for p.buf.Len() == 0 {
+		if p.next == len(p.sess.parts) {
+			return 0, io.EOF
+		}
+		part := p.sess.parts[p.next]
+		f, err := os.Open(filepath.Join(p.sess.dir, part.name)) // #nosec G304 -- hex name inside the upload dir
+		if err != nil {
+			return 0, err
+		}
+		p.buf.Reset()
+		err = crypto.DecryptStream(p.sess.key, f, &p.buf, []byte(part.name))
+		_ = f.Close()
+		if err == nil && int64(p.buf.Len()) != part.size {
+			err = errors.New("chunk file does not match its size")
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read upload chunk: %w", err)
+		}
+		p.next++
+	}
+	return p.buf.Read(b)
+}
+
+// get returns the upload with id, locked, or nil if there is none. busy is
+// set, and nil returned, when another request holds it.
+func (u *uploadSessions) get(id string) (sess *uploadSession, busy bool) {
+	u.mu.Lock()
+	sess = u.sessions[id]
+	u.mu.Unlock()
+	if sess == nil {
+		return nil, false
+	}
+	if !sess.mu.TryLock() {
+		return nil, true
+	}
+	if sess.closed {
+		sess.mu.Unlock()
+		return nil, false
+	}
+	sess.seen = u.now()
+	return sess, false
+}
+
+// reserved returns the bytes declared by the uploads in progress.
+func (u *uploadSessions) reserved() int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var total int64
+	for _, sess := range u.sessions {
+		total += sess.size
+	}
+	return total
+}
+
+// remove ends an upload its caller holds the lock of, deleting its file.
+func (u *uploadSessions) remove(sess *uploadSession) {
+	u.mu.Lock()
+	delete(u.sessions, sess.id)
+	u.mu.Unlock()
+	u.discard(sess)
+}
+
+// discard deletes the chunks of an upload no longer in the store.
+func (u *uploadSessions) discard(sess *uploadSession) {
+	sess.closed = true
+	crypto.ZeroBytes(sess.key)
+	if err := os.RemoveAll(sess.dir); err != nil {
+		log.Printf("Failed to remove resumable upload files: %v", err)
+	}
+}
+
+// expire removes the uploads no chunk has arrived for within the TTL,
+// except those a request is working on.
+func (u *uploadSessions) expire() {
+	cutoff := u.now().Add(-u.ttl)
+	var stale []*uploadSession
+
+	u.mu.Lock()
+	for id, sess := range u.sessions {
+		if !sess.mu.TryLock() {
+			continue
+		}
+		if sess.seen.Before(cutoff) {
+			delete(u.sessions, id)
+			stale = append(stale, sess)
+			continue
+		}
+		sess.mu.Unlock()
+	}
+	u.mu.Unlock()
+
+	for _, sess := range stale {
+		u.discard(sess)
+		sess.mu.Unlock()
+	}
+}
+
+// expireEvery removes idle uploads every interval until stop is closed.
+func (u *uploadSessions) expireEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.expire()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// uploadInitResponse is the reply to /upload/init.
+type uploadInitResponse struct {
+	UploadID      string `json:"upload_id"`
+	Offset        int64  `json:"offset"`
+	MaxChunkBytes int64  `json:"max_chunk_bytes"`
+}
+
+// acceptingUploads answers and returns false when new uploads are refused,
+// as handleSubmit does before reading the body.
+func (s *Server) acceptingUploads(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-Dead-Drop-Upload") != "true" {
+		http.Error(w, "Missing required header", http.StatusBadRequest)
+		return false
+	}
+	if r.Header.Get("Content-Type") == crypto.EnvelopeContentType {
+		// The chunks would pass a TLS-terminating proxy in the clear
+		s.fail(w, false, "Upload envelopes are not supported for resumable uploads", http.StatusBadRequest)
+		return false
+	}
+	if s.config().Security.SubmissionsPaused {
+		s.fail(w, false, "Submissions are temporarily paused", http.StatusServiceUnavailable)
+		return false
+	}
+	if s.storage.Locked() {
+		s.fail(w, false, "Service unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	if s.storage.Quota != nil && !s.storage.Quota.CanAccept(0) {
+		s.refuseQuotaFull(w, false)
+		return false
+	}
+	return true
+}
+
+// handleUploadInit starts a resumable upload. The form gives the file's
+// filename, size in bytes, sha256 in hex, and optionally content_type.
+func (s *Server) handleUploadInit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.acceptingUploads(w, r) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
+
+	size, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil || size < 0 {
+		s.fail(w, false, "Invalid upload size", http.StatusBadRequest)
+		return
+	}
+	if size > s.config().Server.MaxUploadMB*1024*1024 {
+		s.fail(w, false, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	sum, err := hex.DecodeString(r.FormValue("sha256"))
+	if err != nil || len(sum) != sha256.Size {
+		s.fail(w, false, "Invalid file hash", http.StatusBadRequest)
+		return
+	}
+	filename := r.FormValue("filename")
+	if filename == "" {
+		s.fail(w, false, "Missing filename", http.StatusBadRequest)
+		return
+	}
+	// Uploads in progress will need their space too
+	if s.storage.Quota != nil && !s.storage.Quota.CanAccept(s.uploads.reserved()+size) {
+		s.refuseQuotaFull(w, false)
+		return
+	}
+
+	sess, err := s.uploads.start(filename, r.FormValue("content_type"), size, sum)
+	if errors.Is(err, errTooManyUploads) {
+		s.metrics.RecordShed()
+		s.fail(w, false, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		if s.config().Logging.Errors {
+			log.Printf("Failed to start resumable upload: %v", err)
+		}
+		s.fail(w, false, "Failed to start upload", http.StatusInternalServerError)
+		return
+	}
+	s.writeJSON(w, uploadInitResponse{UploadID: sess.id, MaxChunkBytes: maxUploadChunk})
+}
+
+// handleUploadChunk appends the body of a PATCH to the upload named by the
+// X-Dead-Drop-Upload-ID header. Its Upload-Offset must be the server's,
+// which a HEAD reports, or that of a chunk the server already holds with
+// the same contents, which is acknowledged without being stored again. An
+// optional Upload-Checksum ("sha256 <base64>") is checked before the chunk
+// is kept. A chunk is kept whole or not at all.
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.Header.Get("X-Dead-Drop-Upload") != "true" {
+		http.Error(w, "Missing required header", http.StatusBadRequest)
+		return
+	}
+	sess, busy := s.uploads.get(r.Header.Get(uploadIDHeader))
+	if busy {
+		// An earlier attempt at a chunk is still arriving
+		s.fail(w, false, "Upload busy, please try again later", http.StatusConflict)
+		return
+	}
+	if sess == nil {
+		s.fail(w, false, "Upload not found", http.StatusNotFound)
+		return
+	}
+	defer sess.mu.Unlock()
+
+	w.Header().Set("Upload-Length", strconv.FormatInt(sess.size, 10))
+	w.Header().Set("Upload-Offset", strconv.FormatInt(sess.offset, 10))
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 || offset > sess.offset {
+		s.fail(w, false, "Upload offset mismatch", http.StatusConflict)
+		return
+	}
+
+	cost := r.ContentLength
+	if cost < 0 || cost > maxUploadChunk {
+		cost = maxUploadChunk
+	}
+	if !s.memory.Acquire(cost) {
+		s.metrics.RecordShed()
+		s.fail(w, false, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.memory.Release(cost)
+
+	chunk, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadChunk))
+	if err != nil {
+		s.fail(w, false, "Failed to read chunk", http.StatusBadRequest)
+		return
+	}
+	if len(chunk) == 0 {
+		// It would add an empty part for nothing
+		s.fail(w, false, "Empty chunk", http.StatusBadRequest)
+		return
+	}
+	if int64(len(chunk)) > sess.size-offset {
+		s.fail(w, false, "Chunk exceeds the declared size", http.StatusRequestEntityTooLarge)
+		return
+	}
+	sum := sha256.Sum256(chunk)
+	if checksum := r.Header.Get("Upload-Checksum"); checksum != "" {
+		algorithm, encoded, _ := strings.Cut(checksum, " ")
+		want, err := base64.StdEncoding.DecodeString(encoded)
+		if algorithm != "sha256" || err != nil || subtle.ConstantTimeCompare(want, sum[:]) != 1 {
+			s.fail(w, false, "Chunk checksum mismatch", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if offset < sess.offset {
+		if !sess.holds(offset, chunk, sum) {
+			s.fail(w, false, "Upload offset mismatch", http.StatusConflict)
+			return
+		}
+	} else if err := sess.appendChunk(chunk, sum); err != nil {
+		// Nothing of the chunk is kept, so it can be sent again
+		if s.config().Logging.Errors {
+			log.Printf("Failed to store resumable upload chunk: %v", err)
+		}
+		s.fail(w, false, "Failed to store chunk", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(sess.offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUploadFinish stores a complete resumable upload as a drop. The form
+// names it with upload_id and carries the options of a /submit upload; the
+// reply is that of /submit. An upload whose hash does not match the one
+// declared is discarded.
+func (s *Server) handleUploadFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.acceptingUploads(w, r) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1024*1024)
+
+	sess, busy := s.uploads.get(r.FormValue("upload_id"))
+	if busy {
+		s.fail(w, false, "Upload busy, please try again later", http.StatusConflict)
+		return
+	}
+	if sess == nil {
+		s.fail(w, false, "Upload not found", http.StatusNotFound)
+		return
+	}
+	defer sess.mu.Unlock()
+	if sess.offset != sess.size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(sess.offset, 10))
+		s.fail(w, false, "Upload incomplete", http.StatusConflict)
+		return
+	}
+
+	cost := s.uploadCost(sess.size)
+	if !s.memory.Acquire(cost) {
+		s.metrics.RecordShed()
+		s.fail(w, false, "Server busy, please try again later", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.memory.Release(cost)
+
+	// From here the upload is stored or discarded, never resumed
+	defer s.uploads.remove(sess)
+	if subtle.ConstantTimeCompare(sess.hash.Sum(nil), sess.sum) != 1 {
+		s.fail(w, false, "Upload does not match its hash", http.StatusBadRequest)
+		return
+	}
+	s.acceptUpload(w, r, false, nil, upload{file: sess.reader(), name: sess.filename, contentType: sess.contentType})
+}
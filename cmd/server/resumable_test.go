@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func newResumableTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newTestServer(t)
+	uploads, err := newUploadSessions(filepath.Join(s.storage.StorageDir, ".uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.uploads = uploads
+	return s
+}
+
+func uploadFormRequest(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	return req
+}
+
+func initUpload(t *testing.T, s *Server, filename string, content []byte) string {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	rec := httptest.NewRecorder()
+	s.handleUploadInit(rec, uploadFormRequest("/upload/init", url.Values{
+		"filename": {filename},
+		"size":     {strconv.Itoa(len(content))},
+		"sha256":   {hex.EncodeToString(sum[:])},
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("init: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	var resp uploadInitResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp.UploadID
+}
+
+func sendChunk(s *Server, id string, offset int, chunk []byte, checksum string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/upload/chunk", bytes.NewReader(chunk))
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	req.Header.Set(uploadIDHeader, id)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	if checksum != "" {
+		req.Header.Set("Upload-Checksum", checksum)
+	}
+	rec := httptest.NewRecorder()
+	s.handleUploadChunk(rec, req)
+	return rec
+}
+
+func TestResumableUpload_RoundTrip(t *testing.T) {
+	s := newResumableTestServer(t)
+	content := bytes.Repeat([]byte("resumable upload over a flaky circuit\n"), 5000)
+	id := initUpload(t, s, "notes.txt", content)
+
+	third := len(content) / 3
+	if rec := sendChunk(s, id, 0, content[:third], ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("first chunk: status = %d", rec.Code)
+	}
+
+	// A chunk sent again after its reply was lost is acknowledged, with the
+	// server's offset, but not appended twice
+	rec := sendChunk(s, id, 0, content[:third], "")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != strconv.Itoa(third) {
+		t.Fatalf("retransmitted chunk: status = %d, Upload-Offset %q", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+	// Different contents at a stale offset are refused with the server's offset
+	rec = sendChunk(s, id, 0, content[1:third+1], "")
+	if rec.Code != http.StatusConflict || rec.Header().Get("Upload-Offset") != strconv.Itoa(third) {
+		t.Fatalf("stale offset: status = %d, Upload-Offset %q", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+
+	// A client that lost track asks where to resume
+	head := httptest.NewRequest(http.MethodHead, "/upload/chunk", nil)
+	head.Header.Set("X-Dead-Drop-Upload", "true")
+	head.Header.Set(uploadIDHeader, id)
+	rec = httptest.NewRecorder()
+	s.handleUploadChunk(rec, head)
+	if rec.Header().Get("Upload-Offset") != strconv.Itoa(third) || rec.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Errorf("HEAD: Upload-Offset %q, Upload-Length %q", rec.Header().Get("Upload-Offset"), rec.Header().Get("Upload-Length"))
+	}
+
+	// Finishing early keeps the upload
+	rec = httptest.NewRecorder()
+	s.handleUploadFinish(rec, uploadFormRequest("/upload/finish", url.Values{"upload_id": {id}}))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("early finish: status = %d, want 409", rec.Code)
+	}
+
+	rest := content[third:]
+	sum := sha256.Sum256(rest)
+	if rec := sendChunk(s, id, third, rest, "sha256 "+base64.StdEncoding.EncodeToString(sum[:])); rec.Code != http.StatusNoContent {
+		t.Fatalf("last chunk: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleUploadFinish(rec, uploadFormRequest("/upload/finish", url.Values{
+		"upload_id": {id},
+		"message":   {"sent in pieces"},
+	}))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("finish: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+
+	_, reader, err := s.storage.GetDropWithMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var got bytes.Buffer
+	if _, err := got.ReadFrom(reader); err != nil || !bytes.Equal(got.Bytes(), content) {
+		t.Errorf("stored contents differ (%d bytes, %v)", got.Len(), err)
+	}
+
+	entries, err := os.ReadDir(s.uploads.dir)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("%d upload files left after finishing (%v)", len(entries), err)
+	}
+	if sess, _ := s.uploads.get(id); sess != nil {
+		t.Error("upload still open after finishing")
+	}
+}
+
+func TestResumableUpload_IdenticalChunksStoredOnce(t *testing.T) {
+	s := newResumableTestServer(t)
+	block := bytes.Repeat([]byte{0}, 4096)
+	tail := []byte("end of the image")
+	content := append(bytes.Repeat(block, 3), tail...)
+	id := initUpload(t, s, "disk.img", content)
+
+	for offset := 0; offset < 3*len(block); offset += len(block) {
+		if rec := sendChunk(s, id, offset, block, ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("chunk at %d: status = %d", offset, rec.Code)
+		}
+	}
+	if rec := sendChunk(s, id, 3*len(block), tail, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("last chunk: status = %d", rec.Code)
+	}
+
+	sess, _ := s.uploads.get(id)
+	files, err := os.ReadDir(sess.dir)
+	sess.mu.Unlock()
+	if err != nil || len(files) != 2 {
+		t.Errorf("%d chunk files for 2 distinct chunks (%v)", len(files), err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleUploadFinish(rec, uploadFormRequest("/upload/finish", url.Values{"upload_id": {id}}))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("finish: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	_, reader, err := s.storage.GetDrop(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var got bytes.Buffer
+	if _, err := got.ReadFrom(reader); err != nil || !bytes.Equal(got.Bytes(), content) {
+		t.Errorf("stored contents differ (%d bytes, %v)", got.Len(), err)
+	}
+}
+
+func TestResumableUpload_ChunkChecksum(t *testing.T) {
+	s := newResumableTestServer(t)
+	content := []byte("checked chunk")
+	id := initUpload(t, s, "a.txt", content)
+
+	wrong := sha256.Sum256([]byte("something else"))
+	rec := sendChunk(s, id, 0, content, "sha256 "+base64.StdEncoding.EncodeToString(wrong[:]))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("bad checksum: status = %d, want 400", rec.Code)
+	}
+	// The chunk was not kept
+	if rec := sendChunk(s, id, 0, content, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("resend: status = %d, want 204", rec.Code)
+	}
+}
+
+func TestResumableUpload_HashMismatch(t *testing.T) {
+	s := newResumableTestServer(t)
+	id := initUpload(t, s, "a.txt", []byte("declared contents"))
+
+	if rec := sendChunk(s, id, 0, []byte("different content"), ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("chunk: status = %d", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	s.handleUploadFinish(rec, uploadFormRequest("/upload/finish", url.Values{"upload_id": {id}}))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("finish: status = %d, want 400", rec.Code)
+	}
+	if sess, _ := s.uploads.get(id); sess != nil {
+		t.Error("mismatched upload kept")
+	}
+	drops := 0
+	if err := storage.WalkDrops(s.storage.StorageDir, func(string, string) error { drops++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if drops != 0 {
+		t.Errorf("%d drops stored from a mismatched upload", drops)
+	}
+}
+
+func TestResumableUpload_Refusals(t *testing.T) {
+	s := newResumableTestServer(t)
+	sum := sha256.Sum256(nil)
+
+	for _, tc := range []struct {
+		name string
+		form url.Values
+		want int
+	}{
+		{"too large", url.Values{"filename": {"a"}, "sha256": {hex.EncodeToString(sum[:])},
+			"size": {strconv.FormatInt(s.config().Server.MaxUploadMB*1024*1024+1, 10)}}, http.StatusRequestEntityTooLarge},
+		{"no hash", url.Values{"filename": {"a"}, "size": {"1"}}, http.StatusBadRequest},
+		{"negative size", url.Values{"filename": {"a"}, "size": {"-1"}, "sha256": {hex.EncodeToString(sum[:])}}, http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		s.handleUploadInit(rec, uploadFormRequest("/upload/init", tc.form))
+		if rec.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+
+	req := uploadFormRequest("/upload/init", url.Values{})
+	req.Header.Del("X-Dead-Drop-Upload")
+	rec := httptest.NewRecorder()
+	s.handleUploadInit(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("without header: status = %d, want 400", rec.Code)
+	}
+
+	if rec := sendChunk(s, "unknown", 0, []byte("x"), ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown upload: status = %d, want 404", rec.Code)
+	}
+
+	id := initUpload(t, s, "a.txt", []byte("contents"))
+	if rec := sendChunk(s, id, 0, nil, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty chunk: status = %d, want 400", rec.Code)
+	}
+	sess, _ := s.uploads.get(id)
+	if sess == nil {
+		t.Fatal("upload lost")
+	}
+	defer sess.mu.Unlock()
+	if len(sess.parts) != 0 {
+		t.Errorf("empty chunk kept as %d parts", len(sess.parts))
+	}
+}
+
+func TestUploadSessions_Expire(t *testing.T) {
+	uploads, err := newUploadSessions(filepath.Join(t.TempDir(), ".uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	uploads.now = func() time.Time { return now }
+
+	sess, err := uploads.start("a.txt", "", 10, make([]byte, sha256.Size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := sess.dir
+
+	now = now.Add(uploadSessionTTL + time.Minute)
+	uploads.expire()
+	if got, _ := uploads.get(sess.id); got != nil {
+		t.Error("idle upload not expired")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expired upload's files not removed")
+	}
+}
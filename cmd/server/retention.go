@@ -0,0 +1,109 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// retentionClasses converts the configured retention classes to storage rules.
+func retentionClasses(cfg *config.Config) map[string]storage.RetentionClass {
+	if len(cfg.Retention.Classes) == 0 {
+		return nil
+	}
+	classes := make(map[string]storage.RetentionClass, len(cfg.Retention.Classes))
+	for name, c := range cfg.Retention.Classes {
+		classes[name] = storage.RetentionClass{
+			MaxAge:        time.Duration(c.MaxAgeHours) * time.Hour,
+			BurnAfterRead: c.BurnAfterRead,
+			PinnedReview:  c.PinnedReview,
+		}
+	}
+	return classes
+}
+
+// selectableClasses returns the retention classes sources may choose at upload.
+func (s *Server) selectableClasses() []string {
+	var names []string
+	for name, c := range s.config().Retention.Classes {
+		if c.Selectable {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// campaignCode returns code if it names a configured campaign, or "" so that
+// arbitrary source-supplied strings never reach storage.
+func (s *Server) campaignCode(code string) string {
+	if _, ok := s.config().Campaigns[code]; ok {
+		return code
+	}
+	return ""
+}
+
+// defaultCampaignWindow applies when a campaign's window_hours is unset.
+const defaultCampaignWindow = 24 * time.Hour
+
+// campaignFull reports whether a campaign has reached its max_drops: that
+// many of its drops received within its window are still stored. Uploads
+// in flight are not counted, so concurrent ones may overshoot the limit; it
+// is meant to contain mass spam under a published code, not to be exact.
+func (s *Server) campaignFull(campaign string) bool {
+	c, ok := s.config().Campaigns[campaign]
+	if !ok || c.MaxDrops <= 0 {
+		return false
+	}
+	window := time.Duration(c.WindowHours) * time.Hour
+	if window <= 0 {
+		window = defaultCampaignWindow
+	}
+	// Drop times are rounded down to the hour, and so is the window start
+	since := time.Now().Add(-window).Truncate(time.Hour)
+	n, err := s.storage.CampaignDropsSince(campaign, since)
+	if err != nil {
+		// The save fails anyway while storage is locked
+		return false
+	}
+	return n >= c.MaxDrops
+}
+
+// retentionClass picks the class for an upload: a selectable class the source
+// asked for, then the campaign's class, then the class for the file type,
+// then the default. Unknown or non-selectable requests are ignored rather
+// than rejected, so they reveal nothing about the configuration.
+func (s *Server) retentionClass(requested, campaign, filename string) string {
+	rc := s.config().Retention
+	if c, ok := rc.Classes[requested]; ok && c.Selectable {
+		return requested
+	}
+	if class := s.config().Campaigns[campaign].Retention; class != "" {
+		return class
+	}
+	if class, ok := rc.FileTypes[strings.ToLower(filepath.Ext(filename))]; ok {
+		return class
+	}
+	return rc.DefaultClass
+}
+
+// uploadExpiry reads the expires_hours upload field: the hours after which
+// the source wants the drop deleted, shortened to security.max_expires_hours.
+// It returns 0 when the field is empty or sources may not choose an expiry,
+// and false when the field is not a whole number of hours from 1.
+func (s *Server) uploadExpiry(requested string) (int, bool) {
+	limit := s.config().Security.MaxExpiresHours
+	if requested == "" || limit <= 0 {
+		return 0, true
+	}
+	hours, err := strconv.Atoi(requested)
+	if err != nil || hours < 1 {
+		return 0, false
+	}
+	return min(hours, limit), true
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+)
+
+func newRetentionTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newTestServer(t)
+	s.config().Retention = config.RetentionConfig{
+		DefaultClass: "standard",
+		Classes: map[string]config.RetentionClassConfig{
+			"standard":  {MaxAgeHours: 168},
+			"sensitive": {MaxAgeHours: 24, BurnAfterRead: true, Selectable: true},
+			"archive":   {MaxAgeHours: 720, PinnedReview: true},
+		},
+		FileTypes: map[string]string{".pdf": "archive"},
+	}
+	s.config().Campaigns = map[string]config.CampaignConfig{
+		"tips": {Retention: "sensitive"},
+	}
+	s.storage.Retention = retentionClasses(s.config())
+	return s
+}
+
+func TestRetentionClass_Precedence(t *testing.T) {
+	s := newRetentionTestServer(t)
+
+	tests := []struct {
+		name, requested, campaign, filename, want string
+	}{
+		{"default", "", "", "notes.txt", "standard"},
+		{"file type", "", "", "report.PDF", "archive"},
+		{"campaign over file type", "", "tips", "report.pdf", "sensitive"},
+		{"selectable request", "sensitive", "", "report.pdf", "sensitive"},
+		{"non-selectable request ignored", "archive", "", "notes.txt", "standard"},
+		{"unknown request ignored", "bogus", "", "notes.txt", "standard"},
+	}
+	for _, tt := range tests {
+		if got := s.retentionClass(tt.requested, tt.campaign, tt.filename); got != tt.want {
+			t.Errorf("%s: retentionClass = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleSubmit_RecordsRetentionAndCampaign(t *testing.T) {
+	s := newRetentionTestServer(t)
+
+	body, ct := createMultipartForm(t, "test.txt", []byte("data"), map[string]string{"campaign": "tips"})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("submit status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	meta, err := s.storage.GetDropMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Campaign != "tips" || meta.Retention != "sensitive" {
+		t.Errorf("metadata campaign=%q retention=%q, want tips/sensitive", meta.Campaign, meta.Retention)
+	}
+
+	// Unknown campaign codes are not stored
+	body, ct = createMultipartForm(t, "test.txt", []byte("data"), map[string]string{"campaign": "made-up"})
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	meta, err = s.storage.GetDropMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Campaign != "" || meta.Retention != "standard" {
+		t.Errorf("metadata campaign=%q retention=%q, want empty/standard", meta.Campaign, meta.Retention)
+	}
+}
+
+func TestHandleRetrieve_BurnAfterReadClass(t *testing.T) {
+	s := newRetentionTestServer(t)
+
+	body, ct := createMultipartForm(t, "test.txt", []byte("data"), map[string]string{"retention": "sensitive"})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first retrieve: status = %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("second retrieve: status = %d, want 404 for burn-after-read class", rec.Code)
+	}
+}
+
+func TestHandleIndex_RetentionChoices(t *testing.T) {
+	s := newRetentionTestServer(t)
+	rec := httptest.NewRecorder()
+	s.handleIndex(rec, httptest.NewRequest(http.MethodGet, "/?campaign=tips", nil))
+
+	page := rec.Body.String()
+	if !strings.Contains(page, `<option value="sensitive">`) {
+		t.Error("selectable class should be offered")
+	}
+	if strings.Contains(page, `<option value="archive">`) {
+		t.Error("non-selectable class should not be offered")
+	}
+	if !strings.Contains(page, `name="campaign" id="campaign" value="tips"`) {
+		t.Error("known campaign code should be carried in the form")
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleIndex(rec, httptest.NewRequest(http.MethodGet, "/?campaign=%3Cscript%3E", nil))
+	if strings.Contains(rec.Body.String(), `name="campaign"`) {
+		t.Error("unknown campaign code should not be echoed")
+	}
+}
+
+func TestHandleSubmit_UploaderExpiry(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.MaxExpiresHours = 48
+
+	submit := func(hours string) (*httptest.ResponseRecorder, map[string]string) {
+		body, ct := createMultipartForm(t, "test.txt", []byte("data"), map[string]string{"expires_hours": hours})
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(body, ct))
+		var resp map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	for _, tt := range []struct{ requested, want string }{
+		{"12", "12"},
+		{"1000", "48"}, // shortened to the server's limit
+	} {
+		rec, resp := submit(tt.requested)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expires_hours=%s: status = %d: %s", tt.requested, rec.Code, rec.Body.String())
+		}
+		if resp["expires_hours"] != tt.want {
+			t.Errorf("expires_hours=%s: reply says %q, want %q", tt.requested, resp["expires_hours"], tt.want)
+		}
+		meta, err := s.storage.GetDropMetadata(resp["drop_id"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := (meta.ExpiresHour - meta.TimestampHour) / 3600; strconv.FormatInt(got, 10) != tt.want {
+			t.Errorf("expires_hours=%s: stored expiry is %d hours after receipt, want %s", tt.requested, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"0", "-3", "soon"} {
+		if rec, _ := submit(bad); rec.Code != http.StatusBadRequest {
+			t.Errorf("expires_hours=%s: status = %d, want 400", bad, rec.Code)
+		}
+	}
+
+	// Ignored when sources may not choose an expiry
+	s.config().Security.MaxExpiresHours = 0
+	rec, resp := submit("12")
+	if rec.Code != http.StatusOK || resp["expires_hours"] != "" {
+		t.Errorf("disabled: status = %d, expires_hours = %q", rec.Code, resp["expires_hours"])
+	}
+}
+
+func TestHandleSubmit_CampaignLimit(t *testing.T) {
+	s := newRetentionTestServer(t)
+	s.config().Campaigns["tips"] = config.CampaignConfig{Retention: "sensitive", MaxDrops: 2}
+
+	submit := func(campaign string) int {
+		body, ct := createMultipartForm(t, "test.txt", []byte("data"), map[string]string{"campaign": campaign})
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(body, ct))
+		return rec.Code
+	}
+	for i := 0; i < 2; i++ {
+		if code := submit("tips"); code != http.StatusOK {
+			t.Fatalf("upload %d: status = %d", i+1, code)
+		}
+	}
+	if code := submit("tips"); code != http.StatusServiceUnavailable {
+		t.Errorf("upload over the campaign limit: status = %d, want 503", code)
+	}
+	// Other sources are unaffected
+	if code := submit(""); code != http.StatusOK {
+		t.Errorf("upload without a campaign: status = %d, want 200", code)
+	}
+}
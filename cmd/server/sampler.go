@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// requestSample is one line of the sampled request log. It deliberately has
+// no field for addresses, drop IDs, receipts, tokens, or filenames: the route
+// is the registered pattern, not the requested path.
+type requestSample struct {
+	Hour       time.Time `json:"hour"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	DurationMS int64     `json:"duration_ms"`
+	ReqSize    string    `json:"request_size"`
+	RespSize   string    `json:"response_size"`
+}
+
+// requestSampler writes one in every n requests to a log for latency
+// debugging. Sampling is by count, so no request property decides it.
+type requestSampler struct {
+	n     uint64
+	count atomic.Uint64
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+func newRequestSampler(n int, w io.Writer) *requestSampler {
+	return &requestSampler{n: uint64(n), enc: json.NewEncoder(w), now: time.Now} // #nosec G115 -- n validated positive
+}
+
+// sizeBuckets are the upper bounds used to coarsen request and response
+// sizes, so logged sizes cannot single out a particular upload.
+var sizeBuckets = []struct {
+	limit int64
+	label string
+}{
+	{1, "0"},
+	{1 << 10, "<1KB"},
+	{64 << 10, "<64KB"},
+	{1 << 20, "<1MB"},
+	{16 << 20, "<16MB"},
+	{128 << 20, "<128MB"},
+}
+
+// sizeBucket returns the bucket label for n bytes, or "unknown" if n < 0.
+func sizeBucket(n int64) string {
+	if n < 0 {
+		return "unknown"
+	}
+	for _, b := range sizeBuckets {
+		if n < b.limit {
+			return b.label
+		}
+	}
+	return ">=128MB"
+}
+
+// sampledMethod returns method if it is a standard HTTP method and "OTHER"
+// otherwise, since clients may send arbitrary strings.
+func sampledMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// sampledWriter records the status and size of a response.
+type sampledWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *sampledWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sampledWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *sampledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// middleware logs every nth request passing through next.
+func (rs *requestSampler) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rs.count.Add(1)%rs.n != 0 {
+			next(w, r)
+			return
+		}
+
+		start := rs.now()
+		sw := &sampledWriter{ResponseWriter: w}
+		next(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		sample := requestSample{
+			Hour:       start.UTC().Truncate(time.Hour),
+			Method:     sampledMethod(r.Method),
+			Route:      r.Pattern,
+			Status:     sw.status,
+			DurationMS: rs.now().Sub(start).Milliseconds(),
+			ReqSize:    sizeBucket(r.ContentLength),
+			RespSize:   sizeBucket(sw.bytes),
+		}
+		rs.mu.Lock()
+		_ = rs.enc.Encode(sample)
+		rs.mu.Unlock()
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestSampler(t *testing.T) {
+	var out bytes.Buffer
+	rs := newRequestSampler(2, &out)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download/", rs.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("not found"))
+	}))
+
+	const token = "secret-token-value"
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/download/"+token, nil)
+		req.RemoteAddr = "198.51.100.4:80"
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d samples, want 2 (1 in 2 of 4 requests)", len(lines))
+	}
+	var sample requestSample
+	if err := json.Unmarshal([]byte(lines[0]), &sample); err != nil {
+		t.Fatal(err)
+	}
+	if sample.Method != http.MethodGet || sample.Route != "/download/" ||
+		sample.Status != http.StatusNotFound || sample.RespSize != "<1KB" || sample.ReqSize != "0" {
+		t.Errorf("unexpected sample: %+v", sample)
+	}
+	if sample.Hour.Minute() != 0 || sample.Hour.Second() != 0 {
+		t.Errorf("sample time %v not rounded to the hour", sample.Hour)
+	}
+	for _, leak := range []string{token, "198.51.100.4"} {
+		if strings.Contains(out.String(), leak) {
+			t.Errorf("request log contains %q", leak)
+		}
+	}
+}
+
+func TestSizeBucket(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{-1, "unknown"},
+		{0, "0"},
+		{1023, "<1KB"},
+		{1 << 20, "<16MB"},
+		{1 << 30, ">=128MB"},
+	}
+	for _, tt := range tests {
+		if got := sizeBucket(tt.n); got != tt.want {
+			t.Errorf("sizeBucket(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
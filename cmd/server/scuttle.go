@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// defaultScuttleWarning applies when scuttle.warn_hours is unset.
+const defaultScuttleWarning = 24 * time.Hour
+
+// scuttlePeriod returns how long the store may go without an operator
+// check-in, or 0 when the timer is off.
+func scuttlePeriod(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.Scuttle.AfterDays) * 24 * time.Hour
+}
+
+// scuttleWarning returns how long before the deadline missing check-ins are
+// warned about.
+func scuttleWarning(cfg *config.Config) time.Duration {
+	if cfg.Scuttle.WarnHours > 0 {
+		return time.Duration(cfg.Scuttle.WarnHours) * time.Hour
+	}
+	return defaultScuttleWarning
+}
+
+// scuttleDeadline returns when the store at storageDir is scuttled without
+// another check-in, or the zero time if the timer has not started.
+func scuttleDeadline(storageDir string, period time.Duration) (time.Time, error) {
+	last, err := storage.LastCheckIn(storageDir)
+	if err != nil || last.IsZero() {
+		return time.Time{}, err
+	}
+	return last.Add(period), nil
+}
+
+// prepareScuttle runs at startup, before any key is read. With the timer off
+// it forgets the last check-in, which could not be renewed meanwhile, so
+// that turning the timer back on starts it afresh. With it on, it starts
+// the timer if no operator has checked in yet, and scuttles the store if
+// the deadline passed while the server was stopped.
+func prepareScuttle(storageDir string, period time.Duration, now time.Time) error {
+	if period == 0 {
+		return storage.ClearCheckIn(storageDir)
+	}
+	last, err := storage.LastCheckIn(storageDir)
+	if err != nil {
+		return err
+	}
+	if last.IsZero() {
+		return storage.CheckIn(storageDir, now)
+	}
+	if now.Before(last.Add(period)) {
+		return nil
+	}
+	if err := storage.Scuttle(storageDir); err != nil {
+		log.Printf("Scuttle incomplete: %v", err)
+	}
+	return fmt.Errorf("no operator check-in since %s: storage scuttled", last.Format(time.RFC3339))
+}
+
+// checkScuttle scuttles the store if its deadline has passed, reporting
+// whether it did, and otherwise warns once an hour within the warning
+// period. warned holds when it last warned. A check-in gone missing while
+// the server runs starts the timer afresh, as at startup.
+func (s *Server) checkScuttle(now time.Time, warned *time.Time) bool {
+	storageDir := s.config().Server.StorageDir
+	deadline, err := scuttleDeadline(storageDir, scuttlePeriod(s.config()))
+	if err != nil {
+		// Logged whatever the logging settings, like the warnings
+		log.Printf("Failed to read operator check-in: %v", err)
+		return false
+	}
+	if deadline.IsZero() {
+		log.Printf("No operator check-in recorded: scuttle timer restarted")
+		if err := storage.CheckIn(storageDir, now); err != nil {
+			log.Printf("Failed to record check-in: %v", err)
+		}
+		return false
+	}
+	if !now.Before(deadline) {
+		log.Printf("No operator check-in by %s: scuttling storage", deadline.Format(time.RFC3339))
+		if err := s.storage.Scuttle(); err != nil {
+			log.Printf("Scuttle incomplete: %v", err)
+		}
+		return true
+	}
+	if deadline.Sub(now) <= scuttleWarning(s.config()) && now.Sub(*warned) >= time.Hour {
+		log.Printf("WARNING: storage will be scuttled at %s unless an operator checks in (dead-drop-admin checkin)", deadline.Format(time.RFC3339))
+		*warned = now
+	}
+	return false
+}
+
+// watchScuttle checks the deadline every minute until stop is closed, and
+// ends the process once the store is scuttled.
+func (s *Server) watchScuttle(stop <-chan struct{}) {
+	tick := time.NewTicker(time.Minute)
+	defer tick.Stop()
+
+	var warned time.Time
+	for {
+		select {
+		case now := <-tick.C:
+			if s.checkScuttle(now, &warned) {
+				log.Fatalf("Storage scuttled; the server will not start on %s again", s.config().Server.StorageDir)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
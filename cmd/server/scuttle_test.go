@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/audit"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func TestPrepareScuttle(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Second)
+	period := 7 * 24 * time.Hour
+
+	// The first start begins the timer
+	if err := prepareScuttle(dir, period, now); err != nil {
+		t.Fatal(err)
+	}
+	if last, _ := storage.LastCheckIn(dir); !last.Equal(now) {
+		t.Fatalf("LastCheckIn = %v, want %v", last, now)
+	}
+	if err := prepareScuttle(dir, period, now.Add(period-time.Minute)); err != nil {
+		t.Errorf("start before the deadline: %v", err)
+	}
+	if _, ok := storage.Scuttled(dir); ok {
+		t.Fatal("scuttled before the deadline")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "drop"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := prepareScuttle(dir, period, now.Add(period)); err == nil {
+		t.Fatal("start after the deadline should fail")
+	}
+	if _, ok := storage.Scuttled(dir); !ok {
+		t.Error("store not scuttled after the deadline")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "drop")); !os.IsNotExist(err) {
+		t.Errorf("drop survived the scuttle: %v", err)
+	}
+}
+
+func TestPrepareScuttle_TimerTurnedBackOn(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC().Truncate(time.Second)
+	period := 7 * 24 * time.Hour
+	if err := storage.CheckIn(dir, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Started with the timer off, the check-in cannot be renewed, so it is
+	// forgotten
+	if err := prepareScuttle(dir, 0, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if last, _ := storage.LastCheckIn(dir); !last.IsZero() {
+		t.Fatalf("check-in kept with the timer off: %v", last)
+	}
+
+	// Turned back on long after, the timer starts afresh
+	later := now.Add(30 * 24 * time.Hour)
+	if err := prepareScuttle(dir, period, later); err != nil {
+		t.Fatalf("timer turned back on: %v", err)
+	}
+	if _, ok := storage.Scuttled(dir); ok {
+		t.Fatal("scuttled when the timer was turned back on")
+	}
+	if last, _ := storage.LastCheckIn(dir); !last.Equal(later) {
+		t.Errorf("LastCheckIn = %v, want %v", last, later)
+	}
+}
+
+func TestCheckScuttle_MissingCheckIn(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Scuttle.AfterDays = 2
+	id := saveTestDrop(t, s)
+	dir := s.config().Server.StorageDir
+	if err := storage.ClearCheckIn(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	var warned time.Time
+	if s.checkScuttle(now, &warned) {
+		t.Fatal("scuttled for a missing check-in")
+	}
+	if _, _, err := s.storage.GetDrop(id); err != nil {
+		t.Errorf("drop unreadable: %v", err)
+	}
+	if last, _ := storage.LastCheckIn(dir); !last.Equal(now) {
+		t.Errorf("LastCheckIn = %v, want the timer restarted at %v", last, now)
+	}
+	if !warned.IsZero() {
+		t.Error("warned for a timer just started")
+	}
+}
+
+func TestCheckScuttle(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Scuttle.AfterDays = 2
+	id := saveTestDrop(t, s)
+	now := time.Now()
+	if err := storage.CheckIn(s.config().Server.StorageDir, now); err != nil {
+		t.Fatal(err)
+	}
+
+	var warned time.Time
+	if s.checkScuttle(now.Add(24*time.Hour+time.Minute), &warned) {
+		t.Fatal("scuttled inside the warning period")
+	}
+	if warned.IsZero() {
+		t.Error("no warning inside the warning period")
+	}
+	if !s.checkScuttle(now.Add(48*time.Hour), &warned) {
+		t.Fatal("not scuttled at the deadline")
+	}
+	if _, _, err := s.storage.GetDrop(id); err == nil {
+		t.Error("drop still readable after the scuttle")
+	}
+}
+
+func TestAdmin_CheckIn(t *testing.T) {
+	a, auditPath := newTestAdmin(t)
+	cfg := a.server.config()
+
+	if rec := adminDo(t, a, http.MethodPost, "/admin/v1/checkin", aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("disabled timer: status = %d, want 404", rec.Code)
+	}
+
+	cfg.Scuttle.AfterDays = 1
+	if err := storage.CheckIn(cfg.Server.StorageDir, time.Now().Add(-23*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	rec := adminDo(t, a, http.MethodGet, "/admin/v1/checkin", aliceToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Dead-Drop-Scuttle-Deadline") == "" {
+		t.Error("no deadline warning within the warning period")
+	}
+
+	rec = adminDo(t, a, http.MethodPost, "/admin/v1/checkin", bobToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("check-in status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("X-Dead-Drop-Scuttle-Deadline") != "" {
+		t.Error("deadline warning survives the check-in")
+	}
+	var status checkInStatus
+	json.Unmarshal(rec.Body.Bytes(), &status)
+	if time.Since(status.LastCheckIn) > time.Minute || status.Deadline.Sub(status.LastCheckIn) != 24*time.Hour {
+		t.Errorf("status = %+v", status)
+	}
+
+	entries, err := audit.Verify(auditPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != "checkin" || entries[0].Actor != "bob" {
+		t.Errorf("audit trail = %+v, want bob's check-in", entries)
+	}
+}
@@ -2,17 +2,29 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"filippo.io/age"
 
 	"github.com/scttfrdmn/dead-drop/internal/config"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/incidents"
 	"github.com/scttfrdmn/dead-drop/internal/metadata"
 	"github.com/scttfrdmn/dead-drop/internal/monitoring"
+	"github.com/scttfrdmn/dead-drop/internal/notify"
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
 	"github.com/scttfrdmn/dead-drop/internal/storage"
 	"github.com/scttfrdmn/dead-drop/internal/validation"
 )
@@ -30,13 +42,21 @@ func newTestServer(t *testing.T) *Server {
 	sm.SecureDelete = false
 	t.Cleanup(sm.Close)
 
-	return &Server{
+	csrf, err := newCSRFTokens(0)
+	if err != nil {
+		t.Fatalf("newCSRFTokens error: %v", err)
+	}
+
+	s := &Server{
 		storage:   sm,
-		config:    cfg,
-		validator: validation.NewValidator(cfg.Server.MaxUploadMB),
 		scrubber:  metadata.NewScrubber(),
 		metrics:   monitoring.NewMetrics(),
+		csrf:      csrf,
+		downloads: newDownloadTokens(0),
 	}
+	s.cfg.Store(cfg)
+	s.checks.Store(validation.NewValidator(cfg.Server.MaxUploadMB))
+	return s
 }
 
 func createMultipartFile(t *testing.T, fieldName, filename string, content []byte) (*bytes.Buffer, string) {
@@ -54,6 +74,44 @@ func createMultipartFile(t *testing.T, fieldName, filename string, content []byt
 	return &buf, writer.FormDataContentType()
 }
 
+func createMultipartForm(t *testing.T, filename string, content []byte, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range fields {
+		if err := writer.WriteField(k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	return &buf, writer.FormDataContentType()
+}
+
+func submitRequest(body io.Reader, contentType string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/submit", body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	return req
+}
+
+func randomBlob(t *testing.T, n int) []byte {
+	t.Helper()
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	// Ensure the blob isn't sniffed as a known file type
+	copy(data, []byte{0x00, 0x01, 0x02, 0x03})
+	return data
+}
+
 func retrieveRequest(t *testing.T, dropID, receipt string) *http.Request {
 	t.Helper()
 	form := strings.NewReader("id=" + dropID + "&receipt=" + receipt)
@@ -126,6 +184,75 @@ func TestHandleSubmit_FullUpload(t *testing.T) {
 	}
 }
 
+func TestHandleSubmit_NewDropWebhook(t *testing.T) {
+	secret := bytes.Repeat([]byte("s"), 32)
+	bodies := make(chan []byte, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer hook.Close()
+
+	s := newTestServer(t)
+	notifier, err := notify.New(hook.URL, secret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.notifier = notifier
+
+	body, contentType := createMultipartFile(t, "file", "report.pdf", []byte("%PDF-1.4 hello"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, contentType))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	select {
+	case b := <-bodies:
+		e, err := notify.Open(secret, b)
+		if err != nil {
+			t.Fatalf("Open error: %v", err)
+		}
+		if e.Event != notify.EventNewDrop || e.Campaign != "" || e.Hour.Minute() != 0 {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestHandleSubmit_ResponseFields(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"", []string{"drop_id", "receipt", "file_hash", "message"}},
+		{"no_hash", []string{"drop_id", "receipt", "message"}},
+		{"minimal", []string{"drop_id", "receipt"}},
+	}
+	for _, tt := range tests {
+		s := newTestServer(t)
+		s.config().Security.SubmitResponse = tt.mode
+		body, contentType := createMultipartFile(t, "file", "test.txt", []byte("hello world"))
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(body, contentType))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d, want 200", tt.mode, rec.Code)
+		}
+
+		var resp map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if len(resp) != len(tt.want) {
+			t.Errorf("%q: got fields %v, want %v", tt.mode, resp, tt.want)
+		}
+		for _, field := range tt.want {
+			if resp[field] == "" {
+				t.Errorf("%q: missing %s", tt.mode, field)
+			}
+		}
+	}
+}
+
 func TestHandleSubmit_CSRFRejection(t *testing.T) {
 	s := newTestServer(t)
 	body, contentType := createMultipartFile(t, "file", "test.txt", []byte("data"))
@@ -179,7 +306,7 @@ func TestHandleRetrieve_ValidReceipt(t *testing.T) {
 		t.Fatalf("status = %d, want 200, body: %s", rec.Code, rec.Body.String())
 	}
 
-	if ct := rec.Header().Get("Content-Type"); ct != "application/octet-stream" {
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
 		t.Errorf("Content-Type = %q", ct)
 	}
 
@@ -193,6 +320,193 @@ func TestHandleRetrieve_ValidReceipt(t *testing.T) {
 	}
 }
 
+func TestHandleRetrieve_ContentType(t *testing.T) {
+	s := newTestServer(t)
+
+	upload := func(declared string, content string) string {
+		t.Helper()
+		var buf bytes.Buffer
+		writer := multipart.NewWriter(&buf)
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="file"; filename="upload"`)
+		h.Set("Content-Type", declared)
+		part, err := writer.CreatePart(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write([]byte(content))
+		writer.Close()
+
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(&buf, writer.FormDataContentType()))
+		var resp map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("submit: %d %s", rec.Code, rec.Body)
+		}
+		return resp["drop_id"] + " " + resp["receipt"]
+	}
+	served := func(drop string) string {
+		t.Helper()
+		id, receipt, _ := strings.Cut(drop, " ")
+		rec := httptest.NewRecorder()
+		s.handleRetrieve(rec, retrieveRequest(t, id, receipt))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("retrieve status = %d", rec.Code)
+		}
+		return rec.Header().Get("Content-Type")
+	}
+
+	csv := upload("text/csv", "name,amount\nalice,3\n")
+	mislabeled := upload("application/pdf", "just some text\n")
+	page := upload("text/html", "<html><body>hello</body></html>")
+
+	// text/csv is recorded, being plain text, but is not served by default
+	if ct := served(csv); ct != "application/octet-stream" {
+		t.Errorf("csv served as %q", ct)
+	}
+	if ct := served(mislabeled); ct != "text/plain; charset=utf-8" {
+		t.Errorf("mislabeled text served as %q", ct)
+	}
+	if ct := served(page); ct != "application/octet-stream" {
+		t.Errorf("html served as %q", ct)
+	}
+
+	s.config().Security.ServeContentTypes = []string{"text/csv"}
+	if ct := served(csv); ct != "text/csv" {
+		t.Errorf("allowed csv served as %q", ct)
+	}
+	if ct := served(mislabeled); ct != "application/octet-stream" {
+		t.Errorf("text outside the allowlist served as %q", ct)
+	}
+}
+
+func TestHandleRetrieve_CredentialSources(t *testing.T) {
+	s := newTestServer(t)
+	drop, err := s.storage.SaveDrop("secret.txt", strings.NewReader("secret content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "/retrieve?id=" + drop.ID + "&receipt=" + drop.Receipt
+
+	retrieve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		s.handleRetrieve(rec, req)
+		return rec.Code
+	}
+
+	// Headers
+	req := httptest.NewRequest(http.MethodPost, "/retrieve", nil)
+	req.Header.Set(dropIDHeader, drop.ID)
+	req.Header.Set(receiptHeader, drop.Receipt)
+	if code := retrieve(req); code != http.StatusOK {
+		t.Errorf("header credentials: status = %d, want 200", code)
+	}
+
+	// Query string is ignored by default, for POST and GET alike
+	if code := retrieve(httptest.NewRequest(http.MethodPost, query, nil)); code != http.StatusBadRequest {
+		t.Errorf("query credentials on POST: status = %d, want 400", code)
+	}
+	if code := retrieve(httptest.NewRequest(http.MethodGet, query, nil)); code != http.StatusMethodNotAllowed {
+		t.Errorf("query credentials on GET: status = %d, want 405", code)
+	}
+
+	// ... unless the deprecated flag is set
+	s.config().Security.AllowQueryCredentials = true
+	if code := retrieve(httptest.NewRequest(http.MethodGet, query, nil)); code != http.StatusOK {
+		t.Errorf("deprecated query credentials: status = %d, want 200", code)
+	}
+}
+
+func TestHandleRetrieve_SealedToRecipient(t *testing.T) {
+	s := newTestServer(t)
+	drop, err := s.storage.SaveDrop("secret.txt", strings.NewReader("secret content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A malformed key is refused before the drop is touched
+	req := httptest.NewRequest(http.MethodPost, "/retrieve", nil)
+	req.Header.Set(dropIDHeader, drop.ID)
+	req.Header.Set(receiptHeader, drop.Receipt)
+	req.Header.Set(recipientKeyHeader, "bm90IGEga2V5")
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("malformed key: status = %d, want 400", rec.Code)
+	}
+
+	req.Header.Set(recipientKeyHeader, priv.Recipient().String())
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); strings.Contains(cd, "secret.txt") {
+		t.Errorf("Content-Disposition %q reveals the filename", cd)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Error("sealed response contains plaintext")
+	}
+
+	name, data, err := crypto.OpenSealedFile(priv, rec.Body)
+	if err != nil {
+		t.Fatalf("OpenSealedFile error: %v", err)
+	}
+	if name != "secret.txt" || string(data) != "secret content" {
+		t.Errorf("opened %q %q", name, data)
+	}
+}
+
+func TestHandleRetrieve_IntegrityTrailer(t *testing.T) {
+	s := newTestServer(t)
+	content := bytes.Repeat([]byte("large streamed drop "), 4096)
+	drop, err := s.storage.SaveDrop("big.txt", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Over a real connection, so that the trailer is chunk-encoded on the wire
+	ts := httptest.NewServer(http.HandlerFunc(s.handleRetrieve))
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/retrieve", nil)
+	req.Header.Set(dropIDHeader, drop.ID)
+	req.Header.Set(receiptHeader, drop.Receipt)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(body)
+	if got := resp.Trailer.Get(integrityTrailer); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("trailer = %q, want the SHA-256 of the body", got)
+	}
+	if !bytes.Equal(body, content) {
+		t.Error("body differs from the stored drop")
+	}
+
+	// A sealed download's trailer covers the sealed bytes as sent
+	priv, _ := age.GenerateX25519Identity()
+	sealed, _ := s.storage.SaveDrop("secret.txt", strings.NewReader("secret content"))
+	r := httptest.NewRequest(http.MethodPost, "/retrieve", nil)
+	r.Header.Set(dropIDHeader, sealed.ID)
+	r.Header.Set(receiptHeader, sealed.Receipt)
+	r.Header.Set(recipientKeyHeader, priv.Recipient().String())
+	rec := httptest.NewRecorder()
+	s.handleRetrieve(rec, r)
+	sum = sha256.Sum256(rec.Body.Bytes())
+	if got := rec.Result().Trailer.Get(integrityTrailer); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("sealed trailer = %q, want the SHA-256 of the sealed body", got)
+	}
+}
+
 func TestHandleRetrieve_InvalidReceipt(t *testing.T) {
 	s := newTestServer(t)
 
@@ -218,6 +532,57 @@ func TestHandleRetrieve_InvalidReceipt(t *testing.T) {
 	}
 }
 
+func TestHandleRetrieve_ReceiptAttempts(t *testing.T) {
+	s := newTestServer(t)
+	s.attempts = ratelimit.NewAttempts(3, time.Minute)
+	s.incidents = incidents.New(filepath.Join(t.TempDir(), "incidents"), func() ([]byte, error) {
+		return s.storage.SubKey("incidents")
+	})
+	drop, err := s.storage.SaveDrop("test.txt", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.storage.SaveDrop("other.txt", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retrieve := func(id, receipt string) int {
+		rec := httptest.NewRecorder()
+		s.handleRetrieve(rec, retrieveRequest(t, id, receipt))
+		return rec.Code
+	}
+	for i := range 3 {
+		if code := retrieve(drop.ID, "wrong"); code != http.StatusForbidden {
+			t.Fatalf("wrong receipt %d: status = %d, want 403", i+1, code)
+		}
+	}
+	// Refused even with the right receipt, until the lockout ends
+	if code := retrieve(drop.ID, drop.Receipt); code != http.StatusTooManyRequests {
+		t.Errorf("locked out drop: status = %d, want 429", code)
+	}
+	if code := retrieve(other.ID, other.Receipt); code != http.StatusOK {
+		t.Errorf("other drop: status = %d, want 200", code)
+	}
+
+	if err := s.incidents.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.incidents.Events(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range events {
+		if e.Kind == incidents.KindReceiptLockout {
+			found = e.DropID == drop.ID && e.Count == 1
+		}
+	}
+	if !found {
+		t.Errorf("events = %+v, want one receipt lockout for %s", events, drop.ID)
+	}
+}
+
 func TestHandleRetrieve_MissingParams(t *testing.T) {
 	s := newTestServer(t)
 
@@ -256,7 +621,7 @@ func TestHandleRetrieve_InvalidIDLength(t *testing.T) {
 
 func TestHandleRetrieve_DeleteAfterRetrieve(t *testing.T) {
 	s := newTestServer(t)
-	s.config.Security.DeleteAfterRetrieve = true
+	s.config().Security.DeleteAfterRetrieve = true
 
 	// Upload
 	body, contentType := createMultipartFile(t, "file", "one-time.txt", []byte("one-time data"))
@@ -288,6 +653,51 @@ func TestHandleRetrieve_DeleteAfterRetrieve(t *testing.T) {
 	}
 }
 
+func TestHandleRetrieve_Passphrase(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.DeleteAfterRetrieve = true
+
+	body, ct := createMultipartForm(t, "secret.txt", []byte("protected data"), map[string]string{"passphrase": "short"})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("short passphrase: status = %d, want 400", rec.Code)
+	}
+
+	body, ct = createMultipartForm(t, "secret.txt", []byte("protected data"), map[string]string{"passphrase": "correct horse"})
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp["passphrase_protected"] != "true" {
+		t.Fatalf("submit: status = %d, reply %v", rec.Code, resp)
+	}
+
+	retrieve := func(passphrase string) *httptest.ResponseRecorder {
+		req := retrieveRequest(t, resp["drop_id"], resp["receipt"])
+		if passphrase != "" {
+			req.Header.Set(passphraseHeader, passphrase)
+		}
+		rec := httptest.NewRecorder()
+		s.handleRetrieve(rec, req)
+		return rec
+	}
+
+	// Neither a missing nor a wrong passphrase burns the drop
+	for _, passphrase := range []string{"", "wrong horse"} {
+		if rec := retrieve(passphrase); rec.Code != http.StatusForbidden {
+			t.Errorf("passphrase %q: status = %d, want 403", passphrase, rec.Code)
+		}
+	}
+	rec = retrieve("correct horse")
+	if rec.Code != http.StatusOK || rec.Body.String() != "protected data" {
+		t.Fatalf("correct passphrase: status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	if rec := retrieve("correct horse"); rec.Code != http.StatusNotFound {
+		t.Errorf("after retrieval: status = %d, want 404", rec.Code)
+	}
+}
+
 func TestHandleSubmit_QuotaEnforcement(t *testing.T) {
 	s := newTestServer(t)
 
@@ -318,8 +728,20 @@ func TestHandleSubmit_QuotaEnforcement(t *testing.T) {
 	rec = httptest.NewRecorder()
 	s.handleSubmit(rec, req)
 
-	if rec.Code != http.StatusInternalServerError {
-		t.Errorf("second upload: status = %d, want 500", rec.Code)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("second upload: status = %d, Retry-After %q; want 503 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// The status is configurable
+	s.config().Security.QuotaFullStatus = http.StatusInsufficientStorage
+	body, ct = createMultipartFile(t, "file", "third.txt", []byte("third"))
+	req = httptest.NewRequest(http.MethodPost, "/submit", body)
+	req.Header.Set("Content-Type", ct)
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	rec = httptest.NewRecorder()
+	s.handleSubmit(rec, req)
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("third upload: status = %d, want 507", rec.Code)
 	}
 }
 
@@ -420,6 +842,37 @@ func TestLocalhostOnly_BlocksExternal(t *testing.T) {
 	}
 }
 
+func TestBearerOnly(t *testing.T) {
+	const token = "metrics-token-0123456789abcdef0123"
+	handler := bearerOnly(token, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{token, http.StatusUnauthorized},
+		{"Bearer " + token, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.RemoteAddr = "10.0.0.1:5555"
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("Authorization %q: status = %d, want %d", tc.header, rec.Code, tc.want)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Error("401 should carry WWW-Authenticate: Bearer")
+		}
+	}
+}
+
 func TestSecurityHeaders_AllPresent(t *testing.T) {
 	s := newTestServer(t)
 
@@ -602,7 +1055,7 @@ func TestHandleSubmit_NoFile(t *testing.T) {
 
 func TestHandleSubmit_WithMetadataScrubbing(t *testing.T) {
 	s := newTestServer(t)
-	s.config.Security.ScrubMetadata = true
+	s.config().Security.ScrubMetadata = true
 
 	body, ct := createMultipartFile(t, "file", "photo.jpg", []byte("not really a jpeg"))
 	req := httptest.NewRequest(http.MethodPost, "/submit", body)
@@ -617,10 +1070,74 @@ func TestHandleSubmit_WithMetadataScrubbing(t *testing.T) {
 	}
 }
 
+func TestHandleSubmit_ScrubRejectsInvalidPNG(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.ScrubMetadata = true
+	s.scrubber = newScrubber(s.config())
+
+	// PNG signature and an IHDR chunk with a zero CRC
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	png = append(png, make([]byte, 13+4)...)
+
+	body, ct := createMultipartFile(t, "file", "image.png", png)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if drops, _ := s.storage.Drops(); len(drops) != 0 {
+		t.Errorf("%d drops stored, want 0", len(drops))
+	}
+}
+
+func TestHandleSubmit_ScrubRecordsProfile(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.ScrubMetadata = true
+	s.config().Scrubbers.StrictJPEG = true
+	s.scrubber = newScrubber(s.config())
+
+	jpeg := []byte{
+		0xFF, 0xD8,
+		0xFF, 0xE2, 0x00, 0x10, 'I', 'C', 'C', '_', 'P', 'R', 'O', 'F', 'I', 'L', 'E', 0x00, 0x01, 0x01,
+		0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9,
+	}
+	body, ct := createMultipartFile(t, "file", "photo.jpg", jpeg)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.storage.Inspect(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Scrubbed != "strict" {
+		t.Errorf("Scrubbed = %q, want strict", info.Scrubbed)
+	}
+	_, rc, err := s.storage.GetDrop(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("ICC_PROFILE")) {
+		t.Error("strict scrub kept the ICC profile")
+	}
+}
+
 func TestHandleSubmit_WithLogging(t *testing.T) {
 	s := newTestServer(t)
-	s.config.Logging.Errors = true
-	s.config.Logging.Operations = true
+	s.config().Logging.Errors = true
+	s.config().Logging.Operations = true
 
 	body, ct := createMultipartFile(t, "file", "test.txt", []byte("logged upload"))
 	req := httptest.NewRequest(http.MethodPost, "/submit", body)
@@ -637,9 +1154,9 @@ func TestHandleSubmit_WithLogging(t *testing.T) {
 
 func TestHandleRetrieve_WithDeleteLogging(t *testing.T) {
 	s := newTestServer(t)
-	s.config.Security.DeleteAfterRetrieve = true
-	s.config.Logging.Errors = true
-	s.config.Logging.Operations = true
+	s.config().Security.DeleteAfterRetrieve = true
+	s.config().Logging.Errors = true
+	s.config().Logging.Operations = true
 
 	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
 	req := httptest.NewRequest(http.MethodPost, "/submit", body)
@@ -679,7 +1196,7 @@ func TestLocalhostOnly_InvalidRemoteAddr(t *testing.T) {
 
 func TestHandleSubmit_ValidationFailedWithLogging(t *testing.T) {
 	s := newTestServer(t)
-	s.config.Logging.Errors = true
+	s.config().Logging.Errors = true
 
 	// Upload a shell script
 	body, ct := createMultipartFile(t, "file", "evil.sh", []byte("#!/bin/sh\nrm -rf /"))
@@ -695,5 +1212,64 @@ func TestHandleSubmit_ValidationFailedWithLogging(t *testing.T) {
 	}
 }
 
+func TestHandleSubmit_EntropyReject(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.EntropyCheck = "reject"
+
+	body, ct := createMultipartForm(t, "blob.bin", randomBlob(t, 32*1024), nil)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400 for undeclared opaque upload", rec.Code)
+	}
+}
+
+func TestHandleSubmit_EntropyDeclaredEncrypted(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.EntropyCheck = "reject"
+
+	body, ct := createMultipartForm(t, "blob.bin", randomBlob(t, 32*1024), map[string]string{"client_encrypted": "true"})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 for declared encrypted upload", rec.Code)
+	}
+
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	meta, err := s.storage.GetDropMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.ClientEncrypted {
+		t.Error("ClientEncrypted should be recorded in metadata")
+	}
+}
+
+func TestHandleSubmit_EntropyFlag(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.EntropyCheck = "flag"
+
+	body, ct := createMultipartForm(t, "blob.bin", randomBlob(t, 32*1024), nil)
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 in flag mode", rec.Code)
+	}
+
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	meta, err := s.storage.GetDropMetadata(resp["drop_id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Flags) != 1 || meta.Flags[0] != storage.FlagHighEntropy {
+		t.Errorf("Flags = %v, want [%s]", meta.Flags, storage.FlagHighEntropy)
+	}
+}
+
 // Silence the unused import warning for io
 var _ = io.Discard
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockSignals trigger an immediate re-lock when the server runs locked-start.
+var lockSignals = []os.Signal{syscall.SIGUSR1}
+
+// reloadSignals re-read the config file.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
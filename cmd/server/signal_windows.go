@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// lockSignals is empty on Windows, which has no SIGUSR1; use the idle
+// timeout instead.
+var lockSignals []os.Signal
+
+// reloadSignals is empty on Windows, which has no SIGHUP; reload through
+// the admin API instead.
+var reloadSignals []os.Signal
@@ -1,52 +1,671 @@
+// Bytes read from the start of the file for type detection and metadata checks.
+// Inspection happens entirely in the browser; nothing is sent until confirmed.
+const INSPECT_BYTES = 1024 * 1024;
+
+function formatSize(bytes) {
+    if (bytes < 1024) return bytes + ' B';
+    if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB';
+    return (bytes / (1024 * 1024)).toFixed(1) + ' MB';
+}
+
+function startsWith(bytes, signature) {
+    if (bytes.length < signature.length) return false;
+    return signature.every((b, i) => bytes[i] === b);
+}
+
+function detectType(bytes, file) {
+    if (startsWith(bytes, [0xFF, 0xD8, 0xFF])) return 'JPEG image';
+    if (startsWith(bytes, [0x89, 0x50, 0x4E, 0x47])) return 'PNG image';
+    if (startsWith(bytes, [0x47, 0x49, 0x46, 0x38])) return 'GIF image';
+    if (startsWith(bytes, [0x25, 0x50, 0x44, 0x46])) return 'PDF document';
+    if (startsWith(bytes, [0x50, 0x4B, 0x03, 0x04])) return 'ZIP archive or Office document';
+    return file.type || 'unknown';
+}
+
+function findJPEGMetadata(bytes) {
+    const found = [];
+    let i = 2;
+    while (i + 4 <= bytes.length && bytes[i] === 0xFF) {
+        const marker = bytes[i + 1];
+        if (marker === 0xDA || marker === 0xD9) break;
+        const len = (bytes[i + 2] << 8) | bytes[i + 3];
+        if (marker === 0xE1) {
+            const id = String.fromCharCode(...bytes.subarray(i + 4, i + 8));
+            found.push(id === 'Exif' ? 'EXIF data (may include GPS location, camera serial, timestamps)' : 'XMP data');
+        } else if (marker === 0xED) {
+            found.push('IPTC/Photoshop data');
+        } else if (marker === 0xFE) {
+            found.push('JPEG comment');
+        }
+        i += 2 + len;
+    }
+    return found;
+}
+
+function findPNGMetadata(bytes) {
+    const found = [];
+    let i = 8;
+    while (i + 8 <= bytes.length) {
+        const len = ((bytes[i] << 24) | (bytes[i + 1] << 16) | (bytes[i + 2] << 8) | bytes[i + 3]) >>> 0;
+        const type = String.fromCharCode(...bytes.subarray(i + 4, i + 8));
+        if (type === 'tEXt' || type === 'iTXt' || type === 'zTXt') found.push('Text chunk (' + type + ')');
+        if (type === 'eXIf') found.push('EXIF data (may include GPS location, camera serial, timestamps)');
+        if (type === 'tIME') found.push('Modification time');
+        if (type === 'IEND') break;
+        i += 12 + len;
+    }
+    return found;
+}
+
+function findTextMarkers(bytes, markers) {
+    const text = new TextDecoder('latin1').decode(bytes);
+    return markers.filter(([needle]) => text.includes(needle)).map(([, label]) => label);
+}
+
+function inspectMetadata(bytes, type) {
+    let found = [];
+    if (type === 'JPEG image') found = findJPEGMetadata(bytes);
+    else if (type === 'PNG image') found = findPNGMetadata(bytes);
+    else if (type === 'PDF document') {
+        found = findTextMarkers(bytes, [
+            ['/Author', 'Author'],
+            ['/Creator', 'Creating application'],
+            ['/Producer', 'Producing software'],
+            ['/CreationDate', 'Creation date'],
+            ['<x:xmpmeta', 'XMP data'],
+        ]);
+    } else if (type === 'ZIP archive or Office document') {
+        found = findTextMarkers(bytes, [
+            ['docProps/core.xml', 'Office document properties (author, last modified by)'],
+            ['docProps/app.xml', 'Office application properties'],
+            ['meta.xml', 'OpenDocument metadata'],
+        ]);
+    }
+    return [...new Set(found)];
+}
+
+// Upload envelopes (security.upload_envelope): the upload is sealed with
+// HPKE (RFC 9180, base mode) using DHKEM(X25519, HKDF-SHA256), HKDF-SHA256
+// and AES-256-GCM, built from WebCrypto primitives, and the reply comes back
+// under a key from the HPKE exporter. A proxy terminating TLS in between
+// sees neither the file nor the receipt.
+const ENVELOPE_TYPE = 'application/x-dead-drop-envelope';
+const utf8 = new TextEncoder();
+const KEM_SUITE = concatBytes(utf8.encode('KEM'), [0x00, 0x20]);
+const HPKE_SUITE = concatBytes(utf8.encode('HPKE'), [0x00, 0x20, 0x00, 0x01, 0x00, 0x02]);
+
+function concatBytes(...parts) {
+    const out = new Uint8Array(parts.reduce((n, p) => n + p.length, 0));
+    let offset = 0;
+    for (const part of parts) {
+        out.set(part, offset);
+        offset += part.length;
+    }
+    return out;
+}
+
+async function hmac(key, data) {
+    // An empty HKDF salt stands for HashLen zero bytes (RFC 5869)
+    const k = await crypto.subtle.importKey('raw', key.length ? key : new Uint8Array(32),
+        {name: 'HMAC', hash: 'SHA-256'}, false, ['sign']);
+    return new Uint8Array(await crypto.subtle.sign('HMAC', k, data));
+}
+
+function labeledExtract(suite, salt, label, ikm) {
+    return hmac(salt, concatBytes(utf8.encode('HPKE-v1'), suite, utf8.encode(label), ikm));
+}
+
+async function labeledExpand(suite, prk, label, info, length) {
+    // A single HMAC block covers every length used here (at most 32 bytes)
+    const labeled = concatBytes([0, length], utf8.encode('HPKE-v1'), suite, utf8.encode(label), info, [1]);
+    return (await hmac(prk, labeled)).slice(0, length);
+}
+
+// sealEnvelope encrypts plaintext to the server's X25519 key and returns
+// the envelope (encapsulated key and ciphertext) and the reply key.
+async function sealEnvelope(publicKey, plaintext) {
+    if (!window.crypto || !crypto.subtle) {
+        throw new Error('this browser cannot encrypt the upload');
+    }
+    const empty = new Uint8Array(0);
+    const recipient = await crypto.subtle.importKey('raw', publicKey, {name: 'X25519'}, false, []);
+    const ephemeral = await crypto.subtle.generateKey({name: 'X25519'}, true, ['deriveBits']);
+    const enc = new Uint8Array(await crypto.subtle.exportKey('raw', ephemeral.publicKey));
+    const dh = new Uint8Array(await crypto.subtle.deriveBits({name: 'X25519', public: recipient}, ephemeral.privateKey, 256));
+    const eaePRK = await labeledExtract(KEM_SUITE, empty, 'eae_prk', dh);
+    const shared = await labeledExpand(KEM_SUITE, eaePRK, 'shared_secret', concatBytes(enc, publicKey), 32);
+
+    const context = concatBytes([0x00],
+        await labeledExtract(HPKE_SUITE, empty, 'psk_id_hash', empty),
+        await labeledExtract(HPKE_SUITE, empty, 'info_hash', utf8.encode('dead-drop-upload-v1')));
+    const secret = await labeledExtract(HPKE_SUITE, shared, 'secret', empty);
+    const key = await labeledExpand(HPKE_SUITE, secret, 'key', context, 32);
+    const nonce = await labeledExpand(HPKE_SUITE, secret, 'base_nonce', context, 12);
+    const exporter = await labeledExpand(HPKE_SUITE, secret, 'exp', context, 32);
+    const replyKey = await labeledExpand(HPKE_SUITE, exporter, 'sec', utf8.encode('dead-drop-reply-v1'), 32);
+
+    const aesKey = await crypto.subtle.importKey('raw', key, 'AES-GCM', false, ['encrypt']);
+    const ciphertext = await crypto.subtle.encrypt({name: 'AES-GCM', iv: nonce}, aesKey, plaintext);
+    return {envelope: concatBytes(enc, new Uint8Array(ciphertext)), replyKey};
+}
+
+// openReply decrypts the server's sealed reply; each reply key is used once,
+// so the nonce is all zeros.
+async function openReply(replyKey, sealed) {
+    const key = await crypto.subtle.importKey('raw', replyKey, 'AES-GCM', false, ['decrypt']);
+    return new Uint8Array(await crypto.subtle.decrypt({name: 'AES-GCM', iv: new Uint8Array(12)}, key, sealed));
+}
+
+// FINGERPRINT_CONTEXT matches crypto.KeyFingerprint on the server.
+const FINGERPRINT_CONTEXT = 'dead-drop-key-fingerprint-v1\n';
+
+async function keyFingerprint(raw) {
+    const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', concatBytes(utf8.encode(FINGERPRINT_CONTEXT), raw)));
+    return Array.from(digest.slice(0, 16), (b) => b.toString(16).padStart(2, '0')).join('');
+}
+
+// With security.rate_limit_mode pow, a request through the hidden service
+// spends a proof-of-work token instead of counting against the address all
+// its visitors share. powToken solves a challenge for one request, or
+// returns null when none is asked for; the request is then counted as
+// before.
+async function powToken() {
+    const url = document.getElementById('uploadForm').dataset.powUrl;
+    if (!url || !window.crypto || !crypto.subtle) {
+        return null;
+    }
+    const response = await fetch(url);
+    if (!response.ok) {
+        return null;
+    }
+    const {challenge, difficulty} = await response.json();
+    for (let n = 0; ; n++) {
+        const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', utf8.encode(challenge + ':' + n)));
+        let zeros = 0;
+        for (const b of digest) {
+            zeros += b === 0 ? 8 : Math.clz32(b) - 24;
+            if (b !== 0) break;
+        }
+        if (zeros >= difficulty) {
+            return challenge + ':' + n;
+        }
+    }
+}
+
+// encryptLocally encrypts a file under a new AES-256-GCM key, in the format
+// dead-drop-unseal -drop-key reads (nonce, then ciphertext and tag, no AAD),
+// and returns the ciphertext, the base64 key and the key's fingerprint.
+async function encryptLocally(file) {
+    if (!window.crypto || !crypto.subtle) {
+        throw new Error('this browser cannot encrypt the upload');
+    }
+    const raw = crypto.getRandomValues(new Uint8Array(32));
+    const nonce = crypto.getRandomValues(new Uint8Array(12));
+    const key = await crypto.subtle.importKey('raw', raw, 'AES-GCM', false, ['encrypt']);
+    const ciphertext = await crypto.subtle.encrypt({name: 'AES-GCM', iv: nonce}, key, await file.arrayBuffer());
+    return {
+        blob: new Blob([nonce, ciphertext]),
+        key: btoa(String.fromCharCode(...raw)),
+        fingerprint: await keyFingerprint(raw)
+    };
+}
+
+// Sealing to the receivers' key (security.recipient_key) follows
+// crypto.SealFile: an age file (age-encryption.org/v1) for the receivers'
+// X25519 recipient, with the file's name in a dead-drop-name header stanza
+// that age itself skips. dead-drop-unseal opens the result, as does
+// `age -d`. WebCrypto has X25519, HKDF and HMAC but not the
+// ChaCha20-Poly1305 age uses, which is written out below (RFC 8439).
+const AGE_INTRO = 'age-encryption.org/v1\n';
+const AGE_X25519_INFO = utf8.encode('age-encryption.org/v1/X25519');
+const AGE_CHUNK = 64 * 1024;
+const NAME_STANZA = 'dead-drop-name';
+const NAME_INFO = utf8.encode('dead-drop-seal-name-v1');
+const SEALED_NAME = 'drop.age';
+
+async function hkdf(ikm, salt, info) {
+    const key = await crypto.subtle.importKey('raw', ikm, 'HKDF', false, ['deriveBits']);
+    return new Uint8Array(await crypto.subtle.deriveBits({name: 'HKDF', hash: 'SHA-256', salt, info}, key, 256));
+}
+
+// base64Raw is base64 without padding, as age writes it.
+function base64Raw(bytes) {
+    let binary = '';
+    for (const b of bytes) binary += String.fromCharCode(b);
+    return btoa(binary).replace(/=+$/, '');
+}
+
+const BECH32 = 'qpzry9x8gf2tvdw0s3jn54khce6mua7l';
+
+function bech32Polymod(values) {
+    const gen = [0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3];
+    let chk = 1;
+    for (const v of values) {
+        const top = chk >>> 25;
+        chk = ((chk & 0x1ffffff) << 5) ^ v;
+        for (let i = 0; i < 5; i++) {
+            if ((top >>> i) & 1) chk ^= gen[i];
+        }
+    }
+    return chk;
+}
+
+// ageRecipientKey decodes an age1... recipient into its X25519 public key.
+function ageRecipientKey(recipient) {
+    const s = recipient.trim().toLowerCase();
+    const values = [...s.slice(4)].map((c) => BECH32.indexOf(c));
+    const hrp = [...'age'].map((c) => c.charCodeAt(0));
+    if (!s.startsWith('age1') || values.length < 6 || values.includes(-1) ||
+        bech32Polymod([...hrp.map((c) => c >> 5), 0, ...hrp.map((c) => c & 31), ...values]) !== 1) {
+        throw new Error('invalid recipient key');
+    }
+    const key = [];
+    let acc = 0, bits = 0;
+    for (const v of values.slice(0, -6)) {
+        acc = ((acc << 5) | v) & 0xfff;
+        bits += 5;
+        if (bits >= 8) {
+            bits -= 8;
+            key.push((acc >> bits) & 0xff);
+        }
+    }
+    if (key.length !== 32 || bits >= 5 || (acc & ((1 << bits) - 1)) !== 0) {
+        throw new Error('invalid recipient key');
+    }
+    return new Uint8Array(key);
+}
+
+function chachaQuarter(x, a, b, c, d) {
+    x[a] += x[b]; x[d] ^= x[a]; x[d] = (x[d] << 16) | (x[d] >>> 16);
+    x[c] += x[d]; x[b] ^= x[c]; x[b] = (x[b] << 12) | (x[b] >>> 20);
+    x[a] += x[b]; x[d] ^= x[a]; x[d] = (x[d] << 8) | (x[d] >>> 24);
+    x[c] += x[d]; x[b] ^= x[c]; x[b] = (x[b] << 7) | (x[b] >>> 25);
+}
+
+// chacha20 XORs data with the ChaCha20 keystream from block counter on.
+function chacha20(key, nonce, counter, data) {
+    const state = new Uint32Array(16);
+    state.set([0x61707865, 0x3320646e, 0x79622d32, 0x6b206574]);
+    const kv = new DataView(key.buffer, key.byteOffset, 32);
+    const nv = new DataView(nonce.buffer, nonce.byteOffset, 12);
+    for (let i = 0; i < 8; i++) state[4 + i] = kv.getUint32(4 * i, true);
+    for (let i = 0; i < 3; i++) state[13 + i] = nv.getUint32(4 * i, true);
+
+    const out = new Uint8Array(data.length);
+    const x = new Uint32Array(16);
+    const block = new Uint8Array(64);
+    const bv = new DataView(block.buffer);
+    for (let offset = 0; offset < data.length; offset += 64, counter++) {
+        state[12] = counter;
+        x.set(state);
+        for (let i = 0; i < 10; i++) {
+            chachaQuarter(x, 0, 4, 8, 12); chachaQuarter(x, 1, 5, 9, 13);
+            chachaQuarter(x, 2, 6, 10, 14); chachaQuarter(x, 3, 7, 11, 15);
+            chachaQuarter(x, 0, 5, 10, 15); chachaQuarter(x, 1, 6, 11, 12);
+            chachaQuarter(x, 2, 7, 8, 13); chachaQuarter(x, 3, 4, 9, 14);
+        }
+        for (let i = 0; i < 16; i++) bv.setUint32(4 * i, (x[i] + state[i]) >>> 0, true);
+        const n = Math.min(64, data.length - offset);
+        for (let i = 0; i < n; i++) out[offset + i] = data[offset + i] ^ block[i];
+    }
+    return out;
+}
+
+// poly1305 is the MAC of msg, a whole number of 16-byte blocks, under the
+// one-time key.
+function poly1305(key, msg) {
+    const kv = new DataView(key.buffer, key.byteOffset, 32);
+    const le128 = (v, at) => v.getBigUint64(at, true) | (v.getBigUint64(at + 8, true) << 64n);
+    const p = (1n << 130n) - 5n;
+    const r = le128(kv, 0) & 0x0ffffffc0ffffffc0ffffffc0fffffffn;
+    const mv = new DataView(msg.buffer, msg.byteOffset, msg.length);
+    let h = 0n;
+    for (let at = 0; at < msg.length; at += 16) {
+        h = ((h + le128(mv, at) + (1n << 128n)) * r) % p;
+    }
+    h = (h + le128(kv, 16)) & ((1n << 128n) - 1n);
+    const tag = new Uint8Array(16);
+    const tv = new DataView(tag.buffer);
+    tv.setBigUint64(0, h & 0xffffffffffffffffn, true);
+    tv.setBigUint64(8, h >> 64n, true);
+    return tag;
+}
+
+// chachaSeal encrypts plaintext with ChaCha20-Poly1305 and no additional
+// data, returning the ciphertext and tag.
+function chachaSeal(key, nonce, plaintext) {
+    const polyKey = chacha20(key, nonce, 0, new Uint8Array(32));
+    const ciphertext = chacha20(key, nonce, 1, plaintext);
+    const padded = Math.ceil(ciphertext.length / 16) * 16;
+    const macData = new Uint8Array(padded + 16);
+    macData.set(ciphertext);
+    new DataView(macData.buffer).setBigUint64(padded + 8, BigInt(ciphertext.length), true);
+    const tag = poly1305(polyKey, macData);
+    polyKey.fill(0);
+    return concatBytes(ciphertext, tag);
+}
+
+// ageStanza is a header stanza with its body wrapped at 64 columns; the
+// last line is always short, so may be empty.
+function ageStanza(args, body) {
+    const encoded = base64Raw(body);
+    let out = '-> ' + args.join(' ') + '\n';
+    for (let i = 0; i <= encoded.length; i += 64) {
+        out += encoded.slice(i, i + 64) + '\n';
+    }
+    return out;
+}
+
+// sealToRecipient seals a file and its name to the receivers' age recipient
+// and returns the sealed file and the key's fingerprint.
+async function sealToRecipient(recipient, file, name) {
+    if (!window.crypto || !crypto.subtle) {
+        throw new Error('this browser cannot encrypt the upload');
+    }
+    const publicKey = ageRecipientKey(recipient);
+    const empty = new Uint8Array(0);
+    const zeroNonce = new Uint8Array(12);
+    const fileKey = crypto.getRandomValues(new Uint8Array(16));
+
+    const theirs = await crypto.subtle.importKey('raw', publicKey, {name: 'X25519'}, false, []);
+    const ephemeral = await crypto.subtle.generateKey({name: 'X25519'}, true, ['deriveBits']);
+    const ephPub = new Uint8Array(await crypto.subtle.exportKey('raw', ephemeral.publicKey));
+    const shared = new Uint8Array(await crypto.subtle.deriveBits({name: 'X25519', public: theirs}, ephemeral.privateKey, 256));
+    const wrapKey = await hkdf(shared, concatBytes(ephPub, publicKey), AGE_X25519_INFO);
+    const nameKey = await hkdf(fileKey, empty, NAME_INFO);
+    let header = AGE_INTRO +
+        ageStanza(['X25519', base64Raw(ephPub)], chachaSeal(wrapKey, zeroNonce, fileKey)) +
+        ageStanza([NAME_STANZA], chachaSeal(nameKey, zeroNonce, utf8.encode(name).slice(0, 1024))) +
+        '---';
+    header += ' ' + base64Raw(await hmac(await hkdf(fileKey, empty, utf8.encode('header')), utf8.encode(header))) + '\n';
+    shared.fill(0);
+    wrapKey.fill(0);
+    nameKey.fill(0);
+
+    // The payload is STREAM: chunks under counter nonces, the last byte
+    // marking the final chunk, which is the only one that may be short (or
+    // empty, for an empty file)
+    const payloadNonce = crypto.getRandomValues(new Uint8Array(16));
+    const streamKey = await hkdf(fileKey, payloadNonce, utf8.encode('payload'));
+    fileKey.fill(0);
+    const plaintext = new Uint8Array(await file.arrayBuffer());
+    const parts = [utf8.encode(header), payloadNonce];
+    for (let offset = 0, counter = 0; ; offset += AGE_CHUNK, counter++) {
+        const final = offset + AGE_CHUNK >= plaintext.length;
+        const nonce = new Uint8Array(12);
+        new DataView(nonce.buffer).setBigUint64(3, BigInt(counter));
+        nonce[11] = final ? 1 : 0;
+        parts.push(chachaSeal(streamKey, nonce, plaintext.subarray(offset, offset + AGE_CHUNK)));
+        if (final) break;
+    }
+    plaintext.fill(0);
+    streamKey.fill(0);
+    return {blob: new Blob(parts), fingerprint: await keyFingerprint(utf8.encode(recipient.trim().toLowerCase()))};
+}
+
+// showField sets a receipt panel value and shows it with its label, or hides
+// both when there is no value.
+function showField(id, labelId, value) {
+    document.getElementById(id).textContent = value || '';
+    document.getElementById(id).hidden = !value;
+    document.getElementById(labelId).hidden = !value;
+}
+
+// The name the server gives a message sent without a file
+const MESSAGE_NAME = 'message.txt';
+
+// Several files selected at once are sent together and stored as one drop
+let pendingFiles = [];
+let messageDrop = false;
+
+// The forms post directly to the server when JavaScript is disabled. With
+// JavaScript available, uploads go through the review step first.
+document.getElementById('uploadButton').textContent = 'REVIEW';
+// With a recipient key published, sealing to it replaces the per-drop key
+if (document.getElementById('sealOption')) {
+    document.getElementById('sealOption').hidden = false;
+} else {
+    document.getElementById('encryptOption').hidden = false;
+}
+
+// setStatus updates the polite live region so screen readers announce
+// progress without moving focus. An empty message hides the region.
+function setStatus(message) {
+    const spinner = document.getElementById('uploadSpinner');
+    document.getElementById('uploadStatus').textContent = message;
+    spinner.classList.toggle('active', message !== '');
+}
+
+// showError displays an error in an alert region and moves focus to it so
+// keyboard and screen-reader users land on the message.
+function showError(id, message) {
+    const error = document.getElementById(id);
+    error.textContent = message;
+    error.style.display = 'block';
+    error.focus();
+}
+
+function hideError(id) {
+    const error = document.getElementById(id);
+    error.textContent = '';
+    error.style.display = 'none';
+}
+
+function showPanel(id, headingId) {
+    document.getElementById(id).style.display = 'block';
+    document.getElementById(headingId).focus();
+}
+
+function resetPreview() {
+    pendingFiles = [];
+    document.getElementById('preview').style.display = 'none';
+    document.getElementById('previewFindings').replaceChildren();
+}
+
 document.getElementById('uploadForm').addEventListener('submit', async (e) => {
     e.preventDefault();
 
     const fileInput = document.getElementById('fileInput');
-    const spinner = document.getElementById('uploadSpinner');
-    const receipt = document.getElementById('receipt');
-    const error = document.getElementById('uploadError');
 
-    if (!fileInput.files[0]) {
-        error.textContent = 'Please select a file';
-        error.style.display = 'block';
+    document.getElementById('receipt').style.display = 'none';
+    hideError('uploadError');
+
+    // A message sent without a file is the drop itself, so that it can be
+    // encrypted like a file
+    let files = Array.from(fileInput.files);
+    const message = document.getElementById('message').value;
+    messageDrop = files.length === 0 && message.trim() !== '';
+    if (messageDrop) {
+        files = [new File([message], MESSAGE_NAME, {type: 'text/plain'})];
+    }
+    if (files.length === 0) {
+        showError('uploadError', 'Please select a file or write a message');
         return;
     }
 
-    receipt.style.display = 'none';
-    error.style.display = 'none';
-    spinner.style.display = 'block';
+    // Findings for several files are named after the file they came from
+    const types = [];
+    const findings = [];
+    for (const file of files) {
+        const bytes = new Uint8Array(await file.slice(0, INSPECT_BYTES).arrayBuffer());
+        const type = detectType(bytes, file);
+        types.push(type);
+        for (const finding of inspectMetadata(bytes, type)) {
+            findings.push(files.length > 1 ? file.name + ': ' + finding : finding);
+        }
+    }
+
+    // The server names a bundle itself, so the name cannot be edited
+    const previewName = document.getElementById('previewName');
+    previewName.value = files.length > 1 ? files.length + ' files, stored together' : files[0].name;
+    previewName.disabled = files.length > 1;
+    document.getElementById('previewSize').textContent = formatSize(files.reduce((n, file) => n + file.size, 0));
+    document.getElementById('previewType').textContent = [...new Set(types)].join(', ');
+
+    const list = document.getElementById('previewFindings');
+    list.replaceChildren();
+    if (findings.length === 0) {
+        const li = document.createElement('li');
+        li.textContent = 'None detected (this check is not exhaustive)';
+        list.appendChild(li);
+    } else {
+        for (const finding of findings) {
+            const li = document.createElement('li');
+            li.className = 'finding';
+            li.textContent = 'Warning: ' + finding;
+            list.appendChild(li);
+        }
+    }
+
+    pendingFiles = files;
+    showPanel('preview', 'previewHeading');
+});
+
+document.getElementById('cancelUpload').addEventListener('click', () => {
+    resetPreview();
+    const fileInput = document.getElementById('fileInput');
+    fileInput.value = '';
+    setStatus('Submission cancelled. Nothing was sent.');
+    fileInput.focus();
+});
+
+document.getElementById('preview').addEventListener('keydown', (e) => {
+    if (e.key === 'Escape') {
+        document.getElementById('cancelUpload').click();
+    }
+});
+
+document.getElementById('confirmUpload').addEventListener('click', async () => {
+    const fileInput = document.getElementById('fileInput');
+
+    if (pendingFiles.length === 0) return;
 
+    // With local encryption, only ciphertext and the key's fingerprint leave
+    // the browser; a per-drop key is shown once, after the upload, and a
+    // sealed file carries its name inside the seal. Several files are each
+    // sealed; a per-drop key covers only one.
+    let uploads = pendingFiles.map((file) => ({blob: file, name: file.name}));
+    if (uploads.length === 1) {
+        uploads[0].name = document.getElementById('previewName').value.trim() || 'upload';
+    }
+    let local = null;
+    const form = document.getElementById('uploadForm');
+    const seal = document.getElementById('sealToRecipient');
+    try {
+        if (seal && seal.checked) {
+            const sealed = [];
+            for (const upload of uploads) {
+                local = await sealToRecipient(form.dataset.recipientKey, upload.blob, upload.name);
+                sealed.push({blob: local.blob, name: SEALED_NAME});
+            }
+            uploads = sealed;
+        } else if (document.getElementById('encryptLocally').checked) {
+            if (uploads.length > 1) {
+                showError('uploadError', 'Encryption in this browser covers one file; send the files one at a time');
+                return;
+            }
+            local = await encryptLocally(uploads[0].blob);
+            uploads[0].blob = local.blob;
+        }
+    } catch (err) {
+        showError('uploadError', 'Encryption failed: ' + err.message);
+        return;
+    }
+    // A message drop left unencrypted goes as the message field alone, which
+    // the server cleans of invisible characters; encrypted, it is the file
     const formData = new FormData();
-    formData.append('file', fileInput.files[0]);
+    if (!messageDrop || local) {
+        for (const upload of uploads) {
+            formData.append('file', upload.blob, upload.name);
+        }
+    }
+    if (local) {
+        formData.append('client_encrypted', 'true');
+        formData.append('key_fingerprint', local.fingerprint);
+    }
+    formData.append('csrf_token', document.getElementById('csrfToken').value);
+    for (const id of ['campaign', 'retention', 'message', 'expiresHours', 'passphrase']) {
+        const field = document.getElementById(id);
+        if (id === 'message' && messageDrop && local) {
+            continue;
+        }
+        if (field && field.value) {
+            formData.append(field.name, field.value);
+        }
+    }
+    const channel = document.getElementById('receiptChannel');
+    if (channel && channel.value) {
+        formData.append('receipt_channel', channel.value);
+    }
+
+    resetPreview();
+    setStatus('Uploading, please wait...');
 
     try {
-        const response = await fetch('/submit', {
+        const headers = {'X-Dead-Drop-Upload': 'true'};
+        const token = await powToken();
+        if (token) {
+            headers['X-Dead-Drop-PoW'] = token;
+        }
+        let body = formData;
+        let replyKey = null;
+        // With an envelope key published, the whole form is sealed; there is
+        // no fallback to sending it in the clear
+        if (form.dataset.envelopeKey) {
+            const inner = new Response(formData);
+            const plaintext = concatBytes(utf8.encode(inner.headers.get('Content-Type') + '\n'),
+                new Uint8Array(await inner.arrayBuffer()));
+            const publicKey = Uint8Array.from(atob(form.dataset.envelopeKey), (c) => c.charCodeAt(0));
+            const sealed = await sealEnvelope(publicKey, plaintext);
+            body = sealed.envelope;
+            replyKey = sealed.replyKey;
+            headers['Content-Type'] = ENVELOPE_TYPE;
+        }
+
+        // The form actions carry server.base_path when proxied below the root
+        const response = await fetch(form.action, {
             method: 'POST',
-            body: formData,
-            headers: {
-                'X-Dead-Drop-Upload': 'true'
-            }
+            body: body,
+            headers: headers
         });
 
-        spinner.style.display = 'none';
-
         if (!response.ok) {
             throw new Error('Upload failed');
         }
 
-        const data = await response.json();
+        const data = replyKey
+            ? JSON.parse(new TextDecoder().decode(await openReply(replyKey, new Uint8Array(await response.arrayBuffer()))))
+            : await response.json();
 
         document.getElementById('dropIdCode').textContent = data.drop_id;
-        document.getElementById('receiptCode').textContent = data.receipt;
-        document.getElementById('fileHashCode').textContent = data.file_hash;
-        receipt.style.display = 'block';
+        // A torn receipt arrives as a single-use QR code link instead
+        const qr = document.getElementById('receiptQR');
+        document.getElementById('receiptCode').textContent = data.receipt || '';
+        document.getElementById('receiptCode').hidden = !data.receipt;
+        qr.hidden = !data.receipt_url;
+        if (data.receipt_url) {
+            qr.src = data.receipt_url;
+        } else {
+            qr.removeAttribute('src');
+        }
+        // The operator may suppress the file hash (security.submit_response)
+        showField('fileHashCode', 'fileHashLabel', data.file_hash);
+        showField('dropKeyCode', 'dropKeyLabel', local && local.key);
+        showField('keyFingerprintCode', 'keyFingerprintLabel', local && local.fingerprint);
+        // e.g. that the same file already arrived (security.duplicate_advisory_minutes)
+        const advisory = document.getElementById('advisoryNote');
+        advisory.textContent = data.advisory || '';
+        advisory.hidden = !data.advisory;
+        setStatus('Upload complete.');
+        showPanel('receipt', 'receiptHeading');
 
         fileInput.value = '';
+        document.getElementById('message').value = '';
+        document.getElementById('passphrase').value = '';
 
     } catch (err) {
-        spinner.style.display = 'none';
-        error.textContent = 'Upload failed: ' + err.message;
-        error.style.display = 'block';
+        setStatus('');
+        showError('uploadError', 'Upload failed: ' + err.message);
     }
 });
 
@@ -55,47 +674,51 @@ document.getElementById('retrieveForm').addEventListener('submit', async (e) =>
 
     const dropId = document.getElementById('retrieveId').value.trim();
     const receiptCode = document.getElementById('retrieveReceipt').value.trim();
-    const error = document.getElementById('retrieveError');
-    error.style.display = 'none';
+    hideError('retrieveError');
 
     if (!dropId || !receiptCode) {
-        error.textContent = 'Both drop ID and receipt are required';
-        error.style.display = 'block';
+        showError('retrieveError', 'Both drop ID and receipt are required');
+        return;
+    }
+
+    // A passphrase cannot travel in a download link, so the form is posted
+    // as it is and the browser saves the reply
+    if (document.getElementById('retrievePassphrase').value) {
+        e.target.submit();
         return;
     }
 
     try {
+        // Exchange the credentials (in the POST body) for a short-lived,
+        // single-use download link, so the browser streams the file to disk
+        // and no URL that lands in history can be replayed
         const params = new URLSearchParams();
         params.append('id', dropId);
         params.append('receipt', receiptCode);
-        const response = await fetch('/retrieve', {
+        const token = await powToken();
+        const response = await fetch(document.getElementById('retrieveForm').dataset.tokenUrl, {
             method: 'POST',
-            body: params
+            body: params,
+            headers: token ? {'X-Dead-Drop-PoW': token} : {}
         });
 
         if (!response.ok) {
-            throw new Error('Retrieval failed - check your drop ID and receipt');
+            const reason = (await response.text()).trim();
+            throw new Error(reason === 'Drop is protected by a passphrase'
+                ? 'This drop is protected by a passphrase - enter it and retrieve again'
+                : 'Retrieval failed - check your drop ID and receipt');
         }
 
-        const disposition = response.headers.get('Content-Disposition');
-        let filename = 'download';
-        if (disposition) {
-            const match = disposition.match(/filename="?([^"]+)"?/);
-            if (match) filename = match[1];
-        }
-
-        const blob = await response.blob();
-        const url = URL.createObjectURL(blob);
+        const data = await response.json();
         const a = document.createElement('a');
-        a.href = url;
-        a.download = filename;
+        a.href = data.url;
         document.body.appendChild(a);
         a.click();
         document.body.removeChild(a);
-        URL.revokeObjectURL(url);
+        // Compare with sha256sum (or Get-FileHash) once the download ends
+        setStatus(data.sha256 ? 'Download started. SHA-256: ' + data.sha256 : 'Download started.');
 
     } catch (err) {
-        error.textContent = err.message;
-        error.style.display = 'block';
+        showError('retrieveError', err.message);
     }
 });
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// defaultStatsRetention applies when stats.retention_days is unset.
+const defaultStatsRetention = 365 * 24 * time.Hour
+
+// countRejections counts uploads through next that are refused, by any
+// check down to storage, in the usage statistics.
+func (s *Server) countRejections(next http.HandlerFunc) http.HandlerFunc {
+	if s.stats == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &sampledWriter{ResponseWriter: w}
+		next(sw, r)
+		if sw.status >= http.StatusBadRequest && sw.status != http.StatusMethodNotAllowed {
+			s.stats.AddRejection()
+		}
+	}
+}
+
+// maintainStats writes the totals of each hour once it has ended and prunes
+// those older than retention, until stop is closed. While storage is locked
+// totals stay in memory.
+func (s *Server) maintainStats(retention time.Duration, stop <-chan struct{}) {
+	flush := time.NewTicker(time.Minute)
+	defer flush.Stop()
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-flush.C:
+			if err := s.stats.Flush(); err != nil && !errors.Is(err, storage.ErrLocked) && s.config().Logging.Errors {
+				log.Printf("Failed to flush usage statistics: %v", err)
+			}
+		case <-prune.C:
+			if _, err := s.stats.Prune(retention); err != nil && !errors.Is(err, storage.ErrLocked) && s.config().Logging.Errors {
+				log.Printf("Failed to prune usage statistics: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
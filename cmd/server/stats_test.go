@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/stats"
+)
+
+func TestStats_CountsAndAdminAPI(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	s := a.server
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/stats", aliceToken); rec.Code != http.StatusNotFound {
+		t.Errorf("disabled stats: status = %d, want 404", rec.Code)
+	}
+
+	path := filepath.Join(t.TempDir(), "stats")
+	s.stats = stats.New(path, func() ([]byte, error) {
+		return s.storage.SubKey("stats")
+	})
+	submit := s.countRejections(s.handleSubmit)
+
+	body, contentType := createMultipartFile(t, "file", "test.txt", []byte("hello world"))
+	rec := httptest.NewRecorder()
+	submit(rec, submitRequest(body, contentType))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("submit status = %d", rec.Code)
+	}
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+
+	rec = httptest.NewRecorder()
+	submit(rec, submitRequest(http.NoBody, "multipart/form-data; boundary=x"))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("empty submit status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleRetrieve(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retrieve status = %d", rec.Code)
+	}
+
+	rec = adminDo(t, a, http.MethodGet, "/admin/v1/stats", aliceToken)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		Stats []stats.Bucket `json:"stats"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &list)
+	if len(list.Stats) != 0 {
+		t.Errorf("stats = %+v, want none before the hour ends", list.Stats)
+	}
+
+	// The counts of the hour under way are written at shutdown
+	if err := s.stats.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("stats log not written: %v", err)
+	}
+
+	if rec := adminDo(t, a, http.MethodGet, "/admin/v1/stats?since=yesterday", aliceToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad since: status = %d, want 400", rec.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// handleDropStatus reports, for a drop ID and receipt sent in a POST body or
+// headers, whether the drop can be retrieved yet, which client-side key
+// opens it and whether it needs a passphrase, without serving or burning it.
+func (s *Server) handleDropStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dropID, ok := s.retrievalCredentials(w, r, false)
+	if !ok {
+		return
+	}
+	// StoredSize tells a quarantined drop from a missing one
+	if _, err := s.storage.StoredSize(dropID); err != nil {
+		s.dropUnavailable(w, false, err)
+		return
+	}
+	meta, err := s.storage.GetDropMetadata(dropID)
+	if err != nil {
+		s.dropUnavailable(w, false, err)
+		return
+	}
+
+	status := "ready"
+	if meta.Processing == storage.ProcessingPending {
+		status = "processing"
+	}
+	resp := map[string]any{
+		"status":           status,
+		"client_encrypted": meta.ClientEncrypted,
+	}
+	if meta.KeyFingerprint != "" {
+		resp["key_fingerprint"] = meta.KeyFingerprint
+	}
+	if meta.PassphraseSalt != nil {
+		resp["passphrase_protected"] = true
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, resp)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestHandleDropStatus_KeyFingerprint(t *testing.T) {
+	s := newTestServer(t)
+	key, _ := crypto.GenerateKey()
+	var ciphertext bytes.Buffer
+	if err := crypto.EncryptStream(key, bytes.NewReader([]byte("encrypted before upload")), &ciphertext, nil); err != nil {
+		t.Fatal(err)
+	}
+	fp := crypto.KeyFingerprint(key)
+
+	// A fingerprint is refused without client_encrypted, or when malformed
+	for _, fields := range []map[string]string{
+		{"key_fingerprint": fp},
+		{"client_encrypted": "true", "key_fingerprint": "not-a-fingerprint"},
+	} {
+		body, ct := createMultipartForm(t, "memo.bin", ciphertext.Bytes(), fields)
+		rec := httptest.NewRecorder()
+		s.handleSubmit(rec, submitRequest(body, ct))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("fields %v: status = %d, want 400", fields, rec.Code)
+		}
+	}
+
+	body, ct := createMultipartForm(t, "memo.bin", ciphertext.Bytes(), map[string]string{
+		"client_encrypted": "true", "key_fingerprint": fp,
+	})
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("submit: %d %s", rec.Code, rec.Body)
+	}
+	if resp["key_fingerprint"] != fp {
+		t.Errorf("submit reply key_fingerprint = %q, want %q", resp["key_fingerprint"], fp)
+	}
+	if info, _ := s.storage.Inspect(resp["drop_id"]); info.KeyFingerprint != fp {
+		t.Errorf("stored fingerprint = %q", info.KeyFingerprint)
+	}
+
+	req := retrieveRequest(t, resp["drop_id"], resp["receipt"])
+	req.URL.Path = "/api/v1/drop-status"
+	rec = httptest.NewRecorder()
+	s.handleDropStatus(rec, req)
+	var status struct {
+		Status          string `json:"status"`
+		ClientEncrypted bool   `json:"client_encrypted"`
+		KeyFingerprint  string `json:"key_fingerprint"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("status: %d %s", rec.Code, rec.Body)
+	}
+	if status.Status != "ready" || !status.ClientEncrypted || status.KeyFingerprint != fp {
+		t.Errorf("status = %+v", status)
+	}
+
+	// Asking for the status does not burn the drop
+	s.config().Security.DeleteAfterRetrieve = true
+	rec = httptest.NewRecorder()
+	s.handleDropStatus(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+	if _, err := s.storage.StoredSize(resp["drop_id"]); err != nil {
+		t.Errorf("drop gone after a status request: %v", err)
+	}
+}
+
+func TestHandleDropStatus_States(t *testing.T) {
+	s := newTestServer(t)
+	s.processing = newProcessingQueue(1)
+	resp := submitAsync(t, s, "memo.txt", []byte("queued memo"))
+
+	status := func() (int, string) {
+		rec := httptest.NewRecorder()
+		s.handleDropStatus(rec, retrieveRequest(t, resp["drop_id"], resp["receipt"]))
+		var body map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		state, _ := body["status"].(string)
+		return rec.Code, state
+	}
+	if code, state := status(); code != http.StatusOK || state != "processing" {
+		t.Errorf("pending drop: %d %q, want 200 processing", code, state)
+	}
+	runQueued(s)
+	if code, state := status(); code != http.StatusOK || state != "ready" {
+		t.Errorf("processed drop: %d %q, want 200 ready", code, state)
+	}
+	if err := s.storage.Quarantine(resp["drop_id"], "operator"); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := status(); code != http.StatusForbidden {
+		t.Errorf("quarantined drop: status = %d, want 403", code)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleDropStatus(rec, retrieveRequest(t, resp["drop_id"], "wrong"))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("invalid receipt: status = %d, want 403", rec.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strconv"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// timeAssertionPurpose names the subkey that seeds the time assertion key.
+const timeAssertionPurpose = "time-assertions"
+
+// timeAssertionKey derives the key that signs time assertions. It fails
+// while the storage is locked.
+func (s *Server) timeAssertionKey() (ed25519.PrivateKey, error) {
+	seed, err := s.storage.SubKey(timeAssertionPurpose)
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.ZeroBytes(seed)
+	return crypto.TimeAssertionKey(seed)
+}
+
+// timeAssertionPublicKey returns the base64 public key advertised in
+// /api/v1/capacity, or "" when time assertions are off or the storage is
+// locked.
+func (s *Server) timeAssertionPublicKey() string {
+	if !s.config().Security.TimeAssertions {
+		return ""
+	}
+	key, err := s.timeAssertionKey()
+	if err != nil {
+		return ""
+	}
+	defer crypto.ZeroBytes(key)
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// assertTime adds to a submit response the hour the drop was received and
+// the server's signature over it and the drop ID, so that the source can
+// compare the server's clock with its own.
+func (s *Server) assertTime(resp map[string]string, drop *storage.Drop) error {
+	key, err := s.timeAssertionKey()
+	if err != nil {
+		return err
+	}
+	defer crypto.ZeroBytes(key)
+	hour := drop.Timestamp.Truncate(time.Hour).Unix()
+	resp["timestamp_hour"] = strconv.FormatInt(hour, 10)
+	resp["time_signature"] = base64.StdEncoding.EncodeToString(crypto.SignTimeAssertion(key, hour, drop.ID))
+	return nil
+}
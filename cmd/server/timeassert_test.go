@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestHandleSubmit_TimeAssertion(t *testing.T) {
+	s := newTestServer(t)
+	s.config().Security.TimeAssertions = true
+
+	key, err := base64.StdEncoding.DecodeString(getCapacity(t, s).TimeKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		t.Fatalf("capacity time_key is not an Ed25519 key: %v", err)
+	}
+
+	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	hour, err := strconv.ParseInt(resp["timestamp_hour"], 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp_hour = %q: %v", resp["timestamp_hour"], err)
+	}
+	if skew := crypto.TimeAssertionSkew(hour, time.Now()); skew > time.Minute || skew < 0 {
+		t.Errorf("signed hour is %v away from now", skew)
+	}
+	sig, err := base64.StdEncoding.DecodeString(resp["time_signature"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crypto.VerifyTimeAssertion(key, hour, resp["drop_id"], sig) {
+		t.Error("time signature does not verify under the advertised key")
+	}
+}
+
+func TestHandleSubmit_TimeAssertionOff(t *testing.T) {
+	s := newTestServer(t)
+
+	if getCapacity(t, s).TimeKey != "" {
+		t.Error("time_key advertised with time assertions off")
+	}
+	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp["time_signature"]; ok {
+		t.Error("time_signature sent with time assertions off")
+	}
+}
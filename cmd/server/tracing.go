@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+// defaultTraceEndpoint is the OTLP/HTTP traces URL of a collector on its
+// default port, used when tracing.endpoint is unset.
+const defaultTraceEndpoint = "http://127.0.0.1:4318/v1/traces"
+
+// traceRequests records a span for each request, named by its route, with
+// the method, status, and size buckets. Storage spans started from the
+// request's context become its children.
+func (s *Server) traceRequests(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.Pattern
+		if !strings.Contains(name, " ") {
+			name = sampledMethod(r.Method) + " " + name
+		}
+		ctx, span := s.tracer.Start(r.Context(), name)
+		defer span.End()
+		sw := &sampledWriter{ResponseWriter: w}
+		next(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		// r.Pattern is the registered route, never a caller-chosen path
+		span.SetAttr("http.route", r.Pattern)
+		span.SetAttr("http.request.method", sampledMethod(r.Method))
+		span.SetAttr("http.response.status_code", sw.status)
+		span.SetAttr("http.request.size_bucket", sizeBucket(r.ContentLength))
+		span.SetAttr("http.response.size_bucket", sizeBucket(sw.bytes))
+		if sw.status >= 500 {
+			span.SetError("server_error")
+		}
+	}
+}
+
+// errorClass names the kind of a storage error for a span, without the
+// error's message, which may hold a drop ID or path.
+func errorClass(err error) string {
+	switch {
+	case errors.Is(err, storage.ErrLocked):
+		return "locked"
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return "quota"
+	case errors.Is(err, storage.ErrKeyExhausted):
+		return "key_exhausted"
+	case errors.Is(err, storage.ErrHashMismatch):
+		return "hash_mismatch"
+	case errors.Is(err, os.ErrNotExist):
+		return "not_found"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "internal"
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+	"github.com/scttfrdmn/dead-drop/internal/tracing"
+)
+
+func TestTraceRequests_Retrieve(t *testing.T) {
+	bodies := make(chan string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer collector.Close()
+
+	s := newTestServer(t)
+	s.tracer = tracing.New(collector.URL + "/v1/traces")
+	drop, err := s.storage.SaveDrop("memo.txt", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/retrieve", s.traceRequests(s.handleRetrieve))
+
+	req := httptest.NewRequest(http.MethodPost, "/retrieve", nil)
+	req.Header.Set(dropIDHeader, drop.ID)
+	req.Header.Set(receiptHeader, drop.Receipt)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retrieve status = %d", rec.Code)
+	}
+	if err := s.tracer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	body := <-bodies
+	for _, want := range []string{`"name":"POST /retrieve"`, `"key":"http.route","value":{"stringValue":"/retrieve"}`, `"name":"storage.open"`, `"parentSpanId"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("export missing %s:\n%s", want, body)
+		}
+	}
+	for _, secret := range []string{drop.ID, drop.Receipt, "memo.txt", "192.0.2.1"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("export contains %q:\n%s", secret, body)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	for err, want := range map[error]string{
+		fmt.Errorf("reading drop k7f3q9: %w", storage.ErrLocked): "locked",
+		fmt.Errorf("wrapped: %w", os.ErrNotExist):                "not_found",
+		storage.ErrQuotaExceeded:                                 "quota",
+		io.ErrUnexpectedEOF:                                      "internal",
+	} {
+		if got := errorClass(err); got != want {
+			t.Errorf("errorClass(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
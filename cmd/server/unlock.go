@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// maxPassphraseBytes bounds the unlock request body.
+const maxPassphraseBytes = 4096
+
+// unlocker accepts the master passphrase over a unix socket so that it never
+// has to live in a unit file or the environment. The socket is the only
+// trust boundary: its file mode restricts it to the server's user, whereas a
+// localhost TCP endpoint would be reachable by anyone through a Tor hidden
+// service, whose connections arrive from 127.0.0.1.
+type unlocker struct {
+	server     *Server
+	socketPath string
+
+	// afterUnlock runs once the keys are loaded (e.g., honeypot generation).
+	afterUnlock func() error
+
+	mu  sync.Mutex
+	srv *http.Server
+}
+
+// Start listens on the unlock socket. The socket is removed after a
+// successful unlock.
+func (u *unlocker) Start() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.srv != nil {
+		return nil
+	}
+
+	ln, err := listenUnixSocket(u.socketPath)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/unlock", u.handleUnlock)
+	u.srv = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 2 * time.Minute, // key derivation is deliberately slow
+	}
+
+	go func(srv *http.Server) {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Unlock socket error: %v", err)
+		}
+	}(u.srv)
+	return nil
+}
+
+// Stop closes the unlock socket, waiting briefly for an in-flight response.
+// The lock is held throughout so that a concurrent Start cannot create a new
+// socket that the closing listener would then unlink.
+func (u *unlocker) Stop() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = u.srv.Shutdown(ctx) // closing the listener unlinks the socket
+	u.srv = nil
+}
+
+// listenUnixSocket listens on a unix socket restricted to the server's user,
+// replacing a stale socket left by an unclean shutdown. Anything else at
+// path is left alone and an error returned. The socket is bound inside a
+// fresh 0700 directory, set to 0600 and only then moved to path, so it is
+// never reachable by other users, whatever the umask.
+func listenUnixSocket(path string) (net.Listener, error) {
+	fi, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	case fi.Mode().Type() != os.ModeSocket:
+		return nil, fmt.Errorf("%s exists and is not a socket", path)
+	default:
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(dir)
+	tmp := filepath.Join(dir, "s")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	ul := ln.(*net.UnixListener)
+	ul.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		_ = ul.Close()
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = ul.Close()
+		_ = os.Remove(tmp)
+		return nil, err
+	}
+	return &unixSocket{UnixListener: ul, path: path}, nil
+}
+
+// unixSocket is a listener that removes its socket from the path it was
+// moved to when closed.
+type unixSocket struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *unixSocket) Close() error {
+	err := l.UnixListener.Close()
+	if rmErr := os.Remove(l.path); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+func (u *unlocker) handleUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := u.server
+	if !s.storage.Locked() {
+		http.Error(w, "Already unlocked", http.StatusConflict)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPassphraseBytes+1))
+	if err != nil || len(body) > maxPassphraseBytes {
+		http.Error(w, "Invalid passphrase", http.StatusBadRequest)
+		return
+	}
+	passphrase := strings.TrimRight(string(body), "\r\n")
+	crypto.ZeroBytes(body)
+	if passphrase == "" {
+		http.Error(w, "Invalid passphrase", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.unlockStorage(passphrase); err != nil {
+		if s.config().Logging.Errors {
+			log.Printf("Unlock failed: %v", err)
+		}
+		http.Error(w, "Unlock failed", http.StatusForbidden)
+		return
+	}
+
+	if u.afterUnlock != nil {
+		if err := u.afterUnlock(); err != nil && s.config().Logging.Errors {
+			log.Printf("Post-unlock initialization failed: %v", err)
+		}
+	}
+
+	if s.config().Logging.Startup {
+		log.Printf("Storage unlocked")
+	}
+	_, _ = io.WriteString(w, "Unlocked\n")
+
+	// One-time: the socket goes away once the keys are in memory
+	go u.Stop()
+}
+
+// unlockStorage imports the configured key bundle if any, derives the master
+// key from passphrase, and loads the storage keys.
+func (s *Server) unlockStorage(passphrase string) error {
+	if s.config().Security.KeyBundle != "" {
+		if err := importKeyBundle(s.config(), passphrase); err != nil {
+			return err
+		}
+	}
+
+	salt, err := crypto.LoadOrGenerateSalt(s.config().Server.StorageDir)
+	if err != nil {
+		return err
+	}
+	masterKey := crypto.DeriveMasterKey(passphrase, salt)
+	defer crypto.ZeroBytes(masterKey)
+
+	return s.storage.Unlock(masterKey)
+}
+
+// Relock evicts the keys from memory and reopens the unlock socket. In-flight
+// operations holding the keys complete before they are zeroed.
+func (u *unlocker) Relock(reason string) {
+	s := u.server
+	if s.storage.Locked() {
+		return
+	}
+	s.storage.Lock()
+	if err := u.Start(); err != nil && s.config().Logging.Errors {
+		log.Printf("Failed to reopen unlock socket: %v", err)
+	}
+	if s.config().Logging.Startup {
+		log.Printf("Storage locked (%s)", reason)
+	}
+}
+
+// watchIdle relocks the storage once its keys have gone unused for idle,
+// until stop is closed.
+func (u *unlocker) watchIdle(idle time.Duration, stop <-chan struct{}) {
+	interval := min(max(idle/4, time.Second), time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s := u.server
+			if !s.storage.Locked() && time.Since(s.storage.LastUsed()) >= idle {
+				u.Relock("idle timeout")
+			}
+		}
+	}
+}
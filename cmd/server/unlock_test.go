@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+func newLockedTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newTestServer(t)
+	locked, err := storage.NewLockedManager(s.config().Server.StorageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked.SecureDelete = false
+	t.Cleanup(locked.Close)
+	s.storage = locked
+	return s
+}
+
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestUnlocker_UnlocksOnce(t *testing.T) {
+	s := newLockedTestServer(t)
+	sock := filepath.Join(t.TempDir(), "unlock.sock")
+	called := false
+	u := &unlocker{server: s, socketPath: sock, afterUnlock: func() error {
+		called = true
+		return nil
+	}}
+	if err := u.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer u.Stop()
+
+	info, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	// Locked server refuses uploads
+	body, ct := createMultipartFile(t, "file", "test.txt", []byte("data"))
+	rec := httptest.NewRecorder()
+	s.handleSubmit(rec, submitRequest(body, ct))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("submit while locked: status = %d, want 503", rec.Code)
+	}
+
+	resp, err := unixClient(sock).Post("http://unix/unlock", "text/plain", strings.NewReader("passphrase\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unlock status = %d, want 200", resp.StatusCode)
+	}
+	if s.storage.Locked() {
+		t.Error("storage should be unlocked")
+	}
+	if !called {
+		t.Error("afterUnlock should run")
+	}
+
+	// The socket closes after a successful unlock
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(sock); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unlock socket should be removed after unlock")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUnlocker_WrongPassphrase(t *testing.T) {
+	s := newLockedTestServer(t)
+
+	// Establish keys under one passphrase
+	if err := s.unlockStorage("right"); err != nil {
+		t.Fatal(err)
+	}
+	s.storage.Close()
+	relocked, err := storage.NewLockedManager(s.config().Server.StorageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(relocked.Close)
+	s.storage = relocked
+
+	sock := filepath.Join(t.TempDir(), "unlock.sock")
+	u := &unlocker{server: s, socketPath: sock}
+	if err := u.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer u.Stop()
+
+	resp, err := unixClient(sock).Post("http://unix/unlock", "text/plain", strings.NewReader("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", resp.StatusCode)
+	}
+	if !s.storage.Locked() {
+		t.Error("storage should stay locked")
+	}
+	if _, err := os.Stat(sock); err != nil {
+		t.Error("socket should stay open after a failed attempt")
+	}
+}
+
+func TestUnlocker_IdleRelock(t *testing.T) {
+	s := newLockedTestServer(t)
+	sock := filepath.Join(t.TempDir(), "unlock.sock")
+	u := &unlocker{server: s, socketPath: sock}
+	if err := u.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer u.Stop()
+
+	resp, err := unixClient(sock).Post("http://unix/unlock", "text/plain", strings.NewReader("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if s.storage.Locked() {
+		t.Fatal("storage should be unlocked")
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go u.watchIdle(time.Second, stop)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !s.storage.Locked() {
+		if time.Now().After(deadline) {
+			t.Fatal("storage should re-lock after the idle timeout")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// The socket is reopened for the next unlock
+	for {
+		if _, err := os.Stat(sock); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("unlock socket should be reopened after re-lock")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, err = unixClient(sock).Post("http://unix/unlock", "text/plain", strings.NewReader("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("second unlock status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "admin.sock")
+
+	// A stale socket from an unclean shutdown is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	ln, err := listenUnixSocket(path)
+	if err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode().Type() != os.ModeSocket || fi.Mode().Perm() != 0600 {
+		t.Fatalf("socket mode = %v, %v; want a 0600 socket", fi.Mode(), err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	_ = conn.Close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("directory holds %d entries, want only the socket", len(entries))
+	}
+	_ = ln.Close()
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Error("closing the listener should remove the socket")
+	}
+
+	// Anything other than a socket is never removed
+	if err := os.WriteFile(path, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ln, err := listenUnixSocket(path); err == nil {
+		_ = ln.Close()
+		t.Fatal("a regular file at the socket path should be refused")
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "keep" {
+		t.Errorf("file at the socket path = %q, %v; want it untouched", data, err)
+	}
+}
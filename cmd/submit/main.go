@@ -12,8 +12,11 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
 	"github.com/scttfrdmn/dead-drop/internal/crypto"
 	"github.com/scttfrdmn/dead-drop/internal/metadata"
 	"golang.org/x/net/proxy"
@@ -27,13 +30,54 @@ type Config struct {
 	ScrubMetadata bool
 	EncryptClient bool
 	EncryptionKey string
+	Campaign      string
+	Retention     string
+	ReceiptKey    string // age X25519 recipient to seal the receipt to
+	ScrubStrict   bool   // strip JFIF and ICC color segments from JPEGs too
+
+	TimeKey string        // base64 Ed25519 key expected to sign time assertions
+	MaxSkew time.Duration // warn when the local clock is further than this from the server's
+
+	Envelope bool // seal the upload to the server's envelope key when it has one
+
+	Message string // text sent with the file, returned to receivers as message.txt
+
+	ExpiresHours int // ask the server to delete the drop after this many hours; 0 = its default
+
+	Passphrase string // receivers must give this as well as the receipt
+
+	ChunkMB int // send the file in chunks of this size, resuming after dropped connections; 0 = in one request
+
+	Seal         bool   // seal the file and its name to the receivers' public key
+	RecipientKey string // age recipient to seal to; "" = the key the server publishes
+}
+
+// CapacityResponse mirrors the server's /api/v1/capacity advertisement.
+type CapacityResponse struct {
+	AcceptingSubmissions bool   `json:"accepting_submissions"`
+	MaxUploadMB          int64  `json:"max_upload_mb"`
+	TimeKey              string `json:"time_key"`
+	UploadKey            string `json:"upload_key"`
+	ResumableUploads     bool   `json:"resumable_uploads"`
+	RecipientKey         string `json:"recipient_key"`
+	PoWChallenge         string `json:"pow_challenge"`
 }
 
 type SubmitResponse struct {
-	DropID   string `json:"drop_id"`
-	Receipt  string `json:"receipt"`
-	FileHash string `json:"file_hash"`
-	Message  string `json:"message"`
+	DropID        string `json:"drop_id"`
+	Receipt       string `json:"receipt"`
+	SealedReceipt string `json:"sealed_receipt"`
+	FileHash      string `json:"file_hash"`
+	Message       string `json:"message"`
+	TimestampHour string `json:"timestamp_hour"`
+	TimeSignature string `json:"time_signature"`
+
+	KeyFingerprint string `json:"key_fingerprint"`
+	ExpiresHours   string `json:"expires_hours"`
+
+	PassphraseProtected string `json:"passphrase_protected"`
+
+	Advisory string `json:"advisory"`
 }
 
 func main() {
@@ -42,12 +86,41 @@ func main() {
 	flag.StringVar(&config.ServerURL, "server", "http://localhost:8080", "Dead drop server URL")
 	flag.BoolVar(&config.UseTor, "tor", false, "Use Tor SOCKS5 proxy")
 	flag.StringVar(&config.TorProxy, "tor-proxy", "127.0.0.1:9050", "Tor SOCKS5 proxy address")
-	flag.StringVar(&config.FilePath, "file", "", "File to submit (required unless -generate-key)")
+	flag.StringVar(&config.FilePath, "file", "", "File to submit (required unless -message, -message-file or -generate-key)")
 	flag.BoolVar(&config.ScrubMetadata, "scrub-metadata", true, "Strip EXIF/metadata before upload (recommended)")
-	flag.BoolVar(&config.EncryptClient, "encrypt", false, "Encrypt file client-side before upload")
+	flag.BoolVar(&config.ScrubStrict, "scrub-strict", false, "Strip every JPEG APPn segment, including color profiles")
+	flag.BoolVar(&config.EncryptClient, "encrypt", false, "Encrypt file client-side before upload, with a new per-drop key unless -key-file or DEAD_DROP_KEY gives one")
+	flag.StringVar(&config.Campaign, "campaign", "", "Campaign code from the call for submissions")
+	flag.StringVar(&config.Retention, "retention", "", "Retention class to request (see the server's capacity endpoint)")
+	flag.IntVar(&config.ExpiresHours, "expires-hours", 0, "Ask the server to delete the drop after this many hours (capped by its max_expires_hours)")
+	flag.StringVar(&config.ReceiptKey, "receipt-key", "", "Seal the receipt to this age X25519 recipient (age1..., from dead-drop-unseal -public or age-keygen) instead of printing it")
+	flag.StringVar(&config.TimeKey, "time-key", "", "Base64 Ed25519 key the server signs submission times with (default: the key the server advertises)")
+	flag.DurationVar(&config.MaxSkew, "max-skew", 2*time.Hour, "Warn when the local clock differs from the server's signed time by more than this")
+	flag.BoolVar(&config.Envelope, "envelope", true, "Seal the upload and reply with the server's envelope key (upload_key) when it advertises one")
+	flag.StringVar(&config.Message, "message", "", "Text to send with the file, returned to receivers as message.txt (not covered by -encrypt); without -file, the text is the drop")
+	flag.BoolVar(&config.Seal, "seal", false, "Seal the file and its name to the receivers' age X25519 recipient, which only they can open (the server's recipient_key unless -recipient-key gives one)")
+	flag.StringVar(&config.RecipientKey, "recipient-key", "", "Age recipient (age1...) the receivers published, to seal to with -seal instead of trusting the server's")
+	flag.IntVar(&config.ChunkMB, "chunk-mb", 0, "Send the file in chunks of this many MB, resuming after dropped connections (needs a server with resumable_uploads)")
+	messageFile := flag.String("message-file", "", "Read the -message text from a file")
 	keyFile := flag.String("key-file", "", "Read encryption key from file (or set DEAD_DROP_KEY env var)")
+	passphraseFile := flag.String("passphrase-file", "", "Protect the drop with the passphrase in this file (or set DEAD_DROP_PASSPHRASE); receivers need it as well as the receipt")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
+	if *messageFile != "" {
+		message, err := os.ReadFile(*messageFile) // #nosec G304 -- path from the user's flags
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading message file: %v\n", err)
+			os.Exit(1)
+		}
+		config.Message = string(message)
+	}
+
 	// Load encryption key from file or environment variable
 	if *keyFile != "" {
 		keyData, err := os.ReadFile(*keyFile)
@@ -60,6 +133,18 @@ func main() {
 		config.EncryptionKey = envKey
 	}
 
+	// Kept out of the flags, which other users can see in the process list
+	if *passphraseFile != "" {
+		passphrase, err := os.ReadFile(*passphraseFile) // #nosec G304 -- path from the user's flags
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading passphrase file: %v\n", err)
+			os.Exit(1)
+		}
+		config.Passphrase = strings.TrimRight(string(passphrase), "\r\n")
+	} else {
+		config.Passphrase = os.Getenv("DEAD_DROP_PASSPHRASE")
+	}
+
 	// Handle key generation
 	if *genKey {
 		if err := GenerateAndPrintKey(); err != nil {
@@ -69,15 +154,13 @@ func main() {
 		return
 	}
 
-	if config.FilePath == "" {
-		fmt.Fprintf(os.Stderr, "Error: -file is required\n")
+	if config.FilePath == "" && config.Message == "" {
+		fmt.Fprintf(os.Stderr, "Error: -file or -message is required\n")
 		flag.Usage()
 		os.Exit(1)
 	}
-
-	if config.EncryptClient && config.EncryptionKey == "" {
-		fmt.Fprintf(os.Stderr, "Error: -key-file or DEAD_DROP_KEY env var is required when using -encrypt\n")
-		flag.Usage()
+	if config.Seal && config.EncryptClient {
+		fmt.Fprintf(os.Stderr, "Error: -seal and -encrypt cannot be combined\n")
 		os.Exit(1)
 	}
 
@@ -87,34 +170,95 @@ func main() {
 	}
 }
 
-func submitFile(config Config) error {
-	// Read file
-	fileData, err := os.ReadFile(config.FilePath)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+func submitFile(config Config) (err error) {
+	var fileData []byte
+	var filename string
+	if config.FilePath != "" {
+		if fileData, err = os.ReadFile(config.FilePath); err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		filename = filepath.Base(config.FilePath)
+	} else {
+		// A message without a file is sent as the file, so that -encrypt
+		// and -seal cover it
+		fileData, filename = messageDrop(config.Message), messageName
+		config.Message = ""
+		if len(fileData) == 0 {
+			return fmt.Errorf("message is empty")
+		}
 	}
 
-	filename := filepath.Base(config.FilePath)
-
 	// Client-side metadata scrubbing
-	if config.ScrubMetadata {
+	if config.ScrubMetadata && config.FilePath != "" {
 		fmt.Println("Scrubbing metadata...")
-		scrubber := metadata.NewScrubber()
+		scrubber := metadata.NewScrubberWithOptions(metadata.Options{StrictJPEG: config.ScrubStrict})
 		scrubbed := &bytes.Buffer{}
 		if err := scrubber.ScrubFile(filename, bytes.NewReader(fileData), scrubbed); err != nil {
 			fmt.Printf("Warning: metadata scrubbing failed: %v\n", err)
 		} else {
 			fileData = scrubbed.Bytes()
-			fmt.Println("Metadata scrubbed")
+			if config.ScrubStrict {
+				fmt.Println("Metadata scrubbed (strict)")
+			} else {
+				fmt.Println("Metadata scrubbed")
+			}
+		}
+	}
+
+	// Create HTTP client
+	client := &http.Client{}
+
+	if config.UseTor {
+		// Configure Tor SOCKS5 proxy
+		proxyURL, err := url.Parse("socks5://" + config.TorProxy)
+		if err != nil {
+			return fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+
+		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+		if err != nil {
+			return fmt.Errorf("failed to create proxy dialer: %w", err)
+		}
+
+		client.Transport = &http.Transport{
+			Dial: dialer.Dial,
 		}
+
+		fmt.Println("Using Tor proxy:", config.TorProxy)
+	}
+
+	capacity, err := checkCapacity(client, config.ServerURL, uploadSize(config, filename, len(fileData)))
+	if err != nil {
+		return err
 	}
 
-	// Client-side encryption
+	// Client-side encryption. Only the key's fingerprint is sent, so that
+	// receivers can tell which key opens the drop.
+	var fingerprint string
 	if config.EncryptClient {
 		fmt.Println("Encrypting file...")
-		keyBytes, err := base64.StdEncoding.DecodeString(config.EncryptionKey)
+		var keyBytes []byte
+		keyBytes, err = clientKey(config.EncryptionKey)
 		if err != nil {
-			return fmt.Errorf("invalid encryption key: %w", err)
+			return err
+		}
+		defer crypto.ZeroBytes(keyBytes)
+		fingerprint = crypto.KeyFingerprint(keyBytes)
+		if config.EncryptionKey == "" {
+			var path string
+			path, err = savePerDropKey(fingerprint, keyBytes)
+			if err != nil {
+				return err
+			}
+			// A key for a drop that was never sent is only a liability
+			defer func() {
+				if err != nil {
+					_ = os.Remove(path)
+				}
+			}()
+			fmt.Println("Per-drop key written to:")
+			fmt.Printf("  %s\n", path)
+			fmt.Println("  Pass it to the receiver offline; without it the drop cannot be opened.")
 		}
 
 		encrypted := &bytes.Buffer{}
@@ -125,6 +269,22 @@ func submitFile(config Config) error {
 		fmt.Println("File encrypted")
 	}
 
+	// Sealing to the receivers' key: the server stores what it cannot open,
+	// and the real name travels inside the seal
+	if config.Seal {
+		recipient, err := recipientKey(config.RecipientKey, capacity)
+		if err != nil {
+			return err
+		}
+		fingerprint = crypto.RecipientFingerprint(recipient)
+		sealed := &bytes.Buffer{}
+		if err := crypto.SealFile(recipient, filename, bytes.NewReader(fileData), sealed); err != nil {
+			return fmt.Errorf("sealing failed: %w", err)
+		}
+		fileData, filename = sealed.Bytes(), sealedName
+		fmt.Printf("File sealed to recipient key %s\n", fingerprint)
+	}
+
 	// Create multipart form
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -138,73 +298,280 @@ func submitFile(config Config) error {
 		return fmt.Errorf("failed to write file data: %w", err)
 	}
 
+	// A sealed receipt never appears in the response in the clear
+	fields := map[string]string{"campaign": config.Campaign, "retention": config.Retention, "message": config.Message, "passphrase": config.Passphrase}
+	if config.ExpiresHours > 0 {
+		fields["expires_hours"] = strconv.Itoa(config.ExpiresHours)
+	}
+	if config.ReceiptKey != "" {
+		fields["receipt_channel"] = "sealed"
+		fields["receipt_key"] = config.ReceiptKey
+	}
+	// Declare client-side encryption so the server's entropy check accepts the ciphertext
+	if config.EncryptClient || config.Seal {
+		fields["client_encrypted"] = "true"
+		fields["key_fingerprint"] = fingerprint
+	}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(field, value); err != nil {
+			return fmt.Errorf("failed to write form field: %w", err)
+		}
+	}
+
 	if err := writer.Close(); err != nil {
 		return fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	// Create HTTP client
-	client := &http.Client{}
-
-	if config.UseTor {
-		// Configure Tor SOCKS5 proxy
-		proxyURL, err := url.Parse("socks5://" + config.TorProxy)
-		if err != nil {
-			return fmt.Errorf("failed to parse proxy URL: %w", err)
+	if config.ChunkMB > 0 {
+		if capacity == nil || !capacity.ResumableUploads {
+			return fmt.Errorf("server does not accept resumable uploads; submit without -chunk-mb")
+		}
+		if config.Envelope && capacity.UploadKey != "" {
+			// The chunks would pass the server's proxy unsealed
+			return fmt.Errorf("resumable uploads cannot be sealed to the server's envelope key; use -envelope=false to send chunks anyway")
 		}
+	}
 
-		dialer, err := proxy.FromURL(proxyURL, proxy.Direct)
+	// Behind a TLS-terminating proxy, seal the form so that it sees neither
+	// the file nor the receipt in the reply
+	var reqBody io.Reader = body
+	contentType := writer.FormDataContentType()
+	var replyKey []byte
+	if config.Envelope && capacity != nil && capacity.UploadKey != "" {
+		key, err := base64.StdEncoding.DecodeString(capacity.UploadKey)
 		if err != nil {
-			return fmt.Errorf("failed to create proxy dialer: %w", err)
+			return fmt.Errorf("invalid upload key from server: %w", err)
 		}
-
-		client.Transport = &http.Transport{
-			Dial: dialer.Dial,
+		envelope, rk, err := crypto.SealEnvelope(key, append([]byte(contentType+"\n"), body.Bytes()...))
+		if err != nil {
+			return fmt.Errorf("failed to seal upload: %w", err)
 		}
-
-		fmt.Println("Using Tor proxy:", config.TorProxy)
+		reqBody, contentType, replyKey = bytes.NewReader(envelope), crypto.EnvelopeContentType, rk
+		fmt.Println("Upload sealed to the server's envelope key")
 	}
 
-	// Create request
-	submitURL := config.ServerURL + "/submit"
-	req, err := http.NewRequest("POST", submitURL, body)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+	if config.FilePath != "" {
+		fmt.Printf("Submitting file: %s\n", filepath.Base(config.FilePath))
+	} else {
+		fmt.Println("Submitting message")
 	}
+	fmt.Printf("Server: %s\n", config.ServerURL)
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	// CSRF protection header
-	req.Header.Set("X-Dead-Drop-Upload", "true")
+	var resp *http.Response
+	if config.ChunkMB > 0 {
+		resp, err = submitChunked(client, config.ServerURL, powChallengeURL(config.ServerURL, capacity), filename, fileData, fields, config.ChunkMB*1024*1024)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Create request
+		submitURL := config.ServerURL + "/submit"
+		req, err := http.NewRequest("POST", submitURL, reqBody)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
 
-	fmt.Printf("Submitting file: %s\n", filepath.Base(config.FilePath))
-	fmt.Printf("Server: %s\n", config.ServerURL)
+		req.Header.Set("Content-Type", contentType)
+		// CSRF protection header
+		req.Header.Set("X-Dead-Drop-Upload", "true")
+		if err := addPoWToken(client, powChallengeURL(config.ServerURL, capacity), req); err != nil {
+			return err
+		}
 
-	// Send request
-	resp, err := client.Do(req) // #nosec G704 -- server URL is user-provided by design
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		// Send request
+		resp, err = client.Do(req) // #nosec G704 -- server URL is user-provided by design
+		if err != nil {
+			return fmt.Errorf("failed to send request: %w", err)
+		}
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
+		if after := resp.Header.Get("Retry-After"); after != "" {
+			return fmt.Errorf("server returned error %d: %s (retry after %s seconds)", resp.StatusCode, strings.TrimSpace(string(bodyBytes)), after)
+		}
 		return fmt.Errorf("server returned error %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	// Parse response
+	var reply io.Reader = resp.Body
+	if replyKey != nil {
+		sealed, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %w", err)
+		}
+		plaintext, err := crypto.OpenReply(replyKey, sealed)
+		if err != nil {
+			return fmt.Errorf("failed to open sealed response: %w", err)
+		}
+		reply = bytes.NewReader(plaintext)
+	}
 	var submitResp SubmitResponse
-	if err := json.NewDecoder(resp.Body).Decode(&submitResp); err != nil {
+	if err := json.NewDecoder(reply).Decode(&submitResp); err != nil {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	fmt.Println("\nFile submitted successfully")
 	fmt.Println("\nDrop ID:")
 	fmt.Printf("  %s\n", submitResp.DropID)
-	fmt.Println("\nReceipt code:")
-	fmt.Printf("  %s\n", submitResp.Receipt)
-	fmt.Println("\nFile SHA-256:")
-	fmt.Printf("  %s\n", submitResp.FileHash)
+	if submitResp.SealedReceipt != "" {
+		path, err := saveSealedReceipt(submitResp.DropID, submitResp.SealedReceipt)
+		if err != nil {
+			return err
+		}
+		fmt.Println("\nSealed receipt written to:")
+		fmt.Printf("  %s\n", path)
+		fmt.Println("  Open it where the private key is kept: dead-drop-unseal -key <key> -in " + path)
+	} else {
+		fmt.Println("\nReceipt code:")
+		fmt.Printf("  %s\n", submitResp.Receipt)
+	}
+	if submitResp.FileHash != "" {
+		fmt.Println("\nFile SHA-256:")
+		fmt.Printf("  %s\n", submitResp.FileHash)
+	}
+	if fingerprint != "" && config.Seal {
+		fmt.Println("\nSealed to recipient key:")
+		fmt.Printf("  %s\n", fingerprint)
+		fmt.Println("  Only the holder of its private key can open the drop.")
+	} else if fingerprint != "" {
+		fmt.Println("\nKey fingerprint:")
+		fmt.Printf("  %s\n", fingerprint)
+		if submitResp.KeyFingerprint != fingerprint {
+			fmt.Println("  Warning: the server did not record it; tell the receiver which key opens this drop")
+		}
+	}
+	timeKey := config.TimeKey
+	if timeKey == "" && capacity != nil {
+		timeKey = capacity.TimeKey
+	}
+	if config.ExpiresHours > 0 {
+		if submitResp.ExpiresHours == "" {
+			fmt.Println("\nWarning: the server does not let sources choose an expiry; its own retention rules apply")
+		} else {
+			fmt.Printf("\nThe drop will be deleted within %s hours.\n", submitResp.ExpiresHours)
+		}
+	}
+	if config.Passphrase != "" {
+		if submitResp.PassphraseProtected == "" {
+			fmt.Println("\nWarning: the server did not protect the drop with the passphrase; the receipt alone retrieves it")
+		} else {
+			fmt.Println("\nThe drop is protected by your passphrase; give it to the receiver separately.")
+		}
+	}
+	if submitResp.Advisory != "" {
+		fmt.Printf("\n%s\n", submitResp.Advisory)
+	}
+	reportServerTime(submitResp, timeKey, config.TimeKey != "", config.MaxSkew, time.Now())
 	fmt.Println("\nSave the drop ID and receipt - both are needed for retrieval.")
 	fmt.Println("Retrieve via the web UI or POST to /retrieve with id and receipt parameters.")
 
 	return nil
 }
+
+// clientKey decodes the base64 key for -encrypt, or generates a new one when
+// none was given.
+func clientKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return crypto.GenerateKey()
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// savePerDropKey writes a generated per-drop key, base64-encoded, to a file
+// in the current directory named after its fingerprint, and returns the name.
+// It is written before the upload, so that a drop is never sent with a key
+// that was lost.
+func savePerDropKey(fingerprint string, key []byte) (string, error) {
+	path := fingerprint + ".key"
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write per-drop key: %w", err)
+	}
+	return path, nil
+}
+
+// saveSealedReceipt writes a receipt the server sealed to -receipt-key to a
+// file in the current directory and returns its name.
+func saveSealedReceipt(dropID, encoded string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid sealed receipt: %w", err)
+	}
+	path := filepath.Base(dropID) + ".receipt.age"
+	if err := os.WriteFile(path, sealed, 0600); err != nil {
+		return "", fmt.Errorf("failed to write sealed receipt: %w", err)
+	}
+	return path, nil
+}
+
+// checkCapacity asks the server what it currently accepts and fails early
+// instead of uploading a file that would be refused. Servers without the
+// capacity endpoint are assumed to accept the upload, and nil is returned.
+func checkCapacity(client *http.Client, serverURL string, size int64) (*CapacityResponse, error) {
+	resp, err := client.Get(serverURL + "/api/v1/capacity") // #nosec G107 -- server URL is user-provided by design
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	var capacity CapacityResponse
+	if err := json.NewDecoder(resp.Body).Decode(&capacity); err != nil {
+		return nil, nil
+	}
+
+	if !capacity.AcceptingSubmissions {
+		return nil, fmt.Errorf("server is not accepting submissions right now, try again later")
+	}
+	if capacity.MaxUploadMB > 0 && size > capacity.MaxUploadMB*1024*1024 {
+		return nil, fmt.Errorf("file is %.1f MB, server accepts at most %d MB",
+			float64(size)/(1024*1024), capacity.MaxUploadMB)
+	}
+	return &capacity, nil
+}
+
+// reportServerTime checks the server's signed statement of the hour the drop
+// was received against key and the local clock. Problems are warnings: the
+// drop is already submitted. A key that was not pinned with -time-key came
+// from the same server, so it only shows the reply was not altered.
+func reportServerTime(resp SubmitResponse, key string, pinned bool, maxSkew time.Duration, now time.Time) {
+	if resp.TimeSignature == "" {
+		if pinned {
+			fmt.Println("\nWarning: the server did not sign the submission time")
+		}
+		return
+	}
+	pub, err := base64.StdEncoding.DecodeString(key)
+	if key == "" || err != nil {
+		fmt.Println("\nWarning: no valid key to verify the server's signed time (use -time-key)")
+		return
+	}
+	hour, err := strconv.ParseInt(resp.TimestampHour, 10, 64)
+	sig, sigErr := base64.StdEncoding.DecodeString(resp.TimeSignature)
+	if err != nil || sigErr != nil || !crypto.VerifyTimeAssertion(pub, hour, resp.DropID, sig) {
+		fmt.Println("\nWARNING: the server's signed time does not verify - the reply may have been altered")
+		return
+	}
+
+	received := time.Unix(hour, 0).UTC()
+	fmt.Println("\nServer time (signed):")
+	fmt.Printf("  received in the hour from %s\n", received.Format("2006-01-02 15:04 MST"))
+	if !pinned {
+		fmt.Printf("  key not pinned; to pin it: -time-key %s\n", key)
+	}
+	if skew := crypto.TimeAssertionSkew(hour, now); skew > maxSkew || skew < -maxSkew {
+		fmt.Printf("WARNING: your clock is %s away from the server's; embargo dates and\n", skew.Abs().Truncate(time.Minute))
+		fmt.Println("  timestamps you rely on may be wrong. Check the system clock.")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/textsanitize"
+)
+
+// messageName is the name a message sent without a file is stored under,
+// as the server names one sent in its message field alone.
+const messageName = "message.txt"
+
+// messageDrop returns a message to be sent as the drop itself, cleaned as
+// the server would clean it: line endings normalized and the invisible
+// characters that can carry a tracking mark removed.
+func messageDrop(message string) []byte {
+	message = strings.ReplaceAll(message, "\r\n", "\n")
+	message, _ = textsanitize.StripInvisible(message)
+	return []byte(strings.ReplaceAll(message, "\r", ""))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/scttfrdmn/dead-drop/internal/ratelimit"
+)
+
+// powChallengeURL returns where to fetch proof-of-work challenges, which
+// the server asks hidden service clients to spend on each rate-limited
+// request, or "" when it does not.
+func powChallengeURL(serverURL string, capacity *CapacityResponse) string {
+	if capacity == nil || capacity.PoWChallenge == "" {
+		return ""
+	}
+	base, err := url.Parse(serverURL)
+	if err != nil {
+		return ""
+	}
+	ref, err := url.Parse(capacity.PoWChallenge)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// addPoWToken solves a challenge from challengeURL and attaches the token
+// to req. It does nothing when challengeURL is "".
+func addPoWToken(client *http.Client, challengeURL string, req *http.Request) error {
+	if challengeURL == "" {
+		return nil
+	}
+	resp, err := client.Get(challengeURL) // #nosec G107 -- on the user-provided server
+	if err != nil {
+		return fmt.Errorf("failed to fetch proof-of-work challenge: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch proof-of-work challenge: status %d", resp.StatusCode)
+	}
+	var challenge struct {
+		Challenge  string `json:"challenge"`
+		Difficulty int    `json:"difficulty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+		return fmt.Errorf("failed to decode proof-of-work challenge: %w", err)
+	}
+	if challenge.Difficulty > ratelimit.MaxPoWDifficulty {
+		return fmt.Errorf("server asks for %d bits of proof of work, more than %d", challenge.Difficulty, ratelimit.MaxPoWDifficulty)
+	}
+	fmt.Printf("Solving proof of work (%d bits)...\n", challenge.Difficulty)
+	req.Header.Set(ratelimit.PoWHeader, challenge.Challenge+":"+ratelimit.Solve(challenge.Challenge, challenge.Difficulty))
+	return nil
+}
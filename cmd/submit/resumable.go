@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunkAttempts is how many times one chunk is tried before giving up.
+const chunkAttempts = 8
+
+// uploadInitResponse mirrors the server's reply to /upload/init.
+type uploadInitResponse struct {
+	UploadID      string `json:"upload_id"`
+	Offset        int64  `json:"offset"`
+	MaxChunkBytes int64  `json:"max_chunk_bytes"`
+}
+
+// submitChunked sends data through the server's resumable upload endpoints
+// in chunks of at most chunkSize bytes, retrying each from the offset the
+// server holds when a connection drops, and returns the reply to
+// /upload/finish, which is that of /submit. Init and finish each spend a
+// proof-of-work token from powURL, when set.
+func submitChunked(client *http.Client, serverURL, powURL, filename string, data []byte, fields map[string]string, chunkSize int) (*http.Response, error) {
+	sum := sha256.Sum256(data)
+	init := url.Values{
+		"filename": {filename},
+		"size":     {strconv.Itoa(len(data))},
+		"sha256":   {hex.EncodeToString(sum[:])},
+	}
+	resp, err := postUploadForm(client, serverURL+"/upload/init", init, powURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server refused the upload: %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var upload uploadInitResponse
+	if err := json.NewDecoder(resp.Body).Decode(&upload); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if upload.MaxChunkBytes > 0 && int64(chunkSize) > upload.MaxChunkBytes {
+		chunkSize = int(upload.MaxChunkBytes)
+	}
+
+	offset := upload.Offset
+	for attempt := 1; offset < int64(len(data)); {
+		end := min(offset+int64(chunkSize), int64(len(data)))
+		next, retry, err := sendChunk(client, serverURL, upload.UploadID, offset, data[offset:end])
+		if err == nil {
+			fmt.Printf("Sent %d of %d bytes\n", next, len(data))
+			offset, attempt = next, 1
+			continue
+		}
+		if !retry || attempt == chunkAttempts {
+			return nil, fmt.Errorf("upload failed at byte %d: %w", offset, err)
+		}
+		fmt.Printf("Chunk failed (%v), resuming...\n", err)
+		time.Sleep(time.Duration(attempt) * 5 * time.Second)
+		attempt++
+		// The chunk may have arrived even though the reply did not
+		if held, err := uploadOffset(client, serverURL, upload.UploadID); err == nil {
+			offset = held
+		}
+	}
+
+	finish := url.Values{"upload_id": {upload.UploadID}}
+	for field, value := range fields {
+		if value != "" {
+			finish.Set(field, value)
+		}
+	}
+	return postUploadForm(client, serverURL+"/upload/finish", finish, powURL)
+}
+
+// postUploadForm posts form to one of the resumable upload endpoints.
+func postUploadForm(client *http.Client, endpoint string, form url.Values, powURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	if err := addPoWToken(client, powURL, req); err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req) // #nosec G704 -- server URL is user-provided by design
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return resp, nil
+}
+
+// sendChunk appends chunk at offset and returns the server's new offset.
+// On failure retry reports whether the chunk may be tried again: after a
+// dropped connection, a conflict over the offset or a server error, but
+// not once the server has refused it or lost the upload.
+func sendChunk(client *http.Client, serverURL, id string, offset int64, chunk []byte) (next int64, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPatch, serverURL+"/upload/chunk", bytes.NewReader(chunk))
+	if err != nil {
+		return 0, false, err
+	}
+	sum := sha256.Sum256(chunk)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	req.Header.Set("X-Dead-Drop-Upload-ID", id)
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Upload-Checksum", "sha256 "+base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := client.Do(req) // #nosec G704 -- server URL is user-provided by design
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		body, _ := io.ReadAll(resp.Body)
+		retry = resp.StatusCode == http.StatusConflict || resp.StatusCode >= 500
+		return 0, retry, fmt.Errorf("server returned error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	next, err = strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	return next, err != nil, err
+}
+
+// uploadOffset asks the server how much of the upload it holds.
+func uploadOffset(client *http.Client, serverURL, id string) (int64, error) {
+	req, err := http.NewRequest(http.MethodHead, serverURL+"/upload/chunk", nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Dead-Drop-Upload", "true")
+	req.Header.Set("X-Dead-Drop-Upload-ID", id)
+	resp, err := client.Do(req) // #nosec G704 -- server URL is user-provided by design
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, fmt.Errorf("server returned error %d", resp.StatusCode)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
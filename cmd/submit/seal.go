@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// sealedName is what a sealed file is uploaded as; its real name is inside
+// the seal.
+const sealedName = "drop.age"
+
+// recipientKey returns the key to seal to: the one the receivers published,
+// when given, or else the one the server advertises. A key pinned by the
+// source is preferred because a compromised server could advertise its own.
+func recipientKey(pinned string, capacity *CapacityResponse) (*age.X25519Recipient, error) {
+	advertised := ""
+	if capacity != nil {
+		advertised = capacity.RecipientKey
+	}
+	encoded := pinned
+	if encoded == "" {
+		if advertised == "" {
+			return nil, fmt.Errorf("server publishes no recipient key; pass the receivers' key with -recipient-key")
+		}
+		encoded = advertised
+	}
+	key, err := crypto.ParseRecipient(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient key: must be an age X25519 recipient (age1...)")
+	}
+
+	switch {
+	case pinned == "":
+		fmt.Printf("Sealing to the server's recipient key, fingerprint %s\n", crypto.RecipientFingerprint(key))
+		fmt.Println("  Compare it with the fingerprint the receivers published; use -recipient-key to pin their key.")
+	case advertised != "" && strings.TrimSpace(advertised) != strings.TrimSpace(pinned):
+		fmt.Println("Warning: the server publishes a different recipient key; sealing to the one given with -recipient-key")
+	}
+	return key, nil
+}
+
+// uploadSize is how many bytes the file will take once encrypted or sealed,
+// for checking against the server's upload limit.
+func uploadSize(config Config, filename string, n int) int64 {
+	switch {
+	case config.Seal:
+		return crypto.SealedSize(len(filename), int64(n))
+	case config.EncryptClient:
+		return crypto.EncryptedSize(int64(n))
+	}
+	return int64(n)
+}
@@ -0,0 +1,160 @@
+// Command dead-drop-unseal opens drops sealed to a receiver's age X25519
+// key (the recipient_key retrieval option, or a source sealing to
+// security.recipient_key), using an identity file written by
+// dead-drop-keygen -recipients or age-keygen, and writes them under the name
+// sealed with them. The files are age files, so `age -d -i` opens them too,
+// without the name. With -public it prints the matching age1 recipient to
+// send with retrieval requests. With -sha256 it first checks the sealed file
+// against the server's X-Dead-Drop-SHA256 trailer. With -drop-key, -key is instead a per-drop key from dead-drop-submit
+// -encrypt or the web UI: its fingerprint is printed, to match against the
+// one the server recorded, and -in is decrypted with it.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/buildinfo"
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func main() {
+	keyFile := flag.String("key", "", "Recipient identity file (from dead-drop-keygen -recipients or age-keygen)")
+	in := flag.String("in", "", "Sealed file to open")
+	outDir := flag.String("out-dir", ".", "Directory to write the opened file")
+	public := flag.Bool("public", false, "Print the public key for -key and exit")
+	digest := flag.String("sha256", "", "Expected SHA-256 of the sealed file (the X-Dead-Drop-SHA256 trailer)")
+	dropKey := flag.Bool("drop-key", false, "-key is a per-drop key: print its fingerprint, and decrypt the client-encrypted -in if given")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Println(buildinfo.String())
+		return
+	}
+
+	if *keyFile == "" {
+		log.Fatal("-key is required")
+	}
+	encoded, err := os.ReadFile(*keyFile) // #nosec G304 -- path from operator flags
+	if err != nil {
+		log.Fatalf("Failed to read key: %v", err)
+	}
+	defer crypto.ZeroBytes(encoded)
+
+	if *dropKey {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+		if err != nil {
+			log.Fatalf("Failed to decode key: %v", err)
+		}
+		defer crypto.ZeroBytes(key)
+		fmt.Println("Key fingerprint:", crypto.KeyFingerprint(key))
+		if *in != "" {
+			if err := decryptDrop(key, *in, *outDir, *digest); err != nil {
+				log.Fatalf("Failed to decrypt %s: %v", *in, err)
+			}
+		}
+		return
+	}
+
+	identity, err := crypto.ParseIdentity(encoded)
+	if err != nil {
+		log.Fatalf("Invalid key: %v", err)
+	}
+	if *public {
+		fmt.Println(identity.Recipient().String())
+		return
+	}
+
+	if *in == "" {
+		log.Fatal("-in is required")
+	}
+	f, err := os.Open(*in) // #nosec G304 -- path from operator flags
+	if err != nil {
+		log.Fatalf("Failed to open %s: %v", *in, err)
+	}
+	if *digest != "" {
+		if err := verifyDigest(f, *digest); err != nil {
+			_ = f.Close()
+			log.Fatalf("%s: %v", *in, err)
+		}
+	}
+	name, data, err := crypto.OpenSealedFile(identity, f)
+	_ = f.Close()
+	if err != nil {
+		log.Fatalf("Failed to unseal: %v", err)
+	}
+	defer crypto.ZeroBytes(data)
+
+	// The name comes from the source; never let it choose the directory
+	name = filepath.Base(name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "drop"
+	}
+	path := filepath.Join(*outDir, name)
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- base name inside operator-chosen dir
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", path, err)
+	}
+	if _, err := out.Write(data); err != nil {
+		_ = out.Close()
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if err := out.Close(); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+}
+
+// verifyDigest hashes f, compares the result with the hex digest want, and
+// rewinds f.
+func verifyDigest(f *os.File, want string) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, strings.TrimSpace(want)) {
+		return fmt.Errorf("SHA-256 mismatch: got %s, want %s (incomplete or altered download)", got, want)
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// decryptDrop decrypts a drop the source encrypted with a per-drop key into
+// outDir, as the name of the input file with ".decrypted" appended.
+func decryptDrop(key []byte, in, outDir, digest string) error {
+	f, err := os.Open(in) // #nosec G304 -- path from operator flags
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if digest != "" {
+		if err := verifyDigest(f, digest); err != nil {
+			return err
+		}
+	}
+
+	path := filepath.Join(outDir, filepath.Base(in)+".decrypted")
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- base name inside operator-chosen dir
+	if err != nil {
+		return err
+	}
+	if err := crypto.DecryptStream(key, f, out, nil); err != nil {
+		_ = out.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("%w (wrong key, or not a client-encrypted drop)", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", path)
+	return nil
+}
@@ -7,6 +7,10 @@ require (
 	gopkg.in/yaml.v3 v3.0.1
 )
 
-require golang.org/x/crypto v0.48.0
-
-require golang.org/x/sys v0.41.0 // indirect
+require (
+	filippo.io/age v1.2.1
+	github.com/glaslos/ssdeep v0.4.0
+	golang.org/x/crypto v0.48.0
+	golang.org/x/sys v0.41.0
+	rsc.io/qr v0.2.0
+)
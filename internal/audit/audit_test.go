@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLog_RecordAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if err := l.Record("alice", "legal_hold_set", "abcdef0123456789abcdef0123456789", "case 42"); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// Reopening continues the chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen error: %v", err)
+	}
+	if err := l.RecordClient("bob", "CN=bob-laptop", "legal_hold_released", "abcdef0123456789abcdef0123456789", ""); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	entries, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Actor != "alice" || entries[1].Action != "legal_hold_released" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+	if entries[0].Client != "" || entries[1].Client != "CN=bob-laptop" {
+		t.Errorf("client = %q, %q; want none, then the certificate", entries[0].Client, entries[1].Client)
+	}
+	if entries[0].Prev != "" || entries[1].Prev == "" {
+		t.Error("first entry should start the chain and the second should link to it")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %o, want 600", info.Mode().Perm())
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, actor := range []string{"alice", "bob", "carol"} {
+		if err := l.Record(actor, "drop_deleted", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing an entry breaks the chain at the following line
+	edited := bytes.Replace(data, []byte(`"bob"`), []byte(`"eve"`), 1)
+	if err := os.WriteFile(path, edited, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(path); err == nil {
+		t.Error("Verify should detect an edited entry")
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Open should refuse to extend a broken chain")
+	}
+
+	// Removing an entry is detected too
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	removed := append(append([]byte{}, lines[0]...), lines[2]...)
+	if err := os.WriteFile(path, removed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(path); err == nil {
+		t.Error("Verify should detect a removed entry")
+	}
+}
@@ -0,0 +1,56 @@
+// Package buildinfo holds the version information linked into release
+// builds by cmd/release (and make build-production) with -ldflags -X, so
+// that every binary can say which source it was built from.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at link time, e.g.
+//
+//	-X github.com/scttfrdmn/dead-drop/internal/buildinfo.Version=v0.11.0
+var (
+	// Version is the release version, "dev" for an ordinary go build.
+	Version = "dev"
+	// Commit is the full git commit the binary was built from.
+	Commit = ""
+	// BuildTime is the commit time in RFC 3339, not the wall-clock time
+	// of the build, so that rebuilding the same commit gives the same binary.
+	BuildTime = ""
+	// SigningKey is the minisign public key releases are signed with (the
+	// base64 line of its .pub file), which dead-drop-verify-binary checks
+	// signatures against when not given one.
+	SigningKey = ""
+)
+
+// commit returns Commit, or for a build that did not set it the revision
+// the go command recorded from version control, if any.
+func commit() string {
+	if Commit != "" {
+		return Commit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return ""
+}
+
+// String describes the build in one line for -version flags and startup logs.
+func String() string {
+	s := Version
+	if c := commit(); c != "" {
+		s += " (" + c
+		if BuildTime != "" {
+			s += ", " + BuildTime
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s/%s %s", s, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
@@ -0,0 +1,23 @@
+package buildinfo
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	defer func(v, c, b string) { Version, Commit, BuildTime = v, c, b }(Version, Commit, BuildTime)
+	Version, Commit, BuildTime = "v1.2.3", "abc123", "2026-01-02T03:04:05Z"
+
+	got := String()
+	want := "v1.2.3 (abc123, 2026-01-02T03:04:05Z) " + runtime.GOOS + "/" + runtime.GOARCH + " " + runtime.Version()
+	if got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	Version, BuildTime = "dev", ""
+	if got := String(); !strings.HasPrefix(got, "dev (abc123) ") {
+		t.Errorf("String() = %q, want the commit without a time", got)
+	}
+}
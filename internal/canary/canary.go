@@ -0,0 +1,306 @@
+// Package canary matches uploads against documents that receivers
+// distributed internally as leak canaries (watermarked memos and the like).
+//
+// Only hashes are registered: the SHA-256 of each copy, its ssdeep fuzzy
+// hash, or both, so that lightly edited or re-saved copies still match. The
+// list is kept in a single AES-GCM sealed file, since which documents are
+// canaries is itself sensitive.
+package canary
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"unicode"
+
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+)
+
+// DefaultThreshold is the ssdeep score at or above which an upload matches a
+// canary's fuzzy hash.
+const DefaultThreshold = fuzzyhash.DefaultThreshold
+
+// maxNameLen bounds canary names.
+const maxNameLen = 64
+
+// aad binds the sealed file to this use of the key.
+var aad = []byte("dead-drop-canaries")
+
+var (
+	// ErrNotFound is returned when removing a canary that is not registered.
+	ErrNotFound = errors.New("canary not found")
+	// ErrInvalid is returned for a canary with a bad name or hash.
+	ErrInvalid = errors.New("invalid canary")
+)
+
+// Canary is a registered document. At least one hash is set.
+type Canary struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256,omitempty"` // lowercase hex
+	SSDeep string `json:"ssdeep,omitempty"`
+}
+
+// Match describes an upload that matched a canary.
+type Match struct {
+	Name  string
+	Score int // 100 for an exact SHA-256 match, else the ssdeep score
+}
+
+// KeyFunc returns the key sealing the canary file. It may fail while
+// storage is locked.
+type KeyFunc func() ([]byte, error)
+
+// Store holds the canary list, sealed at path.
+type Store struct {
+	path      string
+	key       KeyFunc
+	threshold int
+
+	mu       sync.Mutex
+	canaries []Canary
+	loaded   bool
+}
+
+// New returns a store for the file at path. threshold is the ssdeep score
+// needed for a fuzzy match; 0 means DefaultThreshold.
+func New(path string, key KeyFunc, threshold int) *Store {
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	return &Store{path: path, key: key, threshold: threshold}
+}
+
+// List returns the registered canaries, sorted by name.
+func (s *Store) List() ([]Canary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return append([]Canary(nil), s.canaries...), nil
+}
+
+// Add registers c, replacing any canary of the same name.
+func (s *Store) Add(c Canary) error {
+	if err := validate(&c); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	list := make([]Canary, 0, len(s.canaries)+1)
+	for _, existing := range s.canaries {
+		if existing.Name != c.Name {
+			list = append(list, existing)
+		}
+	}
+	list = append(list, c)
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return s.save(list)
+}
+
+// Remove unregisters the canary called name.
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	list := make([]Canary, 0, len(s.canaries))
+	for _, c := range s.canaries {
+		if c.Name != name {
+			list = append(list, c)
+		}
+	}
+	if len(list) == len(s.canaries) {
+		return ErrNotFound
+	}
+	return s.save(list)
+}
+
+// Match checks an upload against the registered canaries, returning the
+// best match or nil. The fuzzy hash is only computed if some canary has one.
+func (s *Store) Match(data []byte) (*Match, error) {
+	s.mu.Lock()
+	if err := s.load(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	canaries := s.canaries
+	s.mu.Unlock()
+	if len(canaries) == 0 {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	var fuzzy string
+	fuzzyDone := false
+
+	var best *Match
+	for _, c := range canaries {
+		if c.SHA256 != "" && c.SHA256 == digest {
+			return &Match{Name: c.Name, Score: 100}, nil
+		}
+		if c.SSDeep == "" {
+			continue
+		}
+		if !fuzzyDone {
+			fuzzy, _ = fuzzyhash.Sum(data) // too small to hash: exact matches only
+			fuzzyDone = true
+		}
+		if fuzzy == "" {
+			continue
+		}
+		if score := fuzzyhash.Score(fuzzy, c.SSDeep); score >= s.threshold && (best == nil || score > best.Score) {
+			best = &Match{Name: c.Name, Score: score}
+		}
+	}
+	return best, nil
+}
+
+// Rekey re-seals the canary file under newKey, after the storage key has
+// been rotated. A missing file is not an error.
+func (s *Store) Rekey(newKey []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.path); os.IsNotExist(err) {
+		return nil
+	}
+	return s.write(newKey, s.canaries)
+}
+
+// validate normalizes and checks a canary.
+func validate(c *Canary) error {
+	if c.Name == "" || len(c.Name) > maxNameLen {
+		return fmt.Errorf("%w: name must be 1-%d bytes", ErrInvalid, maxNameLen)
+	}
+	for _, r := range c.Name {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("%w: name must be printable", ErrInvalid)
+		}
+	}
+	if c.SHA256 == "" && c.SSDeep == "" {
+		return fmt.Errorf("%w: a SHA-256 or ssdeep hash is required", ErrInvalid)
+	}
+	if c.SHA256 != "" {
+		raw, err := hex.DecodeString(c.SHA256)
+		if err != nil || len(raw) != sha256.Size {
+			return fmt.Errorf("%w: malformed SHA-256", ErrInvalid)
+		}
+		c.SHA256 = hex.EncodeToString(raw)
+	}
+	if c.SSDeep != "" && !fuzzyhash.Valid(c.SSDeep) {
+		return fmt.Errorf("%w: malformed ssdeep hash", ErrInvalid)
+	}
+	return nil
+}
+
+// load reads the sealed file once. Callers hold s.mu.
+func (s *Store) load() error {
+	if s.loaded {
+		return nil
+	}
+	data, err := os.ReadFile(s.path) // #nosec G304 -- path from config
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read canary file: %w", err)
+	}
+
+	key, err := s.key()
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	if len(data) < gcm.NonceSize() {
+		return errors.New("canary file too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+	if err != nil {
+		return errors.New("canary file failed authentication")
+	}
+	var canaries []Canary
+	if err := json.Unmarshal(plaintext, &canaries); err != nil {
+		return fmt.Errorf("malformed canary file: %w", err)
+	}
+	s.canaries = canaries
+	s.loaded = true
+	return nil
+}
+
+// save seals list under the current key and makes it the loaded list.
+// Callers hold s.mu.
+func (s *Store) save(list []Canary) error {
+	key, err := s.key()
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	if err := s.write(key, list); err != nil {
+		return err
+	}
+	s.canaries = list
+	return nil
+}
+
+// write seals list under key and replaces the file atomically.
+func (s *Store) write(key []byte, list []Canary) error {
+	plaintext, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, aad)
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return fmt.Errorf("failed to write canary file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write canary file: %w", err)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
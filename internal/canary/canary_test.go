@@ -0,0 +1,117 @@
+package canary
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+)
+
+func testStore(t *testing.T) *Store {
+	t.Helper()
+	key := bytes.Repeat([]byte{7}, 32)
+	return New(filepath.Join(t.TempDir(), "canaries"), func() ([]byte, error) {
+		return append([]byte(nil), key...), nil
+	}, 0)
+}
+
+func document(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed)) // #nosec G404 -- deterministic test data
+	words := []string{"memo", "budget", "review", "internal", "quarterly", "draft", "confidential", "project"}
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(words[r.Intn(len(words))])
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()
+}
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestStore_Match(t *testing.T) {
+	s := testStore(t)
+	memo := document(1, 20000)
+	fuzzy, err := fuzzyhash.Sum(memo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Canary{Name: "q3-memo", SSDeep: fuzzy}); err != nil {
+		t.Fatalf("Add error: %v", err)
+	}
+	exact := []byte("short canary")
+	if err := s.Add(Canary{Name: "short", SHA256: sha(exact)}); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := s.Match(exact)
+	if err != nil || m == nil || m.Name != "short" || m.Score != 100 {
+		t.Errorf("exact match = %+v, %v", m, err)
+	}
+
+	edited := append([]byte{}, memo...)
+	copy(edited[5000:], []byte("WATERMARK-0042"))
+	if m, _ := s.Match(edited); m == nil || m.Name != "q3-memo" {
+		t.Errorf("edited copy should match fuzzily, got %+v", m)
+	}
+
+	if m, _ := s.Match(document(2, 20000)); m != nil {
+		t.Errorf("unrelated document matched %+v", m)
+	}
+}
+
+func TestStore_PersistRemoveRekey(t *testing.T) {
+	s := testStore(t)
+	doc := []byte("leaked")
+	if err := s.Add(Canary{Name: "a", SHA256: sha(doc)}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(sha(doc))) {
+		t.Error("canary file should be encrypted")
+	}
+
+	newKey := bytes.Repeat([]byte{9}, 32)
+	if err := s.Rekey(newKey); err != nil {
+		t.Fatalf("Rekey error: %v", err)
+	}
+	reopened := New(s.path, func() ([]byte, error) { return append([]byte(nil), newKey...), nil }, 0)
+	list, err := reopened.List()
+	if err != nil || len(list) != 1 || list[0].Name != "a" {
+		t.Fatalf("List after rekey = %+v, %v", list, err)
+	}
+
+	if err := reopened.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Remove("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Remove error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_AddRejectsInvalid(t *testing.T) {
+	s := testStore(t)
+	for _, c := range []Canary{
+		{Name: "", SHA256: sha(nil)},
+		{Name: "no-hash"},
+		{Name: "bad-sha", SHA256: "abc"},
+		{Name: "bad-ssdeep", SSDeep: "not a hash"},
+		{Name: "ctl\n", SHA256: sha(nil)},
+	} {
+		if err := s.Add(c); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Add(%+v) error = %v, want ErrInvalid", c, err)
+		}
+	}
+}
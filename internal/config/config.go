@@ -10,46 +10,460 @@ import (
 
 // Config holds all server configuration
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Security SecurityConfig `yaml:"security"`
-	Logging  LoggingConfig  `yaml:"logging"`
+	Server     ServerConfig     `yaml:"server"`
+	Security   SecurityConfig   `yaml:"security"`
+	Validation ValidationConfig `yaml:"validation"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Scrubbers  ScrubbersConfig  `yaml:"scrubbers"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	Admin      AdminConfig      `yaml:"admin"`
+	TorExits   TorExitsConfig   `yaml:"tor_exits"`
+	Incidents  IncidentsConfig  `yaml:"incidents"`
+	Stats      StatsConfig      `yaml:"stats"`
+	Notify     NotifyConfig     `yaml:"notify"`
+	Canaries   CanariesConfig   `yaml:"canaries"`
+
+	// Processing moves validation and scrubbing out of the upload request
+	Processing ProcessingConfig `yaml:"processing"`
+
+	// Campaigns maps campaign codes (published with a call for submissions
+	// and sent by sources at upload) to per-campaign settings
+	Campaigns map[string]CampaignConfig `yaml:"campaigns"`
+
+	// Forwarding names other dead-drop instances that operators can forward
+	// drops to through the admin API
+	Forwarding ForwardingConfig `yaml:"forwarding"`
+
+	// Scuttle wipes the store when operators stop checking in
+	Scuttle ScuttleConfig `yaml:"scuttle"`
+
+	// Tracing exports request and storage spans to a local collector
+	Tracing TracingConfig `yaml:"tracing"`
+
+	// Flatten converts risky formats to static renderings on retrieval
+	Flatten FlattenConfig `yaml:"flatten"`
+
+	// secretRefs maps config paths to the env:// or secret:// references
+	// their values were resolved from, so SaveConfig can write them back
+	secretRefs map[string]string
+
+	// envOverrides are the paths of the settings DEAD_DROP_* environment
+	// variables overrode
+	envOverrides []string
 }
 
 // ServerConfig holds server settings
 type ServerConfig struct {
-	Listen      string        `yaml:"listen"`
-	StorageDir  string        `yaml:"storage_dir"`
-	MaxUploadMB int64         `yaml:"max_upload_mb"`
-	TLS         TLSConfig     `yaml:"tls"`
-	Metrics     MetricsConfig `yaml:"metrics"`
+	Listen         string        `yaml:"listen"`
+	StorageDir     string        `yaml:"storage_dir"`
+	MaxUploadMB    int64         `yaml:"max_upload_mb"`
+	MemoryBudgetMB int64         `yaml:"memory_budget_mb"`
+	BasePath       string        `yaml:"base_path"` // URL prefix when proxied below the site root, e.g. /securedrop
+	TLS            TLSConfig     `yaml:"tls"`
+	Metrics        MetricsConfig `yaml:"metrics"`
+
+	// DropIDs sets the format of new drop IDs. A store keeps the format its
+	// first drop was created with.
+	DropIDs DropIDConfig `yaml:"drop_ids"`
+
+	// StaticDir, if set, holds files that replace the embedded web UI assets
+	// of the same name, and a templates directory replacing page templates.
+	StaticDir string `yaml:"static_dir"`
+}
+
+// DropIDConfig describes drop IDs: Length characters from Alphabet ("hex",
+// "unambiguous", or the characters themselves), after Prefix and a dash
+// when Prefix is set. A zero Length picks the shortest carrying 128 bits.
+type DropIDConfig struct {
+	Alphabet string `yaml:"alphabet"`
+	Length   int    `yaml:"length"`
+	Prefix   string `yaml:"prefix"`
 }
 
 // MetricsConfig holds metrics endpoint settings
 type MetricsConfig struct {
 	Enabled       bool `yaml:"enabled"`
 	LocalhostOnly bool `yaml:"localhost_only"`
+	OriginStats   bool `yaml:"origin_stats"` // count requests as loopback / Tor exit / clearnet
+
+	// BearerToken, if set, is required as "Authorization: Bearer <token>"
+	// on /metrics, for Prometheus scraping over a network. May be an env://
+	// or secret:// reference.
+	BearerToken string `yaml:"bearer_token"`
 }
 
 // TLSConfig holds TLS certificate settings
 type TLSConfig struct {
 	CertFile string `yaml:"cert_file"`
 	KeyFile  string `yaml:"key_file"`
+
+	// ClientCAFile, if set, is a PEM bundle of CAs whose client certificates
+	// are required for retrieval and the admin TCP listener. Submission
+	// stays open.
+	ClientCAFile string `yaml:"client_ca_file"`
 }
 
 // SecurityConfig holds security settings
 type SecurityConfig struct {
-	DeleteAfterRetrieve bool    `yaml:"delete_after_retrieve"`
-	MaxAgeHours         int     `yaml:"max_age_hours"`
-	ScrubMetadata       bool    `yaml:"scrub_metadata"`
-	RateLimitPerMin     int     `yaml:"rate_limit_per_min"`
-	SecureDelete        bool    `yaml:"secure_delete"`
-	MaxStorageGB        float64 `yaml:"max_storage_gb"`
-	MaxDrops            int     `yaml:"max_drops"`
-	MasterKeyEnv        string  `yaml:"master_key_env"`
-	HoneypotsEnabled    bool    `yaml:"honeypots_enabled"`
-	HoneypotCount       int     `yaml:"honeypot_count"`
-	AlertWebhook        string  `yaml:"alert_webhook"`
-	TorOnly             bool    `yaml:"tor_only"`
+	DeleteAfterRetrieve     bool    `yaml:"delete_after_retrieve"`
+	MaxAgeHours             int     `yaml:"max_age_hours"`
+	ScrubMetadata           bool    `yaml:"scrub_metadata"`
+	RateLimitPerMin         int     `yaml:"rate_limit_per_min"`
+	RateLimitIPv4Prefix     int     `yaml:"rate_limit_ipv4_prefix"` // clients share a limit per prefix; 0 = 32
+	RateLimitIPv6Prefix     int     `yaml:"rate_limit_ipv6_prefix"` // 0 = 64
+	SecureDelete            bool    `yaml:"secure_delete"`
+	MaxStorageGB            float64 `yaml:"max_storage_gb"`
+	MaxDrops                int     `yaml:"max_drops"`
+	MasterKeyEnv            string  `yaml:"master_key_env"`
+	KeyBundle               string  `yaml:"key_bundle"`
+	UnlockSocket            string  `yaml:"unlock_socket"`
+	IdleRelockMinutes       int     `yaml:"idle_relock_minutes"`
+	HoneypotsEnabled        bool    `yaml:"honeypots_enabled"`
+	HoneypotCount           int     `yaml:"honeypot_count"`
+	AlertWebhook            string  `yaml:"alert_webhook"` // may be an env:// or secret:// reference
+	TorOnly                 bool    `yaml:"tor_only"`
+	TorExitOnly             bool    `yaml:"tor_exit_only"`     // accept only known Tor exit relays (clearnet deployments)
+	EntropyCheck            string  `yaml:"entropy_check"`     // "", "flag", or "reject"
+	EntropyThreshold        float64 `yaml:"entropy_threshold"` // bits per byte; 0 = default
+	FuzzyHash               bool    `yaml:"fuzzy_hash"`        // store an ssdeep hash in drop metadata
+	TriageStats             bool    `yaml:"triage_stats"`      // store page counts, image sizes, etc. in drop metadata
+	CSRFTokenTTLMinutes     int     `yaml:"csrf_token_ttl_minutes"`
+	DownloadTokenTTLSeconds int     `yaml:"download_token_ttl_seconds"` // 0 = 60
+	AllowQueryCredentials   bool    `yaml:"allow_query_credentials"`    // deprecated: accept ?id=&receipt= on /retrieve
+	SubmissionsPaused       bool    `yaml:"submissions_paused"`
+	TornReceipts            bool    `yaml:"torn_receipts"`    // let sources take the receipt by QR or sealed to a key
+	ResponsePadding         int     `yaml:"response_padding"` // max random padding bytes on JSON replies; 0 = off
+	SubmitResponse          string  `yaml:"submit_response"`  // "", "full", "no_hash", or "minimal"
+
+	// Resource guards around validating and scrubbing one upload
+	MaxArchiveNesting   int   `yaml:"max_archive_nesting"`   // archives within an uploaded archive; 0 = 3
+	MaxExaminedMB       int64 `yaml:"max_examined_mb"`       // decompressed while inspecting archives; 0 = max_upload_mb
+	ParseTimeoutSeconds int   `yaml:"parse_timeout_seconds"` // time budget for validation and scrubbing; 0 = 30
+
+	// Sign the hour each drop was received, so clients can check their clock
+	TimeAssertions bool `yaml:"time_assertions"`
+
+	// Let clients encrypt uploads to a per-process key (HPKE), so that a
+	// TLS-terminating proxy or CDN never sees files or receipts
+	UploadEnvelope bool `yaml:"upload_envelope"`
+
+	// Remove tracking artifacts (unusual spaces, lookalike letters, print
+	// stamps) from messages and plain-text uploads
+	SanitizeText bool `yaml:"sanitize_text"`
+
+	// Percentages of max_storage_gb or max_drops at which storage usage is
+	// logged and reported to the notify webhook; empty = 70, 85, 95
+	QuotaAlerts []int `yaml:"quota_alerts"`
+
+	// Status of an upload refused because the quota is full: 503 (the
+	// default, as for any other overload), 507, or 429. Sent with Retry-After.
+	QuotaFullStatus int `yaml:"quota_full_status"`
+
+	// Content types a drop is downloaded with as recorded at upload; any
+	// other type is sent as application/octet-stream. Empty = a default set
+	// of images, audio, video, PDF, archives and plain text; [] = none.
+	ServeContentTypes []string `yaml:"serve_content_types"`
+
+	// Serve receivers small re-encoded JPEG previews of image drops at
+	// /api/v1/preview, for the drop ID and receipt
+	Previews bool `yaml:"previews"`
+
+	// Longest expiry, in hours, a source may choose with the expires_hours
+	// upload field; longer requests are shortened to it. 0 = sources cannot
+	// choose one.
+	MaxExpiresHours int `yaml:"max_expires_hours"`
+
+	// How much the storage key may encrypt before new uploads are refused
+	// until it is rotated with dead-drop-rotate-keys; a warning is logged
+	// at 80%. KeyMaxMessages counts data files and metadata records
+	// written. 0 = no limit.
+	KeyMaxGB       float64 `yaml:"key_max_gb"`
+	KeyMaxMessages int64   `yaml:"key_max_messages"`
+
+	// Accept uploads in chunks at /upload/init, /upload/chunk and
+	// /upload/finish, so that a large file survives a dropped connection
+	ResumableUploads bool `yaml:"resumable_uploads"`
+
+	// Minutes a burn-after-read drop whose download was cut short is kept
+	// so that the download can be finished with Range requests; it is
+	// deleted once its last byte is sent or the window closes. 0 = burn
+	// drops are served whole and deleted on the first retrieval.
+	ResumeWindowMinutes int `yaml:"resume_window_minutes"`
+
+	// The receivers' age X25519 recipient ("age1...", as printed by
+	// dead-drop-unseal -public), published so that the web UI and
+	// dead-drop-submit -seal can encrypt files to it before upload. Only its
+	// identity, which the server never holds, opens such drops.
+	RecipientKey string `yaml:"recipient_key"`
+
+	// SHA-256 (hex) of the server binary as deployed, e.g. from the release
+	// SHA256SUMS. When set, a warning is logged at startup if the running
+	// binary does not match, as a sign that it was replaced or altered.
+	BinarySHA256 string `yaml:"binary_sha256"`
+
+	// Minutes a resumable upload is kept without a chunk arriving before
+	// its chunks are deleted. 0 = 60.
+	ResumableUploadTTLMinutes int `yaml:"resumable_upload_ttl_minutes"`
+
+	// How requests arriving through the hidden service, which all come from
+	// the local Tor daemon's address, are budgeted: "ip" (default) counts
+	// them against that one address; "pow" admits each request that spends
+	// a solved proof-of-work token, and counts only those without one.
+	RateLimitMode string `yaml:"rate_limit_mode"`
+
+	// Leading zero bits of work a token takes while traffic is quiet; each
+	// doubling of recent volume past rate_limit_per_min adds one. 0 = 16.
+	PoWDifficulty int `yaml:"pow_difficulty"`
+
+	// With rate_limit_mode pow, refuse submissions through the hidden
+	// service that carry no token, instead of counting them against the
+	// shared allowance. Clients that run no JavaScript cannot submit then.
+	PoWRequired bool `yaml:"pow_required"`
+
+	// Let receivers leave a short reply on a drop, with its ID and receipt,
+	// for the source to fetch with the same (/reply and /check-reply).
+	Replies bool `yaml:"replies"`
+
+	// Collect the web UI's Content-Security-Policy violation reports at
+	// /csp-report, as counts for the admin API.
+	CSPReports bool `yaml:"csp_reports"`
+
+	// Refuse retrieval of a drop ID for receipt_lockout_minutes (0 = 15)
+	// once it has seen receipt_attempts wrong receipts within that time.
+	// 0 = no per-drop limit.
+	ReceiptAttempts       int `yaml:"receipt_attempts"`
+	ReceiptLockoutMinutes int `yaml:"receipt_lockout_minutes"`
+
+	// Tell a source whose file was already uploaded in the last this many
+	// minutes, by anyone, so that it need not keep resending. This confirms
+	// to anyone holding a file whether it was submitted. 0 = off.
+	DuplicateAdvisoryMinutes int `yaml:"duplicate_advisory_minutes"`
+
+	// Hash a drop's contents as they are retrieved and, if they do not
+	// match the SHA-256 recorded at upload, cut the download short and alert
+	VerifyHash bool `yaml:"verify_hash"`
+}
+
+// ValidationConfig holds the upload type checks. Types are detected from
+// content; empty lists keep the built-in ones.
+type ValidationConfig struct {
+	AllowedTypes      []string `yaml:"allowed_types"`      // accepted unless allow_all
+	BlockedTypes      []string `yaml:"blocked_types"`      // refused even with allow_all
+	BlockedExtensions []string `yaml:"blocked_extensions"` // e.g. ".exe", also inside archives
+	AllowAll          bool     `yaml:"allow_all"`          // accept types not in allowed_types (default true)
+}
+
+// ScrubbersConfig holds metadata scrubber settings
+type ScrubbersConfig struct {
+	TempDir  string                   `yaml:"temp_dir"`
+	External []ExternalScrubberConfig `yaml:"external"`
+	// Sandbox runs external tools and flatten converters without network,
+	// core dumps, or surviving processes, and with resource limits (default
+	// true; Linux only, and needs user namespaces)
+	Sandbox bool `yaml:"sandbox"`
+
+	// OnInvalid is what the built-in scrubbers do with a structurally
+	// invalid file: "reject" the upload (the default) or "passthrough" the
+	// rest of it unscrubbed
+	OnInvalid string `yaml:"on_invalid"`
+	// StrictJPEG strips every JPEG APPn segment, including the JFIF header
+	// and ICC color profiles that are kept by default
+	StrictJPEG bool `yaml:"strict_jpeg"`
+}
+
+// ExternalScrubberConfig describes an external metadata removal tool
+// (e.g., mat2, exiftool) registered for a set of file extensions
+type ExternalScrubberConfig struct {
+	Extensions     []string `yaml:"extensions"`
+	Command        []string `yaml:"command"`
+	InPlace        bool     `yaml:"in_place"`
+	TimeoutSeconds int      `yaml:"timeout_seconds"`
+	MaxOutputMB    int64    `yaml:"max_output_mb"`
+}
+
+// RetentionConfig holds retention classes. When no classes are defined,
+// security.max_age_hours and security.delete_after_retrieve apply to all drops.
+type RetentionConfig struct {
+	DefaultClass string                          `yaml:"default_class"`
+	Classes      map[string]RetentionClassConfig `yaml:"classes"`
+	FileTypes    map[string]string               `yaml:"file_types"` // extension -> class
+}
+
+// RetentionClassConfig describes how long drops of a class are kept and
+// what happens when they are retrieved or expire
+type RetentionClassConfig struct {
+	MaxAgeHours   int  `yaml:"max_age_hours"`   // 0 = never expires
+	BurnAfterRead bool `yaml:"burn_after_read"` // delete after first retrieval
+	PinnedReview  bool `yaml:"pinned_review"`   // keep past expiry until deleted by an operator
+	Selectable    bool `yaml:"selectable"`      // sources may choose this class at upload
+}
+
+// CampaignConfig holds settings for drops submitted under a campaign code
+type CampaignConfig struct {
+	Retention string `yaml:"retention"`
+
+	// Refuse uploads under the code while MaxDrops of its drops received in
+	// the last WindowHours (0 = 24) are still stored. 0 = no limit.
+	MaxDrops    int `yaml:"max_drops"`
+	WindowHours int `yaml:"window_hours"`
+
+	// Flatten is "on" or "off" to override flatten.enabled for the
+	// campaign's drops; "" follows it
+	Flatten string `yaml:"flatten"`
+}
+
+// ValidateRetention checks that every class referenced by the retention settings
+// and campaigns is defined.
+func (c *Config) ValidateRetention() error {
+	known := func(class string) bool {
+		_, ok := c.Retention.Classes[class]
+		return ok
+	}
+	if c.Retention.DefaultClass != "" && !known(c.Retention.DefaultClass) {
+		return fmt.Errorf("retention.default_class %q is not a defined class", c.Retention.DefaultClass)
+	}
+	for ext, class := range c.Retention.FileTypes {
+		if !known(class) {
+			return fmt.Errorf("retention.file_types[%s]: %q is not a defined class", ext, class)
+		}
+	}
+	for code, campaign := range c.Campaigns {
+		if campaign.Retention != "" && !known(campaign.Retention) {
+			return fmt.Errorf("campaigns[%s].retention: %q is not a defined class", code, campaign.Retention)
+		}
+	}
+	for name, class := range c.Retention.Classes {
+		if class.MaxAgeHours < 0 {
+			return fmt.Errorf("retention.classes[%s].max_age_hours must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// AdminConfig holds administrative API settings
+type AdminConfig struct {
+	Socket   string       `yaml:"socket"`    // unix socket for the admin API; empty = disabled
+	Listen   string       `yaml:"listen"`    // TCP address for the admin API over mutual TLS; empty = disabled
+	AuditLog string       `yaml:"audit_log"` // empty = .audit.log in storage_dir
+	Tokens   []AdminToken `yaml:"tokens"`
+}
+
+// AdminToken is a named bearer token for the admin API. The name is what the
+// audit log records.
+type AdminToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"` // may be an env:// or secret:// reference
+
+	// Role is "operator" (the default: every endpoint) or "receiver"
+	// (listing, inspecting, annotating, and forwarding drops). Campaigns
+	// limits a receiver to the drops of those campaign codes; empty = all.
+	Role      string   `yaml:"role"`
+	Campaigns []string `yaml:"campaigns"`
+}
+
+// Admin token roles.
+const (
+	RoleOperator = "operator"
+	RoleReceiver = "receiver"
+)
+
+// IncidentsConfig controls the encrypted intrusion event log
+type IncidentsConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Path          string `yaml:"path"`           // empty = .incidents in storage_dir
+	RetentionDays int    `yaml:"retention_days"` // 0 = 90
+}
+
+// StatsConfig controls the encrypted log of hourly usage totals
+type StatsConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Path          string `yaml:"path"`           // empty = .stats in storage_dir
+	RetentionDays int    `yaml:"retention_days"` // 0 = 365
+}
+
+// ScuttleConfig controls the dead-man timer: without an operator check-in
+// through the admin API for AfterDays, the server destroys its keys and
+// drops
+type ScuttleConfig struct {
+	AfterDays int `yaml:"after_days"` // 0 = off
+	WarnHours int `yaml:"warn_hours"` // warn this long before; 0 = 24
+}
+
+// TracingConfig controls OpenTelemetry tracing. Spans go over OTLP/HTTP to a
+// collector on this host only, and carry no IDs, addresses, or filenames.
+type TracingConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Endpoint string `yaml:"endpoint"` // OTLP/HTTP traces URL; empty = http://127.0.0.1:4318/v1/traces
+}
+
+// FlattenConfig converts risky formats, such as documents with macros or
+// interactive PDFs, into static renderings when drops are retrieved. The
+// stored original is kept, and served when a receiver asks for it.
+type FlattenConfig struct {
+	Enabled    bool                     `yaml:"enabled"` // for drops whose campaign does not say
+	Converters []FlattenConverterConfig `yaml:"converters"`
+}
+
+// FlattenConverterConfig describes an external converter, run like
+// scrubbers.external with {input} and {output} in its command
+type FlattenConverterConfig struct {
+	Extensions     []string `yaml:"extensions"`
+	Command        []string `yaml:"command"`
+	Output         string   `yaml:"output"` // extension of the rendering, e.g. .pdf or .png
+	TimeoutSeconds int      `yaml:"timeout_seconds"`
+	MaxOutputMB    int64    `yaml:"max_output_mb"`
+}
+
+// CanariesConfig controls matching uploads against registered canary
+// documents
+type CanariesConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Path           string `yaml:"path"`            // empty = .canaries in storage_dir
+	FuzzyThreshold int    `yaml:"fuzzy_threshold"` // ssdeep score for a fuzzy match, 0 = 80
+}
+
+// ProcessingConfig controls asynchronous processing of uploads. When Async
+// is set, uploads are stored as received and a source gets credentials at
+// once; validation, entropy and canary checks, and scrubbing run in a worker
+// queue, and a drop cannot be retrieved until they pass.
+type ProcessingConfig struct {
+	Async     bool `yaml:"async"`
+	Workers   int  `yaml:"workers"`    // 0 = 2
+	QueueSize int  `yaml:"queue_size"` // uploads waiting for a worker, 0 = 100; a full queue refuses uploads
+}
+
+// NotifyConfig controls the new-drop webhook
+type NotifyConfig struct {
+	WebhookURL    string `yaml:"webhook_url"`    // empty = disabled; may be an env:// or secret:// reference
+	SecretEnv     string `yaml:"secret_env"`     // env var holding the shared secret (32+ bytes)
+	JitterSeconds int    `yaml:"jitter_seconds"` // random delay before posting, 0 = none
+}
+
+// ForwardingConfig lists the destinations drops can be forwarded to. A drop
+// is sealed to the destination's public key and submitted to it as a
+// client-encrypted upload, through Proxy when set.
+type ForwardingConfig struct {
+	Proxy        string               `yaml:"proxy"` // SOCKS5 address, e.g. 127.0.0.1:9050; required for .onion destinations
+	Destinations []ForwardDestination `yaml:"destinations"`
+}
+
+// ForwardDestination is another dead-drop instance and the X25519 public
+// key (base64, as printed by dead-drop-unseal -public) its receivers open
+// forwarded drops with.
+type ForwardDestination struct {
+	Name      string `yaml:"name"`
+	URL       string `yaml:"url"` // base URL, e.g. http://<address>.onion
+	PublicKey string `yaml:"public_key"`
+}
+
+// TorExitsConfig controls the Tor exit relay list used to classify request
+// origins
+type TorExitsConfig struct {
+	URL          string `yaml:"url"`           // empty = Tor Project bulk exit list
+	RefreshHours int    `yaml:"refresh_hours"` // 0 = use the embedded snapshot only
+	Proxy        string `yaml:"proxy"`         // SOCKS5 address for fetching, e.g. 127.0.0.1:9050
+	CacheFile    string `yaml:"cache_file"`    // last fetched list, loaded at startup
+	FailOpen     bool   `yaml:"fail_open"`     // tor_exit_only admits everyone while the list is unusable
 }
 
 // LoggingConfig holds logging settings
@@ -58,6 +472,11 @@ type LoggingConfig struct {
 	Errors     bool   `yaml:"errors"`
 	Operations bool   `yaml:"operations"`
 	LogDir     string `yaml:"log_dir"`
+
+	// SampleRequests, if positive, writes one in every N requests (method,
+	// route, status, duration, and size buckets only) to requests.log in
+	// LogDir for latency debugging
+	SampleRequests int `yaml:"sample_requests"`
 }
 
 // DefaultConfig returns default configuration
@@ -76,6 +495,13 @@ func DefaultConfig() *Config {
 			SecureDelete:        true,
 			MaxStorageGB:        0, // 0 = unlimited
 			MaxDrops:            0, // 0 = unlimited
+			CSRFTokenTTLMinutes: 60,
+		},
+		Validation: ValidationConfig{
+			AllowAll: true,
+		},
+		Scrubbers: ScrubbersConfig{
+			Sandbox: true,
 		},
 		Logging: LoggingConfig{
 			Startup:    true,
@@ -85,20 +511,35 @@ func DefaultConfig() *Config {
 	}
 }
 
-// LoadConfig loads configuration from file
+// LoadConfig loads configuration from file. Every unknown key, type
+// mismatch and out-of-range value is reported in a *CheckError.
 func LoadConfig(path string) (*Config, error) {
-	// Start with defaults
-	cfg := DefaultConfig()
-
 	// Read file
 	data, err := os.ReadFile(path) // #nosec G304 -- config path from command-line flag
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Parse YAML
-	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	return loadConfig(data)
+}
+
+// LoadEnv returns the defaults with the DEAD_DROP_* environment overrides,
+// for a server started without a config file.
+func LoadEnv() (*Config, error) {
+	return loadConfig(nil)
+}
+
+func loadConfig(data []byte) (*Config, error) {
+	// Parse YAML and the environment over the defaults, rejecting unknown
+	// keys, wrong types and out-of-range values
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve env:// secret references
+	if err := cfg.resolveEnvSecrets(); err != nil {
+		return nil, err
 	}
 
 	return cfg, nil
@@ -109,9 +550,10 @@ func (c *SecurityConfig) GetMaxFileAge() time.Duration {
 	return time.Duration(c.MaxAgeHours) * time.Hour
 }
 
-// SaveConfig writes configuration to file
+// SaveConfig writes configuration to file. Values loaded from secret
+// references are written back as the references, never resolved.
 func SaveConfig(path string, cfg *Config) error {
-	data, err := yaml.Marshal(cfg)
+	data, err := yaml.Marshal(cfg.withSecretRefs())
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
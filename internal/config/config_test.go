@@ -206,3 +206,31 @@ func TestGetMaxFileAge_Zero(t *testing.T) {
 		t.Errorf("GetMaxFileAge() = %v, want 0", got)
 	}
 }
+
+func TestValidateRetention(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := cfg.ValidateRetention(); err != nil {
+		t.Fatalf("empty retention config should be valid: %v", err)
+	}
+
+	cfg.Retention = RetentionConfig{
+		DefaultClass: "standard",
+		Classes:      map[string]RetentionClassConfig{"standard": {MaxAgeHours: 168}},
+		FileTypes:    map[string]string{".pdf": "standard"},
+	}
+	cfg.Campaigns = map[string]CampaignConfig{"tips": {Retention: "standard"}}
+	if err := cfg.ValidateRetention(); err != nil {
+		t.Fatalf("valid retention config rejected: %v", err)
+	}
+
+	cfg.Campaigns["tips"] = CampaignConfig{Retention: "missing"}
+	if err := cfg.ValidateRetention(); err == nil {
+		t.Error("campaign referencing an undefined class should be rejected")
+	}
+	cfg.Campaigns = nil
+
+	cfg.Retention.DefaultClass = "missing"
+	if err := cfg.ValidateRetention(); err == nil {
+		t.Error("undefined default class should be rejected")
+	}
+}
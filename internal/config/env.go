@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix begins the name of every environment variable that overrides a
+// setting: DEAD_DROP_ and the setting's key path in upper case with dots
+// as underscores, e.g. DEAD_DROP_SERVER_LISTEN for server.listen.
+const EnvPrefix = "DEAD_DROP_"
+
+// EnvVar returns the environment variable that overrides the setting at
+// path, a dotted key path such as security.max_drops.
+func EnvVar(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// envSetting is one setting an environment variable may override.
+type envSetting struct {
+	path  string
+	field reflect.Value
+}
+
+// envSettings lists every setting of c, walking the nested sections. Lists
+// and maps are settings as a whole.
+func (c *Config) envSettings() []envSetting {
+	var settings []envSetting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := range t.NumField() {
+			key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			if !t.Field(i).IsExported() || key == "" || key == "-" {
+				continue
+			}
+			path := prefix + key
+			if t.Field(i).Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			settings = append(settings, envSetting{path, v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return settings
+}
+
+// applyEnv overrides the settings of c whose environment variables are set
+// and not empty, recording their paths, and returns a problem for each
+// value that does not parse. Strings are taken as they are, so they may
+// hold env:// and secret:// references like the file; lists of strings or
+// numbers may be comma-separated; anything else is YAML, such as
+// DEAD_DROP_CAMPAIGNS='{spring: {max_drops: 5}}'.
+func (c *Config) applyEnv() []Problem {
+	var problems []Problem
+	c.envOverrides = nil
+	for _, s := range c.envSettings() {
+		name := EnvVar(s.path)
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if err := setFromEnv(s.field, value); err != nil {
+			problems = append(problems, Problem{Path: s.path, Message: fmt.Sprintf("%s: %v", name, err)})
+			continue
+		}
+		c.envOverrides = append(c.envOverrides, s.path)
+	}
+	return problems
+}
+
+// setFromEnv parses value into field.
+func setFromEnv(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	if field.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		switch field.Type().Elem().Kind() {
+		case reflect.String, reflect.Int:
+			value = "[" + value + "]"
+		}
+	}
+
+	// Decoded into a fresh value, so that a list or map replaces the
+	// file's rather than merging with it
+	parsed := reflect.New(field.Type())
+	dec := yaml.NewDecoder(strings.NewReader(value))
+	dec.KnownFields(true)
+	if err := dec.Decode(parsed.Interface()); err != nil {
+		// Not quoted: the value may hold a secret
+		return fmt.Errorf("not a valid %s", field.Type())
+	}
+	field.Set(parsed.Elem())
+	return nil
+}
+
+// envOverride returns the environment variable that set path, or the list
+// or map path is in.
+func (c *Config) envOverride(path string) (string, bool) {
+	for _, o := range c.envOverrides {
+		if path == o || strings.HasPrefix(path, o+".") || strings.HasPrefix(path, o+"[") {
+			return EnvVar(o), true
+		}
+	}
+	return "", false
+}
+
+// EnvOverrides returns the key paths of the settings the environment
+// overrode when c was loaded, without their values, which may be secrets.
+func (c *Config) EnvOverrides() []string {
+	return c.envOverrides
+}
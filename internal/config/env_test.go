@@ -0,0 +1,112 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_EnvOverrides(t *testing.T) {
+	t.Setenv("DEAD_DROP_SERVER_LISTEN", "0.0.0.0:9090")
+	t.Setenv("DEAD_DROP_SECURITY_MAX_DROPS", "50")
+	t.Setenv("DEAD_DROP_SECURITY_DELETE_AFTER_RETRIEVE", "true")
+	t.Setenv("DEAD_DROP_SERVER_TLS_CERT_FILE", "/etc/tls/cert.pem")
+	t.Setenv("DEAD_DROP_VALIDATION_BLOCKED_EXTENSIONS", ".exe,.js")
+	t.Setenv("DEAD_DROP_SECURITY_QUOTA_ALERTS", "[70, 90]")
+	t.Setenv("DEAD_DROP_CAMPAIGNS", "{spring: {max_drops: 5}}")
+	t.Setenv("DEAD_DROP_LOGGING_ERRORS", "") // empty: ignored
+
+	cfg, err := LoadConfig(writeConfig(t, `server:
+  listen: "127.0.0.1:8080"
+  max_upload_mb: 20
+security:
+  max_drops: 10
+campaigns:
+  autumn:
+    max_drops: 3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Listen != "0.0.0.0:9090" || cfg.Server.MaxUploadMB != 20 {
+		t.Errorf("server = %+v, want listen from the environment and max_upload_mb from the file", cfg.Server)
+	}
+	if cfg.Security.MaxDrops != 50 || !cfg.Security.DeleteAfterRetrieve {
+		t.Errorf("security max_drops = %d, delete_after_retrieve = %v", cfg.Security.MaxDrops, cfg.Security.DeleteAfterRetrieve)
+	}
+	if cfg.Server.TLS.CertFile != "/etc/tls/cert.pem" {
+		t.Errorf("nested setting = %q", cfg.Server.TLS.CertFile)
+	}
+	if !slices.Equal(cfg.Validation.BlockedExtensions, []string{".exe", ".js"}) {
+		t.Errorf("comma-separated list = %q", cfg.Validation.BlockedExtensions)
+	}
+	if !slices.Equal(cfg.Security.QuotaAlerts, []int{70, 90}) {
+		t.Errorf("YAML list = %v", cfg.Security.QuotaAlerts)
+	}
+	if _, ok := cfg.Campaigns["autumn"]; ok || cfg.Campaigns["spring"].MaxDrops != 5 {
+		t.Errorf("campaigns = %v, want the environment's in place of the file's", cfg.Campaigns)
+	}
+	if !cfg.Logging.Errors {
+		t.Error("an empty variable should leave the setting alone")
+	}
+	if got := cfg.EnvOverrides(); len(got) != 7 || !slices.Contains(got, "server.tls.cert_file") {
+		t.Errorf("EnvOverrides = %v", got)
+	}
+}
+
+func TestLoadConfig_EnvProblems(t *testing.T) {
+	t.Setenv("DEAD_DROP_SECURITY_MAX_DROPS", "many")
+	t.Setenv("DEAD_DROP_SERVER_MAX_UPLOAD_MB", "0")
+	t.Setenv("DEAD_DROP_ADMIN_TOKENS", "[{name: alice, token: s3cret, bogus: 1}]")
+
+	_, err := LoadConfig(writeConfig(t, "server:\n  max_upload_mb: 20\n"))
+	var checkErr *CheckError
+	if !errors.As(err, &checkErr) {
+		t.Fatalf("error = %v, want a CheckError", err)
+	}
+	want := map[string]string{
+		"security.max_drops":   "DEAD_DROP_SECURITY_MAX_DROPS: not a valid int",
+		"server.max_upload_mb": "(set by DEAD_DROP_SERVER_MAX_UPLOAD_MB)",
+		"admin.tokens":         "DEAD_DROP_ADMIN_TOKENS: not a valid",
+	}
+	for _, p := range checkErr.Problems {
+		if p.Line != 0 {
+			t.Errorf("%s: line %d, want none for a setting from the environment", p.Path, p.Line)
+		}
+		if msg, ok := want[p.Path]; ok && strings.Contains(p.Message, msg) {
+			delete(want, p.Path)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("problems %v missing %v", checkErr.Problems, want)
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Error("a value that does not parse should not be echoed")
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("DEAD_DROP_SERVER_STORAGE_DIR", "/data/drops")
+	cfg, err := LoadEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.StorageDir != "/data/drops" || cfg.Server.MaxUploadMB != DefaultConfig().Server.MaxUploadMB {
+		t.Errorf("server = %+v, want the defaults with the storage dir overridden", cfg.Server)
+	}
+}
+
+func TestEnvVar_Unique(t *testing.T) {
+	seen := make(map[string]string)
+	for _, s := range DefaultConfig().envSettings() {
+		name := EnvVar(s.path)
+		if other, ok := seen[name]; ok {
+			t.Errorf("%s and %s share %s", other, s.path, name)
+		}
+		seen[name] = s.path
+	}
+	if seen["DEAD_DROP_SERVER_LISTEN"] != "server.listen" || seen["DEAD_DROP_SERVER_METRICS_BEARER_TOKEN"] != "server.metrics.bearer_token" {
+		t.Error("variables should be named after the key paths")
+	}
+}
@@ -0,0 +1,400 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is one error found in a configuration file: an unknown key, a
+// value of the wrong type, or a value outside its allowed range.
+type Problem struct {
+	Line    int    // line in the file, 0 if unknown
+	Path    string // dotted key path, e.g. security.rate_limit_per_min
+	Message string
+}
+
+func (p Problem) String() string {
+	msg := p.Message
+	if p.Path != "" {
+		msg = p.Path + ": " + msg
+	}
+	if p.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", p.Line, msg)
+	}
+	return msg
+}
+
+// CheckError lists every problem found in a configuration file.
+type CheckError struct {
+	Problems []Problem
+}
+
+func (e *CheckError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+// CheckFile validates the configuration file at path, with the DEAD_DROP_*
+// environment overrides, as the server would at startup, without resolving
+// secret references.
+func CheckFile(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- config path from command-line flag
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return err
+	}
+	return cfg.ValidateRetention()
+}
+
+// yamlLine matches the line prefix of yaml.v3 type errors.
+var yamlLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// yamlUnknownField matches the yaml.v3 error for a key with no struct field.
+var yamlUnknownField = regexp.MustCompile(`^field (\S+) not found in type `)
+
+// parseConfig decodes data and then the environment overrides over the
+// defaults, rejecting unknown keys and type mismatches, then checks every
+// value against the schema.
+func parseConfig(data []byte) (*Config, error) {
+	cfg := DefaultConfig()
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	var problems []Problem
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+		for _, msg := range typeErr.Errors {
+			problems = append(problems, typeProblem(msg))
+		}
+	}
+
+	problems = append(problems, cfg.applyEnv()...)
+
+	for _, p := range cfg.checkSchema() {
+		if name, ok := cfg.envOverride(p.Path); ok {
+			p.Message += " (set by " + name + ")"
+		} else {
+			p.Line = lineOf(&root, p.Path)
+		}
+		problems = append(problems, p)
+	}
+	if len(problems) > 0 {
+		return nil, &CheckError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// typeProblem converts a yaml.v3 type error message into a Problem.
+func typeProblem(msg string) Problem {
+	var p Problem
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+		msg = m[2]
+	}
+	if m := yamlUnknownField.FindStringSubmatch(msg); m != nil {
+		msg = fmt.Sprintf("unknown key %q", m[1])
+	}
+	p.Message = msg
+	return p
+}
+
+// lineOf returns the line of the value at the dotted path in the document,
+// or 0 if the path is not in the file. Path elements may index sequences,
+// e.g. scrubbers.external[1].timeout_seconds.
+func lineOf(root *yaml.Node, path string) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, elem := range strings.Split(path, ".") {
+		key, index := elem, -1
+		if i := strings.IndexByte(elem, '['); i >= 0 && strings.HasSuffix(elem, "]") {
+			key = elem[:i]
+			index, _ = strconv.Atoi(elem[i+1 : len(elem)-1])
+		}
+		node = mappingValue(node, key)
+		if node == nil {
+			return 0
+		}
+		if index >= 0 {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return 0
+			}
+			node = node.Content[index]
+		}
+	}
+	return node.Line
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// rule checks one setting, returning a problem message or "".
+type rule struct {
+	path  string
+	check func(c *Config) string
+}
+
+func atLeast[T int | int64 | float64](path string, lo T, get func(c *Config) T) rule {
+	return rule{path, func(c *Config) string {
+		if get(c) < lo {
+			return fmt.Sprintf("must be at least %v", lo)
+		}
+		return ""
+	}}
+}
+
+func between[T int | int64 | float64](path string, lo, hi T, get func(c *Config) T) rule {
+	return rule{path, func(c *Config) string {
+		if v := get(c); v < lo || v > hi {
+			return fmt.Sprintf("must be between %v and %v", lo, hi)
+		}
+		return ""
+	}}
+}
+
+// oneOf accepts the zero value (the default) or one of values.
+func oneOf[T string | int](path string, get func(c *Config) T, values ...T) rule {
+	return rule{path, func(c *Config) string {
+		var zero T
+		if v := get(c); v != zero && !slices.Contains(values, v) {
+			allowed := make([]string, len(values))
+			for i, a := range values {
+				allowed[i] = fmt.Sprint(a)
+			}
+			return fmt.Sprintf("%#v must be one of %s", v, strings.Join(allowed, ", "))
+		}
+		return ""
+	}}
+}
+
+// sha256Hex matches a hex SHA-256 digest as sha256sum prints it.
+var sha256Hex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// schema bounds the settings whose type alone does not make them valid.
+var schema = []rule{
+	atLeast("server.max_upload_mb", 1, func(c *Config) int64 { return c.Server.MaxUploadMB }),
+	atLeast("server.memory_budget_mb", 0, func(c *Config) int64 { return c.Server.MemoryBudgetMB }),
+	atLeast("server.drop_ids.length", 0, func(c *Config) int { return c.Server.DropIDs.Length }),
+
+	atLeast("security.max_age_hours", 0, func(c *Config) int { return c.Security.MaxAgeHours }),
+	atLeast("security.rate_limit_per_min", 0, func(c *Config) int { return c.Security.RateLimitPerMin }),
+	between("security.rate_limit_ipv4_prefix", 0, 32, func(c *Config) int { return c.Security.RateLimitIPv4Prefix }),
+	between("security.rate_limit_ipv6_prefix", 0, 128, func(c *Config) int { return c.Security.RateLimitIPv6Prefix }),
+	atLeast("security.max_storage_gb", 0, func(c *Config) float64 { return c.Security.MaxStorageGB }),
+	atLeast("security.max_drops", 0, func(c *Config) int { return c.Security.MaxDrops }),
+	atLeast("security.idle_relock_minutes", 0, func(c *Config) int { return c.Security.IdleRelockMinutes }),
+	atLeast("security.honeypot_count", 0, func(c *Config) int { return c.Security.HoneypotCount }),
+	oneOf("security.entropy_check", func(c *Config) string { return c.Security.EntropyCheck }, "flag", "reject"),
+	between("security.entropy_threshold", 0, 8, func(c *Config) float64 { return c.Security.EntropyThreshold }),
+	atLeast("security.csrf_token_ttl_minutes", 0, func(c *Config) int { return c.Security.CSRFTokenTTLMinutes }),
+	atLeast("security.download_token_ttl_seconds", 0, func(c *Config) int { return c.Security.DownloadTokenTTLSeconds }),
+	atLeast("security.response_padding", 0, func(c *Config) int { return c.Security.ResponsePadding }),
+	oneOf("security.submit_response", func(c *Config) string { return c.Security.SubmitResponse }, "full", "no_hash", "minimal"),
+	oneOf("security.quota_full_status", func(c *Config) int { return c.Security.QuotaFullStatus }, 503, 507, 429),
+	atLeast("security.max_archive_nesting", 0, func(c *Config) int { return c.Security.MaxArchiveNesting }),
+	atLeast("security.max_examined_mb", 0, func(c *Config) int64 { return c.Security.MaxExaminedMB }),
+	atLeast("security.parse_timeout_seconds", 0, func(c *Config) int { return c.Security.ParseTimeoutSeconds }),
+	atLeast("security.max_expires_hours", 0, func(c *Config) int { return c.Security.MaxExpiresHours }),
+	atLeast("security.key_max_gb", 0, func(c *Config) float64 { return c.Security.KeyMaxGB }),
+	atLeast("security.key_max_messages", 0, func(c *Config) int64 { return c.Security.KeyMaxMessages }),
+	atLeast("security.resume_window_minutes", 0, func(c *Config) int { return c.Security.ResumeWindowMinutes }),
+	atLeast("security.resumable_upload_ttl_minutes", 0, func(c *Config) int { return c.Security.ResumableUploadTTLMinutes }),
+	oneOf("security.rate_limit_mode", func(c *Config) string { return c.Security.RateLimitMode }, "ip", "pow"),
+	between("security.pow_difficulty", 0, 32, func(c *Config) int { return c.Security.PoWDifficulty }),
+	atLeast("security.receipt_attempts", 0, func(c *Config) int { return c.Security.ReceiptAttempts }),
+	atLeast("security.receipt_lockout_minutes", 0, func(c *Config) int { return c.Security.ReceiptLockoutMinutes }),
+	atLeast("security.duplicate_advisory_minutes", 0, func(c *Config) int { return c.Security.DuplicateAdvisoryMinutes }),
+	{"security.binary_sha256", func(c *Config) string {
+		if v := c.Security.BinarySHA256; v != "" && !sha256Hex.MatchString(v) {
+			return "must be a hex SHA-256 digest"
+		}
+		return ""
+	}},
+
+	oneOf("scrubbers.on_invalid", func(c *Config) string { return c.Scrubbers.OnInvalid }, "reject", "passthrough"),
+	atLeast("incidents.retention_days", 0, func(c *Config) int { return c.Incidents.RetentionDays }),
+	atLeast("stats.retention_days", 0, func(c *Config) int { return c.Stats.RetentionDays }),
+	atLeast("scuttle.after_days", 0, func(c *Config) int { return c.Scuttle.AfterDays }),
+	atLeast("scuttle.warn_hours", 0, func(c *Config) int { return c.Scuttle.WarnHours }),
+	between("canaries.fuzzy_threshold", 0, 100, func(c *Config) int { return c.Canaries.FuzzyThreshold }),
+	atLeast("processing.workers", 0, func(c *Config) int { return c.Processing.Workers }),
+	atLeast("processing.queue_size", 0, func(c *Config) int { return c.Processing.QueueSize }),
+	atLeast("notify.jitter_seconds", 0, func(c *Config) int { return c.Notify.JitterSeconds }),
+	atLeast("tor_exits.refresh_hours", 0, func(c *Config) int { return c.TorExits.RefreshHours }),
+	atLeast("logging.sample_requests", 0, func(c *Config) int { return c.Logging.SampleRequests }),
+	{"tracing.endpoint", func(c *Config) string {
+		if v := c.Tracing.Endpoint; v != "" && !loopbackURL(v) {
+			return "must be an http or https URL on localhost"
+		}
+		return ""
+	}},
+}
+
+// loopbackURL reports whether raw is an http(s) URL whose host is localhost
+// or a loopback address, so that spans never cross the network.
+func loopbackURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	if u.Hostname() == "localhost" {
+		return true
+	}
+	addr, err := netip.ParseAddr(u.Hostname())
+	return err == nil && addr.IsLoopback()
+}
+
+// checkSchema returns the settings that break a schema rule.
+func (c *Config) checkSchema() []Problem {
+	var problems []Problem
+	for _, r := range schema {
+		if msg := r.check(c); msg != "" {
+			problems = append(problems, Problem{Path: r.path, Message: msg})
+		}
+	}
+	for i, pct := range c.Security.QuotaAlerts {
+		if pct < 1 || pct > 100 {
+			problems = append(problems, Problem{Path: fmt.Sprintf("security.quota_alerts[%d]", i), Message: "must be between 1 and 100"})
+		}
+	}
+	for i, ct := range c.Security.ServeContentTypes {
+		if msg := checkServedType(ct); msg != "" {
+			problems = append(problems, Problem{Path: fmt.Sprintf("security.serve_content_types[%d]", i), Message: msg})
+		}
+	}
+	for i, ct := range c.Validation.AllowedTypes {
+		if msg := checkMediaType(ct); msg != "" {
+			problems = append(problems, Problem{Path: fmt.Sprintf("validation.allowed_types[%d]", i), Message: msg})
+		}
+	}
+	for i, ct := range c.Validation.BlockedTypes {
+		if msg := checkMediaType(ct); msg != "" {
+			problems = append(problems, Problem{Path: fmt.Sprintf("validation.blocked_types[%d]", i), Message: msg})
+		}
+	}
+	for i, ext := range c.Validation.BlockedExtensions {
+		if !isExtension(ext) {
+			problems = append(problems, Problem{Path: fmt.Sprintf("validation.blocked_extensions[%d]", i), Message: fmt.Sprintf("%q is not an extension such as .exe", ext)})
+		}
+	}
+	for _, code := range slices.Sorted(maps.Keys(c.Campaigns)) {
+		campaign := c.Campaigns[code]
+		if campaign.MaxDrops < 0 {
+			problems = append(problems, Problem{Path: "campaigns." + code + ".max_drops", Message: "must be at least 0"})
+		}
+		if campaign.WindowHours < 0 {
+			problems = append(problems, Problem{Path: "campaigns." + code + ".window_hours", Message: "must be at least 0"})
+		}
+		if f := campaign.Flatten; f != "" && f != "on" && f != "off" {
+			problems = append(problems, Problem{Path: "campaigns." + code + ".flatten", Message: fmt.Sprintf("%q must be one of on, off", f)})
+		}
+	}
+	for i, conv := range c.Flatten.Converters {
+		path := fmt.Sprintf("flatten.converters[%d]", i)
+		if len(conv.Command) == 0 {
+			problems = append(problems, Problem{Path: path + ".command", Message: "must not be empty"})
+		}
+		if !isExtension(conv.Output) {
+			problems = append(problems, Problem{Path: path + ".output", Message: fmt.Sprintf("%q is not an extension such as .pdf", conv.Output)})
+		}
+		if conv.TimeoutSeconds < 0 {
+			problems = append(problems, Problem{Path: path + ".timeout_seconds", Message: "must be at least 0"})
+		}
+		if conv.MaxOutputMB < 0 {
+			problems = append(problems, Problem{Path: path + ".max_output_mb", Message: "must be at least 0"})
+		}
+	}
+	for i, t := range c.Admin.Tokens {
+		path := fmt.Sprintf("admin.tokens[%d]", i)
+		if t.Role != "" && t.Role != RoleOperator && t.Role != RoleReceiver {
+			problems = append(problems, Problem{Path: path + ".role", Message: fmt.Sprintf("%q must be one of %s, %s", t.Role, RoleOperator, RoleReceiver)})
+		}
+		if len(t.Campaigns) > 0 && t.Role != RoleReceiver {
+			problems = append(problems, Problem{Path: path + ".campaigns", Message: "only applies to role receiver"})
+		}
+		for j, code := range t.Campaigns {
+			if _, ok := c.Campaigns[code]; !ok {
+				problems = append(problems, Problem{Path: fmt.Sprintf("%s.campaigns[%d]", path, j), Message: fmt.Sprintf("%q is not in campaigns", code)})
+			}
+		}
+	}
+	for i, ext := range c.Scrubbers.External {
+		if ext.TimeoutSeconds < 0 {
+			problems = append(problems, Problem{Path: fmt.Sprintf("scrubbers.external[%d].timeout_seconds", i), Message: "must be at least 0"})
+		}
+		if ext.MaxOutputMB < 0 {
+			problems = append(problems, Problem{Path: fmt.Sprintf("scrubbers.external[%d].max_output_mb", i), Message: "must be at least 0"})
+		}
+	}
+	return problems
+}
+
+// isExtension reports whether ext is a file extension such as ".exe".
+func isExtension(ext string) bool {
+	return len(ext) >= 2 && ext[0] == '.' && !strings.ContainsAny(ext, "/\\")
+}
+
+// activeContentTypes are types a browser may render as a page running
+// script, which would turn an upload into stored XSS if served verbatim.
+var activeContentTypes = []string{
+	"text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml",
+	"text/javascript", "application/javascript", "application/ecmascript", "text/ecmascript",
+}
+
+// checkMediaType checks that ct is a bare, lower-case media type.
+func checkMediaType(ct string) string {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil || ct != mediaType {
+		return fmt.Sprintf("%q is not a bare media type such as image/png", ct)
+	}
+	return ""
+}
+
+// checkServedType checks one entry of security.serve_content_types.
+func checkServedType(ct string) string {
+	if msg := checkMediaType(ct); msg != "" {
+		return msg
+	}
+	if slices.Contains(activeContentTypes, ct) || strings.HasSuffix(ct, "+xml") {
+		return fmt.Sprintf("%q may run script in a browser and cannot be served verbatim", ct)
+	}
+	return ""
+}
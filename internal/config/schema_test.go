@@ -0,0 +1,145 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig_Example(t *testing.T) {
+	if _, err := LoadConfig("../../config.example.yaml"); err != nil {
+		t.Fatalf("config.example.yaml: %v", err)
+	}
+}
+
+func TestLoadConfig_ReportsEveryProblem(t *testing.T) {
+	path := writeConfig(t, `server:
+  listen: "127.0.0.1:8080"
+  drop_ids:
+    length: -1
+security:
+  rate_limt_per_min: 5
+  max_age_hours: forever
+  rate_limit_ipv4_prefix: 40
+  entropy_check: warn
+  quota_alerts: [70, 150]
+  quota_full_status: 500
+  serve_content_types: [image/png, text/html]
+  max_expires_hours: -2
+  key_max_messages: -5
+  resume_window_minutes: -1
+  binary_sha256: abc123
+  resumable_upload_ttl_minutes: -5
+  rate_limit_mode: token
+  pow_difficulty: 40
+  receipt_attempts: -3
+  duplicate_advisory_minutes: -10
+scrubbers:
+  external:
+    - extensions: [".pdf"]
+      command: ["mat2", "{input}"]
+      timeout_seconds: -1
+campaigns:
+  tips-2026:
+    max_drops: -1
+validation:
+  allowed_types: [application/pdf, PDF]
+  blocked_extensions: [exe]
+admin:
+  tokens:
+    - name: intern
+      role: intern
+    - name: desk
+      role: receiver
+      campaigns: [tips-2026, tips-2027]
+tracing:
+  endpoint: "http://collector.example.com:4318/v1/traces"
+flatten:
+  converters:
+    - extensions: [.docm]
+      command: [soffice, --convert-to, pdf, "{input}"]
+      output: pdf
+`)
+	_, err := LoadConfig(path)
+	var checkErr *CheckError
+	if !errors.As(err, &checkErr) {
+		t.Fatalf("err = %v, want *CheckError", err)
+	}
+
+	want := []Problem{
+		{Line: 4, Path: "server.drop_ids.length", Message: "must be at least 0"},
+		{Line: 6, Message: `unknown key "rate_limt_per_min"`},
+		{Line: 8, Path: "security.rate_limit_ipv4_prefix", Message: "must be between 0 and 32"},
+		{Line: 9, Path: "security.entropy_check", Message: `"warn" must be one of flag, reject`},
+		{Line: 10, Path: "security.quota_alerts[1]", Message: "must be between 1 and 100"},
+		{Line: 11, Path: "security.quota_full_status", Message: "500 must be one of 503, 507, 429"},
+		{Line: 12, Path: "security.serve_content_types[1]", Message: `"text/html" may run script in a browser and cannot be served verbatim`},
+		{Line: 13, Path: "security.max_expires_hours", Message: "must be at least 0"},
+		{Line: 14, Path: "security.key_max_messages", Message: "must be at least 0"},
+		{Line: 15, Path: "security.resume_window_minutes", Message: "must be at least 0"},
+		{Line: 16, Path: "security.binary_sha256", Message: "must be a hex SHA-256 digest"},
+		{Line: 17, Path: "security.resumable_upload_ttl_minutes", Message: "must be at least 0"},
+		{Line: 18, Path: "security.rate_limit_mode", Message: `"token" must be one of ip, pow`},
+		{Line: 19, Path: "security.pow_difficulty", Message: "must be between 0 and 32"},
+		{Line: 20, Path: "security.receipt_attempts", Message: "must be at least 0"},
+		{Line: 21, Path: "security.duplicate_advisory_minutes", Message: "must be at least 0"},
+		{Line: 26, Path: "scrubbers.external[0].timeout_seconds", Message: "must be at least 0"},
+		{Line: 29, Path: "campaigns.tips-2026.max_drops", Message: "must be at least 0"},
+		{Line: 31, Path: "validation.allowed_types[1]", Message: `"PDF" is not a bare media type such as image/png`},
+		{Line: 32, Path: "validation.blocked_extensions[0]", Message: `"exe" is not an extension such as .exe`},
+		{Line: 36, Path: "admin.tokens[0].role", Message: `"intern" must be one of operator, receiver`},
+		{Line: 39, Path: "admin.tokens[1].campaigns[1]", Message: `"tips-2027" is not in campaigns`},
+		{Line: 41, Path: "tracing.endpoint", Message: "must be an http or https URL on localhost"},
+		{Line: 46, Path: "flatten.converters[0].output", Message: `"pdf" is not an extension such as .pdf`},
+	}
+	for _, w := range want {
+		found := false
+		for _, p := range checkErr.Problems {
+			if p == w {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing problem %q in:\n%v", w, err)
+		}
+	}
+	if !strings.Contains(err.Error(), "line 7: cannot unmarshal") {
+		t.Errorf("type mismatch not reported with its line:\n%v", err)
+	}
+}
+
+func TestLoadConfig_EmptyFile(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.MaxUploadMB != DefaultConfig().Server.MaxUploadMB {
+		t.Error("empty file should leave the defaults")
+	}
+}
+
+func TestCheckFile_SkipsSecrets(t *testing.T) {
+	path := writeConfig(t, "notify:\n  webhook_url: env://DEAD_DROP_TEST_UNSET_WEBHOOK\n")
+	if err := CheckFile(path); err != nil {
+		t.Errorf("CheckFile: %v", err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("LoadConfig should fail on the unset env reference")
+	}
+
+	bad := writeConfig(t, "retention:\n  default_class: missing\n")
+	if err := CheckFile(bad); err == nil {
+		t.Error("CheckFile should report an undefined retention class")
+	}
+}
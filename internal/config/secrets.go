@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// Secret references. A sensitive value in the config file may be given as
+// "env://NAME", read from the environment at load time, or "secret://NAME",
+// read from the encrypted secrets file in the storage directory once the
+// master key is known.
+const (
+	envRefPrefix    = "env://"
+	secretRefPrefix = "secret://"
+)
+
+// SecretsFile is the name of the encrypted secrets file in storage_dir.
+const SecretsFile = ".secrets"
+
+// secretsPurpose is the AAD binding the secrets file to the master key use.
+var secretsPurpose = []byte("config-secrets")
+
+// secretFields returns the values that may hold secret references, keyed by
+// their path in the config file.
+func (c *Config) secretFields() map[string]*string {
+	fields := map[string]*string{
+		"security.alert_webhook":      &c.Security.AlertWebhook,
+		"notify.webhook_url":          &c.Notify.WebhookURL,
+		"server.metrics.bearer_token": &c.Server.Metrics.BearerToken,
+	}
+	for i := range c.Admin.Tokens {
+		fields[fmt.Sprintf("admin.tokens[%d].token", i)] = &c.Admin.Tokens[i].Token
+	}
+	return fields
+}
+
+// resolveEnvSecrets records every secret reference and replaces env://
+// references with their values. secret:// references are left for
+// ResolveSecrets.
+func (c *Config) resolveEnvSecrets() error {
+	c.secretRefs = make(map[string]string)
+	for path, field := range c.secretFields() {
+		switch {
+		case strings.HasPrefix(*field, envRefPrefix):
+			name := strings.TrimPrefix(*field, envRefPrefix)
+			value := os.Getenv(name)
+			if value == "" {
+				return fmt.Errorf("%s: environment variable %s is unset or empty", path, name)
+			}
+			c.secretRefs[path] = *field
+			*field = value
+		case strings.HasPrefix(*field, secretRefPrefix):
+			c.secretRefs[path] = *field
+		}
+	}
+	return nil
+}
+
+// ResolveSecrets replaces secret:// references with values from stored (as
+// returned by LoadSecrets). stored may be nil when there is no master key,
+// in which case any secret:// reference is an error.
+func (c *Config) ResolveSecrets(stored map[string]string) error {
+	fields := c.secretFields()
+	for path, ref := range c.secretRefs {
+		field, ok := fields[path]
+		if !ok || !strings.HasPrefix(ref, secretRefPrefix) || *field != ref {
+			continue
+		}
+		name := strings.TrimPrefix(ref, secretRefPrefix)
+		if stored == nil {
+			return fmt.Errorf("%s: %s needs master_key_env to open the secrets file", path, ref)
+		}
+		value, ok := stored[name]
+		if !ok {
+			return fmt.Errorf("%s: secret %q is not in the secrets file", path, name)
+		}
+		*field = value
+	}
+	return nil
+}
+
+// LoadSecrets decrypts the secrets file in storageDir with the master key.
+// A missing file yields an empty set.
+func LoadSecrets(storageDir string, masterKey []byte) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(storageDir, SecretsFile)) // #nosec G304 -- path built from config
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	plaintext, err := crypto.DecryptKeyFile(masterKey, data, secretsPurpose)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file: %w", err)
+	}
+	defer crypto.ZeroBytes(plaintext)
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	return secrets, nil
+}
+
+// SaveSecrets encrypts secrets with the master key and writes them to the
+// secrets file in storageDir.
+func SaveSecrets(storageDir string, masterKey []byte, secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+	defer crypto.ZeroBytes(plaintext)
+
+	data, err := crypto.EncryptKeyFile(masterKey, plaintext, secretsPurpose)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt secrets: %w", err)
+	}
+	path := filepath.Join(storageDir, SecretsFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+// withSecretRefs returns a copy of c with every resolved secret replaced by
+// the reference it was loaded from.
+func (c *Config) withSecretRefs() *Config {
+	out := *c
+	out.Admin.Tokens = append([]AdminToken(nil), c.Admin.Tokens...)
+	fields := out.secretFields()
+	for path, ref := range c.secretRefs {
+		if field, ok := fields[path]; ok {
+			*field = ref
+		}
+	}
+	return &out
+}
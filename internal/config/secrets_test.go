@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig_EnvSecret(t *testing.T) {
+	t.Setenv("TEST_ALERT_WEBHOOK", "https://alerts.example/hook")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `security:
+  alert_webhook: "env://TEST_ALERT_WEBHOOK"
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig error: %v", err)
+	}
+	if cfg.Security.AlertWebhook != "https://alerts.example/hook" {
+		t.Errorf("AlertWebhook = %q, want resolved value", cfg.Security.AlertWebhook)
+	}
+
+	// SaveConfig writes the reference, not the value
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("alerts.example")) {
+		t.Error("SaveConfig wrote the resolved secret")
+	}
+	if !bytes.Contains(data, []byte("env://TEST_ALERT_WEBHOOK")) {
+		t.Error("SaveConfig dropped the secret reference")
+	}
+	if cfg.Security.AlertWebhook != "https://alerts.example/hook" {
+		t.Error("SaveConfig modified the loaded config")
+	}
+}
+
+func TestLoadConfig_EnvSecretUnset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `notify:
+  webhook_url: "env://TEST_UNSET_WEBHOOK_VAR"
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "notify.webhook_url") {
+		t.Errorf("LoadConfig error = %v, want unset variable error naming the field", err)
+	}
+}
+
+func TestResolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	masterKey := bytes.Repeat([]byte{7}, 32)
+	if err := SaveSecrets(dir, masterKey, map[string]string{"alice": "alice-token-0123456789abcdef0123456789"}); err != nil {
+		t.Fatalf("SaveSecrets error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, SecretsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("alice-token")) {
+		t.Error("secrets file holds plaintext")
+	}
+
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `admin:
+  tokens:
+    - name: alice
+      token: "secret://alice"
+    - name: bob
+      token: "bob-token-0123456789abcdef0123456789"
+`
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cfg.ResolveSecrets(nil); err == nil {
+		t.Error("ResolveSecrets(nil) should fail with a secret:// reference")
+	}
+	if _, err := LoadSecrets(dir, bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Error("LoadSecrets with the wrong master key should fail")
+	}
+
+	stored, err := LoadSecrets(dir, masterKey)
+	if err != nil {
+		t.Fatalf("LoadSecrets error: %v", err)
+	}
+	if err := cfg.ResolveSecrets(stored); err != nil {
+		t.Fatalf("ResolveSecrets error: %v", err)
+	}
+	if cfg.Admin.Tokens[0].Token != "alice-token-0123456789abcdef0123456789" {
+		t.Errorf("token = %q, want stored secret", cfg.Admin.Tokens[0].Token)
+	}
+	if cfg.Admin.Tokens[1].Token != "bob-token-0123456789abcdef0123456789" {
+		t.Error("plain value was changed")
+	}
+
+	if err := SaveConfig(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(saved, []byte("alice-token")) || !bytes.Contains(saved, []byte("secret://alice")) {
+		t.Errorf("SaveConfig wrote a resolved secret:\n%s", saved)
+	}
+
+	delete(stored, "alice")
+	cfg, _ = LoadConfig(path)
+	if err := cfg.ResolveSecrets(stored); err == nil {
+		t.Error("ResolveSecrets should fail for a missing secret")
+	}
+}
+
+func TestLoadSecrets_Missing(t *testing.T) {
+	secrets, err := LoadSecrets(t.TempDir(), bytes.Repeat([]byte{7}, 32))
+	if err != nil || len(secrets) != 0 {
+		t.Errorf("LoadSecrets = %v, %v; want empty set", secrets, err)
+	}
+}
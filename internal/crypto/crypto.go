@@ -1,8 +1,6 @@
 package crypto
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -15,81 +13,35 @@ func ZeroBytes(b []byte) {
 	}
 }
 
-// EncryptStream encrypts data from reader and writes to writer using AES-GCM.
-// The aad parameter provides Additional Authenticated Data (e.g., drop ID)
-// to bind ciphertext to a specific context.
+// EncryptStream encrypts data from reader and writes to writer in the
+// chunked AES-GCM format (see NewEncryptWriter), so memory use does not grow
+// with the size of the data. The aad parameter provides Additional
+// Authenticated Data (e.g., drop ID) to bind ciphertext to a specific
+// context.
 func EncryptStream(key []byte, reader io.Reader, writer io.Writer, aad []byte) error {
-	block, err := aes.NewCipher(key)
+	ew, err := NewEncryptWriter(key, writer, aad)
 	if err != nil {
-		return fmt.Errorf("failed to create cipher: %w", err)
+		return err
 	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("failed to generate nonce: %w", err)
+	if _, err := io.Copy(ew, reader); err != nil {
+		_ = ew.Close()
+		return fmt.Errorf("failed to encrypt: %w", err)
 	}
-
-	// Write nonce first
-	if _, err := writer.Write(nonce); err != nil {
-		return fmt.Errorf("failed to write nonce: %w", err)
-	}
-
-	// Read all data
-	plaintext, err := io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read data: %w", err)
-	}
-	defer ZeroBytes(plaintext)
-
-	ciphertext := gcm.Seal(nil, nonce, plaintext, aad)
-	if _, err := writer.Write(ciphertext); err != nil {
-		return fmt.Errorf("failed to write ciphertext: %w", err)
-	}
-
-	return nil
+	return ew.Close()
 }
 
-// DecryptStream decrypts data from reader and writes to writer using AES-GCM.
-// The aad parameter must match the AAD used during encryption.
+// DecryptStream decrypts data from reader and writes to writer. The aad
+// parameter must match the AAD used during encryption. Chunks are written
+// as they are authenticated, so on error writer may hold part of the
+// plaintext, which the caller must discard.
 func DecryptStream(key []byte, reader io.Reader, writer io.Writer, aad []byte) error {
-	block, err := aes.NewCipher(key)
+	dr, err := NewDecryptReader(key, reader, aad)
 	if err != nil {
-		return fmt.Errorf("failed to create cipher: %w", err)
+		return err
 	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	// Read nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(reader, nonce); err != nil {
-		return fmt.Errorf("failed to read nonce: %w", err)
-	}
-
-	// Read ciphertext
-	ciphertext, err := io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read ciphertext: %w", err)
+	if _, err := io.Copy(writer, dr); err != nil {
+		return err
 	}
-	defer ZeroBytes(ciphertext)
-
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt: %w", err)
-	}
-	defer ZeroBytes(plaintext)
-
-	if _, err := writer.Write(plaintext); err != nil {
-		return fmt.Errorf("failed to write plaintext: %w", err)
-	}
-
 	return nil
 }
 
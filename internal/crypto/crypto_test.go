@@ -2,6 +2,8 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"io"
 	"testing"
@@ -256,6 +258,159 @@ func TestDecryptStream_InvalidKeyLength(t *testing.T) {
 	}
 }
 
+func TestEncryptStream_ChunkBoundaries(t *testing.T) {
+	key, _ := GenerateKey()
+	for _, n := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3 * StreamChunkSize} {
+		plaintext := make([]byte, n)
+		if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+			t.Fatal(err)
+		}
+
+		var cipherBuf bytes.Buffer
+		if err := EncryptStream(key, bytes.NewReader(plaintext), &cipherBuf, []byte("id")); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := int64(cipherBuf.Len()), EncryptedSize(int64(n)); got != want {
+			t.Errorf("%d bytes: encrypted size = %d, want %d", n, got, want)
+		}
+
+		var decBuf bytes.Buffer
+		if err := DecryptStream(key, &cipherBuf, &decBuf, []byte("id")); err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(decBuf.Bytes(), plaintext) {
+			t.Errorf("%d bytes: round-trip failed", n)
+		}
+	}
+}
+
+func TestDecryptStream_TruncatedAtChunkBoundary(t *testing.T) {
+	key, _ := GenerateKey()
+	plaintext := make([]byte, 2*StreamChunkSize+100)
+
+	var cipherBuf bytes.Buffer
+	if err := EncryptStream(key, bytes.NewReader(plaintext), &cipherBuf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping whole chunks leaves chunks that authenticate on their own
+	for _, chunks := range []int{1, 2} {
+		cut := streamHeaderSize + chunks*(StreamChunkSize+gcmTagSize)
+		err := DecryptStream(key, bytes.NewReader(cipherBuf.Bytes()[:cut]), io.Discard, nil)
+		if err == nil {
+			t.Errorf("stream cut after %d chunks decrypted without error", chunks)
+		}
+	}
+}
+
+func TestDecryptStream_ReorderedChunks(t *testing.T) {
+	key, _ := GenerateKey()
+	plaintext := make([]byte, 3*StreamChunkSize)
+
+	var cipherBuf bytes.Buffer
+	if err := EncryptStream(key, bytes.NewReader(plaintext), &cipherBuf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := cipherBuf.Bytes()
+	size := StreamChunkSize + gcmTagSize
+	first := append([]byte{}, data[streamHeaderSize:streamHeaderSize+size]...)
+	copy(data[streamHeaderSize:], data[streamHeaderSize+size:streamHeaderSize+2*size])
+	copy(data[streamHeaderSize+size:], first)
+
+	if err := DecryptStream(key, bytes.NewReader(data), io.Discard, nil); err == nil {
+		t.Error("stream with swapped chunks decrypted without error")
+	}
+}
+
+func TestDecryptStream_Legacy(t *testing.T) {
+	key, _ := GenerateKey()
+	plaintext := []byte("written before the chunked format")
+
+	// The legacy format: a random nonce and one GCM ciphertext
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		t.Fatal(err)
+	}
+	legacy := gcm.Seal(append([]byte{}, nonce...), nonce, plaintext, []byte("id"))
+
+	var decBuf bytes.Buffer
+	if err := DecryptStream(key, bytes.NewReader(legacy), &decBuf, []byte("id")); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decBuf.Bytes(), plaintext) {
+		t.Error("legacy round-trip failed")
+	}
+	if err := DecryptStream(key, bytes.NewReader(legacy), io.Discard, []byte("other")); err == nil {
+		t.Error("legacy stream decrypted with the wrong AAD")
+	}
+}
+
+func TestDecryptSeeker_RandomAccess(t *testing.T) {
+	key, _ := GenerateKey()
+	for _, n := range []int{0, 1, StreamChunkSize, 3*StreamChunkSize + 100} {
+		plaintext := make([]byte, n)
+		if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+			t.Fatal(err)
+		}
+		var cipherBuf bytes.Buffer
+		if err := EncryptStream(key, bytes.NewReader(plaintext), &cipherBuf, []byte("id")); err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := NewDecryptSeeker(key, bytes.NewReader(cipherBuf.Bytes()), int64(cipherBuf.Len()), []byte("id"))
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if size, err := d.Seek(0, io.SeekEnd); err != nil || size != int64(n) {
+			t.Errorf("%d bytes: size = %d, %v", n, size, err)
+		}
+		for _, off := range []int{0, n / 2, n - n/3, StreamChunkSize - 1, StreamChunkSize + 1} {
+			if off > n {
+				continue
+			}
+			if _, err := d.Seek(int64(off), io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(d)
+			if err != nil || !bytes.Equal(got, plaintext[off:]) {
+				t.Errorf("%d bytes from %d: %d bytes read, %v", n, off, len(got), err)
+			}
+		}
+	}
+}
+
+func TestDecryptSeeker_TruncatedAtChunkBoundary(t *testing.T) {
+	key, _ := GenerateKey()
+	var cipherBuf bytes.Buffer
+	if err := EncryptStream(key, bytes.NewReader(make([]byte, 2*StreamChunkSize+100)), &cipherBuf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cut := cipherBuf.Bytes()[:streamHeaderSize+StreamChunkSize+gcmTagSize]
+	d, err := NewDecryptSeeker(key, bytes.NewReader(cut), int64(len(cut)), nil)
+	if err == nil {
+		_, err = io.ReadAll(d)
+	}
+	if err == nil {
+		t.Error("stream cut after a chunk decrypted without error")
+	}
+}
+
+func TestDecryptSeeker_WrongKey(t *testing.T) {
+	key, _ := GenerateKey()
+	other, _ := GenerateKey()
+	var cipherBuf bytes.Buffer
+	if err := EncryptStream(key, bytes.NewReader([]byte("data")), &cipherBuf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDecryptSeeker(other, bytes.NewReader(cipherBuf.Bytes()), int64(cipherBuf.Len()), nil); err == nil {
+		t.Error("stream opened with the wrong key")
+	}
+}
+
 func FuzzEncryptDecrypt(f *testing.F) {
 	f.Add([]byte("hello"), []byte("aad"))
 	f.Add([]byte(""), []byte(""))
@@ -282,3 +437,40 @@ func FuzzEncryptDecrypt(f *testing.F) {
 		}
 	})
 }
+
+func benchmarkEncryptStream(b *testing.B, size int) {
+	key, _ := GenerateKey()
+	data := make([]byte, size)
+	rand.Read(data)
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := EncryptStream(key, bytes.NewReader(data), io.Discard, []byte("bench")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecryptStream(b *testing.B, size int) {
+	key, _ := GenerateKey()
+	data := make([]byte, size)
+	rand.Read(data)
+	var sealed bytes.Buffer
+	if err := EncryptStream(key, bytes.NewReader(data), &sealed, []byte("bench")); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := DecryptStream(key, bytes.NewReader(sealed.Bytes()), io.Discard, []byte("bench")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncryptStream_1MB(b *testing.B)   { benchmarkEncryptStream(b, 1<<20) }
+func BenchmarkEncryptStream_100MB(b *testing.B) { benchmarkEncryptStream(b, 100<<20) }
+func BenchmarkDecryptStream_1MB(b *testing.B)   { benchmarkDecryptStream(b, 1<<20) }
+func BenchmarkDecryptStream_100MB(b *testing.B) { benchmarkDecryptStream(b, 100<<20) }
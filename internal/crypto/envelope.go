@@ -0,0 +1,132 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hpke"
+	"errors"
+	"fmt"
+)
+
+// EnvelopeContentType marks a request or response body sealed with an
+// upload envelope.
+const EnvelopeContentType = "application/x-dead-drop-envelope"
+
+// envelopeInfo is the HPKE info of upload envelopes, and replyContext the
+// exporter context of the key that seals the reply.
+const (
+	envelopeInfo = "dead-drop-upload-v1"
+	replyContext = "dead-drop-reply-v1"
+)
+
+// envelopeEncSize is the size of the encapsulated key at the start of an
+// envelope: an X25519 public key.
+const envelopeEncSize = 32
+
+// The envelope suite is DHKEM(X25519, HKDF-SHA256), HKDF-SHA256 and
+// AES-256-GCM, all of which browsers provide through WebCrypto.
+func envelopeSuite() (hpke.KEM, hpke.KDF, hpke.AEAD) {
+	return hpke.DHKEM(ecdh.X25519()), hpke.HKDFSHA256(), hpke.AES256GCM()
+}
+
+// EnvelopeKey is a server's HPKE key for upload envelopes. It is generated
+// in memory and never stored.
+type EnvelopeKey struct {
+	priv hpke.PrivateKey
+}
+
+// NewEnvelopeKey generates a new envelope key.
+func NewEnvelopeKey() (*EnvelopeKey, error) {
+	kem, _, _ := envelopeSuite()
+	priv, err := kem.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate envelope key: %w", err)
+	}
+	return &EnvelopeKey{priv: priv}, nil
+}
+
+// PublicKey returns the X25519 public key that clients seal envelopes to.
+func (k *EnvelopeKey) PublicKey() []byte {
+	return k.priv.PublicKey().Bytes()
+}
+
+// Open decrypts an envelope from SealEnvelope. It returns the plaintext and
+// the key to seal the reply with.
+func (k *EnvelopeKey) Open(envelope []byte) (plaintext, replyKey []byte, err error) {
+	if len(envelope) < envelopeEncSize {
+		return nil, nil, errors.New("envelope too short")
+	}
+	_, kdf, aead := envelopeSuite()
+	r, err := hpke.NewRecipient(envelope[:envelopeEncSize], k.priv, kdf, aead, []byte(envelopeInfo))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid envelope: %w", err)
+	}
+	plaintext, err = r.Open(nil, envelope[envelopeEncSize:])
+	if err != nil {
+		return nil, nil, errors.New("envelope decryption failed")
+	}
+	replyKey, err = r.Export(replyContext, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, replyKey, nil
+}
+
+// SealEnvelope encrypts plaintext to a server's envelope public key. The
+// envelope is the encapsulated key followed by the ciphertext. It also
+// returns the key that opens the server's reply.
+func SealEnvelope(publicKey, plaintext []byte) (envelope, replyKey []byte, err error) {
+	kem, kdf, aead := envelopeSuite()
+	pub, err := kem.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid envelope key: %w", err)
+	}
+	enc, s, err := hpke.NewSender(pub, kdf, aead, []byte(envelopeInfo))
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphertext, err := s.Seal(nil, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	replyKey, err = s.Export(replyContext, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(enc, ciphertext...), replyKey, nil
+}
+
+// replyCipher returns the AES-256-GCM cipher of a reply key. Each reply key
+// seals exactly one message, so the nonce is all zeros.
+func replyCipher(replyKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(replyKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reply key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealReply encrypts the reply to an envelope under the key from
+// EnvelopeKey.Open.
+func SealReply(replyKey, plaintext []byte) ([]byte, error) {
+	gcm, err := replyCipher(replyKey)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nil, make([]byte, gcm.NonceSize()), plaintext, nil), nil
+}
+
+// OpenReply decrypts a reply from SealReply under the key from
+// SealEnvelope.
+func OpenReply(replyKey, sealed []byte) ([]byte, error) {
+	gcm, err := replyCipher(replyKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), sealed, nil)
+	if err != nil {
+		return nil, errors.New("reply decryption failed")
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	key, err := NewEnvelopeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte("multipart body with the file")
+
+	envelope, clientReplyKey, err := SealEnvelope(key.PublicKey(), body)
+	if err != nil {
+		t.Fatalf("SealEnvelope error: %v", err)
+	}
+	if bytes.Contains(envelope, body) {
+		t.Error("envelope contains plaintext")
+	}
+
+	got, serverReplyKey, err := key.Open(envelope)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Errorf("opened %q, want %q", got, body)
+	}
+	if !bytes.Equal(clientReplyKey, serverReplyKey) {
+		t.Fatal("client and server derived different reply keys")
+	}
+
+	reply, err := SealReply(serverReplyKey, []byte(`{"receipt":"r"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := OpenReply(clientReplyKey, reply)
+	if err != nil || string(opened) != `{"receipt":"r"}` {
+		t.Errorf("OpenReply = %q, %v", opened, err)
+	}
+}
+
+func TestEnvelope_Tampered(t *testing.T) {
+	key, _ := NewEnvelopeKey()
+	envelope, _, err := SealEnvelope(key.PublicKey(), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	envelope[len(envelope)-1] ^= 1
+	if _, _, err := key.Open(envelope); err == nil {
+		t.Error("tampered envelope opened")
+	}
+	if _, _, err := key.Open(envelope[:10]); err == nil {
+		t.Error("truncated envelope opened")
+	}
+}
+
+func TestEnvelope_WrongKey(t *testing.T) {
+	key, _ := NewEnvelopeKey()
+	other, _ := NewEnvelopeKey()
+	envelope, _, err := SealEnvelope(key.PublicKey(), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := other.Open(envelope); err == nil {
+		t.Error("envelope opened with a different key")
+	}
+}
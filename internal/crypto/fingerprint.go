@@ -0,0 +1,36 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// keyFingerprintContext prefixes the key when hashing it for a fingerprint,
+// so that a fingerprint is never the plain SHA-256 of the key.
+const keyFingerprintContext = "dead-drop-key-fingerprint-v1\n"
+
+// KeyFingerprintLen is the length of a fingerprint from KeyFingerprint.
+const KeyFingerprintLen = 32
+
+// KeyFingerprint identifies a client-side encryption key without revealing
+// it: the first 16 bytes of SHA-256(context || key), as lowercase hex. The
+// web UI computes the same value with WebCrypto.
+func KeyFingerprint(key []byte) string {
+	h := sha256.New()
+	h.Write([]byte(keyFingerprintContext))
+	h.Write(key)
+	return hex.EncodeToString(h.Sum(nil)[:KeyFingerprintLen/2])
+}
+
+// ValidKeyFingerprint reports whether s has the form of a KeyFingerprint.
+func ValidKeyFingerprint(s string) bool {
+	if len(s) != KeyFingerprintLen {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
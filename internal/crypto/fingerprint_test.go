@@ -0,0 +1,29 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	// Fixed, so that the web UI's implementation can be checked against it
+	fp := KeyFingerprint(key)
+	if fp != "00725b84c91ef6324ae884ab2ebe5d3d" {
+		t.Fatalf("KeyFingerprint = %q", fp)
+	}
+	if !ValidKeyFingerprint(fp) {
+		t.Fatalf("ValidKeyFingerprint(%q) = false", fp)
+	}
+	other := bytes.Repeat([]byte{0x43}, 32)
+	if fp == KeyFingerprint(other) {
+		t.Error("different keys share a fingerprint")
+	}
+
+	for _, bad := range []string{"", strings.ToUpper(fp), fp[:31], fp + "0", strings.Repeat("g", 32)} {
+		if ValidKeyFingerprint(bad) {
+			t.Errorf("ValidKeyFingerprint(%q) = true", bad)
+		}
+	}
+}
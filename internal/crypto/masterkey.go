@@ -49,6 +49,16 @@ func DeriveMasterKey(passphrase string, salt []byte) []byte {
 	return argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 4, 32)
 }
 
+// DropKeyMemory is how much memory DeriveDropKey uses, for callers that
+// budget it.
+const DropKeyMemory = 64 << 20
+
+// DeriveDropKey derives a 32-byte key for a passphrase-protected drop from
+// its passphrase and salt using Argon2id, with the master key's parameters.
+func DeriveDropKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 3, DropKeyMemory/1024, 4, 32)
+}
+
 // EncryptKeyFile encrypts a plaintext key using AES-256-GCM with the master key.
 // The purpose parameter is used as Additional Authenticated Data (AAD) to bind
 // the ciphertext to its intended use (e.g., "encryption-key" or "receipt-key").
@@ -0,0 +1,194 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Sealed files are age files (age-encryption.org/v1) encrypted to an age
+// X25519 recipient, so that `age -d -i key.txt` opens them. The file's name
+// travels in an extra header stanza, which age itself skips: its body is
+// the name encrypted with ChaCha20-Poly1305 under a key derived from the
+// file key, and the header MAC covers it like any other stanza.
+
+// sealedIntro starts every age file.
+const sealedIntro = "age-encryption.org/v1\n"
+
+// nameStanza is the type of the header stanza carrying the file's name.
+const nameStanza = "dead-drop-name"
+
+// nameInfo is the HKDF info for the key that encrypts the name stanza.
+var nameInfo = []byte("dead-drop-seal-name-v1")
+
+// maxSealedName bounds the filename carried inside a sealed file.
+const maxSealedName = 1024
+
+// Sizes of the parts of a sealed file; the payload is a nonce and then
+// ChaCha20-Poly1305 chunks.
+const (
+	ageChunkSize   = 64 * 1024
+	ageNonceSize   = 16
+	ageColumns     = 64
+	x25519Stanza   = len("-> X25519 ") + 43 + 1 + 43 + 1 // ephemeral share, wrapped file key
+	sealedMACLine  = len("--- ") + 43 + 1
+	nameStanzaHead = len("-> " + nameStanza + "\n")
+)
+
+// SealedSize is how many bytes SealFile writes for a file of size bytes
+// named with nameLen bytes: the age header with its X25519 and name
+// stanzas, then the payload nonce and chunks.
+func SealedSize(nameLen int, size int64) int64 {
+	body := base64.RawStdEncoding.EncodedLen(nameLen + chacha20poly1305.Overhead)
+	header := len(sealedIntro) + x25519Stanza + nameStanzaHead + body + body/ageColumns + 1 + sealedMACLine
+	chunks := max((size+ageChunkSize-1)/ageChunkSize, 1)
+	return int64(header) + ageNonceSize + size + chunks*chacha20poly1305.Overhead
+}
+
+// SealedHeaderSize is how many bytes of a file IsSealedHeader looks at.
+const SealedHeaderSize = len(sealedIntro)
+
+// IsSealedHeader reports whether header, the first SealedHeaderSize bytes
+// of a file, starts an age file, as SealFile writes. It cannot tell which
+// key the file was sealed to, or whether the rest of it will open.
+func IsSealedHeader(header []byte) bool {
+	return bytes.HasPrefix(header, []byte(sealedIntro))
+}
+
+// ParseRecipient parses an age X25519 recipient, "age1...", the form
+// receivers' public keys take.
+func ParseRecipient(s string) (*age.X25519Recipient, error) {
+	r, err := age.ParseX25519Recipient(strings.TrimSpace(s))
+	if err != nil {
+		return nil, errors.New("not an age X25519 recipient (age1...)")
+	}
+	return r, nil
+}
+
+// ParseIdentity reads an age identity file, as dead-drop-keygen and
+// age-keygen write: an "AGE-SECRET-KEY-1..." line, with # comments allowed.
+func ParseIdentity(data []byte) (*age.X25519Identity, error) {
+	ids, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.New("not an age identity file (AGE-SECRET-KEY-1...)")
+	}
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			return x, nil
+		}
+	}
+	return nil, errors.New("identity file holds no X25519 key")
+}
+
+// RecipientFingerprint is the KeyFingerprint of a recipient's age1 form,
+// which sources compare with the one the receivers published.
+func RecipientFingerprint(r *age.X25519Recipient) string {
+	return KeyFingerprint([]byte(r.String()))
+}
+
+// SealFile encrypts a file and its name to an age X25519 recipient. Only
+// the holder of the matching identity can open it, so the name and
+// contents are never readable in transit; `age -d` recovers the contents,
+// and OpenSealedFile the name as well.
+func SealFile(recipient *age.X25519Recipient, filename string, reader io.Reader, writer io.Writer) error {
+	if recipient == nil {
+		return errors.New("no recipient key")
+	}
+	if len(filename) > maxSealedName {
+		return errors.New("filename too long to seal")
+	}
+	w, err := age.Encrypt(writer, &namedRecipient{recipient, filename})
+	if err != nil {
+		return fmt.Errorf("failed to seal: %w", err)
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// OpenSealedFile decrypts an age file with the recipient's identity,
+// returning the filename and contents. The name is "" for an age file
+// sealed without one, by age itself for instance. The caller should zero
+// the contents when done.
+func OpenSealedFile(identity *age.X25519Identity, reader io.Reader) (string, []byte, error) {
+	id := &namedIdentity{X25519Identity: identity}
+	r, err := age.Decrypt(reader, id)
+	if err != nil {
+		return "", nil, err
+	}
+	var plaintext bytes.Buffer
+	if _, err := io.Copy(&plaintext, r); err != nil {
+		ZeroBytes(plaintext.Bytes())
+		return "", nil, err
+	}
+	return id.name, plaintext.Bytes(), nil
+}
+
+// namedRecipient adds the name stanza to an X25519 recipient's.
+type namedRecipient struct {
+	*age.X25519Recipient
+	name string
+}
+
+func (r *namedRecipient) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	stanzas, err := r.X25519Recipient.Wrap(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := nameAEAD(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	// The name key is used once, so the nonce is all zeros
+	body := aead.Seal(nil, make([]byte, aead.NonceSize()), []byte(r.name), nil)
+	return append(stanzas, &age.Stanza{Type: nameStanza, Body: body}), nil
+}
+
+// namedIdentity unwraps the file key as an X25519 identity does and then
+// decrypts the name stanza, if there is one.
+type namedIdentity struct {
+	*age.X25519Identity
+	name string
+}
+
+func (id *namedIdentity) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	fileKey, err := id.X25519Identity.Unwrap(stanzas)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stanzas {
+		if s.Type != nameStanza {
+			continue
+		}
+		aead, err := nameAEAD(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		name, err := aead.Open(nil, make([]byte, aead.NonceSize()), s.Body, nil)
+		if err != nil || len(name) > maxSealedName {
+			return nil, errors.New("sealed file name corrupt")
+		}
+		id.name = string(name)
+	}
+	return fileKey, nil
+}
+
+// nameAEAD returns the cipher for the name stanza of the file with fileKey.
+func nameAEAD(fileKey []byte) (cipher.AEAD, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nil, nameInfo), key); err != nil {
+		return nil, fmt.Errorf("failed to derive name key: %w", err)
+	}
+	defer ZeroBytes(key)
+	return chacha20poly1305.New(key)
+}
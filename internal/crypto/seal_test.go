@@ -0,0 +1,147 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestSealFile_RoundTrip(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("leaked memo contents")
+
+	var sealed bytes.Buffer
+	if err := SealFile(id.Recipient(), "memo.pdf", bytes.NewReader(content), &sealed); err != nil {
+		t.Fatalf("SealFile error: %v", err)
+	}
+	if bytes.Contains(sealed.Bytes(), content) || bytes.Contains(sealed.Bytes(), []byte("memo.pdf")) {
+		t.Error("sealed output contains plaintext")
+	}
+
+	name, data, err := OpenSealedFile(id, bytes.NewReader(sealed.Bytes()))
+	if err != nil {
+		t.Fatalf("OpenSealedFile error: %v", err)
+	}
+	if name != "memo.pdf" || !bytes.Equal(data, content) {
+		t.Errorf("got %q %q, want memo.pdf %q", name, data, content)
+	}
+}
+
+func TestSealFile_AgeCompatible(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// age itself opens a sealed file, skipping the name
+	var sealed bytes.Buffer
+	if err := SealFile(id.Recipient(), "memo.pdf", strings.NewReader("contents"), &sealed); err != nil {
+		t.Fatal(err)
+	}
+	r, err := age.Decrypt(&sealed, id)
+	if err != nil {
+		t.Fatalf("age.Decrypt: %v", err)
+	}
+	var data bytes.Buffer
+	if _, err := data.ReadFrom(r); err != nil || data.String() != "contents" {
+		t.Errorf("age.Decrypt = %q, %v", data.String(), err)
+	}
+
+	// and a file age sealed opens without a name
+	var plain bytes.Buffer
+	w, err := age.Encrypt(&plain, id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("from age"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	name, got, err := OpenSealedFile(id, &plain)
+	if err != nil || name != "" || string(got) != "from age" {
+		t.Errorf("OpenSealedFile = %q %q %v", name, got, err)
+	}
+}
+
+func TestSealedSize(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "a.txt", strings.Repeat("n", 32), strings.Repeat("n", 100)} {
+		for _, size := range []int{0, 1, 64 * 1024, 64*1024 + 1, 3 * 64 * 1024} {
+			var sealed bytes.Buffer
+			if err := SealFile(id.Recipient(), name, bytes.NewReader(make([]byte, size)), &sealed); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := int64(sealed.Len()), SealedSize(len(name), int64(size)); got != want {
+				t.Errorf("name %d bytes, size %d: sealed size = %d, want %d", len(name), size, got, want)
+			}
+		}
+	}
+}
+
+func TestIsSealedHeader(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sealed bytes.Buffer
+	if err := SealFile(id.Recipient(), "a.txt", bytes.NewReader(nil), &sealed); err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealedHeader(sealed.Bytes()[:SealedHeaderSize]) {
+		t.Error("sealed file not recognized")
+	}
+
+	var stream bytes.Buffer
+	if err := EncryptStream(make([]byte, 32), bytes.NewReader(make([]byte, 100)), &stream, nil); err != nil {
+		t.Fatal(err)
+	}
+	if IsSealedHeader(stream.Bytes()[:SealedHeaderSize]) || IsSealedHeader(sealed.Bytes()[:SealedHeaderSize-1]) {
+		t.Error("stream or short header taken for a sealed file")
+	}
+}
+
+func TestOpenSealedFile_WrongKey(t *testing.T) {
+	id, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+
+	var sealed bytes.Buffer
+	if err := SealFile(id.Recipient(), "a.txt", bytes.NewReader([]byte("x")), &sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenSealedFile(other, &sealed); err == nil {
+		t.Error("a different private key should not open the file")
+	}
+}
+
+func TestParseRecipientAndIdentity(t *testing.T) {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ParseRecipient(id.Recipient().String() + "\n")
+	if err != nil || r.String() != id.Recipient().String() {
+		t.Errorf("ParseRecipient = %v, %v", r, err)
+	}
+	for _, bad := range []string{"", "not-a-key", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", id.String()} {
+		if _, err := ParseRecipient(bad); err == nil {
+			t.Errorf("ParseRecipient(%q) should fail", bad)
+		}
+	}
+
+	file := "# created: 2026-01-01T00:00:00Z\n# public key: " + id.Recipient().String() + "\n" + id.String() + "\n"
+	parsed, err := ParseIdentity([]byte(file))
+	if err != nil || parsed.String() != id.String() {
+		t.Errorf("ParseIdentity = %v, %v", parsed, err)
+	}
+	if _, err := ParseIdentity([]byte(id.Recipient().String())); err == nil {
+		t.Error("a recipient is not an identity")
+	}
+}
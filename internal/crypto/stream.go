@@ -0,0 +1,447 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/scttfrdmn/dead-drop/internal/faultinject"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Streams are written in the chunked format: a header of streamMagic and a
+// random salt, then the plaintext in StreamChunkSize chunks, each sealed
+// with AES-GCM on its own. Every stream gets a fresh key derived from the
+// caller's key and the salt, so the chunk nonces can be a counter. The last
+// nonce byte marks the final chunk, so a stream cut at a chunk boundary
+// fails to decrypt, as do reordered or dropped chunks.
+//
+// Streams written before the chunked format are a random 12-byte nonce and
+// a single GCM ciphertext; they are still decrypted, but only whole.
+
+// StreamChunkSize is how much plaintext each chunk of a stream holds.
+const StreamChunkSize = 64 * 1024
+
+const (
+	streamSaltSize   = 32
+	streamHeaderSize = 8 + streamSaltSize
+	gcmTagSize       = 16
+	gcmNonceSize     = 12
+)
+
+// streamMagic starts every chunked stream. A legacy stream starts with a
+// random nonce, which matches it with negligible probability.
+var streamMagic = []byte("DDSTRM\x00\x01")
+
+// streamInfo is the HKDF info for per-stream keys.
+var streamInfo = []byte("dead-drop-stream-v1")
+
+// EncryptedSize is how many bytes EncryptStream writes for n bytes of
+// plaintext.
+func EncryptedSize(n int64) int64 {
+	chunks := (n + StreamChunkSize - 1) / StreamChunkSize
+	if chunks == 0 {
+		chunks = 1 // an empty stream still has its final chunk
+	}
+	return streamHeaderSize + n + chunks*gcmTagSize
+}
+
+// streamCipher derives the per-stream key from key and salt.
+func streamCipher(key, salt []byte) (cipher.AEAD, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	streamKey := make([]byte, 32)
+	defer ZeroBytes(streamKey)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, streamInfo), streamKey); err != nil {
+		return nil, fmt.Errorf("failed to derive stream key: %w", err)
+	}
+	block, err := aes.NewCipher(streamKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// chunkNonce returns the nonce of chunk number counter.
+func chunkNonce(nonce []byte, counter uint64, final bool) []byte {
+	ZeroBytes(nonce)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptWriter seals what is written to it chunk by chunk.
+type encryptWriter struct {
+	w       io.Writer
+	gcm     cipher.AEAD
+	aad     []byte
+	buf     []byte // pending plaintext, up to StreamChunkSize
+	out     []byte
+	nonce   []byte
+	counter uint64
+	closed  bool
+}
+
+// NewEncryptWriter returns a writer that encrypts everything written to it
+// onto w, holding at most one chunk in memory. The stream is incomplete,
+// and will not decrypt, until Close returns nil. Close does not close w.
+func NewEncryptWriter(key []byte, w io.Writer, aad []byte) (io.WriteCloser, error) {
+	if err := faultinject.Check(faultinject.CryptoEncrypt); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	salt := make([]byte, streamSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	gcm, err := streamCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(append([]byte{}, streamMagic...), salt...)); err != nil {
+		return nil, fmt.Errorf("failed to write stream header: %w", err)
+	}
+	return &encryptWriter{
+		w:     w,
+		gcm:   gcm,
+		aad:   aad,
+		buf:   make([]byte, 0, StreamChunkSize),
+		out:   make([]byte, 0, StreamChunkSize+gcmTagSize),
+		nonce: make([]byte, gcmNonceSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is sealed only once more data follows, since
+		// the final chunk must be marked as such
+		if len(e.buf) == StreamChunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):StreamChunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close seals the final chunk and zeroes the buffers.
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	err := e.seal(true)
+	ZeroBytes(e.buf[:cap(e.buf)])
+	return err
+}
+
+func (e *encryptWriter) seal(final bool) error {
+	e.out = e.gcm.Seal(e.out[:0], chunkNonce(e.nonce, e.counter, final), e.buf, e.aad)
+	ZeroBytes(e.buf)
+	e.buf = e.buf[:0]
+	e.counter++
+	if _, err := e.w.Write(e.out); err != nil {
+		return fmt.Errorf("failed to write ciphertext: %w", err)
+	}
+	return nil
+}
+
+// decryptReader opens a chunked stream chunk by chunk.
+type decryptReader struct {
+	r       *bufio.Reader
+	gcm     cipher.AEAD
+	aad     []byte
+	in      []byte
+	plain   []byte // the opened chunk
+	pending []byte // the part of plain not yet read
+	nonce   []byte
+	counter uint64
+	err     error // sticky: io.EOF after the final chunk, or a failure
+}
+
+// NewDecryptReader returns a reader of the plaintext of the stream in r,
+// holding at most one chunk in memory. Each chunk is authenticated before
+// any of it is returned, but a damaged or truncated stream is only detected
+// at the chunk where it goes wrong: earlier chunks will already have been
+// read, so callers must treat everything read as unconfirmed until Read
+// returns io.EOF. The first chunk is opened before NewDecryptReader
+// returns; legacy single-GCM streams are read and authenticated whole.
+func NewDecryptReader(key []byte, r io.Reader, aad []byte) (io.Reader, error) {
+	if err := faultinject.Check(faultinject.CryptoDecrypt); err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header[:gcmNonceSize]); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+	if !bytes.Equal(header[:len(streamMagic)], streamMagic) {
+		return decryptLegacy(key, header[:gcmNonceSize], r, aad)
+	}
+	if _, err := io.ReadFull(r, header[gcmNonceSize:]); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	gcm, err := streamCipher(key, header[len(streamMagic):])
+	if err != nil {
+		return nil, err
+	}
+	d := &decryptReader{
+		r:     bufio.NewReaderSize(r, StreamChunkSize+gcmTagSize),
+		gcm:   gcm,
+		aad:   aad,
+		in:    make([]byte, StreamChunkSize+gcmTagSize),
+		plain: make([]byte, 0, StreamChunkSize),
+		nonce: make([]byte, gcmNonceSize),
+	}
+	// The first chunk is opened at once, so a wrong key or AAD, and any
+	// damage to a stream of a single chunk, is reported here
+	if d.err = d.open(); d.err != nil && d.err != io.EOF {
+		return nil, d.err
+	}
+	return d, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.open()
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	if len(d.pending) == 0 {
+		ZeroBytes(d.plain[:cap(d.plain)])
+	}
+	return n, nil
+}
+
+// open reads and authenticates the next chunk. It returns io.EOF once the
+// final chunk is open.
+func (d *decryptReader) open() error {
+	n, err := io.ReadFull(d.r, d.in)
+	final := false
+	switch {
+	case err == io.EOF:
+		return errors.New("failed to decrypt: stream truncated")
+	case err == io.ErrUnexpectedEOF:
+		final = true
+	case err != nil:
+		return fmt.Errorf("failed to read ciphertext: %w", err)
+	default:
+		// A full chunk is final only if nothing follows it
+		if _, err := d.r.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return fmt.Errorf("failed to read ciphertext: %w", err)
+		}
+	}
+
+	plain, err := d.gcm.Open(d.plain[:0], chunkNonce(d.nonce, d.counter, final), d.in[:n], d.aad)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	d.counter++
+	d.pending = plain
+	if final {
+		return io.EOF
+	}
+	return nil
+}
+
+// NewDecryptSeeker is NewDecryptReader for a stream of size bytes that can
+// be read from any offset: seeking moves through the plaintext, and only the
+// chunk holding the new offset is read and authenticated. As the chunk count
+// follows from size, a stream cut at a chunk boundary fails at its last
+// chunk, which was not sealed as final. Legacy streams are decrypted whole.
+func NewDecryptSeeker(key []byte, r io.ReadSeeker, size int64, aad []byte) (io.ReadSeeker, error) {
+	if err := faultinject.Check(faultinject.CryptoDecrypt); err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header[:gcmNonceSize]); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+	if !bytes.Equal(header[:len(streamMagic)], streamMagic) {
+		plaintext, err := openLegacy(key, header[:gcmNonceSize], r, aad)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(plaintext), nil
+	}
+	if _, err := io.ReadFull(r, header[gcmNonceSize:]); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	// Every chunk but the last is full, and the last holds at least its tag
+	body := size - streamHeaderSize
+	chunks := body / (StreamChunkSize + gcmTagSize)
+	if rest := body % (StreamChunkSize + gcmTagSize); rest > 0 {
+		if rest < gcmTagSize {
+			return nil, errors.New("failed to decrypt: stream truncated")
+		}
+		chunks++
+	}
+	if chunks == 0 {
+		return nil, errors.New("failed to decrypt: stream truncated")
+	}
+	gcm, err := streamCipher(key, header[len(streamMagic):])
+	if err != nil {
+		return nil, err
+	}
+	d := &decryptSeeker{
+		r:      r,
+		gcm:    gcm,
+		aad:    aad,
+		size:   body - chunks*gcmTagSize,
+		chunks: chunks,
+		in:     make([]byte, StreamChunkSize+gcmTagSize),
+		plain:  make([]byte, 0, StreamChunkSize),
+		nonce:  make([]byte, gcmNonceSize),
+	}
+	// As with NewDecryptReader, a wrong key or AAD is reported here
+	if err := d.open(0); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// decryptSeeker opens the chunk of a stream holding the current offset.
+type decryptSeeker struct {
+	r      io.ReadSeeker
+	gcm    cipher.AEAD
+	aad    []byte
+	size   int64 // of the plaintext
+	chunks int64
+	in     []byte
+	plain  []byte // the open chunk, or empty
+	chunk  int64  // the number of the open chunk
+	nonce  []byte
+	off    int64
+}
+
+func (d *decryptSeeker) Read(p []byte) (int, error) {
+	if d.off >= d.size {
+		return 0, io.EOF
+	}
+	chunk := d.off / StreamChunkSize
+	if len(d.plain) == 0 || chunk != d.chunk {
+		if err := d.open(chunk); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain[d.off-chunk*StreamChunkSize:])
+	d.off += int64(n)
+	return n, nil
+}
+
+func (d *decryptSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.off
+	case io.SeekEnd:
+		offset += d.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.off = offset
+	return offset, nil
+}
+
+// open reads and authenticates chunk number chunk.
+func (d *decryptSeeker) open(chunk int64) error {
+	ZeroBytes(d.plain[:cap(d.plain)])
+	d.plain = d.plain[:0]
+	if _, err := d.r.Seek(streamHeaderSize+chunk*(StreamChunkSize+gcmTagSize), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+	in := d.in
+	final := chunk == d.chunks-1
+	if final {
+		in = in[:d.size-chunk*StreamChunkSize+gcmTagSize]
+	}
+	if _, err := io.ReadFull(d.r, in); err != nil {
+		return fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+	plain, err := d.gcm.Open(d.plain[:0], chunkNonce(d.nonce, uint64(chunk), final), in, d.aad) // #nosec G115 -- chunk is not negative
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	d.plain, d.chunk = plain, chunk
+	return nil
+}
+
+// decryptLegacy authenticates a stream written before the chunked format,
+// which is a single GCM ciphertext after its nonce.
+func decryptLegacy(key, nonce []byte, r io.Reader, aad []byte) (io.Reader, error) {
+	plaintext, err := openLegacy(key, nonce, r, aad)
+	if err != nil {
+		return nil, err
+	}
+	return &zeroingReader{data: plaintext}, nil
+}
+
+// openLegacy returns the plaintext of a legacy stream.
+func openLegacy(key, nonce []byte, r io.Reader, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ciphertext: %w", err)
+	}
+	plaintext, err := gcm.Open(ciphertext[:0], nonce, ciphertext, aad)
+	if err != nil {
+		ZeroBytes(ciphertext)
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+// zeroingReader reads a buffer and zeroes it once it has all been read.
+type zeroingReader struct {
+	data []byte
+	off  int
+}
+
+func (z *zeroingReader) Read(p []byte) (int, error) {
+	if z.off >= len(z.data) {
+		ZeroBytes(z.data)
+		return 0, io.EOF
+	}
+	n := copy(p, z.data[z.off:])
+	z.off += n
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// timeAssertionContext prefixes every signed time assertion, so that the
+// signing key cannot be used to sign anything else.
+const timeAssertionContext = "dead-drop-time-v1\n"
+
+// TimeAssertionKey returns the Ed25519 key that signs time assertions, from a
+// 32-byte seed.
+func TimeAssertionKey(seed []byte) (ed25519.PrivateKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("time assertion seed must be 32 bytes")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// timeAssertionMessage is what a time assertion signs: the hour a drop was
+// received (Unix seconds, truncated to the hour) and its ID.
+func timeAssertionMessage(hour int64, dropID string) []byte {
+	msg := []byte(timeAssertionContext)
+	msg = strconv.AppendInt(msg, hour, 10)
+	msg = append(msg, '\n')
+	return append(msg, dropID...)
+}
+
+// SignTimeAssertion signs the statement that drop dropID was received in
+// the hour starting at hour.
+func SignTimeAssertion(key ed25519.PrivateKey, hour int64, dropID string) []byte {
+	return ed25519.Sign(key, timeAssertionMessage(hour, dropID))
+}
+
+// VerifyTimeAssertion reports whether sig is a time assertion by pub for
+// hour and dropID.
+func VerifyTimeAssertion(pub ed25519.PublicKey, hour int64, dropID string, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(pub, timeAssertionMessage(hour, dropID), sig)
+}
+
+// TimeAssertionSkew returns how far now lies outside the hour starting at
+// hour: negative if now is earlier, positive if later, zero within it.
+func TimeAssertionSkew(hour int64, now time.Time) time.Duration {
+	start := time.Unix(hour, 0)
+	end := start.Add(time.Hour)
+	switch {
+	case now.Before(start):
+		return now.Sub(start)
+	case !now.Before(end):
+		return now.Sub(end)
+	}
+	return 0
+}
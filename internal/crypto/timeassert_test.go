@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+func TestTimeAssertion_RoundTrip(t *testing.T) {
+	key, err := TimeAssertionKey(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	hour := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC).Unix()
+
+	sig := SignTimeAssertion(key, hour, "abc123")
+	if !VerifyTimeAssertion(pub, hour, "abc123", sig) {
+		t.Fatal("valid assertion did not verify")
+	}
+	if VerifyTimeAssertion(pub, hour+3600, "abc123", sig) {
+		t.Error("assertion verified for a different hour")
+	}
+	if VerifyTimeAssertion(pub, hour, "abc124", sig) {
+		t.Error("assertion verified for a different drop")
+	}
+	other, _ := TimeAssertionKey(bytes.Repeat([]byte{8}, 32))
+	if VerifyTimeAssertion(other.Public().(ed25519.PublicKey), hour, "abc123", sig) {
+		t.Error("assertion verified under a different key")
+	}
+	if VerifyTimeAssertion(pub[:16], hour, "abc123", sig) {
+		t.Error("assertion verified under a truncated key")
+	}
+}
+
+func TestTimeAssertionKey_BadSeed(t *testing.T) {
+	if _, err := TimeAssertionKey(make([]byte, 16)); err == nil {
+		t.Error("expected error for short seed")
+	}
+}
+
+func TestTimeAssertionSkew(t *testing.T) {
+	start := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	hour := start.Unix()
+	tests := []struct {
+		now  time.Time
+		want time.Duration
+	}{
+		{start, 0},
+		{start.Add(59 * time.Minute), 0},
+		{start.Add(-10 * time.Minute), -10 * time.Minute},
+		{start.Add(3 * time.Hour), 2 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := TimeAssertionSkew(hour, tt.now); got != tt.want {
+			t.Errorf("TimeAssertionSkew(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !faultinject
+
+package faultinject
+
+import "io"
+
+// Enabled reports whether fault injection is compiled in.
+const Enabled = false
+
+// Check returns the injected error for p, if any.
+func Check(Point) error { return nil }
+
+// Writer wraps w so that writes at p can fail or stop short.
+func Writer(_ Point, w io.Writer) io.Writer { return w }
+
+// Reader wraps r so that reads at p can fail or stop short.
+func Reader(_ Point, r io.Reader) io.Reader { return r }
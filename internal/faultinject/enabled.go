@@ -0,0 +1,134 @@
+//go:build faultinject
+
+package faultinject
+
+import (
+	"io"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Enabled reports whether fault injection is compiled in.
+const Enabled = true
+
+// Fault describes what happens at an injection point.
+type Fault struct {
+	// Rate is the probability (0-1) that an operation fails with Err.
+	Rate float64
+	// Err is the error returned; nil means ErrInjected.
+	Err error
+	// Delay is added before each operation, simulating a slow disk.
+	Delay time.Duration
+	// Limit, if positive, lets a wrapped reader or writer pass only this
+	// many bytes before failing: a partial read or torn write.
+	Limit int64
+}
+
+var (
+	mu     sync.Mutex
+	faults = map[Point]Fault{}
+)
+
+// Set installs a fault at p, replacing any previous one.
+func Set(p Point, f Fault) {
+	mu.Lock()
+	defer mu.Unlock()
+	if f.Err == nil {
+		f.Err = ErrInjected
+	}
+	faults[p] = f
+}
+
+// Reset removes all faults.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	faults = map[Point]Fault{}
+}
+
+func get(p Point) (Fault, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	f, ok := faults[p]
+	return f, ok
+}
+
+// Check returns the injected error for p, if any.
+func Check(p Point) error {
+	f, ok := get(p)
+	if !ok {
+		return nil
+	}
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+	if f.Rate > 0 && rand.Float64() < f.Rate { // #nosec G404 -- test-only fault selection
+		return f.Err
+	}
+	return nil
+}
+
+// Writer wraps w so that writes at p can fail or stop short.
+func Writer(p Point, w io.Writer) io.Writer {
+	f, ok := get(p)
+	if !ok {
+		return w
+	}
+	return &faultyWriter{p: p, w: w, left: f.Limit}
+}
+
+// Reader wraps r so that reads at p can fail or stop short.
+func Reader(p Point, r io.Reader) io.Reader {
+	f, ok := get(p)
+	if !ok {
+		return r
+	}
+	return &faultyReader{p: p, r: r, left: f.Limit}
+}
+
+type faultyWriter struct {
+	p    Point
+	w    io.Writer
+	left int64 // bytes before a torn write; <= 0 means unlimited
+}
+
+func (fw *faultyWriter) Write(b []byte) (int, error) {
+	if err := Check(fw.p); err != nil {
+		return 0, err
+	}
+	if f, _ := get(fw.p); f.Limit > 0 && int64(len(b)) > fw.left {
+		n, _ := fw.w.Write(b[:fw.left])
+		fw.left = 0
+		return n, f.Err
+	}
+	if fw.left > 0 {
+		fw.left -= int64(len(b))
+	}
+	return fw.w.Write(b)
+}
+
+type faultyReader struct {
+	p    Point
+	r    io.Reader
+	left int64
+}
+
+func (fr *faultyReader) Read(b []byte) (int, error) {
+	if err := Check(fr.p); err != nil {
+		return 0, err
+	}
+	f, _ := get(fr.p)
+	if f.Limit > 0 {
+		if fr.left <= 0 {
+			return 0, f.Err
+		}
+		if int64(len(b)) > fr.left {
+			b = b[:fr.left]
+		}
+		n, err := fr.r.Read(b)
+		fr.left -= int64(n)
+		return n, err
+	}
+	return fr.r.Read(b)
+}
@@ -0,0 +1,27 @@
+// Package faultinject lets resilience tests inject failures into storage and
+// crypto: failed or short writes, partial reads, and slow I/O.
+//
+// The hooks are compiled in only with the faultinject build tag:
+//
+//	go test -tags faultinject ./internal/storage/
+//
+// Without the tag every hook is a no-op that the compiler removes, so
+// production binaries carry no injection code.
+package faultinject
+
+import "errors"
+
+// Point names a place where faults can be injected.
+type Point string
+
+// Injection points.
+const (
+	StorageWrite  Point = "storage.write"  // drop data and metadata files
+	StorageRead   Point = "storage.read"   // drop data file
+	StorageDelete Point = "storage.delete" // secure-delete overwrites
+	CryptoEncrypt Point = "crypto.encrypt"
+	CryptoDecrypt Point = "crypto.decrypt"
+)
+
+// ErrInjected is the default error returned by injected faults.
+var ErrInjected = errors.New("injected fault")
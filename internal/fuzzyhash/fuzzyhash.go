@@ -0,0 +1,104 @@
+// Package fuzzyhash computes and compares context-triggered piecewise
+// (ssdeep) hashes, so that near-identical documents can be recognized where
+// a SHA-256 changes with a single edited byte.
+package fuzzyhash
+
+import (
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/glaslos/ssdeep"
+)
+
+// MinSize is the smallest input, in bytes, that yields a meaningful hash.
+const MinSize = 4097
+
+// DefaultThreshold is the score at or above which two hashes are treated as
+// near-duplicates.
+const DefaultThreshold = 80
+
+// ErrTooSmall is returned for inputs shorter than MinSize.
+var ErrTooSmall = errors.New("input too small for a fuzzy hash")
+
+// Sum returns the ssdeep hash of data.
+func Sum(data []byte) (string, error) {
+	if len(data) < MinSize {
+		return "", ErrTooSmall
+	}
+	return ssdeep.FuzzyBytes(data)
+}
+
+// SumReader returns the ssdeep hash of everything read from r.
+func SumReader(r io.Reader) (string, error) {
+	h, err := ssdeep.FuzzyReader(r)
+	if errors.Is(err, ssdeep.ErrFileTooSmall) {
+		return "", ErrTooSmall
+	}
+	return h, err
+}
+
+// Score compares two hashes from Sum on a scale of 0 (unrelated) to 100
+// (identical, or nearly so). Malformed hashes score 0.
+func Score(a, b string) int {
+	score, err := ssdeep.Distance(a, b)
+	if err != nil {
+		return 0
+	}
+	return score
+}
+
+// Valid reports whether h is a well-formed ssdeep hash.
+func Valid(h string) bool {
+	_, err := ssdeep.Distance(h, h)
+	return err == nil
+}
+
+// Cluster groups the keys of hashes whose hashes score at least threshold,
+// directly or through a chain of similar hashes. Only groups of two or more
+// are returned, each sorted, largest group first.
+func Cluster(hashes map[string]string, threshold int) [][]string {
+	keys := make([]string, 0, len(hashes))
+	for k := range hashes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parent := make([]int, len(keys))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range keys {
+		for j := i + 1; j < len(keys); j++ {
+			if find(i) != find(j) && Score(hashes[keys[i]], hashes[keys[j]]) >= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]string)
+	for i, k := range keys {
+		root := find(i)
+		groups[root] = append(groups[root], k)
+	}
+	var clusters [][]string
+	for _, g := range groups {
+		if len(g) > 1 {
+			clusters = append(clusters, g)
+		}
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
@@ -0,0 +1,84 @@
+package fuzzyhash
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func document(seed int64, n int) []byte {
+	r := rand.New(rand.NewSource(seed)) // #nosec G404 -- deterministic test data
+	words := []string{"memo", "budget", "review", "internal", "quarterly", "draft", "confidential", "project"}
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(words[r.Intn(len(words))])
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()
+}
+
+func TestSum_NearDuplicates(t *testing.T) {
+	original := document(1, 20000)
+	edited := append([]byte{}, original...)
+	copy(edited[5000:], []byte("WATERMARK-0042"))
+
+	a, err := Sum(original)
+	if err != nil {
+		t.Fatalf("Sum error: %v", err)
+	}
+	b, err := Sum(edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := Score(a, b); score < 80 {
+		t.Errorf("edited copy scored %d, want >= 80", score)
+	}
+
+	other, err := Sum(document(2, 20000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score := Score(a, other); score > 20 {
+		t.Errorf("unrelated document scored %d", score)
+	}
+
+	r, err := SumReader(bytes.NewReader(original))
+	if err != nil || r != a {
+		t.Errorf("SumReader = %q, %v; want %q", r, err, a)
+	}
+	if !Valid(a) || Valid("not a hash") {
+		t.Error("Valid misjudged a hash")
+	}
+	if Score(a, "garbage") != 0 {
+		t.Error("malformed hash should score 0")
+	}
+}
+
+func TestSum_TooSmall(t *testing.T) {
+	if _, err := Sum([]byte("short")); !errors.Is(err, ErrTooSmall) {
+		t.Errorf("Sum error = %v, want ErrTooSmall", err)
+	}
+	if _, err := SumReader(bytes.NewReader([]byte("short"))); !errors.Is(err, ErrTooSmall) {
+		t.Errorf("SumReader error = %v, want ErrTooSmall", err)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	base := document(1, 20000)
+	near := append([]byte{}, base...)
+	copy(near[9000:], []byte("a different paragraph"))
+	hashes := make(map[string]string)
+	for id, data := range map[string][]byte{"a": base, "b": near, "c": document(2, 20000), "d": document(3, 20000)} {
+		h, err := Sum(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes[id] = h
+	}
+
+	clusters := Cluster(hashes, 80)
+	if len(clusters) != 1 || len(clusters[0]) != 2 || clusters[0][0] != "a" || clusters[0][1] != "b" {
+		t.Errorf("clusters = %v, want [[a b]]", clusters)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"time"
 )
 
-// Alerter sends webhook notifications for honeypot events.
+// Alerter sends webhook notifications for honeypot and canary events.
 type Alerter struct {
 	webhookURL string
 	client     *http.Client
@@ -19,7 +19,9 @@ type AlertPayload struct {
 	Event      string `json:"event"`
 	DropID     string `json:"drop_id"`
 	Timestamp  string `json:"timestamp"`
-	RemoteAddr string `json:"remote_addr"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	Canary     string `json:"canary,omitempty"`   // matched canary document
+	Priority   string `json:"priority,omitempty"` // "high" for canary uploads and hash mismatches
 }
 
 // NewAlerter creates an alerter that POSTs to the given webhook URL.
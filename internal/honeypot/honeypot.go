@@ -58,13 +58,21 @@ func (m *Manager) IsHoneypot(id string) bool {
 	return m.ids[id]
 }
 
-// GenerateHoneypots creates count canary drops using the storage manager.
-// Idempotent: if honeypots already exist, no new ones are created.
+// GenerateHoneypots creates count canary drops using the storage manager,
+// marked as honeypots in their encrypted metadata so that cleanup and
+// offline tools leave them alone. Idempotent: if honeypots already exist, no
+// new ones are created, but any generated before the mark existed are
+// marked.
 func (m *Manager) GenerateHoneypots(count int, sm *storage.Manager) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if len(m.ids) > 0 {
+		for id := range m.ids {
+			if err := sm.MarkHoneypot(id); err != nil {
+				log.Printf("Failed to mark honeypot drop %s: %v", id, err)
+			}
+		}
 		return nil // already generated
 	}
 
@@ -81,7 +89,7 @@ func (m *Manager) GenerateHoneypots(count int, sm *storage.Manager) error {
 			return fmt.Errorf("failed to generate decoy data: %w", err)
 		}
 
-		drop, err := sm.SaveDrop("document.bin", bytes.NewReader(buf))
+		drop, err := sm.SaveDropWithOptions("document.bin", bytes.NewReader(buf), &storage.SaveOptions{Honeypot: true})
 		if err != nil {
 			return fmt.Errorf("failed to save honeypot drop: %w", err)
 		}
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -116,6 +117,57 @@ func TestIdempotent(t *testing.T) {
 	}
 }
 
+func TestGenerateHoneypots_MarksMetadata(t *testing.T) {
+	sm, dir := setupTestStorage(t)
+	m, err := NewManager(dir, "")
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if err := m.GenerateHoneypots(2, sm); err != nil {
+		t.Fatalf("GenerateHoneypots failed: %v", err)
+	}
+	for _, id := range m.IDs() {
+		info, err := sm.Inspect(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.Honeypot {
+			t.Errorf("honeypot %s not marked in metadata", id)
+		}
+	}
+}
+
+func TestGenerateHoneypots_MarksExisting(t *testing.T) {
+	sm, dir := setupTestStorage(t)
+	// A honeypot listed before drops were marked in metadata
+	drop, err := sm.SaveDrop("document.bin", strings.NewReader("decoy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal([]string{drop.ID})
+	if err := os.WriteFile(filepath.Join(dir, ".honeypots"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(dir, "")
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	if err := m.GenerateHoneypots(3, sm); err != nil {
+		t.Fatalf("GenerateHoneypots failed: %v", err)
+	}
+	info, err := sm.Inspect(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Honeypot {
+		t.Error("existing honeypot not marked in metadata")
+	}
+	if len(m.IDs()) != 1 {
+		t.Errorf("expected no new honeypots, got %d", len(m.IDs()))
+	}
+}
+
 func TestPersistence(t *testing.T) {
 	sm, dir := setupTestStorage(t)
 	m, err := NewManager(dir, "")
@@ -0,0 +1,185 @@
+// Package incidents keeps an encrypted record of intrusion-related events
+// (honeypot access, invalid receipts, rate limiting) for incident reports.
+//
+// Events carry no request payloads or addresses: only the kind, the hour in
+// which it happened, the drop concerned (if any), and the coarse network
+// origin. Events with the same fields are counted together in memory and
+// appended to the log on Flush, one sealed line each (see sealedlog).
+package incidents
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/sealedlog"
+)
+
+// Event kinds.
+const (
+	KindCanaryUpload   = "canary_upload"
+	KindHoneypotAccess = "honeypot_access"
+	KindInvalidReceipt = "invalid_receipt"
+	KindRateLimited    = "rate_limited"
+	KindCampaignLimit  = "campaign_limit"  // upload refused by a campaign's max_drops
+	KindReceiptLockout = "receipt_lockout" // drop ID refused after too many wrong receipts
+	KindHashMismatch   = "hash_mismatch"   // retrieved drop did not match its stored hash
+)
+
+// maxPending bounds the distinct events held between flushes, so a flood
+// while the store is locked cannot exhaust memory. Further occurrences of
+// events already pending are still counted.
+const maxPending = 1024
+
+// aad binds log lines to this use of the key.
+var aad = []byte("dead-drop-incidents")
+
+// Event is one kind of incident in one hour.
+type Event struct {
+	Time   time.Time `json:"time"` // truncated to the hour
+	Kind   string    `json:"kind"`
+	DropID string    `json:"drop_id,omitempty"`
+	Origin string    `json:"origin,omitempty"`
+	Count  int       `json:"count"`
+}
+
+type eventKey struct {
+	hour   int64
+	kind   string
+	dropID string
+	origin string
+}
+
+// KeyFunc returns the key used to seal the log. It may fail, for instance
+// while storage is locked, in which case events stay pending.
+type KeyFunc = sealedlog.KeyFunc
+
+// Store records events to an encrypted log file.
+type Store struct {
+	path string
+	log  *sealedlog.Log[Event]
+	now  func() time.Time
+
+	mu      sync.Mutex
+	pending map[eventKey]int
+}
+
+// New returns a store logging to path with keys from key.
+func New(path string, key KeyFunc) *Store {
+	return &Store{
+		path:    path,
+		log:     sealedlog.New[Event](path, "incident log", aad, key),
+		now:     time.Now,
+		pending: make(map[eventKey]int),
+	}
+}
+
+// Record counts an occurrence of an event. It never blocks on disk.
+func (s *Store) Record(kind, dropID, origin string) {
+	k := eventKey{
+		hour:   s.now().UTC().Truncate(time.Hour).Unix(),
+		kind:   kind,
+		dropID: dropID,
+		origin: origin,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[k]; ok || len(s.pending) < maxPending {
+		s.pending[k]++
+	}
+}
+
+// Flush appends pending events to the log. If the key is unavailable the
+// events stay pending and the error is returned.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = make(map[eventKey]int)
+	s.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := s.append(pending)
+	if err != nil {
+		// Put the events back, merging with any recorded meanwhile
+		s.mu.Lock()
+		for k, n := range pending {
+			if _, ok := s.pending[k]; ok || len(s.pending) < maxPending {
+				s.pending[k] += n
+			}
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Store) append(pending map[eventKey]int) error {
+	return s.log.Append(sortedEvents(pending))
+}
+
+// Events flushes pending events and returns all logged events at or after
+// since, oldest first, with identical events combined.
+func (s *Store) Events(since time.Time) ([]Event, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	events, err := s.log.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[eventKey]int)
+	for _, e := range events {
+		if e.Time.Before(since) {
+			continue
+		}
+		merged[eventKey{e.Time.Unix(), e.Kind, e.DropID, e.Origin}] += e.Count
+	}
+	return sortedEvents(merged), nil
+}
+
+// Prune removes events older than maxAge from the log and returns how many
+// lines were removed.
+func (s *Store) Prune(maxAge time.Duration) (int, error) {
+	cutoff := s.now().Add(-maxAge)
+	return s.log.Prune(func(e Event) bool {
+		return !e.Time.Add(time.Hour).Before(cutoff)
+	})
+}
+
+// Rekey re-seals the whole log under newKey, for use after the storage
+// encryption key has been rotated. The store's own key must still open it.
+func (s *Store) Rekey(newKey []byte) error {
+	return s.log.Rekey(newKey)
+}
+
+func sortedEvents(m map[eventKey]int) []Event {
+	events := make([]Event, 0, len(m))
+	for k, n := range m {
+		events = append(events, Event{
+			Time:   time.Unix(k.hour, 0).UTC(),
+			Kind:   k.kind,
+			DropID: k.dropID,
+			Origin: k.origin,
+			Count:  n,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool {
+		a, b := events[i], events[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.DropID != b.DropID {
+			return a.DropID < b.DropID
+		}
+		return a.Origin < b.Origin
+	})
+	return events
+}
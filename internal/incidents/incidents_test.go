@@ -0,0 +1,129 @@
+package incidents
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T) (*Store, *bool) {
+	t.Helper()
+	locked := false
+	key := bytes.Repeat([]byte{7}, 32)
+	s := New(filepath.Join(t.TempDir(), "incidents"), func() ([]byte, error) {
+		if locked {
+			return nil, errors.New("locked")
+		}
+		return append([]byte(nil), key...), nil
+	})
+	return s, &locked
+}
+
+func TestStore_RecordFlushEvents(t *testing.T) {
+	s, _ := testStore(t)
+	at := time.Date(2026, 3, 1, 10, 25, 0, 0, time.UTC)
+	s.now = func() time.Time { return at }
+
+	s.Record(KindHoneypotAccess, "abcdef0123456789abcdef0123456789", "tor_exit")
+	s.Record(KindRateLimited, "", "clearnet")
+	s.Record(KindRateLimited, "", "clearnet")
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	s.Record(KindRateLimited, "", "clearnet")
+
+	events, err := s.Events(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	for _, e := range events {
+		if !e.Time.Equal(at.Truncate(time.Hour)) {
+			t.Errorf("time = %v, want rounded to the hour", e.Time)
+		}
+	}
+	if events[1].Kind != KindRateLimited || events[1].Count != 3 {
+		t.Errorf("rate limit events = %+v, want count 3", events[1])
+	}
+
+	// Nothing readable on disk
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("honeypot")) || bytes.Contains(data, []byte("abcdef")) {
+		t.Error("incident log should be encrypted")
+	}
+}
+
+func TestStore_PendingWhileLocked(t *testing.T) {
+	s, locked := testStore(t)
+	*locked = true
+	s.Record(KindInvalidReceipt, "", "loopback")
+	if err := s.Flush(); err == nil {
+		t.Fatal("Flush should fail while locked")
+	}
+
+	*locked = false
+	events, err := s.Events(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != KindInvalidReceipt {
+		t.Errorf("events = %+v, want the event recorded while locked", events)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s, _ := testStore(t)
+	now := time.Now()
+	s.now = func() time.Time { return now.Add(-48 * time.Hour) }
+	s.Record(KindRateLimited, "", "clearnet")
+	s.now = func() time.Time { return now }
+	s.Record(KindHoneypotAccess, "", "clearnet")
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+	events, _ := s.Events(time.Time{})
+	if len(events) != 1 || events[0].Kind != KindHoneypotAccess {
+		t.Errorf("events after prune = %+v", events)
+	}
+}
+
+func TestStore_Rekey(t *testing.T) {
+	s, _ := testStore(t)
+	s.Record(KindInvalidReceipt, "", "clearnet")
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	newKey := bytes.Repeat([]byte{9}, 32)
+	if err := s.Rekey(newKey); err != nil {
+		t.Fatalf("Rekey error: %v", err)
+	}
+	if _, err := s.Events(time.Time{}); err == nil {
+		t.Error("old key should no longer open the log")
+	}
+
+	rekeyed := New(s.path, func() ([]byte, error) { return append([]byte(nil), newKey...), nil })
+	events, err := rekeyed.Events(time.Time{})
+	if err != nil {
+		t.Fatalf("Events with new key: %v", err)
+	}
+	if len(events) != 1 || events[0].Kind != KindInvalidReceipt {
+		t.Errorf("unexpected events after rekey: %+v", events)
+	}
+}
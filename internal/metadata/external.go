@@ -0,0 +1,235 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/storage"
+)
+
+const (
+	// inputPlaceholder is replaced with the path of the file to scrub.
+	inputPlaceholder = "{input}"
+	// outputPlaceholder is replaced with the path the tool must write to.
+	outputPlaceholder = "{output}"
+
+	defaultToolTimeout   = 30 * time.Second
+	defaultToolMaxOutput = 100 * 1024 * 1024
+
+	// sandboxMaxMemory is the address space a sandboxed tool may map. It
+	// leaves room for office suites, which reserve far more than they use.
+	sandboxMaxMemory = 4 << 30
+)
+
+// ErrToolOutputTooLarge is returned when an external tool produces more
+// output than its configured cap.
+var ErrToolOutputTooLarge = errors.New("external scrubber output exceeds size cap")
+
+// ErrSandboxUnavailable is returned when a tool is to run sandboxed but the
+// platform or the host's settings do not allow it, for instance where user
+// namespaces are disabled.
+var ErrSandboxUnavailable = errors.New("external scrubber sandbox unavailable")
+
+// ExternalTool runs an external metadata removal program (e.g., mat2 or
+// exiftool) as a Transform.
+//
+// The input is written to a private temporary directory and the command is
+// run with that directory as its working directory, no stdin, and an empty
+// environment apart from PATH. Arguments may reference "{input}" and
+// "{output}". The result is read from the {output} path when present, from
+// the input file when InPlace is set, and from stdout otherwise. The scratch
+// files hold plaintext, so they are overwritten before they are removed.
+//
+// With Sandbox set, on Linux, the tool runs in namespaces of its own, with no
+// network and no processes outliving it, without core dumps, and limited in
+// CPU time, memory, and the size of the files it writes. Operators wanting
+// stronger isolation can prefix Command with a launcher such as bwrap or
+// firejail.
+//
+// A converter to another format sets OutputExt. Its result is then always
+// read from {output}, which is named "input" plus OutputExt, as tools that
+// derive the name from their input write it (soffice --convert-to with
+// --outdir .).
+type ExternalTool struct {
+	Command        []string
+	InPlace        bool
+	OutputExt      string        // for converters: the result's extension; "" = the input's
+	Timeout        time.Duration // 0 = 30s
+	MaxOutputBytes int64         // 0 = 100 MB
+	TempDir        string        // parent for scratch directories; "" = os.TempDir()
+	Sandbox        bool          // run in the default sandbox; fails where it is unavailable
+}
+
+// Transform returns a Transform that pipes files through the tool. The
+// extension is used to name the scratch files so tools can detect the format.
+func (t *ExternalTool) Transform(ext string) Transform {
+	ext = normalizeExt(ext)
+	return func(src io.Reader, dst io.Writer) error {
+		return t.run(ext, src, dst)
+	}
+}
+
+func (t *ExternalTool) run(ext string, src io.Reader, dst io.Writer) error {
+	if len(t.Command) == 0 {
+		return fmt.Errorf("external scrubber has no command")
+	}
+
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+	maxOutput := t.MaxOutputBytes
+	if maxOutput <= 0 {
+		maxOutput = defaultToolMaxOutput
+	}
+
+	workDir, err := os.MkdirTemp(t.TempDir, "scrub-")
+	if err != nil {
+		return fmt.Errorf("failed to create scratch directory: %w", err)
+	}
+	defer removeScratch(workDir)
+
+	inputPath := filepath.Join(workDir, "input"+ext)
+	outputPath := filepath.Join(workDir, "output"+ext)
+	converts := t.OutputExt != "" && normalizeExt(t.OutputExt) != ext
+	if converts {
+		outputPath = filepath.Join(workDir, "input"+normalizeExt(t.OutputExt))
+	}
+
+	in, err := os.OpenFile(inputPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) // #nosec G304 -- path inside private temp dir
+	if err != nil {
+		return fmt.Errorf("failed to create scratch input: %w", err)
+	}
+	if _, err := io.Copy(in, src); err != nil {
+		_ = in.Close()
+		return fmt.Errorf("failed to write scratch input: %w", err)
+	}
+	if err := in.Close(); err != nil {
+		return fmt.Errorf("failed to write scratch input: %w", err)
+	}
+
+	usesOutput := converts
+	args := make([]string, len(t.Command))
+	for i, arg := range t.Command {
+		if strings.Contains(arg, outputPlaceholder) {
+			usesOutput = true
+		}
+		arg = strings.ReplaceAll(arg, inputPlaceholder, inputPath)
+		args[i] = strings.ReplaceAll(arg, outputPlaceholder, outputPath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...) // #nosec G204 -- command from operator config
+	cmd.Dir = workDir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	cmd.WaitDelay = time.Second
+	if t.Sandbox {
+		if err := sandbox(cmd); err != nil {
+			return err
+		}
+	}
+
+	stdout := &cappedBuffer{max: maxOutput}
+	if !usesOutput && !t.InPlace {
+		cmd.Stdout = stdout
+	}
+
+	if err := cmd.Start(); err != nil {
+		if t.Sandbox && sandboxRefused(err) {
+			return fmt.Errorf("%w: %v", ErrSandboxUnavailable, err)
+		}
+		return fmt.Errorf("external scrubber failed: %w", err)
+	}
+	if t.Sandbox {
+		if err := limit(cmd.Process.Pid, timeout, maxOutput); err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return fmt.Errorf("%w: failed to set resource limits: %v", ErrSandboxUnavailable, err)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("external scrubber timed out after %v", timeout)
+		}
+		if stdout.exceeded {
+			return ErrToolOutputTooLarge
+		}
+		return fmt.Errorf("external scrubber failed: %w", err)
+	}
+
+	if !usesOutput && !t.InPlace {
+		if stdout.exceeded {
+			return ErrToolOutputTooLarge
+		}
+		_, err := dst.Write(stdout.Bytes())
+		return err
+	}
+
+	resultPath := outputPath
+	if !usesOutput {
+		resultPath = inputPath
+	}
+	out, err := os.Open(resultPath) // #nosec G304 -- path inside private temp dir
+	if err != nil {
+		return fmt.Errorf("external scrubber produced no output: %w", err)
+	}
+	defer out.Close()
+
+	info, err := out.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat scrubber output: %w", err)
+	}
+	if info.Size() > maxOutput {
+		return ErrToolOutputTooLarge
+	}
+
+	_, err = io.Copy(dst, io.LimitReader(out, maxOutput))
+	return err
+}
+
+// removeScratch overwrites the regular files in a scratch directory, which
+// hold plaintext of the upload, and removes the directory. Links are removed
+// without being followed, so that a tool cannot aim the overwrite at a file
+// outside it.
+func removeScratch(dir string) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			_ = storage.SecureDelete(path)
+		}
+		return nil
+	})
+	_ = os.RemoveAll(dir)
+}
+
+// cappedBuffer collects up to max bytes and fails writes beyond that, which
+// makes the child process see a broken pipe instead of growing memory. The
+// buffer is a named field rather than embedded so that io.Copy cannot bypass
+// Write through bytes.Buffer.ReadFrom.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	max      int64
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len())+int64(len(p)) > b.max {
+		b.exceeded = true
+		return 0, ErrToolOutputTooLarge
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
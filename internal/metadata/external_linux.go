@@ -0,0 +1,55 @@
+package metadata
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandbox makes cmd start in new user, network and PID namespaces: the tool
+// has only a loopback interface, and every process it starts is killed
+// when it exits. It keeps the server's user and group, mapped to
+// themselves, so it can still read and write the scratch files.
+func sandbox(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return nil
+}
+
+// sandboxRefused reports whether a start error is the kernel refusing the
+// namespaces, where they are disabled or limited to privileged users.
+func sandboxRefused(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EINVAL)
+}
+
+// limit sets the resource limits of the sandboxed process pid, which its
+// children inherit: no core dumps, which would hold plaintext, CPU time no
+// longer than the timeout, sandboxMaxMemory of address space, and no file
+// written past maxOutput bytes. They are set just after the process starts,
+// as the limits of a child cannot be given to exec.
+func limit(pid int, timeout time.Duration, maxOutput int64) error {
+	cpu := uint64(timeout/time.Second) + 1 // #nosec G115 -- timeout is positive
+	for _, l := range []struct {
+		resource int
+		max      uint64
+	}{
+		{unix.RLIMIT_CORE, 0},
+		{unix.RLIMIT_CPU, cpu},
+		{unix.RLIMIT_AS, sandboxMaxMemory},
+		{unix.RLIMIT_FSIZE, uint64(maxOutput)}, // #nosec G115 -- maxOutput is positive
+	} {
+		rlim := unix.Rlimit{Cur: l.max, Max: l.max}
+		if err := unix.Prlimit(pid, l.resource, &rlim, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
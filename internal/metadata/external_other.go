@@ -0,0 +1,23 @@
+//go:build !linux
+
+package metadata
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// sandbox fails: the default sandbox relies on Linux namespaces.
+func sandbox(_ *exec.Cmd) error {
+	return fmt.Errorf("%w: not supported on %s", ErrSandboxUnavailable, runtime.GOOS)
+}
+
+func sandboxRefused(error) bool {
+	return false
+}
+
+func limit(int, time.Duration, int64) error {
+	return nil
+}
@@ -0,0 +1,219 @@
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+}
+
+func TestExternalTool_OutputFile(t *testing.T) {
+	requireShell(t)
+	tool := &ExternalTool{
+		Command: []string{"sh", "-c", `tr a-z A-Z < "$0" > "$1"`, "{input}", "{output}"},
+		TempDir: t.TempDir(),
+	}
+
+	var out bytes.Buffer
+	if err := tool.Transform(".txt")(strings.NewReader("secret author"), &out); err != nil {
+		t.Fatalf("Transform error: %v", err)
+	}
+	if out.String() != "SECRET AUTHOR" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestExternalTool_Stdout(t *testing.T) {
+	requireShell(t)
+	tool := &ExternalTool{Command: []string{"cat", "{input}"}, TempDir: t.TempDir()}
+
+	var out bytes.Buffer
+	if err := tool.Transform("pdf")(strings.NewReader("%PDF-1.4"), &out); err != nil {
+		t.Fatalf("Transform error: %v", err)
+	}
+	if out.String() != "%PDF-1.4" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestExternalTool_InPlace(t *testing.T) {
+	requireShell(t)
+	tool := &ExternalTool{
+		Command: []string{"sh", "-c", `printf cleaned > "$0"`, "{input}"},
+		InPlace: true,
+		TempDir: t.TempDir(),
+	}
+
+	var out bytes.Buffer
+	if err := tool.Transform(".docx")(strings.NewReader("original"), &out); err != nil {
+		t.Fatalf("Transform error: %v", err)
+	}
+	if out.String() != "cleaned" {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestExternalTool_Timeout(t *testing.T) {
+	requireShell(t)
+	tool := &ExternalTool{
+		Command: []string{"sleep", "5"},
+		Timeout: 100 * time.Millisecond,
+		TempDir: t.TempDir(),
+	}
+
+	start := time.Now()
+	err := tool.Transform(".txt")(strings.NewReader("x"), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Error("timeout should kill the tool promptly")
+	}
+}
+
+func TestExternalTool_OutputCap(t *testing.T) {
+	requireShell(t)
+	tool := &ExternalTool{
+		Command:        []string{"cat", "{input}"},
+		MaxOutputBytes: 10,
+		TempDir:        t.TempDir(),
+	}
+
+	err := tool.Transform(".txt")(strings.NewReader(strings.Repeat("a", 100)), &bytes.Buffer{})
+	if !errors.Is(err, ErrToolOutputTooLarge) {
+		t.Fatalf("expected ErrToolOutputTooLarge, got %v", err)
+	}
+}
+
+func TestExternalTool_Failure(t *testing.T) {
+	requireShell(t)
+	tool := &ExternalTool{Command: []string{"false"}, TempDir: t.TempDir()}
+
+	if err := tool.Transform(".txt")(strings.NewReader("x"), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected error from failing tool")
+	}
+}
+
+func TestExternalTool_CleansScratchDir(t *testing.T) {
+	requireShell(t)
+	tmp := t.TempDir()
+	tool := &ExternalTool{Command: []string{"cat", "{input}"}, TempDir: tmp}
+
+	if err := tool.Transform(".txt")(strings.NewReader("plaintext"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(tmp)
+	if len(entries) != 0 {
+		t.Errorf("scratch directory should be removed, found %d entries", len(entries))
+	}
+}
+
+func TestExternalTool_ScratchLinksNotFollowed(t *testing.T) {
+	requireShell(t)
+	victim := filepath.Join(t.TempDir(), "victim")
+	if err := os.WriteFile(victim, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tool := &ExternalTool{
+		Command: []string{"sh", "-c", `cat "$0"; ln -s "$1" link`, "{input}", victim},
+		TempDir: t.TempDir(),
+	}
+
+	if err := tool.Transform(".txt")(strings.NewReader("plaintext"), &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(victim); err != nil || string(data) != "keep me" {
+		t.Errorf("file linked from the scratch directory = %q, %v; want it untouched", data, err)
+	}
+}
+
+func TestExternalTool_Sandbox(t *testing.T) {
+	requireShell(t)
+	if runtime.GOOS != "linux" {
+		t.Skip("the sandbox is Linux only")
+	}
+	tool := &ExternalTool{
+		Command: []string{"sh", "-c", "cat /proc/net/dev; ulimit -c"},
+		TempDir: t.TempDir(),
+		Sandbox: true,
+	}
+
+	var out bytes.Buffer
+	err := tool.Transform(".txt")(strings.NewReader(""), &out)
+	if errors.Is(err, ErrSandboxUnavailable) {
+		t.Skipf("user namespaces unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var interfaces []string
+	for _, line := range lines {
+		if name, _, ok := strings.Cut(line, ":"); ok && !strings.Contains(line, "|") {
+			interfaces = append(interfaces, strings.TrimSpace(name))
+		}
+	}
+	if len(interfaces) != 1 || interfaces[0] != "lo" {
+		t.Errorf("network interfaces = %v, want only lo", interfaces)
+	}
+	if core := lines[len(lines)-1]; core != "0" {
+		t.Errorf("core dump limit = %q, want 0", core)
+	}
+}
+
+func TestScrubber_RegisterExtension(t *testing.T) {
+	s := NewScrubber()
+	s.Register("TXT", func(src io.Reader, dst io.Writer) error {
+		_, err := io.WriteString(dst, "scrubbed")
+		return err
+	})
+
+	var out bytes.Buffer
+	if err := s.ScrubFile("Notes.txt", strings.NewReader("raw"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "scrubbed" {
+		t.Errorf("output = %q, want registered scrubber output", out.String())
+	}
+
+	found := false
+	for _, ext := range s.Extensions() {
+		if ext == ".txt" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Extensions should include .txt")
+	}
+}
+
+func TestExternalTool_OutputExt(t *testing.T) {
+	requireShell(t)
+	// Names its result after its input, like soffice --convert-to
+	tool := &ExternalTool{
+		Command:   []string{"sh", "-c", `tr a-z A-Z < "$0" > input.pdf`, "{input}"},
+		OutputExt: ".pdf",
+		TempDir:   t.TempDir(),
+	}
+
+	var out bytes.Buffer
+	if err := tool.Transform(".docm")(strings.NewReader("macro"), &out); err != nil {
+		t.Fatalf("Transform error: %v", err)
+	}
+	if out.String() != "MACRO" {
+		t.Errorf("output = %q", out.String())
+	}
+}
@@ -0,0 +1,157 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+var (
+	// jfifID opens the APP0 segment that declares the JFIF format.
+	jfifID = []byte("JFIF\x00")
+	// iccID opens each APP2 segment carrying part of an ICC color profile.
+	iccID = []byte("ICC_PROFILE\x00")
+	// adobeID opens the APP14 segment whose color transform flag decoders
+	// need for CMYK and YCCK images.
+	adobeID = []byte("Adobe")
+)
+
+// jfifHeaderLen is the JFIF APP0 payload without a thumbnail: identifier(5),
+// version(2), units(1), density(4), thumbnail size(2).
+const jfifHeaderLen = 14
+
+// scrubJPEG streams a JPEG from src to dst, dropping identifying APP0-APP15
+// segments (EXIF, XMP, IPTC, maker notes, JFXX thumbnails and anything
+// unrecognized). The JFIF header, with its thumbnail removed, ICC profiles
+// and the Adobe color transform segment are kept, since decoders rely on
+// them; with opts.StrictJPEG every APPn segment is dropped.
+//
+// JPEG structure: FFD8 (SOI) + segments + FFDA (SOS) + entropy-coded data.
+// Everything from SOS onward is copied verbatim, so only the header segments
+// are parsed and no segment is ever held in memory.
+func scrubJPEG(src io.Reader, dst io.Writer, opts Options) error {
+	br := bufio.NewReader(src)
+
+	soi, _ := br.Peek(2)
+	if len(soi) < 2 || soi[0] != 0xFF || soi[1] != 0xD8 {
+		// Not a valid JPEG, pass through as-is
+		_, err := io.Copy(dst, br)
+		return err
+	}
+	if _, err := io.CopyN(dst, br, 2); err != nil {
+		return err
+	}
+
+	for {
+		hdr, _ := br.Peek(2)
+		if len(hdr) < 2 {
+			// End of input (a lone trailing byte is dropped)
+			return nil
+		}
+
+		// Not a marker: copy the rest verbatim
+		if hdr[0] != 0xFF {
+			_, err := io.Copy(dst, br)
+			return err
+		}
+
+		marker := hdr[1]
+
+		// Compressed data follows SOS: copy the rest verbatim
+		if marker == 0xDA {
+			_, err := io.Copy(dst, br)
+			return err
+		}
+
+		seg, _ := br.Peek(4)
+		if len(seg) < 4 {
+			// Truncated segment header: drop the remainder
+			return nil
+		}
+		segmentLen := int64(seg[2])<<8 | int64(seg[3])
+
+		// Skip APP0-APP15 markers (FFE0-FFEF) which contain metadata
+		if marker >= 0xE0 && marker <= 0xEF {
+			if segmentLen < 2 {
+				return nil
+			}
+			if !opts.StrictJPEG {
+				kept, err := keepAPPSegment(br, dst, marker, segmentLen)
+				if err != nil {
+					return err
+				}
+				if kept {
+					continue
+				}
+			}
+			// Skip marker + length + payload; a short read means the segment
+			// was truncated, and its remainder is dropped with it
+			if _, err := br.Discard(int(2 + segmentLen)); err != nil {
+				return nil
+			}
+			continue
+		}
+
+		if segmentLen < 2 {
+			// Malformed length: copy the rest verbatim
+			_, err := io.Copy(dst, br)
+			return err
+		}
+
+		// Copy other segments; a truncated segment is copied as far as it goes
+		if _, err := io.CopyN(dst, br, 2+segmentLen); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// keepAPPSegment copies the APPn segment at the head of br to dst if it is
+// one decoders rely on, reporting whether it did. A JFIF segment is
+// rewritten without its thumbnail, which may show the image before editing.
+func keepAPPSegment(br *bufio.Reader, dst io.Writer, marker byte, segmentLen int64) (bool, error) {
+	payload := segmentLen - 2
+	switch {
+	case marker == 0xE0 && hasSegmentID(br, payload, jfifID) && payload >= jfifHeaderLen:
+		seg, err := br.Peek(4 + jfifHeaderLen)
+		if err != nil {
+			return false, nil
+		}
+		header := append([]byte{}, seg...)
+		header[2], header[3] = 0, 2+jfifHeaderLen
+		header[len(header)-2], header[len(header)-1] = 0, 0 // no thumbnail
+		if _, err := dst.Write(header); err != nil {
+			return false, err
+		}
+		// A truncated thumbnail ends the input, as for a stripped segment
+		_, _ = br.Discard(int(2 + segmentLen))
+		return true, nil
+
+	case marker == 0xE2 && hasSegmentID(br, payload, iccID),
+		marker == 0xEE && hasSegmentID(br, payload, adobeID):
+		if _, err := io.CopyN(dst, br, 2+segmentLen); err != nil && err != io.EOF {
+			return false, err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// hasSegmentID reports whether the payload of the segment at the head of br
+// starts with id.
+func hasSegmentID(br *bufio.Reader, payload int64, id []byte) bool {
+	if payload < int64(len(id)) {
+		return false
+	}
+	seg, _ := br.Peek(4 + len(id))
+	return len(seg) == 4+len(id) && bytes.Equal(seg[4:], id)
+}
+
+// jpegTransform returns scrubJPEG configured by opts as a Transform.
+func jpegTransform(opts Options) Transform {
+	return func(src io.Reader, dst io.Writer) error {
+		return scrubJPEG(src, dst, opts)
+	}
+}
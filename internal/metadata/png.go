@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// pngSignature is the 8-byte header every PNG file starts with.
+var pngSignature = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
+
+// pngMaxChunkLen is the largest chunk length the PNG specification allows.
+const pngMaxChunkLen = 1<<31 - 1
+
+// pngStripChunks are the ancillary chunk types removed by the scrubber.
+var pngStripChunks = map[string]bool{
+	"tEXt": true, // Textual data
+	"zTXt": true, // Compressed text
+	"iTXt": true, // International text
+	"tIME": true, // Last modification time
+	"pHYs": true, // Physical pixel dimensions
+	"sPLT": true, // Suggested palette
+	"eXIf": true, // EXIF data
+}
+
+// scrubPNG streams a PNG from src to dst, dropping metadata chunks.
+//
+// PNG structure: signature + chunks, where each chunk is
+// length(4) + type(4) + data(length) + crc(4). Chunks are copied or skipped
+// one at a time without buffering their payload, and every chunk's CRC is
+// checked on the way through. Kept chunks are copied byte for byte, so their
+// CRCs remain valid in the output and never need recomputing.
+//
+// A file with the PNG signature but a bad CRC, an out-of-range length, or no
+// IEND chunk is structurally invalid: with opts.RejectInvalid the scrub fails
+// with ErrInvalidFile, otherwise the rest of the file from that point is
+// passed through unchanged.
+func scrubPNG(src io.Reader, dst io.Writer, opts Options) error {
+	br := bufio.NewReader(src)
+
+	sig, _ := br.Peek(len(pngSignature))
+	if !bytes.Equal(sig, pngSignature) {
+		// Not a valid PNG, pass through as-is
+		_, err := io.Copy(dst, br)
+		return err
+	}
+	if _, err := io.CopyN(dst, br, int64(len(pngSignature))); err != nil {
+		return err
+	}
+
+	invalid := func(reason string) error {
+		if opts.RejectInvalid {
+			return fmt.Errorf("%w: PNG %s", ErrInvalidFile, reason)
+		}
+		_, err := io.Copy(dst, br)
+		return err
+	}
+
+	for {
+		hdr, _ := br.Peek(8)
+		if len(hdr) < 8 {
+			return invalid("ends without IEND")
+		}
+
+		chunkLen := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		chunkType := string(hdr[4:8])
+		if chunkLen > pngMaxChunkLen {
+			return invalid("chunk length out of range")
+		}
+
+		// Stripped chunks are read through to check their CRC, unbuffered
+		out := dst
+		if pngStripChunks[chunkType] {
+			out = io.Discard
+		}
+
+		// The CRC covers the type and data but not the length
+		if _, err := io.CopyN(out, br, 4); err != nil {
+			return err
+		}
+		crc := crc32.NewIEEE()
+		if _, err := io.CopyN(io.MultiWriter(out, crc), br, 4+chunkLen); err != nil {
+			if err == io.EOF {
+				return invalid("chunk truncated")
+			}
+			return err
+		}
+		var sum [4]byte
+		n, err := io.ReadFull(br, sum[:])
+		if _, werr := out.Write(sum[:n]); werr != nil {
+			return werr
+		}
+		if err != nil {
+			return invalid("chunk truncated")
+		}
+		if binary.BigEndian.Uint32(sum[:]) != crc.Sum32() {
+			return invalid("chunk CRC mismatch")
+		}
+
+		// IEND is the last chunk
+		if chunkType == "IEND" {
+			return nil
+		}
+	}
+}
+
+// pngTransform returns scrubPNG configured by opts as a Transform.
+func pngTransform(opts Options) Transform {
+	return func(src io.Reader, dst io.Writer) error {
+		return scrubPNG(src, dst, opts)
+	}
+}
@@ -2,174 +2,142 @@ package metadata
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
+// ErrInvalidFile is returned by the built-in scrubbers, when
+// Options.RejectInvalid is set, for a file that starts like a supported
+// format but is structurally invalid.
+var ErrInvalidFile = errors.New("structurally invalid file")
+
+// Options configures the built-in scrubbers.
+type Options struct {
+	// RejectInvalid fails the scrub of a structurally invalid file with
+	// ErrInvalidFile. When unset, the rest of such a file from the first
+	// invalid structure is passed through unscrubbed.
+	RejectInvalid bool
+
+	// StrictJPEG strips every APPn segment from JPEGs, including the JFIF
+	// header, ICC color profiles and the Adobe color transform segment
+	// that are otherwise kept.
+	StrictJPEG bool
+}
+
 // Scrubber handles metadata removal from files
-type Scrubber struct{}
+type Scrubber struct {
+	mu         sync.RWMutex
+	transforms map[string]Transform // keyed by lowercase extension, e.g. ".jpg"
+}
 
-// NewScrubber creates a new metadata scrubber
+// NewScrubber creates a new metadata scrubber with the built-in JPEG and PNG
+// scrubbers registered.
 func NewScrubber() *Scrubber {
-	return &Scrubber{}
+	return NewScrubberWithOptions(Options{})
 }
 
-// ScrubFile removes metadata from common file types
-func (s *Scrubber) ScrubFile(filename string, reader io.Reader, writer io.Writer) error {
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
+// NewScrubberWithOptions is NewScrubber with the built-in scrubbers
+// configured by opts.
+func NewScrubberWithOptions(opts Options) *Scrubber {
+	s := &Scrubber{transforms: make(map[string]Transform)}
+	s.Register(".jpg", jpegTransform(opts))
+	s.Register(".jpeg", jpegTransform(opts))
+	s.Register(".png", pngTransform(opts))
+	return s
+}
 
-	// Detect file type and apply appropriate scrubbing
-	cleaned := data
-	lower := strings.ToLower(filename)
+// Register installs transform as the scrubber for files with the given
+// extension, replacing any existing scrubber for it. Extensions are matched
+// case-insensitively and may be given with or without the leading dot.
+func (s *Scrubber) Register(ext string, transform Transform) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transforms[normalizeExt(ext)] = transform
+}
 
-	if strings.HasSuffix(lower, ".jpg") || strings.HasSuffix(lower, ".jpeg") {
-		cleaned = recoverScrub(data, s.stripJPEGExif)
-	} else if strings.HasSuffix(lower, ".png") {
-		cleaned = recoverScrub(data, s.stripPNGMetadata)
-	}
-	// Add more file types as needed
+// Extensions returns the extensions that currently have a registered scrubber.
+func (s *Scrubber) Extensions() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	if _, err := writer.Write(cleaned); err != nil {
-		return fmt.Errorf("failed to write cleaned file: %w", err)
+	exts := make([]string, 0, len(s.transforms))
+	for ext := range s.transforms {
+		exts = append(exts, ext)
 	}
-
-	return nil
+	return exts
 }
 
-// recoverScrub calls fn and recovers from any panic, returning the original data on failure.
-func recoverScrub(data []byte, fn func([]byte) []byte) (result []byte) {
-	defer func() {
-		if r := recover(); r != nil {
-			result = data
-		}
-	}()
-	return fn(data)
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
 }
 
-// stripJPEGExif removes EXIF data from JPEG files
-func (s *Scrubber) stripJPEGExif(data []byte) []byte {
-	// JPEG structure: FFD8 (SOI) + segments + FFD9 (EOI)
-	// APP1 segment (FFE1) typically contains EXIF data
-
-	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
-		// Not a valid JPEG, return as-is
-		return data
-	}
+// ScrubFile removes metadata from common file types
+func (s *Scrubber) ScrubFile(filename string, reader io.Reader, writer io.Writer) error {
+	scrubbed := s.ScrubReader(filename, reader)
+	defer scrubbed.Close()
 
-	result := bytes.NewBuffer(nil)
-	result.Write(data[0:2]) // Write SOI marker (FFD8)
-
-	i := 2
-	for i < len(data)-1 {
-		// Check for marker
-		if data[i] != 0xFF {
-			// Not a marker, skip to end
-			result.Write(data[i:])
-			break
-		}
-
-		marker := data[i+1]
-
-		// If we hit compressed data (SOS marker), copy rest and break
-		if marker == 0xDA {
-			result.Write(data[i:])
-			break
-		}
-
-		// Skip APP0-APP15 markers (FFE0-FFEF) which contain metadata
-		if marker >= 0xE0 && marker <= 0xEF {
-			// Read segment length
-			if i+3 >= len(data) {
-				break
-			}
-			segmentLen := int(data[i+2])<<8 | int(data[i+3])
-			if segmentLen < 2 || i+2+segmentLen > len(data) {
-				break
-			}
-			// Skip this segment (marker + length + data)
-			i += 2 + segmentLen
-			continue
-		}
-
-		// Copy other segments
-		if i+3 >= len(data) {
-			break
-		}
-		segmentLen := int(data[i+2])<<8 | int(data[i+3])
-		if i+2+segmentLen > len(data) {
-			// Malformed, copy rest
-			result.Write(data[i:])
-			break
-		}
-		result.Write(data[i : i+2+segmentLen])
-		i += 2 + segmentLen
+	if _, err := io.Copy(writer, scrubbed); err != nil {
+		return fmt.Errorf("failed to scrub file: %w", err)
 	}
 
-	return result.Bytes()
+	return nil
 }
 
-// stripPNGMetadata removes metadata chunks from PNG files
-func (s *Scrubber) stripPNGMetadata(data []byte) []byte {
-	// PNG structure: signature + chunks
-	// Chunks to remove: tEXt, zTXt, iTXt, tIME, pHYs, etc.
+// ScrubReader returns a reader that yields the scrubbed content of reader.
+// Formats with a streaming parser are rewritten incrementally, so memory use
+// is bounded by the largest retained segment rather than the file size.
+// Files of unknown type pass through unchanged. The caller must read the
+// result to EOF or Close it to release the background parser.
+func (s *Scrubber) ScrubReader(filename string, reader io.Reader) io.ReadCloser {
+	return s.ScrubReaderContext(context.Background(), filename, reader)
+}
 
-	pngSignature := []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A}
-	if len(data) < 8 || !bytes.Equal(data[0:8], pngSignature) {
-		// Not a valid PNG, return as-is
-		return data
+// ScrubReaderContext is ScrubReader bounded by ctx: when ctx is done, the
+// parser is abandoned and reads fail with ctx's error instead of letting a
+// crafted file hold a core.
+func (s *Scrubber) ScrubReaderContext(ctx context.Context, filename string, reader io.Reader) io.ReadCloser {
+	transform := s.transformFor(filename)
+	if transform == nil {
+		return io.NopCloser(reader)
 	}
+	return StreamContext(ctx, transform, reader)
+}
 
-	result := bytes.NewBuffer(nil)
-	result.Write(pngSignature)
-
-	// Metadata chunk types to strip
-	stripChunks := map[string]bool{
-		"tEXt": true, // Textual data
-		"zTXt": true, // Compressed text
-		"iTXt": true, // International text
-		"tIME": true, // Last modification time
-		"pHYs": true, // Physical pixel dimensions
-		"sPLT": true, // Suggested palette
-		"eXIf": true, // EXIF data
-	}
+// Handles reports whether filename has a registered scrubber.
+func (s *Scrubber) Handles(filename string) bool {
+	return s.transformFor(filename) != nil
+}
 
-	i := 8
-	for i < len(data) {
-		if i+8 > len(data) {
-			break
-		}
-
-		// Read chunk length
-		chunkLen := int(data[i])<<24 | int(data[i+1])<<16 | int(data[i+2])<<8 | int(data[i+3])
-		chunkType := string(data[i+4 : i+8])
-
-		// Guard against negative length (high bit set) and overflow
-		if chunkLen < 0 || chunkLen > len(data)-12 {
-			break
-		}
-		totalChunkSize := 12 + chunkLen // length(4) + type(4) + data(n) + crc(4)
-		if i+totalChunkSize > len(data) {
-			break
-		}
-
-		// Keep essential chunks, strip metadata
-		if !stripChunks[chunkType] {
-			result.Write(data[i : i+totalChunkSize])
-		}
-
-		i += totalChunkSize
-
-		// IEND is the last chunk
-		if chunkType == "IEND" {
-			break
-		}
+// transformFor selects the scrubbing transform for a filename, or nil if the
+// file type has no scrubber.
+func (s *Scrubber) transformFor(filename string) Transform {
+	ext := filepath.Ext(filename)
+	if ext == "" {
+		return nil
 	}
 
-	return result.Bytes()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transforms[strings.ToLower(ext)]
+}
+
+// stripJPEGExif removes EXIF data from JPEG files
+func (s *Scrubber) stripJPEGExif(data []byte) []byte {
+	return applyTransform(jpegTransform(Options{}), data)
+}
+
+// stripPNGMetadata removes metadata chunks from PNG files
+func (s *Scrubber) stripPNGMetadata(data []byte) []byte {
+	return applyTransform(pngTransform(Options{}), data)
 }
 
 // IsMetadataPresent checks if common metadata markers exist
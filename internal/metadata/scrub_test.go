@@ -2,6 +2,11 @@ package metadata
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
 	"testing"
 )
 
@@ -48,6 +53,55 @@ func TestScrubFile_JPEG_Extension(t *testing.T) {
 	}
 }
 
+// jpegSegment builds a JPEG marker segment with the given payload.
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(2+len(payload))) // #nosec G115 -- test payloads are small
+	return append(seg, payload...)
+}
+
+func TestScrubFile_JPEG_KeepsColorSegments(t *testing.T) {
+	// JFIF header with a 1x1 RGB thumbnail
+	jfif := append([]byte("JFIF\x00\x01\x02\x00\x00\x48\x00\x48\x01\x01"), 0xAA, 0xBB, 0xCC)
+	icc := append([]byte("ICC_PROFILE\x00\x01\x01"), "profile"...)
+	adobe := []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")
+	xmp := []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>Author</x:xmpmeta>")
+	iptc := []byte("Photoshop 3.0\x008BIM byline")
+	sos := []byte{0xFF, 0xDA, 0x00, 0x02, 0x12, 0x34, 0xFF, 0xD9}
+
+	jpeg := []byte{0xFF, 0xD8}
+	jpeg = append(jpeg, jpegSegment(0xE0, jfif)...)
+	jpeg = append(jpeg, jpegSegment(0xE1, []byte("Exif\x00\x00GPS"))...)
+	jpeg = append(jpeg, jpegSegment(0xE1, xmp)...)
+	jpeg = append(jpeg, jpegSegment(0xE2, icc)...)
+	jpeg = append(jpeg, jpegSegment(0xED, iptc)...)
+	jpeg = append(jpeg, jpegSegment(0xEE, adobe)...)
+	jpeg = append(jpeg, sos...)
+
+	var out bytes.Buffer
+	if err := NewScrubber().ScrubFile("photo.jpg", bytes.NewReader(jpeg), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0xFF, 0xD8}
+	want = append(want, jpegSegment(0xE0, append(jfif[:12:12], 0, 0))...) // thumbnail removed
+	want = append(want, jpegSegment(0xE2, icc)...)
+	want = append(want, jpegSegment(0xEE, adobe)...)
+	want = append(want, sos...)
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got  %x\nwant %x", out.Bytes(), want)
+	}
+
+	// Strict mode removes every APPn segment
+	out.Reset()
+	strict := NewScrubberWithOptions(Options{StrictJPEG: true})
+	if err := strict.ScrubFile("photo.jpg", bytes.NewReader(jpeg), &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{0xFF, 0xD8}, sos...); !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("strict: got %x, want %x", out.Bytes(), want)
+	}
+}
+
 func TestScrubFile_PNG_MinimalValid(t *testing.T) {
 	s := NewScrubber()
 
@@ -374,8 +428,190 @@ func buildPNGChunk(chunkType string, data []byte) []byte {
 	chunk = append(chunk, []byte(chunkType)...)
 	// Data
 	chunk = append(chunk, data...)
-	// CRC (fake - not validated in scrubber)
-	chunk = append(chunk, 0x00, 0x00, 0x00, 0x00)
+	// CRC over type and data
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
 
 	return chunk
 }
+
+func TestScrubReader_MatchesScrubFile(t *testing.T) {
+	s := NewScrubber()
+	jpeg := []byte{
+		0xFF, 0xD8,
+		0xFF, 0xE1, 0x00, 0x08, 'E', 'x', 'i', 'f', 0x00, 0x00,
+		0xFF, 0xDB, 0x00, 0x04, 0x00, 0x00,
+		0xFF, 0xDA, 0x00, 0x02, 0x11, 0x22,
+		0xFF, 0xD9,
+	}
+
+	var want bytes.Buffer
+	if err := s.ScrubFile("photo.jpg", bytes.NewReader(jpeg), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	r := s.ScrubReader("photo.jpg", bytes.NewReader(jpeg))
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll error: %v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("streamed output %x differs from ScrubFile output %x", got, want.Bytes())
+	}
+}
+
+func TestScrubReader_UnknownTypePassthrough(t *testing.T) {
+	s := NewScrubber()
+	data := []byte("plain text")
+
+	r := s.ScrubReader("notes.txt", bytes.NewReader(data))
+	got, _ := io.ReadAll(r)
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q, want %q", got, data)
+	}
+}
+
+func TestScrubReader_LargePNGChunkStreams(t *testing.T) {
+	s := NewScrubber()
+
+	// A large metadata chunk followed by IDAT: neither should be buffered whole
+	big := bytes.Repeat([]byte{'x'}, 1<<20)
+	png := append([]byte{}, pngSignature...)
+	png = append(png, buildPNGChunk("IHDR", make([]byte, 13))...)
+	png = append(png, buildPNGChunk("zTXt", big)...)
+	png = append(png, buildPNGChunk("IDAT", big)...)
+	png = append(png, buildPNGChunk("IEND", nil)...)
+
+	r := s.ScrubReader("big.png", bytes.NewReader(png))
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(got, []byte("zTXt")) {
+		t.Error("zTXt chunk should be stripped")
+	}
+	if wantLen := len(png) - (12 + len(big)); len(got) != wantLen {
+		t.Errorf("output length = %d, want %d", len(got), wantLen)
+	}
+}
+
+func TestScrubReader_CloseBeforeEOF(t *testing.T) {
+	s := NewScrubber()
+	png := append([]byte{}, pngSignature...)
+	png = append(png, buildPNGChunk("IDAT", bytes.Repeat([]byte{'x'}, 1<<20))...)
+
+	r := s.ScrubReader("image.png", bytes.NewReader(png))
+	buf := make([]byte, 16)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	// Closing early must unblock the background parser
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScrubReader_PNGOversizedChunkLength(t *testing.T) {
+	// A chunk declaring 4 GB must not be trusted
+	bogus := make([]byte, 12)
+	binary.BigEndian.PutUint32(bogus[0:4], 0xFFFFFFF0)
+	copy(bogus[4:8], "tEXt")
+	png := append([]byte{}, pngSignature...)
+	png = append(png, buildPNGChunk("IHDR", make([]byte, 13))...)
+	png = append(png, bogus...)
+	png = append(png, "GPS secret"...)
+
+	got, err := io.ReadAll(NewScrubber().ScrubReader("bogus.png", bytes.NewReader(png)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, png) {
+		t.Errorf("got %d bytes, want the %d bytes passed through", len(got), len(png))
+	}
+
+	strict := NewScrubberWithOptions(Options{RejectInvalid: true})
+	if _, err := io.ReadAll(strict.ScrubReader("bogus.png", bytes.NewReader(png))); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("RejectInvalid: err = %v, want ErrInvalidFile", err)
+	}
+}
+
+func TestScrubReader_PNGBadCRC(t *testing.T) {
+	ihdr := buildPNGChunk("IHDR", make([]byte, 13))
+	text := buildPNGChunk("tEXt", []byte("Author\x00Someone"))
+	text[len(text)-1] ^= 0xFF
+	idat := buildPNGChunk("IDAT", []byte{0x00})
+	png := append([]byte{}, pngSignature...)
+	png = append(png, ihdr...)
+	png = append(png, text...)
+	png = append(png, idat...)
+	png = append(png, buildPNGChunk("IEND", nil)...)
+
+	// Pass-through: the corrupt chunk is dropped and the rest copied as is
+	got, err := io.ReadAll(NewScrubber().ScrubReader("image.png", bytes.NewReader(png)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte{}, pngSignature...), ihdr...)
+	want = append(want, png[len(want)+len(text):]...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+
+	strict := NewScrubberWithOptions(Options{RejectInvalid: true})
+	if _, err := io.ReadAll(strict.ScrubReader("image.png", bytes.NewReader(png))); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("RejectInvalid: err = %v, want ErrInvalidFile", err)
+	}
+}
+
+func TestScrubReader_PNGMissingIEND(t *testing.T) {
+	png := append([]byte{}, pngSignature...)
+	png = append(png, buildPNGChunk("IHDR", make([]byte, 13))...)
+	png = append(png, buildPNGChunk("IDAT", []byte{0x00})...)
+
+	got, err := io.ReadAll(NewScrubber().ScrubReader("image.png", bytes.NewReader(png)))
+	if err != nil || !bytes.Equal(got, png) {
+		t.Errorf("pass-through: got %d bytes, err %v; want %d bytes", len(got), err, len(png))
+	}
+
+	strict := NewScrubberWithOptions(Options{RejectInvalid: true})
+	if _, err := io.ReadAll(strict.ScrubReader("image.png", bytes.NewReader(png))); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("RejectInvalid: err = %v, want ErrInvalidFile", err)
+	}
+}
+
+func TestScrubReaderContext_Deadline(t *testing.T) {
+	s := NewScrubber()
+	png := append([]byte{}, pngSignature...)
+	png = append(png, buildPNGChunk("IDAT", bytes.Repeat([]byte{'x'}, 1<<20))...)
+
+	// The source stalls halfway, as a parser stuck on a crafted file would
+	src, stall := io.Pipe()
+	defer stall.Close()
+	go func() { _, _ = stall.Write(png[:len(png)/2]) }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := s.ScrubReaderContext(ctx, "image.png", src)
+	defer r.Close()
+	buf := make([]byte, 16)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if _, err := io.ReadAll(r); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestBuffered_RecoversPanic(t *testing.T) {
+	data := []byte("original")
+	transform := Buffered(func([]byte) []byte { panic("boom") })
+
+	var out bytes.Buffer
+	if err := transform(bytes.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("got %q, want original data", out.Bytes())
+	}
+}
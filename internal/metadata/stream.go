@@ -0,0 +1,80 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Transform rewrites a file from src to dst. Transforms should pass
+// structurally invalid input through rather than fail, and only return
+// errors from the underlying reader or writer, unless configured to reject
+// invalid input with ErrInvalidFile.
+type Transform func(src io.Reader, dst io.Writer) error
+
+// Stream runs transform in the background and returns a reader over its
+// output. Closing the returned reader before EOF aborts the transform.
+func Stream(transform Transform, src io.Reader) io.ReadCloser {
+	return StreamContext(context.Background(), transform, src)
+}
+
+// StreamContext is Stream with a deadline: once ctx is done, reads from the
+// returned reader fail with ctx's error and the transform's next write
+// aborts it. External tools are still bounded by their own timeout.
+func StreamContext(ctx context.Context, transform Transform, src io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	stop := context.AfterFunc(ctx, func() {
+		pw.CloseWithError(ctx.Err())
+	})
+	go func() {
+		defer stop()
+		pw.CloseWithError(runTransform(transform, src, pw))
+	}()
+	return pr
+}
+
+// Buffered adapts a whole-file scrubbing function into a Transform. It is the
+// fallback for formats that need random access and cannot be parsed
+// incrementally. If fn panics on malformed input, the original data is
+// written unchanged.
+func Buffered(fn func([]byte) []byte) Transform {
+	return func(src io.Reader, dst io.Writer) error {
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return err
+		}
+		_, err = dst.Write(recoverScrub(data, fn))
+		return err
+	}
+}
+
+// runTransform executes transform, converting a parser panic into an error.
+func runTransform(transform Transform, src io.Reader, dst io.Writer) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("scrubber panic: %v", r)
+		}
+	}()
+	return transform(src, dst)
+}
+
+// applyTransform runs transform over an in-memory file, returning the
+// original data if the transform fails.
+func applyTransform(transform Transform, data []byte) []byte {
+	var out bytes.Buffer
+	if err := runTransform(transform, bytes.NewReader(data), &out); err != nil {
+		return data
+	}
+	return out.Bytes()
+}
+
+// recoverScrub calls fn and recovers from any panic, returning the original data on failure.
+func recoverScrub(data []byte, fn func([]byte) []byte) (result []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = data
+		}
+	}()
+	return fn(data)
+}
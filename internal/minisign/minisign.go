@@ -0,0 +1,147 @@
+// Package minisign verifies detached minisign signatures, the Ed25519
+// format release binaries are signed in (minisign -Sm dead-drop-server).
+// It verifies only: signing is left to minisign itself, run wherever the
+// secret key is kept.
+package minisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	trustedPrefix   = "trusted comment: "
+	untrustedPrefix = "untrusted comment: "
+)
+
+var (
+	// algLegacy signs the message itself; algHashed, minisign's default,
+	// signs its BLAKE2b-512 hash.
+	algLegacy = [2]byte{'E', 'd'}
+	algHashed = [2]byte{'E', 'D'}
+)
+
+// ErrKeyMismatch is returned when a signature was made by a different key.
+var ErrKeyMismatch = errors.New("signature was made by a different key")
+
+// PublicKey is a minisign public key.
+type PublicKey struct {
+	ID  [8]byte
+	Key ed25519.PublicKey
+}
+
+// ParsePublicKey parses a public key from the contents of a minisign .pub
+// file or from its base64 line alone.
+func ParsePublicKey(text string) (*PublicKey, error) {
+	line := ""
+	for _, l := range strings.Split(strings.TrimSpace(text), "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, untrustedPrefix) {
+			line = l
+			break
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize || [2]byte(raw[:2]) != algLegacy {
+		return nil, errors.New("not a minisign public key")
+	}
+	return &PublicKey{ID: [8]byte(raw[2:10]), Key: ed25519.PublicKey(raw[10:])}, nil
+}
+
+// String returns the key ID as minisign prints it.
+func (k *PublicKey) String() string {
+	return keyID(k.ID)
+}
+
+// Encode returns the key as the base64 line of a .pub file, the form
+// ParsePublicKey accepts alone.
+func (k *PublicKey) Encode() string {
+	raw := append(append(algLegacy[:], k.ID[:]...), k.Key...)
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// Signature is a parsed minisign signature file.
+type Signature struct {
+	Algorithm      [2]byte
+	KeyID          [8]byte
+	Signature      []byte
+	TrustedComment string
+	Global         []byte // signs Signature followed by TrustedComment
+}
+
+// ParseSignature parses the contents of a .minisig file.
+func ParseSignature(data []byte) (*Signature, error) {
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], untrustedPrefix) || !strings.HasPrefix(lines[2], trustedPrefix) {
+		return nil, errors.New("not a minisign signature file")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return nil, errors.New("malformed minisign signature")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return nil, errors.New("malformed minisign global signature")
+	}
+	sig := &Signature{
+		Algorithm:      [2]byte(raw[:2]),
+		KeyID:          [8]byte(raw[2:10]),
+		Signature:      raw[10:],
+		TrustedComment: strings.TrimSuffix(strings.TrimPrefix(lines[2], trustedPrefix), "\r"),
+		Global:         global,
+	}
+	if sig.Algorithm != algLegacy && sig.Algorithm != algHashed {
+		return nil, fmt.Errorf("unsupported signature algorithm %q", sig.Algorithm[:])
+	}
+	return sig, nil
+}
+
+// Verify checks sig over the message read from r, and the trusted comment
+// it carries. The message is hashed as it is read unless sig is in the
+// legacy format, which signs the message itself.
+func (k *PublicKey) Verify(sig *Signature, r io.Reader) error {
+	if sig.KeyID != k.ID {
+		return fmt.Errorf("%w: %s, not %s", ErrKeyMismatch, keyID(sig.KeyID), k)
+	}
+	var message []byte
+	if sig.Algorithm == algHashed {
+		h, err := blake2b.New512(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		message = h.Sum(nil)
+	} else {
+		var err error
+		if message, err = io.ReadAll(r); err != nil {
+			return err
+		}
+	}
+	if !ed25519.Verify(k.Key, message, sig.Signature) {
+		return errors.New("signature verification failed")
+	}
+	global := bytes.Join([][]byte{sig.Signature, []byte(sig.TrustedComment)}, nil)
+	if !ed25519.Verify(k.Key, global, sig.Global) {
+		return errors.New("trusted comment signature verification failed")
+	}
+	return nil
+}
+
+// keyID formats a key ID as minisign does: the little-endian key number
+// in upper-case hex.
+func keyID(id [8]byte) string {
+	reversed := make([]byte, len(id))
+	for i, b := range id {
+		reversed[len(id)-1-i] = b
+	}
+	return strings.ToUpper(hex.EncodeToString(reversed))
+}
@@ -0,0 +1,102 @@
+package minisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testKey generates a key pair and its minisign .pub file contents.
+func testKey(t *testing.T, id byte) (ed25519.PrivateKey, string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := append([]byte{'E', 'd', id, 2, 3, 4, 5, 6, 7, 8}, pub...)
+	return priv, "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(raw) + "\n"
+}
+
+// sign writes a .minisig file as minisign -S does, prehashed unless legacy.
+func sign(priv ed25519.PrivateKey, id byte, message []byte, comment string, legacy bool) []byte {
+	alg, signed := []byte("ED"), message
+	if legacy {
+		alg = []byte("Ed")
+	} else {
+		sum := blake2b.Sum512(message)
+		signed = sum[:]
+	}
+	sig := ed25519.Sign(priv, signed)
+	raw := append(append(alg, id, 2, 3, 4, 5, 6, 7, 8), sig...)
+	global := ed25519.Sign(priv, append(append([]byte{}, sig...), comment...))
+	return []byte("untrusted comment: signature from minisign secret key\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
+
+func TestVerify(t *testing.T) {
+	priv, pubFile := testKey(t, 1)
+	key, err := ParsePublicKey(pubFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.String() != "0807060504030201" {
+		t.Errorf("key ID = %s", key)
+	}
+	message := []byte("dead-drop-server binary")
+
+	for _, legacy := range []bool{false, true} {
+		sig, err := ParseSignature(sign(priv, 1, message, "timestamp:1700000000\tfile:dead-drop-server", legacy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := key.Verify(sig, bytes.NewReader(message)); err != nil {
+			t.Errorf("legacy=%v: %v", legacy, err)
+		}
+		if err := key.Verify(sig, strings.NewReader("tampered binary")); err == nil {
+			t.Errorf("legacy=%v: tampered message verified", legacy)
+		}
+		sig.TrustedComment = "file:something-else"
+		if err := key.Verify(sig, bytes.NewReader(message)); err == nil {
+			t.Errorf("legacy=%v: altered trusted comment verified", legacy)
+		}
+	}
+
+	// The base64 line alone is accepted too
+	line := strings.Split(pubFile, "\n")[1]
+	if k, err := ParsePublicKey(line); err != nil || !k.Key.Equal(key.Key) {
+		t.Errorf("bare key line: %v", err)
+	}
+	if key.Encode() != line {
+		t.Errorf("Encode() = %q, want %q", key.Encode(), line)
+	}
+
+	otherPriv, _ := testKey(t, 9)
+	sig, err := ParseSignature(sign(otherPriv, 9, message, "", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Verify(sig, bytes.NewReader(message)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("other key: err = %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestParse_Malformed(t *testing.T) {
+	for _, bad := range []string{"", "untrusted comment: x\nnot base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParsePublicKey(bad); err == nil {
+			t.Errorf("public key %q accepted", bad)
+		}
+	}
+	for _, bad := range []string{"", "just one line", "untrusted comment: x\nAAAA\ntrusted comment: y\nAAAA\n"} {
+		if _, err := ParseSignature([]byte(bad)); err == nil {
+			t.Errorf("signature %q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package monitoring
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Histogram counts observations into buckets, either for distributions
+// computed afresh at each scrape or accumulated since startup. It is safe
+// for concurrent use.
+type Histogram struct {
+	bounds []float64 // ascending upper bounds; +Inf is implied
+	coarse bool      // sum bucket bounds rather than values
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, the last for values above every bound
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates a histogram with the given ascending upper bounds.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// NewCoarseHistogram is NewHistogram for values that must not be recoverable
+// from the sum, such as the size of one upload between two scrapes: each
+// value adds the upper bound of its bucket to the sum, or the last bound if
+// it is above them all.
+func NewCoarseHistogram(bounds []float64) *Histogram {
+	h := NewHistogram(bounds)
+	h.coarse = true
+	return h
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	if h.coarse {
+		v = h.bounds[min(i, len(h.bounds)-1)]
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// write renders h in Prometheus text exposition format under name.
+func (h *Histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	h.series(w, name, "")
+}
+
+// series renders the samples of h under name, with labels (`key="value"`,
+// comma-separated) ahead of each bucket's le label.
+func (h *Histogram) series(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prefix, braced := "", ""
+	if labels != "" {
+		prefix, braced = labels+",", "{"+labels+"}"
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, prefix, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, braced, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, braced, h.count)
+}
+
+// Bucket bounds of the drop age and size histograms: hours to a month, and
+// a note to a large archive.
+var (
+	dropAgeBounds  = []float64{3600, 6 * 3600, 24 * 3600, 3 * 24 * 3600, 7 * 24 * 3600, 30 * 24 * 3600}
+	dropSizeBounds = []float64{64 << 10, 1 << 20, 10 << 20, 100 << 20, 1 << 30}
+)
+
+// Bucket bounds of the request latency histograms, in seconds: from a page
+// served from memory to a large upload over Tor.
+var latencyBounds = []float64{0.005, 0.025, 0.1, 0.5, 1, 5, 30, 120}
+
+// DropsFunc calls observe with the age and stored size of every drop, or
+// returns an error when they cannot be read, e.g. while storage is locked.
+type DropsFunc func(observe func(ageSeconds float64, sizeBytes int64)) error
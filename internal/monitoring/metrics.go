@@ -3,21 +3,77 @@ package monitoring
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // StatsFunc returns live storage statistics (totalBytes, dropCount).
 type StatsFunc func() (int64, int)
 
+// MemoryFunc returns the memory budget state (reservedBytes, limitBytes).
+type MemoryFunc func() (int64, int64)
+
+// QuotaFunc returns how much of the storage quota is in use, in percent.
+type QuotaFunc func() float64
+
+// LimitedFunc returns the number of clients currently at their rate limit.
+type LimitedFunc func() int
+
+// Origin is the coarse network origin of a request.
+type Origin int
+
+// Request origins counted by RecordOrigin.
+const (
+	OriginLoopback Origin = iota // local connections, including Tor hidden services
+	OriginTorExit                // known Tor exit relays
+	OriginClearnet               // everything else
+	numOrigins
+)
+
+var originLabels = [numOrigins]string{"loopback", "tor_exit", "clearnet"}
+
+// String returns the origin's metric label.
+func (o Origin) String() string {
+	if o < 0 || o >= numOrigins {
+		return "unknown"
+	}
+	return originLabels[o]
+}
+
 // Metrics tracks operational counters for the dead-drop server.
 type Metrics struct {
 	uploadsTotal   atomic.Int64
 	downloadsTotal atomic.Int64
+	shedTotal      atomic.Int64
+	quotaRejected  atomic.Int64
+	hashMismatches atomic.Int64
+	memoryFunc     atomic.Pointer[MemoryFunc]
+	limitedFunc    atomic.Pointer[LimitedFunc]
+	quotaFunc      atomic.Pointer[QuotaFunc]
+
+	rateLimitedMu sync.Mutex
+	rateLimited   map[string]int64 // endpoint -> 429 responses
+
+	originStats atomic.Bool
+	origins     [numOrigins]atomic.Int64
+
+	dropsFunc atomic.Pointer[DropsFunc]
+
+	latencyMu sync.Mutex
+	latency   map[string]*Histogram // endpoint -> request durations
+
+	uploadSizes   *Histogram
+	downloadSizes *Histogram
 }
 
 // NewMetrics creates a new Metrics instance.
 func NewMetrics() *Metrics {
-	return &Metrics{}
+	return &Metrics{
+		uploadSizes:   NewCoarseHistogram(dropSizeBounds),
+		downloadSizes: NewCoarseHistogram(dropSizeBounds),
+	}
 }
 
 // RecordUpload increments the upload counter.
@@ -30,6 +86,124 @@ func (m *Metrics) RecordDownload() {
 	m.downloadsTotal.Add(1)
 }
 
+// RecordShed increments the counter of requests refused for lack of memory.
+func (m *Metrics) RecordShed() {
+	m.shedTotal.Add(1)
+}
+
+// RecordQuotaRejected increments the counter of uploads refused because the
+// storage quota is full.
+func (m *Metrics) RecordQuotaRejected() {
+	m.quotaRejected.Add(1)
+}
+
+// RecordHashMismatch increments the counter of retrievals cut short because
+// the drop did not match its stored hash.
+func (m *Metrics) RecordHashMismatch() {
+	m.hashMismatches.Add(1)
+}
+
+// RecordRateLimited counts a request to endpoint refused by the rate limiter.
+// Callers must pass a route pattern, not a raw path, to keep labels bounded.
+func (m *Metrics) RecordRateLimited(endpoint string) {
+	m.rateLimitedMu.Lock()
+	defer m.rateLimitedMu.Unlock()
+	if m.rateLimited == nil {
+		m.rateLimited = make(map[string]int64)
+	}
+	m.rateLimited[endpoint]++
+}
+
+// rateLimitedCounts returns a snapshot of the per-endpoint rejection counts
+// with the endpoints in sorted order.
+func (m *Metrics) rateLimitedCounts() ([]string, map[string]int64) {
+	m.rateLimitedMu.Lock()
+	defer m.rateLimitedMu.Unlock()
+	counts := make(map[string]int64, len(m.rateLimited))
+	endpoints := make([]string, 0, len(m.rateLimited))
+	for e, n := range m.rateLimited {
+		counts[e] = n
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	return endpoints, counts
+}
+
+// ObserveRequest records how long a request to endpoint took. Callers must
+// pass a route pattern, not a raw path, to keep labels bounded.
+func (m *Metrics) ObserveRequest(endpoint string, d time.Duration) {
+	m.latencyMu.Lock()
+	h, ok := m.latency[endpoint]
+	if !ok {
+		if m.latency == nil {
+			m.latency = make(map[string]*Histogram)
+		}
+		h = NewHistogram(latencyBounds)
+		m.latency[endpoint] = h
+	}
+	m.latencyMu.Unlock()
+	h.Observe(d.Seconds())
+}
+
+// latencyHistograms returns the per-endpoint latency histograms with the
+// endpoints in sorted order.
+func (m *Metrics) latencyHistograms() ([]string, map[string]*Histogram) {
+	m.latencyMu.Lock()
+	defer m.latencyMu.Unlock()
+	hists := make(map[string]*Histogram, len(m.latency))
+	endpoints := make([]string, 0, len(m.latency))
+	for e, h := range m.latency {
+		hists[e] = h
+		endpoints = append(endpoints, e)
+	}
+	sort.Strings(endpoints)
+	return endpoints, hists
+}
+
+// ObserveUploadSize records the stored size of an accepted upload. Only its
+// bucket is kept, so the size of one drop cannot be read from the
+// difference between two scrapes.
+func (m *Metrics) ObserveUploadSize(n int64) {
+	m.uploadSizes.Observe(float64(n))
+}
+
+// ObserveDownloadSize records the stored size of a retrieved drop, kept to
+// its bucket like upload sizes.
+func (m *Metrics) ObserveDownloadSize(n int64) {
+	m.downloadSizes.Observe(float64(n))
+}
+
+// RecordOrigin counts a request from the given origin and enables the
+// origin counters in the output.
+func (m *Metrics) RecordOrigin(o Origin) {
+	if o < 0 || o >= numOrigins {
+		return
+	}
+	m.originStats.Store(true)
+	m.origins[o].Add(1)
+}
+
+// SetMemoryFunc registers the source of the memory budget gauges.
+func (m *Metrics) SetMemoryFunc(fn MemoryFunc) {
+	m.memoryFunc.Store(&fn)
+}
+
+// SetLimitedFunc registers the source of the rate-limited clients gauge.
+func (m *Metrics) SetLimitedFunc(fn LimitedFunc) {
+	m.limitedFunc.Store(&fn)
+}
+
+// SetQuotaFunc registers the source of the quota usage gauge.
+func (m *Metrics) SetQuotaFunc(fn QuotaFunc) {
+	m.quotaFunc.Store(&fn)
+}
+
+// SetDropsFunc registers the source of the drop age and size histograms,
+// which are computed from it at each scrape.
+func (m *Metrics) SetDropsFunc(fn DropsFunc) {
+	m.dropsFunc.Store(&fn)
+}
+
 // Handler returns an http.HandlerFunc that renders metrics in Prometheus
 // text exposition format. The optional statsFunc provides live storage
 // gauges; if nil, storage metrics are omitted.
@@ -50,6 +224,48 @@ func (m *Metrics) Handler(statsFunc StatsFunc) http.HandlerFunc {
 		fmt.Fprintf(w, "# TYPE dead_drop_downloads_total counter\n")
 		fmt.Fprintf(w, "dead_drop_downloads_total %d\n", m.downloadsTotal.Load())
 
+		if fn := m.memoryFunc.Load(); fn != nil {
+			reserved, limit := (*fn)()
+			fmt.Fprintf(w, "# HELP dead_drop_memory_budget_bytes Memory reserved by in-flight uploads and downloads.\n")
+			fmt.Fprintf(w, "# TYPE dead_drop_memory_budget_bytes gauge\n")
+			fmt.Fprintf(w, "dead_drop_memory_budget_bytes %d\n", reserved)
+			fmt.Fprintf(w, "# HELP dead_drop_memory_budget_limit_bytes Configured memory budget.\n")
+			fmt.Fprintf(w, "# TYPE dead_drop_memory_budget_limit_bytes gauge\n")
+			fmt.Fprintf(w, "dead_drop_memory_budget_limit_bytes %d\n", limit)
+			fmt.Fprintf(w, "# HELP dead_drop_requests_shed_total Requests refused because the memory budget was exhausted.\n")
+			fmt.Fprintf(w, "# TYPE dead_drop_requests_shed_total counter\n")
+			fmt.Fprintf(w, "dead_drop_requests_shed_total %d\n", m.shedTotal.Load())
+		}
+
+		endpoints, counts := m.rateLimitedCounts()
+		fmt.Fprintf(w, "# HELP dead_drop_rate_limited_total Requests refused by the rate limiter, by endpoint.\n")
+		fmt.Fprintf(w, "# TYPE dead_drop_rate_limited_total counter\n")
+		for _, e := range endpoints {
+			fmt.Fprintf(w, "dead_drop_rate_limited_total{endpoint=%q} %d\n", e, counts[e])
+		}
+		if fn := m.limitedFunc.Load(); fn != nil {
+			fmt.Fprintf(w, "# HELP dead_drop_rate_limited_clients Clients currently at their rate limit.\n")
+			fmt.Fprintf(w, "# TYPE dead_drop_rate_limited_clients gauge\n")
+			fmt.Fprintf(w, "dead_drop_rate_limited_clients %d\n", (*fn)())
+		}
+
+		endpoints, latency := m.latencyHistograms()
+		fmt.Fprintf(w, "# HELP dead_drop_request_duration_seconds Time to serve a request, by endpoint.\n")
+		fmt.Fprintf(w, "# TYPE dead_drop_request_duration_seconds histogram\n")
+		for _, e := range endpoints {
+			latency[e].series(w, "dead_drop_request_duration_seconds", fmt.Sprintf("endpoint=%q", e))
+		}
+		m.uploadSizes.write(w, "dead_drop_upload_size_bytes", "Stored size of accepted uploads, summed by bucket upper bound.")
+		m.downloadSizes.write(w, "dead_drop_download_size_bytes", "Stored size of retrieved drops, summed by bucket upper bound.")
+
+		if m.originStats.Load() {
+			fmt.Fprintf(w, "# HELP dead_drop_requests_by_origin_total Requests by coarse network origin.\n")
+			fmt.Fprintf(w, "# TYPE dead_drop_requests_by_origin_total counter\n")
+			for o, label := range originLabels {
+				fmt.Fprintf(w, "dead_drop_requests_by_origin_total{origin=%q} %d\n", label, m.origins[o].Load())
+			}
+		}
+
 		if statsFunc != nil {
 			totalBytes, dropCount := statsFunc()
 			fmt.Fprintf(w, "# HELP dead_drop_storage_bytes Current storage usage in bytes.\n")
@@ -59,5 +275,28 @@ func (m *Metrics) Handler(statsFunc StatsFunc) http.HandlerFunc {
 			fmt.Fprintf(w, "# TYPE dead_drop_active_drops gauge\n")
 			fmt.Fprintf(w, "dead_drop_active_drops %d\n", dropCount)
 		}
+		fmt.Fprintf(w, "# HELP dead_drop_quota_rejections_total Uploads refused because the storage quota was full.\n")
+		fmt.Fprintf(w, "# TYPE dead_drop_quota_rejections_total counter\n")
+		fmt.Fprintf(w, "dead_drop_quota_rejections_total %d\n", m.quotaRejected.Load())
+		fmt.Fprintf(w, "# HELP dead_drop_hash_mismatches_total Retrievals cut short because the drop did not match its stored hash.\n")
+		fmt.Fprintf(w, "# TYPE dead_drop_hash_mismatches_total counter\n")
+		fmt.Fprintf(w, "dead_drop_hash_mismatches_total %d\n", m.hashMismatches.Load())
+		if fn := m.quotaFunc.Load(); fn != nil {
+			fmt.Fprintf(w, "# HELP dead_drop_quota_used_percent Share of max_storage_gb or max_drops in use, whichever is larger.\n")
+			fmt.Fprintf(w, "# TYPE dead_drop_quota_used_percent gauge\n")
+			fmt.Fprintf(w, "dead_drop_quota_used_percent %.1f\n", (*fn)())
+		}
+		if fn := m.dropsFunc.Load(); fn != nil {
+			ages, sizes := NewHistogram(dropAgeBounds), NewHistogram(dropSizeBounds)
+			err := (*fn)(func(age float64, size int64) {
+				ages.Observe(age)
+				sizes.Observe(float64(size))
+			})
+			// Left out rather than reported empty while they cannot be read
+			if err == nil {
+				ages.write(w, "dead_drop_drop_age_seconds", "Age of current drops, to the hour they were received.")
+				sizes.write(w, "dead_drop_drop_size_bytes", "Stored (encrypted) size of current drops.")
+			}
+		}
 	}
 }
@@ -1,10 +1,12 @@
 package monitoring
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRecordUploadIncrementsCounter(t *testing.T) {
@@ -76,6 +78,100 @@ func TestHandlerOutputFormat(t *testing.T) {
 	}
 }
 
+func TestHandlerMemoryBudget(t *testing.T) {
+	m := NewMetrics()
+	m.RecordShed()
+	m.SetMemoryFunc(func() (int64, int64) { return 1024, 4096 })
+
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE dead_drop_memory_budget_bytes gauge",
+		"dead_drop_memory_budget_bytes 1024",
+		"dead_drop_memory_budget_limit_bytes 4096",
+		"# TYPE dead_drop_requests_shed_total counter",
+		"dead_drop_requests_shed_total 1",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestHandlerQuotaUsage(t *testing.T) {
+	m := NewMetrics()
+	m.RecordQuotaRejected()
+	m.SetQuotaFunc(func() float64 { return 72.5 })
+
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE dead_drop_quota_used_percent gauge",
+		"dead_drop_quota_used_percent 72.5",
+		"# TYPE dead_drop_quota_rejections_total counter",
+		"dead_drop_quota_rejections_total 1",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestHandlerOriginCounters(t *testing.T) {
+	m := NewMetrics()
+
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "dead_drop_requests_by_origin_total") {
+		t.Error("origin counters should be omitted until origins are recorded")
+	}
+
+	m.RecordOrigin(OriginLoopback)
+	m.RecordOrigin(OriginLoopback)
+	m.RecordOrigin(OriginTorExit)
+
+	rec = httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE dead_drop_requests_by_origin_total counter",
+		`dead_drop_requests_by_origin_total{origin="loopback"} 2`,
+		`dead_drop_requests_by_origin_total{origin="tor_exit"} 1`,
+		`dead_drop_requests_by_origin_total{origin="clearnet"} 0`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestHandlerRateLimited(t *testing.T) {
+	m := NewMetrics()
+	m.RecordRateLimited("/submit")
+	m.RecordRateLimited("/submit")
+	m.RecordRateLimited("/retrieve")
+	m.SetLimitedFunc(func() int { return 3 })
+
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE dead_drop_rate_limited_total counter",
+		`dead_drop_rate_limited_total{endpoint="/retrieve"} 1`,
+		`dead_drop_rate_limited_total{endpoint="/submit"} 2`,
+		"# TYPE dead_drop_rate_limited_clients gauge",
+		"dead_drop_rate_limited_clients 3",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, body)
+		}
+	}
+}
+
 func TestHandlerWithoutStatsFunc(t *testing.T) {
 	m := NewMetrics()
 	handler := m.Handler(nil)
@@ -138,3 +234,105 @@ func TestNoSensitiveDataInOutput(t *testing.T) {
 		}
 	}
 }
+
+func TestHandlerDropHistograms(t *testing.T) {
+	m := NewMetrics()
+	m.SetDropsFunc(func(observe func(float64, int64)) error {
+		observe(1800, 1000)        // half an hour, 1000 bytes
+		observe(2*24*3600, 5<<20)  // two days, 5 MiB
+		observe(60*24*3600, 2<<30) // two months, 2 GiB
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE dead_drop_drop_age_seconds histogram",
+		`dead_drop_drop_age_seconds_bucket{le="3600"} 1`,
+		`dead_drop_drop_age_seconds_bucket{le="86400"} 1`,
+		`dead_drop_drop_age_seconds_bucket{le="259200"} 2`,
+		`dead_drop_drop_age_seconds_bucket{le="2.592e+06"} 2`,
+		`dead_drop_drop_age_seconds_bucket{le="+Inf"} 3`,
+		"dead_drop_drop_age_seconds_count 3",
+		"# TYPE dead_drop_drop_size_bytes histogram",
+		`dead_drop_drop_size_bytes_bucket{le="65536"} 1`,
+		`dead_drop_drop_size_bytes_bucket{le="1.048576e+07"} 2`,
+		`dead_drop_drop_size_bytes_bucket{le="1.073741824e+09"} 2`,
+		`dead_drop_drop_size_bytes_bucket{le="+Inf"} 3`,
+		"dead_drop_drop_size_bytes_sum 2.152727528e+09",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestHandlerDropHistogramsOmittedOnError(t *testing.T) {
+	m := NewMetrics()
+	m.SetDropsFunc(func(func(float64, int64)) error { return errors.New("locked") })
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "dead_drop_drop_age_seconds") {
+		t.Error("histograms reported while drops cannot be read")
+	}
+}
+
+func TestHandlerRequestLatency(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveRequest("/submit", 3*time.Millisecond)
+	m.ObserveRequest("/submit", 2*time.Second)
+	m.ObserveRequest("/", 50*time.Millisecond)
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		"# TYPE dead_drop_request_duration_seconds histogram",
+		`dead_drop_request_duration_seconds_bucket{endpoint="/",le="0.025"} 0`,
+		`dead_drop_request_duration_seconds_bucket{endpoint="/",le="0.1"} 1`,
+		`dead_drop_request_duration_seconds_count{endpoint="/"} 1`,
+		`dead_drop_request_duration_seconds_bucket{endpoint="/submit",le="0.005"} 1`,
+		`dead_drop_request_duration_seconds_bucket{endpoint="/submit",le="5"} 2`,
+		`dead_drop_request_duration_seconds_bucket{endpoint="/submit",le="+Inf"} 2`,
+		`dead_drop_request_duration_seconds_count{endpoint="/submit"} 2`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+	if strings.Count(body, "# TYPE dead_drop_request_duration_seconds") != 1 {
+		t.Error("latency histogram family declared more than once")
+	}
+}
+
+func TestHandlerTransferSizes(t *testing.T) {
+	m := NewMetrics()
+	m.ObserveUploadSize(1000)
+	m.ObserveUploadSize(5 << 20)
+	m.ObserveDownloadSize(2 << 30)
+	rec := httptest.NewRecorder()
+	m.Handler(nil)(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, line := range []string{
+		`dead_drop_upload_size_bytes_bucket{le="65536"} 1`,
+		`dead_drop_upload_size_bytes_bucket{le="1.048576e+07"} 2`,
+		"dead_drop_upload_size_bytes_count 2",
+		`dead_drop_download_size_bytes_bucket{le="1.073741824e+09"} 0`,
+		`dead_drop_download_size_bytes_bucket{le="+Inf"} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+	// Sums of bucket bounds, not of the sizes themselves
+	for _, line := range []string{
+		"dead_drop_upload_size_bytes_sum 1.0551296e+07",
+		"dead_drop_download_size_bytes_sum 1.073741824e+09",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package notify tells newsroom tooling that a new drop has arrived, that
+// one failed the checks run after upload, or that storage is filling up.
+//
+// The webhook body carries only the event name, the campaign code (if any),
+// the hour of the submission, and for quota events the threshold crossed, sealed with AES-GCM under a key derived
+// from a secret shared with the receiver. The endpoint, and anything on the
+// path to it, learns nothing else; the receiver authenticates and decrypts
+// with Open.
+package notify
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Event names. EventProcessingFailed reports a drop that failed the checks
+// run after upload when processing is asynchronous; EventQuotaThreshold
+// reports storage usage crossing an alert threshold.
+const (
+	EventNewDrop          = "new_drop"
+	EventProcessingFailed = "processing_failed"
+	EventQuotaThreshold   = "quota_threshold"
+)
+
+// aad binds sealed payloads to this use of the shared secret.
+var aad = []byte("dead-drop-webhook-v1")
+
+// Event is the plaintext of a notification.
+type Event struct {
+	Event    string    `json:"event"`
+	Campaign string    `json:"campaign,omitempty"`
+	Hour     time.Time `json:"hour"`              // truncated to the hour
+	Percent  int       `json:"percent,omitempty"` // quota threshold crossed
+}
+
+// envelope is the webhook request body.
+type envelope struct {
+	Version int    `json:"v"`
+	Sealed  string `json:"sealed"` // base64(nonce || ciphertext)
+}
+
+// Notifier posts sealed new-drop events to a webhook.
+type Notifier struct {
+	url    string
+	key    []byte
+	jitter time.Duration
+	client *http.Client
+	now    func() time.Time
+}
+
+// New creates a notifier for url. secret must be at least 32 bytes; jitter
+// is the upper bound of a random delay before each post, so that the post
+// does not time the upload more precisely than the payload does.
+func New(url string, secret []byte, jitter time.Duration) (*Notifier, error) {
+	key, err := deriveKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{
+		url:    url,
+		key:    key,
+		jitter: jitter,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}, nil
+}
+
+// NewDrop posts a new-drop event for campaign asynchronously.
+func (n *Notifier) NewDrop(campaign string) {
+	n.send(EventNewDrop, campaign)
+}
+
+// ProcessingFailed posts a processing-failed event for campaign
+// asynchronously. Like new-drop events it names no drop.
+func (n *Notifier) ProcessingFailed(campaign string) {
+	n.send(EventProcessingFailed, campaign)
+}
+
+// QuotaThreshold posts a quota-threshold event asynchronously: storage
+// usage has risen to percent of max_storage_gb or max_drops.
+func (n *Notifier) QuotaThreshold(percent int) {
+	n.sendEvent(Event{Event: EventQuotaThreshold, Percent: percent})
+}
+
+// send posts a drop event for campaign.
+func (n *Notifier) send(event, campaign string) {
+	n.sendEvent(Event{Event: event, Campaign: campaign})
+}
+
+// sendEvent stamps e with the hour and posts it after the jitter delay,
+// logging failures.
+func (n *Notifier) sendEvent(e Event) {
+	e.Hour = n.now().UTC().Truncate(time.Hour)
+	go func() {
+		if n.jitter > 0 {
+			d, err := rand.Int(rand.Reader, big.NewInt(int64(n.jitter)))
+			if err == nil {
+				time.Sleep(time.Duration(d.Int64()))
+			}
+		}
+		if err := n.post(e); err != nil {
+			log.Printf("Notification webhook (%s): %v", e.Event, err)
+		}
+	}()
+}
+
+func (n *Notifier) post(e Event) error {
+	body, err := seal(n.key, e)
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body)) // #nosec G107 -- webhook URL from config
+	if err != nil {
+		return fmt.Errorf("POST failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// seal returns the webhook body for e under a key from deriveKey.
+func seal(key []byte, e Event) ([]byte, error) {
+	plaintext, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, aad)
+	return json.Marshal(envelope{Version: 1, Sealed: base64.StdEncoding.EncodeToString(sealed)})
+}
+
+// Open authenticates and decrypts a webhook body with the shared secret.
+func Open(secret, body []byte) (Event, error) {
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return Event{}, fmt.Errorf("malformed webhook body: %w", err)
+	}
+	if env.Version != 1 {
+		return Event{}, fmt.Errorf("unsupported webhook version %d", env.Version)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(env.Sealed)
+	if err != nil {
+		return Event{}, fmt.Errorf("malformed webhook body: %w", err)
+	}
+
+	key, err := deriveKey(secret)
+	if err != nil {
+		return Event{}, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return Event{}, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return Event{}, errors.New("webhook payload too short")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+	if err != nil {
+		return Event{}, errors.New("webhook payload failed authentication")
+	}
+
+	var e Event
+	if err := json.Unmarshal(plaintext, &e); err != nil {
+		return Event{}, fmt.Errorf("malformed webhook payload: %w", err)
+	}
+	return e, nil
+}
+
+// deriveKey turns the shared secret into the AES-256 key.
+func deriveKey(secret []byte) ([]byte, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("webhook secret must be at least 32 bytes")
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, aad), key); err != nil {
+		return nil, fmt.Errorf("failed to derive webhook key: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
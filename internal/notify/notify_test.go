@@ -0,0 +1,108 @@
+package notify
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifier_NewDrop(t *testing.T) {
+	secret := bytes.Repeat([]byte{3}, 32)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	n, err := New(srv.URL, secret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.now = func() time.Time { return time.Date(2026, 5, 4, 13, 47, 12, 0, time.UTC) }
+	n.NewDrop("spring-leaks")
+
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+	if bytes.Contains(body, []byte("spring-leaks")) {
+		t.Error("campaign code sent in the clear")
+	}
+
+	e, err := Open(secret, body)
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	want := Event{Event: EventNewDrop, Campaign: "spring-leaks", Hour: time.Date(2026, 5, 4, 13, 0, 0, 0, time.UTC)}
+	if e != want {
+		t.Errorf("event = %+v, want %+v", e, want)
+	}
+
+	if _, err := Open(bytes.Repeat([]byte{4}, 32), body); err == nil {
+		t.Error("Open should fail with the wrong secret")
+	}
+}
+
+func TestNotifier_ProcessingFailed(t *testing.T) {
+	secret := bytes.Repeat([]byte{3}, 32)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	n, err := New(srv.URL, secret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.ProcessingFailed("")
+
+	select {
+	case body := <-bodies:
+		e, err := Open(secret, body)
+		if err != nil || e.Event != EventProcessingFailed || e.Campaign != "" {
+			t.Errorf("event = %+v, %v", e, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestNotifier_QuotaThreshold(t *testing.T) {
+	secret := bytes.Repeat([]byte{4}, 32)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	n, err := New(srv.URL, secret, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.QuotaThreshold(85)
+
+	select {
+	case body := <-bodies:
+		e, err := Open(secret, body)
+		if err != nil || e.Event != EventQuotaThreshold || e.Percent != 85 || e.Hour.IsZero() {
+			t.Errorf("event = %+v, %v", e, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not called")
+	}
+}
+
+func TestNew_ShortSecret(t *testing.T) {
+	if _, err := New("http://example.invalid", []byte("short"), 0); err == nil {
+		t.Error("expected error for a short secret")
+	}
+}
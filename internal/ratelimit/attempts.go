@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// maxAttemptKeys bounds the keys Attempts tracks, so that failures spread
+// over many keys cannot exhaust memory.
+const maxAttemptKeys = 10000
+
+// Attempts counts failed attempts per key, such as wrong receipts for one
+// drop ID, and refuses a key for a while once it has failed too often.
+// Counts decay: a key's failures are forgotten a window after the first.
+type Attempts struct {
+	mu     sync.Mutex
+	keys   map[string]*attempt
+	limit  int
+	window time.Duration
+	now    func() time.Time
+}
+
+type attempt struct {
+	failures int
+	reset    time.Time // when failures are forgotten, or the refusal ends
+}
+
+// NewAttempts creates counters that refuse a key for window once it has
+// failed limit times within window.
+func NewAttempts(limit int, window time.Duration) *Attempts {
+	return &Attempts{
+		keys:   make(map[string]*attempt),
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// Blocked reports whether key is refused.
+func (a *Attempts) Blocked(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	at, ok := a.keys[key]
+	return ok && at.failures >= a.limit && a.now().Before(at.reset)
+}
+
+// Fail counts a failed attempt for key and reports whether it brought the
+// key to the limit, starting its refusal.
+func (a *Attempts) Fail(key string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	at, ok := a.keys[key]
+	if !ok || !now.Before(at.reset) {
+		if !ok && len(a.keys) >= maxAttemptKeys {
+			a.evict(now)
+		}
+		at = &attempt{reset: now.Add(a.window)}
+		a.keys[key] = at
+	}
+	at.failures++
+	if at.failures == a.limit {
+		// Refused for a whole window from the failure that tripped it
+		at.reset = now.Add(a.window)
+		return true
+	}
+	return false
+}
+
+// evict makes room for a key: it forgets keys whose failures have decayed,
+// or failing that the one whose reset is oldest, preferring a key that is
+// not refused. The map never grows past maxAttemptKeys.
+func (a *Attempts) evict(now time.Time) {
+	for k, at := range a.keys {
+		if !now.Before(at.reset) {
+			delete(a.keys, k)
+		}
+	}
+	if len(a.keys) < maxAttemptKeys {
+		return
+	}
+	var oldest string
+	var found *attempt
+	for k, at := range a.keys {
+		if found == nil || a.evictsBefore(at, found) {
+			oldest, found = k, at
+		}
+	}
+	delete(a.keys, oldest)
+}
+
+// evictsBefore reports whether x should make room before y: a key that is
+// not refused before one that is, and otherwise the one whose reset is older.
+func (a *Attempts) evictsBefore(x, y *attempt) bool {
+	xRefused, yRefused := x.failures >= a.limit, y.failures >= a.limit
+	if xRefused != yRefused {
+		return !xRefused
+	}
+	return x.reset.Before(y.reset)
+}
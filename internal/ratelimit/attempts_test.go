@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestAttempts_RefusesAtLimit(t *testing.T) {
+	a := NewAttempts(3, time.Minute)
+	start := time.Now()
+	a.now = func() time.Time { return start }
+
+	for i := 1; i <= 3; i++ {
+		if a.Blocked("drop") {
+			t.Fatalf("refused after %d failures", i-1)
+		}
+		if tripped := a.Fail("drop"); tripped != (i == 3) {
+			t.Errorf("failure %d tripped = %v", i, tripped)
+		}
+	}
+	if !a.Blocked("drop") {
+		t.Error("not refused at the limit")
+	}
+	if a.Blocked("other") {
+		t.Error("unrelated key refused")
+	}
+
+	a.now = func() time.Time { return start.Add(time.Minute) }
+	if a.Blocked("drop") {
+		t.Error("still refused after the window")
+	}
+}
+
+func TestAttempts_Decay(t *testing.T) {
+	a := NewAttempts(3, time.Minute)
+	start := time.Now()
+	a.now = func() time.Time { return start }
+	a.Fail("drop")
+	a.Fail("drop")
+
+	// Failures a window apart never add up to the limit
+	a.now = func() time.Time { return start.Add(time.Minute) }
+	if a.Fail("drop") || a.Blocked("drop") {
+		t.Error("decayed failures counted")
+	}
+}
+
+func TestAttempts_Bounded(t *testing.T) {
+	a := NewAttempts(2, time.Minute)
+	a.Fail("target")
+	a.Fail("target")
+	for i := range maxAttemptKeys + 100 {
+		a.Fail(fmt.Sprintf("key-%d", i))
+	}
+	if len(a.keys) > maxAttemptKeys {
+		t.Errorf("%d keys tracked, want at most %d", len(a.keys), maxAttemptKeys)
+	}
+	if !a.Blocked("target") {
+		t.Error("refused key evicted")
+	}
+}
+
+func TestAttempts_BoundedAllRefused(t *testing.T) {
+	a := NewAttempts(1, time.Minute)
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	for i := range maxAttemptKeys + 10 {
+		now = now.Add(time.Millisecond)
+		a.Fail(fmt.Sprintf("key-%d", i))
+	}
+	if len(a.keys) > maxAttemptKeys {
+		t.Errorf("%d keys tracked, want at most %d", len(a.keys), maxAttemptKeys)
+	}
+	if !a.Blocked(fmt.Sprintf("key-%d", maxAttemptKeys+9)) {
+		t.Error("newest key not refused")
+	}
+	if a.Blocked("key-0") {
+		t.Error("the key whose refusal ends first should make room")
+	}
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// heapMetric is the runtime metric sampled by the watchdog: bytes occupied
+// by live and not-yet-swept heap objects.
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// MemoryBudget sheds load before the process runs out of memory. Requests
+// reserve an estimate of the memory they will hold (based on upload and drop
+// sizes) and are refused when the total would exceed the limit. A watchdog
+// additionally refuses all reservations while the sampled heap is above the
+// limit, covering anything the estimates miss.
+//
+// A nil *MemoryBudget admits everything.
+type MemoryBudget struct {
+	limit      int64
+	used       atomic.Int64
+	overloaded atomic.Bool
+	heap       atomic.Int64
+}
+
+// NewMemoryBudget creates a budget of limitBytes.
+func NewMemoryBudget(limitBytes int64) *MemoryBudget {
+	return &MemoryBudget{limit: limitBytes}
+}
+
+// Acquire reserves n bytes, reporting false (and reserving nothing) if the
+// budget cannot accommodate them. A single request larger than the whole
+// budget is admitted only when nothing else is in flight, so that the
+// largest permitted upload can always eventually proceed.
+func (b *MemoryBudget) Acquire(n int64) bool {
+	if b == nil {
+		return true
+	}
+	if b.overloaded.Load() {
+		return false
+	}
+	for {
+		used := b.used.Load()
+		if used+n > b.limit && used > 0 {
+			return false
+		}
+		if b.used.CompareAndSwap(used, used+n) {
+			return true
+		}
+	}
+}
+
+// Release returns n bytes reserved by Acquire.
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil {
+		return
+	}
+	b.used.Add(-n)
+}
+
+// Used returns the bytes currently reserved.
+func (b *MemoryBudget) Used() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.used.Load()
+}
+
+// Limit returns the configured budget in bytes.
+func (b *MemoryBudget) Limit() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.limit
+}
+
+// Overloaded reports whether the watchdog is currently shedding load.
+func (b *MemoryBudget) Overloaded() bool {
+	return b != nil && b.overloaded.Load()
+}
+
+// HeapBytes returns the heap size observed by the last watchdog sample.
+func (b *MemoryBudget) HeapBytes() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.heap.Load()
+}
+
+// Watch samples the heap every interval until stop is closed. Load is shed
+// once the heap reaches the limit and admitted again below 80% of it, so the
+// state does not flap around the threshold.
+func (b *MemoryBudget) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sample := []metrics.Sample{{Name: heapMetric}}
+	for {
+		b.observe(sample)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *MemoryBudget) observe(sample []metrics.Sample) {
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return
+	}
+	heap := int64(sample[0].Value.Uint64()) // #nosec G115 -- heap size fits in int64
+	b.setHeap(heap)
+}
+
+func (b *MemoryBudget) setHeap(heap int64) {
+	b.heap.Store(heap)
+	switch {
+	case heap >= b.limit:
+		b.overloaded.Store(true)
+	case heap < b.limit/5*4:
+		b.overloaded.Store(false)
+	}
+}
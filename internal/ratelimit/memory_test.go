@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget_AcquireRelease(t *testing.T) {
+	b := NewMemoryBudget(100)
+
+	if !b.Acquire(60) {
+		t.Fatal("first reservation should fit")
+	}
+	if b.Acquire(50) {
+		t.Error("reservation beyond the limit should be refused")
+	}
+	if !b.Acquire(40) {
+		t.Error("reservation up to the limit should fit")
+	}
+	if b.Used() != 100 {
+		t.Errorf("Used = %d, want 100", b.Used())
+	}
+
+	b.Release(60)
+	b.Release(40)
+	if b.Used() != 0 {
+		t.Errorf("Used = %d after release, want 0", b.Used())
+	}
+}
+
+func TestMemoryBudget_OversizedAloneAdmitted(t *testing.T) {
+	b := NewMemoryBudget(100)
+
+	if !b.Acquire(500) {
+		t.Fatal("oversized request should be admitted when idle")
+	}
+	if b.Acquire(1) {
+		t.Error("nothing else should fit while the oversized request runs")
+	}
+	b.Release(500)
+}
+
+func TestMemoryBudget_Nil(t *testing.T) {
+	var b *MemoryBudget
+	if !b.Acquire(1 << 40) {
+		t.Error("nil budget should admit everything")
+	}
+	b.Release(1 << 40)
+	if b.Used() != 0 || b.Limit() != 0 || b.Overloaded() {
+		t.Error("nil budget should report zero values")
+	}
+}
+
+func TestMemoryBudget_WatchdogHysteresis(t *testing.T) {
+	b := NewMemoryBudget(1000)
+
+	b.setHeap(1000)
+	if !b.Overloaded() || b.Acquire(1) {
+		t.Fatal("heap at the limit should shed load")
+	}
+	b.setHeap(900)
+	if !b.Overloaded() {
+		t.Error("should keep shedding until the heap drops below 80%")
+	}
+	b.setHeap(700)
+	if b.Overloaded() || !b.Acquire(1) {
+		t.Error("should admit again below 80%")
+	}
+}
+
+func TestMemoryBudget_WatchSamplesHeap(t *testing.T) {
+	b := NewMemoryBudget(1 << 40)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		b.Watch(time.Hour, stop)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for b.HeapBytes() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("watchdog should sample the heap immediately")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+}
+
+func TestMemoryBudget_Concurrent(t *testing.T) {
+	b := NewMemoryBudget(1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if b.Acquire(10) {
+				b.Release(10)
+			}
+		}()
+	}
+	wg.Wait()
+	if b.Used() != 0 {
+		t.Errorf("Used = %d, want 0", b.Used())
+	}
+}
@@ -0,0 +1,203 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoWHeader carries a solved proof-of-work token: a challenge from
+// PoW.Challenge, a colon, and the solution.
+const PoWHeader = "X-Dead-Drop-PoW"
+
+const (
+	// DefaultPoWDifficulty is the work asked for when traffic is quiet, in
+	// leading zero bits: about 65 000 hashes, a second or two in a browser.
+	DefaultPoWDifficulty = 16
+
+	// MaxPoWDifficulty caps the work asked for however busy the server is.
+	MaxPoWDifficulty = 32
+
+	// PoWChallengeTTL is how long a challenge may be solved and spent.
+	PoWChallengeTTL = 2 * time.Minute
+)
+
+// challenge layout: random nonce, expiry (Unix seconds), difficulty, MAC.
+const (
+	powNonceSize     = 16
+	powBodySize      = powNonceSize + 8 + 1
+	powChallengeSize = powBodySize + sha256.Size
+)
+
+// Errors returned by PoW.Spend.
+var (
+	ErrPoWInvalid = errors.New("invalid proof-of-work token")
+	ErrPoWExpired = errors.New("proof-of-work challenge expired")
+	ErrPoWSpent   = errors.New("proof-of-work token already spent")
+)
+
+// PoW budgets requests by work spent instead of by address, for traffic
+// whose address says nothing, such as a hidden service's, which all comes
+// from the local Tor daemon. Each request spends a token solving a
+// challenge the server signed; the work asked for doubles each time the
+// tokens spent in the last window double past the allowance, so a flood
+// gets dearer the longer it lasts without anyone being told apart.
+// Challenges are stateless; only spent ones are remembered, until they
+// expire.
+type PoW struct {
+	mu     sync.Mutex
+	key    []byte
+	base   int
+	rate   int
+	window time.Duration
+	spent  map[string]time.Time // challenge -> expiry
+	recent []time.Time          // when tokens were spent, oldest first
+	now    func() time.Time
+}
+
+// NewPoW creates a budget asking for base bits of work while fewer than
+// rate tokens were spent in the last window. A base of 0 means
+// DefaultPoWDifficulty.
+func NewPoW(base, rate int, window time.Duration) (*PoW, error) {
+	if base == 0 {
+		base = DefaultPoWDifficulty
+	}
+	if base < 1 || base > MaxPoWDifficulty {
+		return nil, errors.New("proof-of-work difficulty out of range 1-32")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &PoW{
+		key:    key,
+		base:   base,
+		rate:   max(rate, 1),
+		window: window,
+		spent:  make(map[string]time.Time),
+		now:    time.Now,
+	}, nil
+}
+
+// SetRate changes the tokens that may be spent per window before the
+// difficulty rises.
+func (p *PoW) SetRate(rate int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rate = max(rate, 1)
+}
+
+// Difficulty returns the bits of work a challenge issued now asks for.
+func (p *PoW) Difficulty() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.difficulty(p.now())
+}
+
+// difficulty adds a bit for each doubling of recent volume past the rate.
+// The caller holds p.mu.
+func (p *PoW) difficulty(now time.Time) int {
+	cutoff := now.Add(-p.window)
+	i := 0
+	for i < len(p.recent) && !p.recent[i].After(cutoff) {
+		i++
+	}
+	p.recent = p.recent[i:]
+	return min(p.base+bits.Len(uint(len(p.recent)/p.rate)), MaxPoWDifficulty)
+}
+
+// Challenge issues a challenge and the difficulty it was signed with.
+func (p *PoW) Challenge() (string, int, error) {
+	p.mu.Lock()
+	now := p.now()
+	difficulty := p.difficulty(now)
+	p.mu.Unlock()
+
+	body := make([]byte, powBodySize, powChallengeSize)
+	if _, err := rand.Read(body[:powNonceSize]); err != nil {
+		return "", 0, err
+	}
+	binary.BigEndian.PutUint64(body[powNonceSize:], uint64(now.Add(PoWChallengeTTL).Unix())) // #nosec G115 -- Unix time after 1970
+	body[powBodySize-1] = byte(difficulty)
+	return base64.RawURLEncoding.EncodeToString(append(body, p.mac(body)...)), difficulty, nil
+}
+
+func (p *PoW) mac(body []byte) []byte {
+	m := hmac.New(sha256.New, p.key)
+	m.Write(body)
+	return m.Sum(nil)
+}
+
+// Spend checks a token from PoWHeader and records it as spent, so that it
+// cannot be used again.
+func (p *PoW) Spend(token string) error {
+	challenge, solution, ok := strings.Cut(token, ":")
+	if !ok {
+		return ErrPoWInvalid
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(challenge)
+	if err != nil || len(raw) != powChallengeSize ||
+		subtle.ConstantTimeCompare(raw[powBodySize:], p.mac(raw[:powBodySize])) != 1 {
+		return ErrPoWInvalid
+	}
+	difficulty := int(raw[powBodySize-1])
+	if leadingZeroBits(powHash(challenge, solution)) < difficulty {
+		return ErrPoWInvalid
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(raw[powNonceSize:])), 0) // #nosec G115 -- signed by this server
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if now.After(expires) {
+		return ErrPoWExpired
+	}
+	for c, exp := range p.spent {
+		if now.After(exp) {
+			delete(p.spent, c)
+		}
+	}
+	if _, dup := p.spent[challenge]; dup {
+		return ErrPoWSpent
+	}
+	p.spent[challenge] = expires
+	p.recent = append(p.recent, now)
+	return nil
+}
+
+// Solve finds a solution to challenge at difficulty, as a client does.
+func Solve(challenge string, difficulty int) string {
+	for n := uint64(0); ; n++ {
+		solution := strconv.FormatUint(n, 10)
+		if leadingZeroBits(powHash(challenge, solution)) >= difficulty {
+			return solution
+		}
+	}
+}
+
+// powHash is the hash a solution must start with zero bits:
+// SHA-256(challenge ":" solution).
+func powHash(challenge, solution string) []byte {
+	sum := sha256.Sum256([]byte(challenge + ":" + solution))
+	return sum[:]
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
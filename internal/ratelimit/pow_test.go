@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPoW(t *testing.T, base, rate int) *PoW {
+	t.Helper()
+	p, err := NewPoW(base, rate, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func solvedToken(t *testing.T, p *PoW) string {
+	t.Helper()
+	challenge, difficulty, err := p.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge + ":" + Solve(challenge, difficulty)
+}
+
+func TestPoW_SpendOnce(t *testing.T) {
+	p := newTestPoW(t, 8, 10)
+	token := solvedToken(t, p)
+	if err := p.Spend(token); err != nil {
+		t.Fatalf("first spend: %v", err)
+	}
+	if err := p.Spend(token); !errors.Is(err, ErrPoWSpent) {
+		t.Errorf("second spend: %v, want ErrPoWSpent", err)
+	}
+}
+
+func TestPoW_RejectsBadTokens(t *testing.T) {
+	p := newTestPoW(t, 8, 10)
+	challenge, difficulty, err := p.Challenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	solution := Solve(challenge, difficulty)
+	other := newTestPoW(t, 8, 10)
+	forged, _, _ := other.Challenge()
+
+	for name, token := range map[string]string{
+		"no solution":    challenge,
+		"wrong solution": challenge + ":" + solution + "0",
+		"not base64":     "!!!:" + solution,
+		"other server":   forged + ":" + Solve(forged, difficulty),
+		"truncated":      challenge[:20] + ":" + solution,
+	} {
+		if name == "wrong solution" && leadingZeroBits(powHash(challenge, solution+"0")) >= difficulty {
+			continue // solved by chance
+		}
+		if err := p.Spend(token); !errors.Is(err, ErrPoWInvalid) {
+			t.Errorf("%s: %v, want ErrPoWInvalid", name, err)
+		}
+	}
+}
+
+func TestPoW_Expires(t *testing.T) {
+	p := newTestPoW(t, 4, 10)
+	token := solvedToken(t, p)
+	p.now = func() time.Time { return time.Now().Add(PoWChallengeTTL + time.Second) }
+	if err := p.Spend(token); !errors.Is(err, ErrPoWExpired) {
+		t.Errorf("late spend: %v, want ErrPoWExpired", err)
+	}
+}
+
+func TestPoW_DifficultyRisesWithVolume(t *testing.T) {
+	p := newTestPoW(t, 4, 2)
+	for spent, want := range []int{4, 4, 5, 5, 6, 6, 6, 6, 7} {
+		if got := p.Difficulty(); got != want {
+			t.Fatalf("after %d tokens: difficulty %d, want %d", spent, got, want)
+		}
+		if err := p.Spend(solvedToken(t, p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Volume outside the window no longer counts
+	p.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if got := p.Difficulty(); got != 4 {
+		t.Errorf("after the window: difficulty %d, want 4", got)
+	}
+}
+
+func TestNewPoW_Bounds(t *testing.T) {
+	if p := newTestPoW(t, 0, 10); p.Difficulty() != DefaultPoWDifficulty {
+		t.Errorf("default difficulty = %d", p.Difficulty())
+	}
+	for _, bad := range []int{-1, MaxPoWDifficulty + 1} {
+		if _, err := NewPoW(bad, 10, time.Minute); err == nil {
+			t.Errorf("difficulty %d accepted", bad)
+		}
+	}
+}
+
+func TestMiddleware_ProofOfWork(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	p := newTestPoW(t, 4, 10)
+	l.UseProofOfWork(p, func(r *http.Request) bool { return strings.HasPrefix(r.RemoteAddr, "127.") })
+	handler := l.Middleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(addr, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/submit", nil)
+		req.RemoteAddr = addr
+		if token != "" {
+			req.Header.Set(PoWHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	// Without tokens, the shared address is limited as before
+	if do("127.0.0.1:1", "") != http.StatusOK || do("127.0.0.1:2", "") != http.StatusTooManyRequests {
+		t.Fatal("tokenless requests not limited by address")
+	}
+	// A token admits a request past the address limit, once
+	token := solvedToken(t, p)
+	if code := do("127.0.0.1:3", token); code != http.StatusOK {
+		t.Errorf("with token: status %d", code)
+	}
+	if code := do("127.0.0.1:4", token); code != http.StatusTooManyRequests {
+		t.Errorf("spent token: status %d", code)
+	}
+	// Elsewhere, tokens are ignored
+	if do("192.0.2.1:1", "") != http.StatusOK || do("192.0.2.1:2", solvedToken(t, p)) != http.StatusTooManyRequests {
+		t.Error("token used outside where proof of work applies")
+	}
+}
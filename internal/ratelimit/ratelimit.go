@@ -1,18 +1,37 @@
 package ratelimit
 
 import (
+	"fmt"
 	"net"
 	"net/http"
 	"sync"
 	"time"
 )
 
-// Limiter tracks request rates per IP
+// Default prefix lengths clients are aggregated by. A single IPv6 host
+// usually controls a whole /64, so counting addresses would let it rotate
+// past the limit.
+const (
+	DefaultIPv4Prefix = 32
+	DefaultIPv6Prefix = 64
+)
+
+// Limiter tracks request rates per client network: one IPv4 address or one
+// IPv6 /64 by default
 type Limiter struct {
 	mu       sync.RWMutex
 	visitors map[string]*visitor
 	rate     int           // requests
 	window   time.Duration // time window
+
+	v4Mask net.IPMask
+	v6Mask net.IPMask
+
+	// OnReject, if set, is called for each request refused by Middleware.
+	OnReject func(r *http.Request)
+
+	pow        *PoW
+	powApplies func(r *http.Request) bool
 }
 
 type visitor struct {
@@ -34,6 +53,8 @@ func NewLimiter(rateLimit int, window time.Duration) *Limiter {
 		visitors: make(map[string]*visitor),
 		rate:     rateLimit,
 		window:   window,
+		v4Mask:   net.CIDRMask(DefaultIPv4Prefix, 32),
+		v6Mask:   net.CIDRMask(DefaultIPv6Prefix, 128),
 	}
 
 	// Cleanup old visitors periodically
@@ -42,8 +63,58 @@ func NewLimiter(rateLimit int, window time.Duration) *Limiter {
 	return l
 }
 
+// SetPrefixes sets the prefix lengths IPv4 and IPv6 clients are aggregated
+// by; all addresses in one prefix share an allowance. Call it before the
+// limiter is in use.
+func (l *Limiter) SetPrefixes(v4, v6 int) error {
+	if v4 < 1 || v4 > 32 {
+		return fmt.Errorf("IPv4 prefix /%d out of range 1-32", v4)
+	}
+	if v6 < 1 || v6 > 128 {
+		return fmt.Errorf("IPv6 prefix /%d out of range 1-128", v6)
+	}
+	l.v4Mask = net.CIDRMask(v4, 32)
+	l.v6Mask = net.CIDRMask(v6, 128)
+	return nil
+}
+
+// SetRate changes the number of requests each client network may make per
+// window. Counts already made in the current window stand.
+func (l *Limiter) SetRate(rate int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = rate
+}
+
+// UseProofOfWork makes Middleware admit a request for which applies
+// returns true on a proof-of-work token spent with p, instead of counting
+// it against its address. Such a request without a token is counted as
+// before; one with a bad token is refused. Call it before the limiter is
+// in use.
+func (l *Limiter) UseProofOfWork(p *PoW, applies func(r *http.Request) bool) {
+	l.pow, l.powApplies = p, applies
+}
+
+// clientKey returns the network ip is counted under, e.g. "2001:db8::/64".
+// IPv4-mapped IPv6 addresses count as IPv4. Strings that are not addresses
+// are used as they are.
+func (l *Limiter) clientKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	mask := l.v6Mask
+	if v4 := parsed.To4(); v4 != nil {
+		parsed, mask = v4, l.v4Mask
+	}
+	ones, _ := mask.Size()
+	return fmt.Sprintf("%s/%d", parsed.Mask(mask), ones)
+}
+
 // Allow checks if a request from the given IP is allowed
 func (l *Limiter) Allow(ip string) bool {
+	ip = l.clientKey(ip)
+
 	l.mu.Lock()
 	v, exists := l.visitors[ip]
 	if !exists {
@@ -56,6 +127,7 @@ func (l *Limiter) Allow(ip string) bool {
 		}
 		l.visitors[ip] = v
 	}
+	limit := l.rate
 	l.mu.Unlock()
 
 	v.limiter.mu.Lock()
@@ -70,7 +142,7 @@ func (l *Limiter) Allow(ip string) bool {
 	}
 
 	// Check rate limit
-	if v.limiter.requests >= l.rate {
+	if v.limiter.requests >= limit {
 		return false
 	}
 
@@ -79,6 +151,24 @@ func (l *Limiter) Allow(ip string) bool {
 	return true
 }
 
+// Limited returns the number of clients that have used up their allowance
+// in the current window, a rough measure of how hard the limiter is working.
+func (l *Limiter) Limited() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	n := 0
+	for _, v := range l.visitors {
+		v.limiter.mu.Lock()
+		if v.limiter.requests >= l.rate && !now.After(v.limiter.window) {
+			n++
+		}
+		v.limiter.mu.Unlock()
+	}
+	return n
+}
+
 // cleanupVisitors removes stale visitor entries
 func (l *Limiter) cleanupVisitors() {
 	ticker := time.NewTicker(5 * time.Minute)
@@ -104,12 +194,29 @@ func (l *Limiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
 			ip = r.RemoteAddr
 		}
 
+		// A token is the request's budget, whatever its address
+		if token := r.Header.Get(PoWHeader); token != "" && l.pow != nil && l.powApplies(r) {
+			if err := l.pow.Spend(token); err != nil {
+				l.reject(w, r)
+				return
+			}
+			next(w, r)
+			return
+		}
+
 		// Check rate limit
 		if !l.Allow(ip) {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			l.reject(w, r)
 			return
 		}
 
 		next(w, r)
 	}
 }
+
+func (l *Limiter) reject(w http.ResponseWriter, r *http.Request) {
+	if l.OnReject != nil {
+		l.OnReject(r)
+	}
+	http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+}
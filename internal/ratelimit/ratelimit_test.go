@@ -149,3 +149,121 @@ func TestMiddleware_IPWithoutPort(t *testing.T) {
 		t.Fatal("handler should be called even without port in RemoteAddr")
 	}
 }
+
+func TestMiddleware_OnReject(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	rejected := 0
+	l.OnReject = func(r *http.Request) { rejected++ }
+
+	handler := l.Middleware(func(w http.ResponseWriter, r *http.Request) {})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:12345"
+	for i := 0; i < 3; i++ {
+		handler(httptest.NewRecorder(), req)
+	}
+	if rejected != 2 {
+		t.Errorf("OnReject called %d times, want 2", rejected)
+	}
+}
+
+func TestLimited(t *testing.T) {
+	l := NewLimiter(2, time.Minute)
+	l.Allow("10.0.0.1")
+	l.Allow("10.0.0.1")
+	l.Allow("10.0.0.2")
+
+	if got := l.Limited(); got != 1 {
+		t.Errorf("Limited() = %d, want 1", got)
+	}
+}
+
+func TestAllow_IPv6PrefixAggregation(t *testing.T) {
+	l := NewLimiter(2, time.Minute)
+	// Rotating through one /64 shares a single allowance
+	l.Allow("2001:db8:1:2::1")
+	l.Allow("2001:db8:1:2:ffff::9")
+	if l.Allow("2001:db8:1:2:abcd::42") {
+		t.Error("addresses in the same /64 should share the limit")
+	}
+	// A neighbouring /64 has its own
+	if !l.Allow("2001:db8:1:3::1") {
+		t.Error("a different /64 should not be limited")
+	}
+}
+
+func TestAllow_MixedFamilies(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	if !l.Allow("192.0.2.1") || !l.Allow("192.0.2.2") {
+		t.Error("IPv4 addresses are limited individually by default")
+	}
+	// An IPv4-mapped IPv6 address is the same client as its IPv4 form
+	if l.Allow("::ffff:192.0.2.1") {
+		t.Error("IPv4-mapped address should share the IPv4 allowance")
+	}
+	if !l.Allow("2001:db8::1") {
+		t.Error("IPv6 client should have its own allowance")
+	}
+	if l.Allow("2001:db8::2") {
+		t.Error("second IPv6 address in the same /64 should be limited")
+	}
+}
+
+func TestSetPrefixes(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	if err := l.SetPrefixes(24, 48); err != nil {
+		t.Fatal(err)
+	}
+	l.Allow("198.51.100.7")
+	if l.Allow("198.51.100.200") {
+		t.Error("addresses in the same /24 should share the limit")
+	}
+	l.Allow("2001:db8:aa:1::1")
+	if l.Allow("2001:db8:aa:ff::1") {
+		t.Error("addresses in the same /48 should share the limit")
+	}
+	if !l.Allow("2001:db8:ab::1") {
+		t.Error("a different /48 should not be limited")
+	}
+
+	for _, p := range [][2]int{{0, 64}, {33, 64}, {32, 0}, {32, 129}} {
+		if err := l.SetPrefixes(p[0], p[1]); err == nil {
+			t.Errorf("SetPrefixes(%d, %d) should fail", p[0], p[1])
+		}
+	}
+}
+
+func TestMiddleware_IPv6RemoteAddr(t *testing.T) {
+	l := NewLimiter(1, time.Minute)
+	handler := l.Middleware(func(w http.ResponseWriter, r *http.Request) {})
+
+	for i, addr := range []string{"[2001:db8::1]:4000", "[2001:db8::2]:4001"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		want := http.StatusOK
+		if i > 0 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("%s: status = %d, want %d", addr, rec.Code, want)
+		}
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	l := NewLimiter(2, time.Minute)
+	l.Allow("1.2.3.4")
+	l.Allow("1.2.3.4")
+	if l.Allow("1.2.3.4") {
+		t.Fatal("3rd request should be blocked at a rate of 2")
+	}
+	l.SetRate(3)
+	if !l.Allow("1.2.3.4") {
+		t.Fatal("3rd request should be allowed once the rate is 3")
+	}
+	l.SetRate(1)
+	if !l.Allow("5.6.7.8") || l.Allow("5.6.7.8") {
+		t.Fatal("a new client should get one request at a rate of 1")
+	}
+}
@@ -0,0 +1,241 @@
+// Package sealedlog keeps an append-only file of records, one JSON value per
+// line sealed with AES-GCM as base64(nonce || ciphertext).
+//
+// The incident and usage statistics logs are both kept this way; each binds
+// its lines to its own use of the key with a distinct additional data string,
+// so that a line cannot be moved from one log to the other.
+package sealedlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// KeyFunc returns the key used to seal the log. It may fail, for instance
+// while storage is locked.
+type KeyFunc func() ([]byte, error)
+
+// Log is a sealed log of records of type T.
+type Log[T any] struct {
+	path string
+	name string // for errors, such as "incident log"
+	aad  []byte
+	key  KeyFunc
+
+	mu sync.Mutex // serializes access to the file
+}
+
+// New returns the log at path, sealed with keys from key and bound to aad.
+// name describes the log in errors.
+func New[T any](path, name string, aad []byte, key KeyFunc) *Log[T] {
+	return &Log[T]{path: path, name: name, aad: aad, key: key}
+}
+
+// Append seals records and adds them to the end of the log.
+func (l *Log[T]) Append(records []T) error {
+	key, err := l.key()
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+
+	data, err := l.seal(key, records)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) // #nosec G304 -- path from config
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", l.name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write %s: %w", l.name, err)
+	}
+	return f.Close()
+}
+
+// Read returns every record in the log, in the order appended. A log that
+// does not exist yet holds none.
+func (l *Log[T]) Read() ([]T, error) {
+	key, err := l.key()
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.read(key)
+}
+
+// Prune removes the records keep rejects and returns how many were removed.
+func (l *Log[T]) Prune(keep func(T) bool) (int, error) {
+	key, err := l.key()
+	if err != nil {
+		return 0, err
+	}
+	defer zero(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.read(key)
+	if err != nil {
+		return 0, err
+	}
+	kept := records[:0]
+	for _, r := range records {
+		if keep(r) {
+			kept = append(kept, r)
+		}
+	}
+	removed := len(records) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+	if err := l.rewrite(key, kept); err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
+
+// Rekey re-seals the whole log under newKey, for use after the storage
+// encryption key has been rotated. The log's own key must still open it.
+func (l *Log[T]) Rekey(newKey []byte) error {
+	key, err := l.key()
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.read(key)
+	if err != nil || records == nil {
+		return err
+	}
+	return l.rewrite(newKey, records)
+}
+
+// rewrite replaces the log with records sealed under key. It writes beside
+// the original and renames so a crash cannot truncate it. The caller holds mu.
+func (l *Log[T]) rewrite(key []byte, records []T) error {
+	data, err := l.seal(key, records)
+	if err != nil {
+		return err
+	}
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", l.name, err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// read decrypts every line of the log. The caller holds mu.
+func (l *Log[T]) read(key []byte) ([]T, error) {
+	f, err := os.Open(l.path) // #nosec G304 -- path from config
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	var records []T
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		r, err := l.open(gcm, line)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", l.name, n, err)
+		}
+		records = append(records, r)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", l.name, err)
+	}
+	return records, nil
+}
+
+// seal encrypts records as lines of base64(nonce || ciphertext).
+func (l *Log[T]) seal(key []byte, records []T) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, r := range records {
+		plaintext, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		sealed := gcm.Seal(nonce, nonce, plaintext, l.aad)
+		zero(plaintext)
+		line := make([]byte, base64.StdEncoding.EncodedLen(len(sealed)))
+		base64.StdEncoding.Encode(line, sealed)
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (l *Log[T]) open(gcm cipher.AEAD, line []byte) (T, error) {
+	var r T
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, line)
+	if err != nil {
+		return r, err
+	}
+	sealed = sealed[:n]
+	if len(sealed) < gcm.NonceSize() {
+		return r, fmt.Errorf("truncated entry")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], l.aad)
+	if err != nil {
+		return r, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	err = json.Unmarshal(plaintext, &r)
+	zero(plaintext)
+	return r, err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,88 @@
+package sealedlog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type record struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func keyOf(b byte) KeyFunc {
+	return func() ([]byte, error) { return bytes.Repeat([]byte{b}, 32), nil }
+}
+
+func TestLog_AppendReadPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	l := New[record](path, "test log", []byte("test"), keyOf(7))
+
+	if records, err := l.Read(); err != nil || records != nil {
+		t.Fatalf("missing log: %v, %v; want no records", records, err)
+	}
+	if err := l.Append([]record{{"a", 1}, {"b", 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append([]record{{"c", 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte("\n")) != 3 || bytes.Contains(data, []byte("count")) {
+		t.Errorf("log = %q, want three sealed lines", data)
+	}
+
+	removed, err := l.Prune(func(r record) bool { return r.Count != 2 })
+	if err != nil || removed != 1 {
+		t.Fatalf("Prune = %d, %v; want 1 removed", removed, err)
+	}
+	records, err := l.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(records, []record{{"a", 1}, {"c", 3}}) {
+		t.Errorf("records = %+v", records)
+	}
+}
+
+func TestLog_BoundToAAD(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := New[record](path, "test log", []byte("one"), keyOf(7)).Append([]record{{"a", 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New[record](path, "test log", []byte("two"), keyOf(7)).Read(); err == nil {
+		t.Error("a line sealed for one log should not open as another")
+	}
+}
+
+func TestLog_Rekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	l := New[record](path, "test log", []byte("test"), keyOf(7))
+	if err := l.Rekey(bytes.Repeat([]byte{9}, 32)); err != nil {
+		t.Fatalf("Rekey of a missing log: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Rekey should not create a missing log")
+	}
+
+	if err := l.Append([]record{{"a", 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rekey(bytes.Repeat([]byte{9}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Read(); err == nil {
+		t.Error("old key should no longer open the log")
+	}
+	records, err := New[record](path, "test log", []byte("test"), keyOf(9)).Read()
+	if err != nil || len(records) != 1 || records[0].Name != "a" {
+		t.Errorf("records under the new key = %+v, %v", records, err)
+	}
+}
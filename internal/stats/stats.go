@@ -0,0 +1,225 @@
+// Package stats keeps an encrypted record of hourly usage totals
+// (submissions, retrievals, rejections, and bytes) for longitudinal
+// reporting without a metrics server.
+//
+// No event is recorded on its own: counts are summed per hour in memory, and
+// each hour is appended to the log only once it has ended, as one sealed line
+// (see sealedlog) with its byte totals rounded up to whole mebibytes.
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/sealedlog"
+)
+
+// byteUnit is what byte totals are rounded up to, so that the size of a
+// lone upload in a quiet hour is not recorded exactly.
+const byteUnit = 1 << 20
+
+// maxPending bounds the hours held between flushes, so that a long spell
+// with storage locked cannot exhaust memory. Later hours go uncounted.
+const maxPending = 1024
+
+// aad binds log lines to this use of the key.
+var aad = []byte("dead-drop-stats")
+
+// Bucket holds the totals for one hour.
+type Bucket struct {
+	Time           time.Time `json:"time"` // start of the hour
+	Submissions    int       `json:"submissions"`
+	Retrievals     int       `json:"retrievals"`
+	Rejections     int       `json:"rejections"`      // uploads refused
+	BytesSubmitted int64     `json:"bytes_submitted"` // rounded up to whole MiB
+	BytesRetrieved int64     `json:"bytes_retrieved"` // rounded up to whole MiB
+}
+
+func (b *Bucket) add(o Bucket) {
+	b.Submissions += o.Submissions
+	b.Retrievals += o.Retrievals
+	b.Rejections += o.Rejections
+	b.BytesSubmitted += o.BytesSubmitted
+	b.BytesRetrieved += o.BytesRetrieved
+}
+
+// rounded returns b with its byte totals rounded up to byteUnit.
+func (b Bucket) rounded() Bucket {
+	b.BytesSubmitted = roundBytes(b.BytesSubmitted)
+	b.BytesRetrieved = roundBytes(b.BytesRetrieved)
+	return b
+}
+
+func roundBytes(n int64) int64 {
+	return (n + byteUnit - 1) / byteUnit * byteUnit
+}
+
+// KeyFunc returns the key used to seal the log. It may fail, for instance
+// while storage is locked, in which case totals stay pending.
+type KeyFunc = sealedlog.KeyFunc
+
+// Store records hourly totals to an encrypted log file.
+type Store struct {
+	path string
+	log  *sealedlog.Log[Bucket]
+	now  func() time.Time
+
+	mu      sync.Mutex
+	pending map[int64]*Bucket // hour -> exact totals
+}
+
+// New returns a store logging to path with keys from key.
+func New(path string, key KeyFunc) *Store {
+	return &Store{
+		path:    path,
+		log:     sealedlog.New[Bucket](path, "stats log", aad, key),
+		now:     time.Now,
+		pending: make(map[int64]*Bucket),
+	}
+}
+
+// AddSubmission counts a stored upload of n bytes.
+func (s *Store) AddSubmission(n int64) {
+	s.count(func(b *Bucket) {
+		b.Submissions++
+		b.BytesSubmitted += n
+	})
+}
+
+// AddRetrieval counts a download of a drop of n bytes.
+func (s *Store) AddRetrieval(n int64) {
+	s.count(func(b *Bucket) {
+		b.Retrievals++
+		b.BytesRetrieved += n
+	})
+}
+
+// AddRejection counts a refused upload.
+func (s *Store) AddRejection() {
+	s.count(func(b *Bucket) { b.Rejections++ })
+}
+
+// count applies f to the current hour's totals. It never blocks on disk.
+func (s *Store) count(f func(*Bucket)) {
+	hour := s.now().UTC().Truncate(time.Hour).Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.pending[hour]
+	if !ok {
+		if len(s.pending) >= maxPending {
+			return
+		}
+		b = &Bucket{Time: time.Unix(hour, 0).UTC()}
+		s.pending[hour] = b
+	}
+	f(b)
+}
+
+// Flush appends the totals of hours that have ended to the log. If the key
+// is unavailable they stay pending and the error is returned.
+func (s *Store) Flush() error {
+	return s.flush(s.now().UTC().Truncate(time.Hour))
+}
+
+// FlushAll appends every pending total to the log, including the hour under
+// way, for use at shutdown.
+func (s *Store) FlushAll() error {
+	return s.flush(time.Unix(1<<62, 0))
+}
+
+// flush appends the pending totals of hours before the given one.
+func (s *Store) flush(before time.Time) error {
+	s.mu.Lock()
+	var done []Bucket
+	for hour, b := range s.pending {
+		if b.Time.Before(before) {
+			done = append(done, *b)
+			delete(s.pending, hour)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(done) == 0 {
+		return nil
+	}
+
+	err := s.append(done)
+	if err != nil {
+		// Put the totals back, merging with any counted meanwhile
+		s.mu.Lock()
+		for _, d := range done {
+			hour := d.Time.Unix()
+			if b, ok := s.pending[hour]; ok {
+				b.add(d)
+			} else if len(s.pending) < maxPending {
+				s.pending[hour] = &d
+			}
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Store) append(buckets []Bucket) error {
+	sortBuckets(buckets)
+	for i := range buckets {
+		buckets[i] = buckets[i].rounded()
+	}
+	return s.log.Append(buckets)
+}
+
+// Buckets flushes the hours that have ended and returns the totals of every
+// such hour at or after since, oldest first. The hour under way is left out,
+// even where shutdown wrote part of it, so that no partial total is reported.
+func (s *Store) Buckets(since time.Time) ([]Bucket, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	logged, err := s.log.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	current := s.now().UTC().Truncate(time.Hour)
+	merged := make(map[int64]*Bucket)
+	for _, b := range logged {
+		if b.Time.Before(since) || !b.Time.Before(current) {
+			continue
+		}
+		if m, ok := merged[b.Time.Unix()]; ok {
+			m.add(b)
+		} else {
+			merged[b.Time.Unix()] = &b
+		}
+	}
+	buckets := make([]Bucket, 0, len(merged))
+	for _, b := range merged {
+		buckets = append(buckets, *b)
+	}
+	return sortBuckets(buckets), nil
+}
+
+// Prune removes hours older than maxAge from the log and returns how many
+// lines were removed.
+func (s *Store) Prune(maxAge time.Duration) (int, error) {
+	cutoff := s.now().Add(-maxAge)
+	return s.log.Prune(func(b Bucket) bool {
+		return !b.Time.Add(time.Hour).Before(cutoff)
+	})
+}
+
+// Rekey re-seals the whole log under newKey, for use after the storage
+// encryption key has been rotated. The store's own key must still open it.
+func (s *Store) Rekey(newKey []byte) error {
+	return s.log.Rekey(newKey)
+}
+
+func sortBuckets(buckets []Bucket) []Bucket {
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Time.Before(buckets[j].Time)
+	})
+	return buckets
+}
@@ -0,0 +1,154 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T) (*Store, *bool) {
+	t.Helper()
+	locked := false
+	key := bytes.Repeat([]byte{7}, 32)
+	s := New(filepath.Join(t.TempDir(), "stats"), func() ([]byte, error) {
+		if locked {
+			return nil, errors.New("locked")
+		}
+		return append([]byte(nil), key...), nil
+	})
+	return s, &locked
+}
+
+func TestStore_CountFlushBuckets(t *testing.T) {
+	s, _ := testStore(t)
+	at := time.Date(2026, 3, 1, 10, 25, 0, 0, time.UTC)
+	s.now = func() time.Time { return at }
+
+	s.AddSubmission(1000)
+	s.AddSubmission(3 << 20)
+	s.AddRejection()
+	s.AddRetrieval(10)
+
+	// The hour under way is not written yet
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.path); !os.IsNotExist(err) {
+		t.Errorf("log written before the hour ended: %v", err)
+	}
+
+	at = at.Add(time.Hour)
+	s.AddSubmission(5)
+	buckets, err := s.Buckets(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 {
+		t.Fatalf("got %d buckets, want only the hour that ended: %+v", len(buckets), buckets)
+	}
+	want := Bucket{
+		Time:           time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+		Submissions:    2,
+		Retrievals:     1,
+		Rejections:     1,
+		BytesSubmitted: 4 << 20,
+		BytesRetrieved: 1 << 20,
+	}
+	if buckets[0] != want {
+		t.Errorf("first hour = %+v, want %+v", buckets[0], want)
+	}
+
+	// Nothing readable on disk
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("submissions")) {
+		t.Error("stats log should be encrypted")
+	}
+
+	if err := s.FlushAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.pending) != 0 {
+		t.Errorf("pending after FlushAll = %d hours", len(s.pending))
+	}
+	if buckets, err := s.Buckets(time.Time{}); err != nil || len(buckets) != 1 {
+		t.Errorf("Buckets after FlushAll = %+v, %v; want the hour under way left out", buckets, err)
+	}
+
+	at = at.Add(time.Hour)
+	buckets, err = s.Buckets(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 || buckets[1].Submissions != 1 || buckets[1].BytesSubmitted != 1<<20 {
+		t.Errorf("buckets once the hour ended = %+v, want one submission in the second", buckets)
+	}
+}
+
+func TestStore_PendingWhileLocked(t *testing.T) {
+	s, locked := testStore(t)
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return at }
+	s.AddRejection()
+	at = at.Add(time.Hour)
+
+	*locked = true
+	if err := s.Flush(); err == nil {
+		t.Fatal("Flush should fail while locked")
+	}
+	s.now = func() time.Time { return at.Add(-time.Minute) }
+	s.AddRejection()
+	s.now = func() time.Time { return at }
+
+	*locked = false
+	buckets, err := s.Buckets(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 1 || buckets[0].Rejections != 2 {
+		t.Errorf("buckets = %+v, want the rejections counted while locked", buckets)
+	}
+}
+
+func TestStore_PruneRekey(t *testing.T) {
+	s, _ := testStore(t)
+	now := time.Now()
+	s.now = func() time.Time { return now.Add(-48 * time.Hour) }
+	s.AddSubmission(1)
+	s.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	s.AddRetrieval(1)
+	s.now = func() time.Time { return now }
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed = %d, want 1", removed)
+	}
+
+	newKey := bytes.Repeat([]byte{9}, 32)
+	if err := s.Rekey(newKey); err != nil {
+		t.Fatalf("Rekey error: %v", err)
+	}
+	if _, err := s.Buckets(time.Time{}); err == nil {
+		t.Error("old key should no longer open the log")
+	}
+
+	rekeyed := New(s.path, func() ([]byte, error) { return append([]byte(nil), newKey...), nil })
+	buckets, err := rekeyed.Buckets(time.Time{})
+	if err != nil {
+		t.Fatalf("Buckets with new key: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Retrievals != 1 {
+		t.Errorf("buckets after prune and rekey = %+v", buckets)
+	}
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+const (
+	// KeyBundleVersion is the current key bundle format version.
+	KeyBundleVersion = 1
+
+	saltFileName       = ".master.salt"
+	encryptionKeyFile  = ".encryption.key"
+	receiptKeyFile     = ".receipt.key"
+	recipientsFileName = ".recipients.json"
+)
+
+// ErrKeysExist is returned when importing a key bundle into a storage
+// directory that already holds different key material.
+var ErrKeysExist = errors.New("storage directory already contains different key material")
+
+// Recipient is a named age X25519 recipient ("age1...") that drops can be
+// sealed to. The matching identity never leaves the machine that generated
+// it.
+type Recipient struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// KeyBundle holds the server's key material generated offline. The
+// encryption and receipt keys are wrapped with the master key derived from
+// the operator's passphrase and Salt, exactly as they are stored on disk.
+type KeyBundle struct {
+	Version       int         `json:"version"`
+	Created       time.Time   `json:"created"`
+	Salt          []byte      `json:"salt"`
+	EncryptionKey []byte      `json:"encryption_key"`
+	ReceiptKey    []byte      `json:"receipt_key"`
+	Recipients    []Recipient `json:"recipients,omitempty"`
+}
+
+// GenerateKeyBundle creates a fresh salt, encryption key, and receipt key
+// wrapped to the master key derived from passphrase, plus an age X25519
+// identity for each named recipient. The identities are returned by name and
+// are not part of the bundle.
+func GenerateKeyBundle(passphrase string, recipients []string) (*KeyBundle, map[string]*age.X25519Identity, error) {
+	if passphrase == "" {
+		return nil, nil, fmt.Errorf("master passphrase is required")
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	masterKey := crypto.DeriveMasterKey(passphrase, salt)
+	defer crypto.ZeroBytes(masterKey)
+
+	bundle := &KeyBundle{
+		Version: KeyBundleVersion,
+		Created: time.Now().UTC(),
+		Salt:    salt,
+	}
+
+	var err error
+	if bundle.EncryptionKey, err = generateWrappedKey(masterKey, []byte("encryption-key")); err != nil {
+		return nil, nil, err
+	}
+	if bundle.ReceiptKey, err = generateWrappedKey(masterKey, []byte("receipt-key")); err != nil {
+		return nil, nil, err
+	}
+
+	private := make(map[string]*age.X25519Identity, len(recipients))
+	for _, name := range recipients {
+		if name == "" {
+			return nil, nil, fmt.Errorf("recipient name must not be empty")
+		}
+		if _, dup := private[name]; dup {
+			return nil, nil, fmt.Errorf("duplicate recipient %q", name)
+		}
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recipient key: %w", err)
+		}
+		private[name] = id
+		bundle.Recipients = append(bundle.Recipients, Recipient{
+			Name:      name,
+			PublicKey: id.Recipient().String(),
+		})
+	}
+
+	return bundle, private, nil
+}
+
+func generateWrappedKey(masterKey, purpose []byte) ([]byte, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	defer crypto.ZeroBytes(key)
+
+	wrapped, err := crypto.EncryptKeyFile(masterKey, key, purpose)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// LoadKeyBundle reads a key bundle from path.
+func LoadKeyBundle(path string) (*KeyBundle, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- bundle path from operator config
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key bundle: %w", err)
+	}
+	var bundle KeyBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse key bundle: %w", err)
+	}
+	if bundle.Version != KeyBundleVersion {
+		return nil, fmt.Errorf("unsupported key bundle version %d", bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// Save writes the bundle to path with owner-only permissions.
+func (b *KeyBundle) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode key bundle: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key bundle: %w", err)
+	}
+	return nil
+}
+
+// Import installs the bundle's key material into storageDir. The passphrase
+// must unwrap both keys before anything is written. Importing into a
+// directory that already holds the same keys is a no-op, so the bundle can
+// stay configured after first start; differing keys return ErrKeysExist.
+// It reports whether any files were written.
+func (b *KeyBundle) Import(storageDir, passphrase string) (bool, error) {
+	masterKey := crypto.DeriveMasterKey(passphrase, b.Salt)
+	defer crypto.ZeroBytes(masterKey)
+
+	for _, k := range []struct {
+		data    []byte
+		purpose string
+	}{
+		{b.EncryptionKey, "encryption-key"},
+		{b.ReceiptKey, "receipt-key"},
+	} {
+		key, err := crypto.DecryptKeyFile(masterKey, k.data, []byte(k.purpose))
+		if err != nil {
+			return false, fmt.Errorf("key bundle does not match master passphrase: %w", err)
+		}
+		crypto.ZeroBytes(key)
+	}
+
+	files := map[string][]byte{
+		saltFileName:      b.Salt,
+		encryptionKeyFile: b.EncryptionKey,
+		receiptKeyFile:    b.ReceiptKey,
+	}
+	if len(b.Recipients) > 0 {
+		data, err := json.MarshalIndent(b.Recipients, "", "  ")
+		if err != nil {
+			return false, fmt.Errorf("failed to encode recipients: %w", err)
+		}
+		files[recipientsFileName] = data
+	}
+
+	existing := 0
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(storageDir, name)) // #nosec G304 -- fixed names inside storage dir
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to check %s: %w", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			return false, ErrKeysExist
+		}
+		existing++
+	}
+	if existing == len(files) {
+		return false, nil
+	}
+
+	if err := os.MkdirAll(storageDir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(storageDir, name), data, 0600); err != nil {
+			return false, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return true, nil
+}
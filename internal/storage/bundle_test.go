@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestGenerateKeyBundle_ImportAndUse(t *testing.T) {
+	bundle, private, err := GenerateKeyBundle("ceremony-pass", []string{"editor"})
+	if err != nil {
+		t.Fatalf("GenerateKeyBundle error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.json")
+	if err := bundle.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKeyBundle(path)
+	if err != nil {
+		t.Fatalf("LoadKeyBundle error: %v", err)
+	}
+
+	dir := t.TempDir()
+	imported, err := loaded.Import(dir, "ceremony-pass")
+	if err != nil {
+		t.Fatalf("Import error: %v", err)
+	}
+	if !imported {
+		t.Error("first import should write key files")
+	}
+
+	// The server derives the master key from the imported salt as usual
+	salt, err := crypto.LoadOrGenerateSalt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(salt, bundle.Salt) {
+		t.Error("imported salt should be used")
+	}
+	m, err := NewManager(dir, crypto.DeriveMasterKey("ceremony-pass", salt))
+	if err != nil {
+		t.Fatalf("NewManager with imported keys: %v", err)
+	}
+	defer m.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, encryptionKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, bundle.EncryptionKey) {
+		t.Error("NewManager should keep the imported encryption key")
+	}
+
+	// Recipient public key matches the identity kept offline
+	if private["editor"].Recipient().String() != bundle.Recipients[0].PublicKey {
+		t.Error("recipient public key does not match private key")
+	}
+	if _, err := os.Stat(filepath.Join(dir, recipientsFileName)); err != nil {
+		t.Errorf("recipients should be imported: %v", err)
+	}
+}
+
+func TestKeyBundle_ImportIdempotent(t *testing.T) {
+	bundle, _, err := GenerateKeyBundle("pass", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := bundle.Import(dir, "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := bundle.Import(dir, "pass")
+	if err != nil {
+		t.Fatalf("re-import error: %v", err)
+	}
+	if imported {
+		t.Error("re-import of identical keys should be a no-op")
+	}
+}
+
+func TestKeyBundle_ImportRefusesDifferentKeys(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	bundle, _, err := GenerateKeyBundle("pass", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle.Import(dir, "pass"); !errors.Is(err, ErrKeysExist) {
+		t.Errorf("Import error = %v, want ErrKeysExist", err)
+	}
+}
+
+func TestKeyBundle_ImportWrongPassphrase(t *testing.T) {
+	bundle, _, err := GenerateKeyBundle("right", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if _, err := bundle.Import(dir, "wrong"); err == nil {
+		t.Fatal("Import should fail with the wrong passphrase")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Errorf("nothing should be written on failure, found %d entries", len(entries))
+	}
+}
+
+func TestGenerateKeyBundle_RejectsBadInput(t *testing.T) {
+	if _, _, err := GenerateKeyBundle("", nil); err == nil {
+		t.Error("empty passphrase should be rejected")
+	}
+	if _, _, err := GenerateKeyBundle("pass", []string{"a", "a"}); err == nil {
+		t.Error("duplicate recipients should be rejected")
+	}
+}
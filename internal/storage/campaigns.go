@@ -0,0 +1,57 @@
+package storage
+
+import "time"
+
+// CampaignCount is the number of drops submitted under a campaign and their
+// stored size.
+type CampaignCount struct {
+	Drops int   `json:"drops"`
+	Bytes int64 `json:"bytes"`
+}
+
+// CampaignCounts returns drop counts and stored bytes per campaign code,
+// read from the encrypted index rather than each drop's metadata. Drops
+// submitted without a campaign are counted under "". Honeypots are left
+// out.
+func (m *Manager) CampaignCounts() (map[string]CampaignCount, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	counts := make(map[string]CampaignCount)
+	err := m.eachIndexed(func(_ string, e expiryEntry) {
+		if e.Honeypot {
+			return
+		}
+		c := counts[e.Campaign]
+		c.Drops++
+		c.Bytes += e.Size
+		counts[e.Campaign] = c
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// CampaignDropsSince returns how many drops submitted under campaign and
+// received at or after since are still stored, from the encrypted index.
+// Honeypots are left out.
+func (m *Manager) CampaignDropsSince(campaign string, since time.Time) (int, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return 0, ErrLocked
+	}
+
+	n := 0
+	err := m.eachIndexed(func(_ string, e expiryEntry) {
+		if e.Campaign == campaign && !e.Honeypot && e.Hour >= since.Unix() {
+			n++
+		}
+	})
+	return n, err
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCampaignCounts(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	save := func(data string, opts *SaveOptions) *Drop {
+		t.Helper()
+		drop, err := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte(data)), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return drop
+	}
+	a := save("first", &SaveOptions{Campaign: "payroll"})
+	save("second!", &SaveOptions{Campaign: "payroll"})
+	save("third", nil)
+	save("decoy", &SaveOptions{Honeypot: true})
+
+	counts, err := m.CampaignCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBytes := dataFileSize(m.dropDir(a.ID)) * 2
+	if got := counts["payroll"]; got.Drops != 2 || got.Bytes != wantBytes+2 {
+		t.Errorf("payroll = %+v, want 2 drops of %d bytes", got, wantBytes+2)
+	}
+	if got := counts[""]; got.Drops != 1 {
+		t.Errorf("no campaign = %+v, want 1 drop (honeypot excluded)", got)
+	}
+
+	if err := m.DeleteDrop(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if counts, _ := m.CampaignCounts(); counts["payroll"].Drops != 1 {
+		t.Errorf("after delete, payroll = %+v, want 1 drop", counts["payroll"])
+	}
+}
+
+func TestCampaignCounts_RefreshesOldIndex(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("data")), &SaveOptions{Campaign: "leaks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An index written before campaigns and sizes were recorded
+	if err := m.loadExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+	m.expiry.set(drop.ID, expiryEntry{Hour: time.Now().Unix()})
+	if err := m.saveExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewManager(m.StorageDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close()
+	counts, err := m2.CampaignCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts["leaks"]; got.Drops != 1 || got.Bytes == 0 {
+		t.Errorf("leaks = %+v, want 1 drop with its size", got)
+	}
+}
+
+func TestCampaignDropsSince(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	for _, opts := range []*SaveOptions{{Campaign: "tips"}, {Campaign: "tips"}, {Campaign: "other"}, {Campaign: "tips", Honeypot: true}} {
+		if _, err := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("data")), opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := m.CampaignDropsSince("tips", time.Now().Add(-time.Hour)); err != nil || n != 2 {
+		t.Errorf("recent tips drops = %d, %v; want 2", n, err)
+	}
+	if n, _ := m.CampaignDropsSince("tips", time.Now().Add(2*time.Hour)); n != 0 {
+		t.Errorf("tips drops after a later start = %d, want 0", n)
+	}
+}
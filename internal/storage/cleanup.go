@@ -2,13 +2,23 @@ package storage
 
 import (
 	"crypto/rand"
+	"errors"
 	"log"
 	"math/big"
-	"os"
-	"strings"
 	"time"
 )
 
+// errPendingReview reports an expired drop whose retention class keeps it
+// until an operator reviews and deletes it.
+var errPendingReview = errors.New("expired drop pinned for review")
+
+// RetentionClass holds the rules for drops assigned to a retention class.
+type RetentionClass struct {
+	MaxAge        time.Duration // 0 = never expires
+	BurnAfterRead bool          // deleted after the first retrieval
+	PinnedReview  bool          // kept past MaxAge until deleted by an operator
+}
+
 // CleanupConfig holds cleanup settings
 type CleanupConfig struct {
 	MaxAge           time.Duration
@@ -18,12 +28,21 @@ type CleanupConfig struct {
 
 // StartCleanup begins periodic cleanup of expired drops with random jitter
 // to prevent timing analysis. Each cycle sleeps for the check interval
-// plus a random jitter of +/- 10 minutes.
+// plus a random jitter of +/- 10 minutes. Close stops it, waiting for a
+// pass in progress to finish. It must be called at most once.
 func (m *Manager) StartCleanup(config CleanupConfig) {
+	m.cleanupStop = make(chan struct{})
+	m.cleanupDone.Add(1)
 	go func() {
+		defer m.cleanupDone.Done()
 		for {
-			sleep := config.CheckInterval + cleanupJitter()
-			time.Sleep(sleep)
+			timer := time.NewTimer(config.CheckInterval + cleanupJitter())
+			select {
+			case <-timer.C:
+			case <-m.cleanupStop:
+				timer.Stop()
+				return
+			}
 			if err := m.cleanupExpiredDrops(config.MaxAge); err != nil {
 				log.Printf("Cleanup error: %v", err)
 			}
@@ -41,43 +60,66 @@ func cleanupJitter() time.Duration {
 	return time.Duration(n.Int64()-10*60) * time.Second
 }
 
-// cleanupExpiredDrops removes drops older than maxAge
+// cleanupExpiredDrops runs one cleanup pass for the periodic cleanup.
 func (m *Manager) cleanupExpiredDrops(maxAge time.Duration) error {
-	entries, err := os.ReadDir(m.StorageDir)
-	if err != nil {
-		return err
-	}
+	_, err := m.Cleanup(maxAge)
+	return err
+}
 
+// Cleanup removes drops older than their retention class allows, or older
+// than maxAge for drops without a class, and returns how many it deleted. A
+// maxAge of zero keeps classless drops indefinitely. It runs one pass
+// immediately, for operators; StartCleanup schedules passes.
+func (m *Manager) Cleanup(maxAge time.Duration) (int, error) {
 	now := time.Now()
 	deletedCount := 0
+	pendingReview := 0
 
-	for _, entry := range entries {
-		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
-
-		dropID := entry.Name()
-
-		// Skip protected drops (e.g., honeypots)
-		if m.IsProtected != nil && m.IsProtected(dropID) {
-			continue
-		}
+	candidates, err := m.cleanupCandidates(maxAge, now)
+	if err != nil {
+		return 0, err
+	}
 
+	for _, dropID := range candidates {
 		// Atomically check expiry and delete under a single write lock
 		// to prevent TOCTOU races with concurrent retrievals
 		deleted, err := m.deleteIfExpired(dropID, maxAge, now)
-		if err != nil {
+		if errors.Is(err, errPendingReview) {
+			pendingReview++
+		} else if err != nil {
 			log.Printf("Failed to delete expired drop %s: %v", dropID, err)
 		} else if deleted {
 			deletedCount++
 		}
 	}
 
+	m.keyMu.RLock()
+	if m.EncryptionKey != nil {
+		if err := m.saveExpiryIndex(); err != nil {
+			log.Printf("Failed to save expiry index: %v", err)
+		}
+	}
+	m.keyMu.RUnlock()
+
 	if deletedCount > 0 {
 		log.Printf("Cleaned up %d expired drops", deletedCount)
 	}
+	if pendingReview > 0 {
+		log.Printf("%d expired drops awaiting retention review", pendingReview)
+	}
 
-	return nil
+	return deletedCount, nil
+}
+
+// cleanupCandidates returns the drops the expiry index says are due, or none
+// while the manager is locked.
+func (m *Manager) cleanupCandidates(maxAge time.Duration, now time.Time) ([]string, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, nil
+	}
+	return m.expiryCandidates(maxAge, now)
 }
 
 // GetDropAge returns the age of a drop
@@ -94,3 +136,16 @@ func (m *Manager) GetDropAge(id string) (time.Duration, error) {
 	dropTime := time.Unix(payload.TimestampHour, 0)
 	return time.Since(dropTime), nil
 }
+
+// BurnAfterRead reports whether the drop's retention class requires it to be
+// deleted once retrieved.
+func (m *Manager) BurnAfterRead(id string) bool {
+	if len(m.Retention) == 0 {
+		return false
+	}
+	payload, err := m.GetDropMetadata(id)
+	if err != nil {
+		return false
+	}
+	return m.Retention[payload.Retention].BurnAfterRead
+}
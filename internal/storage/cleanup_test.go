@@ -2,13 +2,14 @@ package storage
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 )
 
-func setupTestManager(t *testing.T) *Manager {
+func setupTestManager(t testing.TB) *Manager {
 	t.Helper()
 	dir := t.TempDir()
 	m, err := NewManager(dir, nil)
@@ -29,7 +30,7 @@ func TestCleanupExpiredDrops_DeletesExpired(t *testing.T) {
 	}
 
 	// Manually set timestamp to 2 hours ago
-	metaPath := filepath.Join(m.StorageDir, drop.ID, "meta")
+	metaPath := filepath.Join(DropDir(m.StorageDir, drop.ID), "meta")
 	payload := &MetadataPayload{
 		Filename:      "old.txt",
 		Receipt:       drop.Receipt,
@@ -71,26 +72,27 @@ func TestCleanupExpiredDrops_PreservesRecent(t *testing.T) {
 	}
 }
 
-func TestCleanupExpiredDrops_SkipsProtected(t *testing.T) {
+func TestCleanupExpiredDrops_SkipsHoneypots(t *testing.T) {
 	m := setupTestManager(t)
 	defer m.Close()
 
-	drop, err := m.SaveDrop("honeypot.txt", bytes.NewReader([]byte("honeypot data")))
+	drop, err := m.SaveDropWithOptions("honeypot.txt", bytes.NewReader([]byte("honeypot data")), &SaveOptions{Honeypot: true})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	m.IsProtected = func(id string) bool {
-		return id == drop.ID
-	}
-
-	metaPath := filepath.Join(m.StorageDir, drop.ID, "meta")
+	metaPath := filepath.Join(DropDir(m.StorageDir, drop.ID), "meta")
+	old := time.Now().Add(-100 * time.Hour).Truncate(time.Hour).Unix()
 	payload := &MetadataPayload{
 		Filename:      "honeypot.txt",
 		Receipt:       drop.Receipt,
-		TimestampHour: time.Now().Add(-100 * time.Hour).Truncate(time.Hour).Unix(),
+		TimestampHour: old,
+		Honeypot:      true,
 	}
 	saveEncryptedMetadata(metaPath, m.EncryptionKey, drop.ID, payload)
+	// An index entry without the mark (e.g., from an older version) must
+	// not get the drop deleted: metadata is checked before deletion
+	m.expiry.set(drop.ID, expiryEntry{Hour: old})
 
 	if err := m.cleanupExpiredDrops(1 * time.Hour); err != nil {
 		t.Fatal(err)
@@ -98,7 +100,7 @@ func TestCleanupExpiredDrops_SkipsProtected(t *testing.T) {
 
 	_, reader, err := m.GetDrop(drop.ID)
 	if err != nil {
-		t.Errorf("protected drop should be preserved: %v", err)
+		t.Errorf("honeypot should be preserved: %v", err)
 	}
 	if reader != nil {
 		reader.Close()
@@ -114,7 +116,7 @@ func TestCleanupExpiredDrops_SkipsLockedDrops(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	metaPath := filepath.Join(m.StorageDir, drop.ID, "meta")
+	metaPath := filepath.Join(DropDir(m.StorageDir, drop.ID), "meta")
 	payload := &MetadataPayload{
 		Filename:      "locked.txt",
 		Receipt:       drop.Receipt,
@@ -131,7 +133,7 @@ func TestCleanupExpiredDrops_SkipsLockedDrops(t *testing.T) {
 
 	m.Locks.Unlock(drop.ID)
 
-	dropDir := filepath.Join(m.StorageDir, drop.ID)
+	dropDir := DropDir(m.StorageDir, drop.ID)
 	if _, err := os.Stat(dropDir); os.IsNotExist(err) {
 		t.Error("locked drop should be skipped during cleanup")
 	}
@@ -173,7 +175,7 @@ func TestGetDropAge_ZeroTimestamp(t *testing.T) {
 	drop, _ := m.SaveDrop("test.txt", bytes.NewReader([]byte("test")))
 
 	// Overwrite metadata with zero timestamp
-	metaPath := filepath.Join(m.StorageDir, drop.ID, "meta")
+	metaPath := filepath.Join(DropDir(m.StorageDir, drop.ID), "meta")
 	payload := &MetadataPayload{
 		Filename:      "test.txt",
 		Receipt:       drop.Receipt,
@@ -228,3 +230,208 @@ func TestCleanupJitter(t *testing.T) {
 		}
 	}
 }
+
+// backdateDrop rewrites a drop's metadata timestamp to age ago.
+func backdateDrop(t *testing.T, m *Manager, drop *Drop, retention string, age time.Duration) {
+	t.Helper()
+	metaPath := filepath.Join(DropDir(m.StorageDir, drop.ID), "meta")
+	payload := &MetadataPayload{
+		Filename:      drop.Filename,
+		Receipt:       drop.Receipt,
+		TimestampHour: time.Now().Add(-age).Truncate(time.Hour).Unix(),
+		Retention:     retention,
+	}
+	if err := saveEncryptedMetadata(metaPath, m.EncryptionKey, drop.ID, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCleanupExpiredDrops_RetentionClasses(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.Retention = map[string]RetentionClass{
+		"sensitive": {MaxAge: 24 * time.Hour},
+		"archive":   {MaxAge: 720 * time.Hour},
+		"forever":   {},
+	}
+
+	save := func(class string, age time.Duration) *Drop {
+		drop, err := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("x")), &SaveOptions{Retention: class})
+		if err != nil {
+			t.Fatal(err)
+		}
+		backdateDrop(t, m, drop, class, age)
+		return drop
+	}
+	sensitive := save("sensitive", 48*time.Hour)
+	archive := save("archive", 48*time.Hour)
+	forever := save("forever", 10000*time.Hour)
+	classless := save("", 48*time.Hour)
+
+	// Default age (for classless drops) is longer than the sensitive class
+	if err := m.cleanupExpiredDrops(168 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := func(d *Drop) bool {
+		_, err := os.Stat(DropDir(m.StorageDir, d.ID))
+		return err == nil
+	}
+	if exists(sensitive) {
+		t.Error("sensitive drop past its class age should be deleted")
+	}
+	if !exists(archive) {
+		t.Error("archive drop within its class age should be kept")
+	}
+	if !exists(forever) {
+		t.Error("class with no max age should never expire")
+	}
+	if !exists(classless) {
+		t.Error("classless drop within the default age should be kept")
+	}
+}
+
+func TestCleanupExpiredDrops_PinnedReview(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.Retention = map[string]RetentionClass{
+		"archive": {MaxAge: 24 * time.Hour, PinnedReview: true},
+	}
+
+	drop, _ := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("x")), &SaveOptions{Retention: "archive"})
+	backdateDrop(t, m, drop, "archive", 48*time.Hour)
+
+	deleted, err := m.deleteIfExpired(drop.ID, time.Hour, time.Now())
+	if deleted || !errors.Is(err, errPendingReview) {
+		t.Errorf("deleteIfExpired = %v, %v; want false, errPendingReview", deleted, err)
+	}
+	if err := m.cleanupExpiredDrops(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(DropDir(m.StorageDir, drop.ID)); err != nil {
+		t.Error("pinned drop should be kept past expiry")
+	}
+}
+
+func TestCleanupExpiredDrops_ZeroDefaultKeepsClassless(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, _ := m.SaveDrop("f.txt", bytes.NewReader([]byte("x")))
+	backdateDrop(t, m, drop, "", 1000*time.Hour)
+
+	if err := m.cleanupExpiredDrops(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(DropDir(m.StorageDir, drop.ID)); err != nil {
+		t.Error("classless drop should be kept when max age is zero")
+	}
+}
+
+func TestCleanupExpiredDrops_UploaderExpiry(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("x")), &SaveOptions{Expires: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := m.SaveDrop("g.txt", bytes.NewReader([]byte("y")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := m.GetDropMetadata(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := meta.TimestampHour + 2*3600; meta.ExpiresHour != want {
+		t.Errorf("ExpiresHour = %d, want %d", meta.ExpiresHour, want)
+	}
+
+	// The uploader's expiry comes before the default age, and no drop is
+	// due before it
+	if candidates, err := m.cleanupCandidates(1000*time.Hour, time.Now()); err != nil || len(candidates) != 0 {
+		t.Errorf("candidates now = %v, %v; want none", candidates, err)
+	}
+	later := time.Now().Add(3 * time.Hour)
+	candidates, err := m.cleanupCandidates(1000*time.Hour, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0] != drop.ID {
+		t.Errorf("candidates later = %v, want only the expiring drop", candidates)
+	}
+	for _, d := range []*Drop{drop, kept} {
+		if _, err := m.deleteIfExpired(d.ID, 1000*time.Hour, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(DropDir(m.StorageDir, drop.ID)); !os.IsNotExist(err) {
+		t.Error("drop past the uploader's expiry should be deleted")
+	}
+	if _, err := os.Stat(DropDir(m.StorageDir, kept.ID)); err != nil {
+		t.Error("drop without an expiry should be kept")
+	}
+}
+
+func TestBurnAfterRead(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.Retention = map[string]RetentionClass{
+		"sensitive": {MaxAge: 24 * time.Hour, BurnAfterRead: true},
+		"standard":  {MaxAge: 168 * time.Hour},
+	}
+
+	burn, _ := m.SaveDropWithOptions("a.txt", bytes.NewReader([]byte("a")), &SaveOptions{Retention: "sensitive"})
+	keep, _ := m.SaveDropWithOptions("b.txt", bytes.NewReader([]byte("b")), &SaveOptions{Retention: "standard"})
+
+	if !m.BurnAfterRead(burn.ID) {
+		t.Error("sensitive drop should burn after read")
+	}
+	if m.BurnAfterRead(keep.ID) {
+		t.Error("standard drop should not burn after read")
+	}
+}
+
+// BenchmarkCleanup_10kDrops measures a cleanup pass over 10,000 unexpired
+// drops: the steady-state cost of walking the store and decrypting metadata.
+func BenchmarkCleanup_10kDrops(b *testing.B) {
+	m := setupTestManager(b)
+	defer m.Close()
+	for i := 0; i < 10000; i++ {
+		if _, err := m.SaveDrop("bench.txt", bytes.NewReader([]byte("data"))); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := m.cleanupExpiredDrops(24 * time.Hour); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClose_StopsCleanupAndLocks(t *testing.T) {
+	m := setupTestManager(t)
+	m.StartCleanup(CleanupConfig{MaxAge: time.Hour, CheckInterval: time.Hour})
+
+	done := make(chan struct{})
+	go func() {
+		m.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the cleanup loop")
+	}
+
+	if !m.Locked() {
+		t.Error("manager still holds keys after Close")
+	}
+	if _, err := m.SaveDrop("late.txt", bytes.NewReader([]byte("x"))); !errors.Is(err, ErrLocked) {
+		t.Errorf("SaveDrop after Close = %v, want ErrLocked", err)
+	}
+	m.Close() // again, as deferred calls may
+}
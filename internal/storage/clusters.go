@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"path/filepath"
+
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+)
+
+// Clusters groups drops whose fuzzy hashes score at least threshold against
+// each other, limited to one campaign if campaign is not empty. Drops
+// without a fuzzy hash are left out.
+func (m *Manager) Clusters(campaign string, threshold int) ([][]string, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	// The index narrows the drops to the campaign before any decryption
+	listed, _, err := m.listDrops(0, 0, ListFilter{Campaign: campaign})
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string)
+	for _, d := range listed {
+		payload, err := loadEncryptedMetadata(filepath.Join(m.dropDir(d.ID), "meta"), m.EncryptionKey, d.ID)
+		if err == nil && payload.FuzzyHash != "" {
+			hashes[d.ID] = payload.FuzzyHash
+		}
+	}
+	return fuzzyhash.Cluster(hashes, threshold), nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestClusters(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.FuzzyHash = true
+
+	var report bytes.Buffer
+	for i := 0; report.Len() < 20000; i++ {
+		fmt.Fprintf(&report, "Invoice %d for consulting, approved by finance on day %d.\n", i*7919%10007, i%31)
+	}
+	edited := bytes.Replace(report.Bytes(), []byte("Invoice 7919"), []byte("Invoice 0000"), 1)
+
+	save := func(name string, data []byte, campaign string) string {
+		t.Helper()
+		drop, err := m.SaveDropWithOptions(name, bytes.NewReader(data), &SaveOptions{Campaign: campaign})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return drop.ID
+	}
+	a := save("a.txt", report.Bytes(), "payroll")
+	b := save("b.txt", edited, "payroll")
+	save("c.txt", []byte("too small for a fuzzy hash"), "payroll")
+	save("d.txt", report.Bytes(), "other")
+
+	info, err := m.Inspect(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.FuzzyHash == "" {
+		t.Error("fuzzy hash should be recorded in metadata")
+	}
+
+	clusters, err := m.Clusters("payroll", 80)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 1 || len(clusters[0]) != 2 {
+		t.Fatalf("clusters = %v, want one pair", clusters)
+	}
+	if got := map[string]bool{clusters[0][0]: true, clusters[0][1]: true}; !got[a] || !got[b] {
+		t.Errorf("clusters = %v, want %s and %s", clusters, a, b)
+	}
+
+	if all, _ := m.Clusters("", 80); len(all) != 1 || len(all[0]) != 3 {
+		t.Errorf("clusters across campaigns = %v, want one group of 3", all)
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// versionPrefix is how much of a data file identifies its version: it holds
+// the random salt every encrypted stream starts with.
+const versionPrefix = 64
+
+// DropContent is a drop's decrypted contents, readable from any offset, so
+// that a download can be resumed part way through.
+type DropContent struct {
+	io.ReadSeeker
+
+	// Version identifies the data file the contents were read from. It
+	// changes whenever the file is rewritten, as by processing or rekeying,
+	// and reveals nothing of the contents.
+	Version string
+
+	f     *os.File
+	check *hashCheck // with Manager.VerifyHash, of contents read from the start
+}
+
+// Read reads the contents. With Manager.VerifyHash, contents read from the
+// start to the end without seeking elsewhere end in ErrHashMismatch rather
+// than io.EOF if they do not match their stored hash.
+func (c *DropContent) Read(p []byte) (int, error) {
+	n, err := c.ReadSeeker.Read(p)
+	if c.check == nil {
+		return n, err
+	}
+	return c.check.read(p, n, err)
+}
+
+// Seek moves to offset; see io.Seeker.
+func (c *DropContent) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.ReadSeeker.Seek(offset, whence)
+	if err == nil && c.check != nil {
+		c.check.seek(pos)
+	}
+	return pos, err
+}
+
+// Close closes the drop's data file.
+func (c *DropContent) Close() error {
+	return c.f.Close()
+}
+
+// verify sets up the check of the contents against fileHash, if
+// VerifyHash is set.
+func (c *DropContent) verify(m *Manager, fileHash string) {
+	if m.VerifyHash {
+		c.check = newHashCheck(fileHash)
+	}
+}
+
+// OpenDropContent is GetDropWithPassphrase returning contents that can be
+// read from any offset. Seeking reads and authenticates only the chunk of
+// the data file that holds the new offset.
+func (m *Manager) OpenDropContent(id, passphrase string) (*MetadataPayload, *DropContent, error) {
+	var version string
+	payload, f, plaintext, err := m.openDataFile(id, retrievable(passphrase), func(key []byte, f *os.File) (io.Reader, error) {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		prefix := make([]byte, min(info.Size(), versionPrefix))
+		if _, err := io.ReadFull(f, prefix); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(append([]byte(id), prefix...))
+		version = hex.EncodeToString(sum[:16])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return crypto.NewDecryptSeeker(key, f, info.Size(), []byte(id))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	content := &DropContent{ReadSeeker: plaintext.(io.ReadSeeker), Version: version, f: f}
+	if payload.PassphraseSalt == nil {
+		content.verify(m, payload.FileHash)
+		return payload, content, nil
+	}
+
+	// The inner layer is a stream in the plaintext of the outer one
+	size, err := content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	key := crypto.DeriveDropKey(passphrase, payload.PassphraseSalt)
+	defer ZeroBytes(key)
+	inner, err := crypto.NewDecryptSeeker(key, content.ReadSeeker, size, []byte(id))
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, ErrWrongPassphrase
+	}
+	content.ReadSeeker = inner
+	content.verify(m, payload.FileHash)
+	return payload, content, nil
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestOpenDropContent_Seek(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	content := make([]byte, 3*crypto.StreamChunkSize+500)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	for _, passphrase := range []string{"", "correct horse"} {
+		drop, err := m.SaveDropWithOptions("a.bin", bytes.NewReader(content), &SaveOptions{Passphrase: passphrase})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, c, err := m.OpenDropContent(drop.ID, passphrase)
+		if err != nil {
+			t.Fatalf("passphrase %q: %v", passphrase, err)
+		}
+		if size, err := c.Seek(0, io.SeekEnd); err != nil || size != int64(len(content)) {
+			t.Errorf("passphrase %q: size = %d, %v", passphrase, size, err)
+		}
+		off := int64(2*crypto.StreamChunkSize - 10)
+		if _, err := c.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(c)
+		if err != nil || !bytes.Equal(got, content[off:]) {
+			t.Errorf("passphrase %q: read from %d: %d bytes, %v", passphrase, off, len(got), err)
+		}
+		_ = c.Close()
+
+		_, again, err := m.OpenDropContent(drop.ID, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Version == "" || again.Version != c.Version {
+			t.Errorf("passphrase %q: version %q, then %q", passphrase, c.Version, again.Version)
+		}
+		_ = again.Close()
+	}
+}
+
+func TestOpenDropContent_Passphrase(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDropWithOptions("a.txt", bytes.NewReader([]byte("data")), &SaveOptions{Passphrase: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.OpenDropContent(drop.ID, ""); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("no passphrase: error = %v, want ErrPassphraseRequired", err)
+	}
+	if _, _, err := m.OpenDropContent(drop.ID, "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: error = %v, want ErrWrongPassphrase", err)
+	}
+}
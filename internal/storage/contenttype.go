@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffedRefinements lists, for sniffed types that cover several formats,
+// the prefixes of declared types they may stand for. Content sniffing tells
+// a CSV file only as text/plain, and a .docx only as application/zip.
+var sniffedRefinements = map[string][]string{
+	"text/plain":      {"text/", "application/json"},
+	"application/zip": {"application/vnd.openxmlformats-officedocument.", "application/vnd.oasis.opendocument.", "application/epub+zip"},
+	"text/xml":        {"application/xml", "image/svg+xml"},
+}
+
+// verifiedContentType returns the content type to record for data: the type
+// the client declared when the contents bear it out, the sniffed type
+// otherwise. Sniffing reads at most the first 512 bytes.
+func verifiedContentType(declared string, data []byte) string {
+	sniffed := http.DetectContentType(data)
+	sniffedType, _, _ := mime.ParseMediaType(sniffed)
+
+	declaredType, params, err := mime.ParseMediaType(declared)
+	if err != nil || declaredType == "application/octet-stream" {
+		return sniffed
+	}
+	if declaredType == sniffedType {
+		return mime.FormatMediaType(declaredType, params)
+	}
+	for _, prefix := range sniffedRefinements[sniffedType] {
+		if strings.HasPrefix(declaredType, prefix) {
+			return mime.FormatMediaType(declaredType, params)
+		}
+	}
+	return sniffed
+}
+
+// sniffLen is how much of a file content sniffing looks at.
+const sniffLen = 512
+
+// prefixBuffer keeps the first limit bytes written to it and discards the
+// rest.
+type prefixBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (p *prefixBuffer) Write(b []byte) (int, error) {
+	if room := p.limit - len(p.buf); room > 0 {
+		p.buf = append(p.buf, b[:min(room, len(b))]...)
+	}
+	return len(b), nil
+}
@@ -0,0 +1,26 @@
+package storage
+
+import "testing"
+
+func TestVerifiedContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	tests := []struct {
+		declared string
+		data     []byte
+		want     string
+	}{
+		{"", []byte("hello"), "text/plain; charset=utf-8"},
+		{"image/png", png, "image/png"},
+		{"image/jpeg", png, "image/png"},                   // contradicted by the contents
+		{"text/csv", []byte("a,b\n1,2\n"), "text/csv"},     // refines text/plain
+		{"text/html", []byte("<html><body>"), "text/html"}, // borne out, but see serve_content_types
+		{"application/pdf", []byte("hello"), "text/plain; charset=utf-8"},
+		{"not a type", []byte("hello"), "text/plain; charset=utf-8"},
+		{"application/octet-stream", png, "image/png"},
+	}
+	for _, tt := range tests {
+		if got := verifiedContentType(tt.declared, tt.data); got != tt.want {
+			t.Errorf("verifiedContentType(%q, %q) = %q, want %q", tt.declared, tt.data, got, tt.want)
+		}
+	}
+}
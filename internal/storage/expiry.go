@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// expiryIndexFile holds the encrypted expiry index inside the storage dir.
+const expiryIndexFile = ".expiry-index"
+
+// expiryEntry is what cleanup and campaign counts need to know about a drop
+// without decrypting its metadata.
+type expiryEntry struct {
+	Hour      int64  `json:"h"`           // TimestampHour from metadata
+	Retention string `json:"r,omitempty"` // retention class
+	Hold      bool   `json:"l,omitempty"` // under legal hold
+	Campaign  string `json:"c,omitempty"` // campaign code
+	Size      int64  `json:"s,omitempty"` // stored (encrypted) size in bytes
+	Honeypot  bool   `json:"p,omitempty"` // decoy drop; never expires
+	Expires   int64  `json:"e,omitempty"` // ExpiresHour from metadata
+}
+
+// indexEntry builds the index entry of the drop in dir from its metadata.
+func indexEntry(dir string, payload *MetadataPayload) expiryEntry {
+	return expiryEntry{
+		Hour:      payload.TimestampHour,
+		Retention: payload.Retention,
+		Hold:      payload.LegalHold,
+		Campaign:  payload.Campaign,
+		Size:      dataFileSize(dir),
+		Honeypot:  payload.Honeypot,
+		Expires:   payload.ExpiresHour,
+	}
+}
+
+// expiryIndex maps drop IDs to expiry data so that a cleanup cycle only
+// decrypts the metadata of drops that are actually due, and per-campaign
+// counts need no decryption at all. It is loaded on the first cleanup or
+// campaign count after unlock, reconciled against the drop directories (only
+// drops missing from the index are decrypted), kept current by saves,
+// deletions and legal holds, and written back encrypted after each cycle.
+// Metadata stays authoritative: candidates are re-checked before deletion.
+type expiryIndex struct {
+	mu      sync.Mutex
+	entries map[string]expiryEntry // nil until loaded
+	dirty   bool
+
+	// While the index is being loaded, changes are collected here (nil
+	// meaning removed) and applied on top of the loaded entries
+	loading bool
+	early   map[string]*expiryEntry
+}
+
+func (x *expiryIndex) update(id string, e *expiryEntry) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	switch {
+	case x.entries != nil:
+		if e != nil {
+			x.entries[id] = *e
+		} else {
+			delete(x.entries, id)
+		}
+		x.dirty = true
+	case x.loading:
+		x.early[id] = e
+	}
+}
+
+func (x *expiryIndex) set(id string, e expiryEntry) { x.update(id, &e) }
+
+func (x *expiryIndex) remove(id string) { x.update(id, nil) }
+
+// expiryCandidates returns the IDs of drops that the index says are expired
+// or due for review, loading the index first if needed. The caller holds
+// keyMu and has checked that the manager is unlocked.
+func (m *Manager) expiryCandidates(maxAge time.Duration, now time.Time) ([]string, error) {
+	var due []string
+	err := m.eachIndexed(func(id string, e expiryEntry) {
+		if e.Hold || e.Honeypot {
+			return
+		}
+		age := maxAge
+		if class, ok := m.Retention[e.Retention]; ok {
+			age = class.MaxAge
+		}
+		if expired(e.Hour, e.Expires, age, now) {
+			due = append(due, id)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// expired reports whether a drop received at hour is due for deletion: past
+// the expiry its uploader chose, if any, or older than maxAge, if positive.
+func expired(hour, expires int64, maxAge time.Duration, now time.Time) bool {
+	if expires > 0 && now.After(time.Unix(expires, 0)) {
+		return true
+	}
+	return maxAge > 0 && now.Sub(time.Unix(hour, 0)) > maxAge
+}
+
+// loadExpiryIndex reads the index file, if not already loaded, and
+// reconciles it with the drops on disk. An unreadable index (for instance
+// after key rotation) is rebuilt from metadata.
+func (m *Manager) loadExpiryIndex() error {
+	m.expiry.mu.Lock()
+	if m.expiry.entries != nil || m.expiry.loading {
+		m.expiry.mu.Unlock()
+		return nil
+	}
+	m.expiry.loading = true
+	m.expiry.early = make(map[string]*expiryEntry)
+	m.expiry.mu.Unlock()
+
+	entries, err := m.readExpiryIndex()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Rebuilding expiry index: %v", err)
+		}
+		entries = make(map[string]expiryEntry)
+	}
+
+	present := make(map[string]bool, len(entries))
+	err = WalkDrops(m.StorageDir, func(id, dir string) error {
+		present[id] = true
+		// Entries written before sizes were indexed have none and are
+		// refreshed from metadata
+		if e, ok := entries[id]; ok && e.Size > 0 {
+			return nil
+		}
+		payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, id)
+		if err != nil {
+			return nil // partial or unreadable drop; not cleanup's to judge
+		}
+		entries[id] = indexEntry(dir, payload)
+		return nil
+	})
+	for id := range entries {
+		if !present[id] {
+			delete(entries, id)
+		}
+	}
+
+	m.expiry.mu.Lock()
+	defer m.expiry.mu.Unlock()
+	m.expiry.loading = false
+	if err != nil {
+		m.expiry.early = nil
+		return err
+	}
+	for id, e := range m.expiry.early {
+		if e != nil {
+			entries[id] = *e
+		} else {
+			delete(entries, id)
+		}
+	}
+	m.expiry.early = nil
+	m.expiry.entries = entries
+	m.expiry.dirty = true
+	return nil
+}
+
+// saveExpiryIndex writes the index if it changed since the last write. The
+// caller holds keyMu and has checked that the manager is unlocked.
+func (m *Manager) saveExpiryIndex() error {
+	m.expiry.mu.Lock()
+	if !m.expiry.dirty {
+		m.expiry.mu.Unlock()
+		return nil
+	}
+	plaintext, err := json.Marshal(m.expiry.entries)
+	m.expiry.dirty = false
+	m.expiry.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer ZeroBytes(plaintext)
+
+	gcm, err := m.expiryCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(expiryIndexFile))
+
+	path := filepath.Join(m.StorageDir, expiryIndexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write expiry index: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+func (m *Manager) readExpiryIndex() (map[string]expiryEntry, error) {
+	data, err := os.ReadFile(filepath.Join(m.StorageDir, expiryIndexFile)) // #nosec G304 -- fixed name inside storage dir
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := m.expiryCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("expiry index truncated")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(expiryIndexFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt expiry index: %w", err)
+	}
+	defer ZeroBytes(plaintext)
+
+	var entries map[string]expiryEntry
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse expiry index: %w", err)
+	}
+	if entries == nil {
+		entries = make(map[string]expiryEntry)
+	}
+	return entries, nil
+}
+
+// expiryCipher returns an AEAD keyed for the index from the storage key.
+func (m *Manager) expiryCipher() (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	defer ZeroBytes(key)
+	r := hkdf.New(sha256.New, m.EncryptionKey, nil, []byte("dead-drop-expiry-index"))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, fmt.Errorf("failed to derive expiry index key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
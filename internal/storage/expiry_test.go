@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpiryIndex_PersistedEncrypted(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.cleanupExpiredDrops(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(m.StorageDir, expiryIndexFile))
+	if err != nil {
+		t.Fatalf("expiry index not written: %v", err)
+	}
+	if bytes.Contains(data, []byte(drop.ID)) {
+		t.Error("expiry index should be encrypted")
+	}
+
+	// A second manager on the same store uses the index instead of
+	// decrypting metadata: a drop with unreadable metadata is still known
+	m2, err := NewManager(m.StorageDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close()
+	if err := os.WriteFile(filepath.Join(DropDir(m.StorageDir, drop.ID), "meta"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.loadExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m2.expiry.entries[drop.ID]; !ok {
+		t.Error("drop should be loaded from the persisted index")
+	}
+}
+
+func TestExpiryIndex_OnlyCandidatesChecked(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	old, err := m.SaveDrop("old.txt", bytes.NewReader([]byte("old")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backdateDrop(t, m, old, "", 3*time.Hour)
+	fresh, err := m.SaveDrop("fresh.txt", bytes.NewReader([]byte("fresh")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candidates, err := m.cleanupCandidates(time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0] != old.ID {
+		t.Errorf("candidates = %v, want only the expired drop", candidates)
+	}
+
+	if err := m.cleanupExpiredDrops(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.expiry.entries[old.ID]; ok {
+		t.Error("deleted drop should leave the index")
+	}
+	if _, ok := m.expiry.entries[fresh.ID]; !ok {
+		t.Error("fresh drop should stay in the index")
+	}
+}
+
+func TestExpiryIndex_MetadataIsAuthoritative(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	if err := m.loadExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A stale index entry claiming the drop is old must not delete it
+	m.expiry.set(drop.ID, expiryEntry{Hour: time.Now().Add(-48 * time.Hour).Unix()})
+
+	if err := m.cleanupExpiredDrops(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.GetDrop(drop.ID); err != nil {
+		t.Errorf("drop deleted on the strength of a stale index: %v", err)
+	}
+}
+
+func TestExpiryIndex_LegalHoldAndRemoval(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	if err := m.loadExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetLegalHold(drop.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if !m.expiry.entries[drop.ID].Hold {
+		t.Error("legal hold should be reflected in the index")
+	}
+	if err := m.SetLegalHold(drop.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteDrop(drop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.expiry.entries[drop.ID]; ok {
+		t.Error("deleted drop should leave the index")
+	}
+}
@@ -0,0 +1,197 @@
+//go:build faultinject
+
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/faultinject"
+)
+
+// Run with: go test -tags faultinject ./internal/storage/
+
+var faultPlaintext = bytes.Repeat([]byte("TOP SECRET PLAINTEXT "), 512)
+
+func setupFaultManager(t *testing.T) *Manager {
+	t.Helper()
+	t.Cleanup(faultinject.Reset)
+	m := setupTestManager(t)
+	t.Cleanup(m.Close)
+	quota, err := NewQuotaManager(m.StorageDir, 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Quota = quota
+	return m
+}
+
+// assertNoPlaintext fails if any file under the storage directory contains
+// the test plaintext.
+func assertNoPlaintext(t *testing.T, dir string) {
+	t.Helper()
+	needle := faultPlaintext[:64]
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path) // #nosec G304 -- test temp dir
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, needle) {
+			t.Errorf("plaintext found on disk in %s", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertQuotaConsistent fails if the in-memory quota disagrees with a fresh
+// scan of the storage directory.
+func assertQuotaConsistent(t *testing.T, m *Manager) {
+	t.Helper()
+	rescan, err := NewQuotaManager(m.StorageDir, 1, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotBytes, gotDrops := m.Quota.Stats()
+	wantBytes, wantDrops := rescan.Stats()
+	if gotBytes != wantBytes || gotDrops != wantDrops {
+		t.Errorf("quota = %d bytes / %d drops, disk has %d bytes / %d drops",
+			gotBytes, gotDrops, wantBytes, wantDrops)
+	}
+}
+
+func TestFault_SaveDropWriteFailures(t *testing.T) {
+	faults := map[string]faultinject.Fault{
+		"failed write":  {Rate: 1},
+		"torn write":    {Limit: 100},
+		"random writes": {Rate: 0.5},
+	}
+	for name, fault := range faults {
+		t.Run(name, func(t *testing.T) {
+			m := setupFaultManager(t)
+			faultinject.Set(faultinject.StorageWrite, fault)
+
+			var saved []*Drop
+			for i := 0; i < 20; i++ {
+				drop, err := m.SaveDrop("secret.txt", bytes.NewReader(faultPlaintext))
+				if err == nil {
+					saved = append(saved, drop)
+				} else if !errors.Is(err, faultinject.ErrInjected) {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			faultinject.Reset()
+
+			assertNoPlaintext(t, m.StorageDir)
+			assertQuotaConsistent(t, m)
+
+			// Whatever was reported saved must be intact
+			for _, drop := range saved {
+				_, r, err := m.GetDrop(drop.ID)
+				if err != nil {
+					t.Fatalf("saved drop unreadable: %v", err)
+				}
+				got, _ := io.ReadAll(r)
+				if !bytes.Equal(got, faultPlaintext) {
+					t.Error("saved drop corrupted")
+				}
+			}
+		})
+	}
+}
+
+func TestFault_SaveDropEncryptFailure(t *testing.T) {
+	m := setupFaultManager(t)
+	faultinject.Set(faultinject.CryptoEncrypt, faultinject.Fault{Rate: 1})
+
+	if _, err := m.SaveDrop("secret.txt", bytes.NewReader(faultPlaintext)); err == nil {
+		t.Fatal("SaveDrop should fail when encryption fails")
+	}
+	assertNoPlaintext(t, m.StorageDir)
+	assertQuotaConsistent(t, m)
+}
+
+func TestFault_GetDropPartialRead(t *testing.T) {
+	m := setupFaultManager(t)
+	drop, err := m.SaveDrop("secret.txt", bytes.NewReader(faultPlaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fault := range []faultinject.Fault{{Limit: 100}, {Rate: 1}} {
+		faultinject.Set(faultinject.StorageRead, fault)
+		_, r, err := m.GetDrop(drop.ID)
+		if err == nil {
+			got, _ := io.ReadAll(r)
+			t.Fatalf("GetDrop returned %d bytes from a partial read", len(got))
+		}
+	}
+	faultinject.Set(faultinject.CryptoDecrypt, faultinject.Fault{Rate: 1})
+	faultinject.Set(faultinject.StorageRead, faultinject.Fault{})
+	if _, _, err := m.GetDrop(drop.ID); err == nil {
+		t.Fatal("GetDrop should fail when decryption fails")
+	}
+
+	// The drop is unharmed once faults clear
+	faultinject.Reset()
+	if _, _, err := m.GetDrop(drop.ID); err != nil {
+		t.Fatalf("GetDrop after faults: %v", err)
+	}
+}
+
+func TestFault_CleanupDeleteFailures(t *testing.T) {
+	m := setupFaultManager(t)
+	m.SecureDelete = true
+
+	for i := 0; i < 10; i++ {
+		drop, err := m.SaveDrop("old.txt", bytes.NewReader(faultPlaintext))
+		if err != nil {
+			t.Fatal(err)
+		}
+		backdateDrop(t, m, drop, "", 3*time.Hour)
+	}
+
+	faultinject.Set(faultinject.StorageDelete, faultinject.Fault{Rate: 0.3})
+	if err := m.cleanupExpiredDrops(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	assertQuotaConsistent(t, m)
+
+	// A later run without faults finishes the job
+	faultinject.Reset()
+	if err := m.cleanupExpiredDrops(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	assertQuotaConsistent(t, m)
+	if bytes, drops := m.Quota.Stats(); bytes != 0 || drops != 0 {
+		t.Errorf("quota after cleanup = %d bytes / %d drops, want empty", bytes, drops)
+	}
+}
+
+func TestFault_SlowDisk(t *testing.T) {
+	m := setupFaultManager(t)
+	faultinject.Set(faultinject.StorageWrite, faultinject.Fault{Delay: 5 * time.Millisecond})
+
+	start := time.Now()
+	drop, err := m.SaveDrop("secret.txt", bytes.NewReader(faultPlaintext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 5*time.Millisecond {
+		t.Error("injected delay not applied")
+	}
+	if _, _, err := m.GetDrop(drop.ID); err != nil {
+		t.Fatal(err)
+	}
+	assertQuotaConsistent(t, m)
+}
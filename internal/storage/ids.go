@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IDGenerator creates drop IDs and recognizes the IDs it creates. Every
+// storage operation checks drop IDs with the active generator's Validate
+// (see ValidateDropID), so generation and validation cannot drift apart.
+type IDGenerator interface {
+	NewID() (string, error)
+	Validate(id string) error
+}
+
+const (
+	// HexAlphabet is the alphabet of the default drop IDs.
+	HexAlphabet = "0123456789abcdef"
+	// UnambiguousAlphabet is Crockford's base32 in lower case: digits and
+	// letters without i, l, o and u, so that IDs read aloud or copied by
+	// hand do not confuse 0 with o or 1 with l.
+	UnambiguousAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+// MinIDBits is the least randomness an ID format may carry, the 128 bits of
+// the default 32-character hex IDs.
+const MinIDBits = 128
+
+// idFormatFile records a store's ID format when it is not the default, so
+// offline tools recognize its drops and the server refuses a config that
+// would leave them unreachable.
+const idFormatFile = ".id-format"
+
+// IDFormat is an IDGenerator producing random IDs of Length characters from
+// Alphabet, after Prefix and a "-" when Prefix is set (e.g. "ops-3f9k...").
+type IDFormat struct {
+	Prefix   string `json:"prefix,omitempty"`
+	Alphabet string `json:"alphabet"`
+	Length   int    `json:"length"`
+}
+
+// DefaultIDFormat is the format of drop IDs unless configured otherwise:
+// 32 lowercase hex characters.
+var DefaultIDFormat = IDFormat{Alphabet: HexAlphabet, Length: 32}
+
+// NewIDFormat checks and completes an ID format. alphabet may be "hex"
+// (the default when empty), "unambiguous", or the characters themselves,
+// which must be distinct ASCII letters and digits. prefix may hold lowercase
+// letters and digits. A zero length picks the shortest that carries
+// MinIDBits; a shorter one is refused.
+func NewIDFormat(prefix, alphabet string, length int) (IDFormat, error) {
+	switch alphabet {
+	case "", "hex":
+		alphabet = HexAlphabet
+	case "unambiguous":
+		alphabet = UnambiguousAlphabet
+	}
+	f := IDFormat{Prefix: prefix, Alphabet: alphabet, Length: length}
+
+	if len(alphabet) < 2 {
+		return f, errors.New("ID alphabet needs at least 2 characters")
+	}
+	for i := 0; i < len(alphabet); i++ {
+		if !isIDChar(alphabet[i]) {
+			return f, fmt.Errorf("ID alphabet may hold only ASCII letters and digits, not %q", alphabet[i])
+		}
+		if strings.IndexByte(alphabet[:i], alphabet[i]) >= 0 {
+			return f, fmt.Errorf("ID alphabet repeats %q", alphabet[i])
+		}
+	}
+	if len(prefix) > 16 {
+		return f, errors.New("ID prefix is longer than 16 characters")
+	}
+	for i := 0; i < len(prefix); i++ {
+		if c := prefix[i]; (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return f, fmt.Errorf("ID prefix may hold only lowercase letters and digits, not %q", c)
+		}
+	}
+
+	bitsPerChar := math.Log2(float64(len(alphabet)))
+	if f.Length == 0 {
+		f.Length = int(math.Ceil(MinIDBits / bitsPerChar))
+	}
+	if bits := float64(f.Length) * bitsPerChar; bits < MinIDBits {
+		return f, fmt.Errorf("ID length %d over %d characters gives %.0f bits, fewer than %d", f.Length, len(alphabet), bits, MinIDBits)
+	}
+	return f, nil
+}
+
+// String describes the format for error messages.
+func (f IDFormat) String() string {
+	return fmt.Sprintf("prefix %q, alphabet %q, length %d", f.Prefix, f.Alphabet, f.Length)
+}
+
+// NewID returns a random ID, drawing each character uniformly from the
+// alphabet.
+func (f IDFormat) NewID() (string, error) {
+	n := len(f.Alphabet)
+	limit := 256 - 256%n // bytes at or above limit would bias the draw
+
+	var b strings.Builder
+	if f.Prefix != "" {
+		b.WriteString(f.Prefix)
+		b.WriteByte('-')
+	}
+	buf := make([]byte, f.Length)
+	for remaining := f.Length; remaining > 0; {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, c := range buf {
+			if int(c) >= limit || remaining == 0 {
+				continue
+			}
+			b.WriteByte(f.Alphabet[int(c)%n])
+			remaining--
+		}
+	}
+	return b.String(), nil
+}
+
+// Validate accepts exactly the IDs NewID can return.
+func (f IDFormat) Validate(id string) error {
+	rest := id
+	if f.Prefix != "" {
+		var ok bool
+		if rest, ok = strings.CutPrefix(id, f.Prefix+"-"); !ok {
+			return errors.New("invalid drop ID format")
+		}
+	}
+	if len(rest) != f.Length {
+		return errors.New("invalid drop ID format")
+	}
+	for i := 0; i < len(rest); i++ {
+		if strings.IndexByte(f.Alphabet, rest[i]) < 0 {
+			return errors.New("invalid drop ID format")
+		}
+	}
+	return nil
+}
+
+// isIDChar reports whether c may appear in the random part of a drop ID.
+func isIDChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+var (
+	idMu        sync.RWMutex
+	idGenerator IDGenerator = DefaultIDFormat
+)
+
+// SetIDGenerator makes g the generator for new drop IDs and the judge of
+// ValidateDropID. nil restores DefaultIDFormat. It must be called before
+// the store is used; drops whose IDs g rejects become unreachable.
+func SetIDGenerator(g IDGenerator) {
+	if g == nil {
+		g = DefaultIDFormat
+	}
+	idMu.Lock()
+	idGenerator = g
+	idMu.Unlock()
+}
+
+func currentIDGenerator() IDGenerator {
+	idMu.RLock()
+	defer idMu.RUnlock()
+	return idGenerator
+}
+
+// generateID creates an ID for a new drop with the active generator.
+func generateID() (string, error) {
+	id, err := currentIDGenerator().NewID()
+	if err != nil {
+		return "", err
+	}
+	if err := ValidateDropID(id); err != nil {
+		return "", fmt.Errorf("ID generator made an unusable ID: %w", err)
+	}
+	return id, nil
+}
+
+// UseIDFormat sets the ID format for the store in storageDir and makes it
+// the active generator. With a nil format, as offline tools pass, the
+// store's recorded format is used. Otherwise format must match the recorded
+// one; a store with no record holds default IDs, and moves to another
+// format only while it holds no drops, so no drop is left unreachable.
+func UseIDFormat(storageDir string, format *IDFormat) error {
+	path := filepath.Join(storageDir, idFormatFile)
+	stored := DefaultIDFormat
+	data, err := os.ReadFile(path) // #nosec G304 -- fixed name inside storage dir
+	recorded := err == nil
+	switch {
+	case recorded:
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if stored, err = NewIDFormat(stored.Prefix, stored.Alphabet, stored.Length); err != nil {
+			return fmt.Errorf("invalid ID format in %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read ID format: %w", err)
+	}
+
+	if format == nil || *format == stored {
+		SetIDGenerator(stored)
+		return nil
+	}
+	if recorded {
+		return fmt.Errorf("drops in %s have IDs of format %s, not the configured %s", storageDir, stored, *format)
+	}
+
+	// Drops with default IDs would fail the new format's validation
+	SetIDGenerator(stored)
+	errHasDrops := errors.New("store holds drops")
+	err = WalkDrops(storageDir, func(string, string) error { return errHasDrops })
+	if err == nil {
+		err = WalkQuarantine(storageDir, func(string, string) error { return errHasDrops })
+	}
+	if errors.Is(err, errHasDrops) {
+		return fmt.Errorf("%s already holds drops with default IDs; the configured ID format %s would leave them unreachable", storageDir, *format)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to scan storage directory: %w", err)
+	}
+
+	if *format != DefaultIDFormat {
+		data, err := json.Marshal(format)
+		if err != nil {
+			return fmt.Errorf("failed to encode ID format: %w", err)
+		}
+		if err := os.MkdirAll(storageDir, 0700); err != nil {
+			return fmt.Errorf("failed to create storage directory: %w", err)
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil { // #nosec G703 -- fixed name inside storage dir
+			return fmt.Errorf("failed to record ID format: %w", err)
+		}
+	}
+	SetIDGenerator(*format)
+	return nil
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNewIDFormat(t *testing.T) {
+	f, err := NewIDFormat("", "", 0)
+	if err != nil || f != DefaultIDFormat {
+		t.Errorf("defaults = %v, %v; want %v", f, err, DefaultIDFormat)
+	}
+	f, err = NewIDFormat("ops", "unambiguous", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Alphabet != UnambiguousAlphabet || f.Length != 26 {
+		t.Errorf("unambiguous format = %v, want 26 characters", f)
+	}
+
+	bad := []struct{ prefix, alphabet string }{
+		{"", "abcda"},  // repeated character
+		{"", "ab/cd"},  // path separator
+		{"", "a"},      // too small
+		{"Ops", "hex"}, // uppercase prefix
+		{"o-s", "hex"}, // dash in prefix
+		{strings.Repeat("a", 17), "hex"},
+	}
+	for _, b := range bad {
+		if _, err := NewIDFormat(b.prefix, b.alphabet, 0); err == nil {
+			t.Errorf("NewIDFormat(%q, %q) accepted", b.prefix, b.alphabet)
+		}
+	}
+	if _, err := NewIDFormat("", "hex", 31); err == nil {
+		t.Error("124-bit IDs accepted")
+	}
+}
+
+func TestIDFormat_NewIDValidates(t *testing.T) {
+	f, err := NewIDFormat("ops", "unambiguous", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		id, err := f.NewID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(id, "ops-") || len(id) != 30 {
+			t.Fatalf("NewID = %q", id)
+		}
+		if strings.ContainsAny(id[4:], "ilou") {
+			t.Fatalf("NewID = %q uses an ambiguous character", id)
+		}
+		if err := f.Validate(id); err != nil {
+			t.Fatalf("Validate(%q): %v", id, err)
+		}
+	}
+	for _, id := range []string{"ops-", "dev-0123456789abcdefghjkmnpq", "ops-0123456789abcdefghjkmnpl", "0123456789abcdef0123456789abcdef"} {
+		if f.Validate(id) == nil {
+			t.Errorf("Validate(%q) accepted", id)
+		}
+	}
+}
+
+func TestSaveDrop_CustomIDFormat(t *testing.T) {
+	f, err := NewIDFormat("ops", "unambiguous", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := setupTestManager(t)
+	defer m.Close()
+	if err := UseIDFormat(m.StorageDir, &f); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetIDGenerator(nil) })
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("contents")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(drop.ID, "ops-") {
+		t.Errorf("ID = %q, want the prefix", drop.ID)
+	}
+	if dir := m.dropDir(drop.ID); !strings.HasSuffix(dir, "/"+drop.ID[4:6]+"/"+drop.ID[6:8]+"/"+drop.ID) {
+		t.Errorf("drop dir %s is not sharded on the random part", dir)
+	}
+	if _, _, err := m.GetDrop(drop.ID); err != nil {
+		t.Errorf("GetDrop: %v", err)
+	}
+	var walked []string
+	if err := WalkDrops(m.StorageDir, func(id, _ string) error { walked = append(walked, id); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 1 || walked[0] != drop.ID {
+		t.Errorf("WalkDrops = %v", walked)
+	}
+
+	// Offline tools pick up the recorded format, and a different one is refused
+	SetIDGenerator(nil)
+	if err := UseIDFormat(m.StorageDir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ValidateDropID(drop.ID) != nil {
+		t.Error("recorded format not applied")
+	}
+	if err := UseIDFormat(m.StorageDir, &DefaultIDFormat); err == nil {
+		t.Error("switching formats on a store with a recorded format accepted")
+	}
+}
+
+func TestUseIDFormat_RefusesStoreWithDefaultIDs(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	if _, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("contents"))); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetIDGenerator(nil) })
+
+	f, err := NewIDFormat("", "unambiguous", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UseIDFormat(m.StorageDir, &f); err == nil {
+		t.Error("new format accepted for a store holding default IDs")
+	}
+	if err := UseIDFormat(m.StorageDir, &DefaultIDFormat); err != nil {
+		t.Errorf("default format refused: %v", err)
+	}
+}
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
 )
 
 // computeSHA256 returns the hex-encoded SHA-256 hash of the data.
@@ -10,3 +14,85 @@ func computeSHA256(data []byte) string {
 	h := sha256.Sum256(data)
 	return hex.EncodeToString(h[:])
 }
+
+// ErrHashMismatch is returned at the end of a drop's contents, in place of
+// io.EOF, when Manager.VerifyHash is set and they do not match the SHA-256
+// recorded when the drop was stored.
+var ErrHashMismatch = errors.New("drop contents do not match their stored hash")
+
+// hashCheck hashes a drop's contents as they are read from the start, and
+// decides at their end whether they match. A drop stored before hashes were
+// recorded has none to check.
+type hashCheck struct {
+	want []byte
+	h    hash.Hash
+	off  bool  // read from elsewhere than the start, so left unchecked
+	err  error // io.EOF or ErrHashMismatch once the end was reached
+}
+
+// newHashCheck returns the check of contents whose hex SHA-256 is fileHash,
+// or nil if there is nothing to check against.
+func newHashCheck(fileHash string) *hashCheck {
+	want, err := hex.DecodeString(fileHash)
+	if err != nil || len(want) != sha256.Size {
+		return nil
+	}
+	return &hashCheck{want: want, h: sha256.New()}
+}
+
+// read passes on the result of reading p from the contents, withholding the
+// end until the hash has been compared. Once the end was reached it keeps
+// returning the outcome, so that a caller dropping an error that came with
+// data still sees it on its next read.
+func (c *hashCheck) read(p []byte, n int, err error) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.off {
+		return n, err
+	}
+	c.h.Write(p[:n])
+	if !errors.Is(err, io.EOF) {
+		return n, err
+	}
+	c.err = io.EOF
+	if !bytes.Equal(c.h.Sum(nil), c.want) {
+		c.err = ErrHashMismatch
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, c.err
+}
+
+// seek follows a move to pos: back at the start the check begins again,
+// anywhere else it is given up.
+func (c *hashCheck) seek(pos int64) {
+	c.err = nil
+	c.h.Reset()
+	c.off = pos != 0
+}
+
+// verifiedReader is a drop's contents read through a hashCheck.
+type verifiedReader struct {
+	io.ReadCloser
+	check *hashCheck
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	return v.check.read(p, n, err)
+}
+
+// verified wraps the contents of a drop stored with fileHash in a check of
+// that hash, if VerifyHash is set.
+func (m *Manager) verified(fileHash string, r io.ReadCloser) io.ReadCloser {
+	if !m.VerifyHash {
+		return r
+	}
+	check := newHashCheck(fileHash)
+	if check == nil {
+		return r
+	}
+	return &verifiedReader{ReadCloser: r, check: check}
+}
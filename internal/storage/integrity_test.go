@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// corruptHash replaces the SHA-256 recorded for a drop, as if its contents
+// had been damaged since it was stored.
+func corruptHash(t *testing.T, m *Manager, id string) {
+	t.Helper()
+	path := filepath.Join(m.dropDir(id), "meta")
+	payload, err := loadEncryptedMetadata(path, m.EncryptionKey, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload.FileHash = computeSHA256([]byte("something else"))
+	if err := saveEncryptedMetadata(path, m.EncryptionKey, id, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyHash(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.VerifyHash = true
+	content := bytes.Repeat([]byte("evidence "), 20000)
+
+	for _, passphrase := range []string{"", "correct horse"} {
+		drop, err := m.SaveDropWithOptions("a.txt", bytes.NewReader(content), &SaveOptions{Passphrase: passphrase})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, r, err := m.GetDropWithPassphrase(drop.ID, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("passphrase %q: intact drop read = %d bytes, %v", passphrase, len(got), err)
+		}
+
+		corruptHash(t, m, drop.ID)
+		_, r, err = m.GetDropWithPassphrase(drop.ID, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = io.ReadAll(r)
+		r.Close()
+		if !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("passphrase %q: mismatched drop read error = %v, want ErrHashMismatch", passphrase, err)
+		}
+
+		_, c, err := m.OpenDropContent(drop.ID, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(c); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("passphrase %q: mismatched content read error = %v, want ErrHashMismatch", passphrase, err)
+		}
+		// A range cannot be checked, and is not failed
+		if _, err := c.Seek(100, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(c); err != nil {
+			t.Errorf("passphrase %q: range read error = %v", passphrase, err)
+		}
+		c.Close()
+	}
+}
+
+func TestVerifyHash_Off(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	corruptHash(t, m, drop.ID)
+
+	_, r, err := m.GetDrop(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); err != nil {
+		t.Errorf("read without VerifyHash error = %v", err)
+	}
+}
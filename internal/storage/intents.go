@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// intentsDirName is the directory inside the storage dir holding one intent
+// record per drop mutation in progress. It is hidden, so WalkDrops skips it.
+const intentsDirName = ".intents"
+
+// Saving, deleting and replacing a drop's data each take several file
+// operations, and the quota and expiry index are adjusted in memory beside
+// them. A crash part way through would leave a drop directory no code path
+// finishes: a new drop without metadata, a half-deleted drop, or a data file
+// beside its replacement. So before touching the directory each mutation
+// records its intent, and removes the record once the directory is in its
+// final state. RecoverIntents finishes or undoes whatever a crash
+// interrupted before the quota is counted and the index reconciled, both of
+// which are rebuilt from the directories. Records name the drop directory
+// and nothing else.
+const (
+	intentSave    = "save"    // a new drop: rolled back unless its metadata was written
+	intentDelete  = "delete"  // a deletion: rolled forward
+	intentReplace = "replace" // a data file swap: completed or undone
+)
+
+// beginIntent durably records that op is about to change the drop
+// directory dir, and returns a function that removes the record once the
+// directory is in its final state.
+func (m *Manager) beginIntent(op, id, dir string) (done func(), err error) {
+	rel, err := filepath.Rel(m.StorageDir, dir)
+	if err != nil || !filepath.IsLocal(rel) || filepath.Base(rel) != id {
+		return nil, fmt.Errorf("drop directory %q is outside storage", dir)
+	}
+	intents := filepath.Join(m.StorageDir, intentsDirName)
+	if err := os.MkdirAll(intents, 0700); err != nil {
+		return nil, fmt.Errorf("failed to record intent: %w", err)
+	}
+
+	path := filepath.Join(intents, op+"-"+id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 -- name built from op and validated drop ID
+	if err != nil {
+		return nil, fmt.Errorf("failed to record intent: %w", err)
+	}
+	_, err = f.WriteString(filepath.ToSlash(rel))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to record intent: %w", err)
+	}
+	syncDir(intents)
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// syncDir flushes a directory's entries to disk where the platform allows.
+func syncDir(dir string) {
+	d, err := os.Open(dir) // #nosec G304 -- directory inside the storage dir
+	if err != nil {
+		return
+	}
+	_ = d.Sync() // not supported for directories on Windows
+	_ = d.Close()
+}
+
+// RecoverIntents completes or undoes the drop mutations a crash left
+// unfinished in storageDir, and returns how many it resolved: new drops
+// without metadata are removed, deletions are finished, and data file swaps
+// are completed if the new file is in place or undone if not. Removals are
+// overwritten first when secure is set. It needs no keys, and must run
+// before anything else reads the store, as the quota scan and expiry index
+// trust what is on disk.
+func RecoverIntents(storageDir string, secure bool) (int, error) {
+	intents := filepath.Join(storageDir, intentsDirName)
+	entries, err := os.ReadDir(intents)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	remove := os.RemoveAll
+	if secure {
+		remove = SecureDeleteDir
+	}
+	recovered := 0
+	var firstErr error
+	for _, entry := range entries {
+		path := filepath.Join(intents, entry.Name())
+		op, id, _ := strings.Cut(entry.Name(), "-")
+		data, err := os.ReadFile(path) // #nosec G304 -- entry of the intents dir
+		rel := filepath.FromSlash(string(data))
+		// A record only ever names the directory of its own drop
+		if err != nil || ValidateDropID(id) != nil || !filepath.IsLocal(rel) || filepath.Base(rel) != id {
+			log.Printf("Ignoring unreadable intent record %q", entry.Name())
+			_ = os.Remove(path)
+			continue
+		}
+		dir := filepath.Join(storageDir, rel)
+
+		switch op {
+		case intentSave:
+			// Metadata is written last, so a drop that has it was saved
+			if _, statErr := os.Stat(filepath.Join(dir, "meta")); os.IsNotExist(statErr) {
+				err = remove(dir)
+			}
+		case intentDelete:
+			err = remove(dir)
+		case intentReplace:
+			err = recoverReplace(dir, secure)
+		default:
+			err = fmt.Errorf("unknown intent %q", op)
+		}
+		if err != nil {
+			// Kept, so the next start tries again
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to recover %s of drop %s: %w", op, id, err)
+			}
+			continue
+		}
+		_ = os.Remove(path)
+		recovered++
+	}
+	return recovered, firstErr
+}
+
+// recoverReplace resolves an interrupted replaceData in dir: the new file is
+// dropped if it never replaced the data file, and the old one is deleted if
+// it was replaced, or moved back if the crash came between the two renames.
+func recoverReplace(dir string, secure bool) error {
+	filePath := filepath.Join(dir, "data")
+	if err := os.Remove(filePath + ".tmp"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	oldPath := filePath + ".old"
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return os.Rename(oldPath, filePath)
+	}
+	if secure {
+		return SecureDelete(oldPath)
+	}
+	return os.Remove(oldPath)
+}
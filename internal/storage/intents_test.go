@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func intentRecords(t *testing.T, m *Manager) []os.DirEntry {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(m.StorageDir, intentsDirName))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestIntents_ClearedOnSuccess(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteDrop(drop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if records := intentRecords(t, m); len(records) != 0 {
+		t.Errorf("%d intent records left after a save and a delete", len(records))
+	}
+}
+
+func TestRecoverIntents_InterruptedSave(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	// A crash after the data file was written but before the metadata
+	id, err := generateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := DropDir(m.StorageDir, id)
+	if _, err := m.beginIntent(intentSave, id, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data"), []byte("ciphertext"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash after the metadata was written but before the record went
+	saved, err := m.SaveDrop("b.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.beginIntent(intentSave, saved.ID, DropDir(m.StorageDir, saved.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := RecoverIntents(m.StorageDir, false)
+	if err != nil || n != 2 {
+		t.Fatalf("RecoverIntents = %d, %v; want 2, nil", n, err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("partial drop should be rolled back")
+	}
+	if _, err := m.GetDropMetadata(saved.ID); err != nil {
+		t.Errorf("saved drop should be kept: %v", err)
+	}
+	if records := intentRecords(t, m); len(records) != 0 {
+		t.Errorf("%d intent records left after recovery", len(records))
+	}
+
+	quota, err := NewQuotaManager(m.StorageDir, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, drops := quota.Stats(); drops != 1 {
+		t.Errorf("quota counts %d drops after recovery, want 1", drops)
+	}
+}
+
+func TestRecoverIntents_InterruptedDelete(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := DropDir(m.StorageDir, drop.ID)
+	if _, err := m.beginIntent(intentDelete, drop.ID, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "meta")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := RecoverIntents(m.StorageDir, true); err != nil || n != 1 {
+		t.Fatalf("RecoverIntents = %d, %v; want 1, nil", n, err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("half-deleted drop should be deleted")
+	}
+}
+
+func TestRecoverIntents_InterruptedReplace(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	for _, tc := range []struct {
+		name    string
+		newData bool // the new file was renamed into place
+		want    string
+	}{
+		{"before the new file was in place", false, "old"},
+		{"after the new file was in place", true, "new"},
+	} {
+		drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := DropDir(m.StorageDir, drop.ID)
+		data := filepath.Join(dir, "data")
+		if _, err := m.beginIntent(intentReplace, drop.ID, dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(data+".old", []byte("old"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(data); err != nil {
+			t.Fatal(err)
+		}
+		if tc.newData {
+			err = os.WriteFile(data, []byte("new"), 0600)
+		} else {
+			err = os.WriteFile(data+".tmp", []byte("new"), 0600)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := RecoverIntents(m.StorageDir, false); err != nil || n != 1 {
+			t.Fatalf("%s: RecoverIntents = %d, %v; want 1, nil", tc.name, n, err)
+		}
+		got, err := os.ReadFile(data)
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s: data = %q, %v; want %q", tc.name, got, err, tc.want)
+		}
+		for _, leftover := range []string{data + ".old", data + ".tmp"} {
+			if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+				t.Errorf("%s: %s left behind", tc.name, filepath.Base(leftover))
+			}
+		}
+	}
+}
+
+func TestRecoverIntents_IgnoresForeignPaths(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := generateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	intents := filepath.Join(m.StorageDir, intentsDirName)
+	if err := os.MkdirAll(intents, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Records naming the storage dir itself, a path outside it, or another
+	// drop's directory are discarded without touching anything
+	rel, err := filepath.Rel(m.StorageDir, DropDir(m.StorageDir, drop.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"delete-" + drop.ID: ".",
+		"delete-" + other:   "../" + other,
+		"save-" + other:     filepath.ToSlash(rel),
+	} {
+		if err := os.WriteFile(filepath.Join(intents, name), []byte(target), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := RecoverIntents(m.StorageDir, false); err != nil || n != 0 {
+		t.Fatalf("RecoverIntents = %d, %v; want 0, nil", n, err)
+	}
+	if _, err := m.GetDropMetadata(drop.ID); err != nil {
+		t.Errorf("drop touched by foreign records: %v", err)
+	}
+	if records := intentRecords(t, m); len(records) != 0 {
+		t.Errorf("%d foreign records kept", len(records))
+	}
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// ErrLocked is returned by operations that need key material while the
+// manager is locked.
+var ErrLocked = errors.New("storage is locked")
+
+// NewLockedManager creates a storage manager without loading any keys. All
+// drop operations return ErrLocked until Unlock is called, which lets the
+// server start before the master passphrase is supplied.
+func NewLockedManager(storageDir string) (*Manager, error) {
+	if err := os.MkdirAll(storageDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	return &Manager{
+		StorageDir:   storageDir,
+		Locks:        NewDropLockManager(),
+		SecureDelete: true,
+	}, nil
+}
+
+// Unlock loads the encryption and receipt keys, unwrapping them with
+// masterKey, and makes the manager usable. It fails without side effects if
+// the master key cannot unwrap existing key files.
+func (m *Manager) Unlock(masterKey []byte) error {
+	m.keyMu.Lock()
+	defer m.keyMu.Unlock()
+
+	if m.EncryptionKey != nil {
+		return fmt.Errorf("storage is already unlocked")
+	}
+
+	// Verify both existing key files before generating anything, so a wrong
+	// passphrase never leaves a freshly generated key beside an old one
+	for _, k := range []struct{ name, purpose string }{
+		{encryptionKeyFile, "encryption-key"},
+		{receiptKeyFile, "receipt-key"},
+	} {
+		if err := checkKeyFile(filepath.Join(m.StorageDir, k.name), masterKey, []byte(k.purpose)); err != nil {
+			return err
+		}
+	}
+
+	key, err := loadOrGenerateKey(filepath.Join(m.StorageDir, encryptionKeyFile), masterKey, []byte("encryption-key"))
+	if err != nil {
+		return fmt.Errorf("failed to load encryption key: %w", err)
+	}
+	receipts, err := NewReceiptManager(filepath.Join(m.StorageDir, receiptKeyFile), masterKey)
+	if err != nil {
+		ZeroBytes(key)
+		return fmt.Errorf("failed to initialize receipt manager: %w", err)
+	}
+
+	m.EncryptionKey = key
+	m.Receipts = receipts
+	m.touch()
+	return nil
+}
+
+// Lock zeroes the key material and returns the manager to the locked state.
+// It waits for in-flight operations that hold the keys to complete first.
+func (m *Manager) Lock() {
+	m.keyMu.Lock()
+	defer m.keyMu.Unlock()
+
+	ZeroBytes(m.EncryptionKey)
+	m.EncryptionKey = nil
+	m.keyUsage.loaded = false // counted again for whichever key unlocks next
+	if m.Receipts != nil {
+		ZeroBytes(m.Receipts.secret)
+		m.Receipts = nil
+	}
+}
+
+// LastUsed returns when key material was last used by a drop operation or
+// receipt check. Background cleanup does not count as use.
+func (m *Manager) LastUsed() time.Time {
+	return time.Unix(0, m.lastUsed.Load())
+}
+
+func (m *Manager) touch() {
+	m.lastUsed.Store(time.Now().UnixNano())
+}
+
+// Locked reports whether the manager currently holds no key material.
+func (m *Manager) Locked() bool {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	return m.EncryptionKey == nil
+}
+
+// ValidateReceipt checks a receipt for the drop ID. It returns false while
+// the manager is locked.
+func (m *Manager) ValidateReceipt(dropID, receipt string) bool {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.Receipts == nil {
+		return false
+	}
+	m.touch()
+	return m.Receipts.Validate(dropID, receipt)
+}
+
+// Receipt regenerates the receipt of a drop, for delivering it to the source
+// through a second channel after upload. It returns ErrLocked while locked.
+func (m *Manager) Receipt(dropID string) (string, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.Receipts == nil {
+		return "", ErrLocked
+	}
+	return m.Receipts.Generate(dropID), nil
+}
+
+// SubKey derives a key for purpose from the storage encryption key, for data
+// kept outside drops such as the incident log. It returns ErrLocked while
+// locked and, like background cleanup, does not count as key use. The caller
+// should zero the key when done.
+func (m *Manager) SubKey(purpose string) ([]byte, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	return DeriveSubKey(m.EncryptionKey, purpose)
+}
+
+// DeriveSubKey derives the key for purpose from a storage encryption key, as
+// SubKey does. Offline tools use it to re-seal data after key rotation.
+func DeriveSubKey(encryptionKey []byte, purpose string) ([]byte, error) {
+	key := make([]byte, 32)
+	r := hkdf.New(sha256.New, encryptionKey, nil, []byte("dead-drop-"+purpose))
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, fmt.Errorf("failed to derive %s key: %w", purpose, err)
+	}
+	return key, nil
+}
+
+// checkKeyFile verifies that an existing wrapped key file can be unwrapped
+// with masterKey. Missing and plaintext (pre-migration) files pass.
+func checkKeyFile(path string, masterKey, purpose []byte) error {
+	data, err := os.ReadFile(path) // #nosec G304 -- fixed name inside storage dir
+	if err != nil || len(data) != crypto.EncryptedKeySize {
+		return nil
+	}
+	key, err := crypto.DecryptKeyFile(masterKey, data, purpose)
+	if err != nil {
+		return fmt.Errorf("failed to unlock: %w", err)
+	}
+	ZeroBytes(key)
+	return nil
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestLockedManager_RefusesOperations(t *testing.T) {
+	m, err := NewLockedManager(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if !m.Locked() {
+		t.Fatal("new locked manager should be locked")
+	}
+	if _, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("x"))); !errors.Is(err, ErrLocked) {
+		t.Errorf("SaveDrop error = %v, want ErrLocked", err)
+	}
+	if _, _, err := m.GetDrop("0123456789abcdef0123456789abcdef"); !errors.Is(err, ErrLocked) {
+		t.Errorf("GetDrop error = %v, want ErrLocked", err)
+	}
+	if m.ValidateReceipt("0123456789abcdef0123456789abcdef", "x") {
+		t.Error("ValidateReceipt should fail while locked")
+	}
+}
+
+func TestLockedManager_UnlockMatchesNewManager(t *testing.T) {
+	dir := t.TempDir()
+	masterKey := crypto.DeriveMasterKey("pass", make([]byte, 16))
+
+	// Initialize keys the usual way and store a drop
+	m1, err := NewManager(dir, masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop, err := m1.SaveDrop("a.txt", bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1.Close()
+
+	m2, err := NewLockedManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close()
+	if err := m2.Unlock(masterKey); err != nil {
+		t.Fatalf("Unlock error: %v", err)
+	}
+	if m2.Locked() {
+		t.Error("manager should be unlocked")
+	}
+	if !m2.ValidateReceipt(drop.ID, drop.Receipt) {
+		t.Error("receipt should validate after unlock")
+	}
+	if _, _, err := m2.GetDrop(drop.ID); err != nil {
+		t.Errorf("GetDrop after unlock: %v", err)
+	}
+}
+
+func TestLockedManager_WrongKeyLeavesLocked(t *testing.T) {
+	dir := t.TempDir()
+	m1, err := NewManager(dir, crypto.DeriveMasterKey("right", make([]byte, 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1.Close()
+
+	m2, err := NewLockedManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Close()
+
+	if err := m2.Unlock(crypto.DeriveMasterKey("wrong", make([]byte, 16))); err == nil {
+		t.Fatal("Unlock with the wrong key should fail")
+	}
+	if !m2.Locked() {
+		t.Error("manager should remain locked")
+	}
+}
+
+func TestManager_LockZeroesKeys(t *testing.T) {
+	masterKey := crypto.DeriveMasterKey("pass", make([]byte, 16))
+	m, err := NewManager(t.TempDir(), masterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.LastUsed().IsZero() {
+		t.Error("SaveDrop should record key use")
+	}
+
+	key := m.EncryptionKey
+	m.Lock()
+	if !m.Locked() {
+		t.Fatal("manager should be locked")
+	}
+	if !bytes.Equal(key, make([]byte, len(key))) {
+		t.Error("encryption key should be zeroed")
+	}
+	if _, _, err := m.GetDrop(drop.ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("GetDrop error = %v, want ErrLocked", err)
+	}
+
+	if err := m.Unlock(masterKey); err != nil {
+		t.Fatalf("re-unlock: %v", err)
+	}
+	if _, _, err := m.GetDrop(drop.ID); err != nil {
+		t.Errorf("GetDrop after re-unlock: %v", err)
+	}
+}
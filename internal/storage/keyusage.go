@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// keyUsageFile records how much the current storage key has encrypted.
+const keyUsageFile = ".key-usage"
+
+// keyUsageWarnPercent is the share of a limit at which a warning is logged.
+const keyUsageWarnPercent = 80
+
+// ErrKeyExhausted is returned for new drops once the storage key has
+// reached one of its KeyLimits.
+var ErrKeyExhausted = errors.New("storage key reached its usage limit: rotate it with dead-drop-rotate-keys")
+
+// KeyLimits bound how much one storage key may encrypt before it has to be
+// rotated. Every data file and metadata record derives its own AES-GCM key
+// from the storage key and a salt or the drop ID, so no single GCM key comes
+// near its nonce limits; these are operator policy on how much any one key
+// protects. Zero means no limit.
+type KeyLimits struct {
+	MaxBytes    int64 // plaintext bytes of drop data
+	MaxMessages int64 // data files and metadata records written
+}
+
+// KeyUsage is how much the current storage key has encrypted.
+type KeyUsage struct {
+	Bytes    int64 `json:"bytes"`
+	Messages int64 `json:"messages"`
+
+	// Key tags the key the counts belong to, so that they start over when
+	// it is rotated; it is derived from the key and reveals nothing of it
+	Key string `json:"key"`
+}
+
+// keyUsage tracks KeyUsage for a Manager. It is loaded on first use.
+type keyUsage struct {
+	mu     sync.Mutex
+	loaded bool
+	warned bool
+	usage  KeyUsage
+}
+
+// keyUsageTag returns the tag that identifies key in the usage file.
+func keyUsageTag(key []byte) (string, error) {
+	sub, err := DeriveSubKey(key, "key-usage")
+	if err != nil {
+		return "", err
+	}
+	defer ZeroBytes(sub)
+	return hex.EncodeToString(sub[:16]), nil
+}
+
+// loadKeyUsage returns the recorded usage of the current key. With no
+// record for it, as on the first start with tracking or after rotation
+// re-encrypted every drop, the drops on disk are counted as a lower bound.
+// The caller holds keyMu and u.mu.
+func (m *Manager) loadKeyUsage(u *keyUsage) error {
+	if u.loaded {
+		return nil
+	}
+	tag, err := keyUsageTag(m.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(m.StorageDir, keyUsageFile)) // #nosec G304 -- fixed name inside storage dir
+	if err == nil && json.Unmarshal(data, &u.usage) == nil && u.usage.Key == tag {
+		u.loaded = true
+		return nil
+	}
+
+	u.usage = KeyUsage{Key: tag}
+	err = WalkDrops(m.StorageDir, func(id, dir string) error {
+		u.usage.Bytes += dataFileSize(dir)
+		u.usage.Messages += 2 // the data file and the metadata
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to count key usage: %w", err)
+	}
+	u.loaded = true
+	return nil
+}
+
+// KeyUsage returns how much the current storage key has encrypted. It
+// returns ErrLocked while locked.
+func (m *Manager) KeyUsage() (KeyUsage, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return KeyUsage{}, ErrLocked
+	}
+	m.keyUsage.mu.Lock()
+	defer m.keyUsage.mu.Unlock()
+	if err := m.loadKeyUsage(&m.keyUsage); err != nil {
+		return KeyUsage{}, err
+	}
+	return m.keyUsage.usage, nil
+}
+
+// checkKeyUsage returns ErrKeyExhausted if the storage key has reached a
+// limit. The caller holds keyMu.
+func (m *Manager) checkKeyUsage() error {
+	if m.KeyLimits == (KeyLimits{}) {
+		return nil
+	}
+	u := &m.keyUsage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := m.loadKeyUsage(u); err != nil {
+		return err
+	}
+	if reached(u.usage.Bytes, m.KeyLimits.MaxBytes, 100) || reached(u.usage.Messages, m.KeyLimits.MaxMessages, 100) {
+		return ErrKeyExhausted
+	}
+	return nil
+}
+
+// KeyExhausted reports whether new drops are refused until the storage key
+// is rotated. It is false while locked.
+func (m *Manager) KeyExhausted() bool {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	return m.EncryptionKey != nil && errors.Is(m.checkKeyUsage(), ErrKeyExhausted)
+}
+
+// recordKeyUse adds bytes of drop data and messages encrypted under the
+// storage key to its usage, and logs once when a limit comes near. A
+// failure to save the counts is logged, not returned: the data is already
+// written. The caller holds keyMu.
+func (m *Manager) recordKeyUse(bytes, messages int64) {
+	if m.KeyLimits == (KeyLimits{}) {
+		return
+	}
+	u := &m.keyUsage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := m.loadKeyUsage(u); err != nil {
+		log.Printf("Key usage not recorded: %v", err)
+		return
+	}
+	u.usage.Bytes += bytes
+	u.usage.Messages += messages
+
+	if !u.warned && (reached(u.usage.Bytes, m.KeyLimits.MaxBytes, keyUsageWarnPercent) ||
+		reached(u.usage.Messages, m.KeyLimits.MaxMessages, keyUsageWarnPercent)) {
+		u.warned = true
+		log.Printf("WARNING: the storage key has encrypted %d bytes in %d messages, over %d%% of its limit; rotate it with dead-drop-rotate-keys before new drops are refused",
+			u.usage.Bytes, u.usage.Messages, keyUsageWarnPercent)
+	}
+
+	data, err := json.Marshal(u.usage)
+	if err == nil {
+		path := filepath.Join(m.StorageDir, keyUsageFile)
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0600); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		log.Printf("Key usage not saved: %v", err)
+	}
+}
+
+// reached reports whether used is at least percent of limit, which is
+// never the case without a limit.
+func reached(used, limit int64, percent float64) bool {
+	return limit > 0 && float64(used) >= float64(limit)*percent/100
+}
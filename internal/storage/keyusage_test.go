@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyUsage_RefusesAtLimit(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	// Counted from what is already stored when tracking starts
+	if _, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatal(err)
+	}
+	m.KeyLimits = KeyLimits{MaxMessages: 5}
+
+	drop, err := m.SaveDrop("b.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage, err := m.KeyUsage()
+	if err != nil || usage.Messages != 4 {
+		t.Fatalf("KeyUsage = %+v, %v; want 4 messages", usage, err)
+	}
+	if m.KeyExhausted() {
+		t.Error("exhausted below the limit")
+	}
+
+	// Metadata updates still go through at the limit; new drops do not
+	if err := m.SetLegalHold(drop.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SaveDrop("c.txt", bytes.NewReader([]byte("data"))); !errors.Is(err, ErrKeyExhausted) {
+		t.Errorf("SaveDrop at the limit error = %v, want ErrKeyExhausted", err)
+	}
+	if !m.KeyExhausted() {
+		t.Error("not exhausted at the limit")
+	}
+
+	// The counts survive a restart
+	again, err := NewManager(m.StorageDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if usage, err := again.KeyUsage(); err != nil || usage.Messages != 5 {
+		t.Errorf("after restart KeyUsage = %+v, %v; want 5 messages", usage, err)
+	}
+}
+
+func TestKeyUsage_StartsOverForNewKey(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.KeyLimits = KeyLimits{MaxBytes: 1 << 30}
+
+	if _, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data"))); err != nil {
+		t.Fatal(err)
+	}
+	usage, err := m.KeyUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A record left by another key is not trusted; the store is counted again
+	record, err := os.ReadFile(filepath.Join(m.StorageDir, keyUsageFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record = bytes.Replace(record, []byte(usage.Key), []byte("0123456789abcdef0123456789abcdef"), 1)
+	record = bytes.Replace(record, []byte(`"messages":2`), []byte(`"messages":1000`), 1)
+	if err := os.WriteFile(filepath.Join(m.StorageDir, keyUsageFile), record, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m.Lock()
+	if err := m.Unlock(nil); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err := m.KeyUsage(); err != nil || usage.Messages != 2 {
+		t.Errorf("KeyUsage = %+v, %v; want the 2 messages on disk", usage, err)
+	}
+}
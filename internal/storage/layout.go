@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Drops are stored two levels deep, keyed by the first four characters
+// of their ID (drops/ab/cd/abcd...), so that no single directory grows to
+// hundreds of thousands of entries. In IDs with a prefix ("ops-3f9k...") the
+// key starts after the last dash. Stores created before sharding keep
+// their drops directly under the storage directory; those are still found
+// and can be moved with MigrateLayout.
+
+// DropDir returns the sharded directory for a drop ID.
+func DropDir(storageDir, id string) string {
+	key := shardKey(id)
+	return filepath.Join(storageDir, key[0:2], key[2:4], id)
+}
+
+// shardKey returns the random part of a drop ID that its shard directories
+// are named from.
+func shardKey(id string) string {
+	return id[strings.LastIndexByte(id, '-')+1:]
+}
+
+// dropDir returns the directory holding a drop, falling back to the legacy
+// flat layout when the drop has not been migrated. The ID must already be
+// validated.
+func (m *Manager) dropDir(id string) string {
+	dir := DropDir(m.StorageDir, id)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		flat := filepath.Join(m.StorageDir, id)
+		if _, err := os.Stat(flat); err == nil {
+			return flat
+		}
+	}
+	return dir
+}
+
+// isShardName reports whether name is a two-character shard directory.
+func isShardName(name string) bool {
+	return len(name) == 2 && isIDChar(name[0]) && isIDChar(name[1])
+}
+
+// WalkDrops calls fn for every drop directory in storageDir, in either the
+// sharded or the legacy flat layout. Hidden entries (key files, honeypot
+// lists) and anything that is not a valid drop ID are skipped. Walking stops
+// at the first error returned by fn.
+func WalkDrops(storageDir string, fn func(id, dir string) error) error {
+	entries, err := os.ReadDir(storageDir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		if ValidateDropID(name) == nil {
+			if err := fn(name, filepath.Join(storageDir, name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isShardName(name) {
+			continue
+		}
+
+		if err := walkShard(filepath.Join(storageDir, name), name, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkShard visits the drops below a first-level shard directory.
+func walkShard(shardDir, prefix string, fn func(id, dir string) error) error {
+	subs, err := os.ReadDir(shardDir)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if !sub.IsDir() || !isShardName(sub.Name()) {
+			continue
+		}
+		subDir := filepath.Join(shardDir, sub.Name())
+		drops, err := os.ReadDir(subDir)
+		if err != nil {
+			return err
+		}
+		for _, d := range drops {
+			id := d.Name()
+			if !d.IsDir() || ValidateDropID(id) != nil || shardKey(id)[0:4] != prefix+sub.Name() {
+				continue
+			}
+			if err := fn(id, filepath.Join(subDir, id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateLayout moves drops stored in the legacy flat layout into their
+// shard directories, returning the number moved. It must run before the
+// storage manager serves requests; drops are renamed within the same
+// filesystem, so an interrupted migration leaves every drop readable.
+func MigrateLayout(storageDir string) (int, error) {
+	var flat []string
+	err := WalkDrops(storageDir, func(id, dir string) error {
+		if filepath.Dir(dir) == filepath.Clean(storageDir) {
+			flat = append(flat, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for _, id := range flat {
+		target := DropDir(storageDir, id)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return moved, fmt.Errorf("failed to create shard directory: %w", err)
+		}
+		if _, err := os.Stat(target); err == nil {
+			return moved, fmt.Errorf("drop %s exists in both layouts", id)
+		}
+		if err := os.Rename(filepath.Join(storageDir, id), target); err != nil {
+			return moved, fmt.Errorf("failed to move drop %s: %w", id, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestSaveDrop_ShardedLayout(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(dir, nil)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("test.txt", bytes.NewReader([]byte("sharded")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(dir, drop.ID[0:2], drop.ID[2:4], drop.ID)
+	if _, err := os.Stat(filepath.Join(want, "data")); err != nil {
+		t.Fatalf("drop should be stored at %s: %v", want, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, drop.ID)); !os.IsNotExist(err) {
+		t.Error("drop should not be stored in the flat layout")
+	}
+}
+
+// flattenDrop moves a drop back into the legacy flat layout.
+func flattenDrop(t *testing.T, dir, id string) {
+	t.Helper()
+	if err := os.Rename(DropDir(dir, id), filepath.Join(dir, id)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetDrop_LegacyFlatLayout(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(dir, nil)
+	defer m.Close()
+	m.SecureDelete = false
+
+	drop, _ := m.SaveDrop("test.txt", bytes.NewReader([]byte("flat data")))
+	flattenDrop(t, dir, drop.ID)
+
+	_, reader, err := m.GetDrop(drop.ID)
+	if err != nil {
+		t.Fatalf("GetDrop from flat layout error: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(got) != "flat data" {
+		t.Errorf("content = %q", got)
+	}
+
+	if err := m.DeleteDrop(drop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, drop.ID)); !os.IsNotExist(err) {
+		t.Error("flat drop directory should be removed")
+	}
+}
+
+func TestWalkDrops_BothLayouts(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(dir, nil)
+	defer m.Close()
+
+	sharded, _ := m.SaveDrop("a.txt", bytes.NewReader([]byte("a")))
+	flat, _ := m.SaveDrop("b.txt", bytes.NewReader([]byte("b")))
+	flattenDrop(t, dir, flat.ID)
+
+	// Noise that must be ignored
+	os.MkdirAll(filepath.Join(dir, ".hidden"), 0700)
+	os.MkdirAll(filepath.Join(dir, "zz", "yy", "notadrop"), 0700)
+	os.MkdirAll(filepath.Join(dir, "ab", "cd", "1234567890abcdef1234567890abcdef"), 0700) // wrong shard
+
+	var ids []string
+	err := WalkDrops(dir, func(id, dropDir string) error {
+		if filepath.Base(dropDir) != id {
+			t.Errorf("dir %s does not match id %s", dropDir, id)
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{sharded.ID, flat.ID}
+	sort.Strings(ids)
+	sort.Strings(want)
+	if len(ids) != 2 || ids[0] != want[0] || ids[1] != want[1] {
+		t.Errorf("WalkDrops visited %v, want %v", ids, want)
+	}
+}
+
+func TestMigrateLayout(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(dir, nil)
+	defer m.Close()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		drop, _ := m.SaveDrop("f.txt", bytes.NewReader([]byte("migrate")))
+		flattenDrop(t, dir, drop.ID)
+		ids = append(ids, drop.ID)
+	}
+
+	moved, err := MigrateLayout(dir)
+	if err != nil {
+		t.Fatalf("MigrateLayout error: %v", err)
+	}
+	if moved != 3 {
+		t.Errorf("moved = %d, want 3", moved)
+	}
+
+	for _, id := range ids {
+		if _, err := os.Stat(filepath.Join(DropDir(dir, id), "meta")); err != nil {
+			t.Errorf("drop %s not in shard directory: %v", id, err)
+		}
+		if _, _, err := m.GetDrop(id); err != nil {
+			t.Errorf("GetDrop after migration: %v", err)
+		}
+	}
+
+	// Key files stay where they are
+	if _, err := os.Stat(filepath.Join(dir, encryptionKeyFile)); err != nil {
+		t.Errorf("key file should not move: %v", err)
+	}
+
+	// Second pass is a no-op
+	if moved, err := MigrateLayout(dir); err != nil || moved != 0 {
+		t.Errorf("second MigrateLayout = %d, %v; want 0, nil", moved, err)
+	}
+}
+
+func TestNewQuotaManager_ScansShardedDrops(t *testing.T) {
+	dir := t.TempDir()
+
+	sharded := DropDir(dir, "abcdef0123456789abcdef0123456789")
+	os.MkdirAll(sharded, 0700)
+	os.WriteFile(filepath.Join(sharded, "data"), make([]byte, 1000), 0600)
+
+	flat := filepath.Join(dir, "1234567890abcdef1234567890abcdef")
+	os.MkdirAll(flat, 0700)
+	os.WriteFile(filepath.Join(flat, "data"), make([]byte, 500), 0600)
+
+	qm, err := NewQuotaManager(dir, 1.0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	totalBytes, dropCount := qm.Stats()
+	if totalBytes != 1500 || dropCount != 2 {
+		t.Errorf("Stats = %d bytes, %d drops; want 1500, 2", totalBytes, dropCount)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+)
+
+// ErrLegalHold is returned when deleting a drop that is under legal hold.
+var ErrLegalHold = errors.New("drop is under legal hold")
+
+// SetLegalHold places or lifts a legal hold on a drop. Held drops are skipped
+// by cleanup and refused by DeleteDrop. The hold is stored in the drop's
+// encrypted metadata, so it survives restarts without revealing on disk
+// which drops are of interest.
+func (m *Manager) SetLegalHold(id string, hold bool) error {
+	return m.updateMetadata(id, func(payload *MetadataPayload) bool {
+		if payload.LegalHold == hold {
+			return false
+		}
+		payload.LegalHold = hold
+		m.expiry.set(id, indexEntry(m.dropDir(id), payload))
+		return true
+	})
+}
+
+// MarkHoneypot records in a drop's encrypted metadata that it is a honeypot
+// decoy, so that cleanup, campaign counts and offline tools recognize it
+// without the server's honeypot list. Drops saved with SaveOptions.Honeypot
+// are marked already.
+func (m *Manager) MarkHoneypot(id string) error {
+	return m.updateMetadata(id, func(payload *MetadataPayload) bool {
+		if payload.Honeypot {
+			return false
+		}
+		payload.Honeypot = true
+		m.expiry.set(id, indexEntry(m.dropDir(id), payload))
+		return true
+	})
+}
+
+// LegalHolds returns the IDs of all drops under legal hold, sorted.
+func (m *Manager) LegalHolds() ([]string, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	var held []string
+	err := WalkDrops(m.StorageDir, func(id, dir string) error {
+		payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, id)
+		if err == nil && payload.LegalHold {
+			held = append(held, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(held)
+	return held, nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DropListing is what the encrypted index records about a drop: enough to
+// page through a large store and pick out drops without decrypting their
+// metadata.
+type DropListing struct {
+	ID            string `json:"id"`
+	Size          int64  `json:"size"` // encrypted size on disk
+	TimestampHour int64  `json:"timestamp_hour"`
+	Retention     string `json:"retention,omitempty"`
+	Campaign      string `json:"campaign,omitempty"`
+	LegalHold     bool   `json:"legal_hold,omitempty"`
+	Honeypot      bool   `json:"honeypot,omitempty"`
+	ExpiresHour   int64  `json:"expires_hour,omitempty"` // chosen by the uploader
+}
+
+// ListFilter narrows ListDrops. The zero value matches every drop.
+type ListFilter struct {
+	Campaign    string        // only drops under this campaign code
+	OlderThan   time.Duration // only drops received at least this long ago
+	NewerThan   time.Duration // only drops received less than this long ago
+	LegalHold   bool          // only drops under legal hold
+	NoHoneypots bool          // leave out honeypot decoys
+}
+
+func (f ListFilter) match(e expiryEntry, now time.Time) bool {
+	age := now.Sub(time.Unix(e.Hour, 0))
+	switch {
+	case f.Campaign != "" && e.Campaign != f.Campaign,
+		f.OlderThan > 0 && age < f.OlderThan,
+		f.NewerThan > 0 && age >= f.NewerThan,
+		f.LegalHold && !e.Hold,
+		f.NoHoneypots && e.Honeypot:
+		return false
+	}
+	return true
+}
+
+// ListDrops returns the drops matching filter, sorted by ID, skipping the
+// first offset and returning at most limit (0 = no limit), along with the
+// number of matching drops. It reads the encrypted index that cleanup and
+// campaign counts use, so no drop's metadata is decrypted. Quarantined
+// drops are not listed.
+func (m *Manager) ListDrops(offset, limit int, filter ListFilter) ([]DropListing, int, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, 0, ErrLocked
+	}
+	m.touch()
+	return m.listDrops(offset, limit, filter)
+}
+
+// listDrops is ListDrops for callers holding keyMu on an unlocked manager.
+func (m *Manager) listDrops(offset, limit int, filter ListFilter) ([]DropListing, int, error) {
+	now := time.Now()
+	var drops []DropListing
+	err := m.eachIndexed(func(id string, e expiryEntry) {
+		if filter.match(e, now) {
+			drops = append(drops, DropListing{
+				ID:            id,
+				Size:          e.Size,
+				TimestampHour: e.Hour,
+				Retention:     e.Retention,
+				Campaign:      e.Campaign,
+				LegalHold:     e.Hold,
+				Honeypot:      e.Honeypot,
+				ExpiresHour:   e.Expires,
+			})
+		}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Slice(drops, func(i, j int) bool { return drops[i].ID < drops[j].ID })
+
+	total := len(drops)
+	offset = min(max(offset, 0), total)
+	drops = drops[offset:]
+	if limit > 0 && limit < len(drops) {
+		drops = drops[:limit]
+	}
+	return drops, total, nil
+}
+
+// DropsPage returns the summaries, with notes, of the drops that ListDrops
+// would return, and the number of matching drops. Only the metadata of the
+// drops on the page is decrypted; drops whose metadata cannot be read are
+// left out.
+func (m *Manager) DropsPage(offset, limit int, filter ListFilter) ([]DropSummary, int, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, 0, ErrLocked
+	}
+	m.touch()
+
+	listed, total, err := m.listDrops(offset, limit, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	drops := make([]DropSummary, 0, len(listed))
+	for _, d := range listed {
+		dir := m.dropDir(d.ID)
+		payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, d.ID)
+		if err != nil {
+			continue
+		}
+		drops = append(drops, summarize(d.ID, dir, payload))
+	}
+	return drops, total, nil
+}
+
+// EachDrop calls fn with the age and stored size of every drop in the
+// index, honeypot decoys left out, for the metrics' distributions. Ages
+// count from the hour a drop was received. It fails with ErrLocked while
+// the store is locked, and unlike ListDrops does not count as activity for
+// the idle relock, so that scrapes do not keep the store unlocked.
+func (m *Manager) EachDrop(fn func(age time.Duration, size int64)) error {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+	now := time.Now()
+	return m.eachIndexed(func(_ string, e expiryEntry) {
+		if !e.Honeypot {
+			fn(now.Sub(time.Unix(e.Hour, 0)), e.Size)
+		}
+	})
+}
+
+// eachIndexed calls fn for every drop in the index, loading the index first
+// if needed. fn runs with the index locked. The caller holds keyMu and has
+// checked that the manager is unlocked.
+func (m *Manager) eachIndexed(fn func(id string, e expiryEntry)) error {
+	if err := m.loadExpiryIndex(); err != nil {
+		return err
+	}
+	m.expiry.mu.Lock()
+	defer m.expiry.mu.Unlock()
+	for id, e := range m.expiry.entries {
+		fn(id, e)
+	}
+	return nil
+}
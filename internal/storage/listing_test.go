@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListDrops(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	var ids []string
+	for i, campaign := range []string{"payroll", "", "payroll", "payroll"} {
+		drop, err := m.SaveDropWithOptions("f.txt", bytes.NewReader(bytes.Repeat([]byte("x"), i+1)), &SaveOptions{Campaign: campaign})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, drop.ID)
+	}
+	if _, err := m.SaveDropWithOptions("decoy.txt", bytes.NewReader([]byte("decoy")), &SaveOptions{Honeypot: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetLegalHold(ids[3], true); err != nil {
+		t.Fatal(err)
+	}
+	// One payroll drop is a month old
+	if err := m.loadExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+	m.expiry.set(ids[2], expiryEntry{Hour: time.Now().Add(-30 * 24 * time.Hour).Unix(), Campaign: "payroll", Size: 1})
+
+	all, total, err := m.ListDrops(0, 0, ListFilter{})
+	if err != nil || total != 5 || len(all) != 5 {
+		t.Fatalf("ListDrops = %d of %d, %v; want all 5", len(all), total, err)
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i-1].ID >= all[i].ID {
+			t.Fatal("ListDrops not sorted by ID")
+		}
+	}
+
+	// Pages cover the listing without overlap
+	first, _, _ := m.ListDrops(0, 2, ListFilter{})
+	rest, total, _ := m.ListDrops(2, 10, ListFilter{})
+	if len(first) != 2 || len(rest) != 3 || total != 5 || first[1].ID != all[1].ID || rest[0].ID != all[2].ID {
+		t.Errorf("pages = %v, %v", first, rest)
+	}
+	if past, total, _ := m.ListDrops(9, 2, ListFilter{}); len(past) != 0 || total != 5 {
+		t.Errorf("page past the end = %v, total %d", past, total)
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   int
+	}{
+		{"campaign", ListFilter{Campaign: "payroll"}, 3},
+		{"older", ListFilter{OlderThan: 7 * 24 * time.Hour}, 1},
+		{"newer", ListFilter{Campaign: "payroll", NewerThan: 7 * 24 * time.Hour}, 2},
+		{"legal hold", ListFilter{LegalHold: true}, 1},
+		{"no honeypots", ListFilter{NoHoneypots: true}, 4},
+	}
+	for _, tt := range tests {
+		if _, total, _ := m.ListDrops(0, 0, tt.filter); total != tt.want {
+			t.Errorf("%s: %d drops, want %d", tt.name, total, tt.want)
+		}
+	}
+}
+
+func TestListDrops_DoesNotDecryptMetadata(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("f.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.ListDrops(0, 0, ListFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	// Once the index is loaded, unreadable metadata does not affect listings
+	if err := os.WriteFile(filepath.Join(m.dropDir(drop.ID), "meta"), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	listed, total, err := m.ListDrops(0, 0, ListFilter{})
+	if err != nil || total != 1 || listed[0].ID != drop.ID {
+		t.Errorf("ListDrops = %v, %d, %v", listed, total, err)
+	}
+
+	// Summaries decrypt, and leave out what they cannot read
+	if drops, total, _ := m.DropsPage(0, 0, ListFilter{}); len(drops) != 0 || total != 1 {
+		t.Errorf("DropsPage = %v, total %d", drops, total)
+	}
+}
+
+func TestEachDrop(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDropWithOptions("f.txt", bytes.NewReader([]byte("contents")), &SaveOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SaveDropWithOptions("decoy.txt", bytes.NewReader([]byte("decoy")), &SaveOptions{Honeypot: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.loadExpiryIndex(); err != nil {
+		t.Fatal(err)
+	}
+	m.expiry.set(drop.ID, expiryEntry{Hour: time.Now().Add(-50 * time.Hour).Unix(), Size: 1234})
+
+	var ages []time.Duration
+	var sizes []int64
+	if err := m.EachDrop(func(age time.Duration, size int64) {
+		ages = append(ages, age)
+		sizes = append(sizes, size)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ages) != 1 || ages[0] < 50*time.Hour || ages[0] > 51*time.Hour || sizes[0] != 1234 {
+		t.Errorf("EachDrop saw ages %v, sizes %v; want the one real drop, 50h, 1234 bytes", ages, sizes)
+	}
+}
@@ -12,10 +12,22 @@ import (
 	"time"
 
 	"golang.org/x/crypto/hkdf"
+
+	"github.com/scttfrdmn/dead-drop/internal/faultinject"
+	"github.com/scttfrdmn/dead-drop/internal/triage"
 )
 
 const metadataVersion = 1
 
+// FlagHighEntropy marks an undeclared upload that looks like ciphertext or random data.
+const FlagHighEntropy = "high_entropy"
+
+// FlagCanary marks an upload matching a registered canary document.
+const FlagCanary = "canary"
+
+// FlagTextSanitized marks a plain-text upload that had tracking artifacts removed.
+const FlagTextSanitized = "text_sanitized"
+
 // EncryptedMetadata is the on-disk JSON envelope for encrypted metadata.
 type EncryptedMetadata struct {
 	Version       int    `json:"version"`
@@ -29,6 +41,36 @@ type MetadataPayload struct {
 	Receipt       string `json:"receipt"`
 	TimestampHour int64  `json:"timestamp_hour"` // Unix timestamp rounded to hour
 	FileHash      string `json:"file_hash,omitempty"`
+	FuzzyHash     string `json:"fuzzy_hash,omitempty"` // ssdeep, if enabled at upload
+	Message       string `json:"message,omitempty"`    // the source's text, returned as message.txt
+
+	ClientEncrypted bool     `json:"client_encrypted,omitempty"`
+	KeyFingerprint  string   `json:"key_fingerprint,omitempty"` // of the client-side key, never the key
+	ContentType     string   `json:"content_type,omitempty"`    // declared or sniffed at upload, see SaveOptions
+	Flags           []string `json:"flags,omitempty"`
+	Canary          string   `json:"canary,omitempty"` // name of the matched canary document
+	Scrubbed        string   `json:"scrubbed,omitempty"`
+
+	Retention string `json:"retention,omitempty"`
+	Campaign  string `json:"campaign,omitempty"`
+	LegalHold bool   `json:"legal_hold,omitempty"`
+	Honeypot  bool   `json:"honeypot,omitempty"` // decoy drop; never expires
+	Note      *Note  `json:"note,omitempty"`
+
+	// ExpiresHour is when the uploader asked for the drop to be deleted, as
+	// a Unix timestamp on the hour, or zero
+	ExpiresHour int64 `json:"expires_hour,omitempty"`
+
+	// PassphraseSalt is the Argon2id salt of the source's passphrase when
+	// the data also has an inner layer encrypted with a key derived from it
+	PassphraseSalt []byte `json:"passphrase_salt,omitempty"`
+
+	// Processing is ProcessingPending until an asynchronous worker has
+	// checked the drop, ProcessingFailed if the checks failed, or empty
+	Processing string `json:"processing,omitempty"`
+	Quarantine string `json:"quarantine,omitempty"` // why the drop was quarantined
+
+	Stats *triage.Stats `json:"stats,omitempty"` // triage statistics, if enabled at upload
 }
 
 // deriveMetadataKey derives a per-drop metadata key using HKDF from the storage key + drop ID.
@@ -89,6 +131,9 @@ func saveEncryptedMetadata(path string, storageKey []byte, dropID string, payloa
 		return fmt.Errorf("failed to marshal envelope: %w", err)
 	}
 
+	if err := faultinject.Check(faultinject.StorageWrite); err != nil {
+		return err
+	}
 	return os.WriteFile(path, envelopeJSON, 0600)
 }
 
@@ -112,6 +157,35 @@ func loadEncryptedMetadata(path string, storageKey []byte, dropID string) (*Meta
 	return decryptMetadataEnvelope(&envelope, storageKey, dropID)
 }
 
+// RekeyMetadata re-encrypts the metadata file at path from oldKey to newKey,
+// the storage keys before and after a key rotation, replacing the file
+// atomically. Metadata that already opens with newKey is left as it is, so an
+// interrupted rotation can be run again. With dryRun it only checks that the
+// metadata opens with one of the keys.
+func RekeyMetadata(path, dropID string, oldKey, newKey []byte, dryRun bool) error {
+	payload, err := loadEncryptedMetadata(path, oldKey, dropID)
+	if err != nil {
+		if _, nerr := loadEncryptedMetadata(path, newKey, dropID); nerr == nil {
+			return nil
+		}
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	tmp := path + ".rekey.tmp"
+	if err := saveEncryptedMetadata(tmp, newKey, dropID, payload); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace metadata: %w", err)
+	}
+	return nil
+}
+
 func decryptMetadataEnvelope(envelope *EncryptedMetadata, storageKey []byte, dropID string) (*MetadataPayload, error) {
 	metaKey, err := deriveMetadataKey(storageKey, dropID)
 	if err != nil {
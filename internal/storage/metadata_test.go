@@ -205,3 +205,51 @@ func TestSaveEncryptedMetadata_DifferentDropID(t *testing.T) {
 		t.Error("loading with wrong dropID should fail")
 	}
 }
+
+func TestRekeyMetadata(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "meta")
+	oldKey := testStorageKey(t)
+	newKey := make([]byte, 32)
+	for i := range newKey {
+		newKey[i] = byte(255 - i)
+	}
+	dropID := "abcdef0123456789abcdef0123456789"
+
+	payload := &MetadataPayload{Filename: "test.txt", Receipt: "r1", TimestampHour: 1700000000}
+	if err := saveEncryptedMetadata(path, oldKey, dropID, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run leaves the file under the old key
+	if err := RekeyMetadata(path, dropID, oldKey, newKey, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if _, err := loadEncryptedMetadata(path, oldKey, dropID); err != nil {
+		t.Fatalf("dry run changed the metadata: %v", err)
+	}
+
+	if err := RekeyMetadata(path, dropID, oldKey, newKey, false); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	loaded, err := loadEncryptedMetadata(path, newKey, dropID)
+	if err != nil {
+		t.Fatalf("load with new key: %v", err)
+	}
+	if loaded.Receipt != "r1" {
+		t.Errorf("Receipt = %q, want r1", loaded.Receipt)
+	}
+
+	// Running again is a no-op
+	if err := RekeyMetadata(path, dropID, oldKey, newKey, false); err != nil {
+		t.Errorf("second rekey: %v", err)
+	}
+
+	// Metadata under neither key is an error
+	if err := RekeyMetadata(path, dropID, oldKey, oldKey, false); err == nil {
+		t.Error("rekey with the wrong keys should fail")
+	}
+	if _, err := os.Stat(path + ".rekey.tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
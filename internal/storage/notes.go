@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/scttfrdmn/dead-drop/internal/triage"
+)
+
+// Limits on note fields, so that notes stay triage annotations rather than
+// a second document store.
+const (
+	MaxNoteStatus   = 32
+	MaxNoteInitials = 8
+	MaxNoteText     = 1024
+)
+
+// ErrNoteTooLong is returned when a note field exceeds its limit.
+var ErrNoteTooLong = errors.New("note field too long")
+
+// Note is a receiver's triage annotation on a drop (status, initials of the
+// reviewer, short text). It is kept in the drop's encrypted metadata, so it
+// is encrypted at rest like the filename and goes when the drop goes.
+type Note struct {
+	Status      string `json:"status,omitempty"`
+	Initials    string `json:"initials,omitempty"`
+	Text        string `json:"text,omitempty"`
+	UpdatedHour int64  `json:"updated_hour"` // Unix timestamp rounded to hour
+}
+
+// DropSummary describes a drop for receiver listings. It omits the filename
+// and receipt.
+type DropSummary struct {
+	ID            string `json:"id"`
+	Size          int64  `json:"size"` // encrypted size on disk
+	TimestampHour int64  `json:"timestamp_hour"`
+	Retention     string `json:"retention,omitempty"`
+	Campaign      string `json:"campaign,omitempty"`
+	LegalHold     bool   `json:"legal_hold,omitempty"`
+	Processing    string `json:"processing,omitempty"` // pending or failed
+	Quarantine    string `json:"quarantine,omitempty"` // reason, for quarantined drops
+	Note          *Note  `json:"note,omitempty"`
+
+	Stats *triage.Stats `json:"stats,omitempty"`
+
+	Replied bool `json:"replied,omitempty"` // a reply waits for the source
+}
+
+// SetNote attaches note to a drop, replacing any earlier note. A nil note
+// removes it.
+func (m *Manager) SetNote(id string, note *Note) error {
+	if note != nil {
+		if len(note.Status) > MaxNoteStatus || len(note.Initials) > MaxNoteInitials || len(note.Text) > MaxNoteText {
+			return ErrNoteTooLong
+		}
+		n := *note
+		n.UpdatedHour = roundToHour(time.Now()).Unix()
+		note = &n
+	}
+	return m.updateMetadata(id, func(payload *MetadataPayload) bool {
+		if payload.Note == nil && note == nil {
+			return false
+		}
+		payload.Note = note
+		return true
+	})
+}
+
+// Drops returns a summary of every drop, with its note, sorted by ID.
+// Drops whose metadata cannot be read are left out.
+func (m *Manager) Drops() ([]DropSummary, error) {
+	drops, _, err := m.DropsPage(0, 0, ListFilter{})
+	return drops, err
+}
+
+// DropInfo is a drop's metadata for operator inspection. It never includes
+// the receipt or the contents.
+type DropInfo struct {
+	DropSummary
+	Filename        string   `json:"filename"`
+	FileHash        string   `json:"file_hash,omitempty"`
+	FuzzyHash       string   `json:"fuzzy_hash,omitempty"`
+	ClientEncrypted bool     `json:"client_encrypted,omitempty"`
+	KeyFingerprint  string   `json:"key_fingerprint,omitempty"`
+	Flags           []string `json:"flags,omitempty"`
+	Canary          string   `json:"canary,omitempty"`
+	Scrubbed        string   `json:"scrubbed,omitempty"`
+	Honeypot        bool     `json:"honeypot,omitempty"`
+}
+
+// Inspect returns a drop's metadata without decrypting its contents. Drops
+// in quarantine are found too.
+func (m *Manager) Inspect(id string) (*DropInfo, error) {
+	if err := ValidateDropID(id); err != nil {
+		return nil, fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	dir := m.dropDir(id)
+	if m.inQuarantine(id) {
+		dir = m.quarantineDir(id)
+	}
+	payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, id)
+	if err != nil {
+		return nil, err
+	}
+	return &DropInfo{
+		DropSummary:     summarize(id, dir, payload),
+		Filename:        payload.Filename,
+		FileHash:        payload.FileHash,
+		FuzzyHash:       payload.FuzzyHash,
+		ClientEncrypted: payload.ClientEncrypted,
+		KeyFingerprint:  payload.KeyFingerprint,
+		Flags:           payload.Flags,
+		Canary:          payload.Canary,
+		Scrubbed:        payload.Scrubbed,
+		Honeypot:        payload.Honeypot,
+	}, nil
+}
+
+// summarize builds the listing entry for the drop in dir.
+func summarize(id, dir string, payload *MetadataPayload) DropSummary {
+	return DropSummary{
+		ID:            id,
+		Size:          dataFileSize(dir),
+		TimestampHour: payload.TimestampHour,
+		Retention:     payload.Retention,
+		Campaign:      payload.Campaign,
+		LegalHold:     payload.LegalHold,
+		Processing:    payload.Processing,
+		Quarantine:    payload.Quarantine,
+		Note:          payload.Note,
+		Stats:         payload.Stats,
+		Replied:       hasReply(dir),
+	}
+}
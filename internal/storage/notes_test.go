@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetNote(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	a, _ := m.SaveDrop("a.txt", bytes.NewReader([]byte("a")))
+	b, _ := m.SaveDrop("b.txt", bytes.NewReader([]byte("b")))
+
+	if err := m.SetNote(a.ID, &Note{Status: "reviewing", Initials: "JD", Text: "call source back"}); err != nil {
+		t.Fatalf("SetNote error: %v", err)
+	}
+
+	drops, err := m.Drops()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drops) != 2 {
+		t.Fatalf("Drops returned %d, want 2", len(drops))
+	}
+	for _, d := range drops {
+		switch d.ID {
+		case a.ID:
+			if d.Note == nil || d.Note.Status != "reviewing" || d.Note.Initials != "JD" || d.Note.UpdatedHour == 0 {
+				t.Errorf("note on %s = %+v", d.ID, d.Note)
+			}
+		case b.ID:
+			if d.Note != nil {
+				t.Errorf("unexpected note on %s: %+v", d.ID, d.Note)
+			}
+		}
+	}
+
+	// The note is encrypted with the rest of the metadata
+	meta, err := m.GetDropMetadata(a.ID)
+	if err != nil || meta.Note == nil || meta.Note.Text != "call source back" {
+		t.Fatalf("GetDropMetadata note = %+v, %v", meta, err)
+	}
+	raw, err := os.ReadFile(filepath.Join(DropDir(m.StorageDir, a.ID), "meta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("call source back")) {
+		t.Error("note stored in plaintext")
+	}
+
+	if err := m.SetNote(a.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := m.GetDropMetadata(a.ID); meta.Note != nil {
+		t.Errorf("note should be cleared, got %+v", meta.Note)
+	}
+
+	if err := m.SetNote(a.ID, &Note{Text: strings.Repeat("x", MaxNoteText+1)}); !errors.Is(err, ErrNoteTooLong) {
+		t.Errorf("long note error = %v, want ErrNoteTooLong", err)
+	}
+}
+
+func TestDrops_TriageStats(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	plain, _ := m.SaveDrop("a.txt", bytes.NewReader([]byte("not summarized")))
+	m.TriageStats = true
+	summarized, _ := m.SaveDrop("b.txt", bytes.NewReader([]byte("three short words")))
+
+	drops, err := m.Drops()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range drops {
+		switch d.ID {
+		case plain.ID:
+			if d.Stats != nil {
+				t.Errorf("stats recorded while disabled: %+v", d.Stats)
+			}
+		case summarized.ID:
+			if d.Stats == nil || d.Stats.Type != "text/plain" || d.Stats.Words != 3 {
+				t.Errorf("stats = %+v, want 3 words of text/plain", d.Stats)
+			}
+		}
+	}
+}
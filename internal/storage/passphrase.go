@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// passphraseSaltSize is the size of the Argon2id salt of a drop passphrase.
+const passphraseSaltSize = 16
+
+var (
+	// ErrPassphraseRequired is returned when opening a passphrase-protected
+	// drop without its passphrase.
+	ErrPassphraseRequired = errors.New("drop is protected by a passphrase")
+	// ErrWrongPassphrase is returned when the passphrase given does not open
+	// the drop.
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+)
+
+// A passphrase-protected drop's data is encrypted twice: first with a key
+// derived from the source's passphrase, then with the storage key like any
+// other drop. Rekeying, integrity checks and secure deletion only ever see
+// the outer layer, so they work unchanged, while the plaintext cannot be
+// read with the storage key alone. Only the Argon2id salt is kept, in the
+// drop's encrypted metadata.
+
+// newPassphraseKey returns a fresh salt and the drop key derived from
+// passphrase with it.
+func newPassphraseKey(passphrase string) (salt, key []byte, err error) {
+	salt = make([]byte, passphraseSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return salt, crypto.DeriveDropKey(passphrase, salt), nil
+}
+
+// encryptData encrypts r into w with key, adding an inner layer under
+// passKey if it is not nil.
+func encryptData(key, passKey []byte, r io.Reader, w io.Writer, aad []byte) error {
+	if passKey == nil {
+		return crypto.EncryptStream(key, r, w, aad)
+	}
+	outer, err := crypto.NewEncryptWriter(key, w, aad)
+	if err != nil {
+		return err
+	}
+	if err := crypto.EncryptStream(passKey, r, outer, aad); err != nil {
+		_ = outer.Close()
+		return err
+	}
+	return outer.Close()
+}
+
+// GetDropWithPassphrase is GetDropWithMetadata for a drop that may be
+// protected by a passphrase. The passphrase is ignored for a drop without
+// one. A wrong passphrase is reported as ErrWrongPassphrase before any of
+// the contents are returned.
+func (m *Manager) GetDropWithPassphrase(id, passphrase string) (*MetadataPayload, io.ReadCloser, error) {
+	payload, reader, err := m.openDrop(id, retrievable(passphrase))
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload.PassphraseSalt == nil {
+		return payload, m.verified(payload.FileHash, reader), nil
+	}
+
+	// The inner layer's first chunk is opened here, so a wrong passphrase
+	// fails before the caller has sent anything
+	key := crypto.DeriveDropKey(passphrase, payload.PassphraseSalt)
+	defer ZeroBytes(key)
+	plaintext, err := crypto.NewDecryptReader(key, reader, []byte(id))
+	if err != nil {
+		_ = reader.Close()
+		return nil, nil, ErrWrongPassphrase
+	}
+	return payload, m.verified(payload.FileHash, &innerReader{Reader: plaintext, Closer: reader}), nil
+}
+
+// retrievable returns the check that a drop may be handed out with
+// passphrase: it is not waiting for processing, and the passphrase is given
+// if the drop needs one.
+func retrievable(passphrase string) func(*MetadataPayload) error {
+	return func(payload *MetadataPayload) error {
+		if payload.Processing == ProcessingPending {
+			return ErrPending
+		}
+		if payload.PassphraseSalt != nil && passphrase == "" {
+			return ErrPassphraseRequired
+		}
+		return nil
+	}
+}
+
+// innerReader reads the inner layer of a passphrase-protected drop, closing
+// the drop's data file with it.
+type innerReader struct {
+	io.Reader
+	io.Closer
+}
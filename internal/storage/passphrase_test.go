@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPassphrase_RoundTrip(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	quota, err := NewQuotaManager(m.StorageDir, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Quota = quota
+
+	content := []byte("protected contents")
+	drop, err := m.SaveDropWithOptions("a.txt", bytes.NewReader(content), &SaveOptions{Passphrase: "correct horse"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := m.GetDropWithMetadata(drop.ID); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("GetDropWithMetadata error = %v, want ErrPassphraseRequired", err)
+	}
+	if _, _, err := m.GetDropWithPassphrase(drop.ID, "wrong horse"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase error = %v, want ErrWrongPassphrase", err)
+	}
+
+	payload, reader, err := m.GetDropWithPassphrase(drop.ID, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(reader)
+	_ = reader.Close()
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("contents = %q, %v; want %q", got, err, content)
+	}
+	if payload.Filename != "a.txt" || len(payload.PassphraseSalt) != passphraseSaltSize {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// The quota holds what is on disk, two layers of it
+	stored, err := m.StoredSize(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := quota.Stats(); used != stored {
+		t.Errorf("quota used = %d, want stored size %d", used, stored)
+	}
+}
+
+func TestPassphrase_IgnoredWithoutProtection(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader([]byte("data")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := m.GetDropWithPassphrase(drop.ID, "anything")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(reader)
+	_ = reader.Close()
+	if string(got) != "data" {
+		t.Errorf("contents = %q", got)
+	}
+}
+
+func TestPassphrase_NotPending(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	if _, err := m.SaveDropWithOptions("a.txt", bytes.NewReader([]byte("data")), &SaveOptions{Passphrase: "p", Pending: true}); err == nil {
+		t.Error("pending passphrase-protected drop accepted")
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/faultinject"
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+	"github.com/scttfrdmn/dead-drop/internal/triage"
+)
+
+// Processing states of a drop saved with SaveOptions.Pending. A drop that
+// completed processing has none.
+const (
+	ProcessingPending = "pending"
+	ProcessingFailed  = "failed"
+)
+
+var (
+	// ErrPending is returned by GetDrop for a drop still waiting for
+	// asynchronous processing.
+	ErrPending = errors.New("drop is waiting for processing")
+	// ErrNotPending is returned when processing a drop that is not waiting
+	// for it, for instance because it was deleted or processed meanwhile.
+	ErrNotPending = errors.New("drop is not waiting for processing")
+)
+
+// GetPendingDrop decrypts a drop waiting for asynchronous processing, for
+// the worker that checks it. It returns the drop's metadata with the
+// contents.
+func (m *Manager) GetPendingDrop(id string) (*MetadataPayload, io.ReadCloser, error) {
+	return m.openDrop(id, func(payload *MetadataPayload) error {
+		if payload.Processing != ProcessingPending {
+			return ErrNotPending
+		}
+		return nil
+	})
+}
+
+// PendingDrops returns the IDs of all drops waiting for processing, sorted,
+// so that a restarted server can queue them again.
+func (m *Manager) PendingDrops() ([]string, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	var pending []string
+	err := WalkDrops(m.StorageDir, func(id, dir string) error {
+		payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, id)
+		if err == nil && payload.Processing == ProcessingPending {
+			pending = append(pending, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
+
+// CompleteProcessing replaces the contents of a pending drop with the
+// processed (scrubbed) contents read from reader, records the flags, canary
+// and scrub profile of result in its metadata, and makes it retrievable.
+// Hashes and statistics are recomputed from the new contents.
+func (m *Manager) CompleteProcessing(id string, reader io.Reader, result *SaveOptions) error {
+	if err := ValidateDropID(id); err != nil {
+		return fmt.Errorf("invalid drop ID: %w", err)
+	}
+	if result == nil {
+		result = &SaveOptions{}
+	}
+
+	// Read before taking any lock: a slow scrubber must not stall relocking
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	defer ZeroBytes(data)
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+	m.touch()
+
+	m.Locks.Lock(id)
+	defer m.Locks.Unlock(id)
+
+	dropDir := m.dropDir(id)
+	metaPath := filepath.Join(dropDir, "meta")
+	payload, err := loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
+	if err != nil {
+		return fmt.Errorf("drop not found: %w", err)
+	}
+	if payload.Processing != ProcessingPending {
+		return ErrNotPending
+	}
+
+	if err := m.replaceData(id, dropDir, data); err != nil {
+		return err
+	}
+
+	payload.FileHash = computeSHA256(data)
+	payload.FuzzyHash = ""
+	if m.FuzzyHash {
+		payload.FuzzyHash, _ = fuzzyhash.Sum(data)
+	}
+	payload.Stats = nil
+	if m.TriageStats {
+		payload.Stats = triage.Summarize(data)
+	}
+	payload.Flags = append(payload.Flags, result.Flags...)
+	payload.Canary = result.Canary
+	payload.Scrubbed = result.Scrubbed
+	payload.Processing = ""
+	if err := m.replaceMetadata(metaPath, id, payload); err != nil {
+		return err
+	}
+	m.expiry.set(id, indexEntry(dropDir, payload))
+	return nil
+}
+
+// replaceData encrypts data beside a drop's data file and renames it into
+// place, adjusting the quota by the change in size. With secure delete the
+// old file is overwritten once replaced. A swap that fails part way is
+// resolved at the next start. The caller holds the drop's write lock.
+func (m *Manager) replaceData(id, dropDir string, data []byte) error {
+	filePath := filepath.Join(dropDir, "data")
+	oldSize := dataFileSize(dropDir)
+
+	done, err := m.beginIntent(intentReplace, id, dropDir)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filePath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 -- path built from validated drop ID
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	w := faultinject.Writer(faultinject.StorageWrite, f)
+	err = crypto.EncryptStream(m.EncryptionKey, bytes.NewReader(data), w, []byte(id))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to encrypt file: %w", err)
+	}
+	m.recordKeyUse(int64(len(data)), 1)
+
+	// Keep the old contents under another name until the new file is in
+	// place, so that a crash leaves one of the two
+	oldPath := filePath + ".old"
+	if m.SecureDelete {
+		if err := os.Rename(filePath, oldPath); err != nil {
+			_ = os.Remove(tmpPath)
+			return fmt.Errorf("failed to replace file: %w", err)
+		}
+	}
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		_ = os.Remove(tmpPath)
+		if m.SecureDelete {
+			_ = os.Rename(oldPath, filePath)
+		}
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	if m.Quota != nil {
+		m.Quota.Resize(oldSize, dataFileSize(dropDir))
+	}
+	if m.SecureDelete {
+		if err := SecureDelete(oldPath); err != nil {
+			return fmt.Errorf("failed to delete unprocessed file: %w", err)
+		}
+	}
+	done()
+	return nil
+}
+
+// FailProcessing records that a pending drop failed its checks and moves it
+// into quarantine, with reason, for the operator to release or purge.
+func (m *Manager) FailProcessing(id, reason string) error {
+	return m.quarantine(id, reason, func(payload *MetadataPayload) error {
+		if payload.Processing != ProcessingPending {
+			return ErrNotPending
+		}
+		payload.Processing = ProcessingFailed
+		return nil
+	})
+}
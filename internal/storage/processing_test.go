@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessing_Complete(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	m.SecureDelete = true
+	quota, err := NewQuotaManager(m.StorageDir, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Quota = quota
+
+	raw := []byte("raw upload with metadata to scrub")
+	drop, err := m.SaveDropWithOptions("memo.txt", bytes.NewReader(raw), &SaveOptions{Pending: true, Campaign: "spring"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.GetDrop(drop.ID); !errors.Is(err, ErrPending) {
+		t.Fatalf("GetDrop of pending drop error = %v, want ErrPending", err)
+	}
+	pending, err := m.PendingDrops()
+	if err != nil || len(pending) != 1 || pending[0] != drop.ID {
+		t.Fatalf("PendingDrops = %v, %v", pending, err)
+	}
+
+	payload, rc, err := m.GetPendingDrop(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(got, raw) || payload.Campaign != "spring" {
+		t.Fatalf("GetPendingDrop = %q, campaign %q", got, payload.Campaign)
+	}
+
+	processed := []byte("scrubbed upload")
+	result := &SaveOptions{Flags: []string{FlagHighEntropy}, Scrubbed: "standard"}
+	if err := m.CompleteProcessing(drop.ID, bytes.NewReader(processed), result); err != nil {
+		t.Fatalf("CompleteProcessing error: %v", err)
+	}
+
+	_, rc, err = m.GetDrop(drop.ID)
+	if err != nil {
+		t.Fatalf("GetDrop after processing error: %v", err)
+	}
+	got, _ = io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(got, processed) {
+		t.Errorf("stored %q, want %q", got, processed)
+	}
+
+	meta, _ := m.GetDropMetadata(drop.ID)
+	if meta.Processing != "" || meta.Scrubbed != "standard" || len(meta.Flags) != 1 || meta.FileHash != computeSHA256(processed) {
+		t.Errorf("metadata after processing = %+v", meta)
+	}
+	if used, _ := quota.Stats(); used != dataFileSize(DropDir(m.StorageDir, drop.ID)) {
+		t.Errorf("quota = %d bytes, want the processed size", used)
+	}
+	entries, _ := os.ReadDir(DropDir(m.StorageDir, drop.ID))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".old") || strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("leftover file %s", e.Name())
+		}
+	}
+
+	if err := m.CompleteProcessing(drop.ID, bytes.NewReader(processed), nil); !errors.Is(err, ErrNotPending) {
+		t.Errorf("second CompleteProcessing error = %v, want ErrNotPending", err)
+	}
+}
+
+func TestProcessing_Fail(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDropWithOptions("bad.pdf", bytes.NewReader([]byte("not a pdf")), &SaveOptions{Pending: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.FailProcessing(drop.ID, "validation"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.GetDrop(drop.ID); !errors.Is(err, ErrQuarantined) {
+		t.Errorf("GetDrop error = %v, want ErrQuarantined", err)
+	}
+	if _, _, err := m.GetPendingDrop(drop.ID); err == nil {
+		t.Error("GetPendingDrop of a failed drop should fail")
+	}
+	if pending, _ := m.PendingDrops(); len(pending) != 0 {
+		t.Errorf("PendingDrops = %v, want none", pending)
+	}
+
+	info, err := m.Inspect(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Processing != ProcessingFailed || info.Quarantine != "validation" {
+		t.Errorf("Inspect = %q, %q", info.Processing, info.Quarantine)
+	}
+
+	// The unprocessed contents stay encrypted in quarantine
+	data, err := os.ReadFile(filepath.Join(m.quarantineDir(drop.ID), "data"))
+	if err != nil || bytes.Contains(data, []byte("not a pdf")) {
+		t.Errorf("quarantined data file missing or not encrypted: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// quarantineDirName is the directory inside the storage dir holding
+// quarantined drops. It is hidden, so WalkDrops, and with it retrieval,
+// listings, campaign counts and cleanup, never sees them.
+const quarantineDirName = ".quarantine"
+
+// MaxQuarantineReason limits the reason recorded with a quarantined drop.
+const MaxQuarantineReason = 200
+
+var (
+	// ErrQuarantined is returned by GetDrop and StoredSize for a drop in
+	// quarantine.
+	ErrQuarantined = errors.New("drop is quarantined")
+	// ErrNotQuarantined is returned when releasing or purging a drop that
+	// is not in quarantine.
+	ErrNotQuarantined = errors.New("drop is not quarantined")
+)
+
+// quarantineDir returns the directory of a drop in quarantine. The ID must
+// already be validated.
+func (m *Manager) quarantineDir(id string) string {
+	return filepath.Join(m.StorageDir, quarantineDirName, id)
+}
+
+// inQuarantine reports whether a drop is in quarantine. The ID must already
+// be validated.
+func (m *Manager) inQuarantine(id string) bool {
+	_, err := os.Stat(m.quarantineDir(id))
+	return err == nil
+}
+
+// WalkQuarantine calls fn for every quarantined drop in storageDir, like
+// WalkDrops does for the others. A store without quarantine is not an error.
+func WalkQuarantine(storageDir string, fn func(id, dir string) error) error {
+	dir := filepath.Join(storageDir, quarantineDirName)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || ValidateDropID(entry.Name()) != nil {
+			continue
+		}
+		if err := fn(entry.Name(), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Quarantine moves a drop out of the retrievable namespace, recording reason
+// in its encrypted metadata for the operator. A quarantined drop is never
+// deleted by cleanup; it stays until an operator releases or purges it.
+func (m *Manager) Quarantine(id, reason string) error {
+	return m.quarantine(id, reason, func(*MetadataPayload) error { return nil })
+}
+
+// quarantine moves a drop whose metadata passes check into quarantine.
+// check may also change the metadata, which is saved with the reason.
+func (m *Manager) quarantine(id, reason string, check func(*MetadataPayload) error) error {
+	if err := ValidateDropID(id); err != nil {
+		return fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+	m.touch()
+
+	m.Locks.Lock(id)
+	defer m.Locks.Unlock(id)
+
+	dropDir := m.dropDir(id)
+	metaPath := filepath.Join(dropDir, "meta")
+	payload, err := loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
+	if err != nil {
+		return fmt.Errorf("drop not found: %w", err)
+	}
+	if err := check(payload); err != nil {
+		return err
+	}
+	payload.Quarantine = reason
+	if err := m.replaceMetadata(metaPath, id, payload); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(m.StorageDir, quarantineDirName), 0700); err != nil {
+		return fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := os.Rename(dropDir, m.quarantineDir(id)); err != nil {
+		return fmt.Errorf("failed to quarantine drop: %w", err)
+	}
+	m.expiry.remove(id)
+	return nil
+}
+
+// Quarantined returns a summary of every quarantined drop, with the reason,
+// sorted by ID.
+func (m *Manager) Quarantined() ([]DropSummary, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	var drops []DropSummary
+	err := WalkQuarantine(m.StorageDir, func(id, dir string) error {
+		payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, id)
+		if err != nil {
+			return nil
+		}
+		drops = append(drops, summarize(id, dir, payload))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(drops, func(i, j int) bool { return drops[i].ID < drops[j].ID })
+	return drops, nil
+}
+
+// ReleaseQuarantine returns a quarantined drop to the retrievable namespace
+// as it is. A drop that failed asynchronous processing is released
+// unprocessed, so it is served without scrubbing.
+func (m *Manager) ReleaseQuarantine(id string) error {
+	if err := ValidateDropID(id); err != nil {
+		return fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+	m.touch()
+
+	m.Locks.Lock(id)
+	defer m.Locks.Unlock(id)
+
+	dir := m.quarantineDir(id)
+	metaPath := filepath.Join(dir, "meta")
+	payload, err := loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
+	if err != nil {
+		return ErrNotQuarantined
+	}
+	payload.Quarantine = ""
+	if payload.Processing == ProcessingFailed {
+		payload.Processing = ""
+	}
+	if err := m.replaceMetadata(metaPath, id, payload); err != nil {
+		return err
+	}
+
+	target := DropDir(m.StorageDir, id)
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return fmt.Errorf("failed to create shard directory: %w", err)
+	}
+	if err := os.Rename(dir, target); err != nil {
+		return fmt.Errorf("failed to release drop: %w", err)
+	}
+	m.expiry.set(id, indexEntry(target, payload))
+	return nil
+}
+
+// PurgeQuarantine deletes a quarantined drop, securely if configured. Drops
+// under legal hold are refused with ErrLegalHold.
+func (m *Manager) PurgeQuarantine(id string) error {
+	if err := ValidateDropID(id); err != nil {
+		return fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+
+	m.Locks.Lock(id)
+	defer m.Locks.Unlock(id)
+
+	dir := m.quarantineDir(id)
+	payload, err := loadEncryptedMetadata(filepath.Join(dir, "meta"), m.EncryptionKey, id)
+	if err != nil {
+		return ErrNotQuarantined
+	}
+	if payload.LegalHold {
+		return ErrLegalHold
+	}
+	return m.removeDropDir(id, dir)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestQuarantine_ReleaseAndPurge(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	quota, err := NewQuotaManager(m.StorageDir, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Quota = quota
+
+	drop, _ := m.SaveDrop("flagged.txt", bytes.NewReader([]byte("flagged by a scanner")))
+	other, _ := m.SaveDrop("other.txt", bytes.NewReader([]byte("other")))
+	if err := m.Quarantine(drop.ID, "av_signature"); err != nil {
+		t.Fatalf("Quarantine error: %v", err)
+	}
+
+	if _, _, err := m.GetDrop(drop.ID); !errors.Is(err, ErrQuarantined) {
+		t.Errorf("GetDrop error = %v, want ErrQuarantined", err)
+	}
+	if _, err := m.StoredSize(drop.ID); !errors.Is(err, ErrQuarantined) {
+		t.Errorf("StoredSize error = %v, want ErrQuarantined", err)
+	}
+	drops, _ := m.Drops()
+	if len(drops) != 1 || drops[0].ID != other.ID {
+		t.Errorf("Drops = %v, want only the other drop", drops)
+	}
+	listed, err := m.Quarantined()
+	if err != nil || len(listed) != 1 || listed[0].ID != drop.ID || listed[0].Quarantine != "av_signature" {
+		t.Fatalf("Quarantined = %+v, %v", listed, err)
+	}
+
+	// Cleanup expires the other drop but never a quarantined one
+	if err := m.cleanupExpiredDrops(time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if !m.inQuarantine(drop.ID) {
+		t.Fatal("cleanup deleted a quarantined drop")
+	}
+
+	// Quarantined drops still count against the quota after a restart
+	rescanned, _ := NewQuotaManager(m.StorageDir, 1, 0)
+	if _, count := rescanned.Stats(); count != 1 {
+		t.Errorf("rescanned drop count = %d, want 1", count)
+	}
+
+	if err := m.ReleaseQuarantine(drop.ID); err != nil {
+		t.Fatalf("ReleaseQuarantine error: %v", err)
+	}
+	_, rc, err := m.GetDrop(drop.ID)
+	if err != nil {
+		t.Fatalf("GetDrop after release error: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "flagged by a scanner" {
+		t.Errorf("released drop = %q", got)
+	}
+	if info, _ := m.Inspect(drop.ID); info.Quarantine != "" {
+		t.Errorf("released drop keeps reason %q", info.Quarantine)
+	}
+	if err := m.ReleaseQuarantine(drop.ID); !errors.Is(err, ErrNotQuarantined) {
+		t.Errorf("second release error = %v, want ErrNotQuarantined", err)
+	}
+
+	if err := m.Quarantine(drop.ID, "again"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PurgeQuarantine(drop.ID); err != nil {
+		t.Fatalf("PurgeQuarantine error: %v", err)
+	}
+	if m.inQuarantine(drop.ID) {
+		t.Error("purged drop still in quarantine")
+	}
+	if _, count := quota.Stats(); count != 0 {
+		t.Errorf("drop count after purge = %d, want 0", count)
+	}
+	if err := m.PurgeQuarantine(other.ID); !errors.Is(err, ErrNotQuarantined) {
+		t.Errorf("purging a drop not in quarantine error = %v, want ErrNotQuarantined", err)
+	}
+}
+
+func TestQuarantine_PurgeRefusesLegalHold(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, _ := m.SaveDrop("held.txt", bytes.NewReader([]byte("evidence")))
+	if err := m.SetLegalHold(drop.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Quarantine(drop.ID, "flagged"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PurgeQuarantine(drop.ID); !errors.Is(err, ErrLegalHold) {
+		t.Errorf("PurgeQuarantine error = %v, want ErrLegalHold", err)
+	}
+}
@@ -1,13 +1,17 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
+	"slices"
 	"sync"
 )
 
+// ErrQuotaExceeded is returned when a drop would exceed the storage or drop
+// count quota.
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
 // QuotaManager tracks total storage usage and drop count.
 type QuotaManager struct {
 	mu         sync.Mutex
@@ -15,8 +19,17 @@ type QuotaManager struct {
 	dropCount  int
 	maxBytes   int64
 	maxDrops   int
+
+	alerts  []int             // ascending usage thresholds, in percent
+	alerted int               // number of thresholds alerted on and not yet re-armed
+	onAlert func(percent int) // called when usage crosses a threshold
 }
 
+// quotaAlertHysteresis is how many percentage points usage must fall below
+// a threshold before crossing it again alerts again, so that usage hovering
+// at a threshold does not alert on every upload.
+const quotaAlertHysteresis = 5
+
 // NewQuotaManager creates a quota manager and scans existing drops.
 func NewQuotaManager(storageDir string, maxGB float64, maxDrops int) (*QuotaManager, error) {
 	qm := &QuotaManager{
@@ -24,25 +37,19 @@ func NewQuotaManager(storageDir string, maxGB float64, maxDrops int) (*QuotaMana
 		maxDrops: maxDrops,
 	}
 
-	// Scan existing drops to initialize counters
-	entries, err := os.ReadDir(storageDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to scan storage: %w", err)
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
-			continue
-		}
-
-		filePath := filepath.Join(storageDir, entry.Name(), "data")
-		if _, statErr := os.Stat(filePath); os.IsNotExist(statErr) {
-			filePath = filepath.Join(storageDir, entry.Name(), "file.enc")
-		}
-		if info, err := os.Stat(filePath); err == nil {
+	// Scan existing drops, quarantined ones included, to initialize counters
+	count := func(_, dropDir string) error {
+		if info, err := os.Stat(dataFilePath(dropDir)); err == nil {
 			qm.totalBytes += info.Size()
 			qm.dropCount++
 		}
+		return nil
+	}
+	if err := WalkDrops(storageDir, count); err != nil {
+		return nil, fmt.Errorf("failed to scan storage: %w", err)
+	}
+	if err := WalkQuarantine(storageDir, count); err != nil {
+		return nil, fmt.Errorf("failed to scan quarantine: %w", err)
 	}
 
 	return qm, nil
@@ -54,20 +61,33 @@ func (qm *QuotaManager) Reserve(bytes int64) error {
 	defer qm.mu.Unlock()
 
 	if qm.maxBytes > 0 && qm.totalBytes+bytes > qm.maxBytes {
-		return fmt.Errorf("storage quota exceeded (%.1f GB used of %.1f GB)",
+		return fmt.Errorf("%w (%.1f GB used of %.1f GB)", ErrQuotaExceeded,
 			float64(qm.totalBytes)/(1024*1024*1024),
 			float64(qm.maxBytes)/(1024*1024*1024))
 	}
 
 	if qm.maxDrops > 0 && qm.dropCount+1 > qm.maxDrops {
-		return fmt.Errorf("drop count quota exceeded (%d of %d)", qm.dropCount, qm.maxDrops)
+		return fmt.Errorf("%w (%d of %d drops)", ErrQuotaExceeded, qm.dropCount, qm.maxDrops)
 	}
 
 	qm.totalBytes += bytes
 	qm.dropCount++
+	qm.checkAlerts()
 	return nil
 }
 
+// CanAccept reports whether a drop of the given size would currently fit,
+// without reserving anything.
+func (qm *QuotaManager) CanAccept(bytes int64) bool {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	if qm.maxBytes > 0 && qm.totalBytes+bytes > qm.maxBytes {
+		return false
+	}
+	return qm.maxDrops <= 0 || qm.dropCount+1 <= qm.maxDrops
+}
+
 // Stats returns current storage usage and drop count.
 func (qm *QuotaManager) Stats() (totalBytes int64, dropCount int) {
 	qm.mu.Lock()
@@ -75,6 +95,24 @@ func (qm *QuotaManager) Stats() (totalBytes int64, dropCount int) {
 	return qm.totalBytes, qm.dropCount
 }
 
+// Limits returns the configured maximum bytes and drop count (0 = none).
+func (qm *QuotaManager) Limits() (maxBytes int64, maxDrops int) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	return qm.maxBytes, qm.maxDrops
+}
+
+// SetLimits changes the maximum storage and drop count (0 = none). Drops
+// already stored are kept when usage is over the new limits; uploads are
+// refused until it falls below them.
+func (qm *QuotaManager) SetLimits(maxGB float64, maxDrops int) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	qm.maxBytes = int64(maxGB * 1024 * 1024 * 1024)
+	qm.maxDrops = maxDrops
+	qm.checkAlerts()
+}
+
 // Release frees reserved space when a drop is deleted.
 func (qm *QuotaManager) Release(bytes int64) {
 	qm.mu.Lock()
@@ -88,4 +126,82 @@ func (qm *QuotaManager) Release(bytes int64) {
 	if qm.dropCount < 0 {
 		qm.dropCount = 0
 	}
+	qm.checkAlerts()
+}
+
+// Resize accounts for a drop whose stored size changed from oldBytes to
+// newBytes. The drop was accepted already, so the limit is not enforced.
+func (qm *QuotaManager) Resize(oldBytes, newBytes int64) {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	qm.totalBytes += newBytes - oldBytes
+	if qm.totalBytes < 0 {
+		qm.totalBytes = 0
+	}
+	qm.checkAlerts()
+}
+
+// UsagePercent returns how much of the quota is in use, in percent: the
+// larger of the share of bytes and the share of drops. It is 0 without
+// limits.
+func (qm *QuotaManager) UsagePercent() float64 {
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	return qm.usagePercent()
+}
+
+func (qm *QuotaManager) usagePercent() float64 {
+	var pct float64
+	if qm.maxBytes > 0 {
+		pct = 100 * float64(qm.totalBytes) / float64(qm.maxBytes)
+	}
+	if qm.maxDrops > 0 {
+		pct = max(pct, 100*float64(qm.dropCount)/float64(qm.maxDrops))
+	}
+	return pct
+}
+
+// SetAlerts registers fn to be called, in its own goroutine, when usage
+// rises to one of percents (each between 1 and 100). It is called once per
+// crossing, with the highest threshold crossed; a threshold is re-armed once
+// usage falls quotaAlertHysteresis points below it. Thresholds already
+// crossed are reported at once.
+func (qm *QuotaManager) SetAlerts(percents []int, fn func(percent int)) error {
+	alerts := append([]int(nil), percents...)
+	for _, p := range alerts {
+		if p < 1 || p > 100 {
+			return fmt.Errorf("quota alert threshold %d%% is not between 1 and 100", p)
+		}
+	}
+	slices.Sort(alerts)
+	alerts = slices.Compact(alerts)
+
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+	qm.alerts = alerts
+	qm.alerted = 0
+	qm.onAlert = fn
+	qm.checkAlerts()
+	return nil
+}
+
+// checkAlerts alerts on thresholds that usage has risen to and re-arms
+// those it has fallen well below. The caller must hold qm.mu.
+func (qm *QuotaManager) checkAlerts() {
+	if qm.onAlert == nil {
+		return
+	}
+	usage := qm.usagePercent()
+	crossed := 0
+	for qm.alerted < len(qm.alerts) && usage >= float64(qm.alerts[qm.alerted]) {
+		crossed = qm.alerts[qm.alerted]
+		qm.alerted++
+	}
+	for qm.alerted > 0 && usage < float64(qm.alerts[qm.alerted-1]-quotaAlertHysteresis) {
+		qm.alerted--
+	}
+	if crossed > 0 {
+		go qm.onAlert(crossed)
+	}
 }
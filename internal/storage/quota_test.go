@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewQuotaManager_EmptyDir(t *testing.T) {
@@ -110,6 +111,27 @@ func TestQuotaManager_Reserve_DropCountExceeded(t *testing.T) {
 	}
 }
 
+func TestQuotaManager_CanAccept(t *testing.T) {
+	dir := t.TempDir()
+	qm, _ := NewQuotaManager(dir, 0.001, 2) // ~1MB, 2 drops
+
+	if !qm.CanAccept(1024) {
+		t.Error("CanAccept should be true for an empty quota")
+	}
+	if qm.CanAccept(2 * 1024 * 1024) {
+		t.Error("CanAccept should be false beyond the byte quota")
+	}
+
+	qm.Reserve(100)
+	qm.Reserve(100)
+	if qm.CanAccept(1) {
+		t.Error("CanAccept should be false once the drop count is reached")
+	}
+	if _, count := qm.Stats(); count != 2 {
+		t.Errorf("CanAccept must not reserve; dropCount = %d, want 2", count)
+	}
+}
+
 func TestQuotaManager_Reserve_UnlimitedWhenZero(t *testing.T) {
 	dir := t.TempDir()
 	qm, _ := NewQuotaManager(dir, 0, 0) // unlimited
@@ -178,3 +200,99 @@ func TestQuotaManager_ThreadSafe(t *testing.T) {
 		t.Errorf("dropCount = %d, want 0", dropCount)
 	}
 }
+
+func TestQuotaManager_Alerts(t *testing.T) {
+	qm, err := NewQuotaManager(t.TempDir(), 0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := qm.SetAlerts([]int{70, 0}, func(int) {}); err == nil {
+		t.Error("expected an error for a 0% threshold")
+	}
+
+	alerts := make(chan int, 10)
+	if err := qm.SetAlerts([]int{95, 70, 85}, func(p int) { alerts <- p }); err != nil {
+		t.Fatal(err)
+	}
+	expect := func(want int) {
+		t.Helper()
+		select {
+		case got := <-alerts:
+			if got != want {
+				t.Errorf("alert at %d%%, want %d%%", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no alert, want %d%%", want)
+		}
+	}
+	reserve := func(n int) {
+		t.Helper()
+		for range n {
+			if err := qm.Reserve(1); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	reserve(14) // 70%
+	expect(70)
+	reserve(3) // 85%
+	expect(85)
+	if got := qm.UsagePercent(); got != 85 {
+		t.Errorf("UsagePercent = %v, want 85", got)
+	}
+
+	// Hovering at a threshold does not alert again
+	qm.Release(1)
+	reserve(1)
+	// Falling well below re-arms it
+	for range 5 {
+		qm.Release(1)
+	}
+	reserve(3) // 75%
+	expect(70)
+
+	reserve(2) // 85%
+	expect(85)
+	reserve(3) // 100%
+	expect(95)
+
+	// Thresholds already crossed when set alert once, with the highest
+	if err := qm.SetAlerts([]int{70, 85, 95}, func(p int) { alerts <- p }); err != nil {
+		t.Fatal(err)
+	}
+	expect(95)
+
+	select {
+	case p := <-alerts:
+		t.Errorf("unexpected alert at %d%%", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestQuotaManager_SetLimits(t *testing.T) {
+	qm, err := NewQuotaManager(t.TempDir(), 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := qm.Reserve(100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if qm.CanAccept(100) {
+		t.Fatal("third drop should not fit under a limit of 2")
+	}
+
+	qm.SetLimits(0, 3)
+	if !qm.CanAccept(100) {
+		t.Error("third drop should fit once the limit is 3")
+	}
+	qm.SetLimits(0, 1)
+	if qm.CanAccept(100) {
+		t.Error("no drop should fit while usage is over the limit")
+	}
+	if _, maxDrops := qm.Limits(); maxDrops != 1 {
+		t.Errorf("maxDrops = %d, want 1", maxDrops)
+	}
+}
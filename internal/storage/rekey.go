@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// RotationJournalFile records a full key rotation in progress. While it
+// exists the store is partly on each key, and the server refuses to start.
+const RotationJournalFile = ".rotation-journal"
+
+// RekeyDrop re-encrypts the drop dropID in dropDir, its data file, its
+// metadata and any reply, from oldKey to newKey, the storage keys before and
+// after a key rotation. Each file is replaced atomically, and one already
+// under newKey is left as it is, so an interrupted rotation can be run again.
+// With dryRun it only checks that the files open with one of the keys.
+//
+// RekeyDrop works on the files directly, without a Manager: the caller holds
+// the store with LockStore so that no server touches the drop meanwhile.
+func RekeyDrop(dropDir, dropID string, oldKey, newKey []byte, dryRun bool) error {
+	// Legacy drops keep their data in "file.enc"
+	dataPath := filepath.Join(dropDir, "data")
+	if _, err := os.Stat(dataPath); os.IsNotExist(err) {
+		dataPath = filepath.Join(dropDir, "file.enc")
+	}
+	if err := rekeyData(dataPath, dropID, oldKey, newKey, dryRun); err != nil {
+		return fmt.Errorf("failed to re-encrypt file: %w", err)
+	}
+	if err := RekeyMetadata(filepath.Join(dropDir, "meta"), dropID, oldKey, newKey, dryRun); err != nil {
+		return fmt.Errorf("failed to re-encrypt metadata: %w", err)
+	}
+	if hasReply(dropDir) {
+		if err := rekeyData(replyPath(dropDir), replyAAD(dropID), oldKey, newKey, dryRun); err != nil {
+			return fmt.Errorf("failed to re-encrypt reply: %w", err)
+		}
+	}
+	return nil
+}
+
+// rekeyData streams the data file at path from oldKey to newKey through a
+// temporary file beside it, so no plaintext is held in memory or on disk.
+func rekeyData(path, dropID string, oldKey, newKey []byte, dryRun bool) error {
+	if err := decryptFileTo(path, dropID, oldKey, io.Discard); err != nil {
+		if decryptFileTo(path, dropID, newKey, io.Discard) == nil {
+			return nil
+		}
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+
+	tmp := path + ".rekey.tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 -- path built from validated drop ID
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(decryptFileTo(path, dropID, oldKey, pw))
+	}()
+	err = crypto.EncryptStream(newKey, pr, f, []byte(dropID))
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// decryptFileTo decrypts the stream-encrypted file at path into w.
+func decryptFileTo(path, dropID string, key []byte, w io.Writer) error {
+	f, err := os.Open(path) // #nosec G304 -- path built from validated drop ID
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	defer f.Close()
+	if err := crypto.DecryptStream(key, f, w, []byte(dropID)); err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestRekeyDrop(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, err := m.SaveDrop("secret.txt", bytes.NewReader([]byte("the contents")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := bytes.Clone(m.EncryptionKey)
+	newKey, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := m.dropDir(drop.ID)
+
+	read := func() string {
+		t.Helper()
+		name, rc, err := m.GetDrop(drop.ID)
+		if err != nil {
+			t.Fatalf("GetDrop: %v", err)
+		}
+		defer rc.Close()
+		data, _ := io.ReadAll(rc)
+		if name != "secret.txt" {
+			t.Errorf("filename = %q", name)
+		}
+		return string(data)
+	}
+
+	if err := RekeyDrop(dir, drop.ID, oldKey, newKey, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if got := read(); got != "the contents" {
+		t.Fatalf("after dry run: %q", got)
+	}
+
+	if err := RekeyDrop(dir, drop.ID, oldKey, newKey, false); err != nil {
+		t.Fatalf("RekeyDrop: %v", err)
+	}
+	copy(m.EncryptionKey, newKey)
+	if got := read(); got != "the contents" {
+		t.Errorf("under the new key: %q", got)
+	}
+
+	// A drop already under the new key is left alone
+	if err := RekeyDrop(dir, drop.ID, oldKey, newKey, false); err != nil {
+		t.Errorf("second RekeyDrop: %v", err)
+	}
+	if err := RekeyDrop(dir, drop.ID, oldKey, oldKey, false); err == nil {
+		t.Error("RekeyDrop with the wrong keys should fail")
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+// MaxReplyText bounds a receiver's reply to a source: a few paragraphs, to
+// acknowledge a drop or ask for more, not a channel for documents.
+const MaxReplyText = 2048
+
+var (
+	// ErrNoReply is returned by Reply when no reply waits on a drop.
+	ErrNoReply = errors.New("no reply")
+
+	// ErrReplyTooLong is returned by SetReply for a reply over MaxReplyText.
+	ErrReplyTooLong = errors.New("reply too long")
+)
+
+// A reply is kept beside the drop's data in a "reply" file, stream
+// encrypted under the storage key like the data but with its own AAD, so
+// that one cannot be swapped for the other. It goes when the drop goes.
+
+func replyPath(dropDir string) string {
+	return filepath.Join(dropDir, "reply")
+}
+
+func replyAAD(id string) string {
+	return id + "/reply"
+}
+
+// SetReply attaches the receivers' reply to a drop, for its source to fetch
+// with the drop ID and receipt, replacing any earlier reply. An empty reply
+// removes it.
+func (m *Manager) SetReply(id, text string) error {
+	if err := ValidateDropID(id); err != nil {
+		return fmt.Errorf("invalid drop ID: %w", err)
+	}
+	if len(text) > MaxReplyText {
+		return ErrReplyTooLong
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+	m.touch()
+
+	m.Locks.Lock(id)
+	defer m.Locks.Unlock(id)
+
+	dir := m.dropDir(id)
+	if _, err := os.Stat(filepath.Join(dir, "meta")); err != nil {
+		return fmt.Errorf("drop not found: %w", err)
+	}
+	path := replyPath(dir)
+	if text == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 -- path built from validated drop ID
+	if err != nil {
+		return fmt.Errorf("failed to create reply: %w", err)
+	}
+	err = crypto.EncryptStream(m.EncryptionKey, bytes.NewReader([]byte(text)), f, []byte(replyAAD(id)))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to save reply: %w", err)
+	}
+	m.recordKeyUse(int64(len(text)), 1)
+	return os.Rename(tmp, path)
+}
+
+// Reply returns the reply waiting on a drop, or ErrNoReply.
+func (m *Manager) Reply(id string) (string, error) {
+	if err := ValidateDropID(id); err != nil {
+		return "", fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return "", ErrLocked
+	}
+
+	m.Locks.RLock(id)
+	defer m.Locks.RUnlock(id)
+
+	path := replyPath(m.dropDir(id))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", ErrNoReply
+	}
+	var text bytes.Buffer
+	if err := decryptFileTo(path, replyAAD(id), m.EncryptionKey, &text); err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// hasReply reports whether a reply waits in dropDir.
+func hasReply(dropDir string) bool {
+	_, err := os.Stat(replyPath(dropDir))
+	return err == nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
+)
+
+func TestSetReply(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	drop, _ := m.SaveDrop("a.txt", bytes.NewReader([]byte("a")))
+	if _, err := m.Reply(drop.ID); !errors.Is(err, ErrNoReply) {
+		t.Fatalf("Reply before any = %v, want ErrNoReply", err)
+	}
+
+	if err := m.SetReply(drop.ID, "received, thank you"); err != nil {
+		t.Fatalf("SetReply error: %v", err)
+	}
+	if got, err := m.Reply(drop.ID); err != nil || got != "received, thank you" {
+		t.Fatalf("Reply = %q, %v", got, err)
+	}
+	raw, err := os.ReadFile(replyPath(m.dropDir(drop.ID)))
+	if err != nil || bytes.Contains(raw, []byte("thank you")) {
+		t.Errorf("reply stored in the clear (%v)", err)
+	}
+	drops, _ := m.Drops()
+	if len(drops) != 1 || !drops[0].Replied {
+		t.Errorf("Drops = %+v, want the drop marked replied", drops)
+	}
+
+	// Rekeying carries the reply over
+	newKey, _ := crypto.GenerateKey()
+	if err := RekeyDrop(m.dropDir(drop.ID), drop.ID, m.EncryptionKey, newKey, false); err != nil {
+		t.Fatalf("RekeyDrop: %v", err)
+	}
+	copy(m.EncryptionKey, newKey)
+	if got, err := m.Reply(drop.ID); err != nil || got != "received, thank you" {
+		t.Errorf("Reply after rekey = %q, %v", got, err)
+	}
+
+	if err := m.SetReply(drop.ID, strings.Repeat("x", MaxReplyText+1)); !errors.Is(err, ErrReplyTooLong) {
+		t.Errorf("long reply: %v", err)
+	}
+	if err := m.SetReply(drop.ID, ""); err != nil {
+		t.Fatalf("clearing reply: %v", err)
+	}
+	if _, err := m.Reply(drop.ID); !errors.Is(err, ErrNoReply) {
+		t.Errorf("Reply after clearing = %v", err)
+	}
+
+	// Replies go with their drop
+	if err := m.SetReply(drop.ID, "again"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.DeleteDrop(drop.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetReply(drop.ID, "late"); err == nil {
+		t.Error("SetReply on a deleted drop should fail")
+	}
+}
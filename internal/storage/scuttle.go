@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// CheckInFile records when an operator last checked in, for the
+	// scuttle timer.
+	CheckInFile = ".checkin"
+	// ScuttledFile marks a storage directory that has been scuttled. The
+	// server refuses to start on it while it exists.
+	ScuttledFile = ".scuttled"
+)
+
+// keyFiles hold the key material everything else is sealed under. Scuttle
+// destroys them first, so that the rest is unreadable however far the wipe
+// gets.
+var keyFiles = []string{encryptionKeyFile, receiptKeyFile, ".master.salt", ".secrets"}
+
+// LastCheckIn returns when an operator last checked in at storageDir, or
+// the zero time if none has.
+func LastCheckIn(storageDir string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(storageDir, CheckInFile)) // #nosec G304 -- path from config
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	at, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid check-in file: %w", err)
+	}
+	return at, nil
+}
+
+// CheckIn records an operator check-in at storageDir at the given time.
+func CheckIn(storageDir string, at time.Time) error {
+	path := filepath.Join(storageDir, CheckInFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(at.UTC().Format(time.RFC3339)+"\n"), 0600); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to record check-in: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ClearCheckIn forgets the last operator check-in at storageDir, so that the
+// scuttle timer starts afresh when next turned on.
+func ClearCheckIn(storageDir string) error {
+	err := os.Remove(filepath.Join(storageDir, CheckInFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear check-in: %w", err)
+	}
+	return nil
+}
+
+// Scuttled returns when storageDir was scuttled, and whether it was.
+func Scuttled(storageDir string) (time.Time, bool) {
+	data, err := os.ReadFile(filepath.Join(storageDir, ScuttledFile)) // #nosec G304 -- path from config
+	if err != nil {
+		return time.Time{}, false
+	}
+	at, _ := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	return at, true
+}
+
+// Scuttle destroys the store at storageDir: the key files first, then
+// every drop and every other file but the directory lock, each securely
+// deleted. Legal holds do not stop it. It carries on past failures and
+// returns them all, and finally marks the directory as scuttled.
+func Scuttle(storageDir string) error {
+	var errs []error
+	for _, name := range keyFiles {
+		if err := SecureDelete(filepath.Join(storageDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	entries, err := os.ReadDir(storageDir)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, e := range entries {
+		if e.Name() == storeLockFile {
+			continue
+		}
+		path := filepath.Join(storageDir, e.Name())
+		switch {
+		case e.Type()&fs.ModeSymlink != 0:
+			// Overwriting would reach whatever it points to
+			err = os.Remove(path)
+		case e.IsDir():
+			err = SecureDeleteDir(path)
+		default:
+			err = SecureDelete(path)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	marker := []byte(time.Now().UTC().Format(time.RFC3339) + "\n")
+	if err := os.WriteFile(filepath.Join(storageDir, ScuttledFile), marker, 0600); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Scuttle zeroes the manager's keys, waiting for operations that hold them,
+// and then scuttles its storage directory.
+func (m *Manager) Scuttle() error {
+	m.Lock()
+	return Scuttle(m.StorageDir)
+}
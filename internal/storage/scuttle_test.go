@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckIn(t *testing.T) {
+	dir := t.TempDir()
+	last, err := LastCheckIn(dir)
+	if err != nil || !last.IsZero() {
+		t.Fatalf("LastCheckIn before any = %v, %v; want zero", last, err)
+	}
+
+	at := time.Date(2026, 5, 1, 12, 30, 0, 0, time.UTC)
+	if err := CheckIn(dir, at); err != nil {
+		t.Fatal(err)
+	}
+	if last, err = LastCheckIn(dir); err != nil || !last.Equal(at) {
+		t.Errorf("LastCheckIn = %v, %v; want %v", last, err, at)
+	}
+
+	for range 2 {
+		if err := ClearCheckIn(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if last, err = LastCheckIn(dir); err != nil || !last.IsZero() {
+		t.Errorf("LastCheckIn after ClearCheckIn = %v, %v; want zero", last, err)
+	}
+}
+
+func TestScuttle(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+	lock, err := LockStore(m.StorageDir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release()
+
+	drop, err := m.SaveDrop("held.txt", bytes.NewReader([]byte("evidence")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetLegalHold(drop.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckIn(m.StorageDir, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Scuttle(); err != nil {
+		t.Fatalf("Scuttle error: %v", err)
+	}
+	if !m.Locked() {
+		t.Error("manager should hold no keys after Scuttle")
+	}
+	if _, _, err := m.GetDrop(drop.ID); !errors.Is(err, ErrLocked) {
+		t.Errorf("GetDrop after Scuttle error = %v, want ErrLocked", err)
+	}
+
+	entries, err := os.ReadDir(m.StorageDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, e := range entries {
+		left = append(left, e.Name())
+	}
+	if len(left) != 2 {
+		t.Errorf("left after Scuttle: %v, want only the lock and the marker", left)
+	}
+	if _, err := os.Stat(filepath.Join(m.StorageDir, storeLockFile)); err != nil {
+		t.Errorf("store lock removed: %v", err)
+	}
+	if at, ok := Scuttled(m.StorageDir); !ok || time.Since(at) > time.Minute {
+		t.Errorf("Scuttled = %v, %v", at, ok)
+	}
+	if _, ok := Scuttled(t.TempDir()); ok {
+		t.Error("fresh directory reported as scuttled")
+	}
+}
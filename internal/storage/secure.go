@@ -5,17 +5,24 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
-	"regexp"
 )
 
-// validDropID checks if a drop ID is valid hex string (prevents path traversal)
-var validDropIDRegex = regexp.MustCompile(`^[a-f0-9]{32}$`)
-
-// ValidateDropID checks if a drop ID is safe to use in file operations
+// ValidateDropID checks if a drop ID is safe to use in file operations: the
+// active IDGenerator must accept it, and whatever the generator, it must be
+// ASCII letters, digits and dashes, with at least four characters after the
+// last dash to shard on (see DropDir).
 func ValidateDropID(id string) error {
-	if !validDropIDRegex.MatchString(id) {
+	if err := currentIDGenerator().Validate(id); err != nil {
+		return fmt.Errorf("invalid drop ID format")
+	}
+	if len(shardKey(id)) < 4 || id[0] == '-' {
 		return fmt.Errorf("invalid drop ID format")
 	}
+	for i := 0; i < len(id); i++ {
+		if !isIDChar(id[i]) && id[i] != '-' {
+			return fmt.Errorf("invalid drop ID format")
+		}
+	}
 	return nil
 }
 
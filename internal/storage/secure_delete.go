@@ -5,11 +5,39 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/scttfrdmn/dead-drop/internal/faultinject"
 )
 
+// wipeChunk is how much each overwrite writes at a time: large enough that a
+// pass is bound by the disk rather than by system calls.
+const wipeChunk = 1 << 20
+
+// wipeWorkers bounds the writes in flight for one file. Several positional
+// writes outstanding keep an SSD's queue busy, much as io_uring would,
+// without its dependency.
+var wipeWorkers = min(runtime.GOMAXPROCS(0), 4)
+
+// extent is a range of a file that holds data.
+type extent struct {
+	off, len int64
+}
+
 // SecureDelete overwrites a file with multiple passes before removing it.
 // Pass 1: zeros, Pass 2: ones (0xFF), Pass 3: random data, then os.Remove.
+// Holes in a sparse file hold no data and are not written, which would only
+// allocate blocks for them.
+//
+// The passes are real writes. fallocate's zeroing modes are not used: they
+// may only mark blocks unwritten, leaving the old contents on the disk.
 func SecureDelete(path string) error {
+	if err := faultinject.Check(faultinject.StorageDelete); err != nil {
+		return fmt.Errorf("failed to overwrite file: %w", err)
+	}
+
 	info, err := os.Stat(path)
 	if err != nil {
 		return fmt.Errorf("failed to stat file: %w", err)
@@ -24,40 +52,34 @@ func SecureDelete(path string) error {
 	if err != nil {
 		return fmt.Errorf("failed to open file for overwrite: %w", err)
 	}
+	extents := dataExtents(f, size)
 
-	buf := make([]byte, 4096)
-
-	// Pass 1: zeros
-	for i := range buf {
-		buf[i] = 0x00
-	}
-	if err := overwriteFile(f, size, buf); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("zero pass failed: %w", err)
-	}
-
-	// Pass 2: ones
-	for i := range buf {
-		buf[i] = 0xFF
-	}
-	if err := overwriteFile(f, size, buf); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("ones pass failed: %w", err)
+	passes := []struct {
+		name string
+		fill func([]byte) error
+	}{
+		{"zero", fillByte(0x00)},
+		{"ones", fillByte(0xFF)},
+		{"random", func(buf []byte) error {
+			_, err := rand.Read(buf)
+			return err
+		}},
 	}
-
-	// Pass 3: random
-	if err := overwriteFileRandom(f, size); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("random pass failed: %w", err)
+	for _, pass := range passes {
+		if err := overwriteExtents(f, extents, pass.fill); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("%s pass failed: %w", pass.name, err)
+		}
 	}
-
-	_ = f.Sync()
 	_ = f.Close()
 
 	return os.Remove(path)
 }
 
 // SecureDeleteDir securely deletes all files in a directory, then removes the directory.
+// Files go one at a time, in directory order, stopping at the first failure:
+// a drop's data goes before its metadata, so that a drop whose deletion
+// failed can still be found and deleted again.
 func SecureDeleteDir(dir string) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
@@ -84,42 +106,82 @@ func SecureDeleteDir(dir string) error {
 	return os.Remove(dir)
 }
 
-func overwriteFile(f *os.File, size int64, pattern []byte) error {
-	if _, err := f.Seek(0, 0); err != nil {
-		return err
-	}
-	remaining := size
-	for remaining > 0 {
-		n := int64(len(pattern))
-		if n > remaining {
-			n = remaining
+// fillByte returns a fill writing b over the whole buffer.
+func fillByte(b byte) func([]byte) error {
+	return func(buf []byte) error {
+		for i := range buf {
+			buf[i] = b
 		}
-		if _, err := f.Write(pattern[:n]); err != nil {
-			return err
-		}
-		remaining -= n
+		return nil
 	}
-	return f.Sync()
 }
 
-func overwriteFileRandom(f *os.File, size int64) error {
-	if _, err := f.Seek(0, 0); err != nil {
-		return err
+// overwriteExtents writes over extents of f in wipeChunk pieces, each filled
+// by fill, spread over up to wipeWorkers writers, and syncs f.
+func overwriteExtents(f *os.File, extents []extent, fill func([]byte) error) error {
+	var chunks []extent
+	var largest int64
+	for _, e := range extents {
+		for off := e.off; off < e.off+e.len; off += wipeChunk {
+			c := extent{off, min(wipeChunk, e.off+e.len-off)}
+			chunks = append(chunks, c)
+			largest = max(largest, c.len)
+		}
+	}
+
+	// A buffer for each writer, allocated when first needed
+	bufs := make(chan []byte, wipeWorkers)
+	for range wipeWorkers {
+		bufs <- nil
 	}
-	buf := make([]byte, 4096)
-	remaining := size
-	for remaining > 0 {
-		n := int64(len(buf))
-		if n > remaining {
-			n = remaining
+	var failed atomic.Pointer[error]
+	parallel(len(chunks), func(i int) {
+		if failed.Load() != nil {
+			return
 		}
-		if _, err := rand.Read(buf[:n]); err != nil {
-			return err
+		buf := <-bufs
+		if buf == nil {
+			buf = make([]byte, largest)
 		}
-		if _, err := f.Write(buf[:n]); err != nil {
-			return err
+		defer func() { bufs <- buf }()
+
+		c := chunks[i]
+		err := fill(buf[:c.len])
+		if err == nil {
+			_, err = f.WriteAt(buf[:c.len], c.off)
+		}
+		if err != nil {
+			failed.CompareAndSwap(nil, &err)
 		}
-		remaining -= n
+	})
+	if err := failed.Load(); err != nil {
+		return *err
 	}
 	return f.Sync()
 }
+
+// parallel calls fn for 0..n-1 on up to wipeWorkers goroutines and waits
+// for them all.
+func parallel(n int, fn func(i int)) {
+	workers := min(wipeWorkers, n)
+	if workers <= 1 {
+		for i := range n {
+			fn(i)
+		}
+		return
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				fn(i)
+			}
+		})
+	}
+	wg.Wait()
+}
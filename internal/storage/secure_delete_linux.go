@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataExtents returns the ranges of f, of the given size, that hold data,
+// skipping holes. Where the filesystem cannot tell, the whole file is data.
+func dataExtents(f *os.File, size int64) []extent {
+	whole := []extent{{0, size}}
+	var extents []extent
+	for off := int64(0); off < size; {
+		start, err := unix.Seek(int(f.Fd()), off, unix.SEEK_DATA) // #nosec G115 -- file descriptors fit in an int
+		if errors.Is(err, unix.ENXIO) {
+			break // only a hole is left
+		}
+		if err != nil {
+			return whole
+		}
+		end, err := unix.Seek(int(f.Fd()), start, unix.SEEK_HOLE) // #nosec G115 -- file descriptors fit in an int
+		if err != nil {
+			return whole
+		}
+		end = min(end, size)
+		if end <= start {
+			break
+		}
+		extents = append(extents, extent{start, end - start})
+		off = end
+	}
+	return extents
+}
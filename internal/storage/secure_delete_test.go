@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -28,7 +29,7 @@ func TestSecureDelete_LargeFile(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "large.bin")
 
-	// Create a file larger than the 4096 buffer
+	// Create a file larger than a page
 	data := make([]byte, 10000)
 	for i := range data {
 		data[i] = byte(i % 256)
@@ -149,3 +150,86 @@ func TestSecureDeleteDir_EmptyDir(t *testing.T) {
 		t.Error("empty directory should be removed")
 	}
 }
+
+func TestOverwriteExtents_Parallel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "large.bin")
+	size := int64(3*wipeChunk + 12345)
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0x5A}, int(size)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := overwriteExtents(f, []extent{{0, size}}, fillByte(0xAB)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(got)) != size || !bytes.Equal(got, bytes.Repeat([]byte{0xAB}, int(size))) {
+		t.Error("file not wholly overwritten, or its size changed")
+	}
+}
+
+func TestSecureDelete_SparseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Data at the start and 8 MiB in, with a hole between and after
+	written := []extent{{0, 4096}, {8 << 20, 4096}}
+	for _, e := range written {
+		if _, err := f.WriteAt(bytes.Repeat([]byte{0x5A}, int(e.len)), e.off); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := int64(16 << 20)
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	// Whatever the filesystem reports, the data is covered
+	extents := dataExtents(f, size)
+	for _, w := range written {
+		covered := false
+		for _, e := range extents {
+			if e.off <= w.off && w.off+w.len <= e.off+e.len {
+				covered = true
+			}
+		}
+		if !covered {
+			t.Errorf("data at %d not in extents %v", w.off, extents)
+		}
+	}
+	f.Close()
+
+	if err := SecureDelete(path); err != nil {
+		t.Fatalf("SecureDelete error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file should be removed")
+	}
+}
+
+func BenchmarkSecureDelete_1MB(b *testing.B) {
+	dir := b.TempDir()
+	data := make([]byte, 1<<20)
+
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		path := filepath.Join(dir, fmt.Sprintf("f%d", i))
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		if err := SecureDelete(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -2,15 +2,21 @@ package storage
 
 import (
 	"bytes"
-	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/scttfrdmn/dead-drop/internal/crypto"
+	"github.com/scttfrdmn/dead-drop/internal/faultinject"
+	"github.com/scttfrdmn/dead-drop/internal/fuzzyhash"
+	"github.com/scttfrdmn/dead-drop/internal/triage"
 )
 
 // Drop represents a submitted file
@@ -31,7 +37,35 @@ type Manager struct {
 	Quota         *QuotaManager
 	Locks         *DropLockManager
 	SecureDelete  bool
-	IsProtected   func(id string) bool
+
+	// FuzzyHash records an ssdeep hash of each new drop in its metadata.
+	FuzzyHash bool
+	// TriageStats records summary statistics of each new drop in its metadata.
+	TriageStats bool
+	// VerifyHash checks a drop's contents, read whole, against the SHA-256
+	// recorded when it was stored, failing with ErrHashMismatch.
+	VerifyHash bool
+
+	// Retention maps retention class names to their cleanup rules. Drops
+	// without a known class use the cleanup MaxAge.
+	Retention map[string]RetentionClass
+
+	// KeyLimits bound how much the storage key encrypts before new drops
+	// are refused until it is rotated.
+	KeyLimits KeyLimits
+
+	// keyMu guards EncryptionKey and Receipts, which are nil while locked
+	keyMu    sync.RWMutex
+	lastUsed atomic.Int64 // UnixNano of the last key use
+
+	expiry expiryIndex
+
+	keyUsage keyUsage
+
+	// cleanup stops and waits for the StartCleanup loop at Close
+	cleanupStop chan struct{}
+	cleanupDone sync.WaitGroup
+	closeOnce   sync.Once
 }
 
 // NewManager creates a new storage manager.
@@ -42,14 +76,14 @@ func NewManager(storageDir string, masterKey []byte) (*Manager, error) {
 	}
 
 	// Load or generate encryption key
-	keyPath := filepath.Join(storageDir, ".encryption.key")
+	keyPath := filepath.Join(storageDir, encryptionKeyFile)
 	key, err := loadOrGenerateKey(keyPath, masterKey, []byte("encryption-key"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load encryption key: %w", err)
 	}
 
 	// Initialize receipt manager
-	receiptKeyPath := filepath.Join(storageDir, ".receipt.key")
+	receiptKeyPath := filepath.Join(storageDir, receiptKeyFile)
 	receipts, err := NewReceiptManager(receiptKeyPath, masterKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize receipt manager: %w", err)
@@ -64,12 +98,17 @@ func NewManager(storageDir string, masterKey []byte) (*Manager, error) {
 	}, nil
 }
 
-// Close zeros sensitive key material.
+// Close stops periodic cleanup, waiting for a pass in progress to finish,
+// then zeros the key material and leaves the manager locked, so anything
+// still running fails with ErrLocked instead of using zeroed keys.
 func (m *Manager) Close() {
-	ZeroBytes(m.EncryptionKey)
-	if m.Receipts != nil {
-		ZeroBytes(m.Receipts.secret)
-	}
+	m.closeOnce.Do(func() {
+		if m.cleanupStop != nil {
+			close(m.cleanupStop)
+		}
+	})
+	m.cleanupDone.Wait()
+	m.Lock()
 }
 
 // loadOrGenerateKey loads existing key or generates new one.
@@ -123,17 +162,78 @@ func loadOrGenerateKey(keyPath string, masterKey, purpose []byte) ([]byte, error
 	return key, nil
 }
 
-// generateID creates a random hex ID
-func generateID() (string, error) {
-	bytes := make([]byte, 16)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(bytes), nil
+// MaxMessageLen limits the message a source sends with a file, in bytes.
+const MaxMessageLen = 64 * 1024
+
+// SaveOptions carries optional per-drop attributes that are recorded in the
+// drop's encrypted metadata.
+type SaveOptions struct {
+	// ClientEncrypted records that the submitter declared the payload as
+	// encrypted before upload.
+	ClientEncrypted bool
+	// KeyFingerprint identifies the client-side key the payload was
+	// encrypted with (crypto.KeyFingerprint), so that receivers can tell
+	// which key opens the drop. The key itself never reaches the server.
+	KeyFingerprint string
+	// Flags are anomaly markers raised during upload analysis (e.g., "high_entropy").
+	Flags []string
+	// Retention names the retention class governing cleanup of the drop.
+	Retention string
+	// Campaign is the campaign code the drop was submitted under.
+	Campaign string
+	// Canary names the registered canary document the upload matched.
+	Canary string
+	// Scrubbed records the server-side scrub profile ("standard" or
+	// "strict") in effect when the upload was scrubbed.
+	Scrubbed string
+	// Honeypot marks a decoy drop, which cleanup never deletes.
+	Honeypot bool
+	// Pending stores the upload as received, to be checked and scrubbed
+	// later; GetDrop refuses it until CompleteProcessing.
+	Pending bool
+	// Message is text the source sent with the file, at most MaxMessageLen
+	// bytes. It is stored in the encrypted metadata.
+	Message string
+	// ContentType is the type the client declared for the file. The type
+	// recorded is the one sniffed from the contents unless they bear the
+	// declared one out; client-encrypted payloads record none.
+	ContentType string
+	// Expires, if positive, is how long after receipt the uploader wants
+	// the drop deleted, in whole hours. Cleanup deletes it then, or earlier
+	// if its retention class or the default maximum age says so.
+	Expires time.Duration
+	// Passphrase, if set, adds an inner layer of encryption under a key
+	// derived from it with Argon2id, so that the drop can only be read with
+	// GetDropWithPassphrase. The passphrase itself is not stored. It cannot
+	// be combined with Pending.
+	Passphrase string
 }
 
 // SaveDrop stores an uploaded file with encryption
 func (m *Manager) SaveDrop(filename string, reader io.Reader) (*Drop, error) {
+	return m.SaveDropWithOptions(filename, reader, nil)
+}
+
+// SaveDropWithOptions stores an uploaded file with encryption, recording the
+// given options in the drop metadata. A nil opts is equivalent to SaveDrop.
+func (m *Manager) SaveDropWithOptions(filename string, reader io.Reader, opts *SaveOptions) (*Drop, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+	if err := m.checkKeyUsage(); err != nil {
+		return nil, err
+	}
+
+	if opts == nil {
+		opts = &SaveOptions{}
+	}
+	if opts.Passphrase != "" && opts.Pending {
+		return nil, errors.New("passphrase-protected drops cannot be processed later")
+	}
+
 	id, err := generateID()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate ID: %w", err)
@@ -142,31 +242,48 @@ func (m *Manager) SaveDrop(filename string, reader io.Reader) (*Drop, error) {
 	// Generate HMAC receipt
 	receipt := m.Receipts.Generate(id)
 
-	// Create drop directory
-	dropDir := filepath.Join(m.StorageDir, id)
+	// Create drop directory, recording the intent first so that a crash
+	// cannot leave a drop without metadata behind
+	dropDir := DropDir(m.StorageDir, id)
+	done, err := m.beginIntent(intentSave, id, dropDir)
+	if err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(dropDir, 0700); err != nil {
+		done()
 		return nil, fmt.Errorf("failed to create drop directory: %w", err)
 	}
 
-	// Read file data for size calculation and hashing
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-	defer ZeroBytes(data)
-
-	size := int64(len(data))
-
-	// Check quota if configured
-	if m.Quota != nil {
-		if err := m.Quota.Reserve(size); err != nil {
-			_ = os.Remove(dropDir)
-			return nil, fmt.Errorf("quota exceeded: %w", err)
+	// On any failure below, remove the partial drop and give back any quota
+	// it reserved
+	saved, reserved := false, false
+	var stored int64
+	defer func() {
+		if saved {
+			done()
+			return
+		}
+		if os.RemoveAll(dropDir) == nil {
+			done()
 		}
+		if reserved {
+			m.Quota.Release(stored)
+		}
+	}()
+
+	// The file is hashed and sniffed as it is encrypted, so memory use does
+	// not grow with its size. Fuzzy hashes and triage statistics need the
+	// whole file, so with either enabled it is also buffered.
+	hash := sha256.New()
+	sniff := &prefixBuffer{limit: sniffLen}
+	taps := []io.Writer{hash, sniff}
+	var whole *bytes.Buffer
+	if m.FuzzyHash || m.TriageStats {
+		whole = new(bytes.Buffer)
+		defer func() { ZeroBytes(whole.Bytes()) }()
+		taps = append(taps, whole)
 	}
-
-	// Compute file hash
-	fileHash := computeSHA256(data)
+	counted := &countingReader{r: io.TeeReader(reader, io.MultiWriter(taps...))}
 
 	// Encrypt and save file with AAD
 	filePath := filepath.Join(dropDir, "data")
@@ -176,17 +293,77 @@ func (m *Manager) SaveDrop(filename string, reader io.Reader) (*Drop, error) {
 	}
 	defer f.Close()
 
-	if err := crypto.EncryptStream(m.EncryptionKey, bytes.NewReader(data), f, []byte(id)); err != nil {
+	var salt, passKey []byte
+	if opts.Passphrase != "" {
+		if salt, passKey, err = newPassphraseKey(opts.Passphrase); err != nil {
+			return nil, err
+		}
+		defer ZeroBytes(passKey)
+	}
+	w := faultinject.Writer(faultinject.StorageWrite, f)
+	if err := encryptData(m.EncryptionKey, passKey, counted, w, []byte(id)); err != nil {
 		return nil, fmt.Errorf("failed to encrypt file: %w", err)
 	}
+	size := counted.n
+	encrypted := size // under the storage key
+	if passKey != nil {
+		encrypted = crypto.EncryptedSize(size)
+	}
+	stored = crypto.EncryptedSize(encrypted)
+
+	// Check quota if configured, reserving the size of the encrypted file
+	// that DeleteDrop and the startup scan account for. The size is only
+	// known once the upload has been read, so uploads in flight may briefly
+	// overshoot the quota by up to their combined size.
+	if m.Quota != nil {
+		if err := m.Quota.Reserve(stored); err != nil {
+			return nil, err
+		}
+		reserved = true
+	}
+
+	fileHash := hex.EncodeToString(hash.Sum(nil))
+	var fuzzy string
+	var stats *triage.Stats
+	if whole != nil {
+		if m.FuzzyHash {
+			fuzzy, _ = fuzzyhash.Sum(whole.Bytes()) // small files get none
+		}
+		if m.TriageStats {
+			stats = triage.Summarize(whole.Bytes())
+		}
+	}
+	var contentType string
+	if !opts.ClientEncrypted {
+		contentType = verifiedContentType(opts.ContentType, sniff.buf)
+	}
 
 	// Save encrypted metadata with timestamp rounded to hour
 	now := roundToHour(time.Now())
 	metaPayload := &MetadataPayload{
-		Filename:      filename,
-		Receipt:       receipt,
-		TimestampHour: now.Unix(),
-		FileHash:      fileHash,
+		Filename:        filename,
+		Receipt:         receipt,
+		TimestampHour:   now.Unix(),
+		FileHash:        fileHash,
+		FuzzyHash:       fuzzy,
+		Message:         opts.Message,
+		ContentType:     contentType,
+		Stats:           stats,
+		ClientEncrypted: opts.ClientEncrypted,
+		KeyFingerprint:  opts.KeyFingerprint,
+		Flags:           opts.Flags,
+		Canary:          opts.Canary,
+		Scrubbed:        opts.Scrubbed,
+		Retention:       opts.Retention,
+		Campaign:        opts.Campaign,
+		Honeypot:        opts.Honeypot,
+		PassphraseSalt:  salt,
+	}
+	if opts.Expires > 0 {
+		metaPayload.ExpiresHour = now.Add(opts.Expires.Truncate(time.Hour)).Unix()
+	}
+	if opts.Pending {
+		metaPayload.Processing = ProcessingPending
 	}
 
 	metaPath := filepath.Join(dropDir, "meta")
@@ -194,6 +371,9 @@ func (m *Manager) SaveDrop(filename string, reader io.Reader) (*Drop, error) {
 		return nil, fmt.Errorf("failed to save metadata: %w", err)
 	}
 
+	saved = true
+	m.recordKeyUse(encrypted, 2)
+	m.expiry.set(id, expiryEntry{Hour: now.Unix(), Retention: opts.Retention, Campaign: opts.Campaign, Size: stored, Honeypot: opts.Honeypot, Expires: metaPayload.ExpiresHour})
 	return &Drop{
 		ID:        id,
 		Filename:  filename,
@@ -204,24 +384,79 @@ func (m *Manager) SaveDrop(filename string, reader io.Reader) (*Drop, error) {
 	}, nil
 }
 
-// GetDrop retrieves and decrypts a drop by ID
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// GetDrop retrieves and decrypts a drop by ID. A drop still waiting for
+// asynchronous processing is refused with ErrPending, and one in quarantine
+// with ErrQuarantined.
 func (m *Manager) GetDrop(id string) (string, io.ReadCloser, error) {
+	payload, reader, err := m.GetDropWithMetadata(id)
+	if err != nil {
+		return "", nil, err
+	}
+	return payload.Filename, reader, nil
+}
+
+// GetDropWithMetadata is GetDrop returning the drop's metadata, including
+// the source's message, with the contents. A passphrase-protected drop is
+// refused with ErrPassphraseRequired.
+func (m *Manager) GetDropWithMetadata(id string) (*MetadataPayload, io.ReadCloser, error) {
+	return m.GetDropWithPassphrase(id, "")
+}
+
+// openDrop decrypts a drop whose metadata passes check.
+func (m *Manager) openDrop(id string, check func(*MetadataPayload) error) (*MetadataPayload, io.ReadCloser, error) {
+	payload, f, plaintext, err := m.openDataFile(id, check, func(key []byte, f *os.File) (io.Reader, error) {
+		return crypto.NewDecryptReader(key, faultinject.Reader(faultinject.StorageRead, f), []byte(id))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return payload, &dropReader{r: plaintext, f: f}, nil
+}
+
+// openDataFile opens the data file of a drop whose metadata passes check,
+// and decrypts it with decrypt while the storage key is held.
+func (m *Manager) openDataFile(id string, check func(*MetadataPayload) error, decrypt func(key []byte, f *os.File) (io.Reader, error)) (*MetadataPayload, *os.File, io.Reader, error) {
 	// SECURITY: Validate drop ID to prevent path traversal
 	if err := ValidateDropID(id); err != nil {
-		return "", nil, fmt.Errorf("invalid drop ID: %w", err)
+		return nil, nil, nil, fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, nil, nil, ErrLocked
 	}
+	m.touch()
 
 	// Acquire read lock
 	m.Locks.RLock(id)
 	defer m.Locks.RUnlock(id)
 
-	dropDir := filepath.Join(m.StorageDir, id)
+	dropDir := m.dropDir(id)
 
 	// Read encrypted metadata
 	metaPath := filepath.Join(dropDir, "meta")
 	payload, err := loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
 	if err != nil {
-		return "", nil, fmt.Errorf("drop not found: %w", err)
+		if m.inQuarantine(id) {
+			return nil, nil, nil, ErrQuarantined
+		}
+		return nil, nil, nil, fmt.Errorf("drop not found: %w", err)
+	}
+	if err := check(payload); err != nil {
+		return nil, nil, nil, err
 	}
 
 	// Open encrypted file (try "data" first, fall back to legacy "file.enc")
@@ -231,17 +466,80 @@ func (m *Manager) GetDrop(id string) (string, io.ReadCloser, error) {
 	}
 	f, err := os.Open(filePath) // #nosec G304 -- path built from validated drop ID
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to open file: %w", err)
 	}
-	defer f.Close()
 
-	// Decrypt with AAD
-	decrypted := bytes.NewBuffer(nil)
-	if err := crypto.DecryptStream(m.EncryptionKey, f, decrypted, []byte(id)); err != nil {
-		return "", nil, fmt.Errorf("failed to decrypt file: %w", err)
+	// Decrypt with AAD, a chunk at a time as the caller reads. The drop lock
+	// only covers opening: a drop deleted or replaced while it is read keeps
+	// its open file on most systems, and otherwise fails authentication.
+	plaintext, err := decrypt(m.EncryptionKey, f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, nil, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+	return payload, f, plaintext, nil
+}
+
+// dropReader reads a drop's decrypted contents, closing its data file as
+// soon as the contents have all been read, so that the drop can be deleted
+// or replaced before Close, even on Windows.
+type dropReader struct {
+	r io.Reader
+	f *os.File
+}
+
+func (d *dropReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if err != nil {
+		_ = d.Close()
+	}
+	return n, err
+}
+
+func (d *dropReader) Close() error {
+	if d.f == nil {
+		return nil
+	}
+	err := d.f.Close()
+	d.f = nil
+	return err
+}
+
+// StoredSize returns the size of a drop's encrypted data file, which bounds
+// the memory needed to decrypt it.
+func (m *Manager) StoredSize(id string) (int64, error) {
+	if err := ValidateDropID(id); err != nil {
+		return 0, fmt.Errorf("invalid drop ID: %w", err)
 	}
 
-	return payload.Filename, io.NopCloser(decrypted), nil
+	info, err := os.Stat(dataFilePath(m.dropDir(id)))
+	if err != nil {
+		if m.inQuarantine(id) {
+			return 0, ErrQuarantined
+		}
+		return 0, fmt.Errorf("drop not found: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// dataFilePath returns the path of the encrypted data file in dropDir,
+// falling back to the legacy "file.enc" name.
+func dataFilePath(dropDir string) string {
+	filePath := filepath.Join(dropDir, "data")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		filePath = filepath.Join(dropDir, "file.enc")
+	}
+	return filePath
+}
+
+// dataFileSize returns the size of the data file in dropDir, or 0 if it is
+// missing.
+func dataFileSize(dropDir string) int64 {
+	info, err := os.Stat(dataFilePath(dropDir))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
 }
 
 // GetDropMetadata retrieves the metadata for a drop without decrypting the file.
@@ -250,14 +548,70 @@ func (m *Manager) GetDropMetadata(id string) (*MetadataPayload, error) {
 		return nil, fmt.Errorf("invalid drop ID: %w", err)
 	}
 
-	metaPath := filepath.Join(m.StorageDir, id, "meta")
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return nil, ErrLocked
+	}
+	m.touch()
+
+	metaPath := filepath.Join(m.dropDir(id), "meta")
 	return loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
 }
 
+// updateMetadata applies update to a drop's encrypted metadata under the
+// drop's lock, rewriting it only if update reports a change.
+func (m *Manager) updateMetadata(id string, update func(*MetadataPayload) bool) error {
+	if err := ValidateDropID(id); err != nil {
+		return fmt.Errorf("invalid drop ID: %w", err)
+	}
+
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+	m.touch()
+
+	m.Locks.Lock(id)
+	defer m.Locks.Unlock(id)
+
+	metaPath := filepath.Join(m.dropDir(id), "meta")
+	payload, err := loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
+	if err != nil {
+		return fmt.Errorf("drop not found: %w", err)
+	}
+	if !update(payload) {
+		return nil
+	}
+	return m.replaceMetadata(metaPath, id, payload)
+}
+
+// replaceMetadata rewrites a drop's metadata beside the original and renames
+// it into place, so a crash cannot leave the drop with truncated metadata.
+// The caller holds the drop's write lock.
+func (m *Manager) replaceMetadata(metaPath, id string, payload *MetadataPayload) error {
+	tmpPath := metaPath + ".tmp"
+	if err := saveEncryptedMetadata(tmpPath, m.EncryptionKey, id, payload); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	m.recordKeyUse(0, 1)
+	return os.Rename(tmpPath, metaPath)
+}
+
 // deleteIfExpired atomically checks whether a drop is expired and deletes it
 // under a single write lock, preventing TOCTOU races with concurrent retrievals.
-// Returns true if the drop was deleted, false if it was skipped (locked, not expired, or unreadable).
+// Returns true if the drop was deleted, false if it was skipped (locked, not expired, unreadable,
+// or under legal hold).
+// Expired drops of a pinned-review class are kept and reported with errPendingReview.
 func (m *Manager) deleteIfExpired(id string, maxAge time.Duration, now time.Time) (bool, error) {
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return false, nil
+	}
+
 	// Skip drops that are currently locked (being retrieved)
 	if !m.Locks.TryLock(id) {
 		return false, nil
@@ -266,62 +620,95 @@ func (m *Manager) deleteIfExpired(id string, maxAge time.Duration, now time.Time
 
 	// Load metadata to check timestamp (read directly, not via GetDropMetadata,
 	// since we already hold the write lock)
-	metaPath := filepath.Join(m.StorageDir, id, "meta")
+	dropDir := m.dropDir(id)
+	metaPath := filepath.Join(dropDir, "meta")
 	payload, err := loadEncryptedMetadata(metaPath, m.EncryptionKey, id)
 	if err != nil {
+		if _, statErr := os.Stat(dropDir); os.IsNotExist(statErr) {
+			m.expiry.remove(id)
+		}
 		return false, nil
 	}
-
-	dropTime := time.Unix(payload.TimestampHour, 0)
-	if now.Sub(dropTime) <= maxAge {
+	if payload.LegalHold || payload.Honeypot {
+		m.expiry.set(id, indexEntry(dropDir, payload))
 		return false, nil
 	}
 
-	// Drop is expired — delete it while still holding the write lock
-	dropDir := filepath.Join(m.StorageDir, id)
-
-	if m.Quota != nil {
-		filePath := filepath.Join(dropDir, "data")
-		if _, statErr := os.Stat(filePath); os.IsNotExist(statErr) {
-			filePath = filepath.Join(dropDir, "file.enc")
-		}
-		if info, statErr := os.Stat(filePath); statErr == nil {
-			m.Quota.Release(info.Size())
-		}
+	// The drop's retention class, if known, overrides the default age;
+	// an age of zero means the drop never expires
+	class, hasClass := m.Retention[payload.Retention]
+	if hasClass {
+		maxAge = class.MaxAge
 	}
 
-	if m.SecureDelete {
-		return true, SecureDeleteDir(dropDir)
+	if !expired(payload.TimestampHour, payload.ExpiresHour, maxAge, now) {
+		return false, nil
 	}
-	return true, os.RemoveAll(dropDir)
+	if hasClass && class.PinnedReview {
+		return false, errPendingReview
+	}
+
+	// Drop is expired — delete it while still holding the write lock
+	return true, m.removeDropDir(id, dropDir)
 }
 
-// DeleteDrop removes a drop
+// DeleteDrop removes a drop. Drops under legal hold are refused with
+// ErrLegalHold; the hold is read from metadata, so the keys must be loaded.
 func (m *Manager) DeleteDrop(id string) error {
 	// SECURITY: Validate drop ID to prevent path traversal
 	if err := ValidateDropID(id); err != nil {
 		return fmt.Errorf("invalid drop ID: %w", err)
 	}
 
+	m.keyMu.RLock()
+	defer m.keyMu.RUnlock()
+	if m.EncryptionKey == nil {
+		return ErrLocked
+	}
+
 	// Acquire write lock
 	m.Locks.Lock(id)
 	defer m.Locks.Unlock(id)
 
-	dropDir := filepath.Join(m.StorageDir, id)
+	dropDir := m.dropDir(id)
 
-	// Release quota for the encrypted file size (try "data" first, fall back to legacy "file.enc")
-	if m.Quota != nil {
-		filePath := filepath.Join(dropDir, "data")
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			filePath = filepath.Join(dropDir, "file.enc")
-		}
-		if info, err := os.Stat(filePath); err == nil {
-			m.Quota.Release(info.Size())
-		}
+	if payload, err := loadEncryptedMetadata(filepath.Join(dropDir, "meta"), m.EncryptionKey, id); err == nil && payload.LegalHold {
+		return ErrLegalHold
+	}
+
+	return m.removeDropDir(id, dropDir)
+}
+
+// removeDropDir deletes a drop directory, securely if configured. Quota for
+// the encrypted file (try "data" first, fall back to legacy "file.enc") is
+// released only once that file is actually gone, so a failed deletion leaves
+// the quota agreeing with what is on disk; the deletion is finished at the
+// next start. The caller holds the drop's write lock.
+func (m *Manager) removeDropDir(id, dropDir string) error {
+	filePath := filepath.Join(dropDir, "data")
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		filePath = filepath.Join(dropDir, "file.enc")
 	}
+	info, statErr := os.Stat(filePath)
 
+	done, err := m.beginIntent(intentDelete, id, dropDir)
+	if err != nil {
+		return err
+	}
 	if m.SecureDelete {
-		return SecureDeleteDir(dropDir)
+		err = SecureDeleteDir(dropDir)
+	} else {
+		err = os.RemoveAll(dropDir)
+	}
+
+	if err == nil {
+		m.expiry.remove(id)
+		done()
+	}
+	if m.Quota != nil && statErr == nil {
+		if _, gone := os.Stat(filePath); os.IsNotExist(gone) {
+			m.Quota.Release(info.Size())
+		}
 	}
-	return os.RemoveAll(dropDir)
+	return err
 }
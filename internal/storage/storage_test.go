@@ -2,10 +2,16 @@ package storage
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/scttfrdmn/dead-drop/internal/crypto"
 )
 
 func TestNewManager_CreatesDir(t *testing.T) {
@@ -154,7 +160,7 @@ func TestGetDrop_LegacyFileEnc(t *testing.T) {
 	drop, _ := m.SaveDrop("test.txt", bytes.NewReader([]byte("test data")))
 
 	// Rename "data" to "file.enc" to simulate legacy format
-	dropDir := filepath.Join(dir, drop.ID)
+	dropDir := DropDir(dir, drop.ID)
 	os.Rename(filepath.Join(dropDir, "data"), filepath.Join(dropDir, "file.enc"))
 
 	filename, reader, err := m.GetDrop(drop.ID)
@@ -185,7 +191,7 @@ func TestDeleteDrop(t *testing.T) {
 		t.Fatalf("DeleteDrop error: %v", err)
 	}
 
-	dropDir := filepath.Join(dir, drop.ID)
+	dropDir := DropDir(dir, drop.ID)
 	if _, err := os.Stat(dropDir); !os.IsNotExist(err) {
 		t.Error("drop directory should be removed")
 	}
@@ -214,7 +220,7 @@ func TestDeleteDrop_SecureDelete(t *testing.T) {
 		t.Fatalf("secure DeleteDrop error: %v", err)
 	}
 
-	dropDir := filepath.Join(dir, drop.ID)
+	dropDir := DropDir(dir, drop.ID)
 	if _, err := os.Stat(dropDir); !os.IsNotExist(err) {
 		t.Error("drop directory should be securely removed")
 	}
@@ -265,8 +271,8 @@ func TestSaveDrop_QuotaExceeded(t *testing.T) {
 	}
 
 	_, err = m.SaveDrop("second.txt", bytes.NewReader([]byte("second")))
-	if err == nil {
-		t.Fatal("second drop should fail due to quota")
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("second drop error = %v, want ErrQuotaExceeded", err)
 	}
 }
 
@@ -395,7 +401,7 @@ func TestDeleteDrop_WithLegacyFileEnc(t *testing.T) {
 	drop, _ := m.SaveDrop("test.txt", bytes.NewReader([]byte("test")))
 
 	// Rename to legacy format
-	dropDir := filepath.Join(dir, drop.ID)
+	dropDir := DropDir(dir, drop.ID)
 	os.Rename(filepath.Join(dropDir, "data"), filepath.Join(dropDir, "file.enc"))
 
 	err := m.DeleteDrop(drop.ID)
@@ -590,3 +596,128 @@ func TestClose_NilReceipts(t *testing.T) {
 	}
 	m.Close() // should not panic
 }
+
+func TestSaveDropWithOptions_RecordsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	m, _ := NewManager(dir, nil)
+	defer m.Close()
+
+	opts := &SaveOptions{ClientEncrypted: true, Flags: []string{FlagHighEntropy}}
+	drop, err := m.SaveDropWithOptions("blob.bin", bytes.NewReader([]byte("ciphertext")), opts)
+	if err != nil {
+		t.Fatalf("SaveDropWithOptions error: %v", err)
+	}
+
+	meta, err := m.GetDropMetadata(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !meta.ClientEncrypted {
+		t.Error("ClientEncrypted should be true")
+	}
+	if len(meta.Flags) != 1 || meta.Flags[0] != FlagHighEntropy {
+		t.Errorf("Flags = %v", meta.Flags)
+	}
+}
+
+func TestStoredSize(t *testing.T) {
+	m, err := NewManager(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	drop, err := m.SaveDrop("a.txt", bytes.NewReader(make([]byte, 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := m.StoredSize(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size < 1000 {
+		t.Errorf("StoredSize = %d, want at least the plaintext size", size)
+	}
+	if _, err := m.StoredSize("00000000000000000000000000000000"); err == nil {
+		t.Error("StoredSize should fail for a missing drop")
+	}
+}
+
+func TestSaveDrop_Streams(t *testing.T) {
+	m := setupTestManager(t)
+	defer m.Close()
+
+	// Several encryption chunks and a partial one
+	data := make([]byte, 3*crypto.StreamChunkSize+17)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	drop, err := m.SaveDrop("big.bin", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drop.Size != int64(len(data)) {
+		t.Errorf("Size = %d, want %d", drop.Size, len(data))
+	}
+	if sum := sha256.Sum256(data); drop.FileHash != hex.EncodeToString(sum[:]) {
+		t.Error("FileHash is not the SHA-256 of the contents")
+	}
+	if size, _ := m.StoredSize(drop.ID); size != crypto.EncryptedSize(int64(len(data))) {
+		t.Errorf("StoredSize = %d, want %d", size, crypto.EncryptedSize(int64(len(data))))
+	}
+
+	_, reader, err := m.GetDrop(drop.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("retrieved contents differ")
+	}
+
+	// A drop read to the end has released its data file
+	if err := m.DeleteDrop(drop.ID); err != nil {
+		t.Errorf("DeleteDrop after reading: %v", err)
+	}
+}
+
+func BenchmarkSaveDrop_1MB(b *testing.B) {
+	m := setupTestManager(b)
+	defer m.Close()
+	data := bytes.Repeat([]byte{0x5a}, 1<<20)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.SaveDrop("bench.bin", bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetDrop_1MB(b *testing.B) {
+	m := setupTestManager(b)
+	defer m.Close()
+	data := bytes.Repeat([]byte{0x5a}, 1<<20)
+	drop, err := m.SaveDrop("bench.bin", bytes.NewReader(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, r, err := m.GetDrop(drop.ID)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, r)
+		r.Close()
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// storeLockFile is held locked by the process that owns a storage directory.
+const storeLockFile = ".lock"
+
+// ErrStoreInUse is returned by LockStore when another process holds the
+// storage directory.
+var ErrStoreInUse = errors.New("storage directory is in use")
+
+// StoreLock is an exclusive, cross-process lock on a storage directory. The
+// server holds one for as long as it runs, and offline tools that rewrite
+// drops take one first, so the two never work on the same store at once.
+// The operating system releases the lock when its holder exits, so a crash
+// never leaves a store locked.
+type StoreLock struct {
+	f *os.File
+}
+
+// LockStore takes the lock on storageDir for owner, a short description of
+// the process (e.g. "dead-drop-server") shown to anyone else trying to take
+// it. It does not wait: if another process holds the lock it returns an
+// error wrapping ErrStoreInUse that names the holder.
+func LockStore(storageDir, owner string) (*StoreLock, error) {
+	if err := os.MkdirAll(storageDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	path := filepath.Join(storageDir, storeLockFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600) // #nosec G304 -- fixed name inside storage dir
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		holder, _ := os.ReadFile(path) // #nosec G304 -- fixed name inside storage dir
+		f.Close()
+		if errors.Is(err, ErrStoreInUse) {
+			return nil, fmt.Errorf("%w: %s holds %s", ErrStoreInUse, describeHolder(holder), storageDir)
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	// Record the holder for the error above; the lock itself is what counts
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(fmt.Sprintf("%s pid %d\n", owner, os.Getpid())), 0)
+	}
+	return &StoreLock{f: f}, nil
+}
+
+// describeHolder returns the holder recorded in a lock file, or a
+// placeholder if it is empty.
+func describeHolder(data []byte) string {
+	if s := strings.TrimSpace(string(data)); s != "" {
+		return s
+	}
+	return "another process"
+}
+
+// Release drops the lock. The lock file stays in place for the next holder.
+func (l *StoreLock) Release() error {
+	_ = l.f.Truncate(0)
+	return l.f.Close()
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLockStore(t *testing.T) {
+	dir := t.TempDir()
+
+	lock, err := LockStore(dir, "first")
+	if err != nil {
+		t.Fatalf("LockStore: %v", err)
+	}
+
+	_, err = LockStore(dir, "second")
+	if !errors.Is(err, ErrStoreInUse) {
+		t.Fatalf("second LockStore error = %v, want ErrStoreInUse", err)
+	}
+	if !strings.Contains(err.Error(), "first pid") {
+		t.Errorf("error %q does not name the holder", err)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	lock, err = LockStore(dir, "second")
+	if err != nil {
+		t.Fatalf("LockStore after release: %v", err)
+	}
+	lock.Release()
+}
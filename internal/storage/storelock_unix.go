@@ -0,0 +1,18 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive flock on f without blocking.
+func lockFile(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) // #nosec G115 -- file descriptors fit in an int
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrStoreInUse
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+// Package textsanitize removes tracking artifacts from text a source submits:
+// invisible characters, unusual spaces and lookalike letters that canary
+// traps use to give each copy of a document a unique fingerprint, and the
+// print stamps that document systems and printer tracking tools add to
+// printed or decoded pages. What a reader sees is left as it is.
+package textsanitize
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Report counts what Sanitize changed.
+type Report struct {
+	Invisible  int `json:"invisible,omitempty"`   // format and control characters removed
+	Spaces     int `json:"spaces,omitempty"`      // unusual spaces made plain
+	Homoglyphs int `json:"homoglyphs,omitempty"`  // lookalike letters replaced
+	PrintMarks int `json:"print_marks,omitempty"` // print-stamp lines removed
+}
+
+// Changed reports whether anything was removed or replaced.
+func (r Report) Changed() bool {
+	return r.Invisible+r.Spaces+r.Homoglyphs+r.PrintMarks > 0
+}
+
+// StripInvisible removes format characters (zero-width spaces and joiners,
+// byte order marks, bidirectional controls, tag characters, soft hyphens)
+// and control characters other than tab, newline and carriage return, and
+// returns how many it removed. Invalid UTF-8 is dropped.
+func StripInvisible(s string) (string, int) {
+	removed := 0
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || r == '\r' {
+			return r
+		}
+		if unicode.Is(unicode.Cf, r) || unicode.IsControl(r) {
+			removed++
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(s, ""))
+	return s, removed
+}
+
+// Sanitize strips invisible characters, replaces unusual spaces with plain
+// ones, replaces lookalike letters in mixed-script words with their Latin
+// originals, and removes print-stamp lines.
+func Sanitize(s string) (string, Report) {
+	var report Report
+	s, report.Invisible = StripInvisible(s)
+	s, report.Spaces = normalizeSpaces(s)
+	s, report.Homoglyphs = replaceHomoglyphs(s)
+	s, report.PrintMarks = removePrintMarks(s)
+	return s, report
+}
+
+// normalizeSpaces replaces space separators other than the ASCII space, such
+// as no-break, thin, hair and ideographic spaces, whose widths can encode a
+// watermark.
+func normalizeSpaces(s string) (string, int) {
+	replaced := 0
+	s = strings.Map(func(r rune) rune {
+		if r != ' ' && unicode.Is(unicode.Zs, r) {
+			replaced++
+			return ' '
+		}
+		return r
+	}, s)
+	return s, replaced
+}
+
+// homoglyphs maps Cyrillic and Greek letters to the Latin letters they are
+// indistinguishable from in most fonts.
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'\u0430': 'a', '\u0435': 'e', '\u043e': 'o', '\u0440': 'p', '\u0441': 'c', '\u0445': 'x', '\u0443': 'y',
+	'\u0456': 'i', '\u0458': 'j', '\u0455': 's', '\u0501': 'd', '\u051b': 'q', '\u051d': 'w', '\u04bb': 'h',
+	'\u0410': 'A', '\u0412': 'B', '\u0415': 'E', '\u041a': 'K', '\u041c': 'M', '\u041d': 'H', '\u041e': 'O',
+	'\u0420': 'P', '\u0421': 'C', '\u0422': 'T', '\u0425': 'X', '\u0406': 'I', '\u0408': 'J', '\u0405': 'S',
+	// Greek
+	'\u03bf': 'o', '\u03bd': 'v', '\u0391': 'A', '\u0392': 'B', '\u0395': 'E', '\u0396': 'Z', '\u0397': 'H',
+	'\u0399': 'I', '\u039a': 'K', '\u039c': 'M', '\u039d': 'N', '\u039f': 'O', '\u03a1': 'P', '\u03a4': 'T',
+	'\u03a5': 'Y', '\u03a7': 'X',
+}
+
+// latinFor returns the Latin letter r imitates: a homoglyph or a fullwidth
+// Latin letter.
+func latinFor(r rune) (rune, bool) {
+	if l, ok := homoglyphs[r]; ok {
+		return l, true
+	}
+	if (r >= '\uff21' && r <= '\uff3a') || (r >= '\uff41' && r <= '\uff5a') {
+		return r - '\uff21' + 'A', true
+	}
+	return 0, false
+}
+
+// replaceHomoglyphs replaces lookalike letters in words that also contain
+// ASCII letters, the mark of a substitution into Latin text. Words written
+// wholly in another script are left alone.
+func replaceHomoglyphs(s string) (string, int) {
+	var b strings.Builder
+	replaced := 0
+	word := make([]rune, 0, 32)
+	flush := func() {
+		ascii, lookalike := false, false
+		for _, r := range word {
+			if r < unicode.MaxASCII && unicode.IsLetter(r) {
+				ascii = true
+			} else if _, ok := latinFor(r); ok {
+				lookalike = true
+			}
+		}
+		for _, r := range word {
+			if l, ok := latinFor(r); ok && ascii && lookalike {
+				r = l
+				replaced++
+			}
+			b.WriteRune(r)
+		}
+		word = word[:0]
+	}
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		b.WriteRune(r)
+	}
+	flush()
+	return b.String(), replaced
+}
+
+// printMarks match whole lines that identify who printed or copied a page,
+// or that report the decoded machine identification code (the "yellow
+// dots") of the printer that produced it.
+var printMarks = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^\s*printed\s+(by|on|at|from)\b.*$`),
+	regexp.MustCompile(`(?i)^\s*copy\s+(no\.?\s*)?\d+\s+of\s+\d+\s*$`),
+	regexp.MustCompile(`(?i)^\s*(printer|device)\s*(id|serial(\s+(no\.?|number))?|s/n)\s*[:#]\s*\S.*$`),
+	regexp.MustCompile(`(?i)^\s*(tracking\s+dots|yellow\s+dots|machine\s+identification\s+code|mic)\s*[:=].*$`),
+}
+
+// removePrintMarks removes print-stamp lines, with their line breaks.
+func removePrintMarks(s string) (string, int) {
+	lines := strings.SplitAfter(s, "\n")
+	kept := lines[:0]
+	removed := 0
+	for _, line := range lines {
+		text := strings.TrimRight(line, "\r\n")
+		if isPrintMark(text) {
+			removed++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if removed == 0 {
+		return s, 0
+	}
+	return strings.Join(kept, ""), removed
+}
+
+func isPrintMark(line string) bool {
+	for _, re := range printMarks {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package textsanitize
+
+import "testing"
+
+func TestStripInvisible(t *testing.T) {
+	tests := []struct {
+		in, want string
+		removed  int
+	}{
+		{"plain text\r\nsecond line\ttab", "plain text\r\nsecond line\ttab", 0},
+		{"zero\u200bwidth\u200c\u200d\u2060marks", "zerowidthmarks", 4},
+		{"\ufeffbom and \u202eoverride\u202c", "bom and override", 3},
+		{"soft\u00adhyphen, tag\U000E0041s\x07", "softhyphen, tags", 3},
+		{"bad \xff utf-8", "bad  utf-8", 0},
+	}
+	for _, tt := range tests {
+		got, removed := StripInvisible(tt.in)
+		if got != tt.want || removed != tt.removed {
+			t.Errorf("StripInvisible(%q) = %q, %d; want %q, %d", tt.in, got, removed, tt.want, tt.removed)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		report         Report
+	}{
+		{"clean", "Nothing to see here.\n", "Nothing to see here.\n", Report{}},
+		{"spaces", "thin\u2009and\u00a0no-break\u3000spaces", "thin and no-break spaces", Report{Spaces: 3}},
+		{"cyrillic in latin", "the b\u0430nk p\u0430ys", "the bank pays", Report{Homoglyphs: 2}},
+		{"greek capital", "\u039fctober", "October", Report{Homoglyphs: 1}},
+		{"fullwidth in latin", "re\uff50ort", "report", Report{Homoglyphs: 1}},
+		{"whole cyrillic word", "\u0441\u043e\u0440 and text", "\u0441\u043e\u0440 and text", Report{}},
+		{"whole fullwidth word", "\uff41\uff42\uff43", "\uff41\uff42\uff43", Report{}},
+		{
+			"print stamps",
+			"Memo\nPrinted by jsmith on 2026-03-02\r\nCopy 4 of 12\nbody\nPrinter serial: 0x1A2B3C\nMIC: 21-45-11\n",
+			"Memo\nbody\n",
+			Report{PrintMarks: 4},
+		},
+		{"prose about printing", "It was printed in haste.\n", "It was printed in haste.\n", Report{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report := Sanitize(tt.in)
+			if got != tt.want {
+				t.Errorf("Sanitize = %q, want %q", got, tt.want)
+			}
+			if report != tt.report {
+				t.Errorf("report = %+v, want %+v", report, tt.report)
+			}
+			if report.Changed() != (tt.report != Report{}) {
+				t.Errorf("Changed = %v", report.Changed())
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package torexit tracks the addresses of Tor exit relays so that requests
+// can be classified by origin without recording the addresses themselves.
+package torexit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultURL is the Tor Project's bulk exit list.
+const DefaultURL = "https://check.torproject.org/torbulkexitlist"
+
+// maxListBytes bounds a downloaded exit list (the real list is well under 1 MB).
+const maxListBytes = 16 << 20
+
+//go:embed exits.txt
+var embedded []byte
+
+// ErrEmptyList is returned when a fetched list contains no addresses; the
+// previous list is kept rather than treating every request as clearnet.
+var ErrEmptyList = errors.New("exit list contains no addresses")
+
+// List is a concurrency-safe set of exit relay addresses.
+type List struct {
+	mu      sync.RWMutex
+	addrs   map[netip.Addr]struct{}
+	updated time.Time
+}
+
+// Embedded returns a list loaded from the snapshot compiled into the binary.
+func Embedded() *List {
+	l := &List{}
+	if addrs, err := parse(bytes.NewReader(embedded)); err == nil {
+		l.addrs = addrs
+	}
+	return l
+}
+
+// Load replaces the list with the addresses read from r. It accepts both the
+// bulk format (one address per line) and the exit-addresses format
+// ("ExitAddress <ip> <date>").
+func (l *List) Load(r io.Reader) error {
+	addrs, err := parse(r)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return ErrEmptyList
+	}
+
+	l.mu.Lock()
+	l.addrs = addrs
+	l.updated = time.Now()
+	l.mu.Unlock()
+	return nil
+}
+
+// Contains reports whether addr is a known exit relay.
+func (l *List) Contains(addr netip.Addr) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	_, ok := l.addrs[addr.Unmap()]
+	return ok
+}
+
+// Len returns the number of known exit addresses.
+func (l *List) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.addrs)
+}
+
+// Updated returns when the list was last refreshed, or the zero time if it
+// still holds the embedded snapshot.
+func (l *List) Updated() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.updated
+}
+
+// Refresh downloads the list from url and loads it. On any error the current
+// list is kept.
+func (l *List) Refresh(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch exit list: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch exit list: status %d", resp.StatusCode)
+	}
+	return l.Load(io.LimitReader(resp.Body, maxListBytes))
+}
+
+// LoadFile loads a list cached by Save. The cache's modification time is
+// taken as the list's update time, so a stale cache stays stale.
+func (l *List) LoadFile(path string) error {
+	f, err := os.Open(path) // #nosec G304 -- path from config
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := l.Load(f); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.updated = info.ModTime()
+	l.mu.Unlock()
+	return nil
+}
+
+// Save writes the list to path (one address per line), replacing any
+// previous cache atomically.
+func (l *List) Save(path string) error {
+	l.mu.RLock()
+	lines := make([]string, 0, len(l.addrs))
+	for addr := range l.addrs {
+		lines = append(lines, addr.String())
+	}
+	l.mu.RUnlock()
+	sort.Strings(lines)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".exits-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.WriteString(tmp, strings.Join(lines, "\n")+"\n"); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func parse(r io.Reader) (map[netip.Addr]struct{}, error) {
+	addrs := make(map[netip.Addr]struct{})
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		field := fields[0]
+		if field == "ExitAddress" && len(fields) > 1 {
+			field = fields[1]
+		}
+		if addr, err := netip.ParseAddr(field); err == nil {
+			addrs[addr.Unmap()] = struct{}{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read exit list: %w", err)
+	}
+	return addrs, nil
+}
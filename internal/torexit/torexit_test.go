@@ -0,0 +1,105 @@
+package torexit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestList_LoadFormats(t *testing.T) {
+	l := &List{}
+	input := `# comment
+185.220.101.1
+ExitAddress 2001:db8::1 2026-10-01 12:00:00
+not-an-address
+ExitNode 0011223344556677
+`
+	if err := l.Load(strings.NewReader(input)); err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if l.Len() != 2 {
+		t.Errorf("Len = %d, want 2", l.Len())
+	}
+	for _, s := range []string{"185.220.101.1", "2001:db8::1", "::ffff:185.220.101.1"} {
+		if !l.Contains(netip.MustParseAddr(s)) {
+			t.Errorf("%s should be an exit", s)
+		}
+	}
+	if l.Contains(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("192.0.2.1 should not be an exit")
+	}
+	if l.Updated().IsZero() {
+		t.Error("Updated should be set after Load")
+	}
+}
+
+func TestList_EmptyLoadKeepsPrevious(t *testing.T) {
+	l := &List{}
+	l.Load(strings.NewReader("185.220.101.1\n"))
+
+	if err := l.Load(strings.NewReader("# nothing\n")); !errors.Is(err, ErrEmptyList) {
+		t.Errorf("Load error = %v, want ErrEmptyList", err)
+	}
+	if l.Len() != 1 {
+		t.Error("empty load should keep the previous list")
+	}
+}
+
+func TestList_Refresh(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("203.0.113.7\n"))
+	}))
+	defer ts.Close()
+
+	l := Embedded()
+	if err := l.Refresh(context.Background(), ts.Client(), ts.URL+"/list"); err != nil {
+		t.Fatalf("Refresh error: %v", err)
+	}
+	if !l.Contains(netip.MustParseAddr("203.0.113.7")) {
+		t.Error("refreshed address should be present")
+	}
+
+	if err := l.Refresh(context.Background(), ts.Client(), ts.URL+"/fail"); err == nil {
+		t.Error("Refresh should report a failed fetch")
+	}
+	if l.Len() != 1 {
+		t.Error("failed refresh should keep the list")
+	}
+}
+
+func TestList_SaveAndLoadFile(t *testing.T) {
+	l := &List{}
+	l.Load(strings.NewReader("185.220.101.1\n2001:db8::1\n"))
+
+	path := filepath.Join(t.TempDir(), "exits.cache")
+	if err := l.Save(path); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	cached := &List{}
+	if err := cached.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile error: %v", err)
+	}
+	if cached.Len() != 2 || !cached.Contains(netip.MustParseAddr("2001:db8::1")) {
+		t.Error("cached list should round-trip")
+	}
+	if !cached.Updated().Equal(old) {
+		t.Errorf("Updated = %v, want cache mtime %v", cached.Updated(), old)
+	}
+}
@@ -0,0 +1,234 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// batchSize is how many ended spans trigger an export before the
+	// interval is up.
+	batchSize = 256
+
+	// maxQueued bounds the spans waiting for export; more are dropped while
+	// the collector is unreachable.
+	maxQueued = 4096
+
+	exportInterval = 5 * time.Second
+	exportTimeout  = 5 * time.Second
+)
+
+// exporter posts ended spans to a collector in batches.
+type exporter struct {
+	endpoint string
+	client   *http.Client
+
+	mu      sync.Mutex
+	queued  []span
+	dropped int
+	failing bool // the last export failed; logged once until one succeeds
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newExporter(endpoint string) *exporter {
+	e := &exporter{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: exportTimeout},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+func (e *exporter) add(s span) {
+	e.mu.Lock()
+	if len(e.queued) >= maxQueued {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queued = append(e.queued, s)
+	full := len(e.queued) >= batchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+	tick := time.NewTicker(exportInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-e.wake:
+		case <-e.stop:
+			return
+		}
+		e.flush(context.Background())
+	}
+}
+
+// close stops the background exports and sends what is left.
+func (e *exporter) close(ctx context.Context) error {
+	close(e.stop)
+	<-e.done
+	return e.flush(ctx)
+}
+
+// flush exports the queued spans. Spans that fail to export are not
+// retried: tracing is for performance, and must not hold memory while the
+// collector is down.
+func (e *exporter) flush(ctx context.Context) error {
+	e.mu.Lock()
+	spans, dropped := e.queued, e.dropped
+	e.queued, e.dropped = nil, 0
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	err := e.post(ctx, spans)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil && !e.failing {
+		log.Printf("Trace export failed: %v", err)
+	}
+	if err == nil && dropped > 0 {
+		log.Printf("Trace export: %d spans dropped while the collector was behind", dropped)
+	}
+	e.failing = err != nil
+	return err
+}
+
+func (e *exporter) post(ctx context.Context, spans []span) error {
+	body, err := json.Marshal(exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{{Key: "service.name", Value: anyValue{StringValue: "dead-drop"}}}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "github.com/scttfrdmn/dead-drop"}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of an export request, as far as it is used.
+// IDs are hex and 64-bit integers strings, as the encoding requires.
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type span struct {
+	TraceID                string     `json:"traceId"`
+	SpanID                 string     `json:"spanId"`
+	ParentSpanID           string     `json:"parentSpanId,omitempty"`
+	Name                   string     `json:"name"`
+	Kind                   int        `json:"kind"`
+	StartTimeUnixNano      string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string     `json:"endTimeUnixNano"`
+	Attributes             []keyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int        `json:"droppedAttributesCount,omitempty"`
+	Status                 *status    `json:"status,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	IntValue    string `json:"intValue,omitempty"`
+	BoolValue   *bool  `json:"boolValue,omitempty"`
+}
+
+type status struct {
+	Code    int    `json:"code"` // 2 = error
+	Message string `json:"message,omitempty"`
+}
+
+// otlpSpan encodes s, reported as running from start to end, with its
+// attributes scrubbed.
+func otlpSpan(s *Span, start, end time.Time) span {
+	attrs, dropped := Scrub(s.attrs)
+	out := span{
+		TraceID:                hex.EncodeToString(s.traceID[:]),
+		SpanID:                 hex.EncodeToString(s.spanID[:]),
+		Name:                   s.name,
+		Kind:                   s.kind,
+		StartTimeUnixNano:      strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:        strconv.FormatInt(end.UnixNano(), 10),
+		DroppedAttributesCount: dropped,
+	}
+	if s.parentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for _, a := range attrs {
+		kv := keyValue{Key: a.Key}
+		switch v := a.Value.(type) {
+		case string:
+			kv.Value.StringValue = v
+		case int:
+			kv.Value.IntValue = strconv.Itoa(v)
+		case int64:
+			kv.Value.IntValue = strconv.FormatInt(v, 10)
+		case bool:
+			kv.Value.BoolValue = &v
+		}
+		out.Attributes = append(out.Attributes, kv)
+	}
+	if s.errClass != "" && !looksIdentifying(s.errClass) {
+		out.Status = &status{Code: 2, Message: s.errClass}
+	}
+	return out
+}
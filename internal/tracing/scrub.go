@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"net/netip"
+	"path"
+	"strings"
+)
+
+// allowedKeys are the only attribute keys exported. None can hold a drop
+// ID, receipt, address, or filename.
+var allowedKeys = map[string]bool{
+	"http.route":                true, // the registered pattern, not the path
+	"http.request.method":       true,
+	"http.response.status_code": true,
+	"http.request.size_bucket":  true,
+	"http.response.size_bucket": true,
+	"storage.operation":         true,
+	"storage.size_bucket":       true,
+	"dead_drop.passphrase":      true, // whether one was given
+	"dead_drop.sealed":          true, // whether the download is sealed to a recipient key
+	"error.class":               true,
+}
+
+// maxTokenRun is the longest run of ID-like characters a string attribute
+// may hold. Drop IDs, receipts, and tokens are longer; the value checks
+// only back up the key list, which is what keeps them out.
+const maxTokenRun = 15
+
+// Scrub returns the attributes that may be exported and how many were
+// dropped: those with a key outside the allowed list, a value of another
+// type than string, int, int64, or bool, or a string value that looks like
+// an IP address, an identifier, or a filename.
+func Scrub(attrs []Attr) ([]Attr, int) {
+	kept := attrs[:0:0]
+	for _, a := range attrs {
+		if allowedKeys[a.Key] && safeValue(a.Value) {
+			kept = append(kept, a)
+		}
+	}
+	return kept, len(attrs) - len(kept)
+}
+
+func safeValue(v any) bool {
+	switch v := v.(type) {
+	case int, int64, bool:
+		return true
+	case string:
+		return !looksIdentifying(v)
+	}
+	return false
+}
+
+// looksIdentifying reports whether s holds an IP address, with or without a
+// port, a long run of ID-like characters, or a file extension.
+func looksIdentifying(s string) bool {
+	if _, err := netip.ParseAddr(s); err == nil {
+		return true
+	}
+	if _, err := netip.ParseAddrPort(s); err == nil {
+		return true
+	}
+	run := 0
+	for _, c := range s {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' {
+			run++
+			if run > maxTokenRun {
+				return true
+			}
+		} else {
+			run = 0
+		}
+	}
+	if ext := path.Ext(s); len(ext) > 1 && !strings.ContainsAny(ext, "{}") {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+// Package tracing records request and storage spans and exports them to a
+// local OpenTelemetry collector over OTLP/HTTP (JSON encoding), without the
+// OpenTelemetry SDK.
+//
+// Spans carry durations, bucketed sizes, and error classes only. Every
+// attribute passes through Scrub before export, which drops any key outside
+// a fixed list and any value that looks like an address, an identifier, or
+// a filename. Start times are rounded down to the minute per trace, keeping
+// the offsets within it, so that a collector's data cannot be lined up with
+// network captures to the second.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"time"
+)
+
+// Span kinds, as numbered by OTLP.
+const (
+	kindInternal = 1
+	kindServer   = 2
+)
+
+// Tracer starts spans and queues them for export when they end. A nil
+// *Tracer starts nil spans, whose methods do nothing, so callers need not
+// check whether tracing is enabled.
+type Tracer struct {
+	exp *exporter
+	now func() time.Time
+}
+
+// New creates a tracer exporting to the OTLP/HTTP traces URL endpoint, such
+// as http://127.0.0.1:4318/v1/traces. Close flushes it.
+func New(endpoint string) *Tracer {
+	return &Tracer{exp: newExporter(endpoint), now: time.Now}
+}
+
+// Close exports the spans still queued and stops the exporter.
+func (t *Tracer) Close(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.exp.close(ctx)
+}
+
+// Span is one timed operation.
+type Span struct {
+	t        *Tracer
+	name     string
+	kind     int
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+
+	// origin is when the trace's root span really started and base the
+	// minute it is reported at; start is this span's real start
+	origin, base, start time.Time
+
+	attrs    []Attr
+	errClass string
+}
+
+// Attr is a span attribute. Values are strings, ints, int64s, or bools.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+type spanKey struct{}
+
+// Start begins a span named name, a child of the span in ctx if any, and
+// returns a context carrying it. A span without a parent is a server span:
+// the root of a request's trace.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{t: t, name: name, kind: kindInternal, start: t.now()}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+		s.origin, s.base = parent.origin, parent.base
+	} else {
+		s.kind = kindServer
+		_, _ = rand.Read(s.traceID[:])
+		s.origin, s.base = s.start, s.start.Truncate(time.Minute)
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttr records an attribute, subject to Scrub at export.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, Attr{key, value})
+}
+
+// SetError marks the span failed with a coarse class of error, such as
+// "locked" or "not_found", never the error's message.
+func (s *Span) SetError(class string) {
+	if s == nil {
+		return
+	}
+	s.errClass = class
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	end := s.t.now()
+	start := s.base.Add(s.start.Sub(s.origin))
+	s.t.exp.add(otlpSpan(s, start, start.Add(end.Sub(s.start))))
+}
@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrub(t *testing.T) {
+	attrs := []Attr{
+		{"http.route", "POST /api/v1/status/{id}"},
+		{"http.response.status_code", 200},
+		{"http.request.size_bucket", "<1MB"},
+		{"dead_drop.passphrase", true},
+		{"client.address", "10.1.2.3"},                  // key not allowed
+		{"http.route", "203.0.113.7"},                   // an address
+		{"http.route", "[2001:db8::1]:443"},             // an address with a port
+		{"http.route", "/drops/k7f3q9xw2m4p8r6t1v5y0z"}, // an ID
+		{"storage.operation", "leaked-memo.pdf"},        // a filename
+		{"http.response.status_code", 3.5},              // type not allowed
+		{"error.class", struct{}{}},                     // type not allowed
+	}
+	kept, dropped := Scrub(attrs)
+	if len(kept) != 4 || dropped != 7 {
+		t.Errorf("kept %v, dropped %d; want the first 4 kept", kept, dropped)
+	}
+}
+
+func TestTracer_Export(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer collector.Close()
+
+	tr := New(collector.URL + "/v1/traces")
+	clock := time.Date(2026, 10, 16, 9, 41, 27, 500_000_000, time.UTC)
+	tr.now = func() time.Time { return clock }
+
+	ctx, root := tr.Start(context.Background(), "POST /submit")
+	root.SetAttr("http.route", "POST /submit")
+	root.SetAttr("file.name", "memo.docx")
+	clock = clock.Add(time.Second)
+	_, child := tr.Start(ctx, "storage.save")
+	child.SetAttr("storage.size_bucket", "<16MB")
+	child.SetError("quota")
+	clock = clock.Add(2 * time.Second)
+	child.End()
+	root.End()
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var req exportRequest
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatal(err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("%d spans exported, want 2", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.TraceID != r.TraceID || c.ParentSpanID != r.SpanID || r.ParentSpanID != "" {
+		t.Errorf("child %s/%s not under root %s/%s", c.TraceID, c.ParentSpanID, r.TraceID, r.SpanID)
+	}
+	if r.Kind != kindServer || c.Kind != kindInternal {
+		t.Errorf("kinds = %d, %d", r.Kind, c.Kind)
+	}
+
+	// Reported from the minute, keeping offsets and durations
+	minute := time.Date(2026, 10, 16, 9, 41, 0, 0, time.UTC)
+	for _, check := range []struct {
+		got  string
+		want time.Time
+	}{
+		{r.StartTimeUnixNano, minute},
+		{r.EndTimeUnixNano, minute.Add(3 * time.Second)},
+		{c.StartTimeUnixNano, minute.Add(time.Second)},
+		{c.EndTimeUnixNano, minute.Add(3 * time.Second)},
+	} {
+		if check.got != strconv.FormatInt(check.want.UnixNano(), 10) {
+			t.Errorf("time %s, want %v", check.got, check.want)
+		}
+	}
+
+	if r.DroppedAttributesCount != 1 || len(r.Attributes) != 1 {
+		t.Errorf("root attributes %+v, dropped %d", r.Attributes, r.DroppedAttributesCount)
+	}
+	if c.Status == nil || c.Status.Code != 2 || c.Status.Message != "quota" {
+		t.Errorf("child status = %+v", c.Status)
+	}
+}
+
+func TestTracer_Nil(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "x")
+	span.SetAttr("http.route", "/")
+	span.SetError("internal")
+	span.End()
+	if ctx == nil || tr.Close(ctx) != nil {
+		t.Error("nil tracer should do nothing")
+	}
+}
+
+func TestTracer_CollectorDown(t *testing.T) {
+	tr := New("http://127.0.0.1:1/v1/traces")
+	_, span := tr.Start(context.Background(), "GET /")
+	span.End()
+	if err := tr.Close(context.Background()); err == nil || !strings.Contains(err.Error(), "127.0.0.1:1") {
+		t.Errorf("Close error = %v, want the failed export", err)
+	}
+}
@@ -0,0 +1,60 @@
+package triage
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"a.txt", "b.txt", "c/d.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	zw.Close()
+
+	pdf := []byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R 5 0 R] /Count 3 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R >> endobj\n")
+
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want Stats
+		str  string
+	}{
+		{"png", img.Bytes(), Stats{Type: "image/png", Width: 640, Height: 480}, "png 640x480"},
+		{"zip", archive.Bytes(), Stats{Type: "application/zip", Entries: 3}, "zip 3 entries"},
+		{"pdf", pdf, Stats{Type: "application/pdf", Pages: 3}, "pdf 3p"},
+		{"text", []byte("four words of text\n"), Stats{Type: "text/plain", Words: 4}, "plain 4 words"},
+		{"pdf without page tree", []byte("%PDF-1.4\n<< /Type /Page >> << /Type/Page >>"), Stats{Type: "application/pdf", Pages: 2}, "pdf 2p"},
+	} {
+		got := Summarize(tc.data)
+		if *got != tc.want {
+			t.Errorf("%s: Summarize = %+v, want %+v", tc.name, *got, tc.want)
+		}
+		if got.String() != tc.str {
+			t.Errorf("%s: String = %q, want %q", tc.name, got.String(), tc.str)
+		}
+	}
+}
+
+func TestSummarize_Truncated(t *testing.T) {
+	// Corrupt headers leave the fields unset rather than failing
+	s := Summarize([]byte("\x89PNG\r\n\x1a\n\x00\x00"))
+	if s.Type != "image/png" || s.Width != 0 {
+		t.Errorf("Summarize = %+v", *s)
+	}
+}
@@ -0,0 +1,312 @@
+package validation
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// DefaultMaxNesting is the deepest chain of nested archives accepted when
+// Validator.MaxNesting is unset.
+const DefaultMaxNesting = 3
+
+// ErrLimitExceeded is returned when inspecting a file would take more work
+// than the validator's resource limits allow.
+var ErrLimitExceeded = errors.New("file exceeds inspection limits")
+
+// ErrUnsafeEntry is returned for an archive entry or link whose path leads
+// outside the directory it would be extracted to (zip-slip).
+var ErrUnsafeEntry = errors.New("archive entry path escapes the archive")
+
+// ErrUninspectableEntry is returned for an archive entry whose contents
+// cannot be read to be checked, such as an encrypted ZIP entry or one
+// compressed with a method the validator does not support.
+var ErrUninspectableEntry = errors.New("archive entry cannot be inspected")
+
+var (
+	// zipMagic is the local file header signature a ZIP archive starts with.
+	zipMagic = []byte("PK\x03\x04")
+	// gzipMagic starts a gzip stream, such as a .tar.gz.
+	gzipMagic = []byte{0x1f, 0x8b}
+	// tarMagic is the ustar (and GNU tar) magic, at tarMagicOffset.
+	tarMagic = []byte("ustar")
+)
+
+const (
+	// zipEncrypted is the general purpose flag bit marking an encrypted ZIP
+	// entry.
+	zipEncrypted = 0x1
+
+	tarMagicOffset = 257
+	// headSize is how much of each entry is read to recognize executables
+	// and archives; it covers the tar magic.
+	headSize = 512
+)
+
+// checkArchive looks inside ZIP, tar, and gzip uploads for entries that
+// would be refused as uploads of their own (executables, scripts), entries
+// that would extract outside their directory, entries that cannot be read
+// (encrypted, or compressed with an unsupported method), and archives
+// nested deeper than MaxNesting. At most MaxExaminedBytes are decompressed in total.
+// Other files, and archives that cannot be opened, pass unchanged.
+func (v *Validator) checkArchive(ctx context.Context, data []byte) error {
+	if archiveKind(data) == "" {
+		return nil
+	}
+	w := &archiveWalk{v: v, ctx: ctx, maxDepth: v.MaxNesting, budget: v.MaxExaminedBytes}
+	if w.maxDepth <= 0 {
+		w.maxDepth = DefaultMaxNesting
+	}
+	if w.budget <= 0 {
+		w.budget = v.MaxSizeBytes
+	}
+	return w.archive(data, bytes.NewReader(data), 0)
+}
+
+// archiveKind returns "zip", "tar" or "gzip" for the archive formats head
+// starts, and "" for anything else.
+func archiveKind(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		return "zip"
+	case bytes.HasPrefix(head, gzipMagic):
+		return "gzip"
+	case len(head) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(head[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return "tar"
+	}
+	return ""
+}
+
+// archiveWalk holds the limits of one upload's inspection.
+type archiveWalk struct {
+	v        *Validator
+	ctx      context.Context
+	maxDepth int
+	budget   int64 // decompressed bytes left to read
+}
+
+// archive inspects the archive that head starts and r holds whole, which
+// sits depth levels below the upload. A ZIP archive must be read into
+// memory, so r is then a *bytes.Reader.
+func (w *archiveWalk) archive(head []byte, r io.Reader, depth int) error {
+	switch archiveKind(head) {
+	case "zip":
+		br, ok := r.(*bytes.Reader)
+		if !ok {
+			return nil
+		}
+		return w.zip(br, depth)
+	case "tar":
+		return w.tar(r, depth)
+	case "gzip":
+		// A compressed stream is part of the archive it holds, not a level
+		// of its own
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil
+		}
+		inner := bufio.NewReaderSize(&budgetReader{r: zr, budget: &w.budget}, headSize)
+		innerHead, err := inner.Peek(headSize)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+			return limitErr(err)
+		}
+		if archiveKind(innerHead) == "tar" {
+			return w.tar(inner, depth)
+		}
+		// A lone compressed file
+		return w.inspect("", inner, 0, depth)
+	}
+	return nil
+}
+
+func (w *archiveWalk) zip(r *bytes.Reader, depth int) error {
+	zr, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		return nil
+	}
+	for _, f := range zr.File {
+		if err := w.ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %v", ErrLimitExceeded, err)
+		}
+		if unsafePath(f.Name) {
+			return ErrUnsafeEntry
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		// An entry that cannot be read could hide anything the checks
+		// refuse, so it is refused itself
+		if f.Flags&zipEncrypted != 0 {
+			return fmt.Errorf("%w: %s is encrypted", ErrUninspectableEntry, f.Name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrUninspectableEntry, f.Name, err)
+		}
+		if f.Mode()&fs.ModeSymlink != 0 {
+			// A ZIP symlink's content is its target
+			target, err := io.ReadAll(io.LimitReader(&budgetReader{r: rc, budget: &w.budget}, headSize))
+			rc.Close()
+			if err != nil {
+				return limitErr(err)
+			}
+			if unsafeLink(f.Name, string(target)) {
+				return ErrUnsafeEntry
+			}
+			continue
+		}
+		err = w.entry(f.Name, rc, f.UncompressedSize64, depth)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *archiveWalk) tar(r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		if err := w.ctx.Err(); err != nil {
+			return fmt.Errorf("%w: %v", ErrLimitExceeded, err)
+		}
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			// A corrupt archive passes, as elsewhere; running out of budget
+			// does not
+			if errors.Is(err, ErrLimitExceeded) {
+				return err
+			}
+			return nil
+		}
+		if unsafePath(h.Name) {
+			return ErrUnsafeEntry
+		}
+		switch h.Typeflag {
+		case tar.TypeReg, tar.TypeGNUSparse:
+			// A sparse file reads back with its holes filled in
+			if err := w.entry(h.Name, tr, uint64(max(h.Size, 0)), depth); err != nil { // #nosec G115 -- clamped to 0
+				return err
+			}
+		case tar.TypeSymlink:
+			if unsafeLink(h.Name, h.Linkname) {
+				return ErrUnsafeEntry
+			}
+		case tar.TypeLink:
+			// Hard link targets are named from the archive root
+			if unsafePath(h.Linkname) {
+				return ErrUnsafeEntry
+			}
+		}
+	}
+}
+
+// entry checks one file in an archive at depth, read from r, whose declared
+// size is size (0 when unknown), and descends into it if it is an archive.
+func (w *archiveWalk) entry(name string, r io.Reader, size uint64, depth int) error {
+	return w.inspect(name, bufio.NewReaderSize(&budgetReader{r: r, budget: &w.budget}, headSize), size, depth)
+}
+
+// inspect is entry for a reader already charged to the budget.
+func (w *archiveWalk) inspect(name string, br *bufio.Reader, size uint64, depth int) error {
+	head, err := br.Peek(headSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		if errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+		return nil
+	}
+	if err := w.v.validateSpecificType(name, head); err != nil {
+		return fmt.Errorf("archive entry: %w", err)
+	}
+
+	kind := archiveKind(head)
+	if kind == "" {
+		return nil
+	}
+	if depth+1 > w.maxDepth {
+		return fmt.Errorf("%w: archives nested more than %d deep", ErrLimitExceeded, w.maxDepth)
+	}
+	if kind != "zip" {
+		return w.archive(head, br, depth+1)
+	}
+
+	// A ZIP archive is read whole, its declared size checked first so that
+	// a bomb is refused unread
+	if size > uint64(w.budget+int64(len(head))) { // #nosec G115 -- budget is not negative
+		return fmt.Errorf("%w: nested archives expand too far", ErrLimitExceeded)
+	}
+	nested, err := io.ReadAll(br)
+	if err != nil {
+		return limitErr(err)
+	}
+	return w.archive(head, bytes.NewReader(nested), depth+1)
+}
+
+// limitErr returns err if it is ErrLimitExceeded, and nil for other read
+// errors, which leave an archive as corrupt and so passed.
+func limitErr(err error) error {
+	if errors.Is(err, ErrLimitExceeded) {
+		return err
+	}
+	return nil
+}
+
+// budgetReader charges every byte read to budget and fails with
+// ErrLimitExceeded once it is spent.
+type budgetReader struct {
+	r      io.Reader
+	budget *int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if *b.budget <= 0 {
+		// Reaching the end exactly on budget is not exceeding it
+		var probe [1]byte
+		if n, err := b.r.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: archives expand too far", ErrLimitExceeded)
+	}
+	if int64(len(p)) > *b.budget {
+		p = p[:*b.budget]
+	}
+	n, err := b.r.Read(p)
+	*b.budget -= int64(n)
+	return n, err
+}
+
+// unsafePath reports whether an entry named name would be extracted outside
+// the directory the archive is extracted to: an absolute path, a Windows
+// drive or UNC path, or one climbing out with "..".
+func unsafePath(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return true
+	}
+	clean := path.Clean(name)
+	return clean == ".." || strings.HasPrefix(clean, "../")
+}
+
+// unsafeLink reports whether a symlink named name pointing at target leads
+// outside the archive.
+func unsafeLink(name, target string) bool {
+	target = strings.ReplaceAll(target, `\`, "/")
+	if strings.HasPrefix(target, "/") || (len(target) >= 2 && target[1] == ':') {
+		return true
+	}
+	return unsafePath(path.Join(path.Dir(strings.ReplaceAll(name, `\`, "/")), target))
+}
@@ -0,0 +1,269 @@
+package validation
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+// buildZip returns a ZIP archive holding the given files.
+func buildZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// nestZip wraps a document in depth levels of ZIP archives.
+func nestZip(t *testing.T, depth int) []byte {
+	t.Helper()
+	data := buildZip(t, map[string][]byte{"doc.txt": []byte("hello")})
+	for i := 1; i < depth; i++ {
+		data = buildZip(t, map[string][]byte{"inner.zip": data})
+	}
+	return data
+}
+
+func TestValidateFile_NestedArchives(t *testing.T) {
+	v := NewValidator(10)
+
+	// The upload plus DefaultMaxNesting levels inside it is accepted
+	if _, err := v.ValidateFile("ok.zip", bytes.NewReader(nestZip(t, DefaultMaxNesting+1))); err != nil {
+		t.Fatalf("nesting at the limit rejected: %v", err)
+	}
+	_, err := v.ValidateFile("deep.zip", bytes.NewReader(nestZip(t, DefaultMaxNesting+2)))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("err = %v, want ErrLimitExceeded", err)
+	}
+
+	v.MaxNesting = 1
+	if _, err := v.ValidateFile("two.zip", bytes.NewReader(nestZip(t, 3))); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("MaxNesting 1: err = %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestValidateFile_NestedArchiveBudget(t *testing.T) {
+	v := NewValidator(10)
+	inner := buildZip(t, map[string][]byte{"zeros.bin": make([]byte, 64*1024)})
+	outer := buildZip(t, map[string][]byte{"inner.zip": inner})
+
+	// The nested archive, and the head of the file inside it
+	v.MaxExaminedBytes = int64(len(inner)) + headSize
+	if _, err := v.ValidateFile("outer.zip", bytes.NewReader(outer)); err != nil {
+		t.Fatalf("archive within budget rejected: %v", err)
+	}
+	v.MaxExaminedBytes = int64(len(inner)) - 1
+	if _, err := v.ValidateFile("outer.zip", bytes.NewReader(outer)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err = %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestValidateFileContext_Deadline(t *testing.T) {
+	v := NewValidator(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := v.ValidateFileContext(ctx, "a.zip", bytes.NewReader(nestZip(t, 2)))
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err = %v, want ErrLimitExceeded", err)
+	}
+	// Files that need no inspection are unaffected
+	if _, err := v.ValidateFileContext(ctx, "a.txt", bytes.NewReader([]byte("hello"))); err != nil {
+		t.Errorf("plain text rejected: %v", err)
+	}
+}
+
+// buildTar returns a tar archive holding the given headers, with body as
+// the content of every regular file.
+func buildTar(t *testing.T, body []byte, headers ...*tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(body))
+		}
+		h.Mode = 0600
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(body); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rawZip returns a ZIP archive of one entry stored as given, without
+// compressing it, so that its method and flags need not be supported.
+func rawZip(t *testing.T, h *zip.FileHeader, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sparseTar returns a GNU tar archive of one old-style sparse file whose
+// only data is body, at its start.
+func sparseTar(t *testing.T, body []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	h := &tar.Header{Name: "tool", Typeflag: tar.TypeReg, Size: int64(len(body)), Mode: 0600, Format: tar.FormatGNU}
+	if err := tw.WriteHeader(h); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(body); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Turn the header into a sparse one: the type flag, one sparse entry
+	// and the real size, then the checksum
+	data := buf.Bytes()
+	hdr := data[:512]
+	hdr[156] = tar.TypeGNUSparse
+	size := fmt.Sprintf("%011o\x00", len(body))
+	copy(hdr[386:], fmt.Sprintf("%011o\x00", 0))
+	copy(hdr[398:], size)
+	copy(hdr[483:], size)
+	copy(hdr[148:156], "        ")
+	sum := 0
+	for _, b := range hdr {
+		sum += int(b)
+	}
+	copy(hdr[148:], fmt.Sprintf("%06o\x00 ", sum))
+	return data
+}
+
+func TestValidateFile_ArchiveContents(t *testing.T) {
+	v := NewValidator(10)
+	elf := []byte("\x7fELF\x02\x01\x01\x00 not really")
+	text := []byte("hello")
+	reg := func(name string) *tar.Header { return &tar.Header{Name: name, Typeflag: tar.TypeReg} }
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"docs.zip", buildZip(t, map[string][]byte{"notes/a.txt": text, "b.txt": text}), true},
+		{"docs.tar", buildTar(t, text, &tar.Header{Name: "notes/", Typeflag: tar.TypeDir}, reg("notes/a.txt")), true},
+		{"docs.tar.gz", gzipped(t, buildTar(t, text, reg("a.txt"))), true},
+		{"link.tar", buildTar(t, text, reg("a/b.txt"), &tar.Header{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "b.txt"}), true},
+
+		{"elf.zip", buildZip(t, map[string][]byte{"tool": elf}), false},
+		{"script.zip", buildZip(t, map[string][]byte{"run": []byte("#!/bin/sh\nrm -rf ~")}), false},
+		{"ext.zip", buildZip(t, map[string][]byte{"setup.exe": text}), false},
+		{"elf.tar.gz", gzipped(t, buildTar(t, elf, reg("tool"))), false},
+		{"elf.gz", gzipped(t, elf), false},
+		{"nested.zip", buildZip(t, map[string][]byte{"inner.tar": buildTar(t, elf, reg("tool"))}), false},
+
+		{"slip.zip", buildZip(t, map[string][]byte{"../../etc/cron.d/x": text}), false},
+		{"abs.zip", buildZip(t, map[string][]byte{"/etc/passwd": text}), false},
+		{"win.zip", buildZip(t, map[string][]byte{`..\..\boot.ini`: text}), false},
+		{"slip.tar", buildTar(t, text, reg("a/../../x")), false},
+		{"symlink.tar", buildTar(t, text, &tar.Header{Name: "a/c", Typeflag: tar.TypeSymlink, Linkname: "../../etc"}), false},
+		{"hardlink.tar", buildTar(t, text, &tar.Header{Name: "c", Typeflag: tar.TypeLink, Linkname: "/etc/shadow"}), false},
+
+		{"encrypted.zip", rawZip(t, &zip.FileHeader{Name: "a.txt", Method: zip.Store, Flags: 0x1,
+			CompressedSize64: uint64(len(text)), UncompressedSize64: uint64(len(text)), CRC32: crc32.ChecksumIEEE(text)}, text), false},
+		{"aes.zip", rawZip(t, &zip.FileHeader{Name: "a.txt", Method: 99,
+			CompressedSize64: uint64(len(text)), UncompressedSize64: uint64(len(text))}, text), false},
+		{"sparse.tar", sparseTar(t, elf), false},
+		{"sparse-text.tar", sparseTar(t, text), true},
+	}
+	for _, tt := range tests {
+		_, err := v.ValidateFile(tt.name, bytes.NewReader(tt.data))
+		if tt.ok && err != nil {
+			t.Errorf("%s: rejected: %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+
+	_, err := v.ValidateFile("slip.zip", bytes.NewReader(tests[10].data))
+	if !errors.Is(err, ErrUnsafeEntry) {
+		t.Errorf("zip-slip: err = %v, want ErrUnsafeEntry", err)
+	}
+	for _, name := range []string{"encrypted.zip", "aes.zip"} {
+		for _, tt := range tests {
+			if tt.name != name {
+				continue
+			}
+			if _, err := v.ValidateFile(name, bytes.NewReader(tt.data)); !errors.Is(err, ErrUninspectableEntry) {
+				t.Errorf("%s: err = %v, want ErrUninspectableEntry", name, err)
+			}
+		}
+	}
+}
+
+func TestValidateFile_CompressedBomb(t *testing.T) {
+	v := NewValidator(10)
+	bomb := gzipped(t, buildTar(t, make([]byte, 4<<20), &tar.Header{Name: "zeros", Typeflag: tar.TypeReg}))
+
+	// Only the head of a plain file is read, so a large one passes
+	if _, err := v.ValidateFile("big.tar.gz", bytes.NewReader(bomb)); err != nil {
+		t.Fatalf("rejected: %v", err)
+	}
+	nested := buildZip(t, map[string][]byte{"inner.zip": buildZip(t, map[string][]byte{"zeros": make([]byte, 4<<20)})})
+	v.MaxExaminedBytes = 1 << 20
+	if _, err := v.ValidateFile("ok.zip", bytes.NewReader(nested)); err != nil {
+		t.Errorf("nested archive within budget rejected: %v", err)
+	}
+	// Walking a nested archive reads all of it
+	big := buildTar(t, make([]byte, 2<<20), &tar.Header{Name: "big.bin", Typeflag: tar.TypeReg})
+	outer := gzipped(t, buildTar(t, big, &tar.Header{Name: "inner.tar", Typeflag: tar.TypeReg}))
+	if _, err := v.ValidateFile("bomb.tar.gz", bytes.NewReader(outer)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err = %v, want ErrLimitExceeded", err)
+	}
+}
@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"math"
+	"net/http"
+)
+
+// DefaultEntropyThreshold is the Shannon entropy (bits per byte) at or above
+// which an unrecognized upload is treated as encrypted or random data.
+const DefaultEntropyThreshold = 7.5
+
+// minEntropySample is the smallest input for which entropy is meaningful.
+// Short inputs cannot reach high entropy regardless of their content.
+const minEntropySample = 1024
+
+// EntropyMeter accumulates a byte histogram so that Shannon entropy can be
+// computed over a stream without buffering it.
+type EntropyMeter struct {
+	counts [256]int64
+	total  int64
+}
+
+// Write records the byte frequencies of p. It never returns an error.
+func (e *EntropyMeter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		e.counts[b]++
+	}
+	e.total += int64(len(p))
+	return len(p), nil
+}
+
+// Total returns the number of bytes observed.
+func (e *EntropyMeter) Total() int64 {
+	return e.total
+}
+
+// Entropy returns the Shannon entropy of the observed bytes in bits per byte (0-8).
+func (e *EntropyMeter) Entropy() float64 {
+	if e.total == 0 {
+		return 0
+	}
+	total := float64(e.total)
+	var h float64
+	for _, c := range e.counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / total
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// ShannonEntropy returns the entropy of data in bits per byte.
+func ShannonEntropy(data []byte) float64 {
+	var m EntropyMeter
+	_, _ = m.Write(data)
+	return m.Entropy()
+}
+
+// LooksOpaque reports whether data has no recognizable content type and an
+// entropy at or above threshold, which is typical of ciphertext or random
+// blobs. Recognized formats (JPEG, ZIP, PDF, ...) are compressed and naturally
+// high-entropy, so they are never reported. A threshold <= 0 selects
+// DefaultEntropyThreshold.
+func LooksOpaque(data []byte, threshold float64) bool {
+	if len(data) < minEntropySample {
+		return false
+	}
+	if threshold <= 0 {
+		threshold = DefaultEntropyThreshold
+	}
+	if http.DetectContentType(data) != "application/octet-stream" {
+		return false
+	}
+	return ShannonEntropy(data) >= threshold
+}
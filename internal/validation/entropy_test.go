@@ -0,0 +1,95 @@
+package validation
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math"
+	"testing"
+)
+
+func TestShannonEntropy_Uniform(t *testing.T) {
+	data := make([]byte, 256*16)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if h := ShannonEntropy(data); math.Abs(h-8) > 1e-9 {
+		t.Errorf("entropy = %f, want 8", h)
+	}
+}
+
+func TestShannonEntropy_Constant(t *testing.T) {
+	if h := ShannonEntropy(bytes.Repeat([]byte{'a'}, 4096)); h != 0 {
+		t.Errorf("entropy = %f, want 0", h)
+	}
+}
+
+func TestShannonEntropy_Empty(t *testing.T) {
+	if h := ShannonEntropy(nil); h != 0 {
+		t.Errorf("entropy = %f, want 0", h)
+	}
+}
+
+func TestEntropyMeter_Streaming(t *testing.T) {
+	data := make([]byte, 8192)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	var m EntropyMeter
+	for i := 0; i < len(data); i += 1000 {
+		end := min(i+1000, len(data))
+		m.Write(data[i:end])
+	}
+
+	if m.Total() != int64(len(data)) {
+		t.Errorf("Total = %d, want %d", m.Total(), len(data))
+	}
+	if got, want := m.Entropy(), ShannonEntropy(data); math.Abs(got-want) > 1e-9 {
+		t.Errorf("streaming entropy = %f, one-shot = %f", got, want)
+	}
+}
+
+func TestLooksOpaque_RandomData(t *testing.T) {
+	data := make([]byte, 64*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the random prefix isn't sniffed as a known type
+	copy(data, []byte{0x00, 0x01, 0x02, 0x03})
+
+	if !LooksOpaque(data, 0) {
+		t.Error("random data should look opaque")
+	}
+}
+
+func TestLooksOpaque_PlainText(t *testing.T) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 100)
+	if LooksOpaque(data, 0) {
+		t.Error("plain text should not look opaque")
+	}
+}
+
+func TestLooksOpaque_RecognizedFormat(t *testing.T) {
+	data := make([]byte, 64*1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	// ZIP local file header: compressed formats are legitimately high-entropy
+	copy(data, []byte("PK\x03\x04"))
+
+	if LooksOpaque(data, 0) {
+		t.Error("recognized formats should not be flagged")
+	}
+}
+
+func TestLooksOpaque_TooSmall(t *testing.T) {
+	data := make([]byte, 512)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	copy(data, []byte{0x00, 0x01, 0x02, 0x03})
+
+	if LooksOpaque(data, 0) {
+		t.Error("inputs below the sample size should not be flagged")
+	}
+}
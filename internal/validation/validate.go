@@ -2,49 +2,82 @@ package validation
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 )
 
 // Validator handles file validation
 type Validator struct {
+	// AllowedTypes are the detected content types accepted, unless AllowAll
+	// is set
 	AllowedTypes []string
 	MaxSizeBytes int64
+	// BlockedTypes are refused even with AllowAll
 	BlockedTypes []string
+	// BlockedExtensions are filename extensions (".exe") refused, for
+	// uploads and for entries of uploaded archives
+	BlockedExtensions []string
+	// AllowAll accepts content types outside AllowedTypes
+	AllowAll bool
+
+	// MaxNesting is the deepest chain of archives within an uploaded
+	// archive that is accepted; 0 = DefaultMaxNesting
+	MaxNesting int
+	// MaxExaminedBytes caps the bytes decompressed while looking inside
+	// archives; 0 = MaxSizeBytes
+	MaxExaminedBytes int64
 }
 
-// NewValidator creates a new file validator
+var (
+	// DefaultAllowedTypes are common document and image types.
+	DefaultAllowedTypes = []string{
+		"image/jpeg",
+		"image/png",
+		"image/gif",
+		"image/webp",
+		"application/pdf",
+		"text/plain",
+		"application/zip",
+		"application/x-zip-compressed",
+		"application/msword",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	}
+	// DefaultBlockedTypes are potentially dangerous types.
+	DefaultBlockedTypes = []string{
+		"application/x-executable",
+		"application/x-sh",
+		"application/x-shellscript",
+		"text/x-sh",
+		"application/x-msdos-program",
+	}
+	// DefaultBlockedExtensions are executables, libraries, and scripts.
+	DefaultBlockedExtensions = []string{".exe", ".dll", ".so", ".dylib", ".sh", ".bat", ".cmd", ".com", ".scr"}
+)
+
+// NewValidator creates a new file validator with the default lists, which
+// accepts any type not blocked
 func NewValidator(maxSizeMB int64) *Validator {
 	return &Validator{
-		MaxSizeBytes: maxSizeMB * 1024 * 1024,
-		// Allow common document and image types
-		AllowedTypes: []string{
-			"image/jpeg",
-			"image/png",
-			"image/gif",
-			"image/webp",
-			"application/pdf",
-			"text/plain",
-			"application/zip",
-			"application/x-zip-compressed",
-			"application/msword",
-			"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
-		},
-		// Block potentially dangerous types
-		BlockedTypes: []string{
-			"application/x-executable",
-			"application/x-sh",
-			"application/x-shellscript",
-			"text/x-sh",
-			"application/x-msdos-program",
-		},
+		MaxSizeBytes:      maxSizeMB * 1024 * 1024,
+		AllowedTypes:      slices.Clone(DefaultAllowedTypes),
+		BlockedTypes:      slices.Clone(DefaultBlockedTypes),
+		BlockedExtensions: slices.Clone(DefaultBlockedExtensions),
+		AllowAll:          true,
 	}
 }
 
 // ValidateFile checks if file meets security requirements
 func (v *Validator) ValidateFile(filename string, reader io.Reader) ([]byte, error) {
+	return v.ValidateFileContext(context.Background(), filename, reader)
+}
+
+// ValidateFileContext is ValidateFile bounded by ctx: inspection stops with
+// ErrLimitExceeded once ctx is done.
+func (v *Validator) ValidateFileContext(ctx context.Context, filename string, reader io.Reader) ([]byte, error) {
 	// Read file data
 	data, err := io.ReadAll(io.LimitReader(reader, v.MaxSizeBytes+1))
 	if err != nil {
@@ -65,12 +98,19 @@ func (v *Validator) ValidateFile(filename string, reader io.Reader) ([]byte, err
 			return nil, fmt.Errorf("file type not allowed: %s", contentType)
 		}
 	}
+	if !v.AllowAll && !v.allowed(contentType) {
+		return nil, fmt.Errorf("file type not allowed: %s", contentType)
+	}
 
 	// Additional checks for specific file types
 	if err := v.validateSpecificType(filename, data); err != nil {
 		return nil, err
 	}
 
+	if err := v.checkArchive(ctx, data); err != nil {
+		return nil, err
+	}
+
 	return data, nil
 }
 
@@ -104,9 +144,8 @@ func (v *Validator) validateSpecificType(filename string, data []byte) error {
 
 	// Check filename extension for additional safety
 	lower := strings.ToLower(filename)
-	dangerousExts := []string{".exe", ".dll", ".so", ".dylib", ".sh", ".bat", ".cmd", ".com", ".scr"}
-	for _, ext := range dangerousExts {
-		if strings.HasSuffix(lower, ext) {
+	for _, ext := range v.BlockedExtensions {
+		if strings.HasSuffix(lower, strings.ToLower(ext)) {
 			return fmt.Errorf("file extension not allowed: %s", ext)
 		}
 	}
@@ -114,6 +153,18 @@ func (v *Validator) validateSpecificType(filename string, data []byte) error {
 	return nil
 }
 
+// allowed reports whether contentType, as detected, is in AllowedTypes.
+// Parameters such as charset are ignored.
+func (v *Validator) allowed(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	for _, t := range v.AllowedTypes {
+		if strings.EqualFold(strings.TrimSpace(mediaType), t) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetContentType returns the detected content type
 func (v *Validator) GetContentType(data []byte) string {
 	return http.DetectContentType(data)
@@ -141,6 +141,28 @@ func TestValidateFile_SafeExtensions(t *testing.T) {
 	}
 }
 
+func TestValidateFile_ConfiguredLists(t *testing.T) {
+	v := NewValidator(10)
+	v.AllowAll = false
+	v.AllowedTypes = []string{"text/plain", "application/pdf"}
+	v.BlockedExtensions = []string{".docm"}
+
+	// Parameters of the detected type, such as charset, are ignored
+	if _, err := v.ValidateFile("notes.txt", bytes.NewReader([]byte("plain text"))); err != nil {
+		t.Errorf("allowed type refused: %v", err)
+	}
+	if _, err := v.ValidateFile("photo.png", bytes.NewReader([]byte("\x89PNG\r\n\x1a\n0000"))); err == nil {
+		t.Error("type outside AllowedTypes accepted")
+	}
+	if _, err := v.ValidateFile("macro.DOCM", bytes.NewReader([]byte("plain text"))); err == nil {
+		t.Error("configured extension accepted")
+	}
+	// The configured list replaces the built-in one
+	if _, err := v.ValidateFile("run.bat", bytes.NewReader([]byte("plain text"))); err != nil {
+		t.Errorf("extension no longer blocked refused: %v", err)
+	}
+}
+
 func TestValidateFile_SmallDataSkipsMagicCheck(t *testing.T) {
 	v := NewValidator(10)
 	// Data too short for magic number check (<=4 bytes)
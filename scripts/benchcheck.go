@@ -0,0 +1,122 @@
+//go:build ignore
+
+// benchcheck compares two sets of `go test -bench` results and fails if any
+// benchmark got slower than the allowed threshold.
+//
+//	go run scripts/benchcheck.go [-threshold 20] baseline.txt new.txt
+//
+// With -count > 1 the median ns/op of each benchmark is compared, which keeps
+// a single noisy run from failing the check.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	threshold := flag.Float64("threshold", 20, "allowed slowdown in percent")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: benchcheck [-threshold pct] baseline.txt new.txt")
+		os.Exit(2)
+	}
+
+	base, err := parse(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cur, err := parse(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	names := make([]string, 0, len(cur))
+	for name := range cur {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	regressions := 0
+	fmt.Printf("%-40s %14s %14s %8s\n", "benchmark", "baseline ns/op", "new ns/op", "delta")
+	for _, name := range names {
+		newNs := median(cur[name])
+		baseRuns, ok := base[name]
+		if !ok {
+			fmt.Printf("%-40s %14s %14.0f %8s\n", name, "-", newNs, "new")
+			continue
+		}
+		baseNs := median(baseRuns)
+		delta := (newNs - baseNs) / baseNs * 100
+		mark := ""
+		if delta > *threshold {
+			mark = "  REGRESSION"
+			regressions++
+		}
+		fmt.Printf("%-40s %14.0f %14.0f %+7.1f%%%s\n", name, baseNs, newNs, delta, mark)
+	}
+
+	if regressions > 0 {
+		fmt.Printf("\n%d benchmark(s) slower than the %.0f%% threshold\n", regressions, *threshold)
+		os.Exit(1)
+	}
+}
+
+// parse returns the ns/op samples of each benchmark in a results file,
+// keyed by package-qualified name.
+func parse(path string) (map[string][]float64, error) {
+	f, err := os.Open(path) // #nosec G304 -- path from the command line
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	results := make(map[string][]float64)
+	pkg := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "pkg:" {
+			pkg = fields[1][strings.LastIndex(fields[1], "/")+1:]
+			continue
+		}
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || fields[3] != "ns/op" {
+			continue
+		}
+		ns, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			continue
+		}
+		// Drop the -GOMAXPROCS suffix so results from different machines match
+		name := fields[0]
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+		results[pkg+"."+name] = append(results[pkg+"."+name], ns)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("%s: no benchmark results", path)
+	}
+	return results, nil
+}
+
+func median(v []float64) float64 {
+	s := append([]float64(nil), v...)
+	sort.Float64s(s)
+	if len(s)%2 == 1 {
+		return s[len(s)/2]
+	}
+	return (s[len(s)/2-1] + s[len(s)/2]) / 2
+}